@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// callerAllowed reports whether principal matches one of the allowed caller
+// patterns. Patterns are API key prefixes ("tsk_live"), signing key IDs
+// ("hmac:billing") or globs over either ("tsk_*"). An empty list allows everyone.
+func callerAllowed(principal string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	if principal == "" {
+		return false
+	}
+	for _, pattern := range allowed {
+		if ok, err := path.Match(pattern, principal); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAllowedCallers rejects malformed caller patterns
+func validateAllowedCallers(allowed []string) error {
+	for _, pattern := range allowed {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return &render.Error{Message: fmt.Sprintf("invalid allowedCallers pattern %q", pattern), Status: http.StatusBadRequest}
+		}
+	}
+	return nil
+}
+
+// authorizeTemplateCaller rejects renders of restricted stored templates by
+// callers that are not on their list
+func authorizeTemplateCaller(ctx context.Context, req renderRequest) error {
+	if callerAllowed(renderCallerFrom(ctx).Principal, req.AllowedCallers) {
+		return nil
+	}
+	return &render.Error{Message: fmt.Sprintf("caller is not allowed to render template %q", req.TemplateName), Status: http.StatusForbidden}
+}
+
+// templateReadable reports whether the caller of c may read the stored
+// template. The restriction of the latest version applies to all versions.
+func templateReadable(c echo.Context, name string) (bool, error) {
+	current, err := templateStore.get(name)
+	if errors.Is(err, errTemplateNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return callerAllowed(renderCallerFrom(c.Request().Context()).Principal, current.AllowedCallers), nil
+}
+
+// templateAccessDenied answers a failed templateReadable check
+func templateAccessDenied(c echo.Context, err error) error {
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusForbidden, map[string]string{"error": "caller is not allowed to access this template"})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+func TestCallerAllowed(t *testing.T) {
+	tests := []struct {
+		principal string
+		allowed   []string
+		expected  bool
+	}{
+		{"", nil, true},
+		{"tsk_live", nil, true},
+		{"", []string{"tsk_live"}, false},
+		{"tsk_live", []string{"tsk_live"}, true},
+		{"tsk_test", []string{"tsk_live"}, false},
+		{"tsk_ci01", []string{"tsk_live", "tsk_ci*"}, true},
+		{"hmac:contracts", []string{"hmac:contracts"}, true},
+		{"hmac:billing", []string{"hmac:contracts"}, false},
+	}
+	for _, tt := range tests {
+		if got := callerAllowed(tt.principal, tt.allowed); got != tt.expected {
+			t.Errorf("callerAllowed(%q, %v) = %v, want %v", tt.principal, tt.allowed, got, tt.expected)
+		}
+	}
+}
+
+func TestRenderTemplate_AllowedCallers(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if _, err := saveTemplate("contract", &templateInput{Text: "v1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveTemplate("contract", &templateInput{Text: "v2", AllowedCallers: []string{"tsk_lgl1"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	renderAs := func(principal string, version int) error {
+		ctx := withRenderCaller(context.Background(), renderCaller{Principal: principal})
+		_, err := renderTemplate(ctx, renderRequest{TemplateName: "contract", TemplateVersion: version})
+		return err
+	}
+	if err := renderAs("tsk_lgl1", 0); err != nil {
+		t.Errorf("Allowed caller rejected: %v", err)
+	}
+	if re, ok := renderAs("tsk_othr", 0).(*render.Error); !ok || re.Status != http.StatusForbidden {
+		t.Errorf("Expected 403 for another caller, got %v", re)
+	}
+	// The unrestricted first version is still covered by the latest restriction
+	if re, ok := renderAs("tsk_othr", 1).(*render.Error); !ok || re.Status != http.StatusForbidden {
+		t.Errorf("Expected 403 for an earlier version, got %v", re)
+	}
+}
+
+func TestTemplateHandlers_AllowedCallers(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if _, err := saveTemplate("public", &templateInput{Text: "p"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveTemplate("contract", &templateInput{Text: "c", AllowedCallers: []string{"tsk_lgl1"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	call := func(handler echo.HandlerFunc, name, principal string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/api/templates/"+name, nil)
+		req = req.WithContext(withRenderCaller(req.Context(), renderCaller{Principal: principal}))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("name")
+		c.SetParamValues(name)
+		if err := handler(c); err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+		return rec
+	}
+
+	if rec := call(handleGetTemplate, "contract", "tsk_othr"); rec.Code != http.StatusForbidden {
+		t.Errorf("GET by another caller = %d", rec.Code)
+	}
+	if rec := call(handleGetTemplate, "contract", "tsk_lgl1"); rec.Code != http.StatusOK {
+		t.Errorf("GET by allowed caller = %d", rec.Code)
+	}
+	if rec := call(handleListTemplateVersions, "contract", "tsk_othr"); rec.Code != http.StatusForbidden {
+		t.Errorf("GET versions by another caller = %d", rec.Code)
+	}
+	if rec := call(handleTemplateVariables, "contract", "tsk_othr"); rec.Code != http.StatusForbidden {
+		t.Errorf("GET variables by another caller = %d", rec.Code)
+	}
+
+	var listing struct {
+		Templates []storedTemplate `json:"templates"`
+	}
+	if err := json.Unmarshal(call(handleListTemplates, "", "tsk_othr").Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Templates) != 1 || listing.Templates[0].Name != "public" {
+		t.Errorf("Expected only the public template to be listed, got %+v", listing.Templates)
+	}
+}
+
+func TestBindTemplateInput_RejectsInvalidCallerPattern(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/templates/contract", strings.NewReader(`{"text": "c", "allowedCallers": ["tsk_["]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.SetParamNames("name")
+	c.SetParamValues("contract")
+	_, _, err := bindTemplateInput(c)
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed pattern, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// apiKeyPrefixLength is how many leading characters of a key identify it
+// in logs, security events and hash lookups. The prefix is not secret.
+const apiKeyPrefixLength = 8
+
+// apiKeyPrefixContextKey holds the prefix of the key that authenticated a request
+const apiKeyPrefixContextKey = "apiKeyPrefix"
+
+// apiKeyScopesContextKey holds the scopes of the key that authenticated a
+// request, when the key is limited to some
+const apiKeyScopesContextKey = "apiKeyScopes"
+
+// API key scopes. A key without scopes may call every endpoint.
+const (
+	scopeRender    = "render"    // Render templates, inline or named
+	scopeTemplates = "templates" // Manage the named template store
+	scopeJobs      = "jobs"      // Submit and follow asynchronous render jobs
+	scopeAdmin     = "admin"     // Administrative endpoints
+)
+
+var knownScopes = map[string]bool{scopeRender: true, scopeTemplates: true, scopeJobs: true, scopeAdmin: true}
+
+// apiKeyEntry is one accepted API key, stored only as a hash
+type apiKeyEntry struct {
+	prefix string
+	hash   string   // bcrypt ($2a$...), argon2id PHC string, or hex SHA-256 for plain keys
+	scopes []string // Empty for an unrestricted key
+}
+
+// apiKeyStore verifies presented API keys against hashed entries
+type apiKeyStore struct {
+	entries map[string][]apiKeyEntry // By prefix
+
+	mu       sync.RWMutex
+	verified map[[sha256.Size]byte]apiKeyEntry // By digest of the verified key
+}
+
+var apiKeys *apiKeyStore
+
+// dummyHash is compared against when no entry matches the presented prefix,
+// so unknown and known prefixes take the same time to reject
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("templateservice"), bcrypt.MinCost)
+
+// configureAPIKeys loads the accepted keys. TEMPLATE_API_KEY_HASHES holds
+// comma-separated prefix:hash pairs (bcrypt or argon2id), each optionally
+// followed by the key's scopes joined with "+" (prefix:hash:render+jobs); a
+// plain TEMPLATE_API_KEY is still accepted and hashed in memory at startup.
+// Without either, the API is unauthenticated.
+func configureAPIKeys() error {
+	store := &apiKeyStore{
+		entries:  make(map[string][]apiKeyEntry),
+		verified: make(map[[sha256.Size]byte]apiKeyEntry),
+	}
+	for _, pair := range splitKeyHashes(envList("TEMPLATE_API_KEY_HASHES")) {
+		prefix, hash, ok := strings.Cut(pair, ":")
+		if !ok || len(prefix) != apiKeyPrefixLength {
+			return fmt.Errorf("TEMPLATE_API_KEY_HASHES: expected %d-character prefix:hash, got %q", apiKeyPrefixLength, pair)
+		}
+		hash, scopeList, _ := strings.Cut(hash, ":")
+		if !isBcryptHash(hash) && !strings.HasPrefix(hash, "$argon2id$") {
+			return fmt.Errorf("TEMPLATE_API_KEY_HASHES: unsupported hash for key %s (expected bcrypt or argon2id)", prefix)
+		}
+		var scopes []string
+		if scopeList != "" {
+			scopes = strings.Split(scopeList, "+")
+		}
+		if err := validateScopes(scopes); err != nil {
+			return fmt.Errorf("TEMPLATE_API_KEY_HASHES: key %s: %w", prefix, err)
+		}
+		store.add(apiKeyEntry{prefix: prefix, hash: hash, scopes: scopes})
+	}
+	if key := os.Getenv("TEMPLATE_API_KEY"); key != "" {
+		digest := sha256.Sum256([]byte(key))
+		store.add(apiKeyEntry{prefix: apiKeyPrefix(key), hash: fmt.Sprintf("%x", digest)})
+	}
+
+	if len(store.entries) == 0 {
+		apiKeys = nil
+		logger.Info("No API keys configured, API endpoints are unauthenticated unless signed requests are enabled")
+		return nil
+	}
+	apiKeys = store
+	return nil
+}
+
+// splitKeyHashes rejoins list items split at the commas inside argon2id
+// parameters (m=...,t=...,p=...); every entry starts with "<prefix>:$"
+func splitKeyHashes(items []string) []string {
+	var pairs []string
+	for _, item := range items {
+		if len(pairs) > 0 && !strings.HasPrefix(item[min(len(item), apiKeyPrefixLength):], ":$") {
+			pairs[len(pairs)-1] += "," + item
+			continue
+		}
+		pairs = append(pairs, item)
+	}
+	return pairs
+}
+
+// validateScopes checks that each scope is known
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !knownScopes[scope] {
+			return fmt.Errorf("unknown scope %q (expected %s, %s, %s or %s)", scope, scopeRender, scopeTemplates, scopeJobs, scopeAdmin)
+		}
+	}
+	return nil
+}
+
+func (s *apiKeyStore) add(entry apiKeyEntry) {
+	s.entries[entry.prefix] = append(s.entries[entry.prefix], entry)
+}
+
+// verify reports whether key is accepted, returning its prefix and scopes
+func (s *apiKeyStore) verify(key string) (string, []string, bool) {
+	digest := sha256.Sum256([]byte(key))
+	s.mu.RLock()
+	entry, ok := s.verified[digest]
+	s.mu.RUnlock()
+	if ok {
+		return entry.prefix, entry.scopes, true
+	}
+
+	prefix := apiKeyPrefix(key)
+	entries := s.entries[prefix]
+	if len(entries) == 0 {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(key))
+		return prefix, nil, false
+	}
+	for _, entry := range entries {
+		if entry.matches(key, digest) {
+			s.mu.Lock()
+			s.verified[digest] = entry
+			s.mu.Unlock()
+			return prefix, entry.scopes, true
+		}
+	}
+	return prefix, nil, false
+}
+
+// matches compares key against the entry in constant time
+func (e apiKeyEntry) matches(key string, digest [sha256.Size]byte) bool {
+	switch {
+	case isBcryptHash(e.hash):
+		return bcrypt.CompareHashAndPassword([]byte(e.hash), []byte(key)) == nil
+	case strings.HasPrefix(e.hash, "$argon2id$"):
+		ok, err := compareArgon2id(e.hash, key)
+		return err == nil && ok
+	default:
+		expected := fmt.Sprintf("%x", digest)
+		return subtle.ConstantTimeCompare([]byte(e.hash), []byte(expected)) == 1
+	}
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// compareArgon2id verifies key against a PHC-formatted argon2id hash:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func compareArgon2id(encoded, key string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("unsupported argon2id version")
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	actual := argon2.IDKey([]byte(key), salt, iterations, memory, threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(actual, expected) == 1, nil
+}
+
+// apiKeyPrefix returns the identifying prefix of a key. Keys too short to
+// keep a secret part after the prefix have none.
+func apiKeyPrefix(key string) string {
+	if len(key) <= apiKeyPrefixLength {
+		return ""
+	}
+	return key[:apiKeyPrefixLength]
+}
+
+// presentedAPIKey returns the key from X-API-Key or an Authorization bearer token
+func presentedAPIKey(c echo.Context) string {
+	if key := c.Request().Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.Request().Header.Get(echo.HeaderAuthorization); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// apiKeyAuthMiddleware rejects requests without an accepted API key
+// (configured or provisioned, see provisioning.go), valid request signature
+// (see requestsigning.go), bearer token (see jwtauth.go), client
+// certificate (see mtls.go) or single sign-on session (see oidc.go) with 401
+func apiKeyAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if isSignedRequest(c) {
+			return verifySignedRequest(c, next)
+		}
+		if identity, ok := clientCertIdentity(c.Request()); ok && clientCerts != nil && presentedAPIKey(c) == "" {
+			return certAuthenticated(c, next, identity)
+		}
+		if oidc != nil && presentedAPIKey(c) == "" {
+			if session, _, ok := oidc.session(c.Request()); ok {
+				return sessionAuthenticated(c, next, session)
+			}
+		}
+		if key := presentedAPIKey(c); jwtAuth != nil && isJWT(key) {
+			return bearerAuthenticated(c, next, key)
+		}
+		if apiKeys == nil && requestSigning == nil && jwtAuth == nil && clientCerts == nil && oidc == nil && !provisioning.hasKeys() {
+			return authenticated(c, next, "")
+		}
+		key := presentedAPIKey(c)
+		if key != "" {
+			if grants, active, found := provisioning.verify(key); found {
+				if !active {
+					logger.Info(fmt.Sprintf("Rejected disabled API key %s... from %s", apiKeyPrefix(key), c.RealIP()))
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "API key disabled"})
+				}
+				c.Set(roleGrantsContextKey, grants)
+				c.Set(tenantContextKey, provisioning.tenant(apiKeyPrefix(key)))
+				if scopes := provisioning.scopes(apiKeyPrefix(key)); len(scopes) > 0 {
+					c.Set(apiKeyScopesContextKey, scopes)
+				}
+				return authenticated(c, next, apiKeyPrefix(key))
+			}
+		}
+		if key == "" || apiKeys == nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "API key required"})
+		}
+		prefix, scopes, ok := apiKeys.verify(key)
+		if !ok {
+			logger.Info(fmt.Sprintf("Rejected API key %s... from %s", prefix, c.RealIP()))
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid API key"})
+		}
+		if len(scopes) > 0 {
+			c.Set(apiKeyScopesContextKey, scopes)
+		}
+		return authenticated(c, next, prefix)
+	}
+}
+
+// authenticated records the principal of an accepted request, for handlers
+// and for render policy decisions, and continues the chain unless the
+// consumer is over its rate limit (see ratelimit.go)
+func authenticated(c echo.Context, next echo.HandlerFunc, principal string) error {
+	if limited, err := rateLimited(c, principal); limited {
+		return err
+	}
+	if principal != "" {
+		c.Set(apiKeyPrefixContextKey, principal)
+	}
+	req := c.Request()
+	tenant, _ := c.Get(tenantContextKey).(string)
+	c.SetRequest(req.WithContext(withRenderCaller(req.Context(), renderCaller{
+		Principal: principal,
+		ClientIP:  c.RealIP(),
+		Endpoint:  req.Method + " " + c.Path(),
+		Tenant:    tenant,
+	})))
+	return next(c)
+}
+
+// requireScope restricts a route to API keys holding one of scopes. Keys
+// without scopes, and requests authenticated otherwise, are not affected.
+func requireScope(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			held, ok := c.Get(apiKeyScopesContextKey).([]string)
+			if !ok {
+				return next(c)
+			}
+			for _, scope := range scopes {
+				if slices.Contains(held, scope) {
+					return next(c)
+				}
+			}
+			logger.Info(fmt.Sprintf("Refused API key %s... on %s %s: scope %s required", c.Get(apiKeyPrefixContextKey), c.Request().Method, c.Path(), strings.Join(scopes, " or ")))
+			return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("the API key lacks the %s scope", strings.Join(scopes, " or "))})
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestConfigureAPIKeys(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("tsk_live.first-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("0123456789abcdef")
+	argonHash := fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("tsk_ci01.second-secret"), salt, 1, 1024, 1, 32)))
+
+	t.Setenv("TEMPLATE_API_KEY_HASHES", "tsk_live:"+string(bcryptHash)+",tsk_ci01:"+argonHash)
+	t.Setenv("TEMPLATE_API_KEY", "legacy-plain-key")
+	t.Cleanup(func() { apiKeys = nil })
+	if err := configureAPIKeys(); err != nil {
+		t.Fatalf("configureAPIKeys() returned error: %v", err)
+	}
+
+	tests := []struct {
+		key      string
+		accepted bool
+		prefix   string
+	}{
+		{"tsk_live.first-secret", true, "tsk_live"},
+		{"tsk_ci01.second-secret", true, "tsk_ci01"},
+		{"legacy-plain-key", true, "legacy-p"},
+		{"tsk_live.wrong-secret", false, "tsk_live"},
+		{"unknown-key-value", false, "unknown-"},
+	}
+	for _, tt := range tests {
+		// Twice, to cover the verified-key cache
+		for i := 0; i < 2; i++ {
+			prefix, _, ok := apiKeys.verify(tt.key)
+			if ok != tt.accepted || prefix != tt.prefix {
+				t.Errorf("verify(%q) = %q, %v; want %q, %v", tt.key, prefix, ok, tt.prefix, tt.accepted)
+			}
+		}
+	}
+}
+
+func TestConfigureAPIKeysRejectsPlainHashes(t *testing.T) {
+	t.Setenv("TEMPLATE_API_KEY_HASHES", "tsk_live:not-a-hash")
+	t.Cleanup(func() { apiKeys = nil })
+	if err := configureAPIKeys(); err == nil {
+		t.Error("configureAPIKeys() should reject unsupported hashes")
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("tsk_rndr.render-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEMPLATE_API_KEY_HASHES", "tsk_rndr:"+string(hash)+":render+jobs")
+	t.Setenv("TEMPLATE_API_KEY", "legacy-plain-key")
+	t.Cleanup(func() { apiKeys = nil })
+	if err := configureAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.POST("/render", ok, apiKeyAuthMiddleware, requireScope(scopeRender))
+	e.POST("/jobs", ok, apiKeyAuthMiddleware, requireScope(scopeJobs))
+	e.PUT("/templates/:name", ok, apiKeyAuthMiddleware, requireScope(scopeTemplates))
+
+	tests := []struct {
+		key, method, target string
+		expected            int
+	}{
+		{"tsk_rndr.render-secret", http.MethodPost, "/render", http.StatusNoContent},
+		{"tsk_rndr.render-secret", http.MethodPost, "/jobs", http.StatusNoContent},
+		{"tsk_rndr.render-secret", http.MethodPut, "/templates/offer", http.StatusForbidden},
+		{"legacy-plain-key", http.MethodPut, "/templates/offer", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.Header.Set("X-API-Key", tt.key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("%s %s with %s: expected %d, got %d", tt.method, tt.target, apiKeyPrefix(tt.key), tt.expected, rec.Code)
+		}
+	}
+
+	t.Setenv("TEMPLATE_API_KEY_HASHES", "tsk_rndr:"+string(hash)+":render+everything")
+	if err := configureAPIKeys(); err == nil {
+		t.Error("configureAPIKeys() should reject unknown scopes")
+	}
+}
+
+func TestAPIKeyAuthMiddleware(t *testing.T) {
+	t.Setenv("TEMPLATE_API_KEY", "legacy-plain-key")
+	t.Cleanup(func() { apiKeys = nil })
+	if err := configureAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, fmt.Sprint(c.Get(apiKeyPrefixContextKey)))
+	}, apiKeyAuthMiddleware)
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		expected int
+	}{
+		{"missing", "", "", http.StatusUnauthorized},
+		{"wrong", "X-API-Key", "wrong-plain-key", http.StatusUnauthorized},
+		{"header", "X-API-Key", "legacy-plain-key", http.StatusOK},
+		{"bearer", echo.HeaderAuthorization, "Bearer legacy-plain-key", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, rec.Code)
+			}
+			if rec.Code == http.StatusOK && rec.Body.String() != "legacy-p" {
+				t.Errorf("Expected key prefix in context, got %q", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func TestRenderTemplate_ValidFormat(t *testing.T) {
+	_, err := renderTemplate(context.Background(), renderRequest{
+		Text:           "port: {{.port}}\nhosts: [{{.host}}\n",
+		Parameters:     map[string]interface{}{"port": 8080, "host": "a"},
+		EncodingFormat: "application/yaml",
+		Assertions:     &render.Assertions{ValidFormat: true},
+	})
+	var re *render.Error
+	if !errors.As(err, &re) || re.Status != http.StatusUnprocessableEntity || len(re.Violations) != 1 {
+		t.Fatalf("renderTemplate() error = %v, want a 422 with one violation", err)
+	}
+}
+
+func TestRenderTemplate_KubernetesManifests(t *testing.T) {
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:           "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{.name}}\ndata:\n  env: {{.env}}\n---\n",
+		Parameters:     map[string]interface{}{"name": "app-config", "env": "prod"},
+		EncodingFormat: "application/vnd.kubernetes+yaml",
+		Assertions:     &render.Assertions{ValidFormat: true},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if result.Output == "" {
+		t.Error("Expected output")
+	}
+
+	_, err = renderTemplate(context.Background(), renderRequest{
+		Text:           "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{.name}}\n",
+		EncodingFormat: "application/vnd.kubernetes+yaml",
+		Assertions:     &render.Assertions{ValidFormat: true},
+	})
+	var re *render.Error
+	if !errors.As(err, &re) || len(re.Violations) != 1 || re.Violations[0].Line != 4 {
+		t.Errorf("renderTemplate() error = %v, want the missing name reported on line 4", err)
+	}
+}
+
+func TestRenderTemplate_ValidSPARQL(t *testing.T) {
+	_, err := renderTemplate(context.Background(), renderRequest{
+		Text:           `SELECT ?s WHERE { ?s <{{.predicate}}> "{{.value}}" }`,
+		Parameters:     map[string]interface{}{"predicate": "http://schema.org/name", "value": `O"Brien`},
+		EncodingFormat: "application/sparql-query",
+		Assertions:     &render.Assertions{ValidFormat: true},
+	})
+	var re *render.Error
+	if !errors.As(err, &re) || len(re.Violations) != 1 {
+		t.Fatalf("renderTemplate() error = %v, want one violation", err)
+	}
+	if v := re.Violations[0]; v.Assertion != "validFormat" || v.Line != 1 || v.Column != 55 {
+		t.Errorf("Unexpected violation %+v", v)
+	}
+}
+
+func TestSQLTemplate(t *testing.T) {
+	params := map[string]interface{}{"Table": "users", "Name": "O'Brien", "IDs": []interface{}{float64(1), float64(2)}}
+	text := `SELECT * FROM {{sqlIdent .Table}} WHERE name = {{sqlQuote .Name}} AND id IN ({{sqlQuote .IDs}})`
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"application/sql", `SELECT * FROM "users" WHERE name = 'O''Brien' AND id IN (1, 2)`},
+		{"application/sql; dialect=mysql", "SELECT * FROM `users` WHERE name = 'O''Brien' AND id IN (1, 2)"},
+	}
+	for _, tt := range tests {
+		result, err := renderTemplate(context.Background(), renderRequest{
+			Text: text, Parameters: params, EncodingFormat: tt.format,
+			Assertions: &render.Assertions{ValidFormat: true},
+		})
+		if err != nil {
+			t.Fatalf("renderTemplate(%s) returned error: %v", tt.format, err)
+		}
+		if result.Output != tt.want {
+			t.Errorf("renderTemplate(%s) = %s, want %s", tt.format, result.Output, tt.want)
+		}
+	}
+
+	_, err := renderTemplate(context.Background(), renderRequest{
+		Text: `SELECT * FROM users WHERE name = '{{.Name}}'`, Parameters: params,
+		EncodingFormat: "application/sql", Assertions: &render.Assertions{ValidFormat: true},
+	})
+	var re *render.Error
+	if !errors.As(err, &re) || len(re.Violations) != 1 || re.Violations[0].Column != 42 {
+		t.Errorf("renderTemplate() error = %v, want an unterminated string at column 42", err)
+	}
+
+	_, err = renderTemplate(context.Background(), renderRequest{Text: "SELECT 1", EncodingFormat: "application/sql; dialect=oracle"})
+	if !errors.As(err, &re) || re.Status != 400 {
+		t.Errorf("renderTemplate() error = %v, want a 400 for an unknown dialect", err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// Audit log: who rendered which template with what outcome, and every change
+// to the template store, for compliance reviews. Entries are appended as
+// JSON lines to TEMPLATE_AUDIT_LOG and never rewritten; without a file the
+// most recent entries are kept in memory.
+
+// Audited actions
+const (
+	auditRender           = "render"
+	auditTemplateCreate   = "template.create"
+	auditTemplateUpdate   = "template.update"
+	auditTemplateDelete   = "template.delete"
+	auditTemplateRollback = "template.rollback"
+	auditTemplateImport   = "template.import"
+)
+
+const (
+	maxAuditMemory     = 10000 // Entries kept in memory
+	defaultAuditLimit  = 100   // Entries returned by a query by default
+	maxAuditQueryLimit = 10000
+)
+
+// auditEntry is one audited operation
+type auditEntry struct {
+	At         time.Time `json:"at"`
+	Action     string    `json:"action"`
+	Principal  string    `json:"principal"` // API key prefix, signing key ID, jwt:<subject>, ... or anonymous
+	Tenant     string    `json:"tenant,omitempty"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+	Endpoint   string    `json:"endpoint,omitempty"`
+	Template   string    `json:"template"`                 // Stored template name, file or URL identifier, or "inline"
+	Version    int       `json:"version,omitempty"`        // Stored template version, when known
+	SHA256     string    `json:"templateSha256,omitempty"` // Hex SHA-256 of inline template text
+	Output     int64     `json:"outputBytes,omitempty"`
+	OutputHash string    `json:"outputSha256,omitempty"`
+	Status     int       `json:"status"` // HTTP status of the outcome
+	DurationMs float64   `json:"durationMs,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// auditLog appends entries to a file and keeps the most recent in memory
+type auditLog struct {
+	file *os.File // nil without TEMPLATE_AUDIT_LOG
+
+	mu     sync.Mutex
+	recent []auditEntry // Ring of up to maxAuditMemory
+	next   int
+}
+
+var audit = &auditLog{}
+
+// configureAuditLog opens TEMPLATE_AUDIT_LOG for appending
+func configureAuditLog() error {
+	path := os.Getenv("TEMPLATE_AUDIT_LOG")
+	if path == "" {
+		audit = &auditLog{}
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("TEMPLATE_AUDIT_LOG: %w", err)
+	}
+	audit = &auditLog{file: file}
+	logger.Infof("Audit log appended to %s", path)
+	return nil
+}
+
+// record appends an entry. A failed write is logged; the audited operation
+// has already happened and is not undone.
+func (l *auditLog) record(entry auditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.recent) < maxAuditMemory {
+		l.recent = append(l.recent, entry)
+	} else {
+		l.recent[l.next] = entry
+		l.next = (l.next + 1) % maxAuditMemory
+	}
+	if l.file == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = l.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("Failed to append %s of %s to the audit log", entry.Action, entry.Template))
+	}
+}
+
+// auditCaller fills in the caller of an entry
+func auditCaller(entry auditEntry, caller renderCaller) auditEntry {
+	entry.Principal = holdPrincipal(caller)
+	entry.Tenant = caller.Tenant
+	entry.ClientIP = caller.ClientIP
+	entry.Endpoint = caller.Endpoint
+	return entry
+}
+
+// recordRender records a render: the template as the client named it,
+// the size and hash of the output, and the status it was answered with
+func (l *auditLog) recordRender(ctx context.Context, req renderRequest, result *renderResult, err error, elapsed time.Duration) {
+	entry := auditEntry{
+		At:         time.Now().UTC(),
+		Action:     auditRender,
+		Template:   req.TemplateName,
+		Version:    req.TemplateVersion,
+		Status:     http.StatusOK,
+		DurationMs: float64(elapsed) / float64(time.Millisecond),
+	}
+	switch {
+	case entry.Template != "":
+	case req.Text != "":
+		sum := sha256.Sum256([]byte(req.Text))
+		entry.Template, entry.SHA256 = "inline", hex.EncodeToString(sum[:])
+	default:
+		entry.Template = req.Identifier
+	}
+	if err != nil {
+		entry.Status = http.StatusInternalServerError
+		var re *render.Error
+		if errors.As(err, &re) {
+			entry.Status = re.Status
+		}
+		entry.Error = err.Error()
+	} else {
+		entry.Output = int64(len(result.Output))
+		if result.StreamedBytes > 0 {
+			entry.Output = result.StreamedBytes
+		}
+		entry.OutputHash = result.SHA256
+	}
+	l.record(auditCaller(entry, renderCallerFrom(ctx)))
+}
+
+// auditTemplateMiddleware records the template operation action of a route
+// with the status it was answered with. A PUT that creates a template is
+// recorded as a creation.
+func auditTemplateMiddleware(action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			}
+			entry := auditEntry{
+				At:         time.Now().UTC(),
+				Action:     action,
+				Template:   c.Param("name"),
+				Status:     status,
+				DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if action == auditTemplateUpdate && status == http.StatusCreated {
+				entry.Action = auditTemplateCreate
+			}
+			if status < 300 && action != auditTemplateDelete {
+				if stored, err := templateStore.get(entry.Template); err == nil {
+					entry.Version = stored.Version
+				}
+			}
+			audit.record(auditCaller(entry, renderCallerFrom(c.Request().Context())))
+			return err
+		}
+	}
+}
+
+// auditQuery selects entries of the log
+type auditQuery struct {
+	action, principal, tenant, template string
+	since, until                        time.Time
+	limit                               int
+}
+
+func (q auditQuery) matches(entry auditEntry) bool {
+	return (q.action == "" || entry.Action == q.action) &&
+		(q.principal == "" || entry.Principal == q.principal) &&
+		(q.tenant == "" || entry.Tenant == q.tenant) &&
+		(q.template == "" || entry.Template == q.template) &&
+		(q.since.IsZero() || !entry.At.Before(q.since)) &&
+		(q.until.IsZero() || entry.At.Before(q.until))
+}
+
+// query returns the most recent matching entries, oldest first: from the
+// whole file when there is one, else from memory
+func (l *auditLog) query(q auditQuery) ([]auditEntry, error) {
+	var matched []auditEntry
+	keep := func(entry auditEntry) {
+		if !q.matches(entry) {
+			return
+		}
+		matched = append(matched, entry)
+		if len(matched) > q.limit {
+			matched = matched[1:]
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		for i := range l.recent {
+			keep(l.recent[(l.next+i)%len(l.recent)])
+		}
+		return matched, nil
+	}
+	file, err := os.Open(l.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("corrupt audit log entry: %w", err)
+		}
+		keep(entry)
+	}
+	return matched, scanner.Err()
+}
+
+// handleAuditLog handles GET /v1/api/audit: the most recent entries matching
+// the action, principal, tenant, template, since and until (RFC 3339) query
+// parameters, oldest first. Callers with a tenant only see its entries.
+func handleAuditLog(c echo.Context) error {
+	q := auditQuery{
+		action:    c.QueryParam("action"),
+		principal: c.QueryParam("principal"),
+		tenant:    c.QueryParam("tenant"),
+		template:  c.QueryParam("template"),
+		limit:     defaultAuditLimit,
+	}
+	if tenant := renderCallerFrom(c.Request().Context()).Tenant; tenant != "" {
+		q.tenant = tenant
+	}
+	for name, t := range map[string]*time.Time{"since": &q.since, "until": &q.until} {
+		if value := c.QueryParam(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid %s %q (expected RFC 3339)", name, value)})
+			}
+			*t = parsed
+		}
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditQueryLimit {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxAuditQueryLimit)})
+		}
+		q.limit = limit
+	}
+
+	entries, err := audit.query(q)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if entries == nil {
+		entries = []auditEntry{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"count": len(entries), "entries": entries})
+}
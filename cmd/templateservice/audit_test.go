@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// withAuditLog records to path (in memory when empty) for the duration of a test
+func withAuditLog(t *testing.T, path string) *auditLog {
+	t.Helper()
+	previous := audit
+	t.Setenv("TEMPLATE_AUDIT_LOG", path)
+	if err := configureAuditLog(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if audit.file != nil {
+			audit.file.Close()
+		}
+		audit = previous
+	})
+	return audit
+}
+
+func TestAuditLog_Renders(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := withAuditLog(t, path)
+
+	ctx := withRenderCaller(context.Background(), renderCaller{Principal: "tsk_acme", Tenant: "acme", ClientIP: "10.0.0.1"})
+	if _, err := renderTemplate(ctx, renderRequest{Text: "Hello {{.name}}", Parameters: map[string]interface{}{"name": "Ada"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renderTemplate(ctx, renderRequest{TemplateName: "acme~missing"}); err == nil {
+		t.Fatal("Expected rendering a missing template to fail")
+	}
+
+	entries, err := l.query(auditQuery{limit: defaultAuditLimit})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("query() = %v, %v", entries, err)
+	}
+	ok, failed := entries[0], entries[1]
+	if ok.Action != auditRender || ok.Principal != "tsk_acme" || ok.Tenant != "acme" || ok.Template != "inline" ||
+		ok.SHA256 == "" || ok.Output != 9 || ok.OutputHash == "" || ok.Status != http.StatusOK {
+		t.Errorf("Unexpected render entry %+v", ok)
+	}
+	if failed.Template != "acme~missing" || failed.Status != http.StatusNotFound || failed.Error == "" {
+		t.Errorf("Unexpected failed render entry %+v", failed)
+	}
+
+	// Entries are appended to the file as JSON lines
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); lines++ {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Audit log line %d: %v", lines+1, err)
+		}
+	}
+	if lines != 2 {
+		t.Errorf("Audit log has %d lines; want 2", lines)
+	}
+}
+
+func TestAuditLog_Endpoints(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	withAuditLog(t, "")
+
+	e := echo.New()
+	withCaller := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(withRenderCaller(req.Context(), renderCaller{Principal: "tsk_ops", Tenant: req.Header.Get("X-Tenant")})))
+			return next(c)
+		}
+	}
+	e.PUT("/templates/:name", handlePutTemplate, withCaller, auditTemplateMiddleware(auditTemplateUpdate), tenantTemplateMiddleware)
+	e.DELETE("/templates/:name", handleDeleteTemplate, withCaller, auditTemplateMiddleware(auditTemplateDelete), tenantTemplateMiddleware)
+	e.GET("/audit", handleAuditLog, withCaller)
+	call := func(method, target, tenant, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Tenant", tenant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	call(http.MethodPut, "/templates/acme~invoice", "acme", `{"text": "v1"}`)
+	call(http.MethodPut, "/templates/acme~invoice", "acme", `{"text": "v2"}`)
+	call(http.MethodPut, "/templates/invoice", "acme", `{"text": "shared"}`)
+	call(http.MethodPut, "/templates/globex~invoice", "globex", `{"text": "v1"}`)
+	call(http.MethodDelete, "/templates/acme~invoice", "acme", "")
+
+	type listing struct {
+		Count   int          `json:"count"`
+		Entries []auditEntry `json:"entries"`
+	}
+	list := func(target, tenant string) listing {
+		t.Helper()
+		rec := call(http.MethodGet, target, tenant, "")
+		var l listing
+		if err := json.Unmarshal(rec.Body.Bytes(), &l); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", target, rec.Code, rec.Body)
+		}
+		return l
+	}
+
+	all := list("/audit", "")
+	if all.Count != 5 {
+		t.Fatalf("Expected 5 entries, got %+v", all)
+	}
+	want := []struct {
+		action  string
+		version int
+		status  int
+	}{
+		{auditTemplateCreate, 1, http.StatusCreated},
+		{auditTemplateUpdate, 2, http.StatusOK},
+		{auditTemplateUpdate, 0, http.StatusForbidden},
+		{auditTemplateCreate, 1, http.StatusCreated},
+		{auditTemplateDelete, 0, http.StatusNoContent},
+	}
+	for i, w := range want {
+		if got := all.Entries[i]; got.Action != w.action || got.Version != w.version || got.Status != w.status || got.Principal != "tsk_ops" {
+			t.Errorf("Entry %d = %+v; want %s of version %d with %d", i, got, w.action, w.version, w.status)
+		}
+	}
+
+	if l := list("/audit?action=template.create&limit=1", ""); l.Count != 1 || l.Entries[0].Template != "globex~invoice" {
+		t.Errorf("Expected the most recent creation, got %+v", l)
+	}
+	if l := list("/audit?tenant=globex", "acme"); l.Count != 4 {
+		t.Errorf("Expected a tenant to only see its own 4 entries, got %+v", l)
+	}
+	if rec := call(http.MethodGet, "/audit?since=yesterday", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /audit with an invalid since = %d; want 400", rec.Code)
+	}
+}
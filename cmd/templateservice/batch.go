@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// itemPending is reported for items the job has not rendered yet
+const itemPending = "pending"
+
+// jobSummary counts the outcome of a job's items
+type jobSummary struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+	Pending   int `json:"pending"`
+
+	Suppressed int `json:"suppressed,omitempty"` // Succeeded items whose output was suppressed
+}
+
+// jobItemStatus is the per-item outcome reported in the job status
+// (without the rendered output, which is fetched separately)
+type jobItemStatus struct {
+	Index      int    `json:"index"`
+	Status     string `json:"status"`
+	Sha256     string `json:"sha256,omitempty"`
+	ContentUrl string `json:"contentUrl,omitempty"`
+	Suppressed bool   `json:"suppressed,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// jobItemStatuses lists the status of every item of a job
+func jobItemStatuses(job renderJob) []jobItemStatus {
+	statuses := make([]jobItemStatus, len(job.Items))
+	for i := range statuses {
+		statuses[i] = jobItemStatus{Index: i, Status: itemPending}
+	}
+	for _, result := range job.Results {
+		if result.Index < 0 || result.Index >= len(statuses) || result.Status == "" {
+			continue
+		}
+		statuses[result.Index] = jobItemStatus{
+			Index:      result.Index,
+			Status:     result.Status,
+			Sha256:     result.Sha256,
+			ContentUrl: result.ContentUrl,
+			Suppressed: result.Suppressed,
+			Error:      result.Error,
+		}
+	}
+	return statuses
+}
+
+// summarizeJob counts the item outcomes of a job
+func summarizeJob(job renderJob) jobSummary {
+	var summary jobSummary
+	for _, item := range jobItemStatuses(job) {
+		switch item.Status {
+		case itemCompleted:
+			summary.Succeeded++
+			if item.Suppressed {
+				summary.Suppressed++
+			}
+		case itemFailed:
+			summary.Failed++
+		case itemSkipped:
+			summary.Skipped++
+		default:
+			summary.Pending++
+		}
+	}
+	return summary
+}
+
+// retryFailed requeues a dead-lettered job so that only its failed and
+// skipped items are rendered again; completed items keep their results
+func (m *jobManager) retryFailed(id string) (renderJob, error) {
+	return m.requeueDead(id, false, "retrying failed items")
+}
+
+// handleRetryJob handles POST /v1/api/jobs/:id/retry
+func handleRetryJob(c echo.Context) error {
+	job, err := jobs.retryFailed(c.Param("id"))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errJobNotDead):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, errJobsStopped):
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, newJobStatusResponse(job))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJobManager_StopOnErrorAndRetryFailed(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.tmpl")
+	second := filepath.Join(dir, "second.tmpl")
+	if err := os.WriteFile(first, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := newJobManager("", 1)
+	m.start(1)
+	defer m.stop()
+
+	job := m.submit(renderCaller{}, []TemplateRequest{
+		{Identifier: first},
+		{Identifier: second},
+		{Text: "three"},
+	}, jobSchedule{}, true)
+
+	dead := waitForJob(t, m, job.ID)
+	if dead.Status != jobDead {
+		t.Fatalf("Expected job to be dead-lettered, got %s", dead.Status)
+	}
+	summary := summarizeJob(dead)
+	if summary != (jobSummary{Succeeded: 1, Failed: 1, Skipped: 1}) {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	// Retrying must not re-render the completed first item
+	if err := os.Remove(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.retryFailed(job.ID); err != nil {
+		t.Fatalf("retryFailed() returned error: %v", err)
+	}
+
+	done := waitForJob(t, m, job.ID)
+	if done.Status != jobCompleted {
+		t.Fatalf("Expected retried job to complete, got %s (%s)", done.Status, done.Error)
+	}
+	for i, want := range []string{"one", "two", "three"} {
+		if done.Results[i].Output != want {
+			t.Errorf("Item %d: expected %q, got %q", i, want, done.Results[i].Output)
+		}
+	}
+	if summary := summarizeJob(done); summary != (jobSummary{Succeeded: 3}) {
+		t.Errorf("Unexpected summary after retry: %+v", summary)
+	}
+}
+
+func TestJobItemStatuses_Pending(t *testing.T) {
+	job := renderJob{
+		Items:   make([]TemplateRequest, 2),
+		Results: []jobItemResult{{Index: 1, Status: itemFailed, Error: "boom"}},
+	}
+	statuses := jobItemStatuses(job)
+	if statuses[0].Status != itemPending || statuses[1].Status != itemFailed {
+		t.Errorf("Unexpected statuses: %+v", statuses)
+	}
+}
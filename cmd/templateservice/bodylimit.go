@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Request body limits keep a single oversized inline template or parameter
+// payload from exhausting the service's memory. Routes that take template
+// content are allowed more; resumable uploads stream to disk under their own
+// limit (see uploads.go).
+var (
+	maxRequestBodyBytes  int64 = 10 << 20
+	maxTemplateBodyBytes int64 = 50 << 20
+)
+
+// templateBodyRoutes take template content and are limited by maxTemplateBodyBytes
+var templateBodyRoutes = map[string]bool{
+	"/v1/api/templates/:name":        true,
+	"/v1/api/templates/:name/import": true,
+	"/v1/api/themes/:tenant":         true,
+}
+
+// unlimitedBodyRoutes enforce limits of their own
+var unlimitedBodyRoutes = map[string]bool{
+	"/v1/api/uploads/:id": true,
+}
+
+// configureBodyLimits reads the request body limits from the environment;
+// a limit of 0 disables it
+func configureBodyLimits() {
+	maxRequestBodyBytes = int64(envInt("TEMPLATE_MAX_BODY_MB", 10)) << 20
+	maxTemplateBodyBytes = int64(envInt("TEMPLATE_MAX_TEMPLATE_BODY_MB", 50)) << 20
+}
+
+// routeBodyLimit returns the body limit of the request's route, 0 when the
+// route is unlimited
+func routeBodyLimit(c echo.Context) int64 {
+	switch {
+	case unlimitedBodyRoutes[c.Path()]:
+		return 0
+	case templateBodyRoutes[c.Path()]:
+		return maxTemplateBodyBytes
+	}
+	return maxRequestBodyBytes
+}
+
+// bodyLimitMiddleware answers 413 to requests whose body exceeds the limit of
+// their route. Bodies with a Content-Length are checked up front and cannot
+// be read beyond it; chunked bodies are read up to the limit before the
+// handler runs, so handlers never see a truncated body. Compressed bodies
+// are held to the same limit once decoded (see compression.go).
+func bodyLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		limit := routeBodyLimit(c)
+		if limit <= 0 || req.Body == nil || req.Body == http.NoBody {
+			return next(c)
+		}
+		tooLarge := func() error {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("request body exceeds %d bytes", limit)})
+		}
+		if req.ContentLength > limit {
+			return tooLarge()
+		}
+		if req.ContentLength >= 0 {
+			return next(c)
+		}
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+		req.Body.Close()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("failed to read request body: %v", err)})
+		}
+		if int64(len(body)) > limit {
+			return tooLarge()
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		return next(c)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	previous, previousTemplate := maxRequestBodyBytes, maxTemplateBodyBytes
+	t.Cleanup(func() { maxRequestBodyBytes, maxTemplateBodyBytes = previous, previousTemplate })
+	maxRequestBodyBytes, maxTemplateBodyBytes = 16, 32
+
+	e := echo.New()
+	readBody := func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	}
+	group := e.Group("/v1/api", bodyLimitMiddleware)
+	group.POST("/render", readBody)
+	group.PUT("/templates/:name", readBody)
+	group.PATCH("/uploads/:id", readBody)
+
+	tests := []struct {
+		name, method, target string
+		size                 int
+		chunked              bool
+		want                 int
+	}{
+		{"within the limit", http.MethodPost, "/v1/api/render", 16, false, http.StatusOK},
+		{"over the limit", http.MethodPost, "/v1/api/render", 17, false, http.StatusRequestEntityTooLarge},
+		{"chunked within the limit", http.MethodPost, "/v1/api/render", 16, true, http.StatusOK},
+		{"chunked over the limit", http.MethodPost, "/v1/api/render", 17, true, http.StatusRequestEntityTooLarge},
+		{"template upload", http.MethodPut, "/v1/api/templates/invoice", 32, true, http.StatusOK},
+		{"template upload over its limit", http.MethodPut, "/v1/api/templates/invoice", 33, false, http.StatusRequestEntityTooLarge},
+		{"resumable upload", http.MethodPatch, "/v1/api/uploads/u1", 100, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Repeat("x", tt.size)
+			var reader io.Reader = strings.NewReader(body)
+			if tt.chunked {
+				reader = io.MultiReader(reader) // Hides the length, as with Transfer-Encoding: chunked
+			}
+			req := httptest.NewRequest(tt.method, tt.target, reader)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s with %d bytes = %d; want %d", tt.method, tt.target, tt.size, rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && rec.Body.String() != body {
+				t.Errorf("Handler read %d bytes; want %d", rec.Body.Len(), tt.size)
+			}
+		})
+	}
+}
+
+func TestBodyLimitMiddleware_Compressed(t *testing.T) {
+	previous, previousTemplate := maxRequestBodyBytes, maxTemplateBodyBytes
+	t.Cleanup(func() { maxRequestBodyBytes, maxTemplateBodyBytes = previous, previousTemplate })
+	maxRequestBodyBytes, maxTemplateBodyBytes = 1024, 4096
+
+	e := echo.New()
+	group := e.Group("/v1/api", bodyLimitMiddleware, decompressRequestMiddleware)
+	readBody := func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	}
+	group.POST("/render", readBody)
+	group.PUT("/templates/:name", readBody)
+
+	// A few dozen compressed bytes pass the limit, the decoded body does not
+	body := compressGzip(t, strings.Repeat("x", 2048))
+	if len(body) > 1024 {
+		t.Fatalf("Compressed body of %d bytes is not below the limit", len(body))
+	}
+	for target, want := range map[string]int{
+		"/v1/api/render":            http.StatusRequestEntityTooLarge,
+		"/v1/api/templates/invoice": http.StatusOK,
+	} {
+		method := http.MethodPost
+		if strings.HasPrefix(target, "/v1/api/templates/") {
+			method = http.MethodPut
+		}
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentEncoding, "gzip")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s %s with a gzip body inflating to 2048 bytes = %d; want %d", method, target, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// builtinRefPrefix marks template identifiers and layouts naming a template
+// embedded in the binary, e.g. "builtin:health-report"
+const builtinRefPrefix = "builtin:"
+
+//go:embed builtin
+var builtinFS embed.FS
+
+// builtinTemplate describes an embedded template
+type builtinTemplate struct {
+	Name           string `json:"name"`
+	Identifier     string `json:"identifier"`
+	EncodingFormat string `json:"encodingFormat"`
+	Description    string `json:"description"`
+
+	file string
+}
+
+// builtinTemplates are the embedded templates, which only use the functions
+// of every deployment (no Sprig) and escape their parameters in HTML
+var builtinTemplates = []builtinTemplate{
+	{Name: "health-report", file: "health-report.html", Description: "Status page of a service and its checks (service, status, generatedAt, checks[].name/status/detail)"},
+	{Name: "error-page", file: "error-page.html", Description: "Error page for end users (status, title, message, requestId)"},
+	{Name: "email-layout", file: "email-layout.html", Description: "Responsive HTML email layout with title, preheader, header, content and footer blocks (subject, sender, footer)"},
+	{Name: "email-layout-text", file: "email-layout-text.txt", Description: "Plain-text email layout with header, content and footer blocks (sender, footer)"},
+	{Name: "email-notification", file: "email-notification.html", Description: "Notification email for the email-layout (subject, summary, name or greeting, message, actionUrl, actionText)"},
+}
+
+func init() {
+	for i := range builtinTemplates {
+		t := &builtinTemplates[i]
+		t.Identifier = builtinRefPrefix + t.Name
+		switch path.Ext(t.file) {
+		case ".html":
+			t.EncodingFormat = "text/html"
+		default:
+			t.EncodingFormat = "text/plain"
+		}
+	}
+}
+
+// isBuiltinTemplate reports whether a template identifier names an embedded template
+func isBuiltinTemplate(identifier string) bool {
+	return strings.HasPrefix(identifier, builtinRefPrefix)
+}
+
+// lookupBuiltinTemplate returns the embedded template of an identifier and its text
+func lookupBuiltinTemplate(identifier string) (builtinTemplate, string, error) {
+	name := strings.TrimPrefix(identifier, builtinRefPrefix)
+	for _, t := range builtinTemplates {
+		if t.Name != name {
+			continue
+		}
+		data, err := builtinFS.ReadFile("builtin/" + t.file)
+		if err != nil {
+			return t, "", &render.Error{Message: "failed to read built-in template", Status: http.StatusInternalServerError, Err: err}
+		}
+		return t, string(data), nil
+	}
+	return builtinTemplate{}, "", &render.Error{Message: fmt.Sprintf("built-in template %q not found", name), Status: http.StatusNotFound}
+}
+
+// resolveBuiltinTemplate loads the text of an embedded template. Its
+// encoding format applies unless the request sets one.
+func resolveBuiltinTemplate(req renderRequest) (renderRequest, error) {
+	if req.Text != "" || !isBuiltinTemplate(req.Identifier) {
+		return req, nil
+	}
+	t, text, err := lookupBuiltinTemplate(req.Identifier)
+	if err != nil {
+		return req, err
+	}
+	req.Text = text
+	if req.EncodingFormat == "" {
+		req.EncodingFormat = t.EncodingFormat
+	}
+	return req, nil
+}
+
+// handleListBuiltinTemplates handles GET /v1/api/builtin-templates
+func handleListBuiltinTemplates(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"count":     len(builtinTemplates),
+		"templates": builtinTemplates,
+	})
+}
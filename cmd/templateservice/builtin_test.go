@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func TestBuiltinTemplates_Embedded(t *testing.T) {
+	files, err := fs.ReadDir(builtinFS, "builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(builtinTemplates) {
+		t.Errorf("%d embedded files but %d built-in templates", len(files), len(builtinTemplates))
+	}
+	// Every built-in renders without parameters, also without Sprig
+	previous := templateFuncMap
+	templateFuncMap = render.Funcs(false)
+	t.Cleanup(func() { templateFuncMap = previous })
+	for _, builtin := range builtinTemplates {
+		if _, err := renderTemplate(context.Background(), renderRequest{Identifier: builtin.Identifier}); err != nil {
+			t.Errorf("Rendering %s failed: %v", builtin.Identifier, err)
+		}
+	}
+}
+
+func TestBuiltinTemplates_Render(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Identifier: "builtin:health-report",
+		Parameters: map[string]interface{}{
+			"service": "billing",
+			"status":  "degraded",
+			"checks":  []interface{}{map[string]interface{}{"name": "db", "status": "down", "detail": "<timeout>"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.EncodingFormat != "text/html" || !strings.Contains(result.Output, "<h1>billing health report</h1>") ||
+		!strings.Contains(result.Output, "&lt;timeout&gt;") {
+		t.Errorf("Unexpected health report (%s):\n%s", result.EncodingFormat, result.Output)
+	}
+
+	// Built-in layouts frame stored and built-in content
+	result, err = renderTemplate(context.Background(), renderRequest{
+		Identifier: "builtin:email-notification",
+		Layout:     "builtin:email-layout",
+		Parameters: map[string]interface{}{"subject": "Invoice ready", "name": "Ada", "actionUrl": "https://example.com/i/42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<title>Invoice ready</title>", "<p>Hello Ada,</p>", `href="https://example.com/i/42"`} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("Expected %q in the notification:\n%s", want, result.Output)
+		}
+	}
+	if _, err := saveTemplate("receipt", &templateInput{Text: "Thanks, {{.name}}!", Layout: "builtin:email-layout-text"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err = renderTemplate(context.Background(), renderRequest{TemplateName: "receipt", Parameters: map[string]interface{}{"name": "Ada", "footer": "ACME"}})
+	if err != nil || !strings.Contains(result.Output, "Thanks, Ada!\n\n--\nACME") {
+		t.Errorf("Rendering into the text layout = %v, %v", result, err)
+	}
+
+	var re *render.Error
+	if _, err := renderTemplate(context.Background(), renderRequest{Identifier: "builtin:invoice"}); !errors.As(err, &re) || re.Status != http.StatusNotFound {
+		t.Errorf("Rendering an unknown built-in = %v; want 404", err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// templateCacheStore is an LRU of parsed templates keyed by a hash of the
+// template source and the options that affect parsing. Entries older than
+// the TTL are treated as misses so edited files are eventually re-read even
+// when their mtime is unreliable.
+type templateCacheStore struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is most recently used
+	stats   templateCacheStats
+}
+
+// templateCacheStats are cumulative cache metrics
+type templateCacheStats struct {
+	Size      int   `json:"size"`
+	Capacity  int   `json:"capacity"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Expired   int64 `json:"expired"`
+}
+
+type templateCacheEntry struct {
+	key    string
+	tmpl   render.Template
+	stored time.Time
+}
+
+// templateCache is nil when caching is disabled
+var templateCache *templateCacheStore
+
+// configureTemplateCache creates the parsed-template cache from the environment.
+// TEMPLATE_CACHE_SIZE=0 disables caching.
+func configureTemplateCache() {
+	size := envInt("TEMPLATE_CACHE_SIZE", 256)
+	if size <= 0 {
+		templateCache = nil
+		logger.Info("Parsed-template cache disabled")
+		return
+	}
+	templateCache = newTemplateCache(size, envDuration("TEMPLATE_CACHE_TTL", 10*time.Minute))
+	logger.Infof("Parsed-template cache enabled (%d entries)", size)
+}
+
+// newTemplateCache creates a cache holding up to size templates for ttl (0 = no expiry)
+func newTemplateCache(size int, ttl time.Duration) *templateCacheStore {
+	return &templateCacheStore{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached template for key
+func (c *templateCacheStore) get(key string) (render.Template, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := elem.Value.(*templateCacheEntry)
+	if c.ttl > 0 && time.Since(entry.stored) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		c.stats.Expired++
+		c.stats.Misses++
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	c.stats.Hits++
+	return entry.tmpl, true
+}
+
+// put stores a parsed template, evicting the least recently used entry when full
+func (c *templateCacheStore) put(key string, tmpl render.Template) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &templateCacheEntry{key: key, tmpl: tmpl, stored: time.Now()}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&templateCacheEntry{key: key, tmpl: tmpl, stored: time.Now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*templateCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// snapshot returns the current cache metrics
+func (c *templateCacheStore) snapshot() templateCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.order.Len()
+	stats.Capacity = c.size
+	return stats
+}
+
+// templateCacheKey derives the cache key for a request. Inline templates are
+// keyed by their text; file templates by path, modification time and size so
+// a cache hit does not need to read the file. Each tenant has its own entries.
+func templateCacheKey(req renderRequest) (string, error) {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(strconv.Itoa(len(s))))
+		h.Write([]byte{':'})
+		h.Write([]byte(s))
+	}
+
+	if req.Text != "" {
+		write("text")
+		write(req.Text)
+	} else if req.Identifier != "" {
+		info, err := os.Stat(req.Identifier)
+		if err != nil {
+			return "", &render.Error{Message: "failed to read template file", Status: http.StatusBadRequest, Err: err}
+		}
+		write("file")
+		write(req.Identifier)
+		write(info.ModTime().UTC().Format(time.RFC3339Nano))
+		write(strconv.FormatInt(info.Size(), 10))
+	}
+
+	write(req.Name)
+	write(req.Engine)
+	if req.Tenant != "" {
+		// Tenants do not share parsed templates
+		write("tenant")
+		write(req.Tenant)
+	}
+	if req.LayoutText != "" {
+		write("layout")
+		write(req.LayoutText)
+	}
+	for _, name := range sortedKeys(req.Partials) {
+		write("partial")
+		write(name)
+		write(req.Partials[name])
+	}
+	for _, delim := range req.Delimiters {
+		write(delim)
+	}
+	write(req.MissingKey)
+	write(strconv.FormatBool(req.MissingValue != nil))
+	if req.Debug {
+		write("debug")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleCacheStats serves GET /v1/api/cache/stats
+func handleCacheStats(c echo.Context) error {
+	if templateCache == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template cache is disabled"})
+	}
+	return c.JSON(http.StatusOK, templateCache.snapshot())
+}
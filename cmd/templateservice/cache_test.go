@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestTemplateCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTemplateCache(2, 0)
+	c.put("a", template.New("a"))
+	c.put("b", template.New("b"))
+	c.get("a")
+	c.put("c", template.New("c"))
+
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("Expected recently used entry to be kept")
+	}
+
+	stats := c.snapshot()
+	if stats.Size != 2 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestTemplateCache_ExpiresEntries(t *testing.T) {
+	c := newTemplateCache(4, time.Millisecond)
+	c.put("a", template.New("a"))
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.get("a"); ok {
+		t.Error("Expected expired entry to miss")
+	}
+	if stats := c.snapshot(); stats.Expired != 1 || stats.Misses != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestRenderTemplate_UsesCache(t *testing.T) {
+	previous := templateCache
+	templateCache = newTemplateCache(8, time.Minute)
+	defer func() { templateCache = previous }()
+
+	for _, name := range []string{"Alice", "Bob"} {
+		result, err := renderTemplate(context.Background(), renderRequest{
+			Text:       "Hello {{.Name}}",
+			Parameters: map[string]interface{}{"Name": name},
+		})
+		if err != nil {
+			t.Fatalf("renderTemplate() returned error: %v", err)
+		}
+		if result.Output != "Hello "+name {
+			t.Errorf("Expected %q, got %q", "Hello "+name, result.Output)
+		}
+	}
+
+	if stats := templateCache.snapshot(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected one hit and one miss, got %+v", stats)
+	}
+}
+
+func TestRenderTemplate_CacheBindsMissingValuePerRequest(t *testing.T) {
+	previous := templateCache
+	templateCache = newTemplateCache(8, time.Minute)
+	defer func() { templateCache = previous }()
+
+	for _, value := range []string{"N/A", "-"} {
+		v := value
+		result, err := renderTemplate(context.Background(), renderRequest{
+			Text:         "[{{.Missing}}]",
+			Parameters:   map[string]interface{}{},
+			MissingValue: &v,
+		})
+		if err != nil {
+			t.Fatalf("renderTemplate() returned error: %v", err)
+		}
+		if result.Output != "["+value+"]" {
+			t.Errorf("Expected %q, got %q", "["+value+"]", result.Output)
+		}
+	}
+}
+
+func TestRenderTemplate_CacheInvalidatedByFileChange(t *testing.T) {
+	previous := templateCache
+	templateCache = newTemplateCache(8, time.Minute)
+	defer func() { templateCache = previous }()
+
+	path := filepath.Join(t.TempDir(), "greeting.tmpl")
+	render := func() string {
+		result, err := renderTemplate(context.Background(), renderRequest{Identifier: path})
+		if err != nil {
+			t.Fatalf("renderTemplate() returned error: %v", err)
+		}
+		return result.Output
+	}
+
+	if err := os.WriteFile(path, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "v1" {
+		t.Fatalf("Expected v1, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("v2!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "v2!" {
+		t.Errorf("Expected v2!, got %q", got)
+	}
+}
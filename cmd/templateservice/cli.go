@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"templateservice/pkg/render"
+)
+
+// The binary serves the API by default. The render and validate commands use
+// the same rendering pipeline for single templates, so scripts and CI can
+// render without a running server.
+
+const (
+	serveCommand    = "serve"
+	renderCommand   = "render"
+	validateCommand = "validate"
+)
+
+const cliUsage = `Usage: templateservice [command] [flags]
+
+Commands:
+  serve     Run the template service (default)
+  render    Render a template to stdout
+  validate  Check that templates parse
+  help      Show this help
+
+Run "templateservice <command> -h" for the flags of a command.
+`
+
+// Exit codes of the commands
+const (
+	exitOK      = 0
+	exitFailed  = 1 // The template did not render or validate
+	exitUsage   = 2 // Invalid command line or unreadable input
+	stdinSource = "-"
+)
+
+// runCommand runs a command other than serve and returns its exit code
+func runCommand(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	switch command {
+	case renderCommand:
+		return runRender(args, stdin, stdout, stderr)
+	case validateCommand:
+		return runValidate(args, stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "templateservice: unknown command %q\n\n%s", command, cliUsage)
+	return exitUsage
+}
+
+// partialFlags collects repeated -partial name=file flags
+type partialFlags map[string]string
+
+func (p partialFlags) String() string { return "" }
+
+func (p partialFlags) Set(value string) error {
+	name, file, ok := strings.Cut(value, "=")
+	if !ok || name == "" || file == "" {
+		return fmt.Errorf("expected name=file, got %q", value)
+	}
+	p[name] = file
+	return nil
+}
+
+// templateFlags are the flags describing how to parse a template
+type templateFlags struct {
+	engine, format, layout, missingKey string
+	partials                           partialFlags
+}
+
+func (f *templateFlags) register(fs *flag.FlagSet) {
+	f.partials = partialFlags{}
+	fs.StringVar(&f.engine, "engine", "", "template engine (default from -format, else go)")
+	fs.StringVar(&f.format, "format", "", "encoding format of the output, e.g. text/html or text/html+mustache")
+	fs.StringVar(&f.layout, "layout", "", "layout file or builtin:<name> to render the template into")
+	fs.StringVar(&f.missingKey, "missing-key", "", "missing key handling: default, zero or error")
+	fs.Var(f.partials, "partial", "named template as name=file, available to {{template \"name\" .}} (repeatable)")
+}
+
+// request builds the render request of a template source: a file,
+// builtin:<name> or the text read from stdin
+func (f *templateFlags) request(source string, stdin io.Reader) (renderRequest, error) {
+	req := renderRequest{
+		Engine:         f.engine,
+		EncodingFormat: f.format,
+		MissingKey:     f.missingKey,
+	}
+	switch {
+	case source == stdinSource:
+		text, err := io.ReadAll(stdin)
+		if err != nil {
+			return req, fmt.Errorf("failed to read the template from stdin: %w", err)
+		}
+		req.Text, req.Name = string(text), "stdin"
+	case isBuiltinTemplate(source):
+		req.Identifier = source
+	default:
+		path, err := filepath.Abs(source)
+		if err != nil {
+			return req, err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return req, err
+		}
+		req.Identifier, req.Name = path, filepath.Base(source)
+	}
+
+	if isBuiltinTemplate(f.layout) {
+		req.Layout = f.layout
+	} else if f.layout != "" {
+		text, err := os.ReadFile(f.layout)
+		if err != nil {
+			return req, err
+		}
+		req.LayoutText = string(text)
+	}
+	for name, file := range f.partials {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return req, err
+		}
+		if req.Partials == nil {
+			req.Partials = make(map[string]string)
+		}
+		req.Partials[name] = string(text)
+	}
+	return req, nil
+}
+
+// configureCommand applies the configuration the commands share with the
+// service: the configuration file, template functions and plugins and
+// render limits
+func configureCommand() error {
+	if err := configureFromFile(); err != nil {
+		return err
+	}
+	if err := configurePluginFuncs(); err != nil {
+		return err
+	}
+	configureTemplateFuncs()
+	configureRenderTimeout()
+	configureOutputLimit()
+	return nil
+}
+
+// runRender handles "templateservice render"
+func runRender(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("templateservice render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: templateservice render -t template [-p params.json] [-o output] [flags]")
+		fmt.Fprintln(stderr, "\nRenders a template file, builtin:<name> or - (stdin) with JSON parameters to stdout.")
+		fs.PrintDefaults()
+	}
+	var tf templateFlags
+	var source, params, output string
+	fs.StringVar(&source, "t", stdinSource, "template file, builtin:<name> or - for stdin")
+	fs.StringVar(&source, "template", stdinSource, "alias of -t")
+	fs.StringVar(&params, "p", "", "JSON object of parameters, a file or - for stdin")
+	fs.StringVar(&params, "params", "", "alias of -p")
+	fs.StringVar(&output, "o", "", "file to write the output to (default stdout)")
+	fs.StringVar(&output, "output", "", "alias of -o")
+	tf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "templateservice render: unexpected arguments %v\n", fs.Args())
+		return exitUsage
+	}
+	if source == stdinSource && params == stdinSource {
+		fmt.Fprintln(stderr, "templateservice render: the template and the parameters cannot both be read from stdin")
+		return exitUsage
+	}
+	if err := configureCommand(); err != nil {
+		fmt.Fprintf(stderr, "templateservice render: %v\n", err)
+		return exitUsage
+	}
+
+	req, err := tf.request(source, stdin)
+	if err == nil {
+		req.Parameters, err = readParameters(params, stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "templateservice render: %v\n", err)
+		return exitUsage
+	}
+
+	result, err := renderTemplate(context.Background(), req)
+	if err != nil {
+		printRenderError(stderr, "templateservice render", err)
+		return exitFailed
+	}
+	if output == "" {
+		_, err = io.WriteString(stdout, result.Output)
+	} else {
+		err = os.WriteFile(output, []byte(result.Output), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "templateservice render: %v\n", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// readParameters reads a JSON object of parameters from a file or stdin
+func readParameters(source string, stdin io.Reader) (map[string]interface{}, error) {
+	if source == "" {
+		return nil, nil
+	}
+	var data []byte
+	var err error
+	if source == stdinSource {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("parameters must be a JSON object: %w", err)
+	}
+	return params, nil
+}
+
+// runValidate handles "templateservice validate": every template is parsed,
+// and the command fails if any does not
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("templateservice validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: templateservice validate [flags] template...")
+		fmt.Fprintln(stderr, "\nParses each template file, builtin:<name> or - (stdin) and reports errors.")
+		fs.PrintDefaults()
+	}
+	var tf templateFlags
+	tf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := configureCommand(); err != nil {
+		fmt.Fprintf(stderr, "templateservice validate: %v\n", err)
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, source := range fs.Args() {
+		req, err := tf.request(source, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", source, err)
+			code = exitUsage
+			continue
+		}
+		if err := validateTemplate(req); err != nil {
+			printRenderError(stderr, source, err)
+			if code == exitOK {
+				code = exitFailed
+			}
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", source)
+	}
+	return code
+}
+
+// validateTemplate resolves and parses a template without executing it
+func validateTemplate(req renderRequest) error {
+	req, err := resolveTemplateSources(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	_, err = compileTemplate(req)
+	return err
+}
+
+// printRenderError writes a render failure and its details, one per line
+func printRenderError(w io.Writer, prefix string, err error) {
+	fmt.Fprintf(w, "%s: %v\n", prefix, err)
+	var re *render.Error
+	if errors.As(err, &re) {
+		for _, detail := range re.Details {
+			fmt.Fprintf(w, "  %s\n", detail)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLI runs a command with stdin and returns its exit code and output
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := runCommand(args[0], args[1:], strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRenderCommand(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tmpl := write("greeting.tmpl", `{{template "sig" .}} {{.name | upper}}`)
+	sig := write("sig.tmpl", "Dear")
+	params := write("params.json", `{"name": "ada"}`)
+
+	if code, out, errOut := runCLI(t, `{"name": "alan"}`, "render", "-t", tmpl, "-p", "-", "-partial", "sig="+sig); code != exitOK || out != "Dear ALAN" {
+		t.Errorf("render with stdin parameters = %d %q %s", code, out, errOut)
+	}
+	if code, out, _ := runCLI(t, "Hi {{.name}}", "render", "-params", params); code != exitOK || out != "Hi ada" {
+		t.Errorf("render of a stdin template = %d %q", code, out)
+	}
+
+	output := filepath.Join(dir, "out.html")
+	if code, _, errOut := runCLI(t, "", "render", "-t", "builtin:error-page", "-p", params, "-o", output); code != exitOK {
+		t.Fatalf("render of a built-in = %d %s", code, errOut)
+	}
+	if data, err := os.ReadFile(output); err != nil || !strings.Contains(string(data), "Something went wrong") {
+		t.Errorf("Output file = %q, %v", data, err)
+	}
+
+	if code, _, errOut := runCLI(t, "", "render", "-t", write("broken.tmpl", "{{.name"), "-p", params); code != exitFailed || !strings.Contains(errOut, "broken.tmpl") {
+		t.Errorf("render of a broken template = %d %s", code, errOut)
+	}
+	if code, _, _ := runCLI(t, "", "render", "-t", "-", "-p", "-"); code != exitUsage {
+		t.Errorf("render reading both from stdin = %d; want %d", code, exitUsage)
+	}
+	if code, _, _ := runCLI(t, "", "render", "-t", filepath.Join(dir, "missing.tmpl")); code != exitUsage {
+		t.Errorf("render of a missing file = %d; want %d", code, exitUsage)
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.mustache")
+	bad := filepath.Join(dir, "bad.tmpl")
+	os.WriteFile(good, []byte("Hello {{name}}"), 0o644)
+	os.WriteFile(bad, []byte("{{if .x}}"), 0o644)
+
+	code, out, _ := runCLI(t, "", "validate", "-engine", "mustache", good)
+	if code != exitOK || out != good+": ok\n" {
+		t.Errorf("validate = %d %q", code, out)
+	}
+	code, out, errOut := runCLI(t, "", "validate", "builtin:email-layout", bad)
+	if code != exitFailed || !strings.Contains(out, "builtin:email-layout: ok") || !strings.Contains(errOut, bad+": ") {
+		t.Errorf("validate with a broken template = %d %q %q", code, out, errOut)
+	}
+	if code, _, _ := runCLI(t, "", "validate"); code != exitUsage {
+		t.Errorf("validate without templates = %d; want %d", code, exitUsage)
+	}
+	if code, _, errOut := runCLI(t, "", "lint"); code != exitUsage || !strings.Contains(errOut, `unknown command "lint"`) {
+		t.Errorf("unknown command = %d %q", code, errOut)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+// maxDecompressedBytes bounds the decompressed size of a request body so a
+// small compressed payload cannot expand without limit
+var maxDecompressedBytes int64 = 64 << 20
+
+// configureRequestDecompression reads the decompression limit from the environment
+func configureRequestDecompression() {
+	maxDecompressedBytes = int64(envInt("TEMPLATE_MAX_DECOMPRESSED_MB", 64)) << 20
+}
+
+// decompressRequestMiddleware transparently decodes gzip and zstd request
+// bodies (Content-Encoding) so handlers always see plain JSON or data. The
+// decoded body is held to the body limit of its route as well, which
+// bodyLimitMiddleware can only check against the compressed size.
+func decompressRequestMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding)))
+		if encoding == "" || encoding == "identity" || req.Body == nil {
+			return next(c)
+		}
+
+		limit := maxDecompressedBytes
+		if routeLimit := routeBodyLimit(c); routeLimit > 0 && routeLimit < limit {
+			limit = routeLimit
+		}
+		body, err := decompressBody(encoding, req.Body, limit)
+		req.Body.Close()
+		switch {
+		case errors.Is(err, errUnsupportedEncoding):
+			return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": fmt.Sprintf("unsupported Content-Encoding %q (expected gzip or zstd)", encoding)})
+		case errors.Is(err, errDecompressedTooLarge):
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("decompressed request body exceeds %d bytes", limit)})
+		case err != nil:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid %s request body: %v", encoding, err)})
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Del(echo.HeaderContentEncoding)
+		req.Header.Del(echo.HeaderContentLength)
+		return next(c)
+	}
+}
+
+var (
+	errUnsupportedEncoding  = errors.New("unsupported content encoding")
+	errDecompressedTooLarge = errors.New("decompressed body too large")
+)
+
+// decompressBody decodes body, failing once more than limit bytes are produced
+func decompressBody(encoding string, body io.Reader, limit int64) ([]byte, error) {
+	var decoded io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		decoded = zr
+	case "zstd":
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(limit)))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		decoded = zr
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	data, err := io.ReadAll(io.LimitReader(decoded, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errDecompressedTooLarge
+	}
+	return data, nil
+}
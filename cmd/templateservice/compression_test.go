@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+func compressGzip(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func compressZstd(t *testing.T, data string) []byte {
+	t.Helper()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zw.Close()
+	return zw.EncodeAll([]byte(data), nil)
+}
+
+// echoBody runs the middleware in front of a handler that returns the request body
+func echoBody(t *testing.T, encoding string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentEncoding, encoding)
+	rec := httptest.NewRecorder()
+	handler := decompressRequestMiddleware(func(c echo.Context) error {
+		data, _ := io.ReadAll(c.Request().Body)
+		return c.String(http.StatusOK, string(data))
+	})
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	return rec
+}
+
+func TestDecompressRequestMiddleware(t *testing.T) {
+	payload := `{"template": "Hello {{.Name}}", "parameters": {"Name": "World"}}`
+
+	for name, body := range map[string][]byte{
+		"gzip": compressGzip(t, payload),
+		"zstd": compressZstd(t, payload),
+	} {
+		rec := echoBody(t, name, body)
+		if rec.Code != http.StatusOK || rec.Body.String() != payload {
+			t.Errorf("%s: got %d %q", name, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := echoBody(t, "br", []byte("x")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for unsupported encoding, got %d", rec.Code)
+	}
+	if rec := echoBody(t, "gzip", []byte("not gzip")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for corrupt body, got %d", rec.Code)
+	}
+}
+
+func TestDecompressRequestMiddleware_Limit(t *testing.T) {
+	previous := maxDecompressedBytes
+	maxDecompressedBytes = 1024
+	defer func() { maxDecompressedBytes = previous }()
+
+	rec := echoBody(t, "gzip", compressGzip(t, strings.Repeat("a", 4096)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for oversized body, got %d", rec.Code)
+	}
+}
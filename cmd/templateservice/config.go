@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Structured configuration: TEMPLATE_CONFIG names a YAML file whose settings
+// are grouped by concern (port, auth, storage, limits, cache, engines, ...).
+// Each setting stands for one environment variable, and a variable set in
+// the environment overrides the file, so a deployment can share one file and
+// adjust single values per instance. The effective values are validated
+// before anything is configured.
+
+// Kinds of setting values
+type settingKind int
+
+const (
+	settingString settingKind = iota
+	settingInt                // Non-negative integer
+	settingBool
+	settingDuration // Go duration such as 30s
+	settingList     // Comma-separated list, or a YAML sequence in the file
+	settingPort
+)
+
+// configSetting is a setting of the configuration file and its variable
+type configSetting struct {
+	path string // Dotted path in the file
+	env  string
+	kind settingKind
+}
+
+var configSettings = []configSetting{
+	{"port", "PORT", settingPort},
+	{"serviceUrl", "TEMPLATE_SERVICE_URL", settingString},
+	{"grpc.port", "TEMPLATE_GRPC_PORT", settingPort},
+	{"grpc.maxMB", "TEMPLATE_GRPC_MAX_MB", settingInt},
+
+	{"tls.cert", "TEMPLATE_TLS_CERT", settingString},
+	{"tls.key", "TEMPLATE_TLS_KEY", settingString},
+	{"tls.clientCA", "TEMPLATE_TLS_CLIENT_CA", settingString},
+	{"tls.clientAuth", "TEMPLATE_TLS_CLIENT_AUTH", settingString},
+	{"tls.clientRoleMapping", "TEMPLATE_TLS_CLIENT_ROLE_MAPPING", settingList},
+
+	{"network.allowedCidrs", "TEMPLATE_ALLOWED_CIDRS", settingList},
+	{"network.adminAllowedCidrs", "TEMPLATE_ADMIN_ALLOWED_CIDRS", settingList},
+	{"network.trustedProxies", "TEMPLATE_TRUSTED_PROXIES", settingList},
+
+	{"auth.apiKey", "TEMPLATE_API_KEY", settingString},
+	{"auth.apiKeyHashes", "TEMPLATE_API_KEY_HASHES", settingList},
+	{"auth.requestSigningKeys", "TEMPLATE_REQUEST_SIGNING_KEYS", settingList},
+	{"auth.requestSigningSkew", "TEMPLATE_REQUEST_SIGNING_SKEW", settingDuration},
+	{"auth.provisioningFile", "TEMPLATE_PROVISIONING_FILE", settingString},
+	{"auth.metricsToken", "TEMPLATE_METRICS_TOKEN", settingString},
+	{"auth.lockout.maxFailures", "TEMPLATE_AUTH_MAX_FAILURES", settingInt},
+	{"auth.lockout.failureWindow", "TEMPLATE_AUTH_FAILURE_WINDOW", settingDuration},
+	{"auth.lockout.duration", "TEMPLATE_AUTH_LOCKOUT", settingDuration},
+	{"auth.lockout.maxDuration", "TEMPLATE_AUTH_LOCKOUT_MAX", settingDuration},
+	{"auth.jwt.issuer", "TEMPLATE_JWT_ISSUER", settingString},
+	{"auth.jwt.audience", "TEMPLATE_JWT_AUDIENCE", settingString},
+	{"auth.jwt.jwksUrl", "TEMPLATE_JWT_JWKS_URL", settingString},
+	{"auth.jwt.jwksTtl", "TEMPLATE_JWT_JWKS_TTL", settingDuration},
+	{"auth.jwt.groupsClaim", "TEMPLATE_JWT_GROUPS_CLAIM", settingString},
+	{"auth.jwt.tenantClaim", "TEMPLATE_JWT_TENANT_CLAIM", settingString},
+	{"auth.jwt.roleMapping", "TEMPLATE_JWT_ROLE_MAPPING", settingList},
+	{"auth.oidc.issuer", "TEMPLATE_OIDC_ISSUER", settingString},
+	{"auth.oidc.clientId", "TEMPLATE_OIDC_CLIENT_ID", settingString},
+	{"auth.oidc.clientSecret", "TEMPLATE_OIDC_CLIENT_SECRET", settingString},
+	{"auth.oidc.redirectUrl", "TEMPLATE_OIDC_REDIRECT_URL", settingString},
+	{"auth.oidc.groupsClaim", "TEMPLATE_OIDC_GROUPS_CLAIM", settingString},
+	{"auth.oidc.sessionTtl", "TEMPLATE_OIDC_SESSION_TTL", settingDuration},
+	{"auth.oidc.roleMapping", "TEMPLATE_OIDC_ROLE_MAPPING", settingList},
+
+	{"storage.templateDir", "TEMPLATE_STORE_DIR", settingString},
+	{"storage.templateRoot", "TEMPLATE_ROOT", settingString},
+	{"storage.tenantRoots", "TEMPLATE_TENANT_ROOTS", settingString},
+	{"storage.resultDir", "TEMPLATE_RESULT_DIR", settingString},
+	{"storage.resultRetention", "TEMPLATE_RESULT_RETENTION", settingDuration},
+	{"storage.jobDir", "TEMPLATE_JOB_DIR", settingString},
+	{"storage.uploadDir", "TEMPLATE_UPLOAD_DIR", settingString},
+	{"storage.uploadRetention", "TEMPLATE_UPLOAD_RETENTION", settingDuration},
+	{"storage.workspaceDir", "TEMPLATE_WORKSPACE_DIR", settingString},
+	{"storage.workspaceRetention", "TEMPLATE_WORKSPACE_RETENTION", settingDuration},
+	{"storage.workspaceQuotaMB", "TEMPLATE_WORKSPACE_QUOTA_MB", settingInt},
+	{"storage.legalHoldFile", "TEMPLATE_LEGAL_HOLD_FILE", settingString},
+	{"storage.auditLog", "TEMPLATE_AUDIT_LOG", settingString},
+	{"storage.themesFile", "TEMPLATE_THEMES_FILE", settingString},
+	{"storage.messagesFile", "TEMPLATE_MESSAGES_FILE", settingString},
+
+	{"limits.maxBodyMB", "TEMPLATE_MAX_BODY_MB", settingInt},
+	{"limits.maxTemplateBodyMB", "TEMPLATE_MAX_TEMPLATE_BODY_MB", settingInt},
+	{"limits.maxDecompressedMB", "TEMPLATE_MAX_DECOMPRESSED_MB", settingInt},
+	{"limits.maxOutputMB", "TEMPLATE_MAX_OUTPUT_MB", settingInt},
+	{"limits.uploadMaxMB", "TEMPLATE_UPLOAD_MAX_MB", settingInt},
+	{"limits.remoteMaxMB", "TEMPLATE_REMOTE_MAX_MB", settingInt},
+	{"limits.renderTimeout", "TEMPLATE_RENDER_TIMEOUT", settingDuration},
+	{"limits.matrixMaxRows", "TEMPLATE_MATRIX_MAX_ROWS", settingInt},
+	{"limits.tenantMaxTemplates", "TEMPLATE_TENANT_MAX_TEMPLATES", settingInt},
+	{"limits.rate", "TEMPLATE_RATE_LIMIT", settingString},
+	{"limits.burst", "TEMPLATE_RATE_BURST", settingString},
+	{"limits.rateLimits", "TEMPLATE_RATE_LIMITS", settingList},
+	{"limits.quotas", "TEMPLATE_QUOTAS", settingList},
+	{"limits.shutdownTimeout", "TEMPLATE_SHUTDOWN_TIMEOUT", settingDuration},
+
+	{"cache.size", "TEMPLATE_CACHE_SIZE", settingInt},
+	{"cache.ttl", "TEMPLATE_CACHE_TTL", settingDuration},
+	{"cache.remoteTtl", "TEMPLATE_REMOTE_CACHE_TTL", settingDuration},
+
+	{"engines.sprig", "TEMPLATE_SPRIG_ENABLED", settingBool},
+	{"engines.debugRenders", "TEMPLATE_DEBUG_RENDERS", settingBool},
+	{"engines.inlineOnly", "TEMPLATE_INLINE_ONLY", settingBool},
+	{"engines.defaultLocale", "TEMPLATE_DEFAULT_LOCALE", settingString},
+	{"engines.remoteHosts", "TEMPLATE_REMOTE_HOSTS", settingList},
+	{"engines.remoteTimeout", "TEMPLATE_REMOTE_TIMEOUT", settingDuration},
+	{"engines.sandbox", "TEMPLATE_SANDBOX", settingString},
+	{"engines.sandboxCpuSeconds", "TEMPLATE_SANDBOX_CPU_SECONDS", settingInt},
+	{"engines.sandboxMemoryMB", "TEMPLATE_SANDBOX_MEMORY_MB", settingInt},
+	{"engines.funcPlugins", "TEMPLATE_FUNC_PLUGINS", settingList},
+	{"engines.pluginFuncs", "TEMPLATE_PLUGIN_FUNCS", settingList},
+
+	{"jobs.workers", "TEMPLATE_JOB_WORKERS", settingInt},
+	{"jobs.maxAttempts", "TEMPLATE_JOB_MAX_ATTEMPTS", settingInt},
+	{"jobs.callbackHosts", "TEMPLATE_JOB_CALLBACK_HOSTS", settingList},
+	{"jobs.callbackAttempts", "TEMPLATE_JOB_CALLBACK_ATTEMPTS", settingInt},
+	{"jobs.callbackBackoff", "TEMPLATE_JOB_CALLBACK_BACKOFF", settingDuration},
+	{"jobs.callbackTimeout", "TEMPLATE_JOB_CALLBACK_TIMEOUT", settingDuration},
+}
+
+// envSection holds variables without a structured setting, by name
+const envSection = "env"
+
+var envName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// configureFromFile applies the settings of TEMPLATE_CONFIG that the
+// environment does not set, then validates the effective configuration
+func configureFromFile() error {
+	if path := os.Getenv("TEMPLATE_CONFIG"); path != "" {
+		values, err := loadConfigFile(path)
+		if err != nil {
+			return err
+		}
+		applied := 0
+		for env, value := range values {
+			if os.Getenv(env) != "" {
+				continue
+			}
+			if err := os.Setenv(env, value); err != nil {
+				return err
+			}
+			applied++
+		}
+		logger.Infof("Loaded %d settings from %s (%d overridden by the environment)", applied, path, len(values)-applied)
+	}
+	return validateConfig(os.Getenv)
+}
+
+// loadConfigFile reads a configuration file into the variables it sets
+func loadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("TEMPLATE_CONFIG: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+
+	settings := make(map[string]configSetting, len(configSettings))
+	sections := map[string]bool{envSection: true}
+	for _, setting := range configSettings {
+		settings[setting.path] = setting
+		parts := strings.Split(setting.path, ".")
+		for i := 1; i < len(parts); i++ {
+			sections[strings.Join(parts[:i], ".")] = true
+		}
+	}
+
+	var errs []error
+	fail := func(node *yaml.Node, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s:%d: %s", path, node.Line, fmt.Sprintf(format, args...)))
+	}
+	var walk func(prefix string, node *yaml.Node)
+	walk = func(prefix string, node *yaml.Node) {
+		if node.Kind != yaml.MappingNode {
+			fail(node, "%s must be a mapping", describeSection(prefix))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			name := key.Value
+			if prefix != "" {
+				name = prefix + "." + key.Value
+			}
+			switch {
+			case prefix == envSection:
+				if !envName.MatchString(key.Value) {
+					fail(key, "%q is not an environment variable name", key.Value)
+				} else if value.Kind != yaml.ScalarNode {
+					fail(value, "%s must be a single value", name)
+				} else {
+					values[key.Value] = value.Value
+				}
+			case sections[name]:
+				walk(name, value)
+			case settings[name].env != "":
+				setting := settings[name]
+				switch {
+				case value.Kind == yaml.SequenceNode && setting.kind == settingList:
+					items := make([]string, 0, len(value.Content))
+					for _, item := range value.Content {
+						if item.Kind != yaml.ScalarNode {
+							fail(item, "%s must be a list of values", name)
+							continue
+						}
+						items = append(items, item.Value)
+					}
+					values[setting.env] = strings.Join(items, ",")
+				case value.Kind != yaml.ScalarNode:
+					fail(value, "%s must be a single value", name)
+				default:
+					if err := setting.validate(value.Value); err != nil {
+						fail(value, "%s: %v", name, err)
+					}
+					values[setting.env] = value.Value
+				}
+			default:
+				fail(key, "unknown setting %s", name)
+			}
+		}
+	}
+	walk("", doc.Content[0])
+	return values, errors.Join(errs...)
+}
+
+func describeSection(prefix string) string {
+	if prefix == "" {
+		return "the configuration"
+	}
+	return prefix
+}
+
+// validate checks a value of the setting
+func (s configSetting) validate(value string) error {
+	if value == "" {
+		return nil
+	}
+	switch s.kind {
+	case settingInt:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("%q is not a non-negative integer", value)
+		}
+	case settingBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean (true or false)", value)
+		}
+	case settingDuration:
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+	case settingPort:
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%q is not a port between 1 and 65535", value)
+		}
+	}
+	return nil
+}
+
+// validateConfig checks the effective value of every setting, naming both
+// the variable and the file setting of each invalid one
+func validateConfig(getenv func(string) string) error {
+	var errs []error
+	for _, setting := range configSettings {
+		if err := setting.validate(getenv(setting.env)); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", setting.env, setting.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
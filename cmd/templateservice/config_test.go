@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "templateservice.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	values, err := loadConfigFile(writeConfigFile(t, `
+port: 9000
+auth:
+  apiKeyHashes:
+    - sha256:aaaa
+    - sha256:bbbb
+  lockout:
+    maxFailures: 10
+storage:
+  templateDir: /var/lib/templates
+limits:
+  maxBodyMB: 20
+  renderTimeout: 1m
+cache:
+  size: 1024
+engines:
+  sprig: false
+env:
+  TEMPLATE_QUARANTINE_ERROR_PERCENT: "25"
+`))
+	if err != nil {
+		t.Fatalf("loadConfigFile() returned error: %v", err)
+	}
+	want := map[string]string{
+		"PORT":                              "9000",
+		"TEMPLATE_API_KEY_HASHES":           "sha256:aaaa,sha256:bbbb",
+		"TEMPLATE_AUTH_MAX_FAILURES":        "10",
+		"TEMPLATE_STORE_DIR":                "/var/lib/templates",
+		"TEMPLATE_MAX_BODY_MB":              "20",
+		"TEMPLATE_RENDER_TIMEOUT":           "1m",
+		"TEMPLATE_CACHE_SIZE":               "1024",
+		"TEMPLATE_SPRIG_ENABLED":            "false",
+		"TEMPLATE_QUARANTINE_ERROR_PERCENT": "25",
+	}
+	if len(values) != len(want) {
+		t.Errorf("loadConfigFile() = %v", values)
+	}
+	for env, value := range want {
+		if values[env] != value {
+			t.Errorf("%s = %q; want %q", env, values[env], value)
+		}
+	}
+}
+
+func TestLoadConfigFile_Errors(t *testing.T) {
+	_, err := loadConfigFile(writeConfigFile(t, `
+port: 99999
+limits:
+  maxBodyMB: ten
+  renderTimout: 1m
+cache: 5
+engines:
+  sprig: maybe
+env:
+  lower_case: x
+`))
+	if err == nil {
+		t.Fatal("loadConfigFile() accepted an invalid file")
+	}
+	for _, want := range []string{
+		`:2: port: "99999" is not a port`,
+		`:4: limits.maxBodyMB: "ten" is not a non-negative integer`,
+		`:5: unknown setting limits.renderTimout`,
+		`:6: cache must be a mapping`,
+		`:8: engines.sprig: "maybe" is not a boolean`,
+		`:10: "lower_case" is not an environment variable name`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error %q, got:\n%v", want, err)
+		}
+	}
+
+	if _, err := loadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loadConfigFile() accepted a missing file")
+	}
+}
+
+func TestConfigureFromFile_EnvironmentOverrides(t *testing.T) {
+	t.Setenv("TEMPLATE_CONFIG", writeConfigFile(t, "limits:\n  maxBodyMB: 20\n  maxOutputMB: 8\n"))
+	t.Setenv("TEMPLATE_MAX_BODY_MB", "5")
+	t.Setenv("TEMPLATE_MAX_OUTPUT_MB", "")
+	if err := configureFromFile(); err != nil {
+		t.Fatalf("configureFromFile() returned error: %v", err)
+	}
+	if got := os.Getenv("TEMPLATE_MAX_BODY_MB"); got != "5" {
+		t.Errorf("TEMPLATE_MAX_BODY_MB = %q; want the environment's 5", got)
+	}
+	if got := os.Getenv("TEMPLATE_MAX_OUTPUT_MB"); got != "8" {
+		t.Errorf("TEMPLATE_MAX_OUTPUT_MB = %q; want the file's 8", got)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	env := map[string]string{"TEMPLATE_CACHE_TTL": "10 minutes", "TEMPLATE_JOB_WORKERS": "4"}
+	err := validateConfig(func(key string) string { return env[key] })
+	if err == nil || !strings.Contains(err.Error(), `TEMPLATE_CACHE_TTL (cache.ttl): "10 minutes" is not a duration`) {
+		t.Errorf("validateConfig() = %v", err)
+	}
+	delete(env, "TEMPLATE_CACHE_TTL")
+	if err := validateConfig(func(key string) string { return env[key] }); err != nil {
+		t.Errorf("validateConfig() rejected a valid configuration: %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// conformanceCase is a logical render request of the built-in conformance
+// suite. Each case is sent through the semantic action endpoint, REST
+// /render and REST /render/raw, and the outcomes must agree.
+type conformanceCase struct {
+	Name      string
+	Request   RenderRequest
+	WantError bool // The render must fail on every interface
+}
+
+// conformanceSuite exercises parameters, render options, every engine and
+// the error paths
+var conformanceSuite = []conformanceCase{
+	{Name: "parameters", Request: RenderRequest{Template: "Hello {{.name}}, you have {{.count}} items", Parameters: map[string]interface{}{"name": "Ada", "count": 3}}},
+	{Name: "nested parameters", Request: RenderRequest{Template: "{{.user.name}} <{{.user.email}}>{{range .tags}} #{{.}}{{end}}", Parameters: map[string]interface{}{
+		"user": map[string]interface{}{"name": "Ada", "email": "ada@example.com"},
+		"tags": []interface{}{"a", "b"},
+	}}},
+	{Name: "no parameters", Request: RenderRequest{Template: "static text"}},
+	{Name: "template functions", Request: RenderRequest{Template: `{{upper .name}} {{.name | printf "%q"}}`, Parameters: map[string]interface{}{"name": "ada"}}},
+	{Name: "unicode", Request: RenderRequest{Template: "Grüße, {{.name}} ✓", Parameters: map[string]interface{}{"name": "Zoë"}}},
+	{Name: "encoding format", Request: RenderRequest{Template: "<p>{{.name}}</p>", EncodingFormat: "text/html", Parameters: map[string]interface{}{"name": "Ada"}}},
+	{Name: "missing value default", Request: RenderRequest{Template: "[{{.missing}}]"}},
+	{Name: "missing value substitute", Request: RenderRequest{Template: "[{{.missing}}]", MissingKeyValue: conformanceString("n/a")}},
+	{Name: "missing key error", Request: RenderRequest{Template: "[{{.missing}}]", MissingKey: "error"}, WantError: true},
+	{Name: "delimiters", Request: RenderRequest{Template: "{{ kept }} <%.name%>", Delimiters: []string{"<%", "%>"}, Parameters: map[string]interface{}{"name": "Ada"}}},
+	{Name: "partials", Request: RenderRequest{Template: `{{template "greeting" .}}!`, Partials: map[string]string{"greeting": "Hi {{.name}}"}, Parameters: map[string]interface{}{"name": "Ada"}}},
+	{Name: "mustache", Request: RenderRequest{Template: "{{#items}}<{{name}}>{{/items}}", Engine: "mustache", Parameters: map[string]interface{}{"items": []interface{}{map[string]interface{}{"name": "a&b"}}}}},
+	{Name: "handlebars", Request: RenderRequest{Template: "{{#each items}}{{@index}}:{{this}} {{/each}}", Engine: "handlebars", Parameters: map[string]interface{}{"items": []interface{}{"x", "y"}}}},
+	{Name: "jinja2", Request: RenderRequest{Template: "{% for i in items %}{{ i|upper }}{% endfor %} {{ 7 / 2 }}", Engine: "jinja2", Parameters: map[string]interface{}{"items": []interface{}{"x", "y"}}}},
+	{Name: "liquid", Request: RenderRequest{Template: "{{ price | divided_by: 100.0 }} {{ name | upcase }}", Engine: "liquid", Parameters: map[string]interface{}{"price": 1999, "name": "ada"}}},
+	{Name: "engine from encoding format", Request: RenderRequest{Template: "{{name}}", EncodingFormat: "text/x-mustache", Parameters: map[string]interface{}{"name": "Ada"}}},
+	{Name: "passing assertions", Request: RenderRequest{Template: `{"id": {{.id}}}`, Assertions: &render.Assertions{ValidJSON: true}, Parameters: map[string]interface{}{"id": 7}}},
+	{Name: "failing assertions", Request: RenderRequest{Template: "not json", Assertions: &render.Assertions{ValidJSON: true}}, WantError: true},
+	{Name: "suppressed output", Request: RenderRequest{Template: "{{if .show}}text{{end}}  ", Suppress: &suppressOptions{Empty: true}}},
+	{Name: "parse error", Request: RenderRequest{Template: "{{.name"}, WantError: true},
+	{Name: "execution error", Request: RenderRequest{Template: "{{index .items 5}}", Parameters: map[string]interface{}{"items": []interface{}{1}}}, WantError: true},
+	{Name: "unknown engine", Request: RenderRequest{Template: "x", Engine: "velocity"}, WantError: true},
+	{Name: "unknown stored template", Request: RenderRequest{TemplateName: "conformance-suite-no-such-template"}, WantError: true},
+}
+
+func conformanceString(s string) *string { return &s }
+
+// conformanceOutcome is what one interface returned for a case, reduced to
+// the parts that must agree
+type conformanceOutcome struct {
+	Interface      string `json:"interface"` // semantic, rest or raw
+	Status         int    `json:"status"`
+	Succeeded      bool   `json:"succeeded"`
+	Suppressed     bool   `json:"suppressed,omitempty"`
+	Output         string `json:"output,omitempty"`
+	SHA256         string `json:"sha256,omitempty"`
+	EncodingFormat string `json:"encodingFormat,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// conformanceResult reports a case and any divergence between interfaces
+type conformanceResult struct {
+	Name        string               `json:"name"`
+	Passed      bool                 `json:"passed"`
+	Divergences []string             `json:"divergences,omitempty"`
+	Outcomes    []conformanceOutcome `json:"outcomes"`
+}
+
+// conformanceReport is the response of the conformance endpoint
+type conformanceReport struct {
+	Count   int                 `json:"count"`
+	Passed  int                 `json:"passed"`
+	Failed  int                 `json:"failed"`
+	Results []conformanceResult `json:"results"`
+}
+
+// handleConformance handles GET /v1/api/conformance. It runs the built-in
+// suite as the caller, optionally only the cases named in ?case=, and
+// reports every case; the status is 200 even when interfaces diverge.
+func handleConformance(c echo.Context) error {
+	selected := map[string]bool{}
+	for _, name := range c.QueryParams()["case"] {
+		selected[name] = true
+	}
+
+	report := conformanceReport{Results: []conformanceResult{}}
+	for _, tc := range conformanceSuite {
+		if len(selected) > 0 && !selected[tc.Name] {
+			continue
+		}
+		result := runConformanceCase(c, tc)
+		report.Results = append(report.Results, result)
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	report.Count = len(report.Results)
+	if report.Count == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no conformance case matches"})
+	}
+	if report.Failed > 0 {
+		logger.Infof("Conformance suite: %d of %d cases diverged", report.Failed, report.Count)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// runConformanceCase sends a case through every interface and compares the
+// outcomes with the semantic endpoint's
+func runConformanceCase(c echo.Context, tc conformanceCase) conformanceResult {
+	restBody, _ := json.Marshal(tc.Request)
+	semanticBody, _ := json.Marshal(conformanceAction(tc.Request))
+
+	outcomes := []conformanceOutcome{
+		semanticOutcome("semantic", conformanceCall(c, handleSemanticAction, semanticBody)),
+		semanticOutcome("rest", conformanceCall(c, renderTemplateREST, restBody)),
+		rawOutcome(conformanceCall(c, renderTemplateRaw, restBody)),
+	}
+
+	result := conformanceResult{Name: tc.Name, Outcomes: outcomes}
+	reference := outcomes[0]
+	for _, outcome := range outcomes {
+		if outcome.Succeeded == tc.WantError {
+			want := "success"
+			if tc.WantError {
+				want = "an error"
+			}
+			result.Divergences = append(result.Divergences, fmt.Sprintf("%s: expected %s, got status %d", outcome.Interface, want, outcome.Status))
+		}
+	}
+	for _, outcome := range outcomes[1:] {
+		result.Divergences = append(result.Divergences, compareConformance(reference, outcome)...)
+	}
+	result.Passed = len(result.Divergences) == 0
+	return result
+}
+
+// compareConformance lists the differences of an outcome from the reference.
+// Semantic actions report every client error as 400, so failed renders
+// only need to agree on whether the client or the server is at fault. The
+// raw endpoint serves untrusted HTML as text/plain, so its format is not
+// compared.
+func compareConformance(reference, outcome conformanceOutcome) []string {
+	var divergences []string
+	differ := func(field string, want, got interface{}) {
+		divergences = append(divergences, fmt.Sprintf("%s: %s is %v, semantic returned %v", outcome.Interface, field, conformanceQuote(got), conformanceQuote(want)))
+	}
+	if reference.Succeeded != outcome.Succeeded {
+		differ("succeeded", reference.Succeeded, outcome.Succeeded)
+		return divergences
+	}
+	if !reference.Succeeded {
+		if reference.Status/100 != outcome.Status/100 {
+			differ("status", reference.Status, outcome.Status)
+		}
+		return divergences
+	}
+	if reference.Suppressed != outcome.Suppressed {
+		differ("suppressed", reference.Suppressed, outcome.Suppressed)
+	}
+	if reference.Suppressed || outcome.Suppressed {
+		// Suppressed output is not delivered, so only the flag must agree
+		return divergences
+	}
+	if reference.Output != outcome.Output {
+		differ("output", reference.Output, outcome.Output)
+	}
+	if reference.SHA256 != outcome.SHA256 {
+		differ("sha256", reference.SHA256, outcome.SHA256)
+	}
+	if outcome.Interface != "raw" && reference.EncodingFormat != outcome.EncodingFormat {
+		differ("encodingFormat", reference.EncodingFormat, outcome.EncodingFormat)
+	}
+	return divergences
+}
+
+func conformanceQuote(value interface{}) interface{} {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return value
+}
+
+// conformanceAction builds the ReplaceAction an integrator of the semantic
+// interface sends for a request, with the parameters under
+// templateParameters and the options beside them
+func conformanceAction(req RenderRequest) map[string]interface{} {
+	object := map[string]interface{}{"@type": "MediaObject"}
+	if req.Template != "" {
+		object["text"] = req.Template
+	}
+	if req.TemplateName != "" {
+		object["identifier"] = req.TemplateName
+	}
+	if req.EncodingFormat != "" {
+		object["encodingFormat"] = req.EncodingFormat
+	}
+
+	properties := map[string]interface{}{"templateParameters": req.Parameters}
+	if req.Parameters == nil {
+		properties["templateParameters"] = map[string]interface{}{}
+	}
+	if req.Assertions != nil {
+		properties["assertions"] = req.Assertions
+	}
+	if req.Suppress != nil {
+		properties["suppress"] = req.Suppress
+	}
+	if len(req.Delimiters) > 0 {
+		properties["delimiters"] = req.Delimiters
+	}
+	if req.MissingKey != "" {
+		properties["missingKey"] = req.MissingKey
+	}
+	if req.MissingKeyValue != nil {
+		properties["missingKeyValue"] = *req.MissingKeyValue
+	}
+	if len(req.Partials) > 0 {
+		properties["partials"] = req.Partials
+	}
+	if req.Engine != "" {
+		properties["engine"] = req.Engine
+	}
+	return map[string]interface{}{
+		"@context":           "https://schema.org",
+		"@type":              "ReplaceAction",
+		"object":             object,
+		"additionalProperty": properties,
+	}
+}
+
+// conformanceRecorder captures a handler's response in memory
+type conformanceRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *conformanceRecorder) Header() http.Header { return r.header }
+
+func (r *conformanceRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *conformanceRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// conformanceCall invokes a handler with body as the caller of c, turning
+// returned errors into responses as the server's error handler does
+func conformanceCall(c echo.Context, handler echo.HandlerFunc, body []byte) *conformanceRecorder {
+	req := c.Request().Clone(c.Request().Context())
+	req.Method = http.MethodPost
+	req.Body = http.NoBody
+	if len(body) > 0 {
+		req.Body = readCloser{bytes.NewReader(body)}
+	}
+	req.ContentLength = int64(len(body))
+	req.Header = req.Header.Clone()
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Del(echo.HeaderContentEncoding)
+
+	rec := &conformanceRecorder{header: http.Header{}}
+	ctx := c.Echo().NewContext(req, rec)
+	if err := handler(ctx); err != nil {
+		c.Echo().HTTPErrorHandler(err, ctx)
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec
+}
+
+// readCloser adds a no-op Close to a reader
+type readCloser struct{ *bytes.Reader }
+
+func (readCloser) Close() error { return nil }
+
+// semanticOutcome reduces a semantic action response (also returned by REST /render)
+func semanticOutcome(name string, rec *conformanceRecorder) conformanceOutcome {
+	outcome := conformanceOutcome{Interface: name, Status: rec.status, Succeeded: rec.status/100 == 2}
+	var body struct {
+		Error  interface{} `json:"error"`
+		Result *struct {
+			Format string `json:"encodingFormat"`
+			Output string `json:"output"`
+			Value  struct {
+				SHA256     string `json:"sha256"`
+				Suppressed bool   `json:"suppressed"`
+			} `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.body.Bytes(), &body); err != nil {
+		outcome.Error = strings.TrimSpace(rec.body.String())
+		return outcome
+	}
+	if !outcome.Succeeded {
+		outcome.Error = conformanceError(body.Error, rec)
+		return outcome
+	}
+	if body.Result != nil {
+		outcome.Output = body.Result.Output
+		outcome.SHA256 = body.Result.Value.SHA256
+		outcome.Suppressed = body.Result.Value.Suppressed
+		outcome.EncodingFormat = body.Result.Format
+	}
+	return outcome
+}
+
+// rawOutcome reduces a REST /render/raw response
+func rawOutcome(rec *conformanceRecorder) conformanceOutcome {
+	outcome := conformanceOutcome{Interface: "raw", Status: rec.status, Succeeded: rec.status/100 == 2}
+	if !outcome.Succeeded {
+		var body struct {
+			Error interface{} `json:"error"`
+		}
+		_ = json.Unmarshal(rec.body.Bytes(), &body)
+		outcome.Error = conformanceError(body.Error, rec)
+		return outcome
+	}
+	outcome.Suppressed = rec.header.Get(suppressedHeader) == "true"
+	outcome.Output = rec.body.String()
+	outcome.SHA256 = rec.header.Get("X-Content-SHA256")
+	if mediaType, _, err := mime.ParseMediaType(rec.header.Get(echo.HeaderContentType)); err == nil {
+		outcome.EncodingFormat = mediaType
+	}
+	return outcome
+}
+
+// conformanceError extracts the message of a failed response
+func conformanceError(message interface{}, rec *conformanceRecorder) string {
+	if s, ok := message.(string); ok && s != "" {
+		return s
+	}
+	if message != nil {
+		return fmt.Sprint(message)
+	}
+	return strings.TrimSpace(rec.body.String())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// registerSemantic registers the action handlers as main does, once
+var registerSemantic = sync.OnceFunc(func() { semantic.MustRegister("ReplaceAction", handleSemanticReplace) })
+
+func runConformance(t *testing.T, query string) (int, conformanceReport) {
+	t.Helper()
+	registerSemantic()
+	req := httptest.NewRequest(http.MethodGet, "/v1/api/conformance"+query, nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if err := handleConformance(c); err != nil {
+		t.Fatal(err)
+	}
+	var report conformanceReport
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, report
+}
+
+func TestConformanceSuite(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	status, report := runConformance(t, "")
+	if status != http.StatusOK || report.Count != len(conformanceSuite) {
+		t.Fatalf("Status %d, %d cases", status, report.Count)
+	}
+	for _, result := range report.Results {
+		if !result.Passed {
+			t.Errorf("%s diverged: %s", result.Name, strings.Join(result.Divergences, "; "))
+		}
+		if len(result.Outcomes) != 3 {
+			t.Errorf("%s: %d outcomes", result.Name, len(result.Outcomes))
+		}
+	}
+
+	status, report = runConformance(t, "?case=unicode&case=parse+error")
+	if status != http.StatusOK || report.Count != 2 || report.Passed != 2 {
+		t.Errorf("Selected cases: status %d, %+v", status, report)
+	}
+	if status, _ := runConformance(t, "?case=nope"); status != http.StatusNotFound {
+		t.Errorf("Unknown case = %d", status)
+	}
+}
+
+func TestCompareConformance(t *testing.T) {
+	reference := conformanceOutcome{Interface: "semantic", Status: 200, Succeeded: true, Output: "a", SHA256: "x", EncodingFormat: "text/html"}
+
+	raw := reference
+	raw.Interface, raw.EncodingFormat = "raw", "text/plain"
+	if d := compareConformance(reference, raw); len(d) != 0 {
+		t.Errorf("Raw format differences should be ignored, got %v", d)
+	}
+
+	rest := reference
+	rest.Interface, rest.Output, rest.SHA256 = "rest", "b", "y"
+	if d := compareConformance(reference, rest); len(d) != 2 || !strings.Contains(d[0], `output is "b"`) {
+		t.Errorf("Unexpected divergences %v", d)
+	}
+
+	failed := conformanceOutcome{Interface: "semantic", Status: 400}
+	notFound := conformanceOutcome{Interface: "raw", Status: 404}
+	serverError := conformanceOutcome{Interface: "raw", Status: 500}
+	if d := compareConformance(failed, notFound); len(d) != 0 {
+		t.Errorf("Client errors should agree, got %v", d)
+	}
+	if d := compareConformance(failed, serverError); len(d) != 1 {
+		t.Errorf("Expected a status divergence, got %v", d)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobNotDead  = errors.New("job is not in the dead-letter queue")
+	errJobsStopped = errors.New("the service is shutting down and not accepting jobs")
+)
+
+// deadJobs returns all dead-lettered jobs, most recently failed first
+func (m *jobManager) deadJobs() []renderJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var dead []renderJob
+	for _, job := range m.jobs {
+		if job.Status == jobDead {
+			dead = append(dead, *job)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].UpdatedAt.After(dead[j].UpdatedAt) })
+	return dead
+}
+
+// redrive moves a dead-lettered job back to the queue with a fresh attempt
+// budget. All items are rendered again; see retryFailed to keep successes.
+func (m *jobManager) redrive(id string) (renderJob, error) {
+	return m.requeueDead(id, true, "redriven from dead-letter queue")
+}
+
+// requeueDead moves a dead job back to the queue with a fresh attempt budget,
+// optionally discarding the results of items that already completed
+func (m *jobManager) requeueDead(id string, discardResults bool, reason string) (renderJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return renderJob{}, errJobNotFound
+	}
+	if job.Status != jobDead {
+		return renderJob{}, errJobNotDead
+	}
+	if m.closed {
+		return renderJob{}, errJobsStopped
+	}
+
+	job.Attempts = 0
+	job.Error = ""
+	if job.Schedule.expired(time.Now()) {
+		// The original deadline has passed; a redrive runs as soon as possible
+		job.Schedule.NotAfter = nil
+	}
+	if discardResults {
+		job.Results = nil
+	}
+	job.CompletedAt = nil
+	m.transition(job, jobQueued, reason)
+	m.queue = append(m.queue, job.ID)
+	m.cond.Signal()
+	return *job, nil
+}
+
+// handleListDeadJobs handles GET /v1/api/jobs/dead
+func handleListDeadJobs(c echo.Context) error {
+	dead := jobs.deadJobs()
+	response := make([]jobStatusResponse, 0, len(dead))
+	for _, job := range dead {
+		response = append(response, newJobStatusResponse(job))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"count": len(response),
+		"jobs":  response,
+	})
+}
+
+// handleRedriveJob handles POST /v1/api/jobs/:id/redrive
+func handleRedriveJob(c echo.Context) error {
+	job, err := jobs.redrive(c.Param("id"))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errJobNotDead):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, errJobsStopped):
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, newJobStatusResponse(job))
+}
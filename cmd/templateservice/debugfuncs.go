@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+
+	"templateservice/pkg/render"
+)
+
+// debugRenders allows requests to render in debug mode, which adds the
+// debug functions. Configured via TEMPLATE_DEBUG_RENDERS for preview and
+// staging deployments: a debug template can print every parameter it gets.
+var debugRenders bool
+
+// configureDebugRenders loads the debug mode setting from the environment
+func configureDebugRenders() {
+	debugRenders = envBool("TEMPLATE_DEBUG_RENDERS", false)
+	if debugRenders {
+		logger.Info("Debug renders enabled: templates may dump their parameters")
+	}
+}
+
+// checkDebugRender rejects debug renders unless debug mode is enabled
+func checkDebugRender(req renderRequest) error {
+	if req.Debug && !debugRenders {
+		return &render.Error{Message: "debug renders are disabled on this server", Status: http.StatusForbidden}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func TestDebugRenders(t *testing.T) {
+	req := renderRequest{
+		Text:       `{{debugJSON .Customer}}|{{dump .Customer.Name}}`,
+		Parameters: map[string]interface{}{"Customer": map[string]interface{}{"Name": "Ada"}},
+		Debug:      true,
+	}
+
+	_, err := renderTemplate(context.Background(), req)
+	var re *render.Error
+	if !errors.As(err, &re) || re.Status != http.StatusForbidden {
+		t.Fatalf("Expected 403 while debug renders are disabled, got %v", err)
+	}
+
+	debugRenders = true
+	defer func() { debugRenders = false }()
+	result, err := renderTemplate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if want := "{\n  \"Name\": \"Ada\"\n}|string \"Ada\""; result.Output != want {
+		t.Errorf("Expected %q, got %q", want, result.Output)
+	}
+	if !result.Options.Debug {
+		t.Error("Expected effectiveOptions to report the debug render")
+	}
+
+	// The same template without debug mode does not get the functions,
+	// even though its debug compilation is cached
+	req.Debug = false
+	_, err = renderTemplate(context.Background(), req)
+	if !errors.As(err, &re) || re.Status != http.StatusBadRequest {
+		t.Errorf("Expected a parse error without debug mode, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+// effectiveDateLayouts are the accepted formats of a render's effectiveDate.
+// A plain date means midnight UTC.
+var effectiveDateLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+// parseEffectiveDate parses a render's effectiveDate, returning the current
+// time when it is empty
+func parseEffectiveDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Now().UTC(), nil
+	}
+	for _, layout := range effectiveDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &render.Error{Message: fmt.Sprintf("invalid effectiveDate %q, expected RFC 3339 or YYYY-MM-DD", value), Status: http.StatusBadRequest}
+}
+
+// effectiveSince returns when a template version takes effect: its scheduled
+// effectiveFrom time, or otherwise the time it was saved
+func effectiveSince(tmpl *storedTemplate) time.Time {
+	if tmpl.EffectiveFrom != nil {
+		return *tmpl.EffectiveFrom
+	}
+	return tmpl.UpdatedAt
+}
+
+// effectiveVersion returns the version in effect at the given time: of the
+// versions effective by then, the one that took effect last, preferring the
+// newer version on ties. A version scheduled for the future therefore takes
+// over from versions saved before its date, and saving a new version with
+// the same effectiveFrom replaces a scheduled one. It returns nil when no
+// version is effective yet.
+func effectiveVersion(history []*storedTemplate, at time.Time) *storedTemplate {
+	var selected *storedTemplate
+	for _, tmpl := range history {
+		since := effectiveSince(tmpl)
+		if since.After(at) {
+			continue
+		}
+		if selected == nil || !since.Before(effectiveSince(selected)) {
+			selected = tmpl
+		}
+	}
+	return selected
+}
+
+// effectiveTemplate loads the version of a stored template in effect at the
+// given time, together with its latest version
+func effectiveTemplate(name string, at time.Time) (*storedTemplate, *storedTemplate, error) {
+	history, err := templateStore.versions(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	latest := history[len(history)-1]
+	stored := effectiveVersion(history, at)
+	if stored == nil {
+		return nil, latest, &render.Error{Message: fmt.Sprintf("no version of template %q is effective at %s", name, at.Format(time.RFC3339)), Status: http.StatusNotFound}
+	}
+	return stored, latest, nil
+}
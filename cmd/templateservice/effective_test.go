@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseEffectiveDate(t *testing.T) {
+	if got, err := parseEffectiveDate("2027-01-01"); err != nil || !got.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date = %v, %v", got, err)
+	}
+	if got, err := parseEffectiveDate("2027-01-01T09:00:00+01:00"); err != nil || !got.Equal(time.Date(2027, 1, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Timestamp = %v, %v", got, err)
+	}
+	if got, err := parseEffectiveDate(""); err != nil || time.Since(got) > time.Minute {
+		t.Errorf("Empty should be now, got %v, %v", got, err)
+	}
+	if _, err := parseEffectiveDate("January 1st"); err == nil {
+		t.Error("Expected an invalid date to be rejected")
+	}
+}
+
+func TestEffectiveVersion(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	scheduled := at("2027-01-01T00:00:00Z")
+	sameDay := scheduled
+	history := []*storedTemplate{
+		{Version: 1, UpdatedAt: at("2026-01-01T00:00:00Z")},
+		{Version: 2, UpdatedAt: at("2026-06-01T00:00:00Z"), EffectiveFrom: &scheduled},
+		{Version: 3, UpdatedAt: at("2026-07-01T00:00:00Z")}, // Fix to the current text
+	}
+	tests := []struct {
+		at   string
+		want int
+	}{
+		{"2025-12-31T00:00:00Z", 0},
+		{"2026-03-01T00:00:00Z", 1},
+		{"2026-06-15T00:00:00Z", 1},
+		{"2026-08-01T00:00:00Z", 3},
+		{"2027-01-01T00:00:00Z", 2},
+		{"2028-01-01T00:00:00Z", 2},
+	}
+	for _, tt := range tests {
+		got := 0
+		if v := effectiveVersion(history, at(tt.at)); v != nil {
+			got = v.Version
+		}
+		if got != tt.want {
+			t.Errorf("At %s selected version %d, want %d", tt.at, got, tt.want)
+		}
+	}
+
+	// A later version scheduled for the same time replaces the scheduled one
+	history = append(history, &storedTemplate{Version: 4, UpdatedAt: at("2026-08-01T00:00:00Z"), EffectiveFrom: &sameDay})
+	if v := effectiveVersion(history, at("2027-02-01T00:00:00Z")); v.Version != 4 {
+		t.Errorf("Expected the rescheduled version 4, got %d", v.Version)
+	}
+}
+
+func TestRenderTemplate_EffectiveDate(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+
+	future := time.Now().UTC().AddDate(1, 0, 0).Truncate(24 * time.Hour)
+	if _, err := saveTemplate("terms", &templateInput{Text: "old terms", AllowedCallers: []string{"legal"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	existing, _ := templateStore.get("terms")
+	if _, err := saveTemplate("terms", &templateInput{Text: "new terms", EffectiveFrom: &future}, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	render := func(effectiveDate string) (*renderResult, error) {
+		return renderTemplate(context.Background(), renderRequest{TemplateName: "terms", EffectiveDate: effectiveDate})
+	}
+	if result, err := render(""); err != nil || result.Output != "old terms" {
+		t.Errorf("Render now = %+v, %v", result, err)
+	}
+	if result, err := render(future.Format("2006-01-02")); err != nil || result.Output != "new terms" {
+		t.Errorf("Render at the scheduled date = %+v, %v", result, err)
+	}
+	if _, err := render("2000-01-01"); err == nil || !strings.Contains(err.Error(), "no version") {
+		t.Errorf("Expected no effective version before the first save, got %v", err)
+	}
+	if _, err := render("soon"); err == nil || !strings.Contains(err.Error(), "invalid effectiveDate") {
+		t.Errorf("Expected an invalid effectiveDate error, got %v", err)
+	}
+
+	// The effective version is restricted like the latest one
+	resolved, err := resolveStoredTemplate(renderRequest{TemplateName: "terms"})
+	if err != nil || resolved.StoredVersion != 1 || len(resolved.AllowedCallers) != 0 {
+		t.Errorf("Resolved = version %d, allowed %v, %v", resolved.StoredVersion, resolved.AllowedCallers, err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/v1/api/templates/terms/versions", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("name")
+	c.SetParamValues("terms")
+	if err := handleListTemplateVersions(c); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list versions = %d, %v", rec.Code, err)
+	}
+	var listed struct {
+		Current  int                      `json:"current"`
+		Active   int                      `json:"active"`
+		Versions []templateVersionSummary `json:"versions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if listed.Current != 2 || listed.Active != 1 || listed.Versions[1].EffectiveFrom == nil {
+		t.Errorf("Unexpected version listing %s", rec.Body)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"templateservice/pkg/render"
+)
+
+// Templates are parsed by the engines of pkg/render: the Go text/template
+// engine by default, or the engine a request or its encoding format names.
+
+// engineRequest is the part of a request the engines parse and execute
+func (req renderRequest) engineRequest() render.Request {
+	return render.Request{
+		Name:           req.Name,
+		Text:           req.Text,
+		Parameters:     req.Parameters,
+		Engine:         req.Engine,
+		EncodingFormat: req.EncodingFormat,
+		Partials:       req.Partials,
+		Layout:         req.Layout,
+		LayoutText:     req.LayoutText,
+		Delimiters:     req.Delimiters,
+		MissingKey:     req.MissingKey,
+		MissingValue:   req.MissingValue,
+		Locale:         req.Locale,
+		Messages:       req.Messages,
+		Debug:          req.Debug,
+		Funcs:          templateFuncMap,
+	}
+}
+
+// parseTemplate parses the request's template with its engine, ready to
+// execute
+func parseTemplate(req renderRequest) (render.Template, error) {
+	tmpl, err := compileTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+	return render.Bind(tmpl, req.engineRequest())
+}
+
+// engineVariables lists the variables of a template parsed by an engine
+// other than Go, for engines whose templates can list them
+func engineVariables(req renderRequest) ([]render.Variable, error) {
+	tmpl, err := compileTemplate(req)
+	if err != nil {
+		return nil, withStage(err, stageParse)
+	}
+	lister, ok := tmpl.(render.VariableLister)
+	if !ok {
+		return nil, &render.Error{Message: fmt.Sprintf("variable extraction is not supported by the %s engine", req.Engine), Status: http.StatusBadRequest}
+	}
+	variables := lister.Variables()
+	sortVariables(variables)
+	return variables, nil
+}
+
+// resolveEngine selects the request's engine: the explicit engine, else the
+// one its encoding format names, else the Go engine. Engine suffixes are
+// removed from the output format.
+func resolveEngine(req renderRequest) (renderRequest, error) {
+	if name, output, ok := render.EngineFromFormat(req.EncodingFormat); ok {
+		if req.Engine == "" {
+			req.Engine = name
+		}
+		req.EncodingFormat = output
+	}
+	if req.Engine == "" {
+		req.Engine = render.GoEngine
+	}
+	if _, err := render.EngineFor(req.Engine); err != nil {
+		return req, err
+	}
+	return req, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func TestResolveEngine(t *testing.T) {
+	tests := []struct {
+		engine, format      string
+		wantEngine, wantFmt string
+	}{
+		{"", "", render.GoEngine, ""},
+		{"", "text/html", render.GoEngine, "text/html"},
+		{"", "text/x-mustache", "mustache", ""},
+		{"", "text/html+mustache", "mustache", "text/html"},
+		{"mustache", "application/json", "mustache", "application/json"},
+		{"go", "text/html+mustache", render.GoEngine, "text/html"},
+	}
+	for _, tt := range tests {
+		req, err := resolveEngine(renderRequest{Engine: tt.engine, EncodingFormat: tt.format})
+		if err != nil || req.Engine != tt.wantEngine || req.EncodingFormat != tt.wantFmt {
+			t.Errorf("resolveEngine(%q, %q) = %q, %q, %v", tt.engine, tt.format, req.Engine, req.EncodingFormat, err)
+		}
+	}
+
+	_, err := resolveEngine(renderRequest{Engine: "jinja"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown engine, got %v", err)
+	}
+}
+
+func TestRenderEngines(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if err := templateStore.put(&storedTemplate{Name: "greeting", Text: "Hi {{name}}", EncodingFormat: "text/html+mustache"}); err != nil {
+		t.Fatal(err)
+	}
+	parameters := map[string]interface{}{"name": "<Alice>"}
+
+	tests := []struct {
+		name   string
+		req    renderRequest
+		want   string
+		format string
+	}{
+		{"go default", renderRequest{Text: "Hi {{.name}}", Parameters: parameters}, "Hi <Alice>", "text/plain"},
+		{"explicit", renderRequest{Text: "Hi {{name}}", Engine: "mustache", Parameters: parameters}, "Hi &lt;Alice&gt;", "text/plain"},
+		{"format", renderRequest{Text: "Hi {{{name}}}", EncodingFormat: "text/x-mustache", Parameters: parameters}, "Hi <Alice>", "text/plain"},
+		{"stored", renderRequest{TemplateName: "greeting", Parameters: parameters}, "Hi &lt;Alice&gt;", "text/html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderTemplate(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("renderTemplate() returned error: %v", err)
+			}
+			if result.Output != tt.want || result.EncodingFormat != tt.format {
+				t.Errorf("Got %q (%s), want %q (%s)", result.Output, result.EncodingFormat, tt.want, tt.format)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envList returns a comma-separated environment variable as a trimmed list
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envDuration parses a duration environment variable, falling back to def
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("Invalid duration for %s, using default %s", key, def))
+		return def
+	}
+	return d
+}
+
+// envInt parses an integer environment variable, falling back to def
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("Invalid integer for %s, using default %d", key, def))
+		return def
+	}
+	return n
+}
+
+// envBool parses a boolean environment variable, falling back to def
+func envBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("Invalid boolean for %s, using default %t", key, def))
+		return def
+	}
+	return b
+}
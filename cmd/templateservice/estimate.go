@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// Render profiles: every successful render records how long executing its
+// template took, how much it wrote and allocated, and how many items its
+// largest parameter list held. Cost estimates project these onto a planned
+// dataset size so batch owners can size jobs before running them.
+
+const (
+	maxProfileSamples     = 100  // Most recent renders kept per template
+	maxProfiledTemplates  = 1000 // Templates profiled; the least recently rendered is dropped first
+	heapAllocsMetric      = "/gc/heap/allocs:bytes"
+	estimateBasisTemplate = "template" // Projected from renders of the template itself
+	estimateBasisEngine   = "engine"   // Projected from renders of other templates of its engine
+)
+
+// profileSample is the cost of one render
+type profileSample struct {
+	items       int
+	duration    time.Duration
+	outputBytes int64
+	allocBytes  int64 // Heap allocated while executing; process-wide, so an upper bound under load
+}
+
+// templateProfile holds the recent samples of one template
+type templateProfile struct {
+	engine  string
+	samples []profileSample // Ring of up to maxProfileSamples
+	next    int
+	updated time.Time
+}
+
+// renderProfiler keeps the profiles of rendered templates in memory
+type renderProfiler struct {
+	mu       sync.Mutex
+	profiles map[string]*templateProfile // By tenant and template key
+}
+
+var renderProfiles = &renderProfiler{profiles: make(map[string]*templateProfile)}
+
+// profileKey identifies the template of a request as the client named it:
+// a stored template by name, a file or URL by identifier, inline text by
+// its hash
+func profileKey(tenant string, req renderRequest) string {
+	key := req.TemplateName
+	switch {
+	case key != "":
+	case req.Text != "":
+		sum := sha256.Sum256([]byte(req.Text))
+		key = "inline:" + hex.EncodeToString(sum[:8])
+	default:
+		key = req.Identifier
+	}
+	return tenant + "\x00" + key
+}
+
+// datasetItems is the length of the largest list among the parameters, the
+// rows a template typically ranges over (1 without lists)
+func datasetItems(value interface{}) int {
+	items := 1
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			items = max(items, datasetItems(item))
+		}
+	case []interface{}:
+		items = max(items, len(v))
+		for _, item := range v {
+			items = max(items, datasetItems(item))
+		}
+	}
+	return items
+}
+
+// heapAllocs returns the bytes allocated on the heap since the process started
+func heapAllocs() int64 {
+	sample := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
+
+// record adds a render of the template key to its profile
+func (p *renderProfiler) record(key, engine string, sample profileSample) {
+	if engine == "" {
+		engine = render.GoEngine
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	profile, ok := p.profiles[key]
+	if !ok {
+		if len(p.profiles) >= maxProfiledTemplates {
+			p.evictOldest()
+		}
+		profile = &templateProfile{}
+		p.profiles[key] = profile
+	}
+	profile.engine, profile.updated = engine, time.Now()
+	if len(profile.samples) < maxProfileSamples {
+		profile.samples = append(profile.samples, sample)
+		return
+	}
+	profile.samples[profile.next] = sample
+	profile.next = (profile.next + 1) % maxProfileSamples
+}
+
+// evictOldest drops the least recently rendered profile. The caller holds p.mu.
+func (p *renderProfiler) evictOldest() {
+	var oldest string
+	for key, profile := range p.profiles {
+		if oldest == "" || profile.updated.Before(p.profiles[oldest].updated) {
+			oldest = key
+		}
+	}
+	delete(p.profiles, oldest)
+}
+
+// similar returns the samples to project a template's cost from: its own
+// when it has been rendered, else those of every template of the engine
+func (p *renderProfiler) similar(key, engine string) ([]profileSample, string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if profile, ok := p.profiles[key]; ok {
+		return append([]profileSample(nil), profile.samples...), estimateBasisTemplate, profile.engine
+	}
+	if engine == "" {
+		engine = render.GoEngine
+	}
+	var samples []profileSample
+	for _, profile := range p.profiles {
+		if profile.engine == engine {
+			samples = append(samples, profile.samples...)
+		}
+	}
+	return samples, estimateBasisEngine, engine
+}
+
+// projectCost fits cost = fixed + perItem*items to the samples by least
+// squares and evaluates it at items. Samples of a single dataset size are
+// scaled proportionally.
+func projectCost(samples []profileSample, items int, cost func(profileSample) float64) float64 {
+	n := float64(len(samples))
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += float64(s.items)
+		sumY += cost(s)
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var covariance, variance float64
+	for _, s := range samples {
+		dx := float64(s.items) - meanX
+		covariance += dx * (cost(s) - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return meanY / meanX * float64(items)
+	}
+	perItem := covariance / variance
+	return math.Max(0, meanY+perItem*(float64(items)-meanX))
+}
+
+// renderCost is the projected cost of renders
+type renderCost struct {
+	DurationMs  float64 `json:"durationMs"`
+	OutputBytes int64   `json:"outputBytes"`
+	MemoryBytes int64   `json:"memoryBytes,omitempty"` // Not given for batches, whose renders need not run at once
+}
+
+// estimateRequest names a template like a render request and the dataset
+// to plan for
+type estimateRequest struct {
+	Template     string `json:"template"`
+	TemplateID   string `json:"templateId,omitempty"`
+	TemplateName string `json:"templateName,omitempty"`
+	Engine       string `json:"engine,omitempty"`
+	Items        int    `json:"items"`             // Rows in the largest parameter list of each render
+	Renders      int    `json:"renders,omitempty"` // Renders in the batch (default 1)
+}
+
+// estimateResponse is the projected cost of one render and of the batch
+type estimateResponse struct {
+	Basis     string     `json:"basis"` // template or engine
+	Engine    string     `json:"engine"`
+	Samples   int        `json:"samples"`
+	Items     int        `json:"items"`
+	Renders   int        `json:"renders"`
+	PerRender renderCost `json:"perRender"`
+	Total     renderCost `json:"total"`
+}
+
+// handleEstimateRender handles POST /v1/api/estimate: it projects the render
+// time, output size and memory of a template for a dataset size from the
+// recorded profiles of the template, or of similar ones when it has not been
+// rendered yet
+func handleEstimateRender(c echo.Context) error {
+	var req estimateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+	if req.Template == "" && req.TemplateID == "" && req.TemplateName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "template, templateId or templateName is required"})
+	}
+	if req.Items < 1 || req.Renders < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "items must be positive and renders must not be negative"})
+	}
+	if req.Renders == 0 {
+		req.Renders = 1
+	}
+
+	tenant := renderCallerFrom(c.Request().Context()).Tenant
+	key := profileKey(tenant, renderRequest{Text: req.Template, Identifier: req.TemplateID, TemplateName: req.TemplateName})
+	samples, basis, engine := renderProfiles.similar(key, req.Engine)
+	if len(samples) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no renders of this template or its engine have been profiled yet"})
+	}
+
+	perRender := renderCost{
+		DurationMs:  projectCost(samples, req.Items, func(s profileSample) float64 { return float64(s.duration) / float64(time.Millisecond) }),
+		OutputBytes: int64(projectCost(samples, req.Items, func(s profileSample) float64 { return float64(s.outputBytes) })),
+		MemoryBytes: int64(projectCost(samples, req.Items, func(s profileSample) float64 { return float64(s.allocBytes) })),
+	}
+	return c.JSON(http.StatusOK, estimateResponse{
+		Basis:     basis,
+		Engine:    engine,
+		Samples:   len(samples),
+		Items:     req.Items,
+		Renders:   req.Renders,
+		PerRender: perRender,
+		Total: renderCost{
+			DurationMs:  perRender.DurationMs * float64(req.Renders),
+			OutputBytes: perRender.OutputBytes * int64(req.Renders),
+		},
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+func withRenderProfiles(t *testing.T) {
+	t.Helper()
+	previous := renderProfiles
+	renderProfiles = &renderProfiler{profiles: make(map[string]*templateProfile)}
+	t.Cleanup(func() { renderProfiles = previous })
+}
+
+func postEstimate(t *testing.T, body string) (int, estimateResponse) {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/estimate", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handleEstimateRender(e.NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	var response estimateResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+func TestDatasetItems(t *testing.T) {
+	params := map[string]interface{}{
+		"title": "Report",
+		"tags":  []interface{}{"a", "b"},
+		"order": map[string]interface{}{"lines": []interface{}{1, 2, 3, 4}},
+	}
+	if items := datasetItems(params); items != 4 {
+		t.Errorf("datasetItems() = %d, want 4", items)
+	}
+	if items := datasetItems(map[string]interface{}{"name": "Ada"}); items != 1 {
+		t.Errorf("datasetItems() without lists = %d, want 1", items)
+	}
+}
+
+func TestProjectCost(t *testing.T) {
+	samples := []profileSample{{items: 10, outputBytes: 1100}, {items: 20, outputBytes: 2100}, {items: 40, outputBytes: 4100}}
+	output := func(s profileSample) float64 { return float64(s.outputBytes) }
+	if got := projectCost(samples, 1000, output); math.Abs(got-100100) > 1e-6 {
+		t.Errorf("projectCost() = %g, want 100100", got)
+	}
+	if got := projectCost(samples[:1], 100, output); math.Abs(got-11000) > 1e-6 {
+		t.Errorf("projectCost() of one dataset size = %g, want 11000", got)
+	}
+}
+
+func TestEstimateRender(t *testing.T) {
+	withRenderProfiles(t)
+	const text = `{{range .rows}}{{.}},{{end}}`
+	for _, n := range []int{10, 100} {
+		rows := make([]interface{}, n)
+		for i := range rows {
+			rows[i] = "row"
+		}
+		if _, err := renderTemplate(context.Background(), renderRequest{Text: text, Parameters: map[string]interface{}{"rows": rows}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, estimate := postEstimate(t, `{"template":"{{range .rows}}{{.}},{{end}}","items":1000,"renders":3}`)
+	if status != http.StatusOK || estimate.Basis != estimateBasisTemplate || estimate.Samples != 2 || estimate.Engine != render.GoEngine {
+		t.Fatalf("Estimate = %d %+v", status, estimate)
+	}
+	if estimate.PerRender.OutputBytes != 4000 || estimate.Total.OutputBytes != 12000 {
+		t.Errorf("Projected output = %d per render, %d in total; want 4000 and 12000", estimate.PerRender.OutputBytes, estimate.Total.OutputBytes)
+	}
+	if estimate.Total.DurationMs != 3*estimate.PerRender.DurationMs || estimate.Total.MemoryBytes != 0 {
+		t.Errorf("Batch total = %+v for %+v per render", estimate.Total, estimate.PerRender)
+	}
+
+	// A template never rendered is projected from its engine's profiles
+	status, estimate = postEstimate(t, `{"template":"{{.other}}","items":10}`)
+	if status != http.StatusOK || estimate.Basis != estimateBasisEngine || estimate.Samples != 2 || estimate.Renders != 1 {
+		t.Errorf("Estimate of a new template = %d %+v", status, estimate)
+	}
+	if status, _ := postEstimate(t, `{"template":"{{ name }}","engine":"jinja2","items":10}`); status != http.StatusNotFound {
+		t.Errorf("Estimate without profiles = %d, want 404", status)
+	}
+	if status, _ := postEstimate(t, `{"template":"x","items":0}`); status != http.StatusBadRequest {
+		t.Errorf("Estimate without items = %d, want 400", status)
+	}
+}
+
+func TestRenderProfilesAreBounded(t *testing.T) {
+	withRenderProfiles(t)
+	for i := 0; i < maxProfileSamples+5; i++ {
+		renderProfiles.record("\x00invoice", "", profileSample{items: i, duration: time.Millisecond})
+	}
+	samples, _, _ := renderProfiles.similar("\x00invoice", "")
+	if len(samples) != maxProfileSamples {
+		t.Errorf("Kept %d samples, want %d", len(samples), maxProfileSamples)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+
+	"templateservice/pkg/render"
+)
+
+// inlineOnlyExcluded are Sprig functions removed in inline-only mode because
+// they query the network or operate on host file paths
+var inlineOnlyExcluded = []string{"getHostByName", "osBase", "osClean", "osDir", "osExt", "osIsAbs"}
+
+// templateFuncMap is the function map applied to every parsed template
+var templateFuncMap = render.Funcs(true)
+
+// sprigEnabled records whether templateFuncMap includes the Sprig library
+var sprigEnabled = true
+
+// configureTemplateFuncs rebuilds the function map from the environment.
+// TEMPLATE_SPRIG_ENABLED=false disables the Sprig library for strict environments.
+// Allowed plugin functions (see plugins.go) are added last.
+func configureTemplateFuncs() {
+	sprigEnabled = envBool("TEMPLATE_SPRIG_ENABLED", true)
+	templateFuncMap = render.Funcs(sprigEnabled)
+	if !sprigEnabled {
+		logger.Info("Sprig template functions disabled")
+	}
+	if inlineOnly {
+		for _, name := range inlineOnlyExcluded {
+			delete(templateFuncMap, name)
+		}
+	}
+	for name, fn := range pluginFuncs {
+		templateFuncMap[name] = fn
+	}
+}
+
+// templateFuncNames lists the names in the current function map
+func templateFuncNames() []string {
+	names := make([]string, 0, len(templateFuncMap))
+	for name := range templateFuncMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func TestTemplateFuncs_Sprig(t *testing.T) {
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       `{{.Name | upper}} {{.Missing | default "guest"}}`,
+		Parameters: map[string]interface{}{"Name": "alice"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+
+	if result.Output != "ALICE guest" {
+		t.Errorf("Expected 'ALICE guest', got %q", result.Output)
+	}
+}
+
+func TestTemplateFuncs_SprigDisabled(t *testing.T) {
+	templateFuncMap = render.Funcs(false)
+	defer func() { templateFuncMap = render.Funcs(true) }()
+
+	_, err := renderTemplate(context.Background(), renderRequest{Text: `{{"a" | upper}}`})
+	if err == nil {
+		t.Error("renderTemplate() should fail to parse Sprig functions when Sprig is disabled")
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// gitRefPrefix marks template identifiers that name a file in the Git
+// template repository, as "git:path/to/file.tmpl@ref"
+const gitRefPrefix = "git:"
+
+// maxGitTemplates bounds the number of cached template files
+const maxGitTemplates = 512
+
+// gitRefPattern restricts refs to branch, tag and commit names that cannot
+// be mistaken for git options
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._/-]{0,254}$`)
+
+// gitTemplateRepo is a bare mirror of a Git repository of templates.
+// Templates are read from any ref without a checkout; the commit each ref
+// resolved to is remembered until the next sync.
+type gitTemplateRepo struct {
+	url        string
+	dir        string
+	defaultRef string
+	timeout    time.Duration
+
+	syncMu   sync.Mutex // Serializes fetches
+	mu       sync.Mutex
+	commits  map[string]string // Ref -> commit SHA
+	files    map[string]string // commit:path -> content
+	syncedAt time.Time
+}
+
+// gitRepo is nil when no template repository is configured
+var gitRepo *gitTemplateRepo
+
+// gitWebhookSecret authenticates push webhooks (GitHub, Gitea and GitLab style)
+var gitWebhookSecret string
+
+// configureGitRepository clones or updates the template repository named by
+// TEMPLATE_GIT_URL and starts the periodic sync
+func configureGitRepository(ctx context.Context) error {
+	url := os.Getenv("TEMPLATE_GIT_URL")
+	gitWebhookSecret = os.Getenv("TEMPLATE_GIT_WEBHOOK_SECRET")
+	if url == "" {
+		gitRepo = nil
+		return nil
+	}
+	dir := os.Getenv("TEMPLATE_GIT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "templateservice-git")
+	}
+	defaultRef := os.Getenv("TEMPLATE_GIT_REF")
+	if defaultRef == "" {
+		defaultRef = "HEAD"
+	}
+	if defaultRef != "HEAD" && !gitRefPattern.MatchString(defaultRef) {
+		return fmt.Errorf("TEMPLATE_GIT_REF: invalid ref %q", defaultRef)
+	}
+
+	repo := newGitTemplateRepo(url, dir, defaultRef, envDuration("TEMPLATE_GIT_TIMEOUT", time.Minute))
+	if err := repo.sync(ctx); err != nil {
+		return err
+	}
+	gitRepo = repo
+	logger.Infof("Git template repository %s mirrored to %s", url, dir)
+
+	if interval := envDuration("TEMPLATE_GIT_SYNC_INTERVAL", 0); interval > 0 {
+		go repo.syncEvery(ctx, interval)
+	}
+	return nil
+}
+
+func newGitTemplateRepo(url, dir, defaultRef string, timeout time.Duration) *gitTemplateRepo {
+	return &gitTemplateRepo{
+		url:        url,
+		dir:        dir,
+		defaultRef: defaultRef,
+		timeout:    timeout,
+		commits:    make(map[string]string),
+		files:      make(map[string]string),
+	}
+}
+
+// git runs a git command against the mirror and returns its stdout
+func (r *gitTemplateRepo) git(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--git-dir", r.dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// sync clones the mirror on first use and fetches all refs afterwards.
+// Ref resolutions are forgotten so renders pick up the new commits.
+func (r *gitTemplateRepo) sync(ctx context.Context) error {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(r.dir, "HEAD")); errors.Is(err, os.ErrNotExist) {
+		ctx, cancel := context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "git", "clone", "--mirror", "--", r.url, r.dir)
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git clone: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+	} else if _, err := r.git(ctx, "remote", "update", "--prune"); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.commits = make(map[string]string)
+	r.syncedAt = time.Now().UTC()
+	r.mu.Unlock()
+	return nil
+}
+
+// syncEvery fetches the repository periodically until ctx is done
+func (r *gitTemplateRepo) syncEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.sync(ctx); err != nil {
+				logger.WithError(err).Error("Failed to sync Git template repository")
+			}
+		}
+	}
+}
+
+// resolve returns the commit a ref points to
+func (r *gitTemplateRepo) resolve(ctx context.Context, ref string) (string, error) {
+	r.mu.Lock()
+	commit, ok := r.commits[ref]
+	r.mu.Unlock()
+	if ok {
+		return commit, nil
+	}
+
+	out, err := r.git(ctx, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", &render.Error{Message: fmt.Sprintf("unknown git ref %q", ref), Status: http.StatusNotFound, Err: err}
+	}
+	commit = strings.TrimSpace(out)
+	r.mu.Lock()
+	r.commits[ref] = commit
+	r.mu.Unlock()
+	return commit, nil
+}
+
+// read returns a template file at a commit. Files at a commit never change,
+// so they are cached by commit and path.
+func (r *gitTemplateRepo) read(ctx context.Context, commit, file string) (string, error) {
+	key := commit + ":" + file
+	r.mu.Lock()
+	text, ok := r.files[key]
+	r.mu.Unlock()
+	if ok {
+		return text, nil
+	}
+
+	text, err := r.git(ctx, "show", key)
+	if err != nil {
+		return "", &render.Error{Message: fmt.Sprintf("template %q not found at %s", file, commit), Status: http.StatusNotFound, Err: err}
+	}
+	r.mu.Lock()
+	if len(r.files) >= maxGitTemplates {
+		r.files = make(map[string]string)
+	}
+	r.files[key] = text
+	r.mu.Unlock()
+	return text, nil
+}
+
+// parseGitIdentifier splits "git:path@ref" into a clean relative path and ref
+func parseGitIdentifier(identifier, defaultRef string) (string, string, error) {
+	spec := strings.TrimPrefix(identifier, gitRefPrefix)
+	file, ref := spec, defaultRef
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		file, ref = spec[:i], spec[i+1:]
+	}
+	if ref != defaultRef && !gitRefPattern.MatchString(ref) {
+		return "", "", &render.Error{Message: fmt.Sprintf("invalid git ref %q", ref), Status: http.StatusBadRequest}
+	}
+	cleaned := path.Clean(file)
+	if file == "" || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", "", &render.Error{Message: fmt.Sprintf("invalid git template path %q", file), Status: http.StatusBadRequest}
+	}
+	return cleaned, ref, nil
+}
+
+// isGitTemplate reports whether a template identifier names a repository file
+func isGitTemplate(identifier string) bool {
+	return strings.HasPrefix(identifier, gitRefPrefix)
+}
+
+// resolveGitTemplate loads the text of a template from the repository and
+// records the commit it was read from
+func resolveGitTemplate(ctx context.Context, req renderRequest) (renderRequest, error) {
+	if req.Text != "" || !isGitTemplate(req.Identifier) {
+		return req, nil
+	}
+	if gitRepo == nil {
+		return req, &render.Error{Message: "no git template repository is configured", Status: http.StatusBadRequest}
+	}
+	file, ref, err := parseGitIdentifier(req.Identifier, gitRepo.defaultRef)
+	if err != nil {
+		return req, err
+	}
+	tenant, err := tenantStorage(ctx)
+	if err != nil {
+		return req, err
+	}
+	if tenant != "" {
+		file = tenant + "/" + file
+	}
+	commit, err := gitRepo.resolve(ctx, ref)
+	if err != nil {
+		return req, err
+	}
+	if req.Text, err = gitRepo.read(ctx, commit, file); err != nil {
+		return req, err
+	}
+	req.TemplateCommit = commit
+	return req, nil
+}
+
+// handleGitSync handles POST /v1/api/git/sync
+func handleGitSync(c echo.Context) error {
+	if gitRepo == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no git template repository is configured"})
+	}
+	return syncGitRepository(c)
+}
+
+// handleGitWebhook handles POST /v1/api/git/webhook, a push
+// webhook authenticated by an HMAC-SHA256 of the body (X-Hub-Signature-256)
+// or the shared secret itself (X-Gitlab-Token)
+func handleGitWebhook(c echo.Context) error {
+	if gitRepo == nil || gitWebhookSecret == "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "git webhook is not configured"})
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read request body"})
+	}
+	if !validGitWebhook(c.Request().Header, body) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid webhook signature"})
+	}
+	return syncGitRepository(c)
+}
+
+// validGitWebhook checks the webhook's signature or token against the secret
+func validGitWebhook(header http.Header, body []byte) bool {
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		return hmac.Equal([]byte(token), []byte(gitWebhookSecret))
+	}
+	signature, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(gitWebhookSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// syncGitRepository fetches the repository and reports the default ref's commit
+func syncGitRepository(c echo.Context) error {
+	ctx := c.Request().Context()
+	if err := gitRepo.sync(ctx); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	commit, err := gitRepo.resolve(ctx, gitRepo.defaultRef)
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+	gitRepo.mu.Lock()
+	syncedAt := gitRepo.syncedAt
+	gitRepo.mu.Unlock()
+	return c.JSON(http.StatusOK, map[string]interface{}{"ref": gitRepo.defaultRef, "commit": commit, "syncedAt": syncedAt})
+}
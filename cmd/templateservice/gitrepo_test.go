@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// gitCommit writes a file to the work tree and commits it, returning the commit SHA
+func gitCommit(t *testing.T, work, file, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(work, file)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, file), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("add", file)
+	run("commit", "-q", "-m", "update "+file)
+	return run("rev-parse", "HEAD")
+}
+
+func withGitRepo(t *testing.T) (string, *gitTemplateRepo) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	work := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", "-b", "main", work).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	previous := gitRepo
+	t.Cleanup(func() { gitRepo = previous })
+	gitRepo = newGitTemplateRepo(work, filepath.Join(t.TempDir(), "mirror"), "HEAD", time.Minute)
+	return work, gitRepo
+}
+
+func TestGitTemplates(t *testing.T) {
+	work, repo := withGitRepo(t)
+	first := gitCommit(t, work, "mail/welcome.tmpl", "Hello {{.name}}")
+	if out, err := exec.Command("git", "-C", work, "tag", "v1").CombinedOutput(); err != nil {
+		t.Fatalf("git tag: %v: %s", err, out)
+	}
+	if err := repo.sync(context.Background()); err != nil {
+		t.Fatalf("sync() returned error: %v", err)
+	}
+
+	renderFrom := func(identifier string) (*renderResult, error) {
+		return renderTemplate(context.Background(), renderRequest{Identifier: identifier, Parameters: map[string]interface{}{"name": "Ada"}})
+	}
+	result, err := renderFrom("git:mail/welcome.tmpl")
+	if err != nil || result.Output != "Hello Ada" || result.TemplateCommit != first {
+		t.Fatalf("renderFrom() = %+v, %v", result, err)
+	}
+
+	second := gitCommit(t, work, "mail/welcome.tmpl", "Welcome {{.name}}")
+	if result, _ := renderFrom("git:mail/welcome.tmpl"); result.TemplateCommit != first {
+		t.Errorf("Expected the synced commit until the next sync, got %s", result.TemplateCommit)
+	}
+	if err := repo.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := renderFrom("git:mail/welcome.tmpl"); err != nil || result.Output != "Welcome Ada" || result.TemplateCommit != second {
+		t.Errorf("After sync renderFrom() = %+v, %v", result, err)
+	}
+	if result, err := renderFrom("git:mail/welcome.tmpl@v1"); err != nil || result.Output != "Hello Ada" || result.TemplateCommit != first {
+		t.Errorf("Tagged renderFrom() = %+v, %v", result, err)
+	}
+
+	tests := []struct {
+		identifier string
+		status     int
+	}{
+		{"git:mail/missing.tmpl", http.StatusNotFound},
+		{"git:mail/welcome.tmpl@nope", http.StatusNotFound},
+		{"git:mail/welcome.tmpl@--upload-pack=x", http.StatusBadRequest},
+		{"git:../outside.tmpl", http.StatusBadRequest},
+		{"git:/etc/passwd", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		_, err := renderFrom(tt.identifier)
+		if re, ok := err.(*render.Error); !ok || re.Status != tt.status {
+			t.Errorf("renderFrom(%q): expected %d, got %v", tt.identifier, tt.status, err)
+		}
+	}
+	// With tenant roots, tenants read below their own directory
+	gitCommit(t, work, "acme/mail/welcome.tmpl", "Acme {{.name}}")
+	if err := repo.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	previous := tenantRoots
+	t.Cleanup(func() { tenantRoots = previous })
+	tenantRoots = t.TempDir()
+	ctx := withRenderCaller(context.Background(), renderCaller{Tenant: "acme"})
+	if result, err := renderTemplate(ctx, renderRequest{Identifier: "git:mail/welcome.tmpl", Parameters: map[string]interface{}{"name": "Ada"}}); err != nil || result.Output != "Acme Ada" {
+		t.Errorf("Tenant renderFrom() = %+v, %v", result, err)
+	}
+}
+
+func TestGitWebhook(t *testing.T) {
+	work, repo := withGitRepo(t)
+	gitCommit(t, work, "a.tmpl", "a")
+	if err := repo.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	commit := gitCommit(t, work, "a.tmpl", "b")
+
+	previousSecret := gitWebhookSecret
+	gitWebhookSecret = "hook-secret"
+	t.Cleanup(func() { gitWebhookSecret = previousSecret })
+
+	call := func(signature string) *httptest.ResponseRecorder {
+		body := `{"ref": "refs/heads/main"}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/git/webhook", strings.NewReader(body))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rec := httptest.NewRecorder()
+		if err := handleGitWebhook(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	if rec := call("sha256=00"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bad signature, got %d", rec.Code)
+	}
+	mac := hmac.New(sha256.New, []byte("hook-secret"))
+	mac.Write([]byte(`{"ref": "refs/heads/main"}`))
+	rec := call("sha256=" + hex.EncodeToString(mac.Sum(nil)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), commit) {
+		t.Errorf("Webhook = %d %s, expected the new commit %s", rec.Code, rec.Body, commit)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+//go:generate protoc -I ../../proto --go_out=../../proto --go_opt=paths=source_relative --go-grpc_out=../../proto --go-grpc_opt=paths=source_relative templateservice/v1/templateservice.proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // Accept gzip-compressed requests
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"templateservice/pkg/render"
+	templateservicev1 "templateservice/proto/templateservice/v1"
+)
+
+// grpcChunkSize bounds the output carried by one RenderStream message
+const grpcChunkSize = 64 << 10
+
+var (
+	// grpcAddr is the listen address of the gRPC server, empty when disabled
+	grpcAddr string
+	// grpcMaxMessageSize bounds a request message
+	grpcMaxMessageSize = 4 << 20
+)
+
+// configureGRPC enables the gRPC server on TEMPLATE_GRPC_PORT
+func configureGRPC() {
+	grpcAddr = ""
+	if port := os.Getenv("TEMPLATE_GRPC_PORT"); port != "" {
+		grpcAddr = ":" + port
+	}
+	grpcMaxMessageSize = envInt("TEMPLATE_GRPC_MAX_MB", 4) << 20
+}
+
+// newGRPCServer routes the TemplateService methods through the same
+// network policy, authentication, lockout, metrics and tracing as the HTTP
+// API before handing the calls to grpc-go
+func newGRPCServer() *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.IPExtractor = network.ipExtractor()
+	e.Use(grpcStatusMiddleware)
+	e.Use(metricsMiddleware)
+	e.Use(traceMiddleware)
+	e.Use(tenantHostMiddleware)
+	e.Use(allowlistMiddleware(network.api, "api"))
+
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(grpcMaxMessageSize))
+	templateservicev1.RegisterTemplateServiceServer(server, templateService{})
+	handler := echo.WrapHandler(server)
+	auth := lockoutMiddleware(apiKeyAuthMiddleware)
+	for _, method := range []string{
+		templateservicev1.TemplateService_Render_FullMethodName,
+		templateservicev1.TemplateService_RenderStream_FullMethodName,
+		templateservicev1.TemplateService_Validate_FullMethodName,
+	} {
+		e.POST(method, handler, auth, requireScope(scopeRender))
+	}
+	return e
+}
+
+// startGRPCServer serves gRPC over cleartext HTTP/2 on addr, or over TLS
+// when the service is configured for it (see mtls.go)
+func startGRPCServer(addr string) *http.Server {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Addr: addr, Handler: newGRPCServer(), Protocols: &protocols}
+	if serverTLS != nil {
+		// Same certificate and client verification as the HTTP API
+		protocols = http.Protocols{}
+		protocols.SetHTTP2(true)
+		server.TLSConfig = serverTLS.Clone()
+	}
+	go func() {
+		logger.Infof("gRPC server starting on %s", addr)
+		serve := server.ListenAndServe
+		if server.TLSConfig != nil {
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.WithError(err).Error("gRPC server error")
+		}
+	}()
+	return server
+}
+
+// grpcStatusWriter holds back responses that are not gRPC (errors written
+// by the shared middlewares), so they can be answered as gRPC statuses
+type grpcStatusWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *grpcStatusWriter) WriteHeader(code int) {
+	if !strings.HasPrefix(w.Header().Get(echo.HeaderContentType), "application/grpc") {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *grpcStatusWriter) Write(data []byte) (int, error) {
+	if w.status != 0 {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *grpcStatusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		f.Flush()
+	}
+}
+
+// grpcStatusMiddleware turns the HTTP error responses and errors of the
+// shared middlewares into gRPC statuses: 401 becomes Unauthenticated, 429
+// ResourceExhausted and so on
+func grpcStatusMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		res := c.Response()
+		w := &grpcStatusWriter{ResponseWriter: res.Writer}
+		res.Writer = w
+		err := next(c)
+		res.Writer = w.ResponseWriter
+		if w.status != 0 {
+			res.Committed = false // Only the held-back error was "written"
+		}
+
+		var he *echo.HTTPError
+		var code codes.Code
+		var message string
+		switch {
+		case errors.Is(err, echo.ErrNotFound) || errors.Is(err, echo.ErrMethodNotAllowed):
+			code, message = codes.Unimplemented, "unknown method "+c.Request().URL.Path
+		case errors.As(err, &he):
+			code, message = grpcCode(he.Code), fmt.Sprint(he.Message)
+		case err != nil:
+			code, message = codes.Internal, err.Error()
+		case w.status != 0:
+			var body struct {
+				Error string `json:"error"`
+			}
+			message = strings.TrimSpace(w.body.String())
+			if json.Unmarshal(w.body.Bytes(), &body) == nil && body.Error != "" {
+				message = body.Error
+			}
+			code = grpcCode(w.status)
+		default:
+			return nil
+		}
+		writeGRPCStatus(res, code, message)
+		return nil
+	}
+}
+
+// grpcCode maps an HTTP status to the closest gRPC status code
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestTimeout:
+		return codes.Canceled
+	case http.StatusConflict, http.StatusLocked:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if status >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// grpcRenderStatus is the gRPC status of a failed render
+func grpcRenderStatus(err error) error {
+	var re *render.Error
+	if errors.As(err, &re) {
+		return status.Error(grpcCode(re.Status), err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// writeGRPCStatus answers a call the middlewares rejected with a
+// Trailers-Only response
+func writeGRPCStatus(res *echo.Response, code codes.Code, message string) {
+	header := res.Header()
+	header.Del(echo.HeaderContentLength)
+	header.Set(echo.HeaderContentType, "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		header.Set("Grpc-Message", grpcPercentEncode(message))
+	}
+	res.WriteHeader(http.StatusOK)
+}
+
+// grpcPercentEncode escapes a status message as the gRPC spec requires
+func grpcPercentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// templateService implements the TemplateService
+// (proto/templateservice/v1/templateservice.proto)
+type templateService struct {
+	templateservicev1.UnimplementedTemplateServiceServer
+}
+
+// Render renders a template and returns its output in one message
+func (templateService) Render(ctx context.Context, in *templateservicev1.RenderRequest) (*templateservicev1.RenderResponse, error) {
+	req, err := renderRequestFromProto(in)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := renderTemplate(ctx, req)
+	if err != nil {
+		return nil, grpcRenderStatus(err)
+	}
+	return renderResponseProto(rendered, true), nil
+}
+
+// RenderStream renders a template and sends its output in chunks, the last
+// message carrying the result without the output
+func (templateService) RenderStream(in *templateservicev1.RenderRequest, stream grpc.ServerStreamingServer[templateservicev1.RenderChunk]) error {
+	req, err := renderRequestFromProto(in)
+	if err != nil {
+		return err
+	}
+	rendered, err := renderTemplate(stream.Context(), req)
+	if err != nil {
+		return grpcRenderStatus(err)
+	}
+	output := rendered.Output
+	if rendered.Suppressed {
+		output = ""
+	}
+	for output != "" {
+		n := min(len(output), grpcChunkSize)
+		if err := stream.Send(&templateservicev1.RenderChunk{Data: []byte(output[:n])}); err != nil {
+			return err
+		}
+		output = output[n:]
+	}
+	return stream.Send(&templateservicev1.RenderChunk{Result: renderResponseProto(rendered, false)})
+}
+
+// Validate parses a template and lists the variables it references. Parse
+// errors are reported in the response; unknown templates fail the call.
+func (templateService) Validate(ctx context.Context, in *templateservicev1.ValidateRequest) (*templateservicev1.ValidateResponse, error) {
+	req := renderRequest{
+		Name:            "grpc-template",
+		Text:            in.GetText(),
+		Identifier:      in.GetTemplateId(),
+		TemplateName:    in.GetTemplateName(),
+		TemplateVersion: int(in.GetTemplateVersion()),
+		Delimiters:      in.GetDelimiters(),
+		Partials:        in.GetPartials(),
+		Layout:          in.GetLayout(),
+		Parameters:      structMap(in.GetParameters()),
+	}
+	if req.Text == "" && req.Identifier == "" && req.TemplateName == "" {
+		return nil, status.Error(codes.InvalidArgument, "text, template_id or template_name is required")
+	}
+
+	variables, err := extractVariables(ctx, req)
+	var re *render.Error
+	switch {
+	case errors.As(err, &re) && re.Stage == stageParse:
+		return &templateservicev1.ValidateResponse{Error: err.Error()}, nil
+	case err != nil:
+		return nil, grpcRenderStatus(err)
+	}
+	response := &templateservicev1.ValidateResponse{Valid: true}
+	for _, v := range variables {
+		response.Variables = append(response.Variables, v.Name)
+	}
+	if req.Parameters != nil {
+		response.Missing = missingVariables(variables, req.Parameters)
+	}
+	return response, nil
+}
+
+// renderRequestFromProto converts a RenderRequest message
+func renderRequestFromProto(in *templateservicev1.RenderRequest) (renderRequest, error) {
+	req := renderRequest{
+		Name:            "grpc-template",
+		Text:            in.GetText(),
+		Identifier:      in.GetTemplateId(),
+		TemplateName:    in.GetTemplateName(),
+		TemplateVersion: int(in.GetTemplateVersion()),
+		Parameters:      structMap(in.GetParameters()),
+		EncodingFormat:  in.GetEncodingFormat(),
+		Delimiters:      in.GetDelimiters(),
+		MissingKey:      in.GetMissingKey(),
+		Partials:        in.GetPartials(),
+		Layout:          in.GetLayout(),
+		ParametersFrom:  in.GetParametersUpload(),
+		Engine:          in.GetEngine(),
+		EffectiveDate:   in.GetEffectiveDate(),
+		ConvertTo:       in.GetConvertTo(),
+		Debug:           in.GetDebug(),
+		Locale:          in.GetLocale(),
+	}
+	if req.Text == "" && req.Identifier == "" && req.TemplateName == "" {
+		return req, status.Error(codes.InvalidArgument, "text, template_id or template_name is required")
+	}
+	return req, nil
+}
+
+// structMap converts google.protobuf.Struct parameters into the values JSON
+// would produce: maps, slices, float64, string, bool and nil
+func structMap(s *structpb.Struct) map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	return s.AsMap()
+}
+
+// renderResponseProto converts a render result, with or without the output
+func renderResponseProto(rendered *renderResult, withOutput bool) *templateservicev1.RenderResponse {
+	response := &templateservicev1.RenderResponse{
+		EncodingFormat:     rendered.EncodingFormat,
+		Sha256:             rendered.SHA256,
+		ContentUrl:         rendered.ContentURL,
+		Signature:          rendered.Signature,
+		SignatureAlgorithm: rendered.SignatureAlgorithm,
+		TemplateCommit:     rendered.TemplateCommit,
+		Suppressed:         rendered.Suppressed,
+	}
+	if withOutput && !rendered.Suppressed {
+		response.Output = []byte(rendered.Output)
+	}
+	return response
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	templateservicev1 "templateservice/proto/templateservice/v1"
+)
+
+// grpcTestClient serves newGRPCServer over cleartext HTTP/2 and returns a
+// client of it
+func grpcTestClient(t *testing.T) (templateservicev1.TemplateServiceClient, *grpc.ClientConn) {
+	t.Helper()
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := httptest.NewUnstartedServer(newGRPCServer())
+	server.Config.Protocols = &protocols
+	server.Start()
+	t.Cleanup(server.Close)
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(server.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return templateservicev1.NewTemplateServiceClient(conn), conn
+}
+
+// testStruct converts parameters to a google.protobuf.Struct
+func testStruct(t *testing.T, fields map[string]interface{}) *structpb.Struct {
+	t.Helper()
+	s, err := structpb.NewStruct(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGRPCRender(t *testing.T) {
+	client, _ := grpcTestClient(t)
+
+	res, err := client.Render(context.Background(), &templateservicev1.RenderRequest{
+		Text: `{{.greeting}}, {{.person.name}}{{range .tags}} #{{.}}{{end}} {{if .vip}}VIP{{end}} {{.count}}`,
+		Parameters: testStruct(t, map[string]interface{}{
+			"greeting": "Hello",
+			"person":   map[string]interface{}{"name": "Ada"},
+			"tags":     []interface{}{"a", "b"},
+			"vip":      true,
+			"count":    3,
+		}),
+		EncodingFormat: "text/plain",
+	})
+	if err != nil {
+		t.Fatalf("Render() = %v", err)
+	}
+	if string(res.Output) != "Hello, Ada #a #b VIP 3" {
+		t.Errorf("Unexpected output %q", res.Output)
+	}
+	if len(res.Sha256) != 64 {
+		t.Errorf("Expected a SHA-256, got %q", res.Sha256)
+	}
+
+	res, err = client.Render(context.Background(), &templateservicev1.RenderRequest{Text: "compressed"}, grpc.UseCompressor(gzip.Name))
+	if err != nil || string(res.GetOutput()) != "compressed" {
+		t.Errorf("Render() of a gzip-compressed request = %v, %v", res, err)
+	}
+}
+
+func TestGRPCRenderStream(t *testing.T) {
+	client, _ := grpcTestClient(t)
+
+	rows := make([]interface{}, 3000)
+	for i := range rows {
+		rows[i] = strings.Repeat("x", 49) + "\n"
+	}
+	stream, err := client.RenderStream(context.Background(), &templateservicev1.RenderRequest{
+		Text:       `{{range .rows}}{{.}}{{end}}`,
+		Parameters: testStruct(t, map[string]interface{}{"rows": rows}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []*templateservicev1.RenderChunk
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("RenderStream() = %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("Expected 3 chunks and the result, got %d messages", len(chunks))
+	}
+	var output strings.Builder
+	for _, chunk := range chunks[:3] {
+		output.Write(chunk.Data)
+	}
+	if output.Len() != 150000 {
+		t.Errorf("Expected 150000 bytes of output, got %d", output.Len())
+	}
+	if result := chunks[3].Result; result == nil || result.Sha256 == "" || len(result.Output) != 0 {
+		t.Errorf("Expected the last message to carry the result metadata, got %v", chunks[3])
+	}
+}
+
+func TestGRPCValidate(t *testing.T) {
+	client, _ := grpcTestClient(t)
+
+	res, err := client.Validate(context.Background(), &templateservicev1.ValidateRequest{
+		Text:       "{{.name}} {{.address.city}}",
+		Parameters: testStruct(t, map[string]interface{}{"name": "Ada"}),
+	})
+	if err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if !res.Valid || strings.Join(res.Variables, ",") != ".address.city,.name" {
+		t.Errorf("Unexpected variables %q", res.Variables)
+	}
+	if strings.Join(res.Missing, ",") != ".address.city" {
+		t.Errorf("Unexpected missing variables %q", res.Missing)
+	}
+
+	res, err = client.Validate(context.Background(), &templateservicev1.ValidateRequest{Text: "{{.name"})
+	if err != nil || res.Valid || res.Error == "" {
+		t.Errorf("Expected a parse error in the response, got %v, %v", res, err)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	previousKeys, previousSigning, previousMax := apiKeys, requestSigning, grpcMaxMessageSize
+	t.Cleanup(func() { apiKeys, requestSigning, grpcMaxMessageSize = previousKeys, previousSigning, previousMax })
+	hash, err := bcrypt.GenerateFromPassword([]byte("tsk_jobs.jobs-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEMPLATE_API_KEY", "grpc-key-0123456789")
+	t.Setenv("TEMPLATE_API_KEY_HASHES", "tsk_jobs:"+string(hash)+":jobs+templates")
+	if err := configureAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	requestSigning = nil
+	grpcMaxMessageSize = 1 << 10
+	client, conn := grpcTestClient(t)
+
+	invalid := &templateservicev1.RenderRequest{Text: "{{.name"}
+	tests := []struct {
+		name     string
+		request  *templateservicev1.RenderRequest
+		metadata []string
+		code     codes.Code
+	}{
+		{"missing key", invalid, nil, codes.Unauthenticated},
+		{"invalid key", invalid, []string{"x-api-key", "wrong-key-0123456789"}, codes.Unauthenticated},
+		{"key without render scope", invalid, []string{"x-api-key", "tsk_jobs.jobs-secret"}, codes.PermissionDenied},
+		{"parse error", invalid, []string{"authorization", "Bearer grpc-key-0123456789"}, codes.InvalidArgument},
+		{"empty request", &templateservicev1.RenderRequest{}, []string{"x-api-key", "grpc-key-0123456789"}, codes.InvalidArgument},
+		{"oversized request", &templateservicev1.RenderRequest{Text: strings.Repeat("x", 2<<10)}, []string{"x-api-key", "grpc-key-0123456789"}, codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tt.metadata...)
+			if _, err := client.Render(ctx, tt.request); status.Code(err) != tt.code {
+				t.Errorf("Expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "grpc-key-0123456789")
+	err = conn.Invoke(ctx, "/templateservice.v1.TemplateService/Delete", invalid, &templateservicev1.RenderResponse{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected an unknown method to be Unimplemented, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(securityHeadersMiddleware)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/v1/api/cache/stats", ok)
+	e.GET("/assets/logo.svg", ok)
+
+	tests := map[string]string{
+		"/v1/api/cache/stats": apiContentSecurityPolicy,
+		"/assets/logo.svg":    uiContentSecurityPolicy,
+	}
+	for path, policy := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: expected nosniff, got %q", path, got)
+		}
+		if got := rec.Header().Get("Content-Security-Policy"); got != policy {
+			t.Errorf("%s: expected policy %q, got %q", path, policy, got)
+		}
+	}
+}
+
+func TestIsActiveContent(t *testing.T) {
+	tests := map[string]bool{
+		"text/html":                true,
+		"text/html; charset=utf-8": true,
+		"image/svg+xml":            true,
+		"application/xhtml+xml":    true,
+		"text/plain":               false,
+		"application/json":         false,
+		"not a type":               false,
+	}
+	for format, expected := range tests {
+		if got := isActiveContent(format); got != expected {
+			t.Errorf("isActiveContent(%q) = %v, want %v", format, got, expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+// maxHookResponseSize caps the body accepted from a transformation webhook
+const maxHookResponseSize = 64 << 20
+
+// postRenderHooks are webhook URLs that transform rendered output, applied in order.
+// Configured via TEMPLATE_POST_RENDER_HOOKS (comma-separated).
+var postRenderHooks []string
+
+var hookClient = &http.Client{Timeout: 30 * time.Second}
+
+// configurePostRenderHooks loads post-render hook settings from the environment
+func configurePostRenderHooks() {
+	postRenderHooks = envList("TEMPLATE_POST_RENDER_HOOKS")
+	hookClient.Timeout = envDuration("TEMPLATE_HOOK_TIMEOUT", hookClient.Timeout)
+
+	if len(postRenderHooks) > 0 {
+		logger.Infof("Post-render hooks enabled: %d configured", len(postRenderHooks))
+	}
+}
+
+// runPostRenderHooks POSTs the rendered output to each configured hook and
+// substitutes the returned body. A hook may change the output format by
+// answering with a different Content-Type.
+func runPostRenderHooks(ctx context.Context, req renderRequest, result *renderResult) error {
+	for _, hookURL := range postRenderHooks {
+		body, contentType, err := callTransformHook(ctx, hookURL, req, result)
+		if err != nil {
+			return &render.Error{Message: "post-render hook failed", Status: http.StatusBadGateway, Err: err}
+		}
+		result.Output = body
+		if contentType != "" {
+			result.EncodingFormat = contentType
+		}
+	}
+	return nil
+}
+
+// callTransformHook sends the current output to a single hook and returns the transformed body
+func callTransformHook(ctx context.Context, hookURL string, req renderRequest, result *renderResult) (string, string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader([]byte(result.Output)))
+	if err != nil {
+		return "", "", err
+	}
+	httpReq.Header.Set("Content-Type", result.EncodingFormat)
+	injectTraceContext(ctx, httpReq.Header)
+	// The resolved identifier may be a server path or a tenant-qualified
+	// name, so hooks only learn what the caller asked for
+	if req.RequestedID != "" {
+		httpReq.Header.Set("X-Template-Identifier", req.RequestedID)
+	}
+
+	resp, err := hookClient.Do(httpReq)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHookResponseSize+1))
+	if err != nil {
+		return "", "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", "", fmt.Errorf("%s returned status %d", hookURL, resp.StatusCode)
+	}
+	if len(data) > maxHookResponseSize {
+		return "", "", fmt.Errorf("%s response exceeds %d bytes", hookURL, maxHookResponseSize)
+	}
+
+	contentType := ""
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		contentType = mediaType
+	}
+	return string(data), contentType, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func TestPostRenderHooks_TransformOutput(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<p>" + strings.ToUpper(string(body)) + "</p>"))
+	}))
+	defer hook.Close()
+
+	postRenderHooks = []string{hook.URL}
+	defer func() { postRenderHooks = nil }()
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       "Hello {{.Name}}",
+		Parameters: map[string]interface{}{"Name": "World"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+
+	if result.Output != "<p>HELLO WORLD</p>" {
+		t.Errorf("Expected hook output, got %q", result.Output)
+	}
+	if result.EncodingFormat != "text/html" {
+		t.Errorf("Expected encoding format 'text/html', got %q", result.EncodingFormat)
+	}
+}
+
+func TestPostRenderHooks_FailingHook(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hook.Close()
+
+	postRenderHooks = []string{hook.URL}
+	defer func() { postRenderHooks = nil }()
+
+	_, err := renderTemplate(context.Background(), renderRequest{Text: "Hello"})
+	if err == nil {
+		t.Fatal("renderTemplate() should fail when a hook returns an error status")
+	}
+
+	re, ok := err.(*render.Error)
+	if !ok {
+		t.Fatalf("Expected *render.Error, got %T", err)
+	}
+	if re.Status != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, re.Status)
+	}
+}
+
+func TestPostRenderHooks_AssertionsUseHookFormat(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write([]byte("name: Ada\ntags: [a, b]\n"))
+	}))
+	defer hook.Close()
+
+	postRenderHooks = []string{hook.URL}
+	defer func() { postRenderHooks = nil }()
+
+	// The hook turns the JSON output into YAML, which is checked as YAML
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:           `{"name": "Ada", "tags": ["a", "b"]}`,
+		EncodingFormat: "application/json",
+		Assertions:     &render.Assertions{ValidFormat: true},
+	})
+	if err != nil || result.EncodingFormat != "application/yaml" {
+		t.Errorf("Expected the hook's YAML output to pass validFormat, got %v, %v", result, err)
+	}
+}
+
+func TestPostRenderHooks_RequestedIdentifier(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "hello.tmpl"), []byte("Hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withTemplateRoot(t, root)
+
+	var identifier string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identifier = r.Header.Get("X-Template-Identifier")
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer hook.Close()
+
+	postRenderHooks = []string{hook.URL}
+	defer func() { postRenderHooks = nil }()
+
+	// The file is resolved below the template root, which the hook must not see
+	if _, err := renderTemplate(context.Background(), renderRequest{Identifier: "hello.tmpl"}); err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if identifier != "hello.tmpl" {
+		t.Errorf("Expected X-Template-Identifier %q, got %q", "hello.tmpl", identifier)
+	}
+}
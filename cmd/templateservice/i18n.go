@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// localePattern matches BCP 47 style locales such as en, de-CH or zh-Hant-TW
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,8}([-_][A-Za-z0-9]{1,8})*$`)
+
+// defaultLocale is the locale of requests that name none, and the last
+// fallback of every message lookup. Configured via TEMPLATE_DEFAULT_LOCALE.
+var defaultLocale = "en"
+
+// messageCatalog holds the translated messages of one locale, either for a
+// tenant or for everyone (tenant "default")
+type messageCatalog struct {
+	Tenant   string            `json:"tenant"`
+	Locale   string            `json:"locale"`
+	Messages map[string]string `json:"messages"` // Dotted key to message, e.g. welcome.subject
+	Updated  time.Time         `json:"updated"`
+}
+
+// catalogStore keeps the message catalogs by tenant and locale, in
+// TEMPLATE_MESSAGES_FILE when set
+type catalogStore struct {
+	file string
+
+	mu       sync.RWMutex
+	catalogs map[string]map[string]*messageCatalog
+}
+
+var catalogs = newCatalogStore("")
+
+func newCatalogStore(file string) *catalogStore {
+	return &catalogStore{file: file, catalogs: make(map[string]map[string]*messageCatalog)}
+}
+
+// configureMessageCatalogs loads the default locale and the catalogs
+// persisted in TEMPLATE_MESSAGES_FILE
+func configureMessageCatalogs() error {
+	locale, err := normalizeLocale(os.Getenv("TEMPLATE_DEFAULT_LOCALE"))
+	if err != nil {
+		return fmt.Errorf("TEMPLATE_DEFAULT_LOCALE: %w", err)
+	}
+	if locale != "" {
+		defaultLocale = locale
+	}
+	store := newCatalogStore(os.Getenv("TEMPLATE_MESSAGES_FILE"))
+	if store.file != "" {
+		if err := store.load(); err != nil {
+			return fmt.Errorf("TEMPLATE_MESSAGES_FILE: %w", err)
+		}
+		logger.Infof("Loaded %d message catalogs from %s", len(store.sorted()), store.file)
+	}
+	catalogs = store
+	return nil
+}
+
+func (s *catalogStore) load() error {
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []*messageCatalog
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	for _, catalog := range list {
+		if catalog.Locale, err = normalizeLocale(catalog.Locale); err != nil || catalog.Locale == "" {
+			return fmt.Errorf("catalog of %s: invalid locale", catalog.Tenant)
+		}
+		s.put(catalog)
+	}
+	return nil
+}
+
+// save persists the store. The caller holds s.mu.
+func (s *catalogStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.file, data)
+}
+
+// put adds or replaces a catalog. The caller holds s.mu.
+func (s *catalogStore) put(catalog *messageCatalog) {
+	byLocale, ok := s.catalogs[catalog.Tenant]
+	if !ok {
+		byLocale = make(map[string]*messageCatalog)
+		s.catalogs[catalog.Tenant] = byLocale
+	}
+	byLocale[catalog.Locale] = catalog
+}
+
+// remove deletes a catalog. The caller holds s.mu.
+func (s *catalogStore) remove(tenant, locale string) {
+	delete(s.catalogs[tenant], locale)
+	if len(s.catalogs[tenant]) == 0 {
+		delete(s.catalogs, tenant)
+	}
+}
+
+func (s *catalogStore) sorted() []*messageCatalog {
+	var list []*messageCatalog
+	for _, byLocale := range s.catalogs {
+		for _, catalog := range byLocale {
+			list = append(list, catalog)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Tenant != list[j].Tenant {
+			return list[i].Tenant < list[j].Tenant
+		}
+		return list[i].Locale < list[j].Locale
+	})
+	return list
+}
+
+// messagesFor merges the messages a tenant sees in a locale. More specific
+// locales win over their language and the default locale (de-CH over de
+// over en), and at the same locale the tenant's catalog wins over the
+// shared one.
+func (s *catalogStore) messagesFor(tenant, locale string) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.catalogs) == 0 {
+		return nil
+	}
+	chain := localeChain(locale)
+	messages := make(map[string]string)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, owner := range []string{defaultThemeTenant, tenant} {
+			if owner == "" {
+				continue
+			}
+			if catalog, ok := s.catalogs[owner][chain[i]]; ok {
+				for key, message := range catalog.Messages {
+					messages[key] = message
+				}
+			}
+		}
+	}
+	return messages
+}
+
+// localeChain lists the locales a lookup falls back through, most specific
+// first: de-CH, de, then the default locale and its language
+func localeChain(locale string) []string {
+	var chain []string
+	seen := make(map[string]bool)
+	for _, l := range []string{locale, defaultLocale} {
+		for l != "" {
+			if !seen[l] {
+				seen[l] = true
+				chain = append(chain, l)
+			}
+			cut := strings.LastIndexByte(l, '-')
+			if cut < 0 {
+				break
+			}
+			l = l[:cut]
+		}
+	}
+	return chain
+}
+
+// normalizeLocale returns locale in canonical form (de_ch becomes de-CH),
+// or "" for an empty locale
+func normalizeLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+	if !localePattern.MatchString(locale) {
+		return "", fmt.Errorf("invalid locale %q", locale)
+	}
+	parts := strings.FieldsFunc(locale, func(r rune) bool { return r == '-' || r == '_' })
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// resolveLocale sets the request's effective locale and the messages its
+// tenant sees in it
+func resolveLocale(req renderRequest, tenant string) (renderRequest, error) {
+	locale, err := normalizeLocale(req.Locale)
+	if err != nil {
+		return req, &render.Error{Message: err.Error(), Status: http.StatusBadRequest}
+	}
+	if locale == "" {
+		locale = defaultLocale
+	}
+	req.Locale = locale
+	req.Messages = catalogs.messagesFor(tenant, locale)
+	return req, nil
+}
+
+// flattenMessages turns a nested catalog ({"welcome": {"subject": "..."}})
+// into dotted keys (welcome.subject)
+func flattenMessages(prefix string, value interface{}, messages map[string]string) error {
+	switch v := value.(type) {
+	case string:
+		if prefix == "" {
+			return errors.New("messages must be a JSON object")
+		}
+		messages[prefix] = v
+	case map[string]interface{}:
+		for key, nested := range v {
+			if key == "" {
+				return fmt.Errorf("empty message key below %q", prefix)
+			}
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if err := flattenMessages(key, nested, messages); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("message %q must be a string or an object", prefix)
+	}
+	return nil
+}
+
+// handleListMessageCatalogs handles GET /v1/api/messages
+func handleListMessageCatalogs(c echo.Context) error {
+	catalogs.mu.RLock()
+	defer catalogs.mu.RUnlock()
+	return c.JSON(http.StatusOK, map[string]interface{}{"catalogs": catalogs.sorted(), "defaultLocale": defaultLocale})
+}
+
+// catalogParams returns the tenant and normalized locale of a catalog route
+func catalogParams(c echo.Context) (string, string, error) {
+	tenant := c.Param("tenant")
+	if !templateNamePattern.MatchString(tenant) {
+		return "", "", errors.New("invalid tenant")
+	}
+	locale, err := normalizeLocale(c.Param("locale"))
+	if err != nil || locale == "" {
+		return "", "", errors.New("invalid locale")
+	}
+	return tenant, locale, nil
+}
+
+// handleGetMessageCatalog handles GET /v1/api/messages/:tenant/:locale
+func handleGetMessageCatalog(c echo.Context) error {
+	tenant, locale, err := catalogParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	catalogs.mu.RLock()
+	defer catalogs.mu.RUnlock()
+	catalog, ok := catalogs.catalogs[tenant][locale]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "message catalog not found"})
+	}
+	return c.JSON(http.StatusOK, catalog)
+}
+
+// handlePutMessageCatalog handles PUT /v1/api/messages/:tenant/:locale,
+// creating or replacing the tenant's catalog ("default" for the catalog
+// shared by all tenants). The body is a JSON object of messages, nested
+// objects giving dotted keys.
+func handlePutMessageCatalog(c echo.Context) error {
+	tenant, locale, err := catalogParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	var body interface{}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid messages: %v", err)})
+	}
+	messages := make(map[string]string)
+	if err := flattenMessages("", body, messages); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	catalog := &messageCatalog{Tenant: tenant, Locale: locale, Messages: messages, Updated: time.Now().UTC()}
+
+	catalogs.mu.Lock()
+	defer catalogs.mu.Unlock()
+	previous, existed := catalogs.catalogs[tenant][locale]
+	catalogs.put(catalog)
+	if err := catalogs.save(); err != nil {
+		if existed {
+			catalogs.put(previous)
+		} else {
+			catalogs.remove(tenant, locale)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	status := http.StatusOK
+	if !existed {
+		status = http.StatusCreated
+	}
+	return c.JSON(status, catalog)
+}
+
+// handleDeleteMessageCatalog handles DELETE /v1/api/messages/:tenant/:locale
+func handleDeleteMessageCatalog(c echo.Context) error {
+	tenant, locale, err := catalogParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	catalogs.mu.Lock()
+	defer catalogs.mu.Unlock()
+	catalog, ok := catalogs.catalogs[tenant][locale]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "message catalog not found"})
+	}
+	catalogs.remove(tenant, locale)
+	if err := catalogs.save(); err != nil {
+		catalogs.put(catalog)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
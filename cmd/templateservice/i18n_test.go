@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func withCatalogs(t *testing.T, file string) *catalogStore {
+	t.Helper()
+	previous := catalogs
+	catalogs = newCatalogStore(file)
+	t.Cleanup(func() { catalogs = previous })
+	return catalogs
+}
+
+func catalogsServer() *echo.Echo {
+	e := echo.New()
+	e.GET("/v1/api/messages", handleListMessageCatalogs)
+	e.GET("/v1/api/messages/:tenant/:locale", handleGetMessageCatalog)
+	e.PUT("/v1/api/messages/:tenant/:locale", handlePutMessageCatalog)
+	e.DELETE("/v1/api/messages/:tenant/:locale", handleDeleteMessageCatalog)
+	return e
+}
+
+func TestMessageCatalogs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "messages.json")
+	withCatalogs(t, file)
+	e := catalogsServer()
+
+	puts := map[string]string{
+		"/v1/api/messages/default/en":    `{"welcome": {"subject": "Welcome, {name}!", "footer": "Thanks"}}`,
+		"/v1/api/messages/default/de":    `{"welcome": {"subject": "Willkommen, {name}!"}}`,
+		"/v1/api/messages/default/de_ch": `{"welcome.footer": "Merci"}`,
+		"/v1/api/messages/acme/de":       `{"welcome": {"subject": "Grüezi {name} bei ACME"}}`,
+	}
+	for target, body := range puts {
+		if rec := themesCall(e, http.MethodPut, target, body); rec.Code != http.StatusCreated {
+			t.Fatalf("PUT %s = %d %s", target, rec.Code, rec.Body)
+		}
+	}
+	for _, body := range []string{`"text"`, `{"a": 1}`, `{"": "x"}`} {
+		if rec := themesCall(e, http.MethodPut, "/v1/api/messages/default/en", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: expected 400, got %d", body, rec.Code)
+		}
+	}
+	if rec := themesCall(e, http.MethodPut, "/v1/api/messages/default/x", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid locale, got %d", rec.Code)
+	}
+	if rec := themesCall(e, http.MethodGet, "/v1/api/messages/default/de-CH", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the normalized de-CH catalog, got %d", rec.Code)
+	}
+
+	const text = `{{locale}}: {{t "welcome.subject" "name" .Name}} {{t "welcome.footer"}} {{t "missing.key"}}`
+	tests := []struct {
+		tenant string
+		locale string
+		want   string
+	}{
+		{"", "", "en: Welcome, Ada! Thanks missing.key"},
+		{"", "de-AT", "de-AT: Willkommen, Ada! Thanks missing.key"},
+		{"", "de-ch", "de-CH: Willkommen, Ada! Merci missing.key"},
+		{"acme", "de-CH", "de-CH: Grüezi Ada bei ACME Merci missing.key"},
+		{"acme", "fr", "fr: Welcome, Ada! Thanks missing.key"},
+	}
+	for _, tt := range tests {
+		ctx := withRenderCaller(context.Background(), renderCaller{Tenant: tt.tenant})
+		result, err := renderTemplate(ctx, renderRequest{Text: text, Locale: tt.locale, Parameters: map[string]interface{}{"Name": "Ada"}})
+		if err != nil || result.Output != tt.want {
+			t.Errorf("tenant %q, locale %q: renderTemplate() = %v, %v; want %q", tt.tenant, tt.locale, result, err, tt.want)
+		}
+	}
+	if _, err := renderTemplate(context.Background(), renderRequest{Text: text, Locale: "en US"}); err == nil {
+		t.Error("Expected an error for an invalid locale")
+	}
+
+	reloaded := newCatalogStore(file)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.messagesFor("acme", "de")["welcome.subject"]; got != "Grüezi {name} bei ACME" {
+		t.Errorf("Expected persisted catalogs, got %q", got)
+	}
+
+	if rec := themesCall(e, http.MethodDelete, "/v1/api/messages/acme/de", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting a catalog, got %d", rec.Code)
+	}
+	if rec := themesCall(e, http.MethodGet, "/v1/api/messages/acme/de", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", rec.Code)
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := map[string]string{"en": "en", "DE_ch": "de-CH", "zh-hant-tw": "zh-Hant-TW", "es-419": "es-419"}
+	for in, want := range tests {
+		if got, err := normalizeLocale(in); err != nil || got != want {
+			t.Errorf("normalizeLocale(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"e", "en US", "../en"} {
+		if _, err := normalizeLocale(in); err == nil {
+			t.Errorf("Expected an error for %q", in)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"templateservice/pkg/render"
+)
+
+// mailInvite describes the calendar invite (iCalendar, RFC 5545, with
+// METHOD:REQUEST) added to mailbox replies. Every field except When is a Go
+// template rendered with the message's parameters.
+type mailInvite struct {
+	When        string `json:"when,omitempty"` // Parameter path; the invite is only added when truthy
+	UID         string `json:"uid,omitempty"`  // Stable across updates of the same event; derived when empty
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Start       string `json:"start"`               // RFC 3339 time
+	End         string `json:"end,omitempty"`       // RFC 3339 time; Start plus Duration when empty
+	Duration    string `json:"duration,omitempty"`  // Go duration, 1h by default
+	Organizer   string `json:"organizer,omitempty"` // Address; the reply's sender when empty
+	Attendees   string `json:"attendees"`           // Comma-separated addresses ("Ada <ada@example.com>, bob@example.com")
+
+	fields map[string]render.Template
+}
+
+// parseMailInvite parses an invite description and compiles its fields
+func parseMailInvite(config string) (*mailInvite, error) {
+	var invite mailInvite
+	if err := json.Unmarshal([]byte(config), &invite); err != nil {
+		return nil, err
+	}
+	if invite.Summary == "" || invite.Start == "" || invite.Attendees == "" {
+		return nil, errors.New("summary, start and attendees are required")
+	}
+	invite.fields = make(map[string]render.Template)
+	empty := ""
+	for name, text := range map[string]string{
+		"uid": invite.UID, "summary": invite.Summary, "description": invite.Description, "location": invite.Location,
+		"start": invite.Start, "end": invite.End, "duration": invite.Duration, "organizer": invite.Organizer, "attendees": invite.Attendees,
+	} {
+		// Missing parameters leave a field empty
+		tmpl, err := render.Parse(render.Request{Name: name, Text: text, MissingValue: &empty})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		invite.fields[name] = tmpl
+	}
+	return &invite, nil
+}
+
+// applies reports whether the invite is added for parameters
+func (i *mailInvite) applies(parameters map[string]interface{}) bool {
+	return mailAttachment{When: i.When}.applies(parameters)
+}
+
+// render writes the invite for parameters as an iCalendar object, from
+// sender unless an organizer is given
+func (i *mailInvite) render(parameters map[string]interface{}, sender string) (string, error) {
+	values := make(map[string]string, len(i.fields))
+	for name, tmpl := range i.fields {
+		var out strings.Builder
+		if err := tmpl.Execute(&out, parameters); err != nil {
+			return "", err
+		}
+		values[name] = strings.TrimSpace(out.String())
+	}
+
+	start, err := time.Parse(time.RFC3339, values["start"])
+	if err != nil {
+		return "", fmt.Errorf("start %q is not an RFC 3339 time", values["start"])
+	}
+	end := start.Add(time.Hour)
+	switch {
+	case values["end"] != "":
+		if end, err = time.Parse(time.RFC3339, values["end"]); err != nil {
+			return "", fmt.Errorf("end %q is not an RFC 3339 time", values["end"])
+		}
+	case values["duration"] != "":
+		duration, err := time.ParseDuration(values["duration"])
+		if err != nil {
+			return "", fmt.Errorf("invalid duration %q", values["duration"])
+		}
+		end = start.Add(duration)
+	}
+	if !end.After(start) {
+		return "", errors.New("the event must end after it starts")
+	}
+
+	if values["organizer"] == "" {
+		values["organizer"] = sender
+	}
+	organizer, err := mail.ParseAddress(values["organizer"])
+	if err != nil {
+		return "", fmt.Errorf("invalid organizer %q", values["organizer"])
+	}
+	attendees, err := mail.ParseAddressList(values["attendees"])
+	if err != nil || len(attendees) == 0 {
+		return "", fmt.Errorf("invalid attendees %q", values["attendees"])
+	}
+	if values["summary"] == "" {
+		return "", errors.New("summary is empty")
+	}
+	uid := values["uid"]
+	if uid == "" {
+		digest := sha256.Sum256([]byte(organizer.Address + "\n" + start.UTC().Format(time.RFC3339) + "\n" + values["summary"]))
+		uid = fmt.Sprintf("%x@templateservice", digest[:16])
+	}
+
+	const stamp = "20060102T150405Z"
+	var ics strings.Builder
+	line := func(content string) {
+		ics.WriteString(foldICSLine(content))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//evalgo//templateservice//EN")
+	line("METHOD:REQUEST")
+	line("BEGIN:VEVENT")
+	line("UID:" + escapeICSText(uid))
+	line("DTSTAMP:" + time.Now().UTC().Format(stamp))
+	line("DTSTART:" + start.UTC().Format(stamp))
+	line("DTEND:" + end.UTC().Format(stamp))
+	line("SUMMARY:" + escapeICSText(values["summary"]))
+	if values["description"] != "" {
+		line("DESCRIPTION:" + escapeICSText(values["description"]))
+	}
+	if values["location"] != "" {
+		line("LOCATION:" + escapeICSText(values["location"]))
+	}
+	line("ORGANIZER" + icsCommonName(organizer) + ":mailto:" + organizer.Address)
+	for _, attendee := range attendees {
+		line("ATTENDEE" + icsCommonName(attendee) + ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:" + attendee.Address)
+	}
+	line("SEQUENCE:0")
+	line("STATUS:CONFIRMED")
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+	return ics.String(), nil
+}
+
+// icsCommonName returns the CN parameter of an address with a display name
+func icsCommonName(addr *mail.Address) string {
+	if addr.Name == "" {
+		return ""
+	}
+	return `;CN="` + strings.NewReplacer(`"`, "'", "\r", "", "\n", " ").Replace(addr.Name) + `"`
+}
+
+// escapeICSText escapes a TEXT value: backslashes, semicolons, commas and
+// line breaks
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// foldICSLine ends a content line with CRLF, folding it after 75 octets
+// without splitting a UTF-8 sequence
+func foldICSLine(content string) string {
+	var out strings.Builder
+	limit := 75
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		out.WriteString(content[:cut] + "\r\n ")
+		content = content[cut:]
+		limit = 74 // The leading space of a continuation line counts
+	}
+	out.WriteString(content + "\r\n")
+	return out.String()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMailInvite(t *testing.T) {
+	invite, err := parseMailInvite(`{
+		"when": ".meeting",
+		"summary": "Consultation with {{.name}}",
+		"description": "Topic: {{.meeting.topic}}\nBring your documents, please.",
+		"location": "{{.meeting.room}}",
+		"start": "{{.meeting.start}}",
+		"duration": "30m",
+		"attendees": "{{.name}} <{{.email}}>{{range .meeting.guests}}, {{.}}{{end}}"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := map[string]interface{}{
+		"name":  "Ada Lovelace",
+		"email": "ada@example.com",
+		"meeting": map[string]interface{}{
+			"topic":  "Pensions; taxes, etc.",
+			"start":  "2026-11-03T14:00:00+01:00",
+			"guests": []interface{}{"bob@example.com"},
+		},
+	}
+	if !invite.applies(parameters) || invite.applies(map[string]interface{}{"name": "Ada"}) {
+		t.Error("Expected the invite to apply only with a meeting")
+	}
+
+	ics, err := invite.render(parameters, "Front Desk <desk@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ics = strings.ReplaceAll(ics, "\r\n ", "") // Unfold
+	for _, expected := range []string{
+		"METHOD:REQUEST\r\n",
+		"DTSTART:20261103T130000Z\r\n",
+		"DTEND:20261103T133000Z\r\n",
+		"SUMMARY:Consultation with Ada Lovelace\r\n",
+		`DESCRIPTION:Topic: Pensions\; taxes\, etc.\nBring your documents\, please.` + "\r\n",
+		"ORGANIZER;CN=\"Front Desk\":mailto:desk@example.com\r\n",
+		"ATTENDEE;CN=\"Ada Lovelace\";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:ada@example.com\r\n",
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com\r\n",
+	} {
+		if !strings.Contains(ics, expected) {
+			t.Errorf("Expected %q in\n%s", expected, ics)
+		}
+	}
+	if strings.Contains(ics, "LOCATION") {
+		t.Error("Expected no LOCATION for a missing room")
+	}
+
+	again, _ := invite.render(parameters, "desk@example.com")
+	uid := func(ics string) string { return strings.SplitN(strings.SplitN(ics, "UID:", 2)[1], "\r\n", 2)[0] }
+	if uid(ics) != uid(again) {
+		t.Error("Expected the derived UID to be stable")
+	}
+
+	parameters["meeting"].(map[string]interface{})["start"] = "tomorrow"
+	if _, err := invite.render(parameters, "desk@example.com"); err == nil {
+		t.Error("Expected an error for an invalid start")
+	}
+	if _, err := parseMailInvite(`{"summary": "Call"}`); err == nil {
+		t.Error("Expected start and attendees to be required")
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("ä", 60)
+	folded := foldICSLine(line)
+	for _, l := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("Line of %d octets: %q", len(l), l)
+		}
+	}
+	if strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", "") != line {
+		t.Errorf("Unfolding %q does not restore the line", folded)
+	}
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+// imapWatcher polls a mailbox for unseen messages carrying a JSON or CSV
+// attachment, renders a stored template with the attachment's data and
+// mails the result back to the sender or to a fixed address
+type imapWatcher struct {
+	addr     string // host:port
+	useTLS   bool
+	mailbox  string
+	username string
+	password string
+	template string // Stored template name
+	maxBytes int64
+	timeout  time.Duration
+
+	smtpAddr  string
+	smtpAuth  smtp.Auth
+	from      string
+	forwardTo string // Recipient of all results; replies to the sender when empty
+
+	attachments []mailAttachment
+	invite      *mailInvite // Calendar invite added to replies (see ics.go)
+}
+
+// mailAttachment is an additional render of a message's data with another
+// stored template, attached to the reply when its condition holds
+type mailAttachment struct {
+	Template       string `json:"template"` // Stored template name
+	Filename       string `json:"filename"`
+	EncodingFormat string `json:"encodingFormat,omitempty"` // Overrides the template's
+	When           string `json:"when,omitempty"`           // Parameter path (".includeInvoice"); attached only when truthy
+}
+
+// applies reports whether the attachment is produced for parameters
+func (a mailAttachment) applies(parameters map[string]interface{}) bool {
+	if a.When == "" {
+		return true
+	}
+	value, ok := render.LookupPath(parameters, strings.TrimPrefix(a.When, "."))
+	if !ok {
+		return false
+	}
+	truth, _ := template.IsTrue(value)
+	return truth
+}
+
+// renderedAttachment is a produced attachment of a reply
+type renderedAttachment struct {
+	filename    string
+	contentType string
+	content     string
+}
+
+// imapWatch is nil unless TEMPLATE_IMAP_URL is set
+var imapWatch *imapWatcher
+
+// sendMail delivers a message; tests substitute a recorder
+var sendMail = smtp.SendMail
+
+// configureIMAPWatcher loads the mailbox and SMTP settings and starts polling
+func configureIMAPWatcher(ctx context.Context) error {
+	imapWatch = nil
+	raw := os.Getenv("TEMPLATE_IMAP_URL")
+	if raw == "" {
+		return nil
+	}
+	w, err := newIMAPWatcher(raw)
+	if err != nil {
+		return err
+	}
+	w.username = os.Getenv("TEMPLATE_IMAP_USERNAME")
+	w.password = os.Getenv("TEMPLATE_IMAP_PASSWORD")
+	w.template = os.Getenv("TEMPLATE_IMAP_TEMPLATE")
+	if !validTemplateName(w.template) {
+		return fmt.Errorf("TEMPLATE_IMAP_TEMPLATE must name a stored template, got %q", w.template)
+	}
+	w.maxBytes = int64(envInt("TEMPLATE_IMAP_MAX_MB", 16)) << 20
+	w.timeout = envDuration("TEMPLATE_IMAP_TIMEOUT", time.Minute)
+
+	settings, ok := smtpFromEnv()
+	if !ok {
+		return errors.New("TEMPLATE_SMTP_ADDR and TEMPLATE_SMTP_FROM are required with TEMPLATE_IMAP_URL")
+	}
+	w.smtpAddr, w.smtpAuth, w.from = settings.addr, settings.auth, settings.from
+	w.forwardTo = os.Getenv("TEMPLATE_IMAP_FORWARD_TO")
+	if config := os.Getenv("TEMPLATE_IMAP_ATTACHMENTS"); config != "" {
+		if err := json.Unmarshal([]byte(config), &w.attachments); err != nil {
+			return fmt.Errorf("TEMPLATE_IMAP_ATTACHMENTS: %w", err)
+		}
+		for i, a := range w.attachments {
+			if !validTemplateName(a.Template) || a.Filename == "" {
+				return fmt.Errorf("TEMPLATE_IMAP_ATTACHMENTS[%d]: a valid template name and a filename are required", i)
+			}
+		}
+	}
+
+	if config := os.Getenv("TEMPLATE_IMAP_INVITE"); config != "" {
+		if w.invite, err = parseMailInvite(config); err != nil {
+			return fmt.Errorf("TEMPLATE_IMAP_INVITE: %w", err)
+		}
+	}
+
+	imapWatch = w
+	interval := envDuration("TEMPLATE_IMAP_INTERVAL", time.Minute)
+	logger.Infof("Watching IMAP mailbox %s on %s every %s", w.mailbox, w.addr, interval)
+	go w.pollEvery(ctx, interval)
+	return nil
+}
+
+// newIMAPWatcher parses an imaps://host[:port]/mailbox or imap:// URL
+func newIMAPWatcher(raw string) (*imapWatcher, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "imap" && u.Scheme != "imaps") {
+		return nil, fmt.Errorf("TEMPLATE_IMAP_URL must be an imap:// or imaps:// URL, got %q", raw)
+	}
+	w := &imapWatcher{addr: u.Host, useTLS: u.Scheme == "imaps", mailbox: strings.TrimPrefix(u.Path, "/")}
+	if u.Port() == "" {
+		port := "143"
+		if w.useTLS {
+			port = "993"
+		}
+		w.addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	if w.mailbox == "" {
+		w.mailbox = "INBOX"
+	}
+	return w, nil
+}
+
+// pollEvery checks the mailbox periodically until ctx is done
+func (w *imapWatcher) pollEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.poll(ctx); err != nil {
+			logger.WithError(err).Error("Failed to poll IMAP mailbox")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll processes all unseen messages and returns how many were answered.
+// Every message is marked seen once handled; messages that could not be
+// answered are also flagged for an operator.
+func (w *imapWatcher) poll(ctx context.Context) (int, error) {
+	conn, err := w.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.close()
+
+	if _, err := conn.command("LOGIN %s %s", imapQuote(w.username), imapQuote(w.password)); err != nil {
+		return 0, err
+	}
+	if _, err := conn.command("SELECT %s", imapQuote(w.mailbox)); err != nil {
+		return 0, err
+	}
+	resp, err := conn.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return 0, err
+	}
+	var uids []string
+	for _, line := range resp.lines {
+		if fields, ok := strings.CutPrefix(line, "* SEARCH"); ok {
+			uids = append(uids, strings.Fields(fields)...)
+		}
+	}
+
+	answered := 0
+	for _, uid := range uids {
+		if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+			continue
+		}
+		flags := `\Seen`
+		if err := w.handleMessage(ctx, conn, uid); err != nil {
+			logger.WithError(err).Error(fmt.Sprintf("Failed to answer IMAP message %s", uid))
+			flags = `\Seen \Flagged`
+		} else {
+			answered++
+		}
+		if _, err := conn.command("UID STORE %s +FLAGS (%s)", uid, flags); err != nil {
+			return answered, err
+		}
+	}
+	_, _ = conn.command("LOGOUT")
+	return answered, nil
+}
+
+// handleMessage fetches, renders and answers one message
+func (w *imapWatcher) handleMessage(ctx context.Context, conn *imapConn, uid string) error {
+	resp, err := conn.command("UID FETCH %s (RFC822.SIZE)", uid)
+	if err != nil {
+		return err
+	}
+	if size := imapMessageSize(resp.lines); size > w.maxBytes {
+		return fmt.Errorf("message of %d bytes exceeds %d bytes", size, w.maxBytes)
+	}
+	resp, err = conn.command("UID FETCH %s BODY.PEEK[]", uid)
+	if err != nil {
+		return err
+	}
+	if len(resp.literals) == 0 {
+		return errors.New("message body missing from FETCH response")
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(resp.literals[0]))
+	if err != nil {
+		return err
+	}
+	if auto := msg.Header.Get("Auto-Submitted"); auto != "" && !strings.EqualFold(auto, "no") {
+		return fmt.Errorf("not answering automatic message (Auto-Submitted: %s)", auto)
+	}
+
+	parameters, err := mailParameters(msg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	ctx = withRenderCaller(ctx, renderCaller{Principal: "imap:" + w.username, Endpoint: "IMAP " + w.mailbox})
+	result, err := renderTemplate(ctx, renderRequest{TemplateName: w.template, Parameters: parameters})
+	if err != nil {
+		return err
+	}
+	if result.Suppressed {
+		logger.Infof("Output for message %s suppressed, not answering", uid)
+		return nil
+	}
+
+	var attachments []renderedAttachment
+	for _, a := range w.attachments {
+		if !a.applies(parameters) {
+			continue
+		}
+		rendered, err := renderTemplate(ctx, renderRequest{TemplateName: a.Template, Parameters: parameters, EncodingFormat: a.EncodingFormat})
+		if err != nil {
+			return fmt.Errorf("attachment %s: %w", a.Filename, err)
+		}
+		if !rendered.Suppressed {
+			attachments = append(attachments, renderedAttachment{filename: a.Filename, contentType: rendered.EncodingFormat, content: rendered.Output})
+		}
+	}
+	if w.invite != nil && w.invite.applies(parameters) {
+		invite, err := w.invite.render(parameters, w.from)
+		if err != nil {
+			return fmt.Errorf("invite: %w", err)
+		}
+		attachments = append(attachments, renderedAttachment{filename: "invite.ics", contentType: "text/calendar; method=REQUEST", content: invite})
+	}
+	return w.answer(msg, result, attachments)
+}
+
+// answer mails the rendered output as a reply to msg, or forwards it, with
+// any attachments rendered alongside it
+func (w *imapWatcher) answer(msg *mail.Message, result *renderResult, attachments []renderedAttachment) error {
+	var decoder mime.WordDecoder
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	to := w.forwardTo
+	if to == "" {
+		sender := msg.Header.Get("Reply-To")
+		if sender == "" {
+			sender = msg.Header.Get("From")
+		}
+		addr, err := mail.ParseAddress(sender)
+		if err != nil {
+			return fmt.Errorf("no address to reply to: %w", err)
+		}
+		to = addr.Address
+		if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+			subject = "Re: " + subject
+		}
+	} else {
+		subject = "Fwd: " + subject
+	}
+
+	var body bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&body, "%s: %s\r\n", name, strings.NewReplacer("\r", "", "\n", "").Replace(value))
+	}
+	header("From", w.from)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	if id := msg.Header.Get("Message-Id"); id != "" {
+		header("In-Reply-To", id)
+		header("References", id)
+	}
+	header("Auto-Submitted", "auto-replied")
+	header("MIME-Version", "1.0")
+	if len(attachments) == 0 {
+		header("Content-Type", mailContentType(result.EncodingFormat))
+		header("Content-Transfer-Encoding", "base64")
+		body.WriteString("\r\n")
+		body.WriteString(mailBase64(result.Output))
+		return sendMail(w.smtpAddr, w.smtpAuth, w.from, []string{to}, body.Bytes())
+	}
+
+	parts := multipart.NewWriter(&body)
+	header("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+	body.WriteString("\r\n")
+	part, _ := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mailContentType(result.EncodingFormat)},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	io.WriteString(part, mailBase64(result.Output))
+	for _, a := range attachments {
+		part, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mailContentType(a.contentType)},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		io.WriteString(part, mailBase64(a.content))
+	}
+	parts.Close()
+	return sendMail(w.smtpAddr, w.smtpAuth, w.from, []string{to}, body.Bytes())
+}
+
+// mailContentType returns the Content-Type of a rendered part, declaring
+// UTF-8 for text
+func mailContentType(encodingFormat string) string {
+	if strings.HasPrefix(encodingFormat, "text/") && !strings.Contains(encodingFormat, "charset") {
+		return encodingFormat + "; charset=utf-8"
+	}
+	return encodingFormat
+}
+
+// mailBase64 encodes a part body in lines of 76 characters
+func mailBase64(content string) string {
+	var out strings.Builder
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	for len(encoded) > 76 {
+		out.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	out.WriteString(encoded + "\r\n")
+	return out.String()
+}
+
+// mailParameters returns the template parameters carried by the first JSON
+// or CSV attachment: a JSON object as is, CSV as {"rows": [...]} with one
+// object per row keyed by the header line. The message's sender, subject
+// and date are added as "email" unless the data defines it.
+func mailParameters(msg *mail.Message) (map[string]interface{}, error) {
+	data, mediaType, err := findDataPart(msg.Header.Get, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("message has no JSON or CSV attachment")
+	}
+
+	var parameters map[string]interface{}
+	if mediaType == "text/csv" {
+		rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV attachment: %w", err)
+		}
+		records := make([]interface{}, 0, len(rows))
+		for _, row := range rows[min(1, len(rows)):] {
+			record := make(map[string]interface{}, len(row))
+			for i, value := range row {
+				if i < len(rows[0]) {
+					record[rows[0][i]] = value
+				}
+			}
+			records = append(records, record)
+		}
+		parameters = map[string]interface{}{"rows": records}
+	} else if err := json.Unmarshal(data, &parameters); err != nil || parameters == nil {
+		return nil, fmt.Errorf("JSON attachment must be an object: %v", err)
+	}
+
+	if _, ok := parameters["email"]; !ok {
+		var decoder mime.WordDecoder
+		subject, _ := decoder.DecodeHeader(msg.Header.Get("Subject"))
+		parameters["email"] = map[string]interface{}{
+			"from":    msg.Header.Get("From"),
+			"subject": subject,
+			"date":    msg.Header.Get("Date"),
+		}
+	}
+	return parameters, nil
+}
+
+// findDataPart walks a (possibly nested multipart) entity and returns the
+// decoded content of the first JSON or CSV part
+func findDataPart(header func(string) string, body io.Reader) ([]byte, string, error) {
+	mediaType, params, _ := mime.ParseMediaType(header("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, "", nil
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid multipart message: %w", err)
+			}
+			data, kind, err := findDataPart(part.Header.Get, part)
+			if data != nil || err != nil {
+				return data, kind, err
+			}
+		}
+	}
+
+	kind := dataMediaType(mediaType, attachmentName(header, params))
+	if kind == "" {
+		return nil, "", nil
+	}
+	var reader io.Reader = body
+	if strings.EqualFold(header("Content-Transfer-Encoding"), "base64") {
+		reader = base64.NewDecoder(base64.StdEncoding, &lineStripper{r: body})
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode attachment: %w", err)
+	}
+	return data, kind, nil
+}
+
+// attachmentName returns a part's file name from Content-Disposition or Content-Type
+func attachmentName(header func(string) string, contentTypeParams map[string]string) string {
+	if _, params, err := mime.ParseMediaType(header("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	return contentTypeParams["name"]
+}
+
+// dataMediaType classifies a part as "application/json", "text/csv" or neither
+func dataMediaType(mediaType, filename string) string {
+	switch {
+	case mediaType == "application/json" || strings.EqualFold(path.Ext(filename), ".json"):
+		return "application/json"
+	case mediaType == "text/csv" || strings.EqualFold(path.Ext(filename), ".csv"):
+		return "text/csv"
+	}
+	return ""
+}
+
+// lineStripper drops the line breaks of base64 transfer encoding
+type lineStripper struct{ r io.Reader }
+
+func (l *lineStripper) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			out = append(out, b)
+		}
+	}
+	return len(out), err
+}
+
+// imapConn is a minimal IMAP4rev1 client: enough to log in, search, fetch
+// and flag messages
+type imapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+	max    int64
+}
+
+// imapResponse holds the untagged lines of a command's response and the
+// literals embedded in them
+type imapResponse struct {
+	lines    []string
+	literals [][]byte
+}
+
+var imapLiteralPattern = regexp.MustCompile(`\{(\d+)\}$`)
+
+func (w *imapWatcher) dial() (*imapConn, error) {
+	dialer := &net.Dialer{Timeout: w.timeout}
+	var conn net.Conn
+	var err error
+	if w.useTLS {
+		host, _, _ := net.SplitHostPort(w.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = dialer.Dial("tcp", w.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(w.timeout))
+	c := &imapConn{conn: conn, reader: bufio.NewReader(conn), max: w.maxBytes}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP greeting %q", greeting)
+	}
+	return c, nil
+}
+
+func (c *imapConn) close() error { return c.conn.Close() }
+
+func (c *imapConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// command sends a tagged command and reads its response, failing unless
+// the server answers OK
+func (c *imapConn) command(format string, args ...interface{}) (*imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("T%d", c.tag)
+	command := fmt.Sprintf(format, args...)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+
+	resp := &imapResponse{}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if status, ok := strings.CutPrefix(line, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				verb, _, _ := strings.Cut(command, " ")
+				return nil, fmt.Errorf("IMAP %s failed: %s", verb, status)
+			}
+			return resp, nil
+		}
+		// A literal continues the line after its announced number of bytes
+		for m := imapLiteralPattern.FindStringSubmatch(line); m != nil; m = imapLiteralPattern.FindStringSubmatch(line) {
+			size, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil || size > c.max {
+				return nil, fmt.Errorf("IMAP literal of %s bytes exceeds %d bytes", m[1], c.max)
+			}
+			literal := make([]byte, size)
+			if _, err := io.ReadFull(c.reader, literal); err != nil {
+				return nil, err
+			}
+			resp.literals = append(resp.literals, literal)
+			rest, err := c.readLine()
+			if err != nil {
+				return nil, err
+			}
+			line += rest
+		}
+		resp.lines = append(resp.lines, line)
+	}
+}
+
+// imapQuote renders a string as an IMAP quoted string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", "").Replace(s) + `"`
+}
+
+var imapSizePattern = regexp.MustCompile(`RFC822\.SIZE (\d+)`)
+
+// imapMessageSize extracts RFC822.SIZE from FETCH response lines
+func imapMessageSize(lines []string) int64 {
+	for _, line := range lines {
+		if m := imapSizePattern.FindStringSubmatch(line); m != nil {
+			size, _ := strconv.ParseInt(m[1], 10, 64)
+			return size
+		}
+	}
+	return 0
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIMAP serves a fixed set of messages to one IMAP session per connection
+type fakeIMAP struct {
+	listener net.Listener
+	messages map[string]string // UID -> RFC 822 message
+
+	mu     sync.Mutex
+	stored []string // UID STORE arguments
+}
+
+func newFakeIMAP(t *testing.T, messages map[string]string) *fakeIMAP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIMAP{listener: listener, messages: messages}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeIMAP) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "* OK fake IMAP ready\r\n")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		fields := strings.Fields(command)
+		switch {
+		case strings.HasPrefix(command, "LOGIN "):
+			if command != `LOGIN "robot" "p\"w"` {
+				fmt.Fprintf(conn, "%s NO invalid credentials\r\n", tag)
+				continue
+			}
+		case strings.HasPrefix(command, "UID SEARCH"):
+			fmt.Fprintf(conn, "* SEARCH 7 8\r\n")
+		case strings.HasPrefix(command, "UID FETCH") && fields[3] == "(RFC822.SIZE)":
+			fmt.Fprintf(conn, "* 1 FETCH (UID %s RFC822.SIZE %d)\r\n", fields[2], len(f.messages[fields[2]]))
+		case strings.HasPrefix(command, "UID FETCH"):
+			msg := f.messages[fields[2]]
+			fmt.Fprintf(conn, "* 1 FETCH (UID %s BODY[] {%d}\r\n%s)\r\n", fields[2], len(msg), msg)
+		case strings.HasPrefix(command, "UID STORE"):
+			f.mu.Lock()
+			f.stored = append(f.stored, strings.Join(fields[2:], " "))
+			f.mu.Unlock()
+		case command == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK\r\n", tag)
+			return
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+type sentMail struct {
+	from string
+	to   []string
+	msg  []byte
+}
+
+func withSentMail(t *testing.T) *[]sentMail {
+	t.Helper()
+	var sent []sentMail
+	previous := sendMail
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, sentMail{from, to, msg})
+		return nil
+	}
+	t.Cleanup(func() { sendMail = previous })
+	return &sent
+}
+
+func TestIMAPWatcher(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if _, err := saveTemplate("order-confirmation", &templateInput{Text: "Order {{.order}} for {{.email.subject}}", EncodingFormat: "text/plain"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	attachment := base64.StdEncoding.EncodeToString([]byte(`{"order": "A-17"}`))
+	server := newFakeIMAP(t, map[string]string{
+		"7": "From: Ada <ada@example.com>\r\nSubject: =?utf-8?q?Bestellung_M=C3=A4rz?=\r\nMessage-Id: <m1@example.com>\r\n" +
+			"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b1\r\n\r\n" +
+			"--b1\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n" +
+			"--b1\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=order.json\r\n" +
+			"Content-Transfer-Encoding: base64\r\n\r\n" + attachment + "\r\n--b1--\r\n",
+		"8": "From: bob@example.com\r\nSubject: hello\r\n\r\nNo data here.\r\n",
+	})
+	sent := withSentMail(t)
+
+	w, err := newIMAPWatcher("imap://" + server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.username, w.password, w.template = "robot", `p"w`, "order-confirmation"
+	w.maxBytes, w.timeout = 1<<20, 5*time.Second
+	w.smtpAddr, w.from = "smtp.example.com:25", "renderer@example.com"
+
+	answered, err := w.poll(context.Background())
+	if err != nil || answered != 1 {
+		t.Fatalf("poll() = %d, %v", answered, err)
+	}
+	if len(*sent) != 1 || (*sent)[0].to[0] != "ada@example.com" {
+		t.Fatalf("Expected one reply to ada@example.com, got %+v", *sent)
+	}
+	reply, err := mail.ReadMessage(strings.NewReader(string((*sent)[0].msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Header.Get("In-Reply-To") != "<m1@example.com>" || reply.Header.Get("Auto-Submitted") != "auto-replied" {
+		t.Errorf("Unexpected reply headers: %v", reply.Header)
+	}
+	encoded, _ := io.ReadAll(reply.Body)
+	body, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if string(body) != "Order A-17 for Bestellung März" {
+		t.Errorf("Unexpected reply body %q", body)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if strings.Join(server.stored, "|") != `7 +FLAGS (\Seen)|8 +FLAGS (\Seen \Flagged)` {
+		t.Errorf("Unexpected flags %v", server.stored)
+	}
+}
+
+func TestMailParametersCSV(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader("From: a@example.com\r\nSubject: rows\r\nContent-Type: text/csv\r\n\r\nname,qty\r\nbolt,4\r\nnut,9\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters, err := mailParameters(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := parameters["rows"].([]interface{})
+	if len(rows) != 2 || rows[1].(map[string]interface{})["qty"] != "9" {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+	if parameters["email"].(map[string]interface{})["subject"] != "rows" {
+		t.Errorf("Expected the email metadata, got %v", parameters["email"])
+	}
+}
+
+func TestIMAPWatcherAttachments(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	for name, text := range map[string]string{
+		"order-confirmation": "Thanks for order {{.order}}",
+		"order-invoice":      "Invoice {{.order}}",
+		"order-receipt":      "Receipt {{.order}}",
+	} {
+		if _, err := saveTemplate(name, &templateInput{Text: text, EncodingFormat: "text/plain"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := base64.StdEncoding.EncodeToString([]byte(`{"order": "A-17", "includeInvoice": true}`))
+	server := newFakeIMAP(t, map[string]string{
+		"7": "From: ada@example.com\r\nSubject: order\r\nMIME-Version: 1.0\r\nContent-Type: application/json\r\n" +
+			"Content-Transfer-Encoding: base64\r\n\r\n" + data + "\r\n",
+	})
+	sent := withSentMail(t)
+
+	w, err := newIMAPWatcher("imap://" + server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.username, w.password, w.template = "robot", `p"w`, "order-confirmation"
+	w.maxBytes, w.timeout = 1<<20, 5*time.Second
+	w.smtpAddr, w.from = "smtp.example.com:25", "renderer@example.com"
+	w.attachments = []mailAttachment{
+		{Template: "order-invoice", Filename: "invoice.txt", When: ".includeInvoice"},
+		{Template: "order-receipt", Filename: "receipt.txt", When: ".includeReceipt"},
+	}
+
+	if answered, err := w.poll(context.Background()); err != nil || answered != 1 {
+		t.Fatalf("poll() = %d, %v", answered, err)
+	}
+	reply, err := mail.ReadMessage(strings.NewReader(string((*sent)[0].msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(reply.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Expected a multipart reply, got %q", reply.Header.Get("Content-Type"))
+	}
+	var parts []string
+	reader := multipart.NewReader(reply.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, _ := io.ReadAll(part)
+		content, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+		parts = append(parts, part.FileName()+"="+string(content))
+	}
+	if strings.Join(parts, "|") != "=Thanks for order A-17|invoice.txt=Invoice A-17" {
+		t.Errorf("Unexpected parts %q", parts)
+	}
+}
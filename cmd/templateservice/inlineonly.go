@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"templateservice/pkg/render"
+)
+
+// inlineOnly is the hardened mode for deployments that only render inline
+// and stored templates: file, upload, remote and Git template sources and
+// uploaded parameters are refused, and template functions touching the
+// network or host paths and plugin functions are removed
+var inlineOnly bool
+
+// configureInlineOnly enables the hardened mode from TEMPLATE_INLINE_ONLY.
+// Settings for template sources the mode disables are rejected rather than
+// silently ignored.
+func configureInlineOnly() error {
+	inlineOnly = envBool("TEMPLATE_INLINE_ONLY", false)
+	if !inlineOnly {
+		return nil
+	}
+	for _, key := range []string{"TEMPLATE_ROOT", "TEMPLATE_TENANT_ROOTS", "TEMPLATE_REMOTE_HOSTS", "TEMPLATE_GIT_URL"} {
+		if os.Getenv(key) != "" {
+			return fmt.Errorf("%s cannot be used with TEMPLATE_INLINE_ONLY", key)
+		}
+	}
+	logger.Info("Inline-only mode: file, upload, remote and Git template sources, uploaded parameters and plugin functions are disabled")
+	return nil
+}
+
+// checkInlineOnly refuses templates that are not given inline (or stored)
+// and uploaded parameters while the hardened mode is on
+func checkInlineOnly(req renderRequest) error {
+	if !inlineOnly {
+		return nil
+	}
+	if req.Text == "" && req.Identifier != "" {
+		return &render.Error{Message: "only inline templates are accepted by this deployment", Status: http.StatusForbidden}
+	}
+	if req.ParametersFrom != "" {
+		return &render.Error{Message: "uploaded parameters are not accepted by this deployment", Status: http.StatusForbidden}
+	}
+	return nil
+}
+
+// serviceCapabilities lists the capabilities advertised to the registry
+func serviceCapabilities() []string {
+	capabilities := []string{"template-rendering", "go-templates", "state-tracking"}
+	if inlineOnly {
+		capabilities = append(capabilities, "inline-templates-only")
+	}
+	return capabilities
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func withInlineOnly(t *testing.T) {
+	t.Helper()
+	previous, previousFuncs := inlineOnly, templateFuncMap
+	t.Cleanup(func() { inlineOnly, templateFuncMap = previous, previousFuncs })
+	t.Setenv("TEMPLATE_INLINE_ONLY", "true")
+	if err := configureInlineOnly(); err != nil {
+		t.Fatal(err)
+	}
+	configureTemplateFuncs()
+}
+
+func TestInlineOnly(t *testing.T) {
+	withInlineOnly(t)
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if _, err := saveTemplate("greeting", &templateInput{Text: "Hi {{.name}}"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file.tmpl")
+	if err := os.WriteFile(path, []byte("file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := renderTemplate(context.Background(), renderRequest{Text: "{{upper .name}}", Parameters: map[string]interface{}{"name": "ada"}}); err != nil || result.Output != "ADA" {
+		t.Errorf("Inline render = %v, %v", result, err)
+	}
+	if result, err := renderTemplate(context.Background(), renderRequest{TemplateName: "greeting", Parameters: map[string]interface{}{"name": "Ada"}}); err != nil || result.Output != "Hi Ada" {
+		t.Errorf("Stored render = %v, %v", result, err)
+	}
+
+	for _, identifier := range []string{path, uploadRefPrefix + "abc", "https://templates.example.com/a.tmpl", "git:a.tmpl"} {
+		_, err := renderTemplate(context.Background(), renderRequest{Identifier: identifier})
+		if re, ok := err.(*render.Error); !ok || re.Status != http.StatusForbidden {
+			t.Errorf("Expected 403 for %q, got %v", identifier, err)
+		}
+	}
+
+	_, err := renderTemplate(context.Background(), renderRequest{Text: "{{.name}}", ParametersFrom: "abc"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusForbidden {
+		t.Errorf("Expected 403 for uploaded parameters, got %v", err)
+	}
+
+	if _, ok := templateFuncMap["getHostByName"]; ok {
+		t.Error("getHostByName should be removed in inline-only mode")
+	}
+	if _, err := renderTemplate(context.Background(), renderRequest{Text: `{{osBase "/etc/passwd"}}`}); err == nil {
+		t.Error("Expected host path helpers to be unavailable")
+	}
+}
+
+func TestInlineOnlyPluginFuncs(t *testing.T) {
+	withInlineOnly(t)
+	if err := withPluginFuncs(t, "vatRate"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := templateFuncMap["vatRate"]; ok {
+		t.Error("Plugin functions should be removed in inline-only mode")
+	}
+}
+
+func TestInlineOnlyRejectsFileSources(t *testing.T) {
+	previous := inlineOnly
+	t.Cleanup(func() { inlineOnly = previous })
+	t.Setenv("TEMPLATE_INLINE_ONLY", "true")
+	t.Setenv("TEMPLATE_GIT_URL", "https://git.example.com/templates.git")
+	if err := configureInlineOnly(); err == nil {
+		t.Error("Expected TEMPLATE_GIT_URL to be rejected in inline-only mode")
+	}
+}
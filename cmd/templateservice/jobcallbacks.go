@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delivery states of a job callback
+const (
+	callbackPending   = "pending"
+	callbackDelivered = "delivered"
+	callbackFailed    = "failed"
+	callbackSkipped   = "skipped" // Every item's output was suppressed (see suppress.go)
+)
+
+// jobCallback is the delivery state of a job's completion callback
+type jobCallback struct {
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"lastError,omitempty"`
+	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// jobCallbackPayload is POSTed to a job's callback URL when it completes or
+// is dead-lettered
+type jobCallbackPayload struct {
+	Event string `json:"event"` // job.completed or job.dead
+	jobResultResponse
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// jobCallbacks holds the callback settings. Callbacks are disabled unless
+// hosts are allowed.
+var jobCallbacks = struct {
+	hosts    []string // Host names or globs callback URLs may point to
+	secret   []byte   // HMAC-SHA256 key signing every payload
+	attempts int
+	backoff  time.Duration // Delay before the first retry, doubled for each further one
+	client   *http.Client
+}{attempts: 5, backoff: time.Second, client: &http.Client{Timeout: 30 * time.Second}}
+
+// configureJobCallbacks reads the callback settings from the environment
+func configureJobCallbacks() error {
+	jobCallbacks.hosts = envList("TEMPLATE_JOB_CALLBACK_HOSTS")
+	jobCallbacks.secret = []byte(os.Getenv("TEMPLATE_JOB_CALLBACK_SECRET"))
+	jobCallbacks.attempts = envInt("TEMPLATE_JOB_CALLBACK_ATTEMPTS", 5)
+	jobCallbacks.backoff = envDuration("TEMPLATE_JOB_CALLBACK_BACKOFF", time.Second)
+	jobCallbacks.client.Timeout = envDuration("TEMPLATE_JOB_CALLBACK_TIMEOUT", 30*time.Second)
+	if len(jobCallbacks.hosts) == 0 {
+		return nil
+	}
+	if len(jobCallbacks.secret) < 16 {
+		return errors.New("TEMPLATE_JOB_CALLBACK_SECRET of at least 16 bytes is required with TEMPLATE_JOB_CALLBACK_HOSTS")
+	}
+	if jobCallbacks.attempts < 1 {
+		jobCallbacks.attempts = 1
+	}
+	logger.Infof("Job callbacks allowed to %s", strings.Join(jobCallbacks.hosts, ", "))
+	return nil
+}
+
+// validateCallbackURL checks that a callback URL is an http(s) URL on an allowed host
+func validateCallbackURL(raw string) error {
+	if len(jobCallbacks.hosts) == 0 {
+		return errors.New("job callbacks are not enabled")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("invalid callbackUrl %q", raw)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range jobCallbacks.hosts {
+		if ok, err := path.Match(strings.ToLower(pattern), host); err == nil && ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("callback host %q is not allowed", u.Hostname())
+}
+
+// jobSuppressed reports whether every item of a job rendered suppressed
+// output, leaving nothing to deliver
+func jobSuppressed(job renderJob) bool {
+	summary := summarizeJob(job)
+	return len(job.Items) > 0 && summary.Suppressed == len(job.Items)
+}
+
+// signCallback returns the signature header value of a callback payload
+// sent at timestamp: the hex HMAC-SHA256 of "<timestamp>.<body>"
+func signCallback(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// scheduleCallback starts delivering the pending callback of a job that
+// reached a final state. Callers hold m.mu.
+func (m *jobManager) scheduleCallback(job *renderJob) {
+	id := job.ID
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.deliverCallback(id)
+	}()
+}
+
+// deliverCallback POSTs the job's final state to its callback URL, retrying
+// with exponential backoff on network errors, 408, 429 and 5xx responses
+func (m *jobManager) deliverCallback(id string) {
+	job, ok := m.get(id)
+	if !ok || job.CallbackURL == "" {
+		return
+	}
+	payload := jobCallbackPayload{
+		Event:             "job." + string(job.Status),
+		jobResultResponse: jobResultResponse{ID: job.ID, Status: job.Status, Summary: summarizeJob(job), Results: job.Results},
+		Error:             job.Error,
+		CompletedAt:       job.CompletedAt,
+	}
+	if payload.Results == nil {
+		payload.Results = []jobItemResult{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		m.recordCallback(id, callbackFailed, err)
+		return
+	}
+
+	delay := jobCallbacks.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := postCallback(job, body)
+		if err == nil {
+			m.recordCallback(id, callbackDelivered, nil)
+			return
+		}
+		if !retry || attempt >= jobCallbacks.attempts {
+			logger.WithError(err).Error(fmt.Sprintf("Giving up on callback of job %s after %d attempts", id, attempt))
+			m.recordCallback(id, callbackFailed, err)
+			return
+		}
+		m.recordCallback(id, callbackPending, err)
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-m.ctx.Done():
+			// Left pending; recovery resumes the delivery after a restart
+			return
+		}
+	}
+}
+
+// postCallback sends one callback attempt and reports whether a failure is worth retrying
+func postCallback(job renderJob, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-ID", job.ID)
+	req.Header.Set("X-Callback-Timestamp", timestamp)
+	req.Header.Set("X-Callback-Signature", signCallback(jobCallbacks.secret, timestamp, body))
+
+	resp, err := jobCallbacks.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return false, fmt.Errorf("callback returned status %d", resp.StatusCode)
+}
+
+// recordCallback updates and persists the callback state of a job
+func (m *jobManager) recordCallback(id, status string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.Callback == nil {
+		return
+	}
+	// Replaced rather than updated in place: copies handed out by get share the pointer
+	state := &jobCallback{Status: status, Attempts: job.Callback.Attempts + 1}
+	if err != nil {
+		state.LastError = err.Error()
+	}
+	if status == callbackDelivered {
+		now := time.Now().UTC()
+		state.DeliveredAt = &now
+	}
+	job.Callback = state
+	if err := m.persist(job); err != nil {
+		logger.WithError(err).Error("Failed to persist job " + job.ID)
+	}
+	m.notify(id)
+}
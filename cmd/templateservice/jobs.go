@@ -0,0 +1,722 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// jobStatus is the lifecycle state of an asynchronous render job
+type jobStatus string
+
+// Jobs whose attempts are exhausted move to the dead-letter state, from
+// which they can be redriven once the underlying problem is fixed.
+const (
+	jobQueued    jobStatus = "queued"
+	jobRunning   jobStatus = "running"
+	jobCompleted jobStatus = "completed"
+	jobDead      jobStatus = "dead"
+)
+
+// Job item outcomes. Items not attempted because an earlier item failed in a
+// stop-on-error job are skipped.
+const (
+	itemCompleted = "completed"
+	itemFailed    = "failed"
+	itemSkipped   = "skipped"
+)
+
+// renderJob is an asynchronous render of one or more templates.
+// Every state transition is persisted so jobs survive a restart.
+type renderJob struct {
+	ID          string            `json:"id"`
+	Status      jobStatus         `json:"status"`
+	Items       []TemplateRequest `json:"items"`
+	Schedule    jobSchedule       `json:"schedule"`
+	StopOnError bool              `json:"stopOnError,omitempty"`
+	Caller      renderCaller      `json:"caller"` // Submitter, for template access checks and policy
+	Results     []jobItemResult   `json:"results,omitempty"`
+	Progress    jobProgress       `json:"progress"`
+	Attempts    int               `json:"attempts"`
+	Error       string            `json:"error,omitempty"`
+	History     []jobTransition   `json:"history"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	CompletedAt *time.Time        `json:"completedAt,omitempty"`
+	CallbackURL string            `json:"callbackUrl,omitempty"` // Notified when the job finishes (see jobcallbacks.go)
+	Callback    *jobCallback      `json:"callback,omitempty"`
+}
+
+// jobTransition records a single state change of a job
+type jobTransition struct {
+	Status jobStatus `json:"status"`
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// jobItemResult is the outcome of rendering one item of a job
+type jobItemResult struct {
+	Index          int    `json:"index"`
+	Status         string `json:"status"`
+	Output         string `json:"output,omitempty"`
+	EncodingFormat string `json:"encodingFormat,omitempty"`
+	Sha256         string `json:"sha256,omitempty"`
+	ContentUrl     string `json:"contentUrl,omitempty"`
+	TemplateCommit string `json:"templateCommit,omitempty"`
+	Suppressed     bool   `json:"suppressed,omitempty"` // Output matched the item's suppress options
+	Error          string `json:"error,omitempty"`
+
+	ContentEncoding string `json:"contentEncoding,omitempty"` // base64 when the output is binary, e.g. a PDF
+}
+
+// jobManager queues jobs, runs them on a fixed pool of workers and
+// journals their state to disk when a job directory is configured
+type jobManager struct {
+	dir         string
+	maxAttempts int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   map[string]*renderJob
+	queue  []string
+	closed bool
+
+	// watchers are notified of status and progress changes per job ID
+	watchers map[string]map[chan struct{}]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var jobs *jobManager
+
+// configureJobs creates the job manager, recovers persisted jobs and starts the workers.
+// TEMPLATE_JOB_DIR enables persistence; without it jobs are kept in memory only.
+func configureJobs() error {
+	m, err := newJobManager(os.Getenv("TEMPLATE_JOB_DIR"), envInt("TEMPLATE_JOB_MAX_ATTEMPTS", 3))
+	if err != nil {
+		return err
+	}
+
+	requeued, dead, err := m.recover()
+	if err != nil {
+		return err
+	}
+	if requeued > 0 || dead > 0 {
+		logger.Infof("Recovered jobs after restart: %d requeued, %d dead-lettered", requeued, dead)
+	}
+	if m.dir == "" {
+		logger.Info("TEMPLATE_JOB_DIR not set, async jobs will not survive a restart")
+	}
+
+	m.start(envInt("TEMPLATE_JOB_WORKERS", 2))
+	jobs = m
+	return nil
+}
+
+// newJobManager creates a job manager journaling to dir (empty for in-memory)
+func newJobManager(dir string, maxAttempts int) (*jobManager, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &jobManager{
+		dir:         dir,
+		maxAttempts: maxAttempts,
+		jobs:        make(map[string]*renderJob),
+		watchers:    make(map[string]map[chan struct{}]struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	m.cond = sync.NewCond(&m.mu)
+	return m, nil
+}
+
+// recover loads persisted jobs. Queued jobs are requeued; jobs that were
+// running when the service stopped are retried while attempts remain and
+// are otherwise dead-lettered with the interruption as reason.
+func (m *jobManager) recover() (requeued, dead int, err error) {
+	if m.dir == "" {
+		return 0, 0, nil
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []*renderJob
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.dir, entry.Name()))
+		if err != nil {
+			return 0, 0, err
+		}
+		var job renderJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			logger.WithError(err).Error("Skipping unreadable job file " + entry.Name())
+			continue
+		}
+		m.jobs[job.ID] = &job
+
+		switch job.Status {
+		case jobQueued:
+			pending = append(pending, &job)
+		case jobRunning:
+			if job.Attempts < m.maxAttempts {
+				m.transition(&job, jobQueued, fmt.Sprintf("interrupted by service restart during attempt %d, retrying", job.Attempts))
+				pending = append(pending, &job)
+			} else {
+				job.Error = fmt.Sprintf("interrupted by service restart after %d attempts", job.Attempts)
+				m.transition(&job, jobDead, job.Error)
+				dead++
+			}
+		case jobCompleted, jobDead:
+			if job.Callback != nil && job.Callback.Status == callbackPending {
+				m.scheduleCallback(&job)
+			}
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	for _, job := range pending {
+		m.queue = append(m.queue, job.ID)
+	}
+	return len(pending), dead, nil
+}
+
+// start launches the worker pool and the scheduler tick that wakes
+// workers when delayed or windowed jobs become eligible
+func (m *jobManager) start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.mu.Lock()
+				closed := m.closed
+				m.cond.Broadcast()
+				m.mu.Unlock()
+				if closed {
+					return
+				}
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stop cancels running renders and waits for the workers to exit.
+// Interrupted jobs keep their running state and are recovered on next start.
+func (m *jobManager) stop() {
+	m.mu.Lock()
+	m.closed = true
+	m.cond.Broadcast()
+	m.mu.Unlock()
+
+	m.cancel()
+	m.wg.Wait()
+}
+
+// shutdown stops taking jobs off the queue and lets running jobs finish
+// until ctx is done; jobs still running then are interrupted as by stop.
+// Queued jobs stay queued and, with a journal, run after the next start.
+func (m *jobManager) shutdown(ctx context.Context) {
+	m.mu.Lock()
+	m.closed = true
+	m.cond.Broadcast()
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("Drain timeout reached, interrupting running jobs")
+		m.cancel()
+		<-done
+	}
+	m.cancel()
+}
+
+// accepting reports whether new jobs are taken; false once the manager stops
+func (m *jobManager) accepting() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.closed
+}
+
+// submit registers a new job and queues it
+func (m *jobManager) submit(caller renderCaller, items []TemplateRequest, schedule jobSchedule, stopOnError bool) *renderJob {
+	return m.enqueue(newRenderJob(caller, items, schedule, stopOnError))
+}
+
+// newRenderJob creates a job that has not been queued yet
+func newRenderJob(caller renderCaller, items []TemplateRequest, schedule jobSchedule, stopOnError bool) *renderJob {
+	return &renderJob{
+		ID:          uuid.NewString(),
+		Items:       items,
+		Schedule:    schedule,
+		StopOnError: stopOnError,
+		Caller:      caller,
+		Progress:    jobProgress{Total: len(items)},
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// enqueue registers a new job and queues it
+func (m *jobManager) enqueue(job *renderJob) *renderJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs[job.ID] = job
+	m.transition(job, jobQueued, "")
+	m.queue = append(m.queue, job.ID)
+	m.cond.Signal()
+	return job
+}
+
+// get returns a copy of a job
+func (m *jobManager) get(id string) (renderJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return renderJob{}, false
+	}
+	return *job, true
+}
+
+// transition changes a job's status and journals it. Callers hold m.mu.
+func (m *jobManager) transition(job *renderJob, status jobStatus, reason string) {
+	now := time.Now().UTC()
+	job.Status = status
+	job.UpdatedAt = now
+	job.History = append(job.History, jobTransition{Status: status, At: now, Reason: reason})
+	if status == jobCompleted || status == jobDead {
+		job.CompletedAt = &now
+		if job.CallbackURL != "" {
+			job.Callback = &jobCallback{Status: callbackPending}
+			if status == jobCompleted && jobSuppressed(*job) {
+				job.Callback.Status = callbackSkipped
+			}
+		}
+	}
+
+	if err := m.persist(job); err != nil {
+		logger.WithError(err).Error("Failed to persist job " + job.ID)
+	}
+	m.notify(job.ID)
+	if (status == jobCompleted || status == jobDead) && job.Callback != nil && job.Callback.Status == callbackPending {
+		m.scheduleCallback(job)
+	}
+}
+
+// persist writes the job state to the journal directory. Callers hold m.mu.
+func (m *jobManager) persist(job *renderJob) error {
+	if m.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.dir, job.ID+".json"), data)
+}
+
+// next blocks until a queued job is eligible to run or the manager is stopped.
+// Among eligible jobs the highest priority wins, then the oldest.
+func (m *jobManager) next() (*renderJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		if m.closed {
+			return nil, false
+		}
+		if index := m.pickEligible(time.Now()); index >= 0 {
+			job := m.jobs[m.queue[index]]
+			m.queue = append(m.queue[:index], m.queue[index+1:]...)
+			job.Attempts++
+			m.transition(job, jobRunning, fmt.Sprintf("attempt %d", job.Attempts))
+			return job, true
+		}
+		m.cond.Wait()
+	}
+}
+
+// pickEligible returns the queue index of the next job to run, or -1.
+// Jobs whose execution window has passed are dead-lettered on the way.
+// Callers hold m.mu.
+func (m *jobManager) pickEligible(now time.Time) int {
+	best := -1
+	for i := 0; i < len(m.queue); i++ {
+		job := m.jobs[m.queue[i]]
+		if job.Schedule.expired(now) {
+			job.Error = "execution window expired before the job could run"
+			m.transition(job, jobDead, job.Error)
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			i--
+			continue
+		}
+		if !job.Schedule.eligible(now) {
+			continue
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		current := m.jobs[m.queue[best]]
+		if job.Schedule.Priority > current.Schedule.Priority ||
+			(job.Schedule.Priority == current.Schedule.Priority && job.CreatedAt.Before(current.CreatedAt)) {
+			best = i
+		}
+	}
+	return best
+}
+
+// worker executes queued jobs until the manager is stopped
+func (m *jobManager) worker() {
+	defer m.wg.Done()
+	for {
+		job, ok := m.next()
+		if !ok {
+			return
+		}
+		m.run(job)
+	}
+}
+
+// run renders the items of a job and records the outcome. Items completed
+// by an earlier attempt are kept, so retries only re-run failed and skipped
+// items. Failed jobs are requeued until they exhaust their attempts and are
+// then dead-lettered.
+func (m *jobManager) run(job *renderJob) {
+	started := time.Now().UTC()
+	m.mu.Lock()
+	items := job.Items
+	stopOnError := job.StopOnError
+	ctx := withRenderCaller(m.ctx, job.Caller)
+	results := make([]jobItemResult, len(items))
+	job.Progress = jobProgress{Total: len(items), StartedAt: &started}
+	for _, previous := range job.Results {
+		if previous.Status == itemCompleted && previous.Index < len(results) {
+			results[previous.Index] = previous
+			job.Progress.Done++
+		}
+	}
+	m.notify(job.ID)
+	m.mu.Unlock()
+
+	failed := 0
+	for i, item := range items {
+		if results[i].Status == itemCompleted {
+			continue
+		}
+		if stopOnError && failed > 0 {
+			results[i] = jobItemResult{Index: i, Status: itemSkipped, Error: "skipped after an earlier item failed"}
+			m.mu.Lock()
+			job.Progress.Skipped++
+			m.notify(job.ID)
+			m.mu.Unlock()
+			continue
+		}
+
+		results[i] = executeJobItem(ctx, i, item)
+		if m.ctx.Err() != nil {
+			// Shutting down: leave the job running so recovery retries it
+			return
+		}
+
+		m.mu.Lock()
+		if results[i].Status != itemCompleted {
+			failed++
+			job.Progress.Failed++
+		} else {
+			job.Progress.Done++
+		}
+		m.notify(job.ID)
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Results = results
+	if failed > 0 {
+		job.Error = fmt.Sprintf("%d of %d items failed", failed, len(items))
+		if job.Attempts < m.maxAttempts {
+			m.transition(job, jobQueued, fmt.Sprintf("attempt %d failed: %s, retrying", job.Attempts, job.Error))
+			m.queue = append(m.queue, job.ID)
+			m.cond.Signal()
+			return
+		}
+		m.transition(job, jobDead, fmt.Sprintf("giving up after %d attempts: %s", job.Attempts, job.Error))
+		return
+	}
+	job.Error = ""
+	m.transition(job, jobCompleted, "")
+}
+
+// executeJobItem renders a single job item
+func executeJobItem(ctx context.Context, index int, item TemplateRequest) jobItemResult {
+	rendered, err := renderTemplate(ctx, renderRequestFrom(item))
+	if err != nil {
+		return jobItemResult{Index: index, Status: itemFailed, Error: err.Error()}
+	}
+	output, contentEncoding := jsonOutput(rendered.EncodingFormat, rendered.Output)
+	return jobItemResult{
+		Index:           index,
+		Status:          itemCompleted,
+		Output:          output,
+		EncodingFormat:  rendered.EncodingFormat,
+		ContentEncoding: contentEncoding,
+		Sha256:          rendered.SHA256,
+		ContentUrl:      rendered.ContentURL,
+		TemplateCommit:  rendered.TemplateCommit,
+		Suppressed:      rendered.Suppressed,
+	}
+}
+
+// jobSubmission is the body of POST /v1/api/jobs: either a single
+// TemplateRequest, a list of them under items, or a TemplateRequest with
+// rows to render it once per row (as /render/matrix does), plus scheduling
+// options. StopOnError skips the remaining items once one fails instead of
+// rendering every item.
+type jobSubmission struct {
+	TemplateRequest
+	Items       []TemplateRequest        `json:"items,omitempty"`
+	Rows        []map[string]interface{} `json:"rows,omitempty"`
+	StopOnError bool                     `json:"stopOnError,omitempty"`
+	CallbackURL string                   `json:"callbackUrl,omitempty"`
+	jobSchedule
+}
+
+// matrixJobItems expands a template and its rows into job items, merging
+// each row over the shared parameters
+func matrixJobItems(base TemplateRequest, rows []map[string]interface{}) []TemplateRequest {
+	shared := base.TemplateParameters
+	if shared == nil {
+		shared = base.Parameters
+	}
+	base.Parameters = nil
+	items := make([]TemplateRequest, len(rows))
+	for i, row := range rows {
+		parameters := make(map[string]interface{}, len(shared)+len(row))
+		for key, value := range shared {
+			parameters[key] = value
+		}
+		for key, value := range row {
+			parameters[key] = value
+		}
+		items[i] = base
+		items[i].TemplateParameters = parameters
+	}
+	return items
+}
+
+// jobStatusResponse is the status view of a job (without rendered output)
+type jobStatusResponse struct {
+	ID          string          `json:"id"`
+	Status      jobStatus       `json:"status"`
+	ItemCount   int             `json:"itemCount"`
+	StopOnError bool            `json:"stopOnError,omitempty"`
+	Summary     jobSummary      `json:"summary"`
+	Items       []jobItemStatus `json:"items,omitempty"`
+	Progress    jobProgressView `json:"progress"`
+	Schedule    jobSchedule     `json:"schedule"`
+	Attempts    int             `json:"attempts"`
+	Error       string          `json:"error,omitempty"`
+	History     []jobTransition `json:"history"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+	CallbackURL string          `json:"callbackUrl,omitempty"`
+	Callback    *jobCallback    `json:"callback,omitempty"`
+}
+
+func newJobStatusResponse(job renderJob) jobStatusResponse {
+	return jobStatusResponse{
+		ID:          job.ID,
+		Status:      job.Status,
+		ItemCount:   len(job.Items),
+		StopOnError: job.StopOnError,
+		Summary:     summarizeJob(job),
+		Items:       jobItemStatuses(job),
+		Progress:    job.Progress.view(time.Now()),
+		Schedule:    job.Schedule,
+		Attempts:    job.Attempts,
+		Error:       job.Error,
+		History:     job.History,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+		CompletedAt: job.CompletedAt,
+		CallbackURL: job.CallbackURL,
+		Callback:    job.Callback,
+	}
+}
+
+// handleCreateJob handles POST /v1/api/jobs
+func handleCreateJob(c echo.Context) error {
+	var req jobSubmission
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+
+	items := req.Items
+	switch {
+	case len(req.Rows) > 0 && len(items) > 0:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "items and rows cannot be combined"})
+	case len(req.Rows) > maxMatrixRows:
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("more than %d rows", maxMatrixRows)})
+	case len(req.Rows) > 0:
+		items = matrixJobItems(req.TemplateRequest, req.Rows)
+	case len(items) == 0:
+		items = []TemplateRequest{req.TemplateRequest}
+	}
+	for i, item := range items {
+		if err := validateTemplateRequest(item); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("item %d: %v", i, err)})
+		}
+	}
+
+	if err := req.jobSchedule.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if !jobs.accepting() {
+		c.Response().Header().Set("Retry-After", "30")
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": errJobsStopped.Error()})
+	}
+	job := newRenderJob(renderCallerFrom(c.Request().Context()), items, req.jobSchedule, req.StopOnError)
+	job.CallbackURL = req.CallbackURL
+	jobs.enqueue(job)
+	snapshot, _ := jobs.get(job.ID)
+	return c.JSON(http.StatusAccepted, newJobStatusResponse(snapshot))
+}
+
+// jobVisibleTo reports whether caller may see a job. Jobs submitted with
+// credentials are only shown to their submitter.
+func jobVisibleTo(job renderJob, caller renderCaller) bool {
+	return job.Caller.Principal == "" || job.Caller.Principal == caller.Principal
+}
+
+// handleGetJob handles GET /v1/api/jobs/:id. Only the submitter may see a
+// job submitted with credentials.
+func handleGetJob(c echo.Context) error {
+	job, ok := jobs.get(c.Param("id"))
+	if !ok || !jobVisibleTo(job, renderCallerFrom(c.Request().Context())) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+	}
+	return c.JSON(http.StatusOK, newJobStatusResponse(job))
+}
+
+// jobResultResponse is the body of GET /v1/api/jobs/:id/result
+type jobResultResponse struct {
+	ID      string          `json:"id"`
+	Status  jobStatus       `json:"status"`
+	Summary jobSummary      `json:"summary"`
+	Results []jobItemResult `json:"results"`
+}
+
+// handleGetJobResult handles GET /v1/api/jobs/:id/result. It returns the
+// rendered items of a finished job, or with ?item=N the output of that item
+// as the response body like /render/raw. Only the submitter may read the
+// output of a job submitted with credentials.
+func handleGetJobResult(c echo.Context) error {
+	job, ok := jobs.get(c.Param("id"))
+	if !ok || !jobVisibleTo(job, renderCallerFrom(c.Request().Context())) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+	}
+	if job.Status != jobCompleted && job.Status != jobDead {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "job has not finished", "status": string(job.Status)})
+	}
+
+	if c.QueryParam("item") == "" {
+		results := job.Results
+		if results == nil {
+			results = []jobItemResult{}
+		}
+		return c.JSON(http.StatusOK, jobResultResponse{ID: job.ID, Status: job.Status, Summary: summarizeJob(job), Results: results})
+	}
+
+	index, err := strconv.Atoi(c.QueryParam("item"))
+	if err != nil || index < 0 || index >= len(job.Items) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid item"})
+	}
+	for _, result := range job.Results {
+		if result.Index != index {
+			continue
+		}
+		if result.Status != itemCompleted {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": result.Error, "status": result.Status})
+		}
+		header := c.Response().Header()
+		if result.Suppressed {
+			header.Set(suppressedHeader, "true")
+			return c.NoContent(http.StatusNoContent)
+		}
+		header.Set("X-Content-SHA256", result.Sha256)
+		contentType := setRawHeaders(header, &renderResult{
+			EncodingFormat: result.EncodingFormat,
+			ContentURL:     result.ContentUrl,
+			TemplateCommit: result.TemplateCommit,
+		})
+		output := []byte(result.Output)
+		if result.ContentEncoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(result.Output)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "invalid stored output"})
+			}
+			output = decoded
+		}
+		return c.Blob(http.StatusOK, contentType, output)
+	}
+	return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "item was not rendered", "status": itemPending})
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// waitForJob polls until the job reaches a final state
+func waitForJob(t *testing.T, m *jobManager, id string) renderJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := m.get(id)
+		if ok && (job.Status == jobCompleted || job.Status == jobDead) {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish in time", id)
+	return renderJob{}
+}
+
+func TestJobManager_RunsJob(t *testing.T) {
+	m, err := newJobManager(t.TempDir(), 3)
+	if err != nil {
+		t.Fatalf("newJobManager() returned error: %v", err)
+	}
+	m.start(1)
+	defer m.stop()
+
+	job := m.submit(renderCaller{}, []TemplateRequest{{
+		Text:               "Hello {{.Name}}",
+		TemplateParameters: map[string]interface{}{"Name": "Alice"},
+	}}, jobSchedule{}, false)
+
+	done := waitForJob(t, m, job.ID)
+	if done.Status != jobCompleted {
+		t.Fatalf("Expected job to complete, got %s (%s)", done.Status, done.Error)
+	}
+	if len(done.Results) != 1 || done.Results[0].Output != "Hello Alice" {
+		t.Errorf("Unexpected job results: %+v", done.Results)
+	}
+
+	if _, err := os.Stat(filepath.Join(m.dir, job.ID+".json")); err != nil {
+		t.Errorf("Job state should be persisted: %v", err)
+	}
+}
+
+func TestJobManager_RecoverInFlightJobs(t *testing.T) {
+	dir := t.TempDir()
+
+	// Simulate a crash: two jobs persisted in running state
+	crashed, _ := newJobManager(dir, 2)
+	retry := crashed.submit(renderCaller{}, []TemplateRequest{{Text: "retried"}}, jobSchedule{}, false)
+	exhausted := crashed.submit(renderCaller{}, []TemplateRequest{{Text: "exhausted"}}, jobSchedule{}, false)
+	crashed.mu.Lock()
+	for _, id := range []string{retry.ID, exhausted.ID} {
+		job := crashed.jobs[id]
+		job.Attempts = 1
+		if id == exhausted.ID {
+			job.Attempts = 2
+		}
+		crashed.transition(job, jobRunning, "")
+	}
+	crashed.mu.Unlock()
+
+	m, err := newJobManager(dir, 2)
+	if err != nil {
+		t.Fatalf("newJobManager() returned error: %v", err)
+	}
+	requeued, failed, err := m.recover()
+	if err != nil {
+		t.Fatalf("recover() returned error: %v", err)
+	}
+	if requeued != 1 || failed != 1 {
+		t.Errorf("Expected 1 requeued and 1 dead-lettered job, got %d and %d", requeued, failed)
+	}
+
+	job, _ := m.get(exhausted.ID)
+	if job.Status != jobDead || job.Error == "" {
+		t.Errorf("Exhausted job should be dead-lettered with a reason, got %s %q", job.Status, job.Error)
+	}
+
+	m.start(1)
+	defer m.stop()
+
+	done := waitForJob(t, m, retry.ID)
+	if done.Status != jobCompleted || done.Results[0].Output != "retried" {
+		t.Errorf("Recovered job should complete, got %s (%s)", done.Status, done.Error)
+	}
+}
+
+func TestJobManager_DeadLetterAndRedrive(t *testing.T) {
+	dir := t.TempDir()
+	m, err := newJobManager("", 2)
+	if err != nil {
+		t.Fatalf("newJobManager() returned error: %v", err)
+	}
+	m.start(1)
+	defer m.stop()
+
+	job := m.submit(renderCaller{}, []TemplateRequest{{Identifier: filepath.Join(dir, "missing.tmpl")}}, jobSchedule{}, false)
+
+	dead := waitForJob(t, m, job.ID)
+	if dead.Status != jobDead || dead.Attempts != 2 {
+		t.Fatalf("Expected job dead after 2 attempts, got %s after %d", dead.Status, dead.Attempts)
+	}
+	if list := m.deadJobs(); len(list) != 1 || list[0].ID != job.ID {
+		t.Errorf("Expected job in dead-letter queue, got %+v", list)
+	}
+
+	// Fix the underlying problem and redrive
+	if err := os.WriteFile(filepath.Join(dir, "missing.tmpl"), []byte("fixed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.redrive(job.ID); err != nil {
+		t.Fatalf("redrive() returned error: %v", err)
+	}
+
+	done := waitForJob(t, m, job.ID)
+	if done.Status != jobCompleted || done.Results[0].Output != "fixed" {
+		t.Errorf("Redriven job should complete, got %s (%s)", done.Status, done.Error)
+	}
+	if _, err := m.redrive(job.ID); err != errJobNotDead {
+		t.Errorf("Expected errJobNotDead for completed job, got %v", err)
+	}
+}
+
+func TestJobProgress_View(t *testing.T) {
+	started := time.Now().Add(-10 * time.Second)
+	view := jobProgress{Total: 4, Done: 1, Failed: 1, StartedAt: &started}.view(started.Add(10 * time.Second))
+
+	if view.Percent != 50 {
+		t.Errorf("Expected 50%%, got %v", view.Percent)
+	}
+	if view.ETASeconds == nil || *view.ETASeconds != 10 {
+		t.Errorf("Expected ETA of 10s, got %v", view.ETASeconds)
+	}
+
+	finished := jobProgress{Total: 2, Done: 2, StartedAt: &started}.view(time.Now())
+	if finished.Percent != 100 || finished.ETA != nil {
+		t.Errorf("Finished job should have no ETA: %+v", finished)
+	}
+}
+
+func TestJobManager_NotifiesProgress(t *testing.T) {
+	m, _ := newJobManager("", 1)
+	job := m.submit(renderCaller{}, []TemplateRequest{{Text: "a"}, {Text: "b"}}, jobSchedule{}, false)
+
+	changes, unsubscribe := m.subscribe(job.ID)
+	defer unsubscribe()
+
+	m.start(1)
+	defer m.stop()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case <-changes:
+		case <-deadline:
+			t.Fatal("Job did not complete in time")
+		}
+		snapshot, _ := m.get(job.ID)
+		if snapshot.Status == jobCompleted {
+			if snapshot.Progress.Done != 2 || snapshot.Progress.Total != 2 {
+				t.Errorf("Unexpected final progress: %+v", snapshot.Progress)
+			}
+			return
+		}
+	}
+}
+
+func TestJobResult(t *testing.T) {
+	m, err := newJobManager("", 1)
+	if err != nil {
+		t.Fatalf("newJobManager() returned error: %v", err)
+	}
+	previous := jobs
+	jobs = m
+	t.Cleanup(func() { jobs = previous })
+
+	e := echo.New()
+	e.POST("/v1/api/jobs", handleCreateJob)
+	e.GET("/v1/api/jobs/:id/result", handleGetJobResult)
+	e.GET("/v1/api/jobs/:id/events", handleJobEvents)
+	e.GET("/v1/api/jobs/:id", handleGetJob)
+	call := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call(http.MethodPost, "/v1/api/jobs", `{"template": "x", "rows": [{}], "items": [{"template": "y"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 combining items and rows, got %d", rec.Code)
+	}
+
+	rec := call(http.MethodPost, "/v1/api/jobs", `{"template": "{{.Greeting}} {{.Name}}", "parameters": {"Greeting": "Hi"}, "rows": [{"Name": "Ada"}, {"Name": "Alan"}]}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Create job = %d %s", rec.Code, rec.Body)
+	}
+	var created jobStatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.ItemCount != 2 {
+		t.Fatalf("Expected a job of 2 items, got %s", rec.Body)
+	}
+	if rec := call(http.MethodGet, "/v1/api/jobs/"+created.ID+"/result", ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 before the job ran, got %d", rec.Code)
+	}
+
+	m.start(1)
+	defer m.stop()
+	waitForJob(t, m, created.ID)
+
+	rec = call(http.MethodGet, "/v1/api/jobs/"+created.ID+"/result", "")
+	var result jobResultResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Get result = %d %s", rec.Code, rec.Body)
+	}
+	if result.Status != jobCompleted || len(result.Results) != 2 || result.Results[1].Output != "Hi Alan" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	rec = call(http.MethodGet, "/v1/api/jobs/"+created.ID+"/result?item=0", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "Hi Ada" || rec.Header().Get("X-Content-SHA256") == "" {
+		t.Errorf("Get item = %d %q", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	if rec := call(http.MethodGet, "/v1/api/jobs/"+created.ID+"/result?item=2", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an item out of range, got %d", rec.Code)
+	}
+
+	// Output of a job submitted with credentials is only shown to its submitter
+	owned := m.submit(renderCaller{Principal: "tsk_owner"}, []TemplateRequest{{Text: "secret"}}, jobSchedule{}, false)
+	waitForJob(t, m, owned.ID)
+	if rec := call(http.MethodGet, "/v1/api/jobs/"+owned.ID+"/result", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another caller's job, got %d", rec.Code)
+	}
+	if rec := call(http.MethodGet, "/v1/api/jobs/"+owned.ID+"/events", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the events of another caller's job, got %d", rec.Code)
+	}
+	if rec := call(http.MethodGet, "/v1/api/jobs/"+owned.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the status of another caller's job, got %d", rec.Code)
+	}
+	if rec := call(http.MethodGet, "/v1/api/jobs/"+created.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for the status of an anonymous job, got %d", rec.Code)
+	}
+}
+
+func TestJobManager_ShutdownDrainsRunningJobs(t *testing.T) {
+	items := make([]TemplateRequest, 500)
+	for i := range items {
+		items[i] = TemplateRequest{Text: "{{range .n}}{{.}}{{end}}", Parameters: map[string]interface{}{"n": []int{1, 2, 3}}}
+	}
+	waitUntilRunning := func(m *jobManager, id string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if job, _ := m.get(id); job.Status != jobQueued {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("Job %s did not start in time", id)
+	}
+
+	m, _ := newJobManager("", 1)
+	m.start(1)
+	job := m.submit(renderCaller{}, items, jobSchedule{}, false)
+	waitUntilRunning(m, job.ID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m.shutdown(ctx)
+	if drained, _ := m.get(job.ID); drained.Status != jobCompleted || drained.Progress.Done != len(items) {
+		t.Errorf("Expected the running job to finish during the drain, got %s with %d done", drained.Status, drained.Progress.Done)
+	}
+	if m.accepting() {
+		t.Error("Expected no new jobs to be accepted after shutdown")
+	}
+
+	// Jobs still running when the drain times out are interrupted and left
+	// for recovery
+	m, _ = newJobManager("", 1)
+	m.start(1)
+	job = m.submit(renderCaller{}, append(items, items...), jobSchedule{}, false)
+	waitUntilRunning(m, job.ID)
+	expired, cancelExpired := context.WithCancel(context.Background())
+	cancelExpired()
+	m.shutdown(expired)
+	if interrupted, _ := m.get(job.ID); interrupted.Status != jobRunning {
+		t.Errorf("Expected the job to be interrupted while running, got %s", interrupted.Status)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// jwtKeyRefreshInterval bounds how often an unknown key ID triggers a JWKS
+// fetch, so forged tokens cannot flood the identity provider
+const jwtKeyRefreshInterval = time.Minute
+
+// jwtAlgorithms are the accepted signature algorithms. Tokens naming any
+// other, "none" and HMAC included, are rejected before their key is looked up.
+var jwtAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384}
+
+// jwtVerifier authenticates bearer tokens issued by an identity provider,
+// checking their signature against the provider's JWKS and mapping their
+// group claim to role grants like single sign-on (see oidc.go)
+type jwtVerifier struct {
+	issuer      string
+	audience    string
+	jwksURL     string
+	groupsClaim string
+	tenantClaim string // Claim naming the caller's tenant; none when empty
+	mapping     []roleGrant
+	leeway      time.Duration
+	keysTTL     time.Duration
+	client      *http.Client
+	now         func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey // By key ID
+	fetchedAt time.Time
+}
+
+// jwtAuth is nil unless TEMPLATE_JWT_ISSUER is set
+var jwtAuth *jwtVerifier
+
+// configureJWTAuth enables bearer token authentication for the issuer named
+// by TEMPLATE_JWT_ISSUER. Its JWKS comes from TEMPLATE_JWT_JWKS_URL or the
+// issuer's discovery document, and TEMPLATE_JWT_AUDIENCE must appear in the
+// tokens' aud claim.
+func configureJWTAuth() error {
+	jwtAuth = nil
+	issuer := strings.TrimSuffix(os.Getenv("TEMPLATE_JWT_ISSUER"), "/")
+	if issuer == "" {
+		return nil
+	}
+	mapping, err := parseRoleMapping("TEMPLATE_JWT_ROLE_MAPPING", envList("TEMPLATE_JWT_ROLE_MAPPING"))
+	if err != nil {
+		return err
+	}
+	v := newJWTVerifier(issuer, os.Getenv("TEMPLATE_JWT_AUDIENCE"), os.Getenv("TEMPLATE_JWT_JWKS_URL"), mapping)
+	if v.audience == "" {
+		return errors.New("TEMPLATE_JWT_AUDIENCE is required with TEMPLATE_JWT_ISSUER")
+	}
+	if claim := os.Getenv("TEMPLATE_JWT_GROUPS_CLAIM"); claim != "" {
+		v.groupsClaim = claim
+	}
+	v.tenantClaim = os.Getenv("TEMPLATE_JWT_TENANT_CLAIM")
+	v.keysTTL = envDuration("TEMPLATE_JWT_JWKS_TTL", v.keysTTL)
+	if v.jwksURL == "" {
+		if v.jwksURL, err = v.discover(); err != nil {
+			return err
+		}
+	}
+	if err := v.refreshKeys(); err != nil {
+		return err
+	}
+	jwtAuth = v
+	logger.Infof("JWT bearer authentication enabled for %s (%d group mappings)", issuer, len(mapping))
+	return nil
+}
+
+func newJWTVerifier(issuer, audience, jwksURL string, mapping []roleGrant) *jwtVerifier {
+	return &jwtVerifier{
+		issuer:      issuer,
+		audience:    audience,
+		jwksURL:     jwksURL,
+		groupsClaim: "groups",
+		mapping:     mapping,
+		leeway:      30 * time.Second,
+		keysTTL:     time.Hour,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		now:         time.Now,
+		keys:        make(map[string]crypto.PublicKey),
+	}
+}
+
+// discover reads the JWKS location from the issuer's discovery document
+func (v *jwtVerifier) discover() (string, error) {
+	resp, err := v.client.Get(v.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", fmt.Errorf("JWT issuer discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("JWT issuer discovery returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return "", fmt.Errorf("JWT issuer discovery: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != v.issuer || doc.JWKSURI == "" {
+		return "", fmt.Errorf("discovery document of %s has no jwks_uri or names another issuer", v.issuer)
+	}
+	return doc.JWKSURI, nil
+}
+
+// refreshKeys replaces the cached keys with the issuer's current JWKS
+func (v *jwtVerifier) refreshKeys() error {
+	resp, err := v.client.Get(v.jwksURL)
+	if err != nil {
+		return fmt.Errorf("JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS returned status %d", resp.StatusCode)
+	}
+	var set jose.JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return fmt.Errorf("JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		// Keys for encryption and symmetric keys never verify tokens
+		if (jwk.Use != "" && jwk.Use != "sig") || !jwk.IsPublic() {
+			continue
+		}
+		keys[jwk.KeyID] = jwk.Key
+	}
+	v.mu.Lock()
+	v.keys, v.fetchedAt = keys, v.now()
+	v.mu.Unlock()
+	return nil
+}
+
+// key returns the signing key with ID kid, refetching the JWKS when it has
+// expired or, at most once per jwtKeyRefreshInterval, when kid is unknown
+// (the issuer rotated its keys)
+func (v *jwtVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	age := v.now().Sub(v.fetchedAt)
+	v.mu.Unlock()
+	if ok && age < v.keysTTL {
+		return key, nil
+	}
+	if ok || age >= jwtKeyRefreshInterval {
+		if err := v.refreshKeys(); err != nil {
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		v.mu.Lock()
+		key, ok = v.keys[kid]
+		v.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// verify checks a token's signature, issuer, audience and validity period
+// and returns its claims
+func (v *jwtVerifier) verify(token string) (idTokenClaims, error) {
+	parsed, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+	key, err := v.key(parsed.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+	var registered jwt.Claims
+	var claims idTokenClaims
+	if err := parsed.Claims(key, &registered, &claims); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(registered.Issuer, "/") != v.issuer {
+		return nil, fmt.Errorf("token issued by %q", registered.Issuer)
+	}
+	if registered.Expiry == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	expected := jwt.Expected{AnyAudience: jwt.Audience{v.audience}, Time: v.now()}
+	if err := registered.ValidateWithLeeway(expected, v.leeway); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// grants maps the token's groups to role grants
+func (v *jwtVerifier) grants(claims idTokenClaims) []roleGrant {
+	groups := claimStrings(claims[v.groupsClaim])
+	var grants []roleGrant
+	for _, grant := range v.mapping {
+		if containsString(groups, grant.Group) {
+			grants = append(grants, grant)
+		}
+	}
+	return grants
+}
+
+// isJWT reports whether a bearer credential has the shape of a JWT rather
+// than an API key
+func isJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2 && strings.HasPrefix(credential, "eyJ")
+}
+
+// bearerAuthenticated continues the chain for a request carrying a valid
+// token, as the caller "jwt:" + email or subject
+func bearerAuthenticated(c echo.Context, next echo.HandlerFunc, token string) error {
+	claims, err := jwtAuth.verify(token)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Rejected bearer token from %s: %v", c.RealIP(), err))
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid bearer token"})
+	}
+	principal, _ := claims["email"].(string)
+	if principal == "" {
+		principal, _ = claims["sub"].(string)
+	}
+	grants := jwtAuth.grants(claims)
+	if len(grants) == 0 {
+		logger.Info(fmt.Sprintf("Refused bearer token of %s: no group is mapped to a role", principal))
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "none of the token's groups grants access to this service"})
+	}
+	c.Set(roleGrantsContextKey, grants)
+	if jwtAuth.tenantClaim != "" {
+		if tenant, _ := claims[jwtAuth.tenantClaim].(string); tenant != "" {
+			c.Set(tenantContextKey, tenant)
+		}
+	}
+	return authenticated(c, next, "jwt:"+principal)
+}
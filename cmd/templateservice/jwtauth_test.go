@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fakeJWKS publishes a discovery document and the public keys of an issuer
+func fakeJWKS(t *testing.T, keys map[string]crypto.PublicKey) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/jwks"})
+		case "/jwks":
+			var set []map[string]string
+			encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+			for kid, key := range keys {
+				switch k := key.(type) {
+				case *rsa.PublicKey:
+					set = append(set, map[string]string{"kty": "RSA", "kid": kid, "n": encode(k.N), "e": encode(big.NewInt(int64(k.E)))})
+				case *ecdsa.PublicKey:
+					set = append(set, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(k.X), "y": encode(k.Y)})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": set})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// signJWT returns a compact RS256 or ES256 token
+func signJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// unsignedJWT returns a token naming alg without a valid signature
+func unsignedJWT(alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+// hmacJWT returns an HS256 token keyed with the issuer's public RSA key,
+// which verifiers trusting the token's alg header would accept
+func hmacJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := strings.TrimSuffix(unsignedJWT("HS256", kid, claims), ".")
+	mac := hmac.New(sha256.New, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTBearerAuthentication(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeJWKS(t, map[string]crypto.PublicKey{"rsa-1": &rsaKey.PublicKey, "ec-1": &ecKey.PublicKey})
+
+	t.Setenv("TEMPLATE_JWT_ISSUER", server.URL)
+	t.Setenv("TEMPLATE_JWT_AUDIENCE", "templates")
+	t.Setenv("TEMPLATE_JWT_ROLE_MAPPING", "marketing=editor:marketing-*")
+	t.Setenv("TEMPLATE_JWT_TENANT_CLAIM", "tenant")
+	previousKeys, previousSigning := apiKeys, requestSigning
+	t.Cleanup(func() { jwtAuth, apiKeys, requestSigning = nil, previousKeys, previousSigning })
+	apiKeys, requestSigning = nil, nil
+	if err := configureJWTAuth(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.PUT("/templates/:name", func(c echo.Context) error {
+		return c.String(http.StatusOK, renderCallerFrom(c.Request().Context()).Principal+" "+renderCallerFrom(c.Request().Context()).Tenant)
+	}, apiKeyAuthMiddleware, requireRole(roleEditor))
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": server.URL, "aud": []string{"templates"}, "sub": "u-17", "email": "ada@example.com",
+			"groups": []string{"marketing"}, "tenant": "acme", "exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+	tests := []struct {
+		name     string
+		token    string
+		target   string
+		expected int
+	}{
+		{"rsa", signJWT(t, rsaKey, "rsa-1", claims(nil)), "/templates/marketing-offer", http.StatusOK},
+		{"ec", signJWT(t, ecKey, "ec-1", claims(nil)), "/templates/marketing-offer", http.StatusOK},
+		{"outside namespace", signJWT(t, rsaKey, "rsa-1", claims(nil)), "/templates/finance-report", http.StatusForbidden},
+		{"no mapped group", signJWT(t, rsaKey, "rsa-1", claims(map[string]interface{}{"groups": []string{"staff"}})), "/templates/marketing-offer", http.StatusForbidden},
+		{"expired", signJWT(t, rsaKey, "rsa-1", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"other audience", signJWT(t, rsaKey, "rsa-1", claims(map[string]interface{}{"aud": "billing"})), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"other issuer", signJWT(t, rsaKey, "rsa-1", claims(map[string]interface{}{"iss": "https://evil.example.com"})), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"forged", signJWT(t, otherKey, "rsa-1", claims(nil)), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"unknown key", signJWT(t, otherKey, "rsa-2", claims(nil)), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"unsigned", unsignedJWT("none", "rsa-1", claims(nil)), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"hmac with public key", hmacJWT(t, rsaKey, "rsa-1", claims(nil)), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"no expiry", signJWT(t, rsaKey, "rsa-1", claims(map[string]interface{}{"exp": nil})), "/templates/marketing-offer", http.StatusUnauthorized},
+		{"missing", "", "/templates/marketing-offer", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Fatalf("Expected %d, got %d: %s", tt.expected, rec.Code, rec.Body)
+			}
+			if rec.Code == http.StatusOK && rec.Body.String() != "jwt:ada@example.com acme" {
+				t.Errorf("Expected the token's principal and tenant, got %q", rec.Body)
+			}
+		})
+	}
+}
+
+func TestConfigureJWTAuthRequiresAudience(t *testing.T) {
+	t.Setenv("TEMPLATE_JWT_ISSUER", "https://idp.example.com")
+	t.Cleanup(func() { jwtAuth = nil })
+	if err := configureJWTAuth(); err == nil {
+		t.Error("configureJWTAuth() should require TEMPLATE_JWT_AUDIENCE")
+	}
+}
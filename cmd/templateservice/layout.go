@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"templateservice/pkg/render"
+)
+
+// resolveLayout loads the stored or built-in layout a request renders into.
+// The layout becomes the executed template; the content template's body
+// fills its "content" block and the content's {{define}}s override the
+// layout's other {{block}}s. The layout's partials are available as well.
+// Stored layouts resolve to the caller's tenant variant and are checked like
+// the templates they wrap: hidden from other tenants, restricted to their
+// allowed callers and refused while quarantined.
+func resolveLayout(ctx context.Context, req renderRequest) (renderRequest, error) {
+	if req.Layout == "" {
+		return req, nil
+	}
+	if isBuiltinTemplate(req.Layout) {
+		layout, text, err := lookupBuiltinTemplate(req.Layout)
+		if err != nil {
+			return req, err
+		}
+		req.LayoutText = text
+		if req.EncodingFormat == "" {
+			req.EncodingFormat = layout.EncodingFormat
+		}
+		return req, nil
+	}
+	if !validTemplateName(req.Layout) {
+		return req, &render.Error{Message: fmt.Sprintf("invalid layout name %q", req.Layout), Status: http.StatusBadRequest}
+	}
+	variant, err := resolveTenantTemplate(ctx, renderRequest{TemplateName: req.Layout})
+	if err != nil {
+		return req, err
+	}
+	if req.Layout == req.TemplateName || variant.TemplateName == req.TemplateName {
+		return req, &render.Error{Message: "a template cannot be its own layout", Status: http.StatusBadRequest}
+	}
+
+	layout, err := templateStore.get(variant.TemplateName)
+	if errors.Is(err, errTemplateNotFound) {
+		return req, &render.Error{Message: fmt.Sprintf("layout %q not found", req.Layout), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return req, &render.Error{Message: "failed to load layout", Status: http.StatusInternalServerError, Err: err}
+	}
+	if !tenantVisible(renderCallerFrom(ctx).Tenant, layout.Tenant) {
+		return req, &render.Error{Message: fmt.Sprintf("layout %q not found", req.Layout), Status: http.StatusNotFound}
+	}
+	layoutReq := renderRequest{TemplateName: layout.Name, StoredVersion: layout.Version, AllowedCallers: layout.AllowedCallers}
+	if err := authorizeTemplateCaller(ctx, layoutReq); err != nil {
+		return req, err
+	}
+	if err := quarantine.check(layoutReq); err != nil {
+		return req, err
+	}
+
+	req.LayoutText = layout.Text
+	req.Partials = mergePartials(layout.Partials, req.Partials)
+	if req.EncodingFormat == "" {
+		req.EncodingFormat = layout.EncodingFormat
+	}
+	return req, nil
+}
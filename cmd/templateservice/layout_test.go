@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+func TestRenderTemplate_Layout(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	for _, tmpl := range []*storedTemplate{
+		{
+			Name:           "base",
+			Text:           `<title>{{block "title" .}}Untitled{{end}}</title><main>{{block "content" .}}{{end}}</main>{{template "footer"}}`,
+			EncodingFormat: "text/html",
+			Partials:       map[string]string{"footer": "<footer>ACME</footer>"},
+		},
+		{
+			Name:   "invoice",
+			Text:   `{{define "title"}}Invoice {{.Number}}{{end}}Total: {{.Total}}`,
+			Layout: "base",
+		},
+	} {
+		if err := templateStore.put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		TemplateName: "invoice",
+		Parameters:   map[string]interface{}{"Number": 42, "Total": "9.99"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	expected := "<title>Invoice 42</title><main>Total: 9.99</main><footer>ACME</footer>"
+	if result.Output != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Output)
+	}
+	if result.EncodingFormat != "text/html" {
+		t.Errorf("Expected the layout's format, got %q", result.EncodingFormat)
+	}
+
+	// Inline content selecting the layout per request keeps unset blocks' defaults
+	result, err = renderTemplate(context.Background(), renderRequest{Text: "Hello", Layout: "base"})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if expected := "<title>Untitled</title><main>Hello</main><footer>ACME</footer>"; result.Output != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Output)
+	}
+
+	if _, err := renderTemplate(context.Background(), renderRequest{Text: "x", Layout: "missing"}); err == nil {
+		t.Error("renderTemplate() should fail for an unknown layout")
+	}
+}
+
+func TestRenderTemplate_LayoutTenants(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	for _, tmpl := range []*storedTemplate{
+		{Name: "frame", Text: `[{{block "content" .}}{{end}}]`},
+		{Name: "acme~frame", Text: `<{{block "content" .}}{{end}}>`, Tenant: "acme"},
+		{Name: "globex~secret", Text: `globex secret {{block "content" .}}{{end}}`, Tenant: "globex"},
+	} {
+		if err := templateStore.put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acme := withRenderCaller(context.Background(), renderCaller{Principal: "tsk_acme", Tenant: "acme"})
+
+	result, err := renderTemplate(acme, renderRequest{Text: "x", Layout: "frame"})
+	if err != nil || result.Output != "<x>" {
+		t.Errorf("Expected the tenant's variant of the layout, got %v, %v", result, err)
+	}
+	_, err = renderTemplate(acme, renderRequest{Text: "x", Layout: "globex~secret"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusNotFound {
+		t.Errorf("Expected another tenant's layout to be hidden, got %v", err)
+	}
+}
+
+func TestRenderTemplate_LayoutRestrictions(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	withTemplateQuarantine(t, newTemplateQuarantine(0, 20, time.Minute, ""))
+	for _, tmpl := range []*storedTemplate{
+		{Name: "restricted", Text: `[{{block "content" .}}{{end}}]`, AllowedCallers: []string{"tsk_billing"}},
+		{Name: "broken", Text: `({{block "content" .}}{{end}})`},
+	} {
+		if err := templateStore.put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	quarantine.quarantine("broken", 1, "leaks data")
+	shop := withRenderCaller(context.Background(), renderCaller{Principal: "tsk_shop"})
+
+	_, err := renderTemplate(shop, renderRequest{Text: "x", Layout: "restricted"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusForbidden {
+		t.Errorf("Expected a layout restricted to other callers to be refused, got %v", err)
+	}
+	billing := withRenderCaller(context.Background(), renderCaller{Principal: "tsk_billing"})
+	if result, err := renderTemplate(billing, renderRequest{Text: "x", Layout: "restricted"}); err != nil || result.Output != "[x]" {
+		t.Errorf("Expected an allowed caller to use the layout, got %v, %v", result, err)
+	}
+	_, err = renderTemplate(shop, renderRequest{Text: "x", Layout: "broken"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusLocked {
+		t.Errorf("Expected a quarantined layout to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// Kinds of objects a legal hold can cover
+const (
+	holdTemplate = "template" // A stored template; with a version, only that version
+	holdResult   = "result"   // A persisted render result
+)
+
+// errLegalHold is returned when deleting or purging an object under legal hold
+var errLegalHold = errors.New("under legal hold")
+
+// legalHold keeps a template, template version or stored result from being
+// deleted or purged, whatever the retention settings, until it is released
+type legalHold struct {
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`            // Template name or result SHA-256
+	Version   int       `json:"version,omitempty"` // Held template version, 0 for the whole template
+	Reason    string    `json:"reason"`
+	AppliedBy string    `json:"appliedBy"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// legalHoldEvent is an entry of the audit trail of holds applied and released
+type legalHoldEvent struct {
+	Action    string    `json:"action"` // applied or released
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	Version   int       `json:"version,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Principal string    `json:"principal"`
+	ClientIP  string    `json:"clientIp,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// legalHoldStore keeps the active holds and their audit trail, in
+// TEMPLATE_LEGAL_HOLD_FILE when set. The trail is append-only.
+type legalHoldStore struct {
+	file string
+
+	mu     sync.Mutex
+	holds  map[string]*legalHold
+	events []legalHoldEvent
+}
+
+// legalHoldState is the persisted form of the store
+type legalHoldState struct {
+	Holds  []*legalHold     `json:"holds"`
+	Events []legalHoldEvent `json:"events"`
+}
+
+var legalHolds = newLegalHoldStore("")
+
+func newLegalHoldStore(file string) *legalHoldStore {
+	return &legalHoldStore{file: file, holds: make(map[string]*legalHold)}
+}
+
+// configureLegalHolds loads the holds persisted in TEMPLATE_LEGAL_HOLD_FILE
+func configureLegalHolds() error {
+	store := newLegalHoldStore(os.Getenv("TEMPLATE_LEGAL_HOLD_FILE"))
+	if store.file != "" {
+		if err := store.load(); err != nil {
+			return fmt.Errorf("TEMPLATE_LEGAL_HOLD_FILE: %w", err)
+		}
+		logger.Infof("Loaded %d legal holds from %s", len(store.holds), store.file)
+	}
+	legalHolds = store
+	return nil
+}
+
+func (s *legalHoldStore) load() error {
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state legalHoldState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for _, hold := range state.Holds {
+		s.holds[legalHoldKey(hold.Kind, hold.Target, hold.Version)] = hold
+	}
+	s.events = state.Events
+	return nil
+}
+
+// save persists the store. The caller holds s.mu.
+func (s *legalHoldStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(legalHoldState{Holds: s.sorted(), Events: s.events}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.file, data)
+}
+
+// legalHoldKey identifies a hold, e.g. template:invoice@3 or result:<sha256>
+func legalHoldKey(kind, target string, version int) string {
+	if version > 0 {
+		return fmt.Sprintf("%s:%s@%d", kind, target, version)
+	}
+	return kind + ":" + target
+}
+
+// sorted returns the holds ordered by kind, target and version. The caller holds s.mu.
+func (s *legalHoldStore) sorted() []*legalHold {
+	holds := make([]*legalHold, 0, len(s.holds))
+	for _, hold := range s.holds {
+		holds = append(holds, hold)
+	}
+	sort.Slice(holds, func(i, j int) bool {
+		a, b := holds[i], holds[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Version < b.Version
+	})
+	return holds
+}
+
+// heldLocked reports whether the object or, for a whole template, any of its
+// versions is held. The caller holds s.mu.
+func (s *legalHoldStore) heldLocked(kind, target string) bool {
+	if _, ok := s.holds[legalHoldKey(kind, target, 0)]; ok {
+		return true
+	}
+	prefix := legalHoldKey(kind, target, 0) + "@"
+	for key := range s.holds {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// held reports whether the object or any part of it is under legal hold
+func (s *legalHoldStore) held(kind, target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heldLocked(kind, target)
+}
+
+// removeUnlessHeld runs remove unless the object is held. Holds cannot be
+// applied while it runs, so a hold never races a deletion.
+func (s *legalHoldStore) removeUnlessHeld(kind, target string, remove func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.heldLocked(kind, target) {
+		return errLegalHold
+	}
+	return remove()
+}
+
+// apply places a hold, replacing the reason of an existing one
+func (s *legalHoldStore) apply(hold legalHold, caller renderCaller) (*legalHold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := legalHoldKey(hold.Kind, hold.Target, hold.Version)
+	previous, existed := s.holds[key]
+	s.holds[key] = &hold
+	s.events = append(s.events, holdEvent("applied", hold, caller))
+	if err := s.save(); err != nil {
+		if existed {
+			s.holds[key] = previous
+		} else {
+			delete(s.holds, key)
+		}
+		s.events = s.events[:len(s.events)-1]
+		return nil, err
+	}
+	logger.Info(fmt.Sprintf("Legal hold applied to %s by %s: %s", key, hold.AppliedBy, hold.Reason))
+	return &hold, nil
+}
+
+// release lifts a hold, reporting whether one was in place
+func (s *legalHoldStore) release(kind, target string, version int, reason string, caller renderCaller) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := legalHoldKey(kind, target, version)
+	hold, ok := s.holds[key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.holds, key)
+	released := *hold
+	released.Reason = reason
+	s.events = append(s.events, holdEvent("released", released, caller))
+	if err := s.save(); err != nil {
+		s.holds[key] = hold
+		s.events = s.events[:len(s.events)-1]
+		return false, err
+	}
+	logger.Info(fmt.Sprintf("Legal hold on %s released by %s", key, holdPrincipal(caller)))
+	return true, nil
+}
+
+// holdEvent builds an audit trail entry
+func holdEvent(action string, hold legalHold, caller renderCaller) legalHoldEvent {
+	return legalHoldEvent{
+		Action:    action,
+		Kind:      hold.Kind,
+		Target:    hold.Target,
+		Version:   hold.Version,
+		Reason:    hold.Reason,
+		Principal: holdPrincipal(caller),
+		ClientIP:  caller.ClientIP,
+		At:        time.Now().UTC(),
+	}
+}
+
+// holdPrincipal names the caller in the audit trail
+func holdPrincipal(caller renderCaller) string {
+	if caller.Principal == "" {
+		return "anonymous"
+	}
+	return caller.Principal
+}
+
+// holdTarget resolves the object addressed by a hold request, checking that it exists
+func holdTarget(c echo.Context, kind string) (target string, version int, err error) {
+	switch kind {
+	case holdResult:
+		target = c.Param("sha256")
+		if !sha256Pattern.MatchString(target) {
+			return "", 0, &render.Error{Message: "invalid result hash", Status: http.StatusBadRequest}
+		}
+		if results == nil {
+			return "", 0, &render.Error{Message: "result persistence is disabled", Status: http.StatusNotFound}
+		}
+		if _, _, err := results.get(target); err != nil {
+			return "", 0, &render.Error{Message: "result not found", Status: http.StatusNotFound}
+		}
+		return target, 0, nil
+	default:
+		target = c.Param("name")
+		if c.Param("version") != "" {
+			tmpl, err := quarantineTarget(c)
+			if err != nil {
+				return "", 0, err
+			}
+			return tmpl.Name, tmpl.Version, nil
+		}
+		if _, err := templateStore.get(target); errors.Is(err, errTemplateNotFound) {
+			return "", 0, &render.Error{Message: "template not found", Status: http.StatusNotFound}
+		} else if err != nil {
+			return "", 0, &render.Error{Message: "failed to load stored template", Status: http.StatusInternalServerError, Err: err}
+		}
+		return target, 0, nil
+	}
+}
+
+// handleApplyLegalHold returns a handler for PUT .../hold on templates,
+// template versions and results. The body must give a reason.
+func handleApplyLegalHold(kind string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		target, version, err := holdTarget(c, kind)
+		if err != nil {
+			return renderErrorJSON(c, err)
+		}
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+		if strings.TrimSpace(body.Reason) == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+		}
+
+		caller := renderCallerFrom(c.Request().Context())
+		hold, err := legalHolds.apply(legalHold{
+			Kind:      kind,
+			Target:    target,
+			Version:   version,
+			Reason:    body.Reason,
+			AppliedBy: holdPrincipal(caller),
+			AppliedAt: time.Now().UTC(),
+		}, caller)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, hold)
+	}
+}
+
+// handleReleaseLegalHold returns a handler for DELETE .../hold. A reason may
+// be given in the body or the reason query parameter for the audit trail.
+func handleReleaseLegalHold(kind string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		target, version := c.Param("name"), 0
+		if kind == holdResult {
+			target = c.Param("sha256")
+		} else if c.Param("version") != "" {
+			var ok bool
+			if version, ok = templateVersionParam(c); !ok {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid version"})
+			}
+		}
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if c.Request().ContentLength > 0 {
+			if err := c.Bind(&body); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+			}
+		}
+		if body.Reason == "" {
+			body.Reason = c.QueryParam("reason")
+		}
+
+		released, err := legalHolds.release(kind, target, version, body.Reason, renderCallerFrom(c.Request().Context()))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		if !released {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no legal hold in place"})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// handleListLegalHolds handles GET /v1/api/legal-holds
+func handleListLegalHolds(c echo.Context) error {
+	legalHolds.mu.Lock()
+	defer legalHolds.mu.Unlock()
+	holds := legalHolds.sorted()
+	return c.JSON(http.StatusOK, map[string]interface{}{"count": len(holds), "holds": holds})
+}
+
+// handleLegalHoldAudit handles GET /v1/api/legal-holds/audit, listing the
+// trail oldest first, optionally for one kind and target
+func handleLegalHoldAudit(c echo.Context) error {
+	kind, target := c.QueryParam("kind"), c.QueryParam("target")
+	legalHolds.mu.Lock()
+	defer legalHolds.mu.Unlock()
+	events := make([]legalHoldEvent, 0, len(legalHolds.events))
+	for _, event := range legalHolds.events {
+		if (kind == "" || event.Kind == kind) && (target == "" || event.Target == target) {
+			events = append(events, event)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"count": len(events), "events": events})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// withLegalHolds swaps the global legal hold store for the duration of a test
+func withLegalHolds(t *testing.T, store *legalHoldStore) {
+	t.Helper()
+	previous := legalHolds
+	legalHolds = store
+	t.Cleanup(func() { legalHolds = previous })
+}
+
+// callHoldHandler invokes a handler with route parameters as the caller "ops"
+func callHoldHandler(handler echo.HandlerFunc, method, body string, params ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	req = req.WithContext(withRenderCaller(req.Context(), renderCaller{Principal: "ops", ClientIP: "10.0.0.1"}))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	var names, values []string
+	for i := 0; i < len(params); i += 2 {
+		names, values = append(names, params[i]), append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	handler(c)
+	return rec
+}
+
+func TestLegalHold_Templates(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	file := filepath.Join(t.TempDir(), "holds.json")
+	withLegalHolds(t, newLegalHoldStore(file))
+	for _, text := range []string{"v1", "v2"} {
+		existing, _ := templateStore.get("contract")
+		if _, err := saveTemplate("contract", &templateInput{Text: text}, existing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rec := callHoldHandler(handleApplyLegalHold(holdTemplate), http.MethodPut, `{}`, "name", "contract", "version", "1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Hold without reason = %d", rec.Code)
+	}
+	if rec := callHoldHandler(handleApplyLegalHold(holdTemplate), http.MethodPut, `{"reason": "case 42"}`, "name", "contract", "version", "9"); rec.Code != http.StatusNotFound {
+		t.Errorf("Hold on a missing version = %d", rec.Code)
+	}
+	if rec := callHoldHandler(handleApplyLegalHold(holdTemplate), http.MethodPut, `{"reason": "case 42"}`, "name", "contract", "version", "1"); rec.Code != http.StatusOK {
+		t.Fatalf("Hold = %d: %s", rec.Code, rec.Body)
+	}
+
+	// A held version keeps the whole template from being deleted
+	if rec := callHoldHandler(handleDeleteTemplate, http.MethodDelete, "", "name", "contract"); rec.Code != http.StatusConflict {
+		t.Errorf("Delete of a held template = %d", rec.Code)
+	}
+	if _, err := templateStore.get("contract"); err != nil {
+		t.Fatalf("Held template was deleted: %v", err)
+	}
+
+	// Holds and the audit trail survive a restart
+	reloaded := newLegalHoldStore(file)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.held(holdTemplate, "contract") || len(reloaded.events) != 1 || reloaded.events[0].Principal != "ops" {
+		t.Errorf("Reloaded holds %+v, events %+v", reloaded.holds, reloaded.events)
+	}
+
+	if rec := callHoldHandler(handleReleaseLegalHold(holdTemplate), http.MethodDelete, "", "name", "contract"); rec.Code != http.StatusNotFound {
+		t.Errorf("Release of a template without a template-level hold = %d", rec.Code)
+	}
+	if rec := callHoldHandler(handleReleaseLegalHold(holdTemplate), http.MethodDelete, `{"reason": "case closed"}`, "name", "contract", "version", "1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Release = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := callHoldHandler(handleDeleteTemplate, http.MethodDelete, "", "name", "contract"); rec.Code != http.StatusNoContent {
+		t.Errorf("Delete after release = %d", rec.Code)
+	}
+
+	rec := callHoldHandler(handleLegalHoldAudit, http.MethodGet, "")
+	var audit struct {
+		Events []legalHoldEvent `json:"events"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &audit); err != nil {
+		t.Fatal(err)
+	}
+	if len(audit.Events) != 2 || audit.Events[0].Action != "applied" || audit.Events[1].Action != "released" ||
+		audit.Events[1].Reason != "case closed" || audit.Events[1].ClientIP != "10.0.0.1" {
+		t.Errorf("Unexpected audit trail %s", rec.Body)
+	}
+}
+
+func TestLegalHold_Results(t *testing.T) {
+	withLegalHolds(t, newLegalHoldStore(""))
+	store, err := newResultStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := results
+	results = store
+	t.Cleanup(func() { results = previous })
+
+	hashes := make([]string, 2)
+	for i, output := range []string{"held", "purged"} {
+		sum := sha256.Sum256([]byte(output))
+		hashes[i] = hex.EncodeToString(sum[:])
+		if _, err := store.put(hashes[i], output, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-48 * time.Hour)
+		os.Chtimes(store.blobPath(hashes[i]), old, old)
+	}
+
+	if rec := callHoldHandler(handleApplyLegalHold(holdResult), http.MethodPut, `{"reason": "audit"}`, "sha256", hashes[0]); rec.Code != http.StatusOK {
+		t.Fatalf("Hold = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := callHoldHandler(handleDeleteResult, http.MethodDelete, "", "sha256", hashes[0]); rec.Code != http.StatusConflict {
+		t.Errorf("Delete of a held result = %d", rec.Code)
+	}
+
+	store.retention = 24 * time.Hour
+	if expired := store.expire(); expired != 1 {
+		t.Errorf("expire() = %d, want 1", expired)
+	}
+	if _, _, err := store.get(hashes[0]); err != nil {
+		t.Errorf("Held result was purged: %v", err)
+	}
+	if _, _, err := store.get(hashes[1]); err == nil {
+		t.Error("Expected the unheld result to be purged")
+	}
+
+	if rec := callHoldHandler(handleListLegalHolds, http.MethodGet, ""); !strings.Contains(rec.Body.String(), hashes[0]) {
+		t.Errorf("Unexpected hold listing %s", rec.Body)
+	}
+	if rec := callHoldHandler(handleReleaseLegalHold(holdResult), http.MethodDelete, "", "sha256", hashes[0]); rec.Code != http.StatusNoContent {
+		t.Fatalf("Release = %d", rec.Code)
+	}
+	if rec := callHoldHandler(handleDeleteResult, http.MethodDelete, "", "sha256", hashes[0]); rec.Code != http.StatusNoContent {
+		t.Errorf("Delete after release = %d", rec.Code)
+	}
+}
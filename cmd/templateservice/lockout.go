@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxSecurityEvents is the number of recent security events kept in memory
+const maxSecurityEvents = 200
+
+// authenticatedKey marks requests that passed the API key check
+const authenticatedKey = "authenticated"
+
+// authLockout throttles sources that repeatedly fail authentication. After
+// maxFailures failures within window a source is blocked; every further
+// lockout doubles the block duration up to maxBlock.
+type authLockout struct {
+	maxFailures int
+	window      time.Duration
+	baseBlock   time.Duration
+	maxBlock    time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*authSource
+	events  []securityEvent
+}
+
+// authSource is the failure history of a client IP or API key prefix
+type authSource struct {
+	failures     []time.Time
+	lockouts     int
+	blockedUntil time.Time
+	lastSeen     time.Time
+}
+
+// securityEvent is an authentication event worth reviewing
+type securityEvent struct {
+	Type   string    `json:"type"` // auth_failure, lockout, blocked
+	Source string    `json:"source"`
+	Path   string    `json:"path"`
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+var lockout *authLockout
+
+// configureAuthLockout creates the lockout tracker from the environment.
+// TEMPLATE_AUTH_MAX_FAILURES=0 disables it.
+func configureAuthLockout() {
+	maxFailures := envInt("TEMPLATE_AUTH_MAX_FAILURES", 5)
+	if maxFailures <= 0 {
+		lockout = nil
+		return
+	}
+	lockout = newAuthLockout(
+		maxFailures,
+		envDuration("TEMPLATE_AUTH_FAILURE_WINDOW", 15*time.Minute),
+		envDuration("TEMPLATE_AUTH_LOCKOUT", time.Minute),
+		envDuration("TEMPLATE_AUTH_LOCKOUT_MAX", time.Hour),
+	)
+}
+
+func newAuthLockout(maxFailures int, window, baseBlock, maxBlock time.Duration) *authLockout {
+	return &authLockout{
+		maxFailures: maxFailures,
+		window:      window,
+		baseBlock:   baseBlock,
+		maxBlock:    maxBlock,
+		now:         time.Now,
+		sources:     make(map[string]*authSource),
+	}
+}
+
+// blocked returns how long any of the sources is still blocked
+func (l *authLockout) blocked(sources []string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var longest time.Duration
+	for _, key := range sources {
+		if s, ok := l.sources[key]; ok && s.blockedUntil.After(now) {
+			if remaining := s.blockedUntil.Sub(now); remaining > longest {
+				longest = remaining
+			}
+		}
+	}
+	return longest
+}
+
+// failure records a failed authentication and blocks sources that exceed
+// the failure budget
+func (l *authLockout) failure(sources []string, path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	l.record(securityEvent{Type: "auth_failure", Source: strings.Join(sources, " "), Path: path, At: now})
+
+	for _, key := range sources {
+		s, ok := l.sources[key]
+		if !ok {
+			s = &authSource{}
+			l.sources[key] = s
+		}
+		s.lastSeen = now
+
+		recent := s.failures[:0]
+		for _, at := range s.failures {
+			if now.Sub(at) < l.window {
+				recent = append(recent, at)
+			}
+		}
+		s.failures = append(recent, now)
+
+		if len(s.failures) >= l.maxFailures {
+			s.lockouts++
+			block := l.backoff(s.lockouts)
+			s.blockedUntil = now.Add(block)
+			s.failures = nil
+			l.record(securityEvent{
+				Type:   "lockout",
+				Source: key,
+				Path:   path,
+				Detail: fmt.Sprintf("blocked for %s after %d failed attempts (lockout %d)", block, l.maxFailures, s.lockouts),
+				At:     now,
+			})
+		}
+	}
+}
+
+// success clears the failure history of the sources
+func (l *authLockout) success(sources []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range sources {
+		delete(l.sources, key)
+	}
+}
+
+// backoff returns the block duration of the nth lockout
+func (l *authLockout) backoff(n int) time.Duration {
+	factor := math.Pow(2, float64(n-1))
+	block := time.Duration(float64(l.baseBlock) * factor)
+	if block > l.maxBlock || block <= 0 {
+		return l.maxBlock
+	}
+	return block
+}
+
+// prune forgets sources that are neither blocked nor recently seen. Callers hold l.mu.
+func (l *authLockout) prune(now time.Time) {
+	for key, s := range l.sources {
+		if s.blockedUntil.Before(now) && now.Sub(s.lastSeen) > l.maxBlock+l.window {
+			delete(l.sources, key)
+		}
+	}
+}
+
+// record logs a security event and keeps it for review. Callers hold l.mu.
+func (l *authLockout) record(event securityEvent) {
+	logger.Info(fmt.Sprintf("Security event %s from %s on %s %s", event.Type, event.Source, event.Path, event.Detail))
+	l.events = append(l.events, event)
+	if len(l.events) > maxSecurityEvents {
+		l.events = l.events[len(l.events)-maxSecurityEvents:]
+	}
+}
+
+// recentEvents returns the retained security events, newest first
+func (l *authLockout) recentEvents() []securityEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := make([]securityEvent, len(l.events))
+	for i, event := range l.events {
+		events[len(l.events)-1-i] = event
+	}
+	return events
+}
+
+// authSources identifies the caller by client IP and, when a key was
+// presented, by the key's prefix so a leaked key probed from many
+// addresses is throttled as well
+func authSources(c echo.Context) []string {
+	sources := []string{"ip:" + c.RealIP()}
+	if keyID := c.Request().Header.Get(headerSignatureKeyID); keyID != "" {
+		sources = append(sources, "hmac:"+keyID)
+	} else if prefix := apiKeyPrefix(presentedAPIKey(c)); prefix != "" {
+		sources = append(sources, "key:"+prefix)
+	}
+	return sources
+}
+
+// lockoutMiddleware wraps an authentication middleware, rejecting blocked
+// sources with 429 and recording its failures (401/403 responses)
+func lockoutMiddleware(auth echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		guarded := auth(func(c echo.Context) error {
+			c.Set(authenticatedKey, true)
+			return next(c)
+		})
+
+		return func(c echo.Context) error {
+			if lockout == nil {
+				return guarded(c)
+			}
+
+			sources := authSources(c)
+			path := c.Request().URL.Path
+			if remaining := lockout.blocked(sources); remaining > 0 {
+				lockout.mu.Lock()
+				lockout.record(securityEvent{Type: "blocked", Source: strings.Join(sources, " "), Path: path, At: lockout.now()})
+				lockout.mu.Unlock()
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+				return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many failed authentication attempts"})
+			}
+
+			err := guarded(c)
+			if c.Get(authenticatedKey) == true {
+				lockout.success(sources)
+				return err
+			}
+			if isAuthFailure(c, err) {
+				lockout.failure(sources, path)
+			}
+			return err
+		}
+	}
+}
+
+// isAuthFailure reports whether the authentication middleware rejected the request
+func isAuthFailure(c echo.Context, err error) bool {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code == http.StatusUnauthorized || he.Code == http.StatusForbidden
+	}
+	status := c.Response().Status
+	return c.Response().Committed && (status == http.StatusUnauthorized || status == http.StatusForbidden)
+}
+
+// handleSecurityEvents serves GET /v1/api/security/events
+func handleSecurityEvents(c echo.Context) error {
+	if lockout == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "authentication lockout is disabled"})
+	}
+	events := lockout.recentEvents()
+	return c.JSON(http.StatusOK, map[string]interface{}{"count": len(events), "events": events})
+}
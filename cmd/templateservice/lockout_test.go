@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// testKeyMiddleware accepts only the key "secret-key"
+func testKeyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Header.Get("X-API-Key") != "secret-key" {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid API key"})
+		}
+		return next(c)
+	}
+}
+
+func withAuthLockout(t *testing.T, l *authLockout) {
+	t.Helper()
+	previous := lockout
+	lockout = l
+	t.Cleanup(func() { lockout = previous })
+}
+
+func TestLockoutMiddleware(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newAuthLockout(3, time.Minute, time.Minute, 10*time.Minute)
+	l.now = func() time.Time { return now }
+	withAuthLockout(t, l)
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, lockoutMiddleware(testKeyMiddleware))
+
+	call := func(remote, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := call("203.0.113.7:1234", "wrong-key"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i, rec.Code)
+		}
+	}
+
+	// Even the correct key is refused while locked out
+	rec := call("203.0.113.7:1234", "secret-key")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 while locked out, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected Retry-After 60, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// Other clients are unaffected
+	if rec := call("198.51.100.1:1234", "secret-key"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another client, got %d", rec.Code)
+	}
+
+	// The lockout expires, and a repeated lockout lasts twice as long
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		call("203.0.113.7:1234", "wrong-key")
+	}
+	if rec := call("203.0.113.7:1234", "secret-key"); rec.Header().Get("Retry-After") != "120" {
+		t.Errorf("Expected escalated Retry-After 120, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	var lockouts int
+	for _, event := range l.recentEvents() {
+		if event.Type == "lockout" {
+			lockouts++
+		}
+	}
+	if lockouts == 0 {
+		t.Error("Expected lockout security events")
+	}
+}
+
+func TestLockoutSuccessResets(t *testing.T) {
+	withAuthLockout(t, newAuthLockout(2, time.Minute, time.Minute, time.Hour))
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, lockoutMiddleware(testKeyMiddleware))
+
+	for _, key := range []string{"wrong-key", "secret-key", "wrong-key", "secret-key"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code == http.StatusTooManyRequests {
+			t.Fatal("Successful requests should reset the failure count")
+		}
+	}
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	l := newAuthLockout(1, time.Minute, time.Minute, 5*time.Minute)
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, want := range expected {
+		if got := l.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, want)
+		}
+	}
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
-	"text/template"
+	"time"
 
 	"eve.evalgo.org/web"
 
@@ -19,6 +21,8 @@ import (
 	"eve.evalgo.org/statemanager"
 	"eve.evalgo.org/tracing"
 	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
 )
 
 // TemplateRequest represents a request to render a template
@@ -31,10 +35,30 @@ type TemplateRequest struct {
 	// Schema.org CreativeWork properties
 	Text           string `json:"text,omitempty"`           // Template content (inline)
 	Identifier     string `json:"identifier,omitempty"`     // Template ID or path
+	TemplateName   string `json:"templateName,omitempty"`   // Stored template name
 	EncodingFormat string `json:"encodingFormat,omitempty"` // Template format (e.g., "text/template")
 
 	// Template-specific properties
 	TemplateParameters map[string]interface{} `json:"templateParameters,omitempty"` // Template variables
+	ParametersUpload   string                 `json:"parametersUpload,omitempty"`   // Upload ID of a JSON parameters file
+
+	// Render options
+	Assertions *render.Assertions `json:"assertions,omitempty"` // Contract checks on the rendered output
+	Suppress   *suppressOptions   `json:"suppress,omitempty"`   // When to suppress the output as empty
+	Delimiters []string           `json:"delimiters,omitempty"` // Action delimiters, e.g. ["<%", "%>"]
+	MissingKey string             `json:"missingKey,omitempty"` // Missing key handling: default, zero or error
+	Engine     string             `json:"engine,omitempty"`     // Template engine: go (default), mustache, handlebars, jinja2 or liquid
+
+	MissingKeyValue *string `json:"missingKeyValue,omitempty"` // Printed in place of missing keys
+	TemplateVersion int     `json:"templateVersion,omitempty"` // Stored template version (default the one in effect)
+	EffectiveDate   string  `json:"effectiveDate,omitempty"`   // Selects the stored version in effect at this time (default now)
+
+	Partials map[string]string `json:"partials,omitempty"` // Named templates for {{template "name" .}}
+	Layout   string            `json:"layout,omitempty"`   // Stored or built-in layout to render into
+
+	ConvertTo string `json:"convertTo,omitempty"` // Convert the output, e.g. HTML to application/pdf
+	Debug     bool   `json:"debug,omitempty"`     // Render with dump and debugJSON (debug mode servers only)
+	Locale    string `json:"locale,omitempty"`    // Locale of {{t "key"}} translations, e.g. de-CH
 
 	// Legacy fields (for backward compatibility)
 	Template   string                 `json:"template,omitempty"`   // Deprecated: use text
@@ -50,9 +74,21 @@ type TemplateResponse struct {
 	Type    string `json:"@type,omitempty"`    // DigitalDocument or Article
 
 	// Schema.org CreativeWork properties
-	Text           string `json:"text,omitempty"`           // Rendered output
-	EncodingFormat string `json:"encodingFormat,omitempty"` // Output format (e.g., "text/plain", "text/html")
-	ContentSize    int64  `json:"contentSize,omitempty"`    // Size in bytes
+	Text            string `json:"text,omitempty"`            // Rendered output
+	EncodingFormat  string `json:"encodingFormat,omitempty"`  // Output format (e.g., "text/plain", "text/html")
+	ContentEncoding string `json:"contentEncoding,omitempty"` // base64 when the output is binary, e.g. a PDF
+	ContentSize     int64  `json:"contentSize,omitempty"`     // Size in bytes
+	Sha256          string `json:"sha256,omitempty"`          // Hex SHA-256 of the output
+	ContentUrl      string `json:"contentUrl,omitempty"`      // Persisted output location
+	TemplateCommit  string `json:"templateCommit,omitempty"`  // Commit of a Git repository template
+
+	// Integrity properties
+	Signature          string `json:"signature,omitempty"`          // Base64 signature of the output
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"` // hmac-sha256 or ed25519
+
+	Suppressed bool `json:"suppressed,omitempty"` // Output matched the suppress options and is not to be sent
+
+	EffectiveOptions *effectiveOptions `json:"effectiveOptions,omitempty"` // Options applied after merging defaults
 
 	// Legacy fields (for backward compatibility)
 	Output string `json:"output,omitempty"` // Deprecated: use text
@@ -61,10 +97,48 @@ type TemplateResponse struct {
 // handleRender renders a template with provided parameters
 func handleRender(c echo.Context) error {
 	var req TemplateRequest
-	if err := c.Bind(&req); err != nil {
+	if err := bindRequest(c, &req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
 
+	if err := validateTemplateRequest(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	rendered, err := renderTemplate(c.Request().Context(), renderRequestFrom(req))
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+
+	result, contentEncoding := jsonOutput(rendered.EncodingFormat, rendered.Output)
+
+	response := TemplateResponse{
+		// Semantic fields
+		Context:         "https://schema.org",
+		Type:            "DigitalDocument",
+		Text:            result,
+		EncodingFormat:  rendered.EncodingFormat,
+		ContentEncoding: contentEncoding,
+		ContentSize:     int64(len(rendered.Output)),
+		Sha256:          rendered.SHA256,
+		ContentUrl:      rendered.ContentURL,
+		TemplateCommit:  rendered.TemplateCommit,
+
+		Signature:          rendered.Signature,
+		SignatureAlgorithm: rendered.SignatureAlgorithm,
+		Suppressed:         rendered.Suppressed,
+		EffectiveOptions:   rendered.Options,
+
+		// Legacy fields (for backward compatibility)
+		Output: result,
+	}
+
+	return respondJSON(c, http.StatusOK, response)
+}
+
+// renderRequestFrom normalizes a TemplateRequest, including its legacy
+// fields, into the engine-level render request
+func renderRequestFrom(req TemplateRequest) renderRequest {
 	// Normalize legacy fields to semantic fields for backward compatibility
 	if req.Text == "" && req.Template != "" {
 		req.Text = req.Template
@@ -75,76 +149,248 @@ func handleRender(c echo.Context) error {
 	if req.TemplateParameters == nil && req.Parameters != nil {
 		req.TemplateParameters = req.Parameters
 	}
-
-	// Get template content (prefer semantic fields)
-	var templateContent string
-	if req.Text != "" {
-		// Inline template
-		templateContent = req.Text
-	} else if req.Identifier != "" {
-		// Load from file
-		data, err := os.ReadFile(req.Identifier)
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				"error": fmt.Sprintf("failed to read template file: %v", err),
-			})
-		}
-		templateContent = string(data)
-	} else {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "either text/template or identifier/templateId is required",
-		})
-	}
-
-	// Parse and execute template
-	tmpl, err := template.New("template").Parse(templateContent)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": fmt.Sprintf("failed to parse template: %v", err),
-		})
+	// The template format may name its engine, e.g. text/x-mustache
+	if engine, _, ok := render.EngineFromFormat(req.EncodingFormat); ok && req.Engine == "" {
+		req.Engine = engine
 	}
 
-	// Use template parameters (prefer semantic field)
-	params := req.TemplateParameters
-	if params == nil {
-		params = req.Parameters
+	return renderRequest{
+		Name:       "template",
+		Text:       req.Text,
+		Identifier: req.Identifier,
+		Parameters: req.TemplateParameters,
+		Assertions: req.Assertions,
+		Suppress:   req.Suppress,
+		Delimiters: req.Delimiters,
+
+		TemplateName: req.TemplateName,
+		MissingKey:   req.MissingKey,
+		MissingValue: req.MissingKeyValue,
+		Engine:       req.Engine,
+
+		ParametersFrom: req.ParametersUpload,
+
+		TemplateVersion: req.TemplateVersion,
+		EffectiveDate:   req.EffectiveDate,
+		Partials:        req.Partials,
+		Layout:          req.Layout,
+		ConvertTo:       req.ConvertTo,
+		Debug:           req.Debug,
+		Locale:          req.Locale,
 	}
+}
 
-	var output bytes.Buffer
-	if err := tmpl.Execute(&output, params); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": fmt.Sprintf("failed to execute template: %v", err),
-		})
+// validateTemplateRequest checks that a request names a template
+func validateTemplateRequest(req TemplateRequest) error {
+	if req.Text == "" && req.Template == "" && req.Identifier == "" && req.TemplateID == "" && req.TemplateName == "" {
+		return errors.New("either text/template, identifier/templateId or templateName is required")
 	}
+	return nil
+}
 
-	result := output.String()
-
-	response := TemplateResponse{
-		// Semantic fields
-		Context:        "https://schema.org",
-		Type:           "DigitalDocument",
-		Text:           result,
-		EncodingFormat: "text/plain",
-		ContentSize:    int64(len(result)),
-
-		// Legacy fields (for backward compatibility)
-		Output: result,
+// renderErrorJSON writes a render failure as the legacy {"error": ...} response
+func renderErrorJSON(c echo.Context, err error) error {
+	body := map[string]interface{}{"error": err.Error()}
+	status := http.StatusInternalServerError
+	var re *render.Error
+	if errors.As(err, &re) {
+		status = re.Status
+		if len(re.Details) > 0 {
+			body["details"] = re.Details
+		}
+		if len(re.Violations) > 0 {
+			body["violations"] = re.Violations
+		}
 	}
-
-	return c.JSON(http.StatusOK, response)
+	setQuotaRetryAfter(c, err)
+	return c.JSON(status, body)
 }
 
 var logger *common.ContextLogger
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == sandboxSubcommand {
+		os.Exit(runRenderSandbox(os.Stdin, os.Stdout))
+	}
+
 	// Initialize logger
 	logger = common.ServiceLogger("templateservice", "1.0.0")
 
+	// Subcommands other than serve render and validate templates from the
+	// command line (see cli.go)
+	if len(os.Args) > 1 && os.Args[1] != serveCommand {
+		os.Exit(runCommand(os.Args[1], os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	serve()
+}
+
+// serve configures and runs the service until it is interrupted
+func serve() {
 	// Register action handlers with the semantic action registry
 	// This allows the service to handle semantic actions without modifying switch statements
 	semantic.MustRegister("ReplaceAction", handleSemanticReplace)
 
+	// Apply the configuration file (TEMPLATE_CONFIG) and validate the settings
+	if err := configureFromFile(); err != nil {
+		logger.WithError(err).Error("Invalid configuration")
+		os.Exit(1)
+	}
+
+	// Load render pipeline configuration
+	if err := configureNetworkPolicy(); err != nil {
+		logger.WithError(err).Error("Invalid network policy")
+		os.Exit(1)
+	}
+	if err := configureAPIKeys(); err != nil {
+		logger.WithError(err).Error("Invalid API key configuration")
+		os.Exit(1)
+	}
+	if err := configureRequestSigning(); err != nil {
+		logger.WithError(err).Error("Invalid request signing configuration")
+		os.Exit(1)
+	}
+	configureAuthLockout()
+	if err := configureOIDC(); err != nil {
+		logger.WithError(err).Error("Failed to configure single sign-on")
+		os.Exit(1)
+	}
+	if err := configureTenants(); err != nil {
+		logger.WithError(err).Error("Invalid tenant configuration")
+		os.Exit(1)
+	}
+	if err := configureRateLimits(); err != nil {
+		logger.WithError(err).Error("Invalid rate limit configuration")
+		os.Exit(1)
+	}
+	if err := configureUsageQuotas(); err != nil {
+		logger.WithError(err).Error("Invalid usage quota configuration")
+		os.Exit(1)
+	}
+	if err := configureAuditLog(); err != nil {
+		logger.WithError(err).Error("Invalid audit log configuration")
+		os.Exit(1)
+	}
+	if err := configureTLS(); err != nil {
+		logger.WithError(err).Error("Invalid TLS configuration")
+		os.Exit(1)
+	}
+	if err := configureJWTAuth(); err != nil {
+		logger.WithError(err).Error("Failed to configure JWT bearer authentication")
+		os.Exit(1)
+	}
+	if err := configureProvisioning(); err != nil {
+		logger.WithError(err).Error("Failed to load provisioned keys")
+		os.Exit(1)
+	}
+	if err := configureTenantHosts(); err != nil {
+		logger.WithError(err).Error("Invalid tenant host mapping")
+		os.Exit(1)
+	}
+	if err := configureThemes(); err != nil {
+		logger.WithError(err).Error("Failed to load theme packs")
+		os.Exit(1)
+	}
+	if err := configureMessageCatalogs(); err != nil {
+		logger.WithError(err).Error("Failed to load message catalogs")
+		os.Exit(1)
+	}
+	configureSecurityHeaders()
+	configureRequestDecompression()
+	configureBodyLimits()
+	if err := configureInlineOnly(); err != nil {
+		logger.WithError(err).Error("Invalid inline-only configuration")
+		os.Exit(1)
+	}
+	if err := configureTemplateRoot(); err != nil {
+		logger.WithError(err).Error("Invalid template root")
+		os.Exit(1)
+	}
+	configureRemoteTemplates()
+	if err := configureGitRepository(context.Background()); err != nil {
+		logger.WithError(err).Error("Failed to initialize Git template repository")
+		os.Exit(1)
+	}
+	if err := configurePluginFuncs(); err != nil {
+		logger.WithError(err).Error("Invalid template function plugins")
+		os.Exit(1)
+	}
+	configureTemplateFuncs()
+	configureDebugRenders()
+	configureTemplateCache()
+	configureRenderTimeout()
+	configureOutputLimit()
+	if err := configureSandbox(); err != nil {
+		logger.WithError(err).Error("Invalid sandbox configuration")
+		os.Exit(1)
+	}
+	configureRenderMatrix()
+	if err := configureTemplateStore(); err != nil {
+		logger.WithError(err).Error("Invalid template store configuration")
+		os.Exit(1)
+	}
+	if err := configureMarketplace(); err != nil {
+		logger.WithError(err).Error("Invalid template marketplace configuration")
+		os.Exit(1)
+	}
+	configureRenderPolicy()
+	configureTemplateQuarantine()
+	configurePostRenderHooks()
+	configureMetrics()
+	configureGRPC()
+	if err := configureSpans(); err != nil {
+		logger.WithError(err).Error("Invalid tracing configuration")
+		os.Exit(1)
+	}
+	if err := configureOutputSigning(); err != nil {
+		logger.WithError(err).Error("Invalid output signing configuration")
+		os.Exit(1)
+	}
+	if err := configureLegalHolds(); err != nil {
+		logger.WithError(err).Error("Failed to load legal holds")
+		os.Exit(1)
+	}
+	if err := configureResultStore(); err != nil {
+		logger.WithError(err).Error("Failed to initialize result store")
+		os.Exit(1)
+	}
+	if err := configureUploads(); err != nil {
+		logger.WithError(err).Error("Failed to initialize uploads")
+		os.Exit(1)
+	}
+	if err := configureWorkspaces(); err != nil {
+		logger.WithError(err).Error("Failed to initialize workspaces")
+		os.Exit(1)
+	}
+	configurePDF()
+	stopJanitor := make(chan struct{})
+	go workspaces.runJanitor(time.Minute, stopJanitor)
+	go uploads.runJanitor(time.Hour, stopJanitor)
+	if results != nil && results.retention > 0 {
+		go results.runJanitor(time.Hour, stopJanitor)
+	}
+	if err := configureS3Events(); err != nil {
+		logger.WithError(err).Error("Failed to configure S3 event pipelines")
+		os.Exit(1)
+	}
+	if err := configureIMAPWatcher(context.Background()); err != nil {
+		logger.WithError(err).Error("Failed to configure IMAP watcher")
+		os.Exit(1)
+	}
+	if err := configureJobCallbacks(); err != nil {
+		logger.WithError(err).Error("Failed to configure job callbacks")
+		os.Exit(1)
+	}
+	if err := configureJobs(); err != nil {
+		logger.WithError(err).Error("Failed to initialize job queue")
+		os.Exit(1)
+	}
+
 	e := echo.New()
+	e.IPExtractor = network.ipExtractor()
+	e.Use(securityHeadersMiddleware)
+	e.Use(metricsMiddleware)
+	e.Use(traceMiddleware)
+	e.Use(tenantHostMiddleware)
 
 	// Register EVE corporate identity assets
 	web.RegisterAssets(e)
@@ -165,17 +411,160 @@ func main() {
 
 	// Register state endpoints
 	apiGroup := e.Group("/v1/api")
+	apiGroup.Use(allowlistMiddleware(network.api, "api"))
+	apiGroup.Use(bodyLimitMiddleware)
+	apiGroup.Use(decompressRequestMiddleware)
 	sm.RegisterRoutes(apiGroup)
 
-	// API Key middleware
-	apiKey := os.Getenv("TEMPLATE_API_KEY")
-	apiKeyMiddleware := evehttp.APIKeyMiddleware(apiKey)
+	// API Key middleware (sources with repeated failures are locked out)
+	apiKeyMiddleware := lockoutMiddleware(apiKeyAuthMiddleware)
+
+	// Administrative endpoints may be further restricted to internal networks
+	adminMiddleware := allowlistMiddleware(network.admin, "admin")
+
+	// Single sign-on users need a role mapped from their groups (see oidc.go),
+	// held over all namespaces on routes that are not about one template
+	viewerRole, editorRole, adminRole := requireRole(roleViewer), requireRole(roleEditor), requireRole(roleAdmin)
+	globalAdminRole := requireGlobalRole(roleAdmin)
+
+	// API keys limited to scopes may only call the matching endpoints (see apikeys.go)
+	renderScope, templatesScope, jobsScope, adminScope := requireScope(scopeRender), requireScope(scopeTemplates), requireScope(scopeJobs), requireScope(scopeAdmin)
+	readScope := requireScope(scopeRender, scopeTemplates)
+
+	// Callers with a tenant only see their own and shared templates (see tenants.go)
+	tenantTemplates := tenantTemplateMiddleware
 
 	// Semantic API endpoint (primary interface)
-	apiGroup.POST("/semantic/action", handleSemanticAction, apiKeyMiddleware)
+	apiGroup.POST("/semantic/action", handleSemanticAction, apiKeyMiddleware, renderScope)
+
+	// One template against many parameter rows
+	apiGroup.POST("/render/matrix", handleRenderMatrix, apiKeyMiddleware, renderScope)
+
+	// Projected cost of rendering a template for a dataset size (capacity planning)
+	apiGroup.POST("/estimate", handleEstimateRender, apiKeyMiddleware, renderScope)
+
+	// Usage of the caller and of every consumer, against their quotas
+	apiGroup.GET("/usage", handleGetUsage, apiKeyMiddleware, readScope)
+	apiGroup.GET("/usage/all", handleListUsage, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+	apiGroup.GET("/audit", handleAuditLog, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// Parameters referenced by a template (for form generation and pre-flight checks)
+	apiGroup.POST("/variables", handleExtractVariables, apiKeyMiddleware, renderScope)
+
+	// Asynchronous render jobs
+	apiGroup.POST("/jobs", handleCreateJob, apiKeyMiddleware, jobsScope)
+	apiGroup.GET("/jobs/dead", handleListDeadJobs, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+	apiGroup.GET("/jobs/:id", handleGetJob, apiKeyMiddleware, jobsScope)
+	apiGroup.GET("/jobs/:id/events", handleJobEvents, apiKeyMiddleware, jobsScope)
+	apiGroup.GET("/jobs/:id/result", handleGetJobResult, apiKeyMiddleware, jobsScope)
+	apiGroup.POST("/jobs/:id/redrive", handleRedriveJob, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+	apiGroup.POST("/jobs/:id/retry", handleRetryJob, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// Resumable uploads for large template and data files
+	apiGroup.POST("/uploads", handleCreateUpload, apiKeyMiddleware, readScope)
+	apiGroup.HEAD("/uploads/:id", handleUploadStatus, apiKeyMiddleware, readScope)
+	apiGroup.GET("/uploads/:id", handleUploadStatus, apiKeyMiddleware, readScope)
+	apiGroup.PATCH("/uploads/:id", handleUploadChunk, apiKeyMiddleware, readScope)
+	apiGroup.DELETE("/uploads/:id", handleDeleteUpload, apiKeyMiddleware, readScope)
+
+	// Templates embedded in the binary, rendered as builtin:<name> (see builtin.go)
+	apiGroup.GET("/builtin-templates", handleListBuiltinTemplates, apiKeyMiddleware, readScope)
+
+	// Named template store
+	apiGroup.GET("/templates", handleListTemplates, apiKeyMiddleware, readScope)
+	apiGroup.GET("/templates/:name", handleGetTemplate, apiKeyMiddleware, tenantTemplates, viewerRole, readScope)
+	apiGroup.POST("/templates/:name", handleCreateTemplate, apiKeyMiddleware, auditTemplateMiddleware(auditTemplateCreate), tenantTemplates, adminMiddleware, editorRole, templatesScope)
+	apiGroup.PUT("/templates/:name", handlePutTemplate, apiKeyMiddleware, auditTemplateMiddleware(auditTemplateUpdate), tenantTemplates, adminMiddleware, editorRole, templatesScope)
+	apiGroup.DELETE("/templates/:name", handleDeleteTemplate, apiKeyMiddleware, auditTemplateMiddleware(auditTemplateDelete), tenantTemplates, adminMiddleware, editorRole, templatesScope)
+	apiGroup.GET("/templates/:name/versions", handleListTemplateVersions, apiKeyMiddleware, tenantTemplates, viewerRole, readScope)
+	apiGroup.GET("/templates/:name/versions/:version", handleGetTemplateVersion, apiKeyMiddleware, tenantTemplates, viewerRole, readScope)
+	apiGroup.POST("/templates/:name/rollback", handleRollbackTemplate, apiKeyMiddleware, auditTemplateMiddleware(auditTemplateRollback), tenantTemplates, adminMiddleware, editorRole, templatesScope)
+	apiGroup.GET("/templates/:name/variables", handleTemplateVariables, apiKeyMiddleware, tenantTemplates, viewerRole, readScope)
+	apiGroup.POST("/templates/:name/import", handleImportTemplate, apiKeyMiddleware, auditTemplateMiddleware(auditTemplateImport), tenantTemplates, adminMiddleware, editorRole, templatesScope)
+	apiGroup.PUT("/templates/:name/versions/:version/quarantine", handleQuarantineTemplate, apiKeyMiddleware, tenantTemplates, adminMiddleware, adminRole, adminScope)
+	apiGroup.DELETE("/templates/:name/versions/:version/quarantine", handleReleaseTemplate, apiKeyMiddleware, tenantTemplates, adminMiddleware, adminRole, adminScope)
+	apiGroup.PUT("/templates/:name/hold", handleApplyLegalHold(holdTemplate), apiKeyMiddleware, tenantTemplates, adminMiddleware, adminRole, adminScope)
+	apiGroup.DELETE("/templates/:name/hold", handleReleaseLegalHold(holdTemplate), apiKeyMiddleware, tenantTemplates, adminMiddleware, adminRole, adminScope)
+	apiGroup.PUT("/templates/:name/versions/:version/hold", handleApplyLegalHold(holdTemplate), apiKeyMiddleware, tenantTemplates, adminMiddleware, adminRole, adminScope)
+	apiGroup.DELETE("/templates/:name/versions/:version/hold", handleReleaseLegalHold(holdTemplate), apiKeyMiddleware, tenantTemplates, adminMiddleware, adminRole, adminScope)
+
+	// Published templates available for import, here and in the central registry
+	apiGroup.GET("/marketplace", handleListMarketplace, apiKeyMiddleware, readScope)
+	apiGroup.GET("/marketplace/:name", handleGetMarketplaceTemplate, apiKeyMiddleware, readScope)
+
+	// Git template repository refresh (the webhook authenticates by signature)
+	apiGroup.POST("/git/sync", handleGitSync, apiKeyMiddleware, adminMiddleware, globalAdminRole, templatesScope)
+	apiGroup.POST("/git/webhook", handleGitWebhook)
+
+	// Bucket notifications that render uploaded objects (authenticated by token)
+	apiGroup.POST("/s3/events", handleS3Events)
+
+	// Template versions refused for failing renders
+	apiGroup.GET("/quarantine", handleListQuarantine, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// Legal holds on templates and results, and their audit trail
+	apiGroup.GET("/legal-holds", handleListLegalHolds, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+	apiGroup.GET("/legal-holds/audit", handleLegalHoldAudit, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// Built-in suite comparing the semantic and REST interfaces
+	apiGroup.GET("/conformance", handleConformance, apiKeyMiddleware, renderScope)
+
+	// Parsed-template cache metrics
+	apiGroup.GET("/cache/stats", handleCacheStats, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// Recent authentication failures and lockouts
+	apiGroup.GET("/security/events", handleSecurityEvents, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// Scratch workspace metrics
+	apiGroup.GET("/workspaces/stats", handleWorkspaceStats, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// SCIM-style provisioning of namespaces and API keys (admin over all namespaces)
+	provisioningGroup := apiGroup.Group("/provisioning", apiKeyMiddleware, adminMiddleware, requireGlobalRole(roleAdmin), adminScope)
+	provisioningGroup.GET("/namespaces", handleListNamespaces)
+	provisioningGroup.POST("/namespaces", handleCreateNamespace)
+	provisioningGroup.GET("/namespaces/:id", handleGetNamespace)
+	provisioningGroup.PATCH("/namespaces/:id", handlePatchNamespace)
+	provisioningGroup.DELETE("/namespaces/:id", handleDeleteNamespace)
+	provisioningGroup.GET("/keys", handleListKeys)
+	provisioningGroup.POST("/keys", handleCreateKey)
+	provisioningGroup.GET("/keys/:id", handleGetKey)
+	provisioningGroup.PATCH("/keys/:id", handlePatchKey)
+	provisioningGroup.DELETE("/keys/:id", handleDeleteKey)
+
+	// Tenant theme packs, exposed to templates as .Theme (admin over all namespaces)
+	themesGroup := apiGroup.Group("/themes", apiKeyMiddleware, adminMiddleware, requireGlobalRole(roleAdmin), adminScope)
+	themesGroup.GET("", handleListThemes)
+	themesGroup.GET("/:tenant", handleGetTheme)
+	themesGroup.PUT("/:tenant", handlePutTheme)
+	themesGroup.DELETE("/:tenant", handleDeleteTheme)
+
+	// Message catalogs behind {{t "key"}}, per tenant or shared as "default" (admin over all namespaces)
+	messagesGroup := apiGroup.Group("/messages", apiKeyMiddleware, adminMiddleware, requireGlobalRole(roleAdmin), adminScope)
+	messagesGroup.GET("", handleListMessageCatalogs)
+	messagesGroup.GET("/:tenant/:locale", handleGetMessageCatalog)
+	messagesGroup.PUT("/:tenant/:locale", handlePutMessageCatalog)
+	messagesGroup.DELETE("/:tenant/:locale", handleDeleteMessageCatalog)
+
+	// Persisted results (content-addressed by SHA-256)
+	apiGroup.GET("/results/:sha256", handleGetResult, apiKeyMiddleware, requireScope(scopeRender, scopeJobs))
+	apiGroup.DELETE("/results/:sha256", handleDeleteResult, apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+	apiGroup.PUT("/results/:sha256/hold", handleApplyLegalHold(holdResult), apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+	apiGroup.DELETE("/results/:sha256/hold", handleReleaseLegalHold(holdResult), apiKeyMiddleware, adminMiddleware, globalAdminRole, adminScope)
+
+	// Public verification key for signed output
+	apiGroup.GET("/signing-key", handleSigningKey)
 
 	// REST endpoints (convenience adapters that convert to semantic actions)
-	registerRESTEndpoints(apiGroup, apiKeyMiddleware)
+	registerRESTEndpoints(apiGroup, apiKeyMiddleware, renderScope)
+
+	// Prometheus metrics (restricted like administrative endpoints)
+	e.GET("/metrics", handleMetrics, allowlistMiddleware(network.admin, "admin"))
+
+	// Single sign-on (the callback authenticates by the provider's code)
+	e.GET("/auth/login", handleOIDCLogin)
+	e.GET("/auth/callback", handleOIDCCallback)
+	e.POST("/auth/logout", handleOIDCLogout)
+	apiGroup.GET("/auth/session", handleOIDCSession)
 
 	// EVE health check
 	e.GET("/health", evehttp.HealthCheckHandler("templateservice", "1.0.0"))
@@ -201,7 +590,7 @@ func main() {
 		ServiceURL:   serviceURL,
 		Directory:    "/home/opunix/templateservice",
 		Binary:       "templateservice",
-		Capabilities: []string{"template-rendering", "go-templates", "state-tracking"},
+		Capabilities: serviceCapabilities(),
 	}); err != nil {
 		logger.WithError(err).Error("Failed to register with registry")
 	}
@@ -209,27 +598,63 @@ func main() {
 	// Start server in goroutine
 	go func() {
 		logger.Infof("templateservice starting on port %s", port)
-		if err := e.Start(":" + port); err != nil {
+		if err := e.StartServer(&http.Server{Addr: ":" + port, TLSConfig: serverTLS}); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.WithError(err).Error("Server error")
 		}
 	}()
 
+	// gRPC rendering API on its own port (see grpc.go)
+	var grpcServer *http.Server
+	if grpcAddr != "" {
+		grpcServer = startGRPCServer(grpcAddr)
+	}
+
 	// Wait for interrupt signal for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	logger.Info("Shutting down server...")
+	// Drain: stop accepting connections and jobs, let in-flight requests and
+	// running jobs finish within TEMPLATE_SHUTDOWN_TIMEOUT, and only then
+	// leave the registry
+	drainTimeout := envDuration("TEMPLATE_SHUTDOWN_TIMEOUT", 30*time.Second)
+	logger.Infof("Shutting down server, draining for up to %s...", drainTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	close(stopJanitor)
+
+	var drained sync.WaitGroup
+	drained.Add(2)
+	go func() {
+		defer drained.Done()
+		jobs.shutdown(ctx)
+	}()
+	go func() {
+		defer drained.Done()
+		if err := e.Shutdown(ctx); err != nil {
+			logger.WithError(err).Error("Error during shutdown, closing remaining connections")
+			e.Close()
+		}
+	}()
+	if grpcServer != nil {
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			if err := grpcServer.Shutdown(ctx); err != nil {
+				logger.WithError(err).Error("Error during gRPC shutdown, closing remaining connections")
+				grpcServer.Close()
+			}
+		}()
+	}
+	drained.Wait()
+	if err := shutdownSpans(ctx); err != nil {
+		logger.WithError(err).Error("Failed to flush spans")
+	}
 
 	// Unregister from registry
 	if err := registry.AutoUnregister("templateservice"); err != nil {
 		logger.WithError(err).Error("Failed to unregister from registry")
 	}
 
-	// Shutdown server
-	if err := e.Close(); err != nil {
-		logger.WithError(err).Error("Error during shutdown")
-	}
-
 	logger.Info("Server stopped")
 }
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// maxRegistryResponseSize bounds responses read from the template registry
+const maxRegistryResponseSize = 4 << 20
+
+// localMarketplace is the source of templates published in this service
+const localMarketplace = "local"
+
+// templateProvenance records where an imported template came from
+type templateProvenance struct {
+	Source     string    `json:"source"`              // "local" or the registry URL
+	Template   string    `json:"template"`            // Name of the published template
+	Version    int       `json:"version"`             // Version that was imported
+	Namespace  string    `json:"namespace,omitempty"` // Namespace that published it
+	License    string    `json:"license,omitempty"`
+	SHA256     string    `json:"sha256"` // Of the imported text
+	ImportedAt time.Time `json:"importedAt"`
+	ImportedBy string    `json:"importedBy,omitempty"` // Principal of the importer
+}
+
+// marketplaceEntry describes a published template in listings
+type marketplaceEntry struct {
+	Name           string              `json:"name"`
+	Version        int                 `json:"version"`
+	Description    string              `json:"description,omitempty"`
+	Namespace      string              `json:"namespace,omitempty"`
+	License        string              `json:"license,omitempty"`
+	Owner          string              `json:"owner,omitempty"`
+	EncodingFormat string              `json:"encodingFormat,omitempty"`
+	UpdatedAt      time.Time           `json:"updatedAt"`
+	Source         string              `json:"source"`
+	Provenance     *templateProvenance `json:"provenance,omitempty"` // When itself imported
+}
+
+// marketplaceRegistry is the central template registry, another template
+// service whose marketplace is browsed and imported from
+var marketplaceRegistry struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// configureMarketplace reads the central registry settings from the environment
+func configureMarketplace() error {
+	registry := strings.TrimSuffix(os.Getenv("TEMPLATE_MARKETPLACE_REGISTRY"), "/")
+	if registry != "" {
+		if u, err := url.Parse(registry); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("TEMPLATE_MARKETPLACE_REGISTRY: expected an http(s) URL, got %q", registry)
+		}
+		logger.Infof("Template marketplace registry at %s", registry)
+	}
+	marketplaceRegistry.url = registry
+	marketplaceRegistry.apiKey = os.Getenv("TEMPLATE_MARKETPLACE_REGISTRY_KEY")
+	marketplaceRegistry.client = &http.Client{Timeout: envDuration("TEMPLATE_MARKETPLACE_TIMEOUT", 30*time.Second)}
+	return nil
+}
+
+// newMarketplaceEntry describes a local published template
+func newMarketplaceEntry(tmpl *storedTemplate) marketplaceEntry {
+	return marketplaceEntry{
+		Name:           tmpl.Name,
+		Version:        tmpl.Version,
+		Description:    tmpl.Description,
+		Namespace:      provisioning.namespaceOf(tmpl.Name),
+		License:        tmpl.License,
+		Owner:          tmpl.Owner,
+		EncodingFormat: tmpl.EncodingFormat,
+		UpdatedAt:      tmpl.UpdatedAt,
+		Source:         localMarketplace,
+		Provenance:     tmpl.Provenance,
+	}
+}
+
+// marketplaceMatches reports whether an entry matches the q (substring of
+// name or description) and namespace filters
+func marketplaceMatches(entry marketplaceEntry, q, namespace string) bool {
+	if namespace != "" && entry.Namespace != namespace {
+		return false
+	}
+	q = strings.ToLower(q)
+	return q == "" || strings.Contains(strings.ToLower(entry.Name), q) || strings.Contains(strings.ToLower(entry.Description), q)
+}
+
+// publishedTemplate returns a published template, or errTemplateNotFound for
+// unpublished templates and those restricted to other callers
+func publishedTemplate(ctx context.Context, name string, version int) (*storedTemplate, error) {
+	current, err := templateStore.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !current.Published || !callerAllowed(renderCallerFrom(ctx).Principal, current.AllowedCallers) {
+		return nil, errTemplateNotFound
+	}
+	if version == 0 || version == current.Version {
+		return current, nil
+	}
+	return templateStore.getVersion(name, version)
+}
+
+// registryGet fetches path from the central registry and decodes the JSON response
+func registryGet(ctx context.Context, path string, query url.Values, v interface{}) error {
+	if marketplaceRegistry.url == "" {
+		return &render.Error{Message: "no template registry is configured", Status: http.StatusNotFound}
+	}
+	target := marketplaceRegistry.url + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", echo.MIMEApplicationJSON)
+	if marketplaceRegistry.apiKey != "" {
+		req.Header.Set("X-API-Key", marketplaceRegistry.apiKey)
+	}
+	injectTraceContext(ctx, req.Header)
+
+	resp, err := marketplaceRegistry.client.Do(req)
+	if err != nil {
+		return &render.Error{Message: "template registry unavailable", Status: http.StatusBadGateway, Err: err}
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRegistryResponseSize+1))
+	if err != nil {
+		return &render.Error{Message: "template registry unavailable", Status: http.StatusBadGateway, Err: err}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errTemplateNotFound
+	case resp.StatusCode != http.StatusOK:
+		return &render.Error{Message: fmt.Sprintf("template registry returned status %d", resp.StatusCode), Status: http.StatusBadGateway}
+	case len(data) > maxRegistryResponseSize:
+		return &render.Error{Message: fmt.Sprintf("template registry response exceeds %d bytes", maxRegistryResponseSize), Status: http.StatusBadGateway}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return &render.Error{Message: "invalid template registry response", Status: http.StatusBadGateway, Err: err}
+	}
+	return nil
+}
+
+// handleListMarketplace handles GET /v1/api/marketplace, listing published
+// templates filtered by ?q= and ?namespace=, or with ?source=registry those
+// of the central registry
+func handleListMarketplace(c echo.Context) error {
+	q, namespace := c.QueryParam("q"), c.QueryParam("namespace")
+	if c.QueryParam("source") == "registry" {
+		var listing struct {
+			Templates []marketplaceEntry `json:"templates"`
+		}
+		if err := registryGet(c.Request().Context(), "/v1/api/marketplace", url.Values{"q": {q}, "namespace": {namespace}}, &listing); err != nil {
+			return renderErrorJSON(c, err)
+		}
+		for i := range listing.Templates {
+			listing.Templates[i].Source = marketplaceRegistry.url
+		}
+		if listing.Templates == nil {
+			listing.Templates = []marketplaceEntry{}
+		}
+		return c.JSON(http.StatusOK, listing)
+	}
+
+	list, err := templateStore.list()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	principal := renderCallerFrom(c.Request().Context()).Principal
+	entries := []marketplaceEntry{}
+	for _, tmpl := range list {
+		if !tmpl.Published || !callerAllowed(principal, tmpl.AllowedCallers) {
+			continue
+		}
+		if entry := newMarketplaceEntry(tmpl); marketplaceMatches(entry, q, namespace) {
+			entries = append(entries, entry)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"templates": entries})
+}
+
+// handleGetMarketplaceTemplate handles GET /v1/api/marketplace/:name
+// (?version=N), returning a published template with its text
+func handleGetMarketplaceTemplate(c echo.Context) error {
+	version, _ := strconv.Atoi(c.QueryParam("version"))
+	tmpl, err := publishedTemplate(c.Request().Context(), c.Param("name"), version)
+	if errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"template":  tmpl,
+		"namespace": provisioning.namespaceOf(tmpl.Name),
+	})
+}
+
+// importRequest is the body of POST /v1/api/templates/:name/import
+type importRequest struct {
+	From      string `json:"from"`                // Published template name
+	Version   int    `json:"version,omitempty"`   // Default latest
+	Source    string `json:"source,omitempty"`    // "local" (default) or "registry"
+	Overwrite bool   `json:"overwrite,omitempty"` // Add a version to an existing template
+}
+
+// fetchPublishedTemplate loads the template an import names, with the
+// namespace and source it was published in
+func fetchPublishedTemplate(ctx context.Context, req importRequest) (*storedTemplate, string, string, error) {
+	if req.Source == "registry" {
+		var published struct {
+			Template  *storedTemplate `json:"template"`
+			Namespace string          `json:"namespace"`
+		}
+		query := url.Values{}
+		if req.Version > 0 {
+			query.Set("version", strconv.Itoa(req.Version))
+		}
+		if err := registryGet(ctx, "/v1/api/marketplace/"+url.PathEscape(req.From), query, &published); err != nil {
+			return nil, "", "", err
+		}
+		if published.Template == nil || published.Template.Text == "" {
+			return nil, "", "", &render.Error{Message: "invalid template registry response", Status: http.StatusBadGateway}
+		}
+		return published.Template, published.Namespace, marketplaceRegistry.url, nil
+	}
+	tmpl, err := publishedTemplate(ctx, req.From, req.Version)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return tmpl, provisioning.namespaceOf(tmpl.Name), localMarketplace, nil
+}
+
+// handleImportTemplate handles POST /v1/api/templates/:name/import, copying
+// a published template (local or from the registry) into the store under
+// :name with its provenance and license. Trust, caller restrictions,
+// publication and the layout are not carried over.
+func handleImportTemplate(c echo.Context) error {
+	name := c.Param("name")
+	if !validTemplateName(name) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid template name"})
+	}
+	var req importRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+	if !validTemplateName(req.From) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must name a published template"})
+	}
+	if req.Source != "" && req.Source != localMarketplace && req.Source != "registry" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": `source must be "local" or "registry"`})
+	}
+
+	existing, err := templateStore.get(name)
+	if err != nil && !errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if existing != nil && !req.Overwrite {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "template already exists"})
+	}
+
+	ctx := c.Request().Context()
+	if existing == nil {
+		if err := checkTenantQuota(ctx); err != nil {
+			return renderErrorJSON(c, err)
+		}
+	}
+	source, namespace, origin, err := fetchPublishedTemplate(ctx, req)
+	if errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "published template not found"})
+	}
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+
+	input := &templateInput{
+		Description:     source.Description,
+		Text:            source.Text,
+		EncodingFormat:  source.EncodingFormat,
+		Delimiters:      source.Delimiters,
+		MissingKey:      source.MissingKey,
+		MissingKeyValue: source.MissingKeyValue,
+		Engine:          source.Engine,
+		Suppress:        source.Suppress,
+		Partials:        source.Partials,
+		License:         source.License,
+	}
+	if err := parseTemplateInput(name, input); err != nil {
+		return renderErrorJSON(c, err)
+	}
+	input.provenance = &templateProvenance{
+		Source:     origin,
+		Template:   source.Name,
+		Version:    source.Version,
+		Namespace:  namespace,
+		License:    source.License,
+		SHA256:     outputChecksum(source.Text),
+		ImportedAt: time.Now().UTC(),
+		ImportedBy: renderCallerFrom(ctx).Principal,
+	}
+	input.tenant = renderCallerFrom(ctx).Tenant
+	if err := usage.checkStorage(ctx, name, templateBytes(input.Text, input.Partials)); err != nil {
+		return renderErrorJSON(c, err)
+	}
+
+	tmpl, err := saveTemplate(name, input, existing)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	logger.Info(fmt.Sprintf("Imported template %s version %d from %s as %s", source.Name, source.Version, origin, name))
+	if existing == nil {
+		return c.JSON(http.StatusCreated, tmpl)
+	}
+	return c.JSON(http.StatusOK, tmpl)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func withMarketplaceRegistry(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	previous := marketplaceRegistry
+	t.Cleanup(func() { marketplaceRegistry = previous })
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	marketplaceRegistry.url = server.URL
+	marketplaceRegistry.apiKey = "registry-key"
+	marketplaceRegistry.client = &http.Client{Timeout: 5 * time.Second}
+	return server.URL
+}
+
+func marketplaceServer() *echo.Echo {
+	e := echo.New()
+	e.GET("/v1/api/marketplace", handleListMarketplace)
+	e.GET("/v1/api/marketplace/:name", handleGetMarketplaceTemplate)
+	e.POST("/v1/api/templates/:name/import", handleImportTemplate)
+	return e
+}
+
+func marketplaceCall(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMarketplaceImport(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	withProvisioning(t, "").namespaces["acme"] = &provisionedNamespace{ID: "acme", Templates: "acme-*", Active: true}
+	for _, tmpl := range []*storedTemplate{
+		{Name: "acme-invoice", Text: "Invoice {{.Number}}", Description: "Standard invoice", Published: true, License: "Apache-2.0"},
+		{Name: "acme-letter", Text: "Dear {{.Name}}", Published: true, AllowedCallers: []string{"tsk_acme"}},
+		{Name: "acme-internal", Text: "secret"},
+	} {
+		if err := templateStore.put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := marketplaceServer()
+
+	var listing struct{ Templates []marketplaceEntry }
+	rec := marketplaceCall(e, http.MethodGet, "/v1/api/marketplace", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil || len(listing.Templates) != 1 {
+		t.Fatalf("Expected only the unrestricted published template, got %s", rec.Body)
+	}
+	if entry := listing.Templates[0]; entry.Name != "acme-invoice" || entry.Namespace != "acme" || entry.License != "Apache-2.0" || entry.Source != localMarketplace {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	for _, query := range []string{"?q=letter", "?namespace=globex"} {
+		rec := marketplaceCall(e, http.MethodGet, "/v1/api/marketplace"+query, "")
+		if strings.Contains(rec.Body.String(), "acme-invoice") {
+			t.Errorf("%s: expected acme-invoice to be filtered out", query)
+		}
+	}
+	if rec := marketplaceCall(e, http.MethodGet, "/v1/api/marketplace/acme-internal", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected unpublished templates to be hidden, got %d", rec.Code)
+	}
+
+	rec = marketplaceCall(e, http.MethodPost, "/v1/api/templates/globex-invoice/import", `{"from": "acme-invoice"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Import = %d %s", rec.Code, rec.Body)
+	}
+	imported, err := templateStore.get("globex-invoice")
+	if err != nil || imported.Text != "Invoice {{.Number}}" || imported.License != "Apache-2.0" || imported.Published {
+		t.Fatalf("Unexpected imported template %+v (%v)", imported, err)
+	}
+	if p := imported.Provenance; p == nil || p.Source != localMarketplace || p.Template != "acme-invoice" || p.Version != 1 || p.Namespace != "acme" || p.SHA256 != outputChecksum(imported.Text) {
+		t.Errorf("Unexpected provenance %+v", p)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"existing target", `{"from": "acme-invoice"}`, http.StatusConflict},
+		{"overwrite", `{"from": "acme-invoice", "overwrite": true}`, http.StatusOK},
+		{"unpublished", `{"from": "acme-internal", "overwrite": true}`, http.StatusNotFound},
+		{"restricted", `{"from": "acme-letter", "overwrite": true}`, http.StatusNotFound},
+		{"unknown source", `{"from": "acme-invoice", "source": "ftp"}`, http.StatusBadRequest},
+		{"no registry", `{"from": "acme-invoice", "source": "registry", "overwrite": true}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := marketplaceCall(e, http.MethodPost, "/v1/api/templates/globex-invoice/import", tt.body); rec.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestMarketplaceRegistry(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	withProvisioning(t, "")
+	registry := withMarketplaceRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "registry-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/api/marketplace":
+			_, _ = w.Write([]byte(`{"templates": [{"name": "eve-receipt", "version": 3, "license": "MIT", "source": "local"}]}`))
+		case "/v1/api/marketplace/eve-receipt":
+			if r.URL.Query().Get("version") != "3" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"template": {"name": "eve-receipt", "version": 3, "text": "Receipt {{.Total}}", "license": "MIT", "trusted": true}, "namespace": "eve"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	e := marketplaceServer()
+
+	rec := marketplaceCall(e, http.MethodGet, "/v1/api/marketplace?source=registry", "")
+	var listing struct{ Templates []marketplaceEntry }
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil || len(listing.Templates) != 1 || listing.Templates[0].Source != registry {
+		t.Fatalf("Unexpected registry listing %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := marketplaceCall(e, http.MethodPost, "/v1/api/templates/receipt/import", `{"from": "eve-receipt", "source": "registry"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a version the registry does not have, got %d", rec.Code)
+	}
+	rec = marketplaceCall(e, http.MethodPost, "/v1/api/templates/receipt/import", `{"from": "eve-receipt", "version": 3, "source": "registry"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Import = %d %s", rec.Code, rec.Body)
+	}
+	imported, _ := templateStore.get("receipt")
+	if imported.Trusted || imported.Provenance == nil || imported.Provenance.Source != registry || imported.Provenance.Namespace != "eve" || imported.Provenance.Version != 3 {
+		t.Errorf("Unexpected registry import %+v", imported)
+	}
+}
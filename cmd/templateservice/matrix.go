@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// mimeNDJSON is the content type of newline-delimited JSON
+const mimeNDJSON = "application/x-ndjson"
+
+// maxMatrixRows bounds buffered (non-streamed) matrix responses
+var maxMatrixRows = 10000
+
+// configureRenderMatrix reads the matrix limits from the environment
+func configureRenderMatrix() {
+	maxMatrixRows = envInt("TEMPLATE_MATRIX_MAX_ROWS", 10000)
+}
+
+// matrixRequest is the body of POST /v1/api/render/matrix: one template and
+// many parameter rows. Each row is merged over the shared parameters.
+type matrixRequest struct {
+	RenderRequest
+	Rows       []map[string]interface{} `json:"rows,omitempty"`
+	RowsUpload string                   `json:"rowsUpload,omitempty"` // Upload ID of a JSON array or NDJSON file of rows
+	Stream     bool                     `json:"stream,omitempty"`     // Stream results as NDJSON
+}
+
+// matrixResponse is the buffered matrix result
+type matrixResponse struct {
+	Count     int             `json:"count"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Results   []jobItemResult `json:"results"`
+}
+
+// handleRenderMatrix handles POST /v1/api/render/matrix. Results are streamed
+// as one NDJSON line per row when requested ("stream": true or
+// Accept: application/x-ndjson), which keeps memory bounded for large inputs.
+func handleRenderMatrix(c echo.Context) error {
+	var req matrixRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+	if req.Template == "" && req.TemplateID == "" && req.TemplateName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "template, templateId or templateName is required"})
+	}
+	if len(req.Rows) == 0 && req.RowsUpload == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rows or rowsUpload is required"})
+	}
+
+	if req.EffectiveDate == "" {
+		// All rows render the same stored version, even across a scheduled change
+		req.EffectiveDate = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	rows, closeRows, err := matrixRows(c.Request().Context(), req)
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+	defer closeRows()
+
+	ctx := c.Request().Context()
+	stream := req.Stream || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), mimeNDJSON)
+	if stream {
+		return streamMatrix(ctx, c, req, rows)
+	}
+
+	response := matrixResponse{Results: []jobItemResult{}}
+	for index := 0; ; index++ {
+		row, err := rows()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("row %d: %v", index, err)})
+		}
+		if index >= maxMatrixRows {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("more than %d rows, use streaming", maxMatrixRows)})
+		}
+
+		result := renderMatrixRow(ctx, req, index, row)
+		if result.Status == itemCompleted {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+	response.Count = len(response.Results)
+	return c.JSON(http.StatusOK, response)
+}
+
+// streamMatrix writes one NDJSON line per row as soon as it is rendered
+func streamMatrix(ctx context.Context, c echo.Context, req matrixRequest, rows func() (map[string]interface{}, error)) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, mimeNDJSON)
+	res.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(res)
+	for index := 0; ctx.Err() == nil; index++ {
+		row, err := rows()
+		if err == io.EOF {
+			return nil
+		}
+		result := jobItemResult{Index: index, Status: itemFailed}
+		if err != nil {
+			// Malformed input ends the stream; the last line reports why
+			result.Error = fmt.Sprintf("invalid row: %v", err)
+			return enc.Encode(result)
+		}
+		result = renderMatrixRow(ctx, req, index, row)
+		if err := enc.Encode(result); err != nil {
+			return nil
+		}
+		res.Flush()
+	}
+	return nil
+}
+
+// renderMatrixRow renders the template for a single row
+func renderMatrixRow(ctx context.Context, req matrixRequest, index int, row map[string]interface{}) jobItemResult {
+	parameters := make(map[string]interface{}, len(req.Parameters)+len(row))
+	for key, value := range req.Parameters {
+		parameters[key] = value
+	}
+	for key, value := range row {
+		parameters[key] = value
+	}
+
+	return executeJobItem(ctx, index, TemplateRequest{
+		Text:               req.Template,
+		Identifier:         req.TemplateID,
+		TemplateName:       req.TemplateName,
+		TemplateParameters: parameters,
+		Assertions:         req.Assertions,
+		Suppress:           req.Suppress,
+		Delimiters:         req.Delimiters,
+		MissingKey:         req.MissingKey,
+		MissingKeyValue:    req.MissingKeyValue,
+		TemplateVersion:    req.TemplateVersion,
+		EffectiveDate:      req.EffectiveDate,
+		ParametersUpload:   req.ParametersUpload,
+		Partials:           req.Partials,
+		Layout:             req.Layout,
+		Engine:             req.Engine,
+		ConvertTo:          req.ConvertTo,
+		Debug:              req.Debug,
+		Locale:             req.Locale,
+	})
+}
+
+// matrixRows returns an iterator over the request rows, yielding io.EOF at
+// the end. Uploaded rows are decoded incrementally from a JSON array or NDJSON.
+func matrixRows(ctx context.Context, req matrixRequest) (func() (map[string]interface{}, error), func(), error) {
+	if req.RowsUpload == "" {
+		i := 0
+		return func() (map[string]interface{}, error) {
+			if i >= len(req.Rows) {
+				return nil, io.EOF
+			}
+			i++
+			return req.Rows[i-1], nil
+		}, func() {}, nil
+	}
+
+	path, err := resolveUploadRef(ctx, uploadRefPrefix+strings.TrimPrefix(req.RowsUpload, uploadRefPrefix))
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, &render.Error{Message: "failed to open uploaded rows", Status: http.StatusInternalServerError, Err: err}
+	}
+
+	reader := bufio.NewReader(f)
+	dec := json.NewDecoder(reader)
+	if first, err := firstNonSpace(reader); err == nil && first == '[' {
+		if _, err := dec.Token(); err != nil {
+			f.Close()
+			return nil, nil, &render.Error{Message: "invalid uploaded rows", Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	next := func() (map[string]interface{}, error) {
+		if !dec.More() {
+			return nil, io.EOF
+		}
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			return nil, err
+		}
+		return row, nil
+	}
+	return next, func() { f.Close() }, nil
+}
+
+// firstNonSpace peeks at the first non-whitespace byte without consuming it
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		r.ReadByte()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func callMatrix(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render/matrix", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handleRenderMatrix(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handleRenderMatrix() returned error: %v", err)
+	}
+	return rec
+}
+
+func TestHandleRenderMatrix(t *testing.T) {
+	rec := callMatrix(t, `{
+		"template": "{{.Greeting}} {{.Name}}",
+		"parameters": {"Greeting": "Hello"},
+		"rows": [{"Name": "Alice"}, {"Name": "Bob", "Greeting": "Hi"}],
+		"missingKey": "error"
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var response matrixResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Count != 2 || response.Succeeded != 2 {
+		t.Fatalf("Unexpected summary: %+v", response)
+	}
+	if response.Results[0].Output != "Hello Alice" || response.Results[1].Output != "Hi Bob" {
+		t.Errorf("Unexpected outputs: %+v", response.Results)
+	}
+}
+
+func TestHandleRenderMatrix_StreamsUploadedRows(t *testing.T) {
+	previous := uploads
+	m, _ := newUploadManager(t.TempDir(), 1<<20, time.Hour)
+	uploads = m
+	defer func() { uploads = previous }()
+
+	rows := "{\"Name\": \"Alice\"}\n{\"Name\": \"Bob\"}\n{}\n"
+	info, _ := m.create(int64(len(rows)), "rows.ndjson", renderCaller{})
+	if _, err := m.writeChunk(info.ID, 0, strings.NewReader(rows)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := callMatrix(t, `{"template": "Dear {{.Name}}", "missingKey": "error", "rowsUpload": "`+info.ID+`", "stream": true}`)
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != mimeNDJSON {
+		t.Errorf("Expected NDJSON content type, got %q", ct)
+	}
+
+	var lines []jobItemResult
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var line jobItemResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+	if lines[1].Output != "Dear Bob" || lines[2].Status != itemFailed {
+		t.Errorf("Unexpected lines: %+v", lines)
+	}
+}
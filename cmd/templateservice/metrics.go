@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"templateservice/pkg/render"
+)
+
+// Render stages reported by render.Error.Stage and the failure counter
+const (
+	stageParse       = "parse"
+	stageExecute     = "execute"
+	stageTimeout     = "timeout"
+	stageOutputLimit = "output_limit"
+	stageSandbox     = "sandbox_limit"
+	stageOther       = "other" // Resolution, policy, hooks, assertions
+)
+
+// Service metrics
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "templateservice_http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+	rendersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "templateservice_renders_total",
+		Help: "Renders by outcome (success, suppressed or error).",
+	}, []string{"outcome"})
+	renderFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "templateservice_render_failures_total",
+		Help: "Failed renders by the stage that failed.",
+	}, []string{"stage"})
+	renderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "templateservice_render_duration_seconds",
+		Help:    "Render latency, from template resolution to the finished result.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"outcome"})
+	renderOutputBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "templateservice_render_output_bytes",
+		Help:    "Size of successfully rendered output.",
+		Buckets: []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20},
+	})
+	tenantRendersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "templateservice_tenant_renders_total",
+		Help: "Renders of callers with a tenant by tenant and outcome.",
+	}, []string{"tenant", "outcome"})
+	tenantRenderOutputBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "templateservice_tenant_render_output_bytes_total",
+		Help: "Output rendered for callers with a tenant, by tenant.",
+	}, []string{"tenant"})
+)
+
+// metricsRegistry holds the metrics served at /metrics, together with the
+// Go runtime and process metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+// metricsHandler serves the registry in the format the scraper accepts
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+func init() {
+	metricsRegistry.MustRegister(
+		httpRequestsTotal, rendersTotal, renderFailuresTotal, renderDuration, renderOutputBytes,
+		tenantRendersTotal, tenantRenderOutputBytes,
+		templateCacheCollector{},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// metricsToken, when set, must be presented as a bearer token to scrape /metrics
+var metricsToken string
+
+// configureMetrics loads the scrape token from TEMPLATE_METRICS_TOKEN
+func configureMetrics() {
+	metricsToken = os.Getenv("TEMPLATE_METRICS_TOKEN")
+}
+
+// metricsMiddleware counts requests by route and status code
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		status := c.Response().Status
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+		} else if err != nil && !c.Response().Committed {
+			status = http.StatusInternalServerError
+		}
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestsTotal.WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).Inc()
+		return err
+	}
+}
+
+// observeRender records the outcome, latency and output size of a render,
+// also by the calling tenant when there is one
+func observeRender(tenant string, elapsed time.Duration, result *renderResult, err error) {
+	if err != nil {
+		stage := stageOther
+		var re *render.Error
+		if errors.As(err, &re) && re.Stage != "" {
+			stage = re.Stage
+		}
+		rendersTotal.WithLabelValues("error").Inc()
+		if tenant != "" {
+			tenantRendersTotal.WithLabelValues(tenant, "error").Inc()
+		}
+		renderFailuresTotal.WithLabelValues(stage).Inc()
+		renderDuration.WithLabelValues("error").Observe(elapsed.Seconds())
+		return
+	}
+	outcome := "success"
+	if result.Suppressed {
+		outcome = "suppressed"
+	}
+	rendersTotal.WithLabelValues(outcome).Inc()
+	renderDuration.WithLabelValues("success").Observe(elapsed.Seconds())
+	size := int64(len(result.Output))
+	if result.StreamedBytes > 0 {
+		size = result.StreamedBytes
+	}
+	renderOutputBytes.Observe(float64(size))
+	if tenant != "" {
+		tenantRendersTotal.WithLabelValues(tenant, outcome).Inc()
+		tenantRenderOutputBytes.WithLabelValues(tenant).Add(float64(size))
+	}
+}
+
+// executionStage classifies an execution error
+func executionStage(err error) string {
+	switch {
+	case errors.Is(err, render.ErrTimeout):
+		return stageTimeout
+	case errors.Is(err, render.ErrOutputTooLarge):
+		return stageOutputLimit
+	}
+	return stageExecute
+}
+
+// withStage records the stage of a render error that has none yet
+func withStage(err error, stage string) error {
+	var re *render.Error
+	if errors.As(err, &re) && re.Stage == "" {
+		re.Stage = stage
+	}
+	return err
+}
+
+// handleMetrics serves GET /metrics in the Prometheus exposition format
+func handleMetrics(c echo.Context) error {
+	if metricsToken != "" {
+		token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) != 1 {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid metrics token"})
+		}
+	}
+	metricsHandler.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// templateCacheCollector exposes the parsed-template cache statistics
+type templateCacheCollector struct{}
+
+var (
+	cacheHitsDesc = prometheus.NewDesc("templateservice_template_cache_hits_total",
+		"Parsed-template cache hits.", nil, nil)
+	cacheMissesDesc = prometheus.NewDesc("templateservice_template_cache_misses_total",
+		"Parsed-template cache misses, including expired entries.", nil, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("templateservice_template_cache_evictions_total",
+		"Entries evicted from the full cache.", nil, nil)
+	cacheExpiredDesc = prometheus.NewDesc("templateservice_template_cache_expired_total",
+		"Entries dropped for exceeding the TTL.", nil, nil)
+	cacheEntriesDesc = prometheus.NewDesc("templateservice_template_cache_entries",
+		"Parsed templates currently cached.", nil, nil)
+	cacheCapacityDesc = prometheus.NewDesc("templateservice_template_cache_capacity",
+		"Maximum number of cached templates.", nil, nil)
+)
+
+func (templateCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{cacheHitsDesc, cacheMissesDesc, cacheEvictionsDesc, cacheExpiredDesc, cacheEntriesDesc, cacheCapacityDesc} {
+		ch <- desc
+	}
+}
+
+func (templateCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	if templateCache == nil {
+		return
+	}
+	stats := templateCache.snapshot()
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(cacheExpiredDesc, prometheus.CounterValue, float64(stats.Expired))
+	ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Size))
+	ch <- prometheus.MustNewConstMetric(cacheCapacityDesc, prometheus.GaugeValue, float64(stats.Capacity))
+}
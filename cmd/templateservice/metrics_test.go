@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue reads a counter or histogram observation count
+func counterValue(c prometheus.Collector, labels ...string) float64 {
+	var m dto.Metric
+	var metric prometheus.Metric
+	switch v := c.(type) {
+	case *prometheus.CounterVec:
+		metric = v.WithLabelValues(labels...)
+	case *prometheus.HistogramVec:
+		metric = v.WithLabelValues(labels...).(prometheus.Metric)
+	case prometheus.Metric:
+		metric = v
+	}
+	if err := metric.Write(&m); err != nil {
+		return 0
+	}
+	if h := m.GetHistogram(); h != nil {
+		return float64(h.GetSampleCount())
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestRenderMetrics(t *testing.T) {
+	successes := counterValue(rendersTotal, "success")
+	parseFailures := counterValue(renderFailuresTotal, stageParse)
+	executeFailures := counterValue(renderFailuresTotal, stageExecute)
+	sizes := counterValue(renderOutputBytes)
+
+	ctx := context.Background()
+	if _, err := renderTemplate(ctx, renderRequest{Text: "Hello {{.name}}", Parameters: map[string]interface{}{"name": "Ada"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = renderTemplate(ctx, renderRequest{Text: "{{.name"})
+	_, _ = renderTemplate(ctx, renderRequest{Text: "{{.a.b}}", MissingKey: "error"})
+
+	if got := counterValue(rendersTotal, "success") - successes; got != 1 {
+		t.Errorf("Expected 1 successful render, got %v", got)
+	}
+	if got := counterValue(renderFailuresTotal, stageParse) - parseFailures; got != 1 {
+		t.Errorf("Expected 1 parse failure, got %v", got)
+	}
+	if got := counterValue(renderFailuresTotal, stageExecute) - executeFailures; got != 1 {
+		t.Errorf("Expected 1 execute failure, got %v", got)
+	}
+	if got := counterValue(renderOutputBytes) - sizes; got != 1 {
+		t.Errorf("Expected 1 output size observation, got %v", got)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	previousCache, previousToken := templateCache, metricsToken
+	t.Cleanup(func() { templateCache, metricsToken = previousCache, previousToken })
+	templateCache = newTemplateCache(8, 0)
+	metricsToken = "scrape"
+	observeRender("", 3*time.Millisecond, &renderResult{Output: "Hello"}, nil)
+
+	e := echo.New()
+	e.Use(metricsMiddleware)
+	e.GET("/metrics", handleMetrics)
+	e.GET("/fail", func(c echo.Context) error { return echo.NewHTTPError(http.StatusTeapot) })
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	for _, expected := range []string{
+		`templateservice_http_requests_total{code="418",method="GET",route="/fail"} `,
+		`templateservice_http_requests_total{code="401",method="GET",route="/metrics"} `,
+		"# TYPE templateservice_render_duration_seconds histogram",
+		`templateservice_render_duration_seconds_bucket{outcome="success",le="0.005"} `,
+		`templateservice_render_output_bytes_bucket{le="256"} `,
+		"# TYPE go_goroutines gauge",
+		"templateservice_template_cache_capacity 8",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in metrics:\n%s", expected, body)
+		}
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %q", rec.Header().Get("Content-Type"))
+	}
+}
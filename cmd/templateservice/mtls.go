@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+)
+
+// clientCertContextKey holds the identity of the client certificate that
+// authenticated a request
+const clientCertContextKey = "clientCert"
+
+// clientCertAuth verifies client certificates against a CA. Identities are
+// mapped to role grants like single sign-on groups; without a mapping,
+// certificate holders have full access like configured API keys.
+type clientCertAuth struct {
+	required bool // Every connection must present a certificate
+	mapping  []roleGrant
+}
+
+// serverTLS is nil when the service serves plain HTTP; clientCerts is nil
+// unless client certificates are verified
+var (
+	serverTLS   *tls.Config
+	clientCerts *clientCertAuth
+)
+
+// configureTLS loads the server certificate (TEMPLATE_TLS_CERT and
+// TEMPLATE_TLS_KEY) and, with TEMPLATE_TLS_CLIENT_CA, the CAs client
+// certificates must chain to. TEMPLATE_TLS_CLIENT_AUTH=optional accepts
+// connections without a certificate, which then authenticate otherwise.
+func configureTLS() error {
+	serverTLS, clientCerts = nil, nil
+	certFile, keyFile, caFile := os.Getenv("TEMPLATE_TLS_CERT"), os.Getenv("TEMPLATE_TLS_KEY"), os.Getenv("TEMPLATE_TLS_CLIENT_CA")
+	if certFile == "" && keyFile == "" {
+		if caFile != "" {
+			return errors.New("TEMPLATE_TLS_CLIENT_CA requires TEMPLATE_TLS_CERT and TEMPLATE_TLS_KEY")
+		}
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("TEMPLATE_TLS_CERT/TEMPLATE_TLS_KEY: %w", err)
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("TEMPLATE_TLS_CLIENT_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("TEMPLATE_TLS_CLIENT_CA: no certificates in %s", caFile)
+		}
+		mapping, err := parseRoleMapping("TEMPLATE_TLS_CLIENT_ROLE_MAPPING", envList("TEMPLATE_TLS_CLIENT_ROLE_MAPPING"))
+		if err != nil {
+			return err
+		}
+		auth := &clientCertAuth{required: true, mapping: mapping}
+		switch mode := os.Getenv("TEMPLATE_TLS_CLIENT_AUTH"); mode {
+		case "", "require":
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			auth.required = false
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return fmt.Errorf("TEMPLATE_TLS_CLIENT_AUTH: expected require or optional, got %q", mode)
+		}
+		config.ClientCAs = pool
+		clientCerts = auth
+	}
+	serverTLS = config
+	if clientCerts != nil {
+		logger.Infof("Serving TLS with client certificates (required: %t, %d identity mappings)", clientCerts.required, len(clientCerts.mapping))
+	} else {
+		logger.Info("Serving TLS")
+	}
+	return nil
+}
+
+// clientCertIdentity returns the identity of the request's verified client
+// certificate: its first URI SAN (such as a SPIFFE ID), DNS name, email
+// address or, failing those, its subject common name
+func clientCertIdentity(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String(), true
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0], true
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0], true
+	}
+	return cert.Subject.CommonName, cert.Subject.CommonName != ""
+}
+
+// certAuthenticated continues the chain for a client with a verified
+// certificate, as the caller "mtls:" + identity
+func certAuthenticated(c echo.Context, next echo.HandlerFunc, identity string) error {
+	if len(clientCerts.mapping) > 0 {
+		var grants []roleGrant
+		for _, grant := range clientCerts.mapping {
+			if grant.Group == identity {
+				grants = append(grants, grant)
+			}
+		}
+		if len(grants) == 0 {
+			logger.Info(fmt.Sprintf("Refused client certificate %s from %s: no role is mapped to it", identity, c.RealIP()))
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "the client certificate grants no access to this service"})
+		}
+		c.Set(roleGrantsContextKey, grants)
+	}
+	c.Set(clientCertContextKey, identity)
+	return authenticated(c, next, "mtls:"+identity)
+}
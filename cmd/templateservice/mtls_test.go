@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// testCertificate issues a certificate from parent (self-signed when nil)
+func testCertificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	issuer, signer := template, interface{}(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, dir, name, kind string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test CA"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	server := testCertificate(t, &x509.Certificate{DNSNames: []string{"localhost"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	billing := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, URIs: []*url.URL{spiffe}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+	reports := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "reports"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+	stranger := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, nil)
+
+	dir := t.TempDir()
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(server.PrivateKey)
+	t.Setenv("TEMPLATE_TLS_CERT", writePEM(t, dir, "server.pem", "CERTIFICATE", server.Certificate[0]))
+	t.Setenv("TEMPLATE_TLS_KEY", writePEM(t, dir, "server-key.pem", "PRIVATE KEY", keyDER))
+	t.Setenv("TEMPLATE_TLS_CLIENT_CA", writePEM(t, dir, "ca.pem", "CERTIFICATE", ca.Certificate[0]))
+	t.Setenv("TEMPLATE_TLS_CLIENT_AUTH", "optional")
+	t.Setenv("TEMPLATE_TLS_CLIENT_ROLE_MAPPING", "spiffe://example.org/billing=editor:billing-*")
+	previousKeys, previousSigning := apiKeys, requestSigning
+	t.Cleanup(func() { serverTLS, clientCerts, apiKeys, requestSigning = nil, nil, previousKeys, previousSigning })
+	apiKeys, requestSigning = nil, nil
+	if err := configureTLS(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.PUT("/templates/:name", func(c echo.Context) error {
+		return c.String(http.StatusOK, renderCallerFrom(c.Request().Context()).Principal)
+	}, apiKeyAuthMiddleware, requireRole(roleEditor))
+	ts := httptest.NewUnstartedServer(e)
+	ts.TLS = serverTLS
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	call := func(cert *tls.Certificate, target string) (int, string, error) {
+		config := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if cert != nil {
+			config.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+target, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), nil
+	}
+
+	if status, body, err := call(&billing, "/templates/billing-invoice"); err != nil || status != http.StatusOK || body != "mtls:spiffe://example.org/billing" {
+		t.Errorf("Mapped identity = %d %q, %v", status, body, err)
+	}
+	if status, _, err := call(&billing, "/templates/hr-letter"); err != nil || status != http.StatusForbidden {
+		t.Errorf("Outside the mapped namespace = %d, %v; want 403", status, err)
+	}
+	if status, _, err := call(&reports, "/templates/billing-invoice"); err != nil || status != http.StatusForbidden {
+		t.Errorf("Unmapped identity = %d, %v; want 403", status, err)
+	}
+	if status, _, err := call(nil, "/templates/billing-invoice"); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("Without a certificate = %d, %v; want 401", status, err)
+	}
+	// Clients do not offer certificates the server's CAs did not issue
+	if status, _, err := call(&stranger, "/templates/billing-invoice"); err == nil && status != http.StatusUnauthorized {
+		t.Errorf("Certificate of another CA = %d; want 401", status)
+	}
+}
+
+func TestConfigureTLSRequiresServerCertificate(t *testing.T) {
+	t.Setenv("TEMPLATE_TLS_CLIENT_CA", "/etc/ssl/ca.pem")
+	t.Cleanup(func() { serverTLS, clientCerts = nil, nil })
+	if err := configureTLS(); err == nil {
+		t.Error("configureTLS() should require a server certificate with TEMPLATE_TLS_CLIENT_CA")
+	}
+}
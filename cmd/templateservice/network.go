@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// networkPolicy restricts which client addresses may reach the API.
+// Empty lists allow every address.
+type networkPolicy struct {
+	api     []*net.IPNet // All /v1/api endpoints
+	admin   []*net.IPNet // Administrative endpoints (template writes, DLQ, stats)
+	proxies []*net.IPNet // Proxies whose X-Forwarded-For header is trusted
+}
+
+var network networkPolicy
+
+// configureNetworkPolicy reads the CIDR allowlists from the environment
+func configureNetworkPolicy() error {
+	var err error
+	if network.api, err = parseCIDRs(envList("TEMPLATE_ALLOWED_CIDRS")); err != nil {
+		return fmt.Errorf("TEMPLATE_ALLOWED_CIDRS: %w", err)
+	}
+	if network.admin, err = parseCIDRs(envList("TEMPLATE_ADMIN_ALLOWED_CIDRS")); err != nil {
+		return fmt.Errorf("TEMPLATE_ADMIN_ALLOWED_CIDRS: %w", err)
+	}
+	if network.proxies, err = parseCIDRs(envList("TEMPLATE_TRUSTED_PROXIES")); err != nil {
+		return fmt.Errorf("TEMPLATE_TRUSTED_PROXIES: %w", err)
+	}
+	if len(network.admin) > 0 {
+		logger.Infof("Administrative endpoints restricted to %d networks", len(network.admin))
+	}
+	return nil
+}
+
+// parseCIDRs parses CIDR ranges; plain addresses match a single host
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// containsIP reports whether ip falls inside any of nets
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipExtractor determines the client address. Forwarded headers are only
+// honoured from trusted proxies so clients cannot spoof an allowed address.
+func (p networkPolicy) ipExtractor() echo.IPExtractor {
+	if len(p.proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, n := range p.proxies {
+		options = append(options, echo.TrustIPRange(n))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// allowlistMiddleware rejects clients outside nets with 403.
+// A nil list allows every client.
+func allowlistMiddleware(nets []*net.IPNet, group string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if len(nets) == 0 {
+			return next
+		}
+		return func(c echo.Context) error {
+			ip := net.ParseIP(c.RealIP())
+			if ip == nil || !containsIP(nets, ip) {
+				logger.Info(fmt.Sprintf("Denied %s request from %s to %s", group, c.RealIP(), c.Request().URL.Path))
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "client address not allowed"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := parseCIDRs([]string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("parseCIDRs() returned error: %v", err)
+	}
+	if len(nets) != 3 {
+		t.Fatalf("Expected 3 networks, got %d", len(nets))
+	}
+	if _, err := parseCIDRs([]string{"not-an-ip"}); err == nil {
+		t.Error("parseCIDRs() should reject invalid addresses")
+	}
+}
+
+func TestAllowlistMiddleware(t *testing.T) {
+	nets, _ := parseCIDRs([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name      string
+		policy    networkPolicy
+		remote    string
+		forwarded string
+		expected  int
+	}{
+		{"allowed", networkPolicy{}, "10.1.2.3:1234", "", http.StatusOK},
+		{"denied", networkPolicy{}, "203.0.113.7:1234", "", http.StatusForbidden},
+		{"spoofed header ignored", networkPolicy{}, "203.0.113.7:1234", "10.1.2.3", http.StatusForbidden},
+		{"trusted proxy", networkPolicy{proxies: mustParseCIDRs(t, "203.0.113.0/24")}, "203.0.113.7:1234", "10.1.2.3", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.IPExtractor = tt.policy.ipExtractor()
+			e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, allowlistMiddleware(nets, "test"))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tt.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func mustParseCIDRs(t *testing.T, values ...string) []*net.IPNet {
+	t.Helper()
+	nets, err := parseCIDRs(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nets
+}
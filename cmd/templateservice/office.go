@@ -0,0 +1,339 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"templateservice/pkg/render"
+)
+
+// Office document formats rendered by replacing placeholders inside the
+// XML parts of the template archive
+const (
+	docxFormat = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	odtFormat  = "application/vnd.oasis.opendocument.text"
+)
+
+// maxOfficePartSize caps the uncompressed size of a single templated part
+const maxOfficePartSize = 32 << 20
+
+// officeFormat describes which parts of an office archive hold text
+type officeFormat struct {
+	Name  string
+	parts func(name string) bool
+}
+
+// officeFormats are the supported office formats by media type
+var officeFormats = map[string]officeFormat{
+	docxFormat: {Name: "DOCX", parts: func(name string) bool {
+		dir, file := path.Split(name)
+		if dir != "word/" || path.Ext(file) != ".xml" {
+			return false
+		}
+		return file == "document.xml" || file == "footnotes.xml" || file == "endnotes.xml" ||
+			strings.HasPrefix(file, "header") || strings.HasPrefix(file, "footer")
+	}},
+	odtFormat: {Name: "ODT", parts: func(name string) bool {
+		return name == "content.xml" || name == "styles.xml"
+	}},
+}
+
+// officeFormatFor returns the office format an encoding format names
+func officeFormatFor(encodingFormat string) (officeFormat, bool) {
+	mediaType, _, _ := mime.ParseMediaType(encodingFormat)
+	format, ok := officeFormats[mediaType]
+	return format, ok
+}
+
+// isOfficeFormat reports whether an encoding format is an office document
+func isOfficeFormat(encodingFormat string) bool {
+	_, ok := officeFormatFor(encodingFormat)
+	return ok
+}
+
+// officeDocument is a template archive split into its templated parts
+type officeDocument struct {
+	archive *zip.Reader
+	parts   map[string]string // Part name to placeholder-normalized XML
+}
+
+// openOfficeDocument reads the request's template archive. Archives sent
+// inline or stored as template text are base64-encoded.
+func openOfficeDocument(req renderRequest, format officeFormat) (*officeDocument, error) {
+	if req.LayoutText != "" {
+		return nil, &render.Error{Message: fmt.Sprintf("layouts cannot be applied to %s templates", format.Name), Status: http.StatusBadRequest}
+	}
+	content, err := loadTemplateContent(req)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(content)
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content)); err == nil {
+			data = decoded
+		}
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, &render.Error{Message: fmt.Sprintf("template is not a %s archive", format.Name), Status: http.StatusBadRequest, Err: err, Stage: stageParse}
+	}
+
+	doc := &officeDocument{archive: archive, parts: make(map[string]string)}
+	for _, f := range archive.File {
+		if !format.parts(f.Name) {
+			continue
+		}
+		if f.UncompressedSize64 > maxOfficePartSize {
+			return nil, &render.Error{Message: fmt.Sprintf("template part %s exceeds %d bytes", f.Name, maxOfficePartSize), Status: http.StatusBadRequest, Stage: stageParse}
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, &render.Error{Message: fmt.Sprintf("failed to read template part %s", f.Name), Status: http.StatusBadRequest, Err: err, Stage: stageParse}
+		}
+		xml, err := io.ReadAll(io.LimitReader(rc, maxOfficePartSize))
+		rc.Close()
+		if err != nil {
+			return nil, &render.Error{Message: fmt.Sprintf("failed to read template part %s", f.Name), Status: http.StatusBadRequest, Err: err, Stage: stageParse}
+		}
+		doc.parts[f.Name] = joinSplitPlaceholders(string(xml), placeholderDelimiters(req))
+	}
+	if len(doc.parts) == 0 {
+		return nil, &render.Error{Message: fmt.Sprintf("template is not a %s document", format.Name), Status: http.StatusBadRequest, Stage: stageParse}
+	}
+	return doc, nil
+}
+
+// partRequest returns the render request for one templated part
+func (d *officeDocument) partRequest(req renderRequest, name string) renderRequest {
+	req.Name = name
+	req.Text = d.parts[name]
+	req.Identifier = ""
+	req.EncodingFormat = "application/xml"
+	return req
+}
+
+// renderOfficeDocument renders every templated part of the request's
+// archive with its engine, in a sandbox when configured, and returns the
+// archive with the rendered parts. Parameter values are XML-escaped.
+func renderOfficeDocument(ctx context.Context, req renderRequest, format officeFormat) (string, error) {
+	doc, err := openOfficeDocument(req, format)
+	if err != nil {
+		return "", err
+	}
+	req.Parameters = escapeXMLValues(req.Parameters).(map[string]interface{})
+
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, f := range doc.archive.File {
+		if _, ok := doc.parts[f.Name]; !ok {
+			// Keeps each entry's compression, so an ODT mimetype stays stored
+			if err := zw.Copy(f); err != nil {
+				return "", &render.Error{Message: "failed to write document", Status: http.StatusInternalServerError, Err: err}
+			}
+			continue
+		}
+		rendered, err := renderOutput(ctx, doc.partRequest(req, f.Name))
+		if err != nil {
+			return "", err
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+		if err == nil {
+			_, err = io.WriteString(w, rendered)
+		}
+		if err != nil {
+			return "", &render.Error{Message: "failed to write document", Status: http.StatusInternalServerError, Err: err}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", &render.Error{Message: "failed to write document", Status: http.StatusInternalServerError, Err: err}
+	}
+	if maxOutputBytes > 0 && int64(out.Len()) > maxOutputBytes {
+		return "", &render.Error{Message: fmt.Sprintf("rendered output exceeds %d bytes", maxOutputBytes), Status: http.StatusRequestEntityTooLarge, Err: render.ErrOutputTooLarge, Stage: stageOutputLimit}
+	}
+	return out.String(), nil
+}
+
+// parseOfficeTemplate checks that every templated part of the request's archive parses
+func parseOfficeTemplate(req renderRequest, format officeFormat) error {
+	doc, err := openOfficeDocument(req, format)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(doc.parts) {
+		if _, err := parseTemplate(doc.partRequest(req, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// officeVariables lists the variables referenced by any templated part
+func officeVariables(req renderRequest, format officeFormat) ([]render.Variable, error) {
+	doc, err := openOfficeDocument(req, format)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]int)
+	variables := []render.Variable{}
+	for _, name := range sortedKeys(doc.parts) {
+		found, err := parsedVariables(doc.partRequest(req, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range found {
+			if i, ok := seen[v.Name]; ok {
+				variables[i].Iterated = variables[i].Iterated || v.Iterated
+				continue
+			}
+			seen[v.Name] = len(variables)
+			variables = append(variables, v)
+		}
+	}
+	sortVariables(variables)
+	return variables, nil
+}
+
+// placeholderDelimiters returns the delimiter pairs of the request's engine
+func placeholderDelimiters(req renderRequest) [][2]string {
+	if len(req.Delimiters) == 2 {
+		return [][2]string{{req.Delimiters[0], req.Delimiters[1]}}
+	}
+	delimiters := [][2]string{{"{{", "}}"}}
+	if req.Engine == "jinja2" || req.Engine == "liquid" {
+		delimiters = append(delimiters, [2]string{"{%", "%}"}, [2]string{"{#", "#}"})
+	}
+	return delimiters
+}
+
+// placeholderQuotes replaces the typographic quotes word processors
+// substitute while typing with the quotes template syntax expects
+var placeholderQuotes = strings.NewReplacer("“", `"`, "”", `"`, "‘", "'", "’", "'")
+
+// joinSplitPlaceholders repairs placeholders that a word processor split
+// over several runs of text, e.g. "{{.Na" and "me}}" in separate <w:t>
+// elements: the whole placeholder is moved into the text where it starts
+// and the markup between is kept. Entities and typographic quotes inside
+// placeholders are decoded so the template engine sees plain syntax.
+func joinSplitPlaceholders(xml string, delimiters [][2]string) string {
+	// Segments alternate between markup and character data
+	type segment struct {
+		text   string
+		markup bool
+	}
+	var segments []segment
+	var text strings.Builder
+	for rest := xml; rest != ""; {
+		if rest[0] == '<' {
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			segments = append(segments, segment{rest[:end+1], true})
+			rest = rest[end+1:]
+			continue
+		}
+		end := strings.IndexByte(rest, '<')
+		if end < 0 {
+			end = len(rest)
+		}
+		segments = append(segments, segment{rest[:end], false})
+		text.WriteString(rest[:end])
+		rest = rest[end:]
+	}
+
+	// Locate the placeholders in the character data as a whole
+	all := text.String()
+	var spans [][2]int
+	for pos := 0; ; {
+		start, pair := nextDelimiter(all[pos:], delimiters)
+		if start < 0 {
+			break
+		}
+		start += pos
+		end := strings.Index(all[start+len(pair[0]):], pair[1])
+		if end < 0 {
+			break
+		}
+		pos = start + len(pair[0]) + end + len(pair[1])
+		spans = append(spans, [2]int{start, pos})
+	}
+
+	var out strings.Builder
+	out.Grow(len(xml))
+	offset, next := 0, 0
+	for _, seg := range segments {
+		if seg.markup {
+			out.WriteString(seg.text)
+			continue
+		}
+		from, to := offset, offset+len(seg.text)
+		offset = to
+		for p := from; p < to; {
+			switch {
+			case next < len(spans) && spans[next][0] < p:
+				// The rest of a placeholder that started in an earlier segment
+				p = min(spans[next][1], to)
+				if spans[next][1] <= to {
+					next++
+				}
+			case next < len(spans) && spans[next][0] < to:
+				span := spans[next]
+				out.WriteString(all[p:span[0]])
+				out.WriteString(placeholderQuotes.Replace(html.UnescapeString(all[span[0]:span[1]])))
+				p = span[1]
+				if p <= to {
+					next++
+				}
+			default:
+				out.WriteString(all[p:to])
+				p = to
+			}
+		}
+	}
+	return out.String()
+}
+
+// nextDelimiter returns the position and pair of the first opening delimiter in text
+func nextDelimiter(text string, delimiters [][2]string) (int, [2]string) {
+	first, pair := -1, [2]string{}
+	for _, d := range delimiters {
+		if i := strings.Index(text, d[0]); i >= 0 && (first < 0 || i < first) {
+			first, pair = i, d
+		}
+	}
+	return first, pair
+}
+
+// xmlValueEscaper escapes markup characters as numeric references, which
+// case-changing template functions leave intact
+var xmlValueEscaper = strings.NewReplacer("&", "&#38;", "<", "&#60;", ">", "&#62;")
+
+// escapeXMLValues returns a copy of v with every string XML-escaped
+func escapeXMLValues(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return xmlValueEscaper.Replace(v)
+	case map[string]interface{}:
+		escaped := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			escaped[key] = escapeXMLValues(value)
+		}
+		return escaped
+	case []interface{}:
+		escaped := make([]interface{}, len(v))
+		for i, value := range v {
+			escaped[i] = escapeXMLValues(value)
+		}
+		return escaped
+	}
+	return v
+}
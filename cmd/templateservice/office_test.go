@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+// officeArchive builds an archive from name/content pairs, storing the
+// first entry uncompressed like an ODT mimetype
+func officeArchive(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < len(entries); i += 2 {
+		method := zip.Deflate
+		if i == 0 {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entries[i], Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, entries[i+1])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// archiveEntries reads every entry of an archive
+func archiveEntries(t *testing.T, data string) ([]*zip.File, map[string]string) {
+	t.Helper()
+	archive, err := zip.NewReader(strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Output is not an archive: %v", err)
+	}
+	contents := make(map[string]string)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(content)
+	}
+	return archive.File, contents
+}
+
+func TestJoinSplitPlaceholders(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"unsplit", `<w:t>Hi {{.Name}}</w:t>`, `<w:t>Hi {{.Name}}</w:t>`},
+		{"split over runs", `<w:r><w:t>Hi {{.Na</w:t></w:r><w:r><w:t>me}}!</w:t></w:r>`, `<w:r><w:t>Hi {{.Name}}</w:t></w:r><w:r><w:t>!</w:t></w:r>`},
+		{"split over three runs", `<w:t>{</w:t><w:t>{.A</w:t><w:t>}}{{.B}} x</w:t>`, `<w:t>{{.A}}</w:t><w:t></w:t><w:t>{{.B}} x</w:t>`},
+		{"entities and quotes", `<w:t>{{if eq .A &quot;x&quot;}}{{printf “%d” 1}}</w:t>`, `<w:t>{{if eq .A "x"}}{{printf "%d" 1}}</w:t>`},
+		{"unterminated", `<w:t>{{.A</w:t><w:t> &amp; b</w:t>`, `<w:t>{{.A</w:t><w:t> &amp; b</w:t>`},
+		{"split delimiters", `<w:t>{</w:t><w:t>{.A}</w:t><w:t>}</w:t>`, `<w:t>{{.A}}</w:t><w:t></w:t><w:t></w:t>`},
+		{"text outside untouched", `<w:t>&quot;a&quot;</w:t>`, `<w:t>&quot;a&quot;</w:t>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinSplitPlaceholders(tt.in, [][2]string{{"{{", "}}"}}); got != tt.want {
+				t.Errorf("joinSplitPlaceholders() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderDOCX(t *testing.T) {
+	docx := officeArchive(t,
+		"[Content_Types].xml", `<Types/>`,
+		"word/document.xml", `<w:document><w:p><w:r><w:t>Dear {{.Cus</w:t></w:r><w:r><w:b/><w:t>tomer}},</w:t></w:r></w:p>{{range .Items}}<w:p><w:r><w:t>{{. | upper}}</w:t></w:r></w:p>{{end}}</w:document>`,
+		"word/header1.xml", `<w:hdr><w:t>Invoice {{.Number}}</w:t></w:hdr>`,
+		"word/media/logo.png", "{{.NotATemplate}}",
+	)
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:           base64.StdEncoding.EncodeToString(docx),
+		EncodingFormat: docxFormat,
+		Parameters: map[string]interface{}{
+			"Customer": "Smith & <Sons>",
+			"Items":    []interface{}{"a&b", "c"},
+			"Number":   7,
+		},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if result.EncodingFormat != docxFormat {
+		t.Errorf("Expected encoding format %s, got %q", docxFormat, result.EncodingFormat)
+	}
+
+	_, contents := archiveEntries(t, result.Output)
+	want := `<w:document><w:p><w:r><w:t>Dear Smith &#38; &#60;Sons&#62;</w:t></w:r><w:r><w:b/><w:t>,</w:t></w:r></w:p><w:p><w:r><w:t>A&#38;B</w:t></w:r></w:p><w:p><w:r><w:t>C</w:t></w:r></w:p></w:document>`
+	if contents["word/document.xml"] != want {
+		t.Errorf("Unexpected document.xml:\n%s\nwant\n%s", contents["word/document.xml"], want)
+	}
+	if contents["word/header1.xml"] != `<w:hdr><w:t>Invoice 7</w:t></w:hdr>` {
+		t.Errorf("Unexpected header1.xml %q", contents["word/header1.xml"])
+	}
+	if contents["word/media/logo.png"] != "{{.NotATemplate}}" || contents["[Content_Types].xml"] != `<Types/>` {
+		t.Error("Expected other entries to be copied unchanged")
+	}
+}
+
+func TestRenderODT(t *testing.T) {
+	odt := officeArchive(t,
+		"mimetype", odtFormat,
+		"content.xml", `<office:text><text:p>Hello <text:span>{{.Name}}</text:span></text:p></office:text>`,
+		"styles.xml", `<office:styles/>`,
+	)
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:           string(odt),
+		EncodingFormat: odtFormat,
+		Parameters:     map[string]interface{}{"Name": "Ada"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	files, contents := archiveEntries(t, result.Output)
+	if files[0].Name != "mimetype" || files[0].Method != zip.Store {
+		t.Errorf("Expected a stored mimetype first, got %s (method %d)", files[0].Name, files[0].Method)
+	}
+	if !strings.Contains(contents["content.xml"], "<text:span>Ada</text:span>") {
+		t.Errorf("Unexpected content.xml %q", contents["content.xml"])
+	}
+}
+
+func TestOfficeVariablesAndErrors(t *testing.T) {
+	docx := officeArchive(t,
+		"[Content_Types].xml", `<Types/>`,
+		"word/document.xml", `<w:t>{{.Customer.Name}}</w:t><w:t>{{range .Items}}{{.Sku}}{{end}}</w:t>`,
+		"word/footer1.xml", `<w:t>{{.Customer.Name}} {{.Page}}</w:t>`,
+	)
+	variables, err := extractVariables(context.Background(), renderRequest{Text: base64.StdEncoding.EncodeToString(docx), EncodingFormat: docxFormat})
+	if err != nil {
+		t.Fatalf("extractVariables() returned error: %v", err)
+	}
+	var names []string
+	for _, v := range variables {
+		names = append(names, v.Name)
+	}
+	if got := strings.Join(names, ","); got != ".Customer.Name,.Items,.Items[].Sku,.Page" {
+		t.Errorf("Unexpected variables %s", got)
+	}
+
+	for name, req := range map[string]renderRequest{
+		"not an archive": {Text: "hello", EncodingFormat: docxFormat},
+		"no document":    {Text: string(officeArchive(t, "other.xml", "<x/>")), EncodingFormat: docxFormat},
+		"parse error":    {Text: string(officeArchive(t, "x", "", "word/document.xml", "<w:t>{{.A</w:t><w:t>}}{{end}}</w:t>")), EncodingFormat: docxFormat},
+	} {
+		_, err := renderTemplate(context.Background(), req)
+		var re *render.Error
+		if !errors.As(err, &re) || re.Status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", name, err)
+		}
+	}
+}
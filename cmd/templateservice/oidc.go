@@ -0,0 +1,500 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Service roles granted to single sign-on users. Each role includes the
+// ones before it.
+const (
+	roleViewer = "viewer" // Read and render templates
+	roleEditor = "editor" // Create, update, delete and roll back templates
+	roleAdmin  = "admin"  // Administrative endpoints
+)
+
+var roleRank = map[string]int{roleViewer: 1, roleEditor: 2, roleAdmin: 3}
+
+// oidcSessionCookie carries the session ID of a signed-in user
+const oidcSessionCookie = "templateservice_session"
+
+// oidcLoginTimeout bounds the time between redirecting to the identity
+// provider and its callback
+const oidcLoginTimeout = 10 * time.Minute
+
+// roleGrant is a role an IdP group holds over template names matching Namespace
+type roleGrant struct {
+	Group     string `json:"group"`
+	Role      string `json:"role"`
+	Namespace string `json:"namespace"` // Glob over template names, "*" for all
+}
+
+// oidcSession is a signed-in user
+type oidcSession struct {
+	Principal string      `json:"principal"` // "oidc:" + email, or the subject
+	Groups    []string    `json:"groups"`
+	Grants    []roleGrant `json:"grants"`
+	CSRFToken string      `json:"csrfToken"` // Required as X-CSRF-Token on unsafe requests
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+// pendingLogin is a redirect to the identity provider awaiting its callback
+type pendingLogin struct {
+	verifier  string // PKCE code verifier
+	nonce     string
+	returnTo  string
+	expiresAt time.Time
+}
+
+// oidcProvider runs the authorization code flow (with PKCE) against an
+// OpenID Connect provider and keeps the resulting sessions in memory
+type oidcProvider struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	authEndpoint  string
+	tokenEndpoint string
+	groupsClaim   string
+	mapping       []roleGrant
+	sessionTTL    time.Duration
+	client        *http.Client
+	now           func() time.Time
+
+	mu       sync.Mutex
+	pending  map[string]pendingLogin // By state
+	sessions map[string]*oidcSession // By session ID
+}
+
+// oidc is nil unless TEMPLATE_OIDC_ISSUER is set
+var oidc *oidcProvider
+
+// configureOIDC discovers the provider named by TEMPLATE_OIDC_ISSUER and
+// parses the group mapping
+func configureOIDC() error {
+	oidc = nil
+	issuer := strings.TrimSuffix(os.Getenv("TEMPLATE_OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return nil
+	}
+	mapping, err := parseRoleMapping("TEMPLATE_OIDC_ROLE_MAPPING", envList("TEMPLATE_OIDC_ROLE_MAPPING"))
+	if err != nil {
+		return err
+	}
+	p := newOIDCProvider(issuer, os.Getenv("TEMPLATE_OIDC_CLIENT_ID"), os.Getenv("TEMPLATE_OIDC_CLIENT_SECRET"),
+		os.Getenv("TEMPLATE_OIDC_REDIRECT_URL"), mapping)
+	if p.clientID == "" || p.redirectURL == "" {
+		return errors.New("TEMPLATE_OIDC_CLIENT_ID and TEMPLATE_OIDC_REDIRECT_URL are required with TEMPLATE_OIDC_ISSUER")
+	}
+	if claim := os.Getenv("TEMPLATE_OIDC_GROUPS_CLAIM"); claim != "" {
+		p.groupsClaim = claim
+	}
+	p.sessionTTL = envDuration("TEMPLATE_OIDC_SESSION_TTL", p.sessionTTL)
+	if err := p.discover(); err != nil {
+		return err
+	}
+	oidc = p
+	logger.Infof("OIDC sign-in enabled with %s (%d group mappings)", issuer, len(mapping))
+	return nil
+}
+
+func newOIDCProvider(issuer, clientID, clientSecret, redirectURL string, mapping []roleGrant) *oidcProvider {
+	return &oidcProvider{
+		issuer:       issuer,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		groupsClaim:  "groups",
+		mapping:      mapping,
+		sessionTTL:   8 * time.Hour,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+		pending:      make(map[string]pendingLogin),
+		sessions:     make(map[string]*oidcSession),
+	}
+}
+
+// parseRoleMapping parses "group=role" and "group=role:namespace" entries
+// of the named variable
+func parseRoleMapping(variable string, entries []string) ([]roleGrant, error) {
+	grants := make([]roleGrant, 0, len(entries))
+	for _, entry := range entries {
+		group, grant, ok := strings.Cut(entry, "=")
+		role, namespace, _ := strings.Cut(grant, ":")
+		if namespace == "" {
+			namespace = "*"
+		}
+		if _, err := path.Match(namespace, ""); !ok || group == "" || roleRank[role] == 0 || err != nil {
+			return nil, fmt.Errorf("%s: expected group=%s|%s|%s[:namespace], got %q", variable, roleViewer, roleEditor, roleAdmin, entry)
+		}
+		grants = append(grants, roleGrant{Group: group, Role: role, Namespace: namespace})
+	}
+	return grants, nil
+}
+
+// discover reads the provider's endpoints from its discovery document
+func (p *oidcProvider) discover() error {
+	resp, err := p.client.Get(p.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return fmt.Errorf("OIDC discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OIDC discovery returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return fmt.Errorf("OIDC discovery: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.issuer || doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return fmt.Errorf("OIDC discovery document of %s is incomplete or names another issuer", p.issuer)
+	}
+	p.authEndpoint, p.tokenEndpoint = doc.AuthorizationEndpoint, doc.TokenEndpoint
+	return nil
+}
+
+// randomToken returns a URL-safe random string
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// handleOIDCLogin handles GET /auth/login, redirecting to the identity provider
+func handleOIDCLogin(c echo.Context) error {
+	if oidc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+	}
+	returnTo := c.QueryParam("returnTo")
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.Contains(returnTo, `\`) {
+		returnTo = "/"
+	}
+	state, login := randomToken(), pendingLogin{
+		verifier:  randomToken(),
+		nonce:     randomToken(),
+		returnTo:  returnTo,
+		expiresAt: oidc.now().Add(oidcLoginTimeout),
+	}
+	oidc.mu.Lock()
+	oidc.prune()
+	oidc.pending[state] = login
+	oidc.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(login.verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {oidc.clientID},
+		"redirect_uri":          {oidc.redirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {login.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(oidc.authEndpoint, "?") {
+		separator = "&"
+	}
+	return c.Redirect(http.StatusFound, oidc.authEndpoint+separator+query.Encode())
+}
+
+// handleOIDCCallback handles GET /auth/callback: it redeems the
+// authorization code, maps the user's groups to roles and starts a session
+func handleOIDCCallback(c echo.Context) error {
+	if oidc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+	}
+	if idpError := c.QueryParam("error"); idpError != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "sign-in failed: " + idpError})
+	}
+	oidc.mu.Lock()
+	login, ok := oidc.pending[c.QueryParam("state")]
+	delete(oidc.pending, c.QueryParam("state"))
+	oidc.mu.Unlock()
+	if !ok || oidc.now().After(login.expiresAt) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown or expired sign-in state"})
+	}
+
+	claims, err := oidc.redeem(c.Request(), c.QueryParam("code"), login)
+	if err != nil {
+		logger.WithError(err).Error("OIDC sign-in failed")
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "sign-in failed"})
+	}
+	session := oidc.newSession(claims)
+	if len(session.Grants) == 0 {
+		logger.Info(fmt.Sprintf("Refused sign-in of %s: no group is mapped to a role", session.Principal))
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "none of your groups grants access to this service"})
+	}
+
+	id := randomToken()
+	oidc.mu.Lock()
+	oidc.sessions[id] = session
+	oidc.mu.Unlock()
+	c.SetCookie(&http.Cookie{
+		Name:     oidcSessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(oidc.redirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	logger.Info(fmt.Sprintf("Signed in %s via OIDC", session.Principal))
+	return c.Redirect(http.StatusFound, login.returnTo)
+}
+
+// idTokenClaims are the ID token claims the service uses
+type idTokenClaims map[string]interface{}
+
+// redeem exchanges the authorization code for an ID token and validates
+// its claims. The token comes straight from the token endpoint over TLS, so
+// its signature is not checked (OpenID Connect Core 3.1.3.7).
+func (p *oidcProvider) redeem(r *http.Request, code string, login pendingLogin) (idTokenClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {login.verifier},
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	parts := strings.Split(token.IDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token response has no ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, fmt.Errorf("ID token issued by %q", iss)
+	}
+	if !containsString(claimStrings(claims["aud"]), p.clientID) {
+		return nil, errors.New("ID token is not issued to this client")
+	}
+	if exp, _ := claims["exp"].(float64); p.now().Unix() > int64(exp) {
+		return nil, errors.New("ID token has expired")
+	}
+	if nonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(nonce), []byte(login.nonce)) != 1 {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// newSession maps the groups of a signed-in user to role grants
+func (p *oidcProvider) newSession(claims idTokenClaims) *oidcSession {
+	principal, _ := claims["email"].(string)
+	if principal == "" {
+		principal, _ = claims["sub"].(string)
+	}
+	session := &oidcSession{
+		Principal: "oidc:" + principal,
+		Groups:    claimStrings(claims[p.groupsClaim]),
+		CSRFToken: randomToken(),
+		ExpiresAt: p.now().Add(p.sessionTTL),
+	}
+	for _, grant := range p.mapping {
+		if containsString(session.Groups, grant.Group) {
+			session.Grants = append(session.Grants, grant)
+		}
+	}
+	return session
+}
+
+// session returns the unexpired session named by the request's cookie
+func (p *oidcProvider) session(r *http.Request) (*oidcSession, string, bool) {
+	cookie, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil, "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session, ok := p.sessions[cookie.Value]
+	if !ok || p.now().After(session.ExpiresAt) {
+		delete(p.sessions, cookie.Value)
+		return nil, "", false
+	}
+	return session, cookie.Value, true
+}
+
+// prune drops expired logins and sessions. The caller holds p.mu.
+func (p *oidcProvider) prune() {
+	now := p.now()
+	for state, login := range p.pending {
+		if now.After(login.expiresAt) {
+			delete(p.pending, state)
+		}
+	}
+	for id, session := range p.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(p.sessions, id)
+		}
+	}
+}
+
+// claimStrings reads a string or string array claim
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcSessionContextKey holds the session of a request authenticated by cookie
+const oidcSessionContextKey = "oidcSession"
+
+// roleGrantsContextKey holds the grants of a request authenticated by a
+// session or a provisioned key (see provisioning.go)
+const roleGrantsContextKey = "roleGrants"
+
+// sessionAuthenticated continues the chain for a signed-in user. Unsafe
+// methods must echo the session's CSRF token.
+func sessionAuthenticated(c echo.Context, next echo.HandlerFunc, session *oidcSession) error {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		token := c.Request().Header.Get("X-CSRF-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) != 1 {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "missing or invalid X-CSRF-Token"})
+		}
+	}
+	c.Set(oidcSessionContextKey, session)
+	c.Set(roleGrantsContextKey, session.Grants)
+	return authenticated(c, next, session.Principal)
+}
+
+// grantsAllow reports whether grants include role (or a higher one) for the
+// template name
+func grantsAllow(grants []roleGrant, role, name string) bool {
+	for _, grant := range grants {
+		if roleRank[grant.Role] < roleRank[role] {
+			continue
+		}
+		if ok, _ := path.Match(grant.Namespace, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// requireRole restricts a route to signed-in users and provisioned keys
+// holding role within the namespace of the route's :name parameter; routes
+// without one use requireGlobalRole. Requests authenticated by a configured API key or signature are
+// not affected.
+func requireRole(role string) echo.MiddlewareFunc {
+	return requireRoleFor(role, func(c echo.Context) string { return c.Param("name") })
+}
+
+// requireGlobalRole is requireRole for routes that act beyond a single
+// namespace, such as provisioning: the role must be held over "*"
+func requireGlobalRole(role string) echo.MiddlewareFunc {
+	return requireRoleFor(role, func(echo.Context) string { return "*" })
+}
+
+func requireRoleFor(role string, name func(echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			grants, ok := c.Get(roleGrantsContextKey).([]roleGrant)
+			if !ok || grantsAllow(grants, role, name(c)) {
+				return next(c)
+			}
+			return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("the %s role is required", role)})
+		}
+	}
+}
+
+// handleOIDCSession handles GET /v1/api/auth/session, describing the
+// signed-in user (including the CSRF token for unsafe requests)
+func handleOIDCSession(c echo.Context) error {
+	if oidc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+	}
+	session, _, ok := oidc.session(c.Request())
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not signed in"})
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// handleOIDCLogout handles POST /auth/logout
+func handleOIDCLogout(c echo.Context) error {
+	if oidc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+	}
+	if session, id, ok := oidc.session(c.Request()); ok {
+		if subtle.ConstantTimeCompare([]byte(c.Request().Header.Get("X-CSRF-Token")), []byte(session.CSRFToken)) != 1 {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "missing or invalid X-CSRF-Token"})
+		}
+		oidc.mu.Lock()
+		delete(oidc.sessions, id)
+		oidc.mu.Unlock()
+	}
+	c.SetCookie(&http.Cookie{Name: oidcSessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fakeIdP issues unsigned ID tokens for a single authorization code
+func fakeIdP(t *testing.T, claims map[string]interface{}) *httptest.Server {
+	t.Helper()
+	var challenge string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 server.URL,
+				"authorization_endpoint": server.URL + "/authorize",
+				"token_endpoint":         server.URL + "/token",
+			})
+		case "/authorize":
+			challenge = r.URL.Query().Get("code_challenge")
+			claims["nonce"] = r.URL.Query().Get("nonce")
+		case "/token":
+			verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+			if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != challenge {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			claims["iss"] = server.URL
+			payload, _ := json.Marshal(claims)
+			token := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+			_ = json.NewEncoder(w).Encode(map[string]string{"id_token": token})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func withOIDC(t *testing.T, issuer string, mapping []roleGrant) *oidcProvider {
+	t.Helper()
+	p := newOIDCProvider(issuer, "templates", "secret", "https://templates.example.com/auth/callback", mapping)
+	if err := p.discover(); err != nil {
+		t.Fatal(err)
+	}
+	previous := oidc
+	oidc = p
+	t.Cleanup(func() { oidc = previous })
+	return p
+}
+
+// signIn runs the login redirect and callback and returns the session cookie
+func signIn(t *testing.T, e *echo.Echo) (*http.Cookie, *httptest.ResponseRecorder) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login?returnTo=/templates", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Login = %d", rec.Code)
+	}
+	authorize, _ := url.Parse(rec.Header().Get("Location"))
+	resp, err := http.Get(authorize.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/callback?code=good-code&state="+authorize.Query().Get("state"), nil))
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == oidcSessionCookie {
+			return cookie, rec
+		}
+	}
+	return nil, rec
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	previousKeys, previousSigning := apiKeys, requestSigning
+	t.Cleanup(func() { apiKeys, requestSigning = previousKeys, previousSigning })
+	t.Setenv("TEMPLATE_API_KEY", "tsk_test_0123456789")
+	if err := configureAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	requestSigning = nil
+
+	idp := fakeIdP(t, map[string]interface{}{
+		"aud": "templates", "exp": float64(time.Now().Add(time.Hour).Unix()),
+		"sub": "u1", "email": "ada@example.com", "groups": []string{"marketing", "staff"},
+	})
+	withOIDC(t, idp.URL, []roleGrant{
+		{Group: "marketing", Role: roleEditor, Namespace: "marketing-*"},
+		{Group: "ops", Role: roleAdmin, Namespace: "*"},
+	})
+
+	e := echo.New()
+	e.GET("/auth/login", handleOIDCLogin)
+	e.GET("/auth/callback", handleOIDCCallback)
+	e.GET("/v1/api/auth/session", handleOIDCSession)
+	e.PUT("/v1/api/templates/:name", handlePutTemplate, apiKeyAuthMiddleware, requireRole(roleEditor))
+	e.GET("/v1/api/cache/stats", handleCacheStats, apiKeyAuthMiddleware, requireGlobalRole(roleAdmin))
+
+	cookie, rec := signIn(t, e)
+	if cookie == nil || rec.Code != http.StatusFound || rec.Header().Get("Location") != "/templates" {
+		t.Fatalf("Callback = %d %s, expected a session and a redirect", rec.Code, rec.Body)
+	}
+
+	call := func(method, target, csrf string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"text": "Hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(cookie)
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = call(http.MethodGet, "/v1/api/auth/session", "")
+	var session oidcSession
+	if err := json.Unmarshal(rec.Body.Bytes(), &session); err != nil || session.Principal != "oidc:ada@example.com" || len(session.Grants) != 1 {
+		t.Fatalf("Session = %s (%v)", rec.Body, err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		csrf   string
+		status int
+	}{
+		{"editor in namespace", http.MethodPut, "/v1/api/templates/marketing-offer", session.CSRFToken, http.StatusCreated},
+		{"missing CSRF token", http.MethodPut, "/v1/api/templates/marketing-offer", "", http.StatusForbidden},
+		{"outside namespace", http.MethodPut, "/v1/api/templates/finance-report", session.CSRFToken, http.StatusForbidden},
+		{"admin endpoint", http.MethodGet, "/v1/api/cache/stats", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := call(tt.method, tt.target, tt.csrf); rec.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	// API keys are not subject to roles
+	req := httptest.NewRequest(http.MethodPut, "/v1/api/templates/finance-report", strings.NewReader(`{"text": "Hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "tsk_test_0123456789")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected the API key to write any template, got %d", rec.Code)
+	}
+}
+
+func TestOIDCRequiresSession(t *testing.T) {
+	previousKeys, previousSigning := apiKeys, requestSigning
+	apiKeys, requestSigning = nil, nil
+	t.Cleanup(func() { apiKeys, requestSigning = previousKeys, previousSigning })
+	idp := fakeIdP(t, map[string]interface{}{})
+	withOIDC(t, idp.URL, []roleGrant{{Group: "ops", Role: roleAdmin, Namespace: "*"}})
+
+	e := echo.New()
+	e.GET("/v1/api/cache/stats", handleCacheStats, apiKeyAuthMiddleware, requireGlobalRole(roleAdmin))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/api/cache/stats", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an anonymous request with only single sign-on configured, got %d", rec.Code)
+	}
+}
+
+func TestGrantsAllow(t *testing.T) {
+	grants := []roleGrant{{Role: roleAdmin, Namespace: "team-a~*"}}
+	if !grantsAllow(grants, roleEditor, "team-a~invoice") {
+		t.Error("Expected a namespace admin to edit the namespace's templates")
+	}
+	for _, name := range []string{"", "*", "team-b~invoice"} {
+		if grantsAllow(grants, roleAdmin, name) {
+			t.Errorf("Expected a namespace admin to be refused for %q", name)
+		}
+	}
+}
+
+func TestOIDCSignInWithoutRole(t *testing.T) {
+	idp := fakeIdP(t, map[string]interface{}{
+		"aud": "templates", "exp": float64(time.Now().Add(time.Hour).Unix()), "sub": "u2", "groups": "staff",
+	})
+	withOIDC(t, idp.URL, []roleGrant{{Group: "ops", Role: roleAdmin, Namespace: "*"}})
+
+	e := echo.New()
+	e.GET("/auth/login", handleOIDCLogin)
+	e.GET("/auth/callback", handleOIDCCallback)
+	if cookie, rec := signIn(t, e); cookie != nil || rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without a mapped group, got %d", rec.Code)
+	}
+}
+
+func TestParseRoleMapping(t *testing.T) {
+	grants, err := parseRoleMapping("TEMPLATE_OIDC_ROLE_MAPPING", []string{"ops=admin", "marketing=editor:marketing-*"})
+	if err != nil || len(grants) != 2 || grants[0].Namespace != "*" || grants[1].Namespace != "marketing-*" {
+		t.Errorf("parseRoleMapping() = %+v, %v", grants, err)
+	}
+	for _, bad := range []string{"ops", "ops=root", "=admin", "ops=admin:["} {
+		if _, err := parseRoleMapping("TEMPLATE_OIDC_ROLE_MAPPING", []string{bad}); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
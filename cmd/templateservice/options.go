@@ -0,0 +1,172 @@
+package main
+
+import (
+	"sort"
+
+	"templateservice/pkg/render"
+)
+
+// Sources an effective option can come from
+const (
+	sourceRequest  = "request"
+	sourceTemplate = "template" // The stored template's defaults
+	sourceTenant   = "tenant"   // The caller's namespace (see tenanthosts.go, themes.go)
+	sourcePolicy   = "policy"   // A render policy modification (see policy.go)
+	sourceDefault  = "default"
+)
+
+// effectiveOptions reports exactly how a render was performed once the
+// request was merged with its stored template, the caller's namespace, the
+// render policy and the service defaults. Sources names where each merged
+// option came from.
+type effectiveOptions struct {
+	Engine          string   `json:"engine"`
+	EncodingFormat  string   `json:"encodingFormat"`
+	Delimiters      []string `json:"delimiters"`
+	MissingKey      string   `json:"missingKey"`
+	MissingKeyValue *string  `json:"missingKeyValue,omitempty"`
+
+	Template        string   `json:"template,omitempty"` // Stored template rendered, after namespace resolution
+	TemplateVersion int      `json:"templateVersion,omitempty"`
+	Layout          string   `json:"layout,omitempty"`
+	Partials        []string `json:"partials,omitempty"`
+	Theme           string   `json:"theme,omitempty"`  // Namespace whose theme pack was applied, or default
+	Debug           bool     `json:"debug,omitempty"`  // Rendered with the debug functions
+	Locale          string   `json:"locale,omitempty"` // Locale of the translation functions
+
+	Functions      effectiveFunctions `json:"functions"`
+	Limits         effectiveLimits    `json:"limits"`
+	PostProcessors []string           `json:"postProcessors"` // Steps applied to the output, in order
+
+	Sources map[string]string `json:"sources"`
+}
+
+// effectiveFunctions describes the template function set
+type effectiveFunctions struct {
+	Sprig      bool `json:"sprig"`      // The Sprig library is available
+	InlineOnly bool `json:"inlineOnly"` // Network and file path functions are removed
+	Count      int  `json:"count"`
+	Plugins    int  `json:"plugins,omitempty"` // Allowed plugin functions among Count
+}
+
+// effectiveLimits are the resource limits the render ran under
+type effectiveLimits struct {
+	Timeout        string `json:"timeout"` // "0s" when unlimited
+	MaxOutputBytes int64  `json:"maxOutputBytes"`
+	Sandbox        bool   `json:"sandbox"` // Rendered in a sandbox process
+	MemoryMB       int    `json:"memoryMB,omitempty"`
+	CPUSeconds     int    `json:"cpuSeconds,omitempty"`
+}
+
+// optionSources attributes the options of a prepared request: request is
+// the client's request, resolved the request after template resolution and
+// prepared the request after the render policy
+func optionSources(request, resolved, prepared renderRequest) map[string]string {
+	fromTemplate := sourceDefault
+	if resolved.StoredVersion > 0 {
+		fromTemplate = sourceTemplate
+	}
+	source := func(inRequest, inResolved bool) string {
+		switch {
+		case inRequest:
+			return sourceRequest
+		case inResolved:
+			return fromTemplate
+		}
+		return sourceDefault
+	}
+
+	_, _, formatNamesEngine := render.EngineFromFormat(request.EncodingFormat)
+	sources := map[string]string{
+		"engine":         source(request.Engine != "" || formatNamesEngine, resolved.Engine != render.GoEngine),
+		"encodingFormat": source(request.EncodingFormat != "", resolved.EncodingFormat != ""),
+		"delimiters":     source(len(request.Delimiters) > 0, len(resolved.Delimiters) > 0),
+		"missingKey":     source(request.MissingKey != "" || request.MissingValue != nil, resolved.MissingKey != "" || resolved.MissingValue != nil),
+		"layout":         source(request.Layout != "", resolved.Layout != ""),
+		"locale":         source(request.Locale != "", false),
+	}
+	if resolved.TemplateName != "" {
+		sources["template"] = sourceRequest
+		if request.TemplateName != resolved.TemplateName && request.Identifier != resolved.TemplateName {
+			sources["template"] = sourceTenant
+		}
+	}
+	if prepared.EncodingFormat != resolved.EncodingFormat {
+		sources["encodingFormat"] = sourcePolicy
+	}
+	if prepared.MissingKey != resolved.MissingKey || (prepared.MissingValue == nil) != (resolved.MissingValue == nil) {
+		sources["missingKey"] = sourcePolicy
+	}
+	if prepared.Theme != "" {
+		sources["theme"] = sourceTenant
+		if prepared.Theme == defaultThemeTenant {
+			sources["theme"] = sourceDefault
+		}
+	}
+	return sources
+}
+
+// effectiveOptionsFor describes the options req was rendered with and the
+// post-processors applied to its output
+func effectiveOptionsFor(req renderRequest, postProcessors []string) *effectiveOptions {
+	delimiters := req.Delimiters
+	if len(delimiters) == 0 {
+		delimiters = []string{"{{", "}}"}
+	}
+	missingKey := req.MissingKey
+	if missingKey == "" || req.MissingValue != nil {
+		missingKey = "default"
+	}
+	partials := make([]string, 0, len(req.Partials))
+	for name := range req.Partials {
+		partials = append(partials, name)
+	}
+	sort.Strings(partials)
+
+	options := &effectiveOptions{
+		Engine:          req.Engine,
+		EncodingFormat:  resultEncodingFormat(req),
+		Delimiters:      delimiters,
+		MissingKey:      missingKey,
+		MissingKeyValue: req.MissingValue,
+		Template:        req.TemplateName,
+		TemplateVersion: req.StoredVersion,
+		Layout:          req.Layout,
+		Partials:        partials,
+		Theme:           req.Theme,
+		Debug:           req.Debug,
+		Locale:          req.Locale,
+		Functions: effectiveFunctions{
+			Sprig:      sprigEnabled,
+			InlineOnly: inlineOnly,
+			Count:      len(templateFuncMap),
+			Plugins:    len(pluginFuncs),
+		},
+		Limits: effectiveLimits{
+			Timeout:        renderTimeout.String(),
+			MaxOutputBytes: maxOutputBytes,
+		},
+		PostProcessors: postProcessors,
+		Sources:        req.OptionSources,
+	}
+	if options.PostProcessors == nil {
+		options.PostProcessors = []string{}
+	}
+	if options.Sources == nil {
+		options.Sources = map[string]string{}
+	}
+	if sandboxed(req) {
+		options.Limits.Sandbox = true
+		options.Limits.MemoryMB = sandboxMemoryMB
+		options.Limits.CPUSeconds = sandboxCPUSeconds
+	}
+	return options
+}
+
+// integrityProcessors names the signing step applied to every output
+func integrityProcessors() []string {
+	if signer == nil {
+		return nil
+	}
+	return []string{"sign:" + signer.algorithm}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+func TestEffectiveOptionsInline(t *testing.T) {
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       "<%.Name%>",
+		Parameters: map[string]interface{}{"Name": "x"},
+		Delimiters: []string{"<%", "%>"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+
+	options := result.Options
+	if options == nil {
+		t.Fatal("Expected effective options")
+	}
+	if options.Engine != render.GoEngine || options.EncodingFormat != "text/plain" || options.MissingKey != "default" {
+		t.Errorf("Unexpected options %+v", options)
+	}
+	if !reflect.DeepEqual(options.Delimiters, []string{"<%", "%>"}) {
+		t.Errorf("Expected request delimiters, got %v", options.Delimiters)
+	}
+	want := map[string]string{"engine": "default", "encodingFormat": "default", "delimiters": "request", "missingKey": "default", "layout": "default"}
+	for option, source := range want {
+		if options.Sources[option] != source {
+			t.Errorf("Expected %s from %s, got %q", option, source, options.Sources[option])
+		}
+	}
+	if options.Limits.Timeout != renderTimeout.String() || options.Limits.MaxOutputBytes != maxOutputBytes {
+		t.Errorf("Unexpected limits %+v", options.Limits)
+	}
+	if options.Functions.Count != len(templateFuncMap) {
+		t.Errorf("Expected %d functions, got %d", len(templateFuncMap), options.Functions.Count)
+	}
+}
+
+func TestEffectiveOptionsStoredTemplate(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if err := templateStore.put(&storedTemplate{
+		Name:           "greeting",
+		Text:           "Hello {{name}}",
+		Engine:         "mustache",
+		EncodingFormat: "text/html",
+		MissingKey:     "zero",
+		Partials:       map[string]string{"footer": "bye"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		TemplateName:   "greeting",
+		EncodingFormat: "text/markdown",
+		Parameters:     map[string]interface{}{"name": "Ada"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+
+	options := result.Options
+	if options.Engine != "mustache" || options.EncodingFormat != "text/markdown" || options.MissingKey != "zero" {
+		t.Errorf("Unexpected options %+v", options)
+	}
+	if options.Template != "greeting" || options.TemplateVersion != 1 || !reflect.DeepEqual(options.Partials, []string{"footer"}) {
+		t.Errorf("Unexpected template options %+v", options)
+	}
+	want := map[string]string{"engine": "template", "encodingFormat": "request", "missingKey": "template", "delimiters": "default", "template": "request"}
+	for option, source := range want {
+		if options.Sources[option] != source {
+			t.Errorf("Expected %s from %s, got %q", option, source, options.Sources[option])
+		}
+	}
+}
+
+func TestEffectiveOptionsPolicyAndPostProcessors(t *testing.T) {
+	withRenderPolicy(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{"allow": true, "encodingFormat": "text/csv"}})
+	})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hooked"))
+	}))
+	defer hook.Close()
+	postRenderHooks = []string{hook.URL}
+	defer func() { postRenderHooks = nil }()
+	s, err := newOutputSigner("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer = s
+	defer func() { signer = nil }()
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       "x",
+		Assertions: &render.Assertions{MaxLength: 100},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+
+	options := result.Options
+	if options.EncodingFormat != "text/csv" || options.Sources["encodingFormat"] != "policy" {
+		t.Errorf("Expected the policy's encoding format, got %q from %q", options.EncodingFormat, options.Sources["encodingFormat"])
+	}
+	if want := []string{"hook", "assertions", "sign:hmac-sha256"}; !reflect.DeepEqual(options.PostProcessors, want) {
+		t.Errorf("Expected post-processors %v, got %v", want, options.PostProcessors)
+	}
+}
+
+func TestEffectiveOptionsResponse(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/render", strings.NewReader(`{"text": "{{.A}}", "templateParameters": {"A": 1}, "missingKey": "zero"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handleRender(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handleRender() returned error: %v", err)
+	}
+
+	var response struct {
+		EffectiveOptions struct {
+			MissingKey string            `json:"missingKey"`
+			Sources    map[string]string `json:"sources"`
+		} `json:"effectiveOptions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.EffectiveOptions.MissingKey != "zero" || response.EffectiveOptions.Sources["missingKey"] != "request" {
+		t.Errorf("Unexpected effectiveOptions in %s", rec.Body)
+	}
+}
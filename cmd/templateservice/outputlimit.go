@@ -0,0 +1,10 @@
+package main
+
+// maxOutputBytes bounds the rendered output of a single template execution
+// (0 disables the limit)
+var maxOutputBytes int64 = 64 << 20
+
+// configureOutputLimit reads the output size limit from the environment
+func configureOutputLimit() {
+	maxOutputBytes = int64(envInt("TEMPLATE_MAX_OUTPUT_MB", 64)) << 20
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"templateservice/pkg/render"
+)
+
+// pdfFormat is the encoding format of output converted to PDF
+const pdfFormat = "application/pdf"
+
+// pdfConverter is the headless browser used to print HTML output to PDF.
+// Configured via TEMPLATE_PDF_CHROME, otherwise found on the PATH; empty
+// disables conversion.
+var pdfConverter string
+
+// pdfTimeout bounds a single conversion (TEMPLATE_PDF_TIMEOUT)
+var pdfTimeout = time.Minute
+
+// pdfAllowNetwork lets the browser fetch remote stylesheets, fonts and
+// images referenced by the document (TEMPLATE_PDF_ALLOW_NETWORK). Off by
+// default so rendered parameters cannot make the service issue requests.
+var pdfAllowNetwork bool
+
+// pdfNoSandbox runs the browser without its sandbox
+// (TEMPLATE_PDF_NO_SANDBOX), which Chromium requires when running as root.
+// Only for containers that isolate the service themselves.
+var pdfNoSandbox bool
+
+// pdfExtraArgs are additional browser flags (TEMPLATE_PDF_ARGS, comma-separated)
+var pdfExtraArgs []string
+
+// pdfBrowsers are the executables looked up when TEMPLATE_PDF_CHROME is unset
+var pdfBrowsers = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"}
+
+// binaryFormats are output formats that are not text and are base64-encoded
+// where output is embedded in a JSON response
+var binaryFormats = map[string]bool{
+	pdfFormat:  true,
+	docxFormat: true,
+	odtFormat:  true,
+}
+
+// configurePDF loads PDF conversion settings from the environment
+func configurePDF() {
+	pdfConverter = os.Getenv("TEMPLATE_PDF_CHROME")
+	if pdfConverter == "" {
+		for _, name := range pdfBrowsers {
+			if path, err := exec.LookPath(name); err == nil {
+				pdfConverter = path
+				break
+			}
+		}
+	}
+	pdfTimeout = envDuration("TEMPLATE_PDF_TIMEOUT", pdfTimeout)
+	pdfAllowNetwork = envBool("TEMPLATE_PDF_ALLOW_NETWORK", false)
+	pdfNoSandbox = envBool("TEMPLATE_PDF_NO_SANDBOX", false)
+	pdfExtraArgs = envList("TEMPLATE_PDF_ARGS")
+
+	if pdfConverter != "" {
+		logger.Infof("PDF output enabled using %s", pdfConverter)
+	}
+}
+
+// convertOutput converts the rendered output to the format requested with
+// convertTo. Only HTML can be converted, to PDF.
+func convertOutput(ctx context.Context, req renderRequest, result *renderResult) error {
+	if req.ConvertTo == "" {
+		return nil
+	}
+	if req.ConvertTo != pdfFormat {
+		return &render.Error{Message: fmt.Sprintf("unsupported convertTo %q, only %s is supported", req.ConvertTo, pdfFormat), Status: http.StatusBadRequest}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(result.EncodingFormat); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return &render.Error{Message: fmt.Sprintf("cannot convert %s output to PDF, the encoding format must be text/html", result.EncodingFormat), Status: http.StatusBadRequest}
+	}
+	if pdfConverter == "" {
+		return &render.Error{Message: "PDF conversion is not configured", Status: http.StatusNotImplemented}
+	}
+
+	spanCtx, span := startSpan(ctx, "output.convert", spanKindInternal)
+	span.SetAttributes(attribute.String("output.format", pdfFormat))
+	pdf, err := printPDF(spanCtx, result.Output, result.Trusted)
+	endSpan(span, err)
+	if err != nil {
+		var re *render.Error
+		if errors.As(err, &re) {
+			return err
+		}
+		return &render.Error{Message: "PDF conversion failed", Status: http.StatusBadGateway, Err: err}
+	}
+	result.Output = string(pdf)
+	result.EncodingFormat = pdfFormat
+	return nil
+}
+
+// printPDF prints an HTML document to PDF with the headless browser in a
+// scratch workspace. The browser loads the document from a loopback
+// server rather than a file:// URL, so the document cannot read local
+// files. Scripts only run for trusted stored templates.
+func printPDF(ctx context.Context, html string, trusted bool) ([]byte, error) {
+	if workspaces == nil {
+		return nil, errors.New("no workspace directory configured")
+	}
+	ws, err := workspaces.create("pdf")
+	if err != nil {
+		return nil, err
+	}
+	defer ws.release()
+
+	// The copy in the workspace counts towards its quota
+	if _, err := ws.writeFile("document.html", []byte(html)); err != nil {
+		return nil, err
+	}
+	out, err := ws.path("document.pdf")
+	if err != nil {
+		return nil, err
+	}
+	profile, err := ws.path("profile")
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := servePDFDocument([]byte(html), trusted)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.close()
+
+	args := []string{
+		"--headless",
+		"--disable-gpu",
+		"--no-first-run",
+		"--no-pdf-header-footer",
+		"--user-data-dir=" + profile,
+		"--print-to-pdf=" + out,
+	}
+	if pdfNoSandbox {
+		args = append(args, "--no-sandbox")
+	}
+	if !pdfAllowNetwork {
+		// Route every request, loopback included, to the document server,
+		// which refuses all but the document
+		args = append(args, "--proxy-server=http://"+doc.host, "--proxy-bypass-list=<-loopback>")
+	}
+	if !trusted {
+		args = append(args, "--blink-settings=scriptEnabled=false")
+	}
+	args = append(args, pdfExtraArgs...)
+	args = append(args, doc.url())
+
+	convertCtx, cancel := context.WithTimeout(ctx, pdfTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(convertCtx, pdfConverter, args...)
+	cmd.Dir = ws.Dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if convertCtx.Err() == context.DeadlineExceeded {
+			return nil, &render.Error{Message: fmt.Sprintf("PDF conversion exceeded %s", pdfTimeout), Status: http.StatusGatewayTimeout, Err: err}
+		}
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, fmt.Errorf("%w: %s", err, lastLine(msg))
+		}
+		return nil, err
+	}
+
+	pdf, err := os.ReadFile(out)
+	if err != nil {
+		return nil, fmt.Errorf("no PDF written: %w", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		return nil, errors.New("converter did not produce a PDF document")
+	}
+	return pdf, nil
+}
+
+// pdfDocumentServer serves a document being printed to the browser on a
+// loopback port under an unguessable path. Without network access it is
+// also the browser's proxy, so every other request of the document reaches
+// it and is refused.
+type pdfDocumentServer struct {
+	host   string // Address the server listens on
+	path   string
+	html   []byte
+	policy string // Content-Security-Policy of the document
+	server *http.Server
+}
+
+// servePDFDocument starts serving html until close is called
+func servePDFDocument(html []byte, trusted bool) (*pdfDocumentServer, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve the document to the browser: %w", err)
+	}
+	doc := &pdfDocumentServer{
+		host:   listener.Addr().String(),
+		path:   "/" + hex.EncodeToString(token) + "/document.html",
+		html:   html,
+		policy: pdfContentPolicy(pdfAllowNetwork, trusted),
+	}
+	doc.server = &http.Server{Handler: doc, ReadHeaderTimeout: 10 * time.Second}
+	go doc.server.Serve(listener)
+	return doc, nil
+}
+
+// pdfContentPolicy returns the Content-Security-Policy of printed
+// documents: inline data: resources, and remote ones if the network is
+// allowed. No source matches file:// URLs.
+func pdfContentPolicy(allowNetwork, trusted bool) string {
+	sources := "data:"
+	if allowNetwork {
+		sources = "http: https: data:"
+	}
+	policy := "default-src 'none'; img-src " + sources + "; font-src " + sources + "; media-src " + sources +
+		"; style-src 'unsafe-inline' " + sources
+	if trusted {
+		policy += "; script-src 'unsafe-inline' " + sources
+	}
+	return policy
+}
+
+func (d *pdfDocumentServer) url() string {
+	return "http://" + d.host + d.path
+}
+
+func (d *pdfDocumentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.Host != d.host || r.URL.Path != d.path {
+		http.Error(w, "blocked by the PDF converter", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", d.policy)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(d.html)
+}
+
+func (d *pdfDocumentServer) close() {
+	d.server.Close()
+}
+
+// lastLine returns the last line of a command's diagnostic output
+func lastLine(msg []byte) string {
+	if i := bytes.LastIndexByte(msg, '\n'); i >= 0 {
+		msg = msg[i+1:]
+	}
+	return string(msg)
+}
+
+// jsonOutput returns output for embedding in a JSON response together with
+// its contentEncoding: binary formats are base64-encoded, text is returned as-is
+func jsonOutput(encodingFormat, output string) (string, string) {
+	if mediaType, _, _ := mime.ParseMediaType(encodingFormat); binaryFormats[mediaType] {
+		return base64.StdEncoding.EncodeToString([]byte(output)), "base64"
+	}
+	return output, ""
+}
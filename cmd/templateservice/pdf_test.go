@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// fakePDFConverter installs a script standing in for the browser. It writes
+// a minimal PDF followed by its arguments so tests can inspect them.
+func fakePDFConverter(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake converter is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "chromium")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	m, err := newWorkspaceManager(t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldConverter, oldWorkspaces := pdfConverter, workspaces
+	pdfConverter, workspaces = path, m
+	t.Cleanup(func() { pdfConverter, workspaces = oldConverter, oldWorkspaces })
+}
+
+const printArgsScript = `for a in "$@"; do
+  case "$a" in --print-to-pdf=*) out="${a#--print-to-pdf=}";; esac
+done
+printf '%%PDF-1.7\n\377\376\n' > "$out"
+echo "$@" >> "$out"
+`
+
+func TestConvertOutputPDF(t *testing.T) {
+	fakePDFConverter(t, printArgsScript)
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:           "<h1>Invoice {{.Number}}</h1>",
+		Parameters:     map[string]interface{}{"Number": 42},
+		EncodingFormat: "text/html",
+		ConvertTo:      pdfFormat,
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if !strings.HasPrefix(result.Output, "%PDF-1.7\n\377\376") {
+		t.Errorf("Expected PDF output, got %q", result.Output)
+	}
+	if result.EncodingFormat != pdfFormat {
+		t.Errorf("Expected encoding format %s, got %q", pdfFormat, result.EncodingFormat)
+	}
+	if result.SHA256 != sha256Hex([]byte(result.Output)) {
+		t.Error("Expected the checksum to describe the PDF")
+	}
+	// Inline templates are untrusted and the network is off by default
+	for _, arg := range []string{"--headless", "--blink-settings=scriptEnabled=false", "--proxy-server=http://127.0.0.1:", " http://127.0.0.1:"} {
+		if !strings.Contains(result.Output, arg) {
+			t.Errorf("Expected converter argument %q in %q", arg, result.Output)
+		}
+	}
+	// The document is not loaded from disk, and the sandbox stays on
+	for _, arg := range []string{"file://", "--no-sandbox"} {
+		if strings.Contains(result.Output, arg) {
+			t.Errorf("Unexpected converter argument %q in %q", arg, result.Output)
+		}
+	}
+	if stats := workspaces.snapshot(); stats.Active != 0 {
+		t.Errorf("Expected the workspace to be released, %d active", stats.Active)
+	}
+}
+
+func TestPDFDocumentServer(t *testing.T) {
+	html := `<img src="file:///etc/passwd"><iframe src="file:///etc/passwd"></iframe>`
+	doc, err := servePDFDocument([]byte(html), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.close()
+
+	resp, err := http.Get(doc.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != html {
+		t.Fatalf("Expected the document, got %d %q", resp.StatusCode, body)
+	}
+	policy := resp.Header.Get("Content-Security-Policy")
+	if !strings.HasPrefix(policy, "default-src 'none'") || strings.Contains(policy, "file:") || strings.Contains(policy, "script-src") {
+		t.Errorf("Content-Security-Policy %q lets the document load local files or run scripts", policy)
+	}
+
+	// As the browser's proxy, the server refuses every other request,
+	// file:/// subresources included
+	for _, request := range []string{
+		"GET file:///etc/passwd HTTP/1.1\r\nHost: \r\n\r\n",
+		"GET http://169.254.169.254/latest/meta-data/ HTTP/1.1\r\nHost: 169.254.169.254\r\n\r\n",
+		"GET http://" + doc.host + "/document.html HTTP/1.1\r\nHost: " + doc.host + "\r\n\r\n",
+		"CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+		"POST " + doc.url() + " HTTP/1.1\r\nHost: " + doc.host + "\r\nContent-Length: 0\r\n\r\n",
+	} {
+		conn, err := net.Dial("tcp", doc.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(conn, request)
+		status, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if !strings.Contains(status, " 403 ") {
+			t.Errorf("Expected %q to be refused, got %q", strings.SplitN(request, "\r\n", 2)[0], status)
+		}
+	}
+
+	if policy := pdfContentPolicy(true, true); !strings.Contains(policy, "script-src 'unsafe-inline' http: https: data:") || strings.Contains(policy, "file:") {
+		t.Errorf("Unexpected policy of trusted documents with network access: %q", policy)
+	}
+}
+
+func TestConvertOutputErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		req    renderRequest
+		status int
+	}{
+		{"unsupported format", printArgsScript, renderRequest{Text: "<p>x</p>", EncodingFormat: "text/html", ConvertTo: "image/png"}, http.StatusBadRequest},
+		{"not html", printArgsScript, renderRequest{Text: "x", ConvertTo: pdfFormat}, http.StatusBadRequest},
+		{"converter fails", "echo 'cannot open display' >&2\nexit 1\n", renderRequest{Text: "<p>x</p>", EncodingFormat: "text/html", ConvertTo: pdfFormat}, http.StatusBadGateway},
+		{"no pdf written", "exit 0\n", renderRequest{Text: "<p>x</p>", EncodingFormat: "text/html", ConvertTo: pdfFormat}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePDFConverter(t, tt.script)
+			_, err := renderTemplate(context.Background(), tt.req)
+			var re *render.Error
+			if !errors.As(err, &re) {
+				t.Fatalf("Expected *render.Error, got %v", err)
+			}
+			if re.Status != tt.status {
+				t.Errorf("Expected status %d, got %d (%v)", tt.status, re.Status, err)
+			}
+		})
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		old := pdfConverter
+		pdfConverter = ""
+		defer func() { pdfConverter = old }()
+
+		_, err := renderTemplate(context.Background(), renderRequest{Text: "<p>x</p>", EncodingFormat: "text/html", ConvertTo: pdfFormat})
+		var re *render.Error
+		if !errors.As(err, &re) || re.Status != http.StatusNotImplemented {
+			t.Errorf("Expected 501, got %v", err)
+		}
+	})
+}
+
+func TestPDFResponses(t *testing.T) {
+	fakePDFConverter(t, printArgsScript)
+	e := echo.New()
+	body := `{"template": "<h1>{{.Title}}</h1>", "parameters": {"Title": "Report"}, "encodingFormat": "text/html", "convertTo": "application/pdf"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render/raw", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := renderTemplateRaw(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("renderTemplateRaw() returned error: %v", err)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != pdfFormat {
+		t.Errorf("Expected Content-Type %s, got %q", pdfFormat, ct)
+	}
+	raw := rec.Body.String()
+	if !strings.HasPrefix(raw, "%PDF-") {
+		t.Errorf("Expected the PDF as the body, got %q", raw)
+	}
+
+	// The legacy request's encodingFormat names the template format, so
+	// its output format comes from the stored template
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if err := templateStore.put(&storedTemplate{Name: "report", Text: "<h1>{{.Title}}</h1>", EncodingFormat: "text/html"}); err != nil {
+		t.Fatal(err)
+	}
+	body = `{"templateName": "report", "templateParameters": {"Title": "Report"}, "convertTo": "application/pdf"}`
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/render", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	if err := handleRender(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handleRender() returned error: %v", err)
+	}
+	var response TemplateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.ContentEncoding != "base64" {
+		t.Fatalf("Expected base64 content encoding, got %q", response.ContentEncoding)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(response.Text)
+	if err != nil {
+		t.Fatalf("Output is not base64: %v", err)
+	}
+	if sha256Hex(decoded) != response.Sha256 || response.ContentSize != int64(len(decoded)) {
+		t.Error("Expected sha256 and contentSize to describe the decoded PDF")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	if text, enc := jsonOutput("text/html", "<p>x</p>"); text != "<p>x</p>" || enc != "" {
+		t.Errorf("Text output should be unchanged, got %q %q", text, enc)
+	}
+	if text, enc := jsonOutput("application/pdf", "%PDF\xff"); text != "JVBERv8=" || enc != "base64" {
+		t.Errorf("Binary output should be base64-encoded, got %q %q", text, enc)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"strings"
+	"text/template"
+
+	"templateservice/pkg/render"
+)
+
+// Deployments add domain-specific template functions without forking the
+// service through render.FuncProvider: providers register from an init
+// function of a package linked into the binary, or of a Go plugin
+// (go build -buildmode=plugin) listed in TEMPLATE_FUNC_PLUGINS. A plugin
+// may instead export a FuncProvider variable. No plugin function reaches
+// templates unless TEMPLATE_PLUGIN_FUNCS allows it.
+
+// funcPluginSymbol is the optional provider a plugin exports
+const funcPluginSymbol = "FuncProvider"
+
+// funcPlugins are the plugin files loaded at startup, handed on to sandbox
+// processes so they render with the same functions
+var funcPlugins []string
+
+// pluginFuncs are the allowed plugin functions, added to templateFuncMap
+var pluginFuncs template.FuncMap
+
+// configurePluginFuncs loads the plugins of TEMPLATE_FUNC_PLUGINS and
+// selects the provider functions TEMPLATE_PLUGIN_FUNCS allows: function
+// names, "<provider>.*" for all functions of a provider, or "*". Functions
+// may not replace built-in ones, and allowed names no provider supplies
+// are rejected, so a typo does not go unnoticed. Inline-only mode (see
+// inlineonly.go) loads no plugins.
+func configurePluginFuncs() error {
+	if inlineOnly {
+		funcPlugins, pluginFuncs = nil, nil
+		if len(envList("TEMPLATE_FUNC_PLUGINS")) > 0 || len(envList("TEMPLATE_PLUGIN_FUNCS")) > 0 {
+			logger.Warn("Inline-only mode: plugin template functions are not loaded")
+		}
+		return nil
+	}
+	funcPlugins = envList("TEMPLATE_FUNC_PLUGINS")
+	if err := loadFuncPlugins(funcPlugins); err != nil {
+		return err
+	}
+	funcs, err := allowedPluginFuncs(render.FuncProviders(), envList("TEMPLATE_PLUGIN_FUNCS"))
+	if err != nil {
+		return err
+	}
+	pluginFuncs = funcs
+	if len(pluginFuncs) > 0 {
+		names := make([]string, 0, len(pluginFuncs))
+		for name := range pluginFuncs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		logger.Infof("Plugin template functions enabled: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// loadFuncPlugins opens Go plugins, which register their providers when
+// initialized or export one as FuncProvider
+func loadFuncPlugins(paths []string) error {
+	for _, path := range paths {
+		p, err := plugin.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to load function plugin %s: %w", path, err)
+		}
+		symbol, err := p.Lookup(funcPluginSymbol)
+		if err != nil {
+			continue // Registered from init
+		}
+		switch provider := symbol.(type) {
+		case *render.FuncProvider:
+			render.RegisterFuncProvider(*provider)
+		case render.FuncProvider:
+			render.RegisterFuncProvider(provider)
+		default:
+			return fmt.Errorf("function plugin %s: %s is a %T, not a render.FuncProvider", path, funcPluginSymbol, symbol)
+		}
+	}
+	return nil
+}
+
+// allowedPluginFuncs returns the functions of providers that the allowlist
+// names
+func allowedPluginFuncs(providers []render.FuncProvider, allowlist []string) (template.FuncMap, error) {
+	allowed := make(map[string]bool, len(allowlist))
+	for _, entry := range allowlist {
+		allowed[entry] = true
+	}
+	builtin := render.Funcs(true)
+	funcs := template.FuncMap{}
+	origin := map[string]string{}
+	matched := map[string]bool{"*": true}
+	for _, provider := range providers {
+		wildcard := provider.Name() + ".*"
+		for name, fn := range provider.Funcs() {
+			if !allowed["*"] && !allowed[wildcard] && !allowed[name] {
+				continue
+			}
+			if _, ok := builtin[name]; ok {
+				return nil, fmt.Errorf("plugin function %q of %s would replace a built-in function", name, provider.Name())
+			}
+			if other, ok := origin[name]; ok {
+				return nil, fmt.Errorf("plugin function %q is provided by both %s and %s", name, other, provider.Name())
+			}
+			funcs[name], origin[name] = fn, provider.Name()
+			matched[name], matched[wildcard] = true, true
+		}
+	}
+	var unknown []string
+	for entry := range allowed {
+		if !matched[entry] {
+			unknown = append(unknown, entry)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("TEMPLATE_PLUGIN_FUNCS names functions no plugin provides: %s", strings.Join(unknown, ", "))
+	}
+	return funcs, nil
+}
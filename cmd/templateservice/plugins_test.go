@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"templateservice/pkg/render"
+)
+
+func init() {
+	render.RegisterFuncProvider(render.NewFuncProvider("billing", template.FuncMap{
+		"vatRate":   func(country string) string { return map[string]string{"DE": "19%", "FR": "20%"}[country] },
+		"invoiceNo": func(n int) string { return fmt.Sprintf("INV-%05d", n) },
+	}))
+}
+
+// withPluginFuncs configures the plugin functions of allowlist for a test
+func withPluginFuncs(t *testing.T, allowlist string) error {
+	t.Helper()
+	t.Setenv("TEMPLATE_PLUGIN_FUNCS", allowlist)
+	t.Cleanup(func() {
+		pluginFuncs = nil
+		configureTemplateFuncs()
+	})
+	if err := configurePluginFuncs(); err != nil {
+		return err
+	}
+	configureTemplateFuncs()
+	return nil
+}
+
+func TestPluginFuncs(t *testing.T) {
+	if err := withPluginFuncs(t, "vatRate"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       `{{vatRate .country}}`,
+		Parameters: map[string]interface{}{"country": "DE"},
+	})
+	if err != nil || result.Output != "19%" {
+		t.Errorf("Render with a plugin function = %v, %v", result, err)
+	}
+	// Functions the allowlist does not name stay unavailable
+	if _, err := renderTemplate(context.Background(), renderRequest{Text: `{{invoiceNo 7}}`}); err == nil {
+		t.Error("A function missing from the allowlist was available to templates")
+	}
+
+	if err := withPluginFuncs(t, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := templateFuncMap["vatRate"]; ok {
+		t.Error("Plugin functions are exposed without an allowlist")
+	}
+	if err := withPluginFuncs(t, "billing.*"); err != nil || templateFuncMap["vatRate"] == nil || templateFuncMap["invoiceNo"] == nil {
+		t.Errorf("Allowing all functions of a provider = %v", err)
+	}
+}
+
+func TestAllowedPluginFuncs_Errors(t *testing.T) {
+	shadowing := render.NewFuncProvider("strings", template.FuncMap{"upper": strings.ToUpper})
+	if _, err := allowedPluginFuncs([]render.FuncProvider{shadowing}, []string{"*"}); err == nil || !strings.Contains(err.Error(), "replace a built-in") {
+		t.Errorf("Replacing a built-in function = %v", err)
+	}
+	duplicate := []render.FuncProvider{
+		render.NewFuncProvider("a", template.FuncMap{"tax": strings.TrimSpace}),
+		render.NewFuncProvider("b", template.FuncMap{"tax": strings.TrimSpace}),
+	}
+	if _, err := allowedPluginFuncs(duplicate, []string{"tax"}); err == nil || !strings.Contains(err.Error(), "both a and b") {
+		t.Errorf("A function of two providers = %v", err)
+	}
+	if _, err := allowedPluginFuncs(duplicate[:1], []string{"tax", "vat", "c.*"}); err == nil || !strings.Contains(err.Error(), "no plugin provides: c.*, vat") {
+		t.Errorf("Allowing unknown functions = %v", err)
+	}
+	if err := loadFuncPlugins([]string{filepath.Join(t.TempDir(), "missing.so")}); err == nil {
+		t.Error("Loading a missing plugin succeeded")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+// maxPolicyResponseSize caps the body accepted from the policy endpoint
+const maxPolicyResponseSize = 1 << 20
+
+// policyURL is the OPA data API endpoint (or compatible service) consulted
+// before every render, e.g. http://opa:8181/v1/data/templateservice/render.
+// Empty disables policy evaluation.
+var policyURL string
+
+// policyFailOpen allows renders when the policy endpoint cannot be reached
+var policyFailOpen bool
+
+var policyClient = &http.Client{Timeout: 5 * time.Second}
+
+// configureRenderPolicy loads the policy endpoint settings from the environment
+func configureRenderPolicy() {
+	policyURL = os.Getenv("TEMPLATE_POLICY_URL")
+	policyFailOpen = envBool("TEMPLATE_POLICY_FAIL_OPEN", false)
+	policyClient.Timeout = envDuration("TEMPLATE_POLICY_TIMEOUT", policyClient.Timeout)
+
+	if policyURL != "" {
+		logger.Infof("Render policy evaluated by %s", policyURL)
+	}
+}
+
+// renderCaller identifies who requested a render, for policy decisions
+type renderCaller struct {
+	Principal string `json:"principal,omitempty"` // API key prefix or signing key ID
+	ClientIP  string `json:"clientIp,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"` // Method and route, e.g. "POST /v1/api/render"
+	Tenant    string `json:"tenant,omitempty"`   // Provisioned namespace or mapped host of the caller (see tenanthosts.go)
+}
+
+type renderCallerKey struct{}
+
+// withRenderCaller returns ctx annotated with the caller of a render
+func withRenderCaller(ctx context.Context, caller renderCaller) context.Context {
+	return context.WithValue(ctx, renderCallerKey{}, caller)
+}
+
+// renderCallerFrom returns the caller stored in ctx, if any
+func renderCallerFrom(ctx context.Context) renderCaller {
+	caller, _ := ctx.Value(renderCallerKey{}).(renderCaller)
+	return caller
+}
+
+// policyInput is the OPA input document. Parameter values are not sent,
+// only their names and encoded size.
+type policyInput struct {
+	Caller     renderCaller         `json:"caller"`
+	Template   policyTemplate       `json:"template"`
+	Parameters policyParameterStats `json:"parameters"`
+	Output     policyOutput         `json:"output"`
+}
+
+type policyTemplate struct {
+	Name     string   `json:"name,omitempty"`     // Stored template name
+	Version  int      `json:"version,omitempty"`  // Requested stored version (0 = latest)
+	Path     string   `json:"path,omitempty"`     // Template file or URL
+	Inline   bool     `json:"inline"`             // Template text supplied by the caller
+	Trusted  bool     `json:"trusted"`            // Stored template marked trusted
+	Partials []string `json:"partials,omitempty"` // Partial names
+	Layout   string   `json:"layout,omitempty"`   // Stored layout
+}
+
+type policyParameterStats struct {
+	Keys []string `json:"keys"`
+	Size int      `json:"size"` // Bytes of the JSON-encoded parameters
+}
+
+type policyOutput struct {
+	EncodingFormat string `json:"encodingFormat"`
+}
+
+// policyDecision is the OPA result document. A plain boolean result is
+// also accepted. Modifications are applied to allowed requests.
+type policyDecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`     // Merged over the request parameters
+	EncodingFormat string                 `json:"encodingFormat,omitempty"` // Replaces the output format
+	MissingKey     string                 `json:"missingKey,omitempty"`     // Replaces the missing key mode
+}
+
+// evaluateRenderPolicy asks the policy endpoint whether req may be
+// rendered and applies the modifications it returns
+func evaluateRenderPolicy(ctx context.Context, req renderRequest) (renderRequest, error) {
+	if policyURL == "" {
+		return req, nil
+	}
+
+	input, err := renderPolicyInput(ctx, req)
+	if err != nil {
+		return req, &render.Error{Message: "failed to prepare policy input", Status: http.StatusInternalServerError, Err: err}
+	}
+	decision, err := queryPolicy(ctx, input)
+	if err != nil {
+		if policyFailOpen {
+			logger.WithError(err).Error("Render policy unavailable, allowing render (fail open)")
+			return req, nil
+		}
+		return req, &render.Error{Message: "render policy unavailable", Status: http.StatusServiceUnavailable, Err: err}
+	}
+	if !decision.Allow {
+		message := "render denied by policy"
+		if decision.Reason != "" {
+			message += ": " + decision.Reason
+		}
+		return req, &render.Error{Message: message, Status: http.StatusForbidden}
+	}
+
+	if len(decision.Parameters) > 0 {
+		parameters := make(map[string]interface{}, len(req.Parameters)+len(decision.Parameters))
+		for key, value := range req.Parameters {
+			parameters[key] = value
+		}
+		for key, value := range decision.Parameters {
+			parameters[key] = value
+		}
+		req.Parameters = parameters
+	}
+	if decision.EncodingFormat != "" {
+		req.EncodingFormat = decision.EncodingFormat
+	}
+	if decision.MissingKey != "" {
+		req.MissingKey = decision.MissingKey
+		req.MissingValue = nil
+	}
+	return req, nil
+}
+
+func renderPolicyInput(ctx context.Context, req renderRequest) (policyInput, error) {
+	encoded, err := json.Marshal(req.Parameters)
+	if err != nil {
+		return policyInput{}, err
+	}
+	keys := make([]string, 0, len(req.Parameters))
+	for key := range req.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encodingFormat := req.EncodingFormat
+	if encodingFormat == "" {
+		encodingFormat = "text/plain"
+	}
+
+	return policyInput{
+		Caller: renderCallerFrom(ctx),
+		Template: policyTemplate{
+			Name:     req.TemplateName,
+			Version:  req.TemplateVersion,
+			Path:     req.Identifier,
+			Inline:   req.TemplateName == "" && req.Identifier == "" && req.Text != "",
+			Trusted:  req.Trusted,
+			Partials: sortedKeys(req.Partials),
+			Layout:   req.Layout,
+		},
+		Parameters: policyParameterStats{Keys: keys, Size: len(encoded)},
+		Output:     policyOutput{EncodingFormat: encodingFormat},
+	}, nil
+}
+
+// queryPolicy posts the input to the OPA data API and decodes its result
+func queryPolicy(ctx context.Context, input policyInput) (*policyDecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, policyURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	injectTraceContext(ctx, httpReq.Header)
+
+	resp, err := policyClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPolicyResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy endpoint returned status %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid policy response: %w", err)
+	}
+
+	// An undefined result (no rule matched) denies
+	decision := &policyDecision{}
+	if len(envelope.Result) == 0 {
+		decision.Reason = "no policy decision"
+		return decision, nil
+	}
+	if err := json.Unmarshal(envelope.Result, &decision.Allow); err == nil {
+		return decision, nil
+	}
+	if err := json.Unmarshal(envelope.Result, decision); err != nil {
+		return nil, fmt.Errorf("invalid policy result: %w", err)
+	}
+	return decision, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func withRenderPolicy(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := policyURL
+	policyURL = server.URL
+	t.Cleanup(func() {
+		policyURL = previous
+		server.Close()
+	})
+}
+
+func TestRenderPolicy(t *testing.T) {
+	var received policyInput
+	withRenderPolicy(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input policyInput `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		received = body.Input
+
+		result := map[string]interface{}{"allow": true, "parameters": map[string]interface{}{"Env": "prod"}}
+		if received.Caller.Principal == "blocked" {
+			result = map[string]interface{}{"allow": false, "reason": "caller suspended"}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	})
+
+	ctx := withRenderCaller(context.Background(), renderCaller{Principal: "tsk_live", Endpoint: "POST /v1/api/render"})
+	result, err := renderTemplate(ctx, renderRequest{
+		Text:       "{{.Name}}@{{.Env}}",
+		Parameters: map[string]interface{}{"Name": "api", "Env": "dev"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if result.Output != "api@prod" {
+		t.Errorf("Expected policy to override parameters, got %q", result.Output)
+	}
+	if received.Caller.Principal != "tsk_live" || !received.Template.Inline || len(received.Parameters.Keys) != 2 {
+		t.Errorf("Unexpected policy input %+v", received)
+	}
+
+	ctx = withRenderCaller(context.Background(), renderCaller{Principal: "blocked"})
+	_, err = renderTemplate(ctx, renderRequest{Text: "x"})
+	var renderErr *render.Error
+	if !errors.As(err, &renderErr) || renderErr.Status != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %v", err)
+	}
+	if renderErr.Message != "render denied by policy: caller suspended" {
+		t.Errorf("Unexpected message %q", renderErr.Message)
+	}
+}
+
+func TestRenderPolicyResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		failOpen bool
+		expected int // 0 = allowed
+	}{
+		{"boolean allow", http.StatusOK, `{"result": true}`, false, 0},
+		{"boolean deny", http.StatusOK, `{"result": false}`, false, http.StatusForbidden},
+		{"undefined", http.StatusOK, `{}`, false, http.StatusForbidden},
+		{"unavailable", http.StatusInternalServerError, ``, false, http.StatusServiceUnavailable},
+		{"unavailable fail open", http.StatusInternalServerError, ``, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withRenderPolicy(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			policyFailOpen = tt.failOpen
+			t.Cleanup(func() { policyFailOpen = false })
+
+			_, err := renderTemplate(context.Background(), renderRequest{Text: "x"})
+			var renderErr *render.Error
+			switch {
+			case tt.expected == 0 && err != nil:
+				t.Errorf("Expected render to be allowed, got %v", err)
+			case tt.expected != 0 && (!errors.As(err, &renderErr) || renderErr.Status != tt.expected):
+				t.Errorf("Expected %d, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sseHeartbeat is how often an idle event stream sends a keep-alive comment
+const sseHeartbeat = 15 * time.Second
+
+// jobProgress tracks how far the current attempt of a job has got
+type jobProgress struct {
+	Total     int        `json:"total"`
+	Done      int        `json:"done"`
+	Failed    int        `json:"failed"`
+	Skipped   int        `json:"skipped"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+// jobProgressView is the client-facing progress of a job with derived
+// percentage and estimated completion time
+type jobProgressView struct {
+	jobProgress
+	Percent    float64    `json:"percent"`
+	ETA        *time.Time `json:"eta,omitempty"`
+	ETASeconds *float64   `json:"etaSeconds,omitempty"`
+}
+
+// view derives the percentage and ETA of the progress at now. The ETA
+// extrapolates the average item duration of the current attempt.
+func (p jobProgress) view(now time.Time) jobProgressView {
+	v := jobProgressView{jobProgress: p}
+	processed := p.Done + p.Failed + p.Skipped
+	if p.Total > 0 {
+		v.Percent = float64(processed) * 100 / float64(p.Total)
+	}
+	if p.StartedAt != nil && processed > 0 && processed < p.Total {
+		perItem := now.Sub(*p.StartedAt) / time.Duration(processed)
+		remaining := perItem * time.Duration(p.Total-processed)
+		eta := now.Add(remaining).UTC()
+		seconds := remaining.Seconds()
+		v.ETA = &eta
+		v.ETASeconds = &seconds
+	}
+	return v
+}
+
+// subscribe registers for change notifications of a job. The returned channel
+// receives a signal (coalesced, never blocking the sender) whenever the job's
+// status or progress changes; the caller re-reads the job to get its state.
+func (m *jobManager) subscribe(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	m.mu.Lock()
+	if m.watchers[id] == nil {
+		m.watchers[id] = make(map[chan struct{}]struct{})
+	}
+	m.watchers[id][ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.watchers[id], ch)
+		if len(m.watchers[id]) == 0 {
+			delete(m.watchers, id)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// notify signals the subscribers of a job. Callers hold m.mu.
+func (m *jobManager) notify(id string) {
+	for ch := range m.watchers[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// handleJobEvents handles GET /v1/api/jobs/:id/events, streaming the job
+// status as server-sent events until the job completes or is dead-lettered.
+// Like the result, the events of a job submitted with credentials are only
+// streamed to its submitter.
+func handleJobEvents(c echo.Context) error {
+	id := c.Param("id")
+	if job, ok := jobs.get(id); !ok || !jobVisibleTo(job, renderCallerFrom(c.Request().Context())) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+	}
+
+	changes, unsubscribe := jobs.subscribe(id)
+	defer unsubscribe()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		// Read after subscribing so no change between the two is missed
+		job, _ := jobs.get(id)
+		event := "progress"
+		final := job.Status == jobCompleted || job.Status == jobDead
+		if final {
+			event = string(job.Status)
+		}
+		if err := writeSSE(res, event, newJobStatusResponse(job)); err != nil {
+			return nil
+		}
+		if final {
+			return nil
+		}
+
+	wait:
+		for {
+			select {
+			case <-changes:
+				break wait
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			case <-c.Request().Context().Done():
+				return nil
+			case <-jobs.ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// writeSSE writes a single server-sent event with a JSON payload
+func writeSSE(res *echo.Response, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SCIM schema URNs of the provisioning resources and messages
+const (
+	scimNamespaceSchema = "urn:evalgo:params:scim:schemas:templateservice:2.0:Namespace"
+	scimAPIKeySchema    = "urn:evalgo:params:scim:schemas:templateservice:2.0:ApiKey"
+	scimListSchema      = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema     = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// scimContentType is the media type of provisioning responses (RFC 7644)
+const scimContentType = "application/scim+json"
+
+// provisionedKeyPrefix starts every generated key
+const provisionedKeyPrefix = "tsk_"
+
+// scimMeta is the SCIM resource metadata
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// provisionedNamespace groups the templates whose names match Templates
+type provisionedNamespace struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Templates   string   `json:"templates"` // Glob over template names, default "<id>-*"
+	Active      bool     `json:"active"`
+	Meta        scimMeta `json:"meta"`
+}
+
+// keyRole is a role a provisioned key holds in a namespace
+type keyRole struct {
+	Namespace string `json:"namespace"`
+	Role      string `json:"role"`
+}
+
+// provisionedKey is an API key created through the provisioning API. The
+// key itself is returned once, on creation; only its SHA-256 is kept.
+type provisionedKey struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id"` // The key's prefix
+	DisplayName string    `json:"displayName,omitempty"`
+	Roles       []keyRole `json:"roles"`
+	Scopes      []string  `json:"scopes,omitempty"` // Endpoints the key may call, all when empty
+	Active      bool      `json:"active"`
+	Meta        scimMeta  `json:"meta"`
+	Key         string    `json:"key,omitempty"` // Only in the creation response
+	Hash        string    `json:"hash,omitempty"`
+}
+
+// provisioningStore keeps the provisioned namespaces and keys, in
+// TEMPLATE_PROVISIONING_FILE when set
+type provisioningStore struct {
+	file string
+	now  func() time.Time
+
+	mu         sync.RWMutex
+	namespaces map[string]*provisionedNamespace
+	keys       map[string]*provisionedKey // By prefix
+}
+
+var provisioning = newProvisioningStore("")
+
+func newProvisioningStore(file string) *provisioningStore {
+	return &provisioningStore{
+		file:       file,
+		now:        time.Now,
+		namespaces: make(map[string]*provisionedNamespace),
+		keys:       make(map[string]*provisionedKey),
+	}
+}
+
+// configureProvisioning loads the namespaces and keys persisted in
+// TEMPLATE_PROVISIONING_FILE
+func configureProvisioning() error {
+	store := newProvisioningStore(os.Getenv("TEMPLATE_PROVISIONING_FILE"))
+	if store.file != "" {
+		if err := store.load(); err != nil {
+			return fmt.Errorf("TEMPLATE_PROVISIONING_FILE: %w", err)
+		}
+		logger.Infof("Loaded %d provisioned namespaces and %d keys from %s", len(store.namespaces), len(store.keys), store.file)
+	}
+	provisioning = store
+	return nil
+}
+
+// provisioningState is the persisted form of the store
+type provisioningState struct {
+	Namespaces []*provisionedNamespace `json:"namespaces"`
+	Keys       []*provisionedKey       `json:"keys"`
+}
+
+func (s *provisioningStore) load() error {
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state provisioningState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for _, ns := range state.Namespaces {
+		s.namespaces[ns.ID] = ns
+	}
+	for _, key := range state.Keys {
+		s.keys[key.ID] = key
+	}
+	return nil
+}
+
+// save persists the store. The caller holds s.mu.
+func (s *provisioningStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+	state := provisioningState{Namespaces: s.sortedNamespaces(), Keys: s.sortedKeys()}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.file, data)
+}
+
+func (s *provisioningStore) sortedNamespaces() []*provisionedNamespace {
+	namespaces := make([]*provisionedNamespace, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].ID < namespaces[j].ID })
+	return namespaces
+}
+
+func (s *provisioningStore) sortedKeys() []*provisionedKey {
+	keys := make([]*provisionedKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// hasKeys reports whether any key has been provisioned
+func (s *provisioningStore) hasKeys() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys) > 0
+}
+
+// verify looks up a presented key. It returns the key's grants, resolved
+// against the namespaces that are still active, and whether the key is
+// provisioned; a disabled key is reported as found but not active.
+func (s *provisioningStore) verify(key string) (grants []roleGrant, active, found bool) {
+	prefix := apiKeyPrefix(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.keys[prefix]
+	if !ok || !strings.HasPrefix(key, provisionedKeyPrefix) {
+		return nil, false, false
+	}
+	digest := sha256.Sum256([]byte(key))
+	if subtle.ConstantTimeCompare([]byte(entry.Hash), []byte(fmt.Sprintf("%x", digest))) != 1 {
+		return nil, false, false
+	}
+	if !entry.Active {
+		return nil, false, true
+	}
+	for _, role := range entry.Roles {
+		if ns, ok := s.namespaces[role.Namespace]; ok && ns.Active {
+			grants = append(grants, roleGrant{Role: role.Role, Namespace: ns.Templates})
+		}
+	}
+	return grants, true, true
+}
+
+// tenant returns the tenant of a provisioned key: the namespace of its first role
+func (s *provisioningStore) tenant(prefix string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.keys[prefix]; ok && len(key.Roles) > 0 {
+		return key.Roles[0].Namespace
+	}
+	return ""
+}
+
+// scopes returns the scopes of a provisioned key
+func (s *provisioningStore) scopes(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.keys[prefix]; ok {
+		return key.Scopes
+	}
+	return nil
+}
+
+// namespaceOf returns the active namespace whose templates glob matches a
+// template name, the first in ID order when several do
+func (s *provisioningStore) namespaceOf(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, ns := range s.sortedNamespaces() {
+		if ok, err := path.Match(ns.Templates, name); err == nil && ok && ns.Active {
+			return ns.ID
+		}
+	}
+	return ""
+}
+
+// generateAPIKey returns a new random key whose prefix is not taken. The
+// caller holds s.mu.
+func (s *provisioningStore) generateAPIKey() string {
+	for {
+		secret := make([]byte, 30)
+		_, _ = rand.Read(secret)
+		key := provisionedKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+		if _, taken := s.keys[apiKeyPrefix(key)]; !taken {
+			return key
+		}
+	}
+}
+
+// scimError writes a SCIM error response
+func scimError(c echo.Context, status int, detail string) error {
+	return scimJSON(c, status, map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  fmt.Sprint(status),
+		"detail":  detail,
+	})
+}
+
+func scimJSON(c echo.Context, status int, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, scimContentType, data)
+}
+
+// scimList writes a SCIM ListResponse
+func scimList[T any](c echo.Context, resources []T) error {
+	return scimJSON(c, http.StatusOK, map[string]interface{}{
+		"schemas":      []string{scimListSchema},
+		"totalResults": len(resources),
+		"itemsPerPage": len(resources),
+		"startIndex":   1,
+		"Resources":    resources,
+	})
+}
+
+// scimPatch is a SCIM PatchOp request. Only "replace" (and "add", which is
+// the same for single-valued attributes) is supported.
+type scimPatch struct {
+	Schemas    []string `json:"schemas"`
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+// apply decodes the patch operations into the attributes of target, which
+// is a copy of the resource being modified
+func (p scimPatch) apply(target interface{}) error {
+	if len(p.Operations) == 0 {
+		return errors.New("Operations is required")
+	}
+	for _, op := range p.Operations {
+		switch strings.ToLower(op.Op) {
+		case "replace", "add":
+		default:
+			return fmt.Errorf("unsupported patch op %q", op.Op)
+		}
+		value := op.Value
+		if op.Path != "" {
+			value, _ = json.Marshal(map[string]json.RawMessage{op.Path: op.Value})
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return fmt.Errorf("invalid patch value: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateNamespace checks a namespace resource, defaulting its template glob
+func validateNamespace(ns *provisionedNamespace) error {
+	if !templateNamePattern.MatchString(ns.ID) {
+		return errors.New("id must be a valid template name prefix")
+	}
+	if ns.Templates == "" {
+		ns.Templates = tenantTemplateName(ns.ID, "*")
+	}
+	if _, err := path.Match(ns.Templates, ""); err != nil {
+		return fmt.Errorf("invalid templates glob %q", ns.Templates)
+	}
+	return nil
+}
+
+// validateKeyRoles checks that each role is known and names an existing
+// namespace. The caller holds s.mu.
+func (s *provisioningStore) validateKeyRoles(roles []keyRole) error {
+	for _, role := range roles {
+		if _, ok := roleRank[role.Role]; !ok {
+			return fmt.Errorf("unknown role %q", role.Role)
+		}
+		if _, ok := s.namespaces[role.Namespace]; !ok {
+			return fmt.Errorf("unknown namespace %q", role.Namespace)
+		}
+	}
+	return nil
+}
+
+// handleListNamespaces handles GET /v1/api/provisioning/namespaces
+func handleListNamespaces(c echo.Context) error {
+	provisioning.mu.RLock()
+	defer provisioning.mu.RUnlock()
+	return scimList(c, provisioning.sortedNamespaces())
+}
+
+// handleGetNamespace handles GET /v1/api/provisioning/namespaces/:id
+func handleGetNamespace(c echo.Context) error {
+	provisioning.mu.RLock()
+	defer provisioning.mu.RUnlock()
+	ns, ok := provisioning.namespaces[c.Param("id")]
+	if !ok {
+		return scimError(c, http.StatusNotFound, "namespace not found")
+	}
+	return scimJSON(c, http.StatusOK, ns)
+}
+
+// handleCreateNamespace handles POST /v1/api/provisioning/namespaces.
+// Namespaces are active unless created with "active": false.
+func handleCreateNamespace(c echo.Context) error {
+	ns := provisionedNamespace{Active: true}
+	if err := json.NewDecoder(c.Request().Body).Decode(&ns); err != nil {
+		return scimError(c, http.StatusBadRequest, "invalid namespace: "+err.Error())
+	}
+	if err := validateNamespace(&ns); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+
+	provisioning.mu.Lock()
+	defer provisioning.mu.Unlock()
+	if _, exists := provisioning.namespaces[ns.ID]; exists {
+		return scimError(c, http.StatusConflict, "namespace already exists")
+	}
+	now := provisioning.now().UTC()
+	ns.Schemas = []string{scimNamespaceSchema}
+	ns.Meta = scimMeta{ResourceType: "Namespace", Created: now, LastModified: now}
+	provisioning.namespaces[ns.ID] = &ns
+	if err := provisioning.save(); err != nil {
+		delete(provisioning.namespaces, ns.ID)
+		return scimError(c, http.StatusInternalServerError, err.Error())
+	}
+	logger.Info(fmt.Sprintf("Provisioned namespace %s (%s)", ns.ID, ns.Templates))
+	return scimJSON(c, http.StatusCreated, ns)
+}
+
+// handlePatchNamespace handles PATCH /v1/api/provisioning/namespaces/:id,
+// typically to disable a namespace with "active": false
+func handlePatchNamespace(c echo.Context) error {
+	var patch scimPatch
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil {
+		return scimError(c, http.StatusBadRequest, "invalid patch: "+err.Error())
+	}
+
+	provisioning.mu.Lock()
+	defer provisioning.mu.Unlock()
+	current, ok := provisioning.namespaces[c.Param("id")]
+	if !ok {
+		return scimError(c, http.StatusNotFound, "namespace not found")
+	}
+	updated := *current
+	if err := patch.apply(&updated); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	updated.ID, updated.Schemas, updated.Meta.Created = current.ID, current.Schemas, current.Meta.Created
+	if err := validateNamespace(&updated); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	updated.Meta.LastModified = provisioning.now().UTC()
+	provisioning.namespaces[updated.ID] = &updated
+	if err := provisioning.save(); err != nil {
+		provisioning.namespaces[current.ID] = current
+		return scimError(c, http.StatusInternalServerError, err.Error())
+	}
+	return scimJSON(c, http.StatusOK, updated)
+}
+
+// handleDeleteNamespace handles DELETE /v1/api/provisioning/namespaces/:id.
+// Namespaces still referenced by a key cannot be deleted.
+func handleDeleteNamespace(c echo.Context) error {
+	provisioning.mu.Lock()
+	defer provisioning.mu.Unlock()
+	id := c.Param("id")
+	ns, ok := provisioning.namespaces[id]
+	if !ok {
+		return scimError(c, http.StatusNotFound, "namespace not found")
+	}
+	for _, key := range provisioning.keys {
+		for _, role := range key.Roles {
+			if role.Namespace == id {
+				return scimError(c, http.StatusConflict, fmt.Sprintf("namespace is used by key %s", key.ID))
+			}
+		}
+	}
+	delete(provisioning.namespaces, id)
+	if err := provisioning.save(); err != nil {
+		provisioning.namespaces[id] = ns
+		return scimError(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// publicKey is the key resource without its hash
+func publicKey(key *provisionedKey) provisionedKey {
+	public := *key
+	public.Hash = ""
+	return public
+}
+
+// handleListKeys handles GET /v1/api/provisioning/keys
+func handleListKeys(c echo.Context) error {
+	provisioning.mu.RLock()
+	defer provisioning.mu.RUnlock()
+	keys := provisioning.sortedKeys()
+	public := make([]provisionedKey, len(keys))
+	for i, key := range keys {
+		public[i] = publicKey(key)
+	}
+	return scimList(c, public)
+}
+
+// handleGetKey handles GET /v1/api/provisioning/keys/:id
+func handleGetKey(c echo.Context) error {
+	provisioning.mu.RLock()
+	defer provisioning.mu.RUnlock()
+	key, ok := provisioning.keys[c.Param("id")]
+	if !ok {
+		return scimError(c, http.StatusNotFound, "key not found")
+	}
+	return scimJSON(c, http.StatusOK, publicKey(key))
+}
+
+// handleCreateKey handles POST /v1/api/provisioning/keys. The response
+// is the only time the generated key is shown.
+func handleCreateKey(c echo.Context) error {
+	var req struct {
+		DisplayName string    `json:"displayName"`
+		Roles       []keyRole `json:"roles"`
+		Scopes      []string  `json:"scopes"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return scimError(c, http.StatusBadRequest, "invalid key: "+err.Error())
+	}
+	if len(req.Roles) == 0 {
+		return scimError(c, http.StatusBadRequest, "at least one role is required")
+	}
+
+	provisioning.mu.Lock()
+	defer provisioning.mu.Unlock()
+	if err := provisioning.validateKeyRoles(req.Roles); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	if err := validateScopes(req.Scopes); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	secret := provisioning.generateAPIKey()
+	now := provisioning.now().UTC()
+	key := &provisionedKey{
+		Schemas:     []string{scimAPIKeySchema},
+		ID:          apiKeyPrefix(secret),
+		DisplayName: req.DisplayName,
+		Roles:       req.Roles,
+		Scopes:      req.Scopes,
+		Active:      true,
+		Meta:        scimMeta{ResourceType: "ApiKey", Created: now, LastModified: now},
+		Hash:        fmt.Sprintf("%x", sha256.Sum256([]byte(secret))),
+	}
+	provisioning.keys[key.ID] = key
+	if err := provisioning.save(); err != nil {
+		delete(provisioning.keys, key.ID)
+		return scimError(c, http.StatusInternalServerError, err.Error())
+	}
+	logger.Info(fmt.Sprintf("Provisioned API key %s... (%s)", key.ID, key.DisplayName))
+	created := publicKey(key)
+	created.Key = secret
+	return scimJSON(c, http.StatusCreated, created)
+}
+
+// handlePatchKey handles PATCH /v1/api/provisioning/keys/:id, to
+// disable a key ("active": false) or change its display name, roles or scopes
+func handlePatchKey(c echo.Context) error {
+	var patch scimPatch
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil {
+		return scimError(c, http.StatusBadRequest, "invalid patch: "+err.Error())
+	}
+
+	provisioning.mu.Lock()
+	defer provisioning.mu.Unlock()
+	current, ok := provisioning.keys[c.Param("id")]
+	if !ok {
+		return scimError(c, http.StatusNotFound, "key not found")
+	}
+	updated := *current
+	if err := patch.apply(&updated); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	updated.ID, updated.Schemas, updated.Hash, updated.Key = current.ID, current.Schemas, current.Hash, ""
+	updated.Meta = scimMeta{ResourceType: current.Meta.ResourceType, Created: current.Meta.Created, LastModified: provisioning.now().UTC()}
+	if len(updated.Roles) == 0 {
+		return scimError(c, http.StatusBadRequest, "at least one role is required")
+	}
+	if err := provisioning.validateKeyRoles(updated.Roles); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	if err := validateScopes(updated.Scopes); err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	provisioning.keys[updated.ID] = &updated
+	if err := provisioning.save(); err != nil {
+		provisioning.keys[current.ID] = current
+		return scimError(c, http.StatusInternalServerError, err.Error())
+	}
+	if current.Active && !updated.Active {
+		logger.Info(fmt.Sprintf("Disabled API key %s...", updated.ID))
+	}
+	return scimJSON(c, http.StatusOK, publicKey(&updated))
+}
+
+// handleDeleteKey handles DELETE /v1/api/provisioning/keys/:id
+func handleDeleteKey(c echo.Context) error {
+	provisioning.mu.Lock()
+	defer provisioning.mu.Unlock()
+	id := c.Param("id")
+	key, ok := provisioning.keys[id]
+	if !ok {
+		return scimError(c, http.StatusNotFound, "key not found")
+	}
+	delete(provisioning.keys, id)
+	if err := provisioning.save(); err != nil {
+		provisioning.keys[id] = key
+		return scimError(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func withProvisioning(t *testing.T, file string) *provisioningStore {
+	t.Helper()
+	previous := provisioning
+	provisioning = newProvisioningStore(file)
+	t.Cleanup(func() { provisioning = previous })
+	return provisioning
+}
+
+func provisioningServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	withTemplateStore(t, newMemoryTemplateBackend())
+	previousKeys, previousSigning := apiKeys, requestSigning
+	t.Cleanup(func() { apiKeys, requestSigning = previousKeys, previousSigning })
+	t.Setenv("TEMPLATE_API_KEY", "bootstrap-0123456789")
+	if err := configureAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	requestSigning = nil
+
+	e := echo.New()
+	e.PUT("/v1/api/templates/:name", handlePutTemplate, apiKeyAuthMiddleware, requireRole(roleEditor), requireScope(scopeTemplates))
+	e.GET("/v1/api/audit", handleAuditLog, apiKeyAuthMiddleware, requireGlobalRole(roleAdmin))
+	e.GET("/v1/api/usage/all", handleListUsage, apiKeyAuthMiddleware, requireGlobalRole(roleAdmin))
+	group := e.Group("/v1/api/provisioning", apiKeyAuthMiddleware, requireGlobalRole(roleAdmin))
+	group.GET("/namespaces", handleListNamespaces)
+	group.POST("/namespaces", handleCreateNamespace)
+	group.PATCH("/namespaces/:id", handlePatchNamespace)
+	group.DELETE("/namespaces/:id", handleDeleteNamespace)
+	group.POST("/keys", handleCreateKey)
+	group.GET("/keys/:id", handleGetKey)
+	group.PATCH("/keys/:id", handlePatchKey)
+	return e
+}
+
+func provisioningCall(e *echo.Echo, method, target, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProvisionedNamespaceAdmin(t *testing.T) {
+	withProvisioning(t, filepath.Join(t.TempDir(), "provisioning.json"))
+	e := provisioningServer(t)
+	const admin = "bootstrap-0123456789"
+
+	if rec := provisioningCall(e, http.MethodPost, "/v1/api/provisioning/namespaces", admin, `{"id": "team-a"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Create namespace = %d %s", rec.Code, rec.Body)
+	}
+	rec := provisioningCall(e, http.MethodPost, "/v1/api/provisioning/keys", admin, `{"displayName": "Team A", "roles": [{"namespace": "team-a", "role": "admin"}]}`)
+	var created provisionedKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("Create key = %d %s", rec.Code, rec.Body)
+	}
+
+	// Administering one namespace does not reach the data of the others
+	for _, target := range []string{"/v1/api/audit", "/v1/api/usage/all", "/v1/api/provisioning/namespaces"} {
+		if rec := provisioningCall(e, http.MethodGet, target, created.Key, ""); rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s = %d, expected 403 for a namespace admin", target, rec.Code)
+		}
+	}
+	if rec := provisioningCall(e, http.MethodGet, "/v1/api/usage/all", admin, ""); rec.Code == http.StatusForbidden {
+		t.Errorf("Expected the configured key to list usage, got %d", rec.Code)
+	}
+}
+
+func TestProvisionedKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "provisioning.json")
+	withProvisioning(t, file)
+	e := provisioningServer(t)
+	const admin = "bootstrap-0123456789"
+
+	if rec := provisioningCall(e, http.MethodPost, "/v1/api/provisioning/namespaces", admin, `{"id": "marketing", "displayName": "Marketing"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Create namespace = %d %s", rec.Code, rec.Body)
+	}
+	if rec := provisioningCall(e, http.MethodPost, "/v1/api/provisioning/namespaces", admin, `{"id": "marketing"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate namespace, got %d", rec.Code)
+	}
+	if rec := provisioningCall(e, http.MethodPost, "/v1/api/provisioning/keys", admin, `{"displayName": "CI", "roles": [{"namespace": "finance", "role": "editor"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown namespace, got %d", rec.Code)
+	}
+
+	rec := provisioningCall(e, http.MethodPost, "/v1/api/provisioning/keys", admin, `{"displayName": "CI", "roles": [{"namespace": "marketing", "role": "editor"}]}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Type") != scimContentType {
+		t.Fatalf("Create key = %d %s", rec.Code, rec.Body)
+	}
+	var created provisionedKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || !strings.HasPrefix(created.Key, created.ID) || created.Hash != "" {
+		t.Fatalf("Created key = %s (%v)", rec.Body, err)
+	}
+	key := created.Key
+
+	if rec := provisioningCall(e, http.MethodGet, "/v1/api/provisioning/keys/"+created.ID, admin, ""); strings.Contains(rec.Body.String(), `"key"`) || strings.Contains(rec.Body.String(), `"hash"`) {
+		t.Errorf("Expected the key and its hash to be withheld, got %s", rec.Body)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+	}{
+		{"editor in namespace", http.MethodPut, "/v1/api/templates/marketing~offer", http.StatusCreated},
+		{"outside namespace", http.MethodPut, "/v1/api/templates/finance~report", http.StatusForbidden},
+		{"provisioning", http.MethodGet, "/v1/api/provisioning/namespaces", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := provisioningCall(e, tt.method, tt.target, key, `{"text": "Hi"}`); rec.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	// A key limited to rendering cannot manage templates
+	if rec := provisioningCall(e, http.MethodPost, "/v1/api/provisioning/keys", admin, `{"roles": [{"namespace": "marketing", "role": "editor"}], "scopes": ["print"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown scope, got %d", rec.Code)
+	}
+	rec = provisioningCall(e, http.MethodPost, "/v1/api/provisioning/keys", admin, `{"displayName": "Shop", "roles": [{"namespace": "marketing", "role": "editor"}], "scopes": ["render"]}`)
+	var renderOnly provisionedKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &renderOnly); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("Create render-only key = %d %s", rec.Code, rec.Body)
+	}
+	if rec := provisioningCall(e, http.MethodPut, "/v1/api/templates/marketing~offer", renderOnly.Key, `{"text": "Hi"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a render-only key, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Reloading the file keeps the key working
+	reloaded := newProvisioningStore(file)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, active, found := reloaded.verify(key); !active || !found {
+		t.Error("Expected the key to survive a reload")
+	}
+
+	// Disabling the namespace withdraws its grants
+	if rec := provisioningCall(e, http.MethodPatch, "/v1/api/provisioning/namespaces/marketing", admin,
+		`{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "replace", "path": "active", "value": false}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("Disable namespace = %d %s", rec.Code, rec.Body)
+	}
+	if rec := provisioningCall(e, http.MethodPut, "/v1/api/templates/marketing~offer", key, `{"text": "Hi"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 in a disabled namespace, got %d", rec.Code)
+	}
+	if rec := provisioningCall(e, http.MethodDelete, "/v1/api/provisioning/namespaces/marketing", admin, ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 deleting a namespace in use, got %d", rec.Code)
+	}
+
+	// Disabling the key rejects it outright
+	if rec := provisioningCall(e, http.MethodPatch, "/v1/api/provisioning/keys/"+created.ID, admin,
+		`{"Operations": [{"op": "replace", "value": {"active": false}}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("Disable key = %d %s", rec.Code, rec.Body)
+	}
+	if rec := provisioningCall(e, http.MethodPut, "/v1/api/templates/marketing~offer", key, `{"text": "Hi"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a disabled key, got %d", rec.Code)
+	}
+}
+
+func TestProvisionedKeysRequireAuthentication(t *testing.T) {
+	store := withProvisioning(t, "")
+	previousKeys, previousSigning := apiKeys, requestSigning
+	t.Cleanup(func() { apiKeys, requestSigning = previousKeys, previousSigning })
+	apiKeys, requestSigning = nil, nil
+
+	e := echo.New()
+	e.GET("/v1/api/ping", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }, apiKeyAuthMiddleware)
+	if rec := provisioningCall(e, http.MethodGet, "/v1/api/ping", "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected an open API without keys, got %d", rec.Code)
+	}
+
+	store.namespaces["ops"] = &provisionedNamespace{ID: "ops", Templates: "*", Active: true}
+	store.keys["tsk_abcd"] = &provisionedKey{ID: "tsk_abcd", Roles: []keyRole{{Namespace: "ops", Role: roleViewer}}, Active: true}
+	if rec := provisioningCall(e, http.MethodGet, "/v1/api/ping", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 once keys are provisioned, got %d", rec.Code)
+	}
+}
+
+func TestScimPatch(t *testing.T) {
+	var patch scimPatch
+	_ = json.Unmarshal([]byte(`{"Operations": [{"op": "remove", "path": "active"}]}`), &patch)
+	if err := patch.apply(&provisionedNamespace{}); err == nil {
+		t.Error("Expected remove to be rejected")
+	}
+	_ = json.Unmarshal([]byte(`{"Operations": [{"op": "Replace", "path": "displayName", "value": "Ops"}]}`), &patch)
+	ns := provisionedNamespace{ID: "ops"}
+	if err := patch.apply(&ns); err != nil || ns.DisplayName != "Ops" {
+		t.Errorf("apply() = %+v, %v", ns, err)
+	}
+}
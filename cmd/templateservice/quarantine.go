@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// templateQuarantine refuses renders of stored template versions that were
+// quarantined, either by an administrator or automatically once their
+// failure rate within window reaches errorPercent over at least minRenders.
+type templateQuarantine struct {
+	errorPercent int // 0 disables automatic quarantine
+	minRenders   int
+	window       time.Duration
+	webhook      string // Notified of quarantines and releases
+	now          func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*quarantineEntry // By name@version
+	outcomes map[string]*renderOutcomes
+}
+
+// quarantineEntry describes a quarantined template version
+type quarantineEntry struct {
+	Template      string    `json:"template"`
+	Version       int       `json:"version"`
+	Reason        string    `json:"reason"`
+	Automatic     bool      `json:"automatic"`
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+}
+
+// renderOutcomes counts the renders of a template version in the current window
+type renderOutcomes struct {
+	since    time.Time
+	renders  int
+	failures int
+}
+
+// quarantineEvent is the notification posted to the quarantine webhook
+type quarantineEvent struct {
+	Event string `json:"event"` // template.quarantined, template.released
+	Owner string `json:"owner,omitempty"`
+	quarantineEntry
+}
+
+var quarantine = newTemplateQuarantine(0, 20, 10*time.Minute, "")
+
+var quarantineClient = &http.Client{Timeout: 10 * time.Second}
+
+// configureTemplateQuarantine loads the automatic quarantine thresholds and
+// the notification webhook from the environment
+func configureTemplateQuarantine() {
+	quarantine = newTemplateQuarantine(
+		envInt("TEMPLATE_QUARANTINE_ERROR_PERCENT", 0),
+		envInt("TEMPLATE_QUARANTINE_MIN_RENDERS", 20),
+		envDuration("TEMPLATE_QUARANTINE_WINDOW", 10*time.Minute),
+		os.Getenv("TEMPLATE_QUARANTINE_WEBHOOK"),
+	)
+	if quarantine.errorPercent > 0 {
+		logger.Infof("Templates failing %d%% of at least %d renders within %s are quarantined",
+			quarantine.errorPercent, quarantine.minRenders, quarantine.window)
+	}
+}
+
+func newTemplateQuarantine(errorPercent, minRenders int, window time.Duration, webhook string) *templateQuarantine {
+	return &templateQuarantine{
+		errorPercent: errorPercent,
+		minRenders:   minRenders,
+		window:       window,
+		webhook:      webhook,
+		now:          time.Now,
+		entries:      make(map[string]*quarantineEntry),
+		outcomes:     make(map[string]*renderOutcomes),
+	}
+}
+
+func quarantineKey(name string, version int) string {
+	return name + "@" + strconv.Itoa(version)
+}
+
+// check refuses stored template versions that are quarantined
+func (q *templateQuarantine) check(req renderRequest) error {
+	if req.StoredVersion == 0 {
+		return nil
+	}
+	q.mu.Lock()
+	entry, ok := q.entries[quarantineKey(req.TemplateName, req.StoredVersion)]
+	q.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return &render.Error{
+		Message: fmt.Sprintf("template %q version %d is quarantined: %s", entry.Template, entry.Version, entry.Reason),
+		Status:  http.StatusLocked,
+	}
+}
+
+// observe records the outcome of rendering a stored template version and
+// quarantines it once its failure rate crosses the threshold. Cancelled
+// requests are not the template's fault and are ignored.
+func (q *templateQuarantine) observe(req renderRequest, err error) {
+	if req.StoredVersion == 0 || q.errorPercent <= 0 {
+		return
+	}
+	var re *render.Error
+	if errors.As(err, &re) && re.Status == http.StatusRequestTimeout {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	key := quarantineKey(req.TemplateName, req.StoredVersion)
+	if _, quarantined := q.entries[key]; quarantined {
+		return
+	}
+	o, ok := q.outcomes[key]
+	if !ok || now.Sub(o.since) >= q.window {
+		o = &renderOutcomes{since: now}
+		q.outcomes[key] = o
+	}
+	o.renders++
+	if err != nil {
+		o.failures++
+	}
+	if o.renders < q.minRenders || o.failures*100 < o.renders*q.errorPercent {
+		return
+	}
+
+	reason := fmt.Sprintf("%d of %d renders failed within %s", o.failures, o.renders, q.window)
+	if re != nil {
+		reason += ", last error: " + re.Message
+	}
+	q.quarantineLocked(req.TemplateName, req.StoredVersion, reason, true)
+}
+
+// quarantine refuses further renders of a template version
+func (q *templateQuarantine) quarantine(name string, version int, reason string) quarantineEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.quarantineLocked(name, version, reason, false)
+}
+
+// quarantineLocked adds the entry and notifies the owner. Callers hold q.mu.
+func (q *templateQuarantine) quarantineLocked(name string, version int, reason string, automatic bool) quarantineEntry {
+	key := quarantineKey(name, version)
+	entry := &quarantineEntry{Template: name, Version: version, Reason: reason, Automatic: automatic, QuarantinedAt: q.now().UTC()}
+	q.entries[key] = entry
+	delete(q.outcomes, key)
+	logger.Info(fmt.Sprintf("Quarantined template %q version %d: %s", name, version, reason))
+	go q.notify("template.quarantined", *entry)
+	return *entry
+}
+
+// release lifts the quarantine of a template version, reporting whether it was quarantined
+func (q *templateQuarantine) release(name string, version int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := quarantineKey(name, version)
+	entry, ok := q.entries[key]
+	if !ok {
+		return false
+	}
+	delete(q.entries, key)
+	delete(q.outcomes, key)
+	logger.Info(fmt.Sprintf("Released template %q version %d from quarantine", name, version))
+	go q.notify("template.released", *entry)
+	return true
+}
+
+// list returns the quarantined template versions, most recent first
+func (q *templateQuarantine) list() []quarantineEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := make([]quarantineEntry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].QuarantinedAt.After(entries[j].QuarantinedAt) })
+	return entries
+}
+
+// notify posts a quarantine event to the webhook, naming the template's owner
+func (q *templateQuarantine) notify(event string, entry quarantineEntry) {
+	if q.webhook == "" {
+		return
+	}
+	payload := quarantineEvent{Event: event, quarantineEntry: entry}
+	if stored, err := templateStore.getVersion(entry.Template, entry.Version); err == nil {
+		payload.Owner = stored.Owner
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.WithError(err).Error("Failed to encode quarantine notification")
+		return
+	}
+
+	httpReq, err := http.NewRequestWithContext(context.Background(), http.MethodPost, q.webhook, bytes.NewReader(body))
+	if err != nil {
+		logger.WithError(err).Error("Failed to create quarantine notification")
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := quarantineClient.Do(httpReq)
+	if err != nil {
+		logger.WithError(err).Error("Failed to send quarantine notification")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		logger.Info(fmt.Sprintf("Quarantine webhook returned status %d", resp.StatusCode))
+	}
+}
+
+// quarantineTarget loads the stored template version addressed by c
+func quarantineTarget(c echo.Context) (*storedTemplate, error) {
+	version, ok := templateVersionParam(c)
+	if !ok {
+		return nil, &render.Error{Message: "invalid version", Status: http.StatusBadRequest}
+	}
+	tmpl, err := templateStore.getVersion(c.Param("name"), version)
+	if errors.Is(err, errTemplateNotFound) {
+		return nil, &render.Error{Message: "template version not found", Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &render.Error{Message: "failed to load stored template", Status: http.StatusInternalServerError, Err: err}
+	}
+	return tmpl, nil
+}
+
+// handleQuarantineTemplate handles PUT /v1/api/templates/:name/versions/:version/quarantine
+func handleQuarantineTemplate(c echo.Context) error {
+	tmpl, err := quarantineTarget(c)
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if body.Reason == "" {
+		body.Reason = "quarantined by an administrator"
+	}
+	return c.JSON(http.StatusOK, quarantine.quarantine(tmpl.Name, tmpl.Version, body.Reason))
+}
+
+// handleReleaseTemplate handles DELETE /v1/api/templates/:name/versions/:version/quarantine
+func handleReleaseTemplate(c echo.Context) error {
+	tmpl, err := quarantineTarget(c)
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+	if !quarantine.release(tmpl.Name, tmpl.Version) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template version is not quarantined"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// handleListQuarantine handles GET /v1/api/quarantine
+func handleListQuarantine(c echo.Context) error {
+	entries := quarantine.list()
+	return c.JSON(http.StatusOK, map[string]interface{}{"count": len(entries), "templates": entries})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+func withTemplateQuarantine(t *testing.T, q *templateQuarantine) {
+	t.Helper()
+	previous := quarantine
+	quarantine = q
+	t.Cleanup(func() { quarantine = previous })
+}
+
+func TestTemplateQuarantine_Automatic(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if _, err := saveTemplate("report", &templateInput{Text: "{{.rows.total}}", MissingKey: "error", Owner: "reports@example.com"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan quarantineEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event quarantineEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer webhook.Close()
+	withTemplateQuarantine(t, newTemplateQuarantine(50, 4, time.Minute, webhook.URL))
+
+	renderWith := func(parameters map[string]interface{}) error {
+		_, err := renderTemplate(context.Background(), renderRequest{TemplateName: "report", Parameters: parameters})
+		return err
+	}
+	good := map[string]interface{}{"rows": map[string]interface{}{"total": 3}}
+	if err := renderWith(good); err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := renderWith(nil); err == nil {
+			t.Fatal("Expected a render error for missing parameters")
+		}
+	}
+
+	// Three of four renders failed; the version is now refused
+	re, ok := renderWith(good).(*render.Error)
+	if !ok || re.Status != http.StatusLocked || !strings.Contains(re.Message, "quarantined") {
+		t.Fatalf("Expected 423 for a quarantined template, got %v", re)
+	}
+
+	select {
+	case event := <-events:
+		if event.Event != "template.quarantined" || event.Owner != "reports@example.com" || !event.Automatic || event.Version != 1 {
+			t.Errorf("Unexpected notification %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a quarantine notification")
+	}
+
+	// A fixed version is not affected
+	if _, err := saveTemplate("report", &templateInput{Text: "{{.rows.total}}"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderWith(good); err != nil {
+		t.Errorf("Expected the new version to render, got %v", err)
+	}
+}
+
+func TestTemplateQuarantine_Handlers(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	withTemplateQuarantine(t, newTemplateQuarantine(0, 0, time.Minute, ""))
+	if _, err := saveTemplate("invoice", &templateInput{Text: "ok"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	call := func(handler echo.HandlerFunc, method, version, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/api/templates/invoice/versions/"+version+"/quarantine", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("name", "version")
+		c.SetParamValues("invoice", version)
+		if err := handler(c); err != nil {
+			t.Fatalf("%s returned error: %v", method, err)
+		}
+		return rec
+	}
+
+	if rec := call(handleQuarantineTemplate, http.MethodPut, "2", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Quarantine of unknown version = %d", rec.Code)
+	}
+	if rec := call(handleQuarantineTemplate, http.MethodPut, "1", `{"reason": "leaks customer data"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Quarantine = %d: %s", rec.Code, rec.Body)
+	}
+	_, err := renderTemplate(context.Background(), renderRequest{TemplateName: "invoice"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusLocked || !strings.Contains(re.Message, "leaks customer data") {
+		t.Errorf("Expected 423 with the reason, got %v", err)
+	}
+	if entries := quarantine.list(); len(entries) != 1 || entries[0].Automatic {
+		t.Errorf("Expected one manual quarantine, got %+v", entries)
+	}
+
+	if rec := call(handleReleaseTemplate, http.MethodDelete, "1", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Release = %d", rec.Code)
+	}
+	if rec := call(handleReleaseTemplate, http.MethodDelete, "1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Second release = %d", rec.Code)
+	}
+	if _, err := renderTemplate(context.Background(), renderRequest{TemplateName: "invoice"}); err != nil {
+		t.Errorf("Expected released template to render, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxRateBuckets bounds the buckets kept in memory; full buckets are
+// dropped first since they carry no state worth keeping
+const maxRateBuckets = 10000
+
+// rateLimit is a token bucket refilling Rate tokens per second up to Burst
+type rateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// rateLimiter limits the requests of each consumer: the tenant of a
+// request when it has one, else its API key, user or client address
+type rateLimiter struct {
+	defaults  rateLimit
+	overrides map[string]rateLimit // By tenant or principal
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+	limit  rateLimit
+}
+
+// rateLimits is nil when requests are not rate limited
+var rateLimits *rateLimiter
+
+// configureRateLimits reads TEMPLATE_RATE_LIMIT (requests per second) and
+// TEMPLATE_RATE_BURST, the default limit of every consumer, and
+// TEMPLATE_RATE_LIMITS, comma-separated consumer=rate[:burst] overrides
+// for tenants and principals. A rate of 0 leaves a consumer unlimited.
+func configureRateLimits() error {
+	rateLimits = nil
+	defaults, err := parseRateLimit(os.Getenv("TEMPLATE_RATE_LIMIT"), os.Getenv("TEMPLATE_RATE_BURST"))
+	if err != nil {
+		return fmt.Errorf("TEMPLATE_RATE_LIMIT: %w", err)
+	}
+	overrides := make(map[string]rateLimit)
+	for _, entry := range envList("TEMPLATE_RATE_LIMITS") {
+		consumer, limit, ok := strings.Cut(entry, "=")
+		rate, burst, _ := strings.Cut(limit, ":")
+		parsed, err := parseRateLimit(rate, burst)
+		if !ok || consumer == "" || err != nil {
+			return fmt.Errorf("TEMPLATE_RATE_LIMITS: expected consumer=rate[:burst], got %q", entry)
+		}
+		overrides[consumer] = parsed
+	}
+	if defaults.Rate == 0 && len(overrides) == 0 {
+		return nil
+	}
+	rateLimits = newRateLimiter(defaults, overrides)
+	logger.Infof("Rate limiting enabled: %g requests/s (burst %d) per consumer, %d overrides", defaults.Rate, defaults.Burst, len(overrides))
+	return nil
+}
+
+// parseRateLimit parses a rate and an optional burst, which defaults to
+// the rate rounded up
+func parseRateLimit(rate, burst string) (rateLimit, error) {
+	if rate == "" {
+		return rateLimit{}, nil
+	}
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 || math.IsInf(r, 0) || math.IsNaN(r) {
+		return rateLimit{}, fmt.Errorf("invalid rate %q", rate)
+	}
+	limit := rateLimit{Rate: r, Burst: int(math.Max(1, math.Ceil(r)))}
+	if burst != "" {
+		b, err := strconv.Atoi(burst)
+		if err != nil || b < 1 {
+			return rateLimit{}, fmt.Errorf("invalid burst %q", burst)
+		}
+		limit.Burst = b
+	}
+	return limit, nil
+}
+
+func newRateLimiter(defaults rateLimit, overrides map[string]rateLimit) *rateLimiter {
+	return &rateLimiter{
+		defaults:  defaults,
+		overrides: overrides,
+		now:       time.Now,
+		buckets:   make(map[string]*rateBucket),
+	}
+}
+
+// limitFor returns the limit of a consumer: an override for its tenant or
+// principal, or the default
+func (l *rateLimiter) limitFor(tenant, principal string) rateLimit {
+	if limit, ok := l.overrides[tenant]; ok && tenant != "" {
+		return limit
+	}
+	if limit, ok := l.overrides[principal]; ok && principal != "" {
+		return limit
+	}
+	return l.defaults
+}
+
+// allow takes a token from the consumer's bucket. When none is left it
+// returns false and how long until the next one.
+func (l *rateLimiter) allow(consumer string, limit rateLimit) (bool, time.Duration) {
+	if limit.Rate == 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[consumer]
+	if !ok || b.limit != limit {
+		if len(l.buckets) >= maxRateBuckets {
+			l.prune(now)
+		}
+		b = &rateBucket{tokens: float64(limit.Burst), last: now, limit: limit}
+		l.buckets[consumer] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// prune drops buckets that have refilled completely. The caller holds l.mu.
+func (l *rateLimiter) prune(now time.Time) {
+	for consumer, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(l.buckets, consumer)
+		}
+	}
+}
+
+// rateLimited answers 429 with Retry-After when the consumer of an
+// authenticated request has exhausted its limit
+func rateLimited(c echo.Context, principal string) (bool, error) {
+	if rateLimits == nil {
+		return false, nil
+	}
+	tenant, _ := c.Get(tenantContextKey).(string)
+	consumer := "ip:" + c.RealIP()
+	switch {
+	case tenant != "":
+		consumer = "tenant:" + tenant
+	case principal != "":
+		consumer = "principal:" + principal
+	}
+	ok, wait := rateLimits.allow(consumer, rateLimits.limitFor(tenant, principal))
+	if ok {
+		return false, nil
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return true, c.JSON(http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(rateLimit{Rate: 2, Burst: 3}, map[string]rateLimit{"acme": {Rate: 10, Burst: 10}, "tsk_ci01": {}})
+	l.now = func() time.Time { return now }
+
+	limit := l.limitFor("", "tsk_live")
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("principal:tsk_live", limit); !ok {
+			t.Fatalf("Request %d within the burst was refused", i)
+		}
+	}
+	ok, wait := l.allow("principal:tsk_live", limit)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("Over the burst: allow() = %t, %v; want false, 500ms", ok, wait)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.allow("principal:tsk_live", limit); !ok {
+		t.Error("Expected a token after 500ms at 2 requests/s")
+	}
+
+	if limit := l.limitFor("acme", "tsk_live"); limit.Rate != 10 {
+		t.Errorf("Expected the tenant override to take precedence, got %+v", limit)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.allow("principal:tsk_ci01", l.limitFor("", "tsk_ci01")); !ok {
+			t.Fatal("Expected a rate of 0 to exempt the consumer")
+		}
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		rate, burst string
+		want        rateLimit
+		valid       bool
+	}{
+		{"", "", rateLimit{}, true},
+		{"5", "", rateLimit{Rate: 5, Burst: 5}, true},
+		{"0.5", "", rateLimit{Rate: 0.5, Burst: 1}, true},
+		{"5", "20", rateLimit{Rate: 5, Burst: 20}, true},
+		{"-1", "", rateLimit{}, false},
+		{"fast", "", rateLimit{}, false},
+		{"5", "0", rateLimit{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseRateLimit(tt.rate, tt.burst)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("parseRateLimit(%q, %q) = %+v, %v", tt.rate, tt.burst, got, err)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Setenv("TEMPLATE_RATE_LIMIT", "1")
+	t.Setenv("TEMPLATE_RATE_LIMITS", "acme=1:2")
+	t.Cleanup(func() { rateLimits = nil })
+	if err := configureRateLimits(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if tenant := c.Request().Header.Get("X-Tenant"); tenant != "" {
+				c.Set(tenantContextKey, tenant)
+			}
+			return authenticated(c, next, c.Request().Header.Get("X-API-Key"))
+		}
+	})
+	call := func(key, tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("X-Tenant", tenant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call("tsk_live", ""); rec.Code != http.StatusOK {
+		t.Fatalf("First request = %d", rec.Code)
+	}
+	rec := call("tsk_live", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Second request = %d, Retry-After %q; want 429, 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := call("tsk_ci01", ""); rec.Code != http.StatusOK {
+		t.Errorf("Another key shares no bucket, got %d", rec.Code)
+	}
+
+	// Keys of a tenant share the tenant's limit
+	if rec := call("tsk_a", "acme"); rec.Code != http.StatusOK {
+		t.Errorf("First tenant request = %d", rec.Code)
+	}
+	if rec := call("tsk_b", "acme"); rec.Code != http.StatusOK {
+		t.Errorf("Second tenant request within its burst = %d", rec.Code)
+	}
+	if rec := call("tsk_c", "acme"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Third tenant request = %d; want 429", rec.Code)
+	}
+}
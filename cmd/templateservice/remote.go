@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+// maxRemoteTemplates bounds the number of cached remote templates
+const maxRemoteTemplates = 256
+
+// remoteTemplateFetcher fetches templates referenced by http(s) URLs from the
+// allowed hosts, caching them for ttl and revalidating with ETag and
+// Last-Modified afterwards
+type remoteTemplateFetcher struct {
+	hosts    []string // Host names or *.domain patterns
+	maxBytes int64
+	ttl      time.Duration
+	client   *http.Client
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*remoteTemplate
+}
+
+// remoteTemplate is a cached remote template body
+type remoteTemplate struct {
+	text         string
+	etag         string
+	lastModified string
+	fetchedAt    time.Time
+}
+
+// remoteTemplates is nil when no remote hosts are allowed
+var remoteTemplates *remoteTemplateFetcher
+
+// configureRemoteTemplates loads the remote template settings from the
+// environment. TEMPLATE_REMOTE_HOSTS lists the allowed hosts; without it
+// URLs are refused.
+func configureRemoteTemplates() {
+	hosts := envList("TEMPLATE_REMOTE_HOSTS")
+	if len(hosts) == 0 {
+		remoteTemplates = nil
+		return
+	}
+	maxMB := envInt("TEMPLATE_REMOTE_MAX_MB", 1)
+	if maxMB <= 0 {
+		maxMB = 1
+	}
+	remoteTemplates = newRemoteTemplateFetcher(
+		hosts,
+		int64(maxMB)<<20,
+		envDuration("TEMPLATE_REMOTE_TIMEOUT", 10*time.Second),
+		envDuration("TEMPLATE_REMOTE_CACHE_TTL", 5*time.Minute),
+	)
+	logger.Infof("Remote templates allowed from %s", strings.Join(hosts, ", "))
+}
+
+func newRemoteTemplateFetcher(hosts []string, maxBytes int64, timeout, ttl time.Duration) *remoteTemplateFetcher {
+	f := &remoteTemplateFetcher{
+		hosts:    hosts,
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		cache:    make(map[string]*remoteTemplate),
+	}
+	f.client = &http.Client{
+		Timeout: timeout,
+		// Redirects must stay on allowed hosts
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if !f.hostAllowed(req.URL) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return f
+}
+
+// isRemoteTemplate reports whether a template identifier is an http(s) URL
+func isRemoteTemplate(identifier string) bool {
+	lower := strings.ToLower(identifier)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// resolveRemoteTemplate loads the text of a template referenced by URL
+func resolveRemoteTemplate(req renderRequest) (renderRequest, error) {
+	if req.Text != "" || !isRemoteTemplate(req.Identifier) {
+		return req, nil
+	}
+	if remoteTemplates == nil {
+		return req, &render.Error{Message: "remote templates are not enabled", Status: http.StatusForbidden}
+	}
+	text, err := remoteTemplates.fetch(req.Identifier)
+	if err != nil {
+		return req, err
+	}
+	req.Text = text
+	return req, nil
+}
+
+// hostAllowed reports whether u is an http(s) URL on an allowed host
+func (f *remoteTemplateFetcher) hostAllowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range f.hosts {
+		if ok, err := path.Match(strings.ToLower(pattern), host); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch returns the template at rawURL, from the cache while it is fresh
+func (f *remoteTemplateFetcher) fetch(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", &render.Error{Message: "invalid template URL", Status: http.StatusBadRequest, Err: err}
+	}
+	if !f.hostAllowed(u) {
+		return "", &render.Error{Message: fmt.Sprintf("template host %q is not allowed", u.Hostname()), Status: http.StatusForbidden}
+	}
+	key := u.String()
+
+	f.mu.Lock()
+	cached := f.cache[key]
+	f.mu.Unlock()
+	if cached != nil && f.now().Sub(cached.fetchedAt) < f.ttl {
+		return cached.text, nil
+	}
+
+	fetched, err := f.download(key, cached)
+	if err != nil {
+		if cached != nil {
+			// A stale copy beats failing the render
+			logger.WithError(err).Error("Failed to revalidate remote template, using cached copy")
+			return cached.text, nil
+		}
+		return "", &render.Error{Message: "failed to fetch remote template", Status: http.StatusBadGateway, Err: err}
+	}
+	if f.ttl > 0 {
+		f.store(key, fetched)
+	}
+	return fetched.text, nil
+}
+
+// download requests the template, conditionally when a cached copy exists
+func (f *remoteTemplateFetcher) download(rawURL string, cached *remoteTemplate) (*remoteTemplate, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			httpReq.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			httpReq.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := f.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		refreshed := *cached
+		refreshed.fetchedAt = f.now()
+		return &refreshed, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", rawURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.maxBytes {
+		return nil, fmt.Errorf("%s exceeds %d bytes", rawURL, f.maxBytes)
+	}
+	return &remoteTemplate{
+		text:         string(data),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		fetchedAt:    f.now(),
+	}, nil
+}
+
+// store caches a fetched template, evicting the oldest entry when full
+func (f *remoteTemplateFetcher) store(key string, fetched *remoteTemplate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.cache[key]; !ok && len(f.cache) >= maxRemoteTemplates {
+		var oldest string
+		for k, entry := range f.cache {
+			if oldest == "" || entry.fetchedAt.Before(f.cache[oldest].fetchedAt) {
+				oldest = k
+			}
+		}
+		delete(f.cache, oldest)
+	}
+	f.cache[key] = fetched
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+func withRemoteTemplates(t *testing.T, f *remoteTemplateFetcher) {
+	t.Helper()
+	previous := remoteTemplates
+	remoteTemplates = f
+	t.Cleanup(func() { remoteTemplates = previous })
+}
+
+func TestRemoteTemplates(t *testing.T) {
+	var requests, revalidations int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/greeting.tmpl":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidations++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("Hello {{.name}}"))
+		case "/large.tmpl":
+			_, _ = w.Write([]byte(strings.Repeat("x", 2048)))
+		case "/redirect":
+			http.Redirect(w, r, "http://example.invalid/evil.tmpl", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newRemoteTemplateFetcher([]string{"127.0.0.1"}, 1024, 5*time.Second, time.Minute)
+	f.now = func() time.Time { return now }
+	withRemoteTemplates(t, f)
+
+	renderFrom := func(url string) (*renderResult, error) {
+		return renderTemplate(context.Background(), renderRequest{Identifier: url, Parameters: map[string]interface{}{"name": "Ada"}})
+	}
+
+	result, err := renderFrom(server.URL + "/greeting.tmpl")
+	if err != nil || result.Output != "Hello Ada" {
+		t.Fatalf("renderFrom() = %v, %v", result, err)
+	}
+	if _, err := renderFrom(server.URL + "/greeting.tmpl"); err != nil || requests != 1 {
+		t.Errorf("Expected a cached template, got %d requests (%v)", requests, err)
+	}
+	now = now.Add(2 * time.Minute)
+	if result, err := renderFrom(server.URL + "/greeting.tmpl"); err != nil || result.Output != "Hello Ada" || revalidations != 1 {
+		t.Errorf("Expected a conditional revalidation, got %d (%v)", revalidations, err)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"host not allowed", "http://localhost:1/greeting.tmpl", http.StatusForbidden},
+		{"too large", server.URL + "/large.tmpl", http.StatusBadGateway},
+		{"not found", server.URL + "/missing.tmpl", http.StatusBadGateway},
+		{"redirect off allowlist", server.URL + "/redirect", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := renderFrom(tt.url)
+			if re, ok := err.(*render.Error); !ok || re.Status != tt.status {
+				t.Errorf("Expected %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+func TestRemoteTemplatesDisabled(t *testing.T) {
+	withRemoteTemplates(t, nil)
+	_, err := renderTemplate(context.Background(), renderRequest{Identifier: "https://templates.example.com/a.tmpl"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusForbidden {
+		t.Errorf("Expected 403 with remote templates disabled, got %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"templateservice/pkg/render"
+)
+
+// renderRequest is the engine-level description of a render.
+// Both the legacy handler and the semantic ReplaceAction handler normalize
+// their input into this structure so the pipeline is implemented once.
+type renderRequest struct {
+	Name           string                 // Template name used in parse errors
+	TemplateName   string                 // Stored template to render (see templates.go)
+	ParametersFrom string                 // Completed upload holding JSON parameters (see uploads.go)
+	Text           string                 // Inline template content
+	Identifier     string                 // Template file path (used when Text is empty)
+	RequestedID    string                 // Identifier as the caller sent it, before resolution to a path (see hooks.go)
+	Parameters     map[string]interface{} // Template variables
+	EncodingFormat string                 // Output format (e.g., "text/plain")
+	Assertions     *render.Assertions     // Optional contract checks on the output
+	Suppress       *suppressOptions       // Optional conditions under which the output is not sent (see suppress.go)
+	Delimiters     []string               // Optional [left, right] action delimiters (default "{{", "}}")
+	MissingKey     string                 // Missing map key handling: default, zero or error
+	MissingValue   *string                // Substitute printed for missing keys (overrides MissingKey)
+
+	TemplateVersion int    // Stored template version (0 = the one effective at EffectiveDate)
+	EffectiveDate   string // Time selecting the effective stored version (default now, see effective.go)
+	Trusted         bool   // Set from a stored template marked trusted; never from client input
+
+	Partials   map[string]string // Named templates available to {{template "name" .}}
+	Layout     string            // Stored layout to render the template into (see layout.go)
+	LayoutText string            // Resolved layout content
+
+	AllowedCallers []string // Set from the stored template; callers that may render it (see access.go)
+	OwnerTenant    string   // Set from the stored template; the tenant owning it (see tenants.go)
+	Tenant         string   // Calling tenant, which scopes cached templates
+
+	StoredVersion int // Version of the resolved stored template, 0 for other sources
+
+	TemplateCommit string // Commit a Git repository template was read from (see gitrepo.go)
+
+	Theme         string            // Namespace of the applied theme pack (see themes.go)
+	OptionSources map[string]string // Where each merged option came from (see options.go)
+
+	Engine string // Template engine, resolved from the request or its encoding format (see engine.go)
+
+	ConvertTo string // Format to convert the output to, e.g. application/pdf (see pdf.go)
+	Debug     bool   // Render with the debug functions (see debugfuncs.go)
+
+	Locale   string            // Locale of the translation functions, default TEMPLATE_DEFAULT_LOCALE (see i18n.go)
+	Messages map[string]string // Resolved messages of the caller's catalogs in Locale
+}
+
+// renderResult is the output of a successful render
+type renderResult struct {
+	Output             string
+	EncodingFormat     string
+	SHA256             string // Hex SHA-256 of Output
+	Signature          string // Base64 signature of Output (when signing is configured)
+	SignatureAlgorithm string
+	ContentURL         string // Location of the persisted output (when result persistence is enabled)
+	Trusted            bool   // Rendered from a trusted stored template
+	TemplateCommit     string // Commit of the Git repository template
+	StreamedBytes      int64  // Size of output written straight to the client (see stream.go)
+	Suppressed         bool   // Output matched the request's suppress options and is not to be sent
+
+	Options *effectiveOptions // How the render was performed (see options.go)
+}
+
+// renderTemplate resolves stored templates, consults the render policy,
+// compiles (or fetches from cache) and executes the template, runs the configured post-render hooks over the
+// output, checks the request's assertions and annotates the result with its
+// checksum and signature before persisting it. Every render is recorded in
+// the service metrics and the audit log (see audit.go) and counts towards
+// the caller's usage (see usage.go).
+func renderTemplate(ctx context.Context, req renderRequest) (*renderResult, error) {
+	start := time.Now()
+	result, err := runRenderStages(ctx, req)
+	observeRender(renderCallerFrom(ctx).Tenant, time.Since(start), result, err)
+	usage.observe(ctx, result, err)
+	audit.recordRender(ctx, req, result, err, time.Since(start))
+	return result, err
+}
+
+// runRenderStages performs the stages of renderTemplate, reporting them to
+// a streaming semantic client (see semanticstream.go) and profiling the
+// render for cost estimates (see estimate.go)
+func runRenderStages(ctx context.Context, req renderRequest) (*renderResult, error) {
+	profile := profileKey(renderCallerFrom(ctx).Tenant, req)
+	req, err := prepareRender(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	reportRenderStage(ctx, actionFetched, fetchedDetail(req))
+
+	start, allocs := time.Now(), heapAllocs()
+	output, err := renderOutput(ctx, req)
+	quarantine.observe(req, err)
+	if err != nil {
+		return nil, err
+	}
+	renderProfiles.record(profile, req.Engine, profileSample{
+		items:       datasetItems(req.Parameters),
+		duration:    time.Since(start),
+		outputBytes: int64(len(output)),
+		allocBytes:  heapAllocs() - allocs,
+	})
+	reportRenderStage(ctx, actionRendered, map[string]interface{}{"contentSize": len(output)})
+
+	result, err := finishRender(ctx, req, output)
+	if err != nil {
+		return nil, err
+	}
+	reportRenderStage(ctx, actionDelivered, deliveredDetail(result))
+	return result, nil
+}
+
+// prepareRender resolves the request's template sources and runs the checks
+// and policy that precede compilation
+func prepareRender(ctx context.Context, req renderRequest) (renderRequest, error) {
+	if err := usage.checkRender(ctx); err != nil {
+		return req, err
+	}
+	req.RequestedID = req.Identifier
+	request := req
+	loadCtx, load := startSpan(ctx, "template.load", spanKindInternal)
+	resolved, err := resolveTemplateSources(loadCtx, req)
+	load.SetAttributes(attribute.String("template.source", templateSource(req, resolved)))
+	endSpan(load, err)
+	if err != nil {
+		return req, err
+	}
+	req = resolved
+	if err := authorizeTemplateTenant(ctx, req); err != nil {
+		return req, err
+	}
+	if err := authorizeTemplateCaller(ctx, req); err != nil {
+		return req, err
+	}
+	req.Tenant = renderCallerFrom(ctx).Tenant
+	if err := quarantine.check(req); err != nil {
+		return req, err
+	}
+	if err := req.Suppress.validate(); err != nil {
+		return req, err
+	}
+	if err := checkDebugRender(req); err != nil {
+		return req, err
+	}
+	if req.ParametersFrom != "" {
+		if req.Parameters, err = loadUploadedParameters(ctx, req.ParametersFrom, req.Parameters); err != nil {
+			return req, err
+		}
+	}
+	req.Parameters = applyTheme(ctx, req.Parameters)
+	if pack := themes.forTenant(renderCallerFrom(ctx).Tenant); pack != nil {
+		req.Theme = pack.Tenant
+	}
+	if req, err = resolveLocale(req, renderCallerFrom(ctx).Tenant); err != nil {
+		return req, err
+	}
+	if req, err = evaluateRenderPolicy(ctx, req); err != nil {
+		return req, err
+	}
+	req.OptionSources = optionSources(request, resolved, req)
+	return req, nil
+}
+
+// finishRender runs the post-render hooks and assertions over the output,
+// then annotates and persists the result. Suppressed output is only annotated.
+func finishRender(ctx context.Context, req renderRequest, output string) (*renderResult, error) {
+	result := &renderResult{
+		Output:         output,
+		EncodingFormat: resultEncodingFormat(req),
+		Trusted:        req.Trusted,
+		TemplateCommit: req.TemplateCommit,
+	}
+	var postProcessors []string
+
+	if req.Suppress.applies(output) {
+		result.Suppressed = true
+		annotateIntegrity(result)
+		result.Options = effectiveOptionsFor(req, integrityProcessors())
+		return result, nil
+	}
+
+	if err := runPostRenderHooks(ctx, req, result); err != nil {
+		return nil, err
+	}
+	for range postRenderHooks {
+		postProcessors = append(postProcessors, "hook")
+	}
+
+	if err := render.CheckAssertions(req.Assertions, result.EncodingFormat, result.Output); err != nil {
+		return nil, err
+	}
+	if req.Assertions != nil {
+		postProcessors = append(postProcessors, "assertions")
+	}
+
+	if err := convertOutput(ctx, req, result); err != nil {
+		return nil, err
+	}
+	if req.ConvertTo != "" {
+		postProcessors = append(postProcessors, "convert:"+req.ConvertTo)
+	}
+
+	annotateIntegrity(result)
+	postProcessors = append(postProcessors, integrityProcessors()...)
+
+	if err := persistResult(result); err != nil {
+		return nil, err
+	}
+	if results != nil {
+		postProcessors = append(postProcessors, "persist")
+	}
+
+	result.Options = effectiveOptionsFor(req, postProcessors)
+	return result, nil
+}
+
+// resultEncodingFormat returns the request's output format, text/plain by default
+func resultEncodingFormat(req renderRequest) string {
+	if req.EncodingFormat == "" {
+		return "text/plain"
+	}
+	return req.EncodingFormat
+}
+
+// compileAndExecute compiles the request's template and renders its parameters
+func compileAndExecute(ctx context.Context, req renderRequest) (string, error) {
+	var output strings.Builder
+	if err := compileAndExecuteTo(ctx, req, &output); err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// compileAndExecuteTo compiles the request's template and writes its output to w
+func compileAndExecuteTo(ctx context.Context, req renderRequest, w io.Writer) error {
+	_, parse := startSpan(ctx, "template.parse", spanKindInternal)
+	tmpl, err := parseTemplate(req)
+	endSpan(parse, err)
+	if err != nil {
+		return withStage(err, stageParse)
+	}
+
+	execCtx, execute := startSpan(ctx, "template.execute", spanKindInternal)
+	counter := &countingWriter{w: w}
+	err = render.ExecuteTo(execCtx, tmpl, req.Parameters, counter, renderLimits())
+	execute.SetAttributes(attribute.Int64("template.output_size", counter.n))
+	endSpan(execute, err)
+	if err != nil {
+		return withStage(err, executionStage(err))
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// templateSource names where a resolved template came from, for traces
+func templateSource(original, resolved renderRequest) string {
+	switch {
+	case resolved.StoredVersion > 0:
+		return "store"
+	case resolved.TemplateCommit != "":
+		return "git"
+	case original.Text != "":
+		return "inline"
+	case isRemoteTemplate(original.Identifier):
+		return "remote"
+	case isBuiltinTemplate(original.Identifier):
+		return "builtin"
+	case strings.HasPrefix(original.Identifier, uploadRefPrefix):
+		return "upload"
+	}
+	return "file"
+}
+
+// resolveTemplateSources resolves the stored or built-in template, layout,
+// remote or Git repository template and template file (uploaded or below
+// TEMPLATE_ROOT) a request refers to, and the engine to parse it with
+func resolveTemplateSources(ctx context.Context, req renderRequest) (renderRequest, error) {
+	req, err := resolveTenantTemplate(ctx, req)
+	if err != nil {
+		return req, err
+	}
+	if req, err = resolveStoredTemplate(req); err != nil {
+		return req, err
+	}
+	if req, err = resolveBuiltinTemplate(req); err != nil {
+		return req, err
+	}
+	if req, err = resolveLayout(ctx, req); err != nil {
+		return req, err
+	}
+	if err := checkInlineOnly(req); err != nil {
+		return req, err
+	}
+	if req, err = resolveRemoteTemplate(req); err != nil {
+		return req, err
+	}
+	if req, err = resolveGitTemplate(ctx, req); err != nil {
+		return req, err
+	}
+	if req.Identifier, err = resolveTemplateFile(ctx, req.Identifier); err != nil {
+		return req, err
+	}
+	return resolveEngine(req)
+}
+
+// compileTemplate returns the compiled template of a request, consulting
+// the parsed-template cache first
+func compileTemplate(req renderRequest) (render.Template, error) {
+	key, err := templateCacheKey(req)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := templateCache.get(key); ok {
+		return cached, nil
+	}
+
+	engineReq := req.engineRequest()
+	if engineReq.Text, err = loadTemplateContent(req); err != nil {
+		return nil, err
+	}
+	tmpl, err := render.Compile(engineReq)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.put(key, tmpl)
+	return tmpl, nil
+}
+
+// loadTemplateContent returns the inline template text or reads it from the identifier path
+func loadTemplateContent(req renderRequest) (string, error) {
+	if req.Text != "" {
+		return req.Text, nil
+	}
+	if req.Identifier == "" {
+		return "", &render.Error{Message: "template text or identifier is required", Status: http.StatusBadRequest}
+	}
+
+	data, err := os.ReadFile(req.Identifier)
+	if err != nil {
+		return "", &render.Error{Message: "failed to read template file", Status: http.StatusBadRequest, Err: err}
+	}
+	return string(data), nil
+}
+
+// mergePartials returns base overlaid with overrides
+func mergePartials(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 {
+		return overrides
+	}
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for name, text := range base {
+		merged[name] = text
+	}
+	for name, text := range overrides {
+		merged[name] = text
+	}
+	return merged
+}
+
+// sortedKeys returns the keys of m in order, for deterministic hashing
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
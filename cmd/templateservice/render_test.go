@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRenderTemplate_CustomDelimiters(t *testing.T) {
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       `image: {{ .Values.image }} # <% .Tag %>`,
+		Parameters: map[string]interface{}{"Tag": "v1.2.3"},
+		Delimiters: []string{"<%", "%>"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+
+	expected := `image: {{ .Values.image }} # v1.2.3`
+	if result.Output != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Output)
+	}
+}
+
+func TestRenderTemplate_InvalidDelimiters(t *testing.T) {
+	_, err := renderTemplate(context.Background(), renderRequest{
+		Text:       "Hello",
+		Delimiters: []string{"<%"},
+	})
+	if err == nil {
+		t.Error("renderTemplate() should reject a single delimiter")
+	}
+}
+
+func TestRenderTemplate_MissingKeyModes(t *testing.T) {
+	params := map[string]interface{}{"Name": "Alice", "User": map[string]interface{}{}}
+
+	_, err := renderTemplate(context.Background(), renderRequest{
+		Text:       "{{.Missing}}",
+		Parameters: params,
+		MissingKey: "error",
+	})
+	if err == nil {
+		t.Error("renderTemplate() should fail on missing keys with missingKey=error")
+	}
+
+	fallback := "N/A"
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:         `{{.Name}} {{.Missing}} {{.User.Email}} {{if true}}{{.Other}}{{end}} {{$x := .Gone}}{{$x}}`,
+		Parameters:   params,
+		MissingValue: &fallback,
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if result.Output != "Alice N/A N/A N/A N/A" {
+		t.Errorf("Expected missing keys substituted, got %q", result.Output)
+	}
+
+	if _, err := renderTemplate(context.Background(), renderRequest{Text: "x", MissingKey: "bogus"}); err == nil {
+		t.Error("renderTemplate() should reject unknown missingKey modes")
+	}
+}
+
+func TestRenderTemplate_Partials(t *testing.T) {
+	partials := map[string]string{
+		"header": `<h1>{{.Title}}</h1>{{template "badge" .}}`,
+		"badge":  `[{{.Status}}]`,
+	}
+	params := map[string]interface{}{"Title": "Report", "Status": "ok"}
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       `{{template "header" .}} body`,
+		Parameters: params,
+		Partials:   partials,
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if expected := "<h1>Report</h1>[ok] body"; result.Output != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Output)
+	}
+
+	// A different partial must not be served from the cache
+	partials = map[string]string{"header": "== {{.Title}} ==", "badge": ""}
+	result, err = renderTemplate(context.Background(), renderRequest{
+		Text:       `{{template "header" .}} body`,
+		Parameters: params,
+		Partials:   partials,
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if expected := "== Report == body"; result.Output != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Output)
+	}
+
+	if _, err := renderTemplate(context.Background(), renderRequest{
+		Text:     "x",
+		Partials: map[string]string{"broken": "{{.Title"},
+	}); err == nil {
+		t.Error("renderTemplate() should reject a partial that does not parse")
+	}
+}
+
+func TestRenderTemplate_StoredPartials(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if err := templateStore.put(&storedTemplate{
+		Name:     "letter",
+		Text:     `{{template "greeting" .}}, {{template "signature" .}}`,
+		Partials: map[string]string{"greeting": "Dear {{.Name}}", "signature": "ACME"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Request partials override stored ones of the same name
+	result, err := renderTemplate(context.Background(), renderRequest{
+		TemplateName: "letter",
+		Parameters:   map[string]interface{}{"Name": "Ada"},
+		Partials:     map[string]string{"signature": "Support"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if expected := "Dear Ada, Support"; result.Output != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Output)
+	}
+}
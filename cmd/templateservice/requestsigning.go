@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Signed request headers
+const (
+	headerSignatureKeyID     = "X-Signature-Key-Id"
+	headerSignatureTimestamp = "X-Signature-Timestamp"
+	headerSignatureNonce     = "X-Signature-Nonce"
+	headerSignature          = "X-Signature"
+)
+
+// maxNonceLength bounds the nonces kept in the replay cache
+const maxNonceLength = 128
+
+// requestVerifier authenticates HMAC-signed requests. A request signs
+//
+//	METHOD \n PATH?QUERY \n TIMESTAMP \n NONCE \n hex(SHA-256(body))
+//
+// with HMAC-SHA256 under the secret of its key ID. Requests outside the
+// allowed clock skew and reused nonces are rejected.
+type requestVerifier struct {
+	secrets map[string][]byte // By key ID
+	skew    time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // Seen nonce -> expiry
+}
+
+// requestSigning is nil when signed requests are disabled
+var requestSigning *requestVerifier
+
+// configureRequestSigning loads the signing secrets. TEMPLATE_REQUEST_SIGNING_KEYS
+// holds comma-separated keyId:secret pairs; TEMPLATE_REQUEST_SIGNING_SKEW the
+// accepted clock difference.
+func configureRequestSigning() error {
+	pairs := envList("TEMPLATE_REQUEST_SIGNING_KEYS")
+	if len(pairs) == 0 {
+		requestSigning = nil
+		return nil
+	}
+	secrets := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return fmt.Errorf("TEMPLATE_REQUEST_SIGNING_KEYS: expected keyId:secret, got entry for %q", id)
+		}
+		secrets[id] = []byte(secret)
+	}
+	requestSigning = newRequestVerifier(secrets, envDuration("TEMPLATE_REQUEST_SIGNING_SKEW", 5*time.Minute))
+	logger.Infof("Signed requests enabled for %d keys", len(secrets))
+	return nil
+}
+
+func newRequestVerifier(secrets map[string][]byte, skew time.Duration) *requestVerifier {
+	return &requestVerifier{
+		secrets: secrets,
+		skew:    skew,
+		now:     time.Now,
+		nonces:  make(map[string]time.Time),
+	}
+}
+
+// isSignedRequest reports whether the request carries a signature
+func isSignedRequest(c echo.Context) bool {
+	return c.Request().Header.Get(headerSignature) != ""
+}
+
+// verify checks a signed request and records its nonce. The body is read
+// and replaced so handlers can still bind it.
+func (v *requestVerifier) verify(c echo.Context) (string, error) {
+	req := c.Request()
+	keyID := req.Header.Get(headerSignatureKeyID)
+	secret, ok := v.secrets[keyID]
+	if !ok {
+		return keyID, fmt.Errorf("unknown signing key %q", keyID)
+	}
+
+	timestamp := req.Header.Get(headerSignatureTimestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return keyID, fmt.Errorf("invalid %s", headerSignatureTimestamp)
+	}
+	now := v.now()
+	if math.Abs(now.Sub(time.Unix(seconds, 0)).Seconds()) > v.skew.Seconds() {
+		return keyID, fmt.Errorf("request timestamp outside the allowed %s skew", v.skew)
+	}
+
+	nonce := req.Header.Get(headerSignatureNonce)
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return keyID, fmt.Errorf("%s is required (at most %d characters)", headerSignatureNonce, maxNonceLength)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return keyID, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := signRequest(secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	signature, err := base64.StdEncoding.DecodeString(req.Header.Get(headerSignature))
+	if err != nil || !hmac.Equal(signature, expected) {
+		return keyID, fmt.Errorf("signature mismatch")
+	}
+
+	// Only valid signatures consume a nonce, so forged requests cannot fill the cache
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for seen, expiry := range v.nonces {
+		if now.After(expiry) {
+			delete(v.nonces, seen)
+		}
+	}
+	nonceKey := keyID + ":" + nonce
+	if _, replayed := v.nonces[nonceKey]; replayed {
+		return keyID, fmt.Errorf("nonce already used")
+	}
+	// A nonce only needs remembering while its timestamp is acceptable
+	v.nonces[nonceKey] = time.Unix(seconds, 0).Add(v.skew)
+	return keyID, nil
+}
+
+// signRequest returns the HMAC-SHA256 of a request's canonical form
+func signRequest(secret []byte, method, uri, timestamp, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", strings.ToUpper(method), uri, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+	return mac.Sum(nil)
+}
+
+// verifySignedRequest authenticates a signed request for apiKeyAuthMiddleware
+func verifySignedRequest(c echo.Context, next echo.HandlerFunc) error {
+	if requestSigning == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "signed requests are not enabled"})
+	}
+	keyID, err := requestSigning.verify(c)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Rejected signed request with key %q from %s: %v", keyID, c.RealIP(), err))
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": fmt.Sprintf("invalid request signature: %v", err)})
+	}
+	return authenticated(c, next, "hmac:"+keyID)
+}
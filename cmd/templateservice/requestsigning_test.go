@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func withRequestSigning(t *testing.T, v *requestVerifier) {
+	t.Helper()
+	previous := requestSigning
+	requestSigning = v
+	t.Cleanup(func() { requestSigning = previous })
+}
+
+func signedTestRequest(secret, timestamp, nonce, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render?x=1", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(headerSignatureKeyID, "ci")
+	req.Header.Set(headerSignatureTimestamp, timestamp)
+	req.Header.Set(headerSignatureNonce, nonce)
+	signature := signRequest([]byte(secret), http.MethodPost, "/v1/api/render?x=1", timestamp, nonce, []byte(body))
+	req.Header.Set(headerSignature, base64.StdEncoding.EncodeToString(signature))
+	return req
+}
+
+func TestSignedRequests(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := newRequestVerifier(map[string][]byte{"ci": []byte("s3cret")}, time.Minute)
+	v.now = func() time.Time { return now }
+	withRequestSigning(t, v)
+
+	e := echo.New()
+	e.POST("/v1/api/render", func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.String(http.StatusOK, string(body))
+	}, apiKeyAuthMiddleware)
+
+	stamp := strconv.FormatInt(now.Unix(), 10)
+	tests := []struct {
+		name     string
+		req      *http.Request
+		expected int
+	}{
+		{"valid", signedTestRequest("s3cret", stamp, "n1", `{"a":1}`), http.StatusOK},
+		{"replayed nonce", signedTestRequest("s3cret", stamp, "n1", `{"a":1}`), http.StatusUnauthorized},
+		{"wrong secret", signedTestRequest("other", stamp, "n2", `{"a":1}`), http.StatusUnauthorized},
+		{"stale timestamp", signedTestRequest("s3cret", strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10), "n3", `{}`), http.StatusUnauthorized},
+		{"unsigned", httptest.NewRequest(http.MethodPost, "/v1/api/render", nil), http.StatusUnauthorized},
+	}
+
+	tampered := signedTestRequest("s3cret", stamp, "n4", `{"a":1}`)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"a":2}`))
+	tests = append(tests, struct {
+		name     string
+		req      *http.Request
+		expected int
+	}{"tampered body", tampered, http.StatusUnauthorized})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, tt.req)
+			if rec.Code != tt.expected {
+				t.Errorf("Expected %d, got %d: %s", tt.expected, rec.Code, rec.Body)
+			}
+			if tt.expected == http.StatusOK && rec.Body.String() != `{"a":1}` {
+				t.Errorf("Expected body to reach the handler, got %q", rec.Body)
+			}
+		})
+	}
+}
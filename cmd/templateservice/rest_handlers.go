@@ -5,9 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
 )
 
 // REST endpoint request types
@@ -16,25 +21,51 @@ type RenderRequest struct {
 	Template   string                 `json:"template"`
 	TemplateID string                 `json:"templateId,omitempty"`
 	Parameters map[string]interface{} `json:"parameters"`
+	Assertions *render.Assertions     `json:"assertions,omitempty"`
+	Suppress   *suppressOptions       `json:"suppress,omitempty"`
+	Delimiters []string               `json:"delimiters,omitempty"`
+	MissingKey string                 `json:"missingKey,omitempty"`
+	Engine     string                 `json:"engine,omitempty"` // Template engine (default from encodingFormat, else go)
+
+	MissingKeyValue *string `json:"missingKeyValue,omitempty"`
+	TemplateName    string  `json:"templateName,omitempty"` // Stored template name
+
+	ParametersUpload string `json:"parametersUpload,omitempty"` // Upload ID of a JSON parameters file
+	TemplateVersion  int    `json:"templateVersion,omitempty"`  // Stored template version (default the one in effect)
+	EffectiveDate    string `json:"effectiveDate,omitempty"`    // Selects the stored version in effect at this time (default now)
+	EncodingFormat   string `json:"encodingFormat,omitempty"`   // Output format (e.g., "text/html")
+
+	Partials map[string]string `json:"partials,omitempty"` // Named templates for {{template "name" .}}
+	Layout   string            `json:"layout,omitempty"`   // Stored layout to render into
+
+	ConvertTo string `json:"convertTo,omitempty"` // Convert the output, e.g. HTML to application/pdf
+	Debug     bool   `json:"debug,omitempty"`     // Render with dump and debugJSON (debug mode servers only)
+	Locale    string `json:"locale,omitempty"`    // Locale of {{t "key"}} translations, e.g. de-CH
 }
 
 // registerRESTEndpoints adds REST endpoints that convert to semantic actions
-func registerRESTEndpoints(apiGroup *echo.Group, apiKeyMiddleware echo.MiddlewareFunc) {
+func registerRESTEndpoints(apiGroup *echo.Group, middleware ...echo.MiddlewareFunc) {
 	// POST /v1/api/render - Render template
-	apiGroup.POST("/render", renderTemplateREST, apiKeyMiddleware)
+	apiGroup.POST("/render", renderTemplateREST, middleware...)
+
+	// POST /v1/api/render/raw - Render template, returning the document body itself
+	apiGroup.POST("/render/raw", renderTemplateRaw, middleware...)
+
+	// POST /v1/api/render/stream - Render template, streaming the document body (see stream.go)
+	apiGroup.POST("/render/stream", renderTemplateStream, middleware...)
 }
 
 // renderTemplateREST handles REST POST /v1/api/render
 // Converts to ReplaceAction and delegates to semantic handler
 func renderTemplateREST(c echo.Context) error {
 	var req RenderRequest
-	if err := c.Bind(&req); err != nil {
+	if err := bindRequest(c, &req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
 	}
 
 	// Validate required fields
-	if req.Template == "" && req.TemplateID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "template or templateId is required"})
+	if req.Template == "" && req.TemplateID == "" && req.TemplateName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "template, templateId or templateName is required"})
 	}
 
 	// Build object (template content)
@@ -47,6 +78,12 @@ func renderTemplateREST(c echo.Context) error {
 	if req.TemplateID != "" {
 		object["contentUrl"] = req.TemplateID
 	}
+	if req.TemplateName != "" {
+		object["identifier"] = req.TemplateName
+	}
+	if req.EncodingFormat != "" {
+		object["encodingFormat"] = req.EncodingFormat
+	}
 
 	// Convert to JSON-LD ReplaceAction
 	action := map[string]interface{}{
@@ -55,14 +92,149 @@ func renderTemplateREST(c echo.Context) error {
 		"object":   object,
 	}
 
-	// Add parameters if provided
-	if req.Parameters != nil {
-		action["additionalProperty"] = req.Parameters
+	// Add parameters and render options if provided
+	if properties := actionProperties(req.Parameters, map[string]interface{}{
+		"assertions":       req.Assertions,
+		"suppress":         req.Suppress,
+		"delimiters":       req.Delimiters,
+		"missingKey":       req.MissingKey,
+		"missingKeyValue":  req.MissingKeyValue,
+		"parametersUpload": req.ParametersUpload,
+		"templateVersion":  req.TemplateVersion,
+		"effectiveDate":    req.EffectiveDate,
+		"partials":         req.Partials,
+		"layout":           req.Layout,
+		"engine":           req.Engine,
+		"convertTo":        req.ConvertTo,
+		"debug":            req.Debug,
+		"locale":           req.Locale,
+	}); properties != nil {
+		action["additionalProperty"] = properties
 	}
 
 	return callSemanticHandler(c, action)
 }
 
+// renderTemplateRaw handles REST POST /v1/api/render/raw.
+// The rendered output is written directly as the response body with the
+// Content-Type derived from its encoding format; integrity metadata is
+// returned in headers. Failures use the JSON error format. HTML and SVG
+// from templates not marked trusted are served as text/plain.
+func renderTemplateRaw(c echo.Context) error {
+	var req RenderRequest
+	if err := bindRequest(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+	if req.Template == "" && req.TemplateID == "" && req.TemplateName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "template, templateId or templateName is required"})
+	}
+
+	rendered, err := renderTemplate(c.Request().Context(), rawRenderRequest(req))
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+
+	header := c.Response().Header()
+	if rendered.Suppressed {
+		header.Set(suppressedHeader, "true")
+		return c.NoContent(http.StatusNoContent)
+	}
+	header.Set("X-Content-SHA256", rendered.SHA256)
+	return c.Blob(http.StatusOK, setRawHeaders(header, rendered), []byte(rendered.Output))
+}
+
+// rawRenderRequest converts a raw or streamed render request for the pipeline
+func rawRenderRequest(req RenderRequest) renderRequest {
+	return renderRequest{
+		Name:           "template",
+		Text:           req.Template,
+		Identifier:     req.TemplateID,
+		Parameters:     req.Parameters,
+		EncodingFormat: req.EncodingFormat,
+		Assertions:     req.Assertions,
+		Suppress:       req.Suppress,
+		Delimiters:     req.Delimiters,
+		MissingKey:     req.MissingKey,
+		MissingValue:   req.MissingKeyValue,
+		TemplateName:   req.TemplateName,
+		ParametersFrom: req.ParametersUpload,
+
+		TemplateVersion: req.TemplateVersion,
+		EffectiveDate:   req.EffectiveDate,
+		Partials:        req.Partials,
+		Layout:          req.Layout,
+		Engine:          req.Engine,
+		ConvertTo:       req.ConvertTo,
+		Debug:           req.Debug,
+		Locale:          req.Locale,
+	}
+}
+
+// setRawHeaders sets the integrity and provenance headers of a raw response
+// and returns its Content-Type
+func setRawHeaders(header http.Header, rendered *renderResult) string {
+	if rendered.Signature != "" {
+		header.Set("X-Content-Signature", rendered.Signature)
+		header.Set("X-Content-Signature-Algorithm", rendered.SignatureAlgorithm)
+	}
+	if rendered.ContentURL != "" {
+		header.Set("Content-Location", rendered.ContentURL)
+	}
+	if rendered.TemplateCommit != "" {
+		header.Set("X-Template-Commit", rendered.TemplateCommit)
+	}
+
+	// HTML rendered from caller-supplied input could carry script into the
+	// service's origin; only trusted stored templates are served as such
+	contentType := rawContentType(rendered.EncodingFormat)
+	if isActiveContent(rendered.EncodingFormat) {
+		if rendered.Trusted {
+			header.Set("Content-Security-Policy", trustedHTMLContentSecurityPolicy)
+		} else {
+			contentType = echo.MIMETextPlainCharsetUTF8
+		}
+	}
+	return contentType
+}
+
+// rawContentType returns the Content-Type for an encoding format, declaring
+// UTF-8 for textual formats that do not name a charset
+func rawContentType(encodingFormat string) string {
+	mediaType, params, err := mime.ParseMediaType(encodingFormat)
+	if err != nil {
+		return echo.MIMEOctetStream
+	}
+	textual := strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == echo.MIMEApplicationJSON || mediaType == echo.MIMEApplicationXML ||
+		mediaType == echo.MIMEApplicationJavaScript
+	if textual && params["charset"] == "" {
+		params["charset"] = "utf-8"
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// actionProperties builds the additionalProperty map of a ReplaceAction.
+// Without options the parameters are passed as-is; otherwise they are nested
+// under templateParameters so options are not mistaken for template variables.
+func actionProperties(parameters map[string]interface{}, options map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for key, value := range options {
+		if value != nil && !reflect.ValueOf(value).IsZero() {
+			properties[key] = value
+		}
+	}
+	if len(properties) == 0 {
+		return parameters
+	}
+
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+	properties["templateParameters"] = parameters
+	return properties
+}
+
 // callSemanticHandler converts action to JSON and calls the semantic action handler
 func callSemanticHandler(c echo.Context, action map[string]interface{}) error {
 	// Marshal action to JSON
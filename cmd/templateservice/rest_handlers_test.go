@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRenderTemplateRaw(t *testing.T) {
+	e := echo.New()
+	body := `{"template": "<h1>{{.Title}}</h1>", "parameters": {"Title": "Tom & Jerry"}, "encodingFormat": "text/html"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render/raw", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if err := renderTemplateRaw(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("renderTemplateRaw() returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Body.String(); got != "<h1>Tom & Jerry</h1>" {
+		t.Errorf("Expected raw body, got %q", got)
+	}
+	// Inline templates are untrusted, so HTML is not served as active content
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "text/plain; charset=UTF-8" {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	if rec.Header().Get("X-Content-SHA256") == "" {
+		t.Error("Expected X-Content-SHA256 header")
+	}
+}
+
+func TestRenderTemplateRawTrusted(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if err := templateStore.put(&storedTemplate{Name: "page", Text: "<h1>{{.Title}}</h1>", EncodingFormat: "text/html", Trusted: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render/raw", strings.NewReader(`{"templateName": "page", "parameters": {"Title": "Hi"}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if err := renderTemplateRaw(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("renderTemplateRaw() returned error: %v", err)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "text/html; charset=utf-8" {
+		t.Errorf("Expected trusted HTML to keep its type, got %q", ct)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); csp != trustedHTMLContentSecurityPolicy {
+		t.Errorf("Expected trusted HTML policy, got %q", csp)
+	}
+}
+
+func TestRawContentType(t *testing.T) {
+	tests := map[string]string{
+		"text/plain":                   "text/plain; charset=utf-8",
+		"application/json":             "application/json; charset=utf-8",
+		"text/csv; charset=iso-8859-1": "text/csv; charset=iso-8859-1",
+		"application/pdf":              "application/pdf",
+		"not a type":                   echo.MIMEOctetStream,
+	}
+	for format, expected := range tests {
+		if got := rawContentType(format); got != expected {
+			t.Errorf("rawContentType(%q) = %q, want %q", format, got, expected)
+		}
+	}
+}
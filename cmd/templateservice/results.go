@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// resultStore persists rendered output content-addressed by SHA-256.
+// Identical outputs share one blob, so mass mail-merge jobs producing the
+// same document many times only store it once.
+type resultStore struct {
+	dir       string
+	retention time.Duration // 0 keeps results indefinitely
+	mu        sync.Mutex
+}
+
+// resultMeta is stored next to each blob
+type resultMeta struct {
+	EncodingFormat string `json:"encodingFormat"`
+	ContentSize    int    `json:"contentSize"`
+}
+
+// results is nil when result persistence is disabled
+var results *resultStore
+
+// configureResultStore enables result persistence when TEMPLATE_RESULT_DIR
+// is set. Results older than TEMPLATE_RESULT_RETENTION are purged.
+func configureResultStore() error {
+	dir := os.Getenv("TEMPLATE_RESULT_DIR")
+	if dir == "" {
+		return nil
+	}
+	store, err := newResultStore(dir)
+	if err != nil {
+		return err
+	}
+	store.retention = envDuration("TEMPLATE_RESULT_RETENTION", 0)
+	results = store
+	logger.Infof("Result persistence enabled in %s", dir)
+	return nil
+}
+
+// newResultStore creates a store rooted at dir
+func newResultStore(dir string) (*resultStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &resultStore{dir: dir}, nil
+}
+
+// blobPath returns the sharded path of a blob (e.g. ab/abcdef...)
+func (s *resultStore) blobPath(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// put stores output under its hash unless an identical blob already exists.
+// It reports whether the write was deduplicated.
+func (s *resultStore) put(hash, output, encodingFormat string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.blobPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		// Retention counts from the latest render of the content
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+
+	meta, err := json.Marshal(resultMeta{EncodingFormat: encodingFormat, ContentSize: len(output)})
+	if err != nil {
+		return false, err
+	}
+	if err := writeFileAtomic(path+".json", meta); err != nil {
+		return false, err
+	}
+	// The blob is written last so its presence implies complete metadata
+	if err := writeFileAtomic(path, []byte(output)); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// get returns a stored blob and its metadata
+func (s *resultStore) get(hash string) ([]byte, *resultMeta, error) {
+	data, err := os.ReadFile(s.blobPath(hash))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta := &resultMeta{EncodingFormat: "text/plain", ContentSize: len(data)}
+	if raw, err := os.ReadFile(s.blobPath(hash) + ".json"); err == nil {
+		_ = json.Unmarshal(raw, meta)
+	}
+	return data, meta, nil
+}
+
+// remove deletes a stored blob and its metadata unless it is under legal hold
+func (s *resultStore) remove(hash string) error {
+	return legalHolds.removeUnlessHeld(holdResult, hash, func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := os.Remove(s.blobPath(hash)); err != nil {
+			return err
+		}
+		os.Remove(s.blobPath(hash) + ".json")
+		return nil
+	})
+}
+
+// expire removes results stored longer than the retention period ago,
+// except those under legal hold
+func (s *resultStore) expire() int {
+	if s.retention <= 0 {
+		return 0
+	}
+	shards, err := os.ReadDir(s.dir)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list results")
+		return 0
+	}
+	expired := 0
+	cutoff := time.Now().Add(-s.retention)
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, shard.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			hash := entry.Name()
+			if !sha256Pattern.MatchString(hash) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+			if err := s.remove(hash); err == nil {
+				expired++
+			}
+		}
+	}
+	return expired
+}
+
+// runJanitor periodically purges expired results until stop is closed
+func (s *resultStore) runJanitor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.expire()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// persistResult stores a render result and sets its content URL
+func persistResult(result *renderResult) error {
+	if results == nil {
+		return nil
+	}
+	if _, err := results.put(result.SHA256, result.Output, result.EncodingFormat); err != nil {
+		return &render.Error{Message: "failed to persist result", Status: http.StatusInternalServerError, Err: err}
+	}
+	result.ContentURL = "/v1/api/results/" + result.SHA256
+	return nil
+}
+
+// handleGetResult serves GET /v1/api/results/:sha256
+func handleGetResult(c echo.Context) error {
+	if results == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "result persistence is disabled"})
+	}
+
+	hash := c.Param("sha256")
+	if !sha256Pattern.MatchString(hash) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid result hash"})
+	}
+
+	data, meta, err := results.get(hash)
+	if errors.Is(err, os.ErrNotExist) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "result not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.Blob(http.StatusOK, meta.EncodingFormat, data)
+}
+
+// handleDeleteResult handles DELETE /v1/api/results/:sha256. Results under
+// legal hold cannot be deleted.
+func handleDeleteResult(c echo.Context) error {
+	if results == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "result persistence is disabled"})
+	}
+	hash := c.Param("sha256")
+	if !sha256Pattern.MatchString(hash) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid result hash"})
+	}
+
+	err := results.remove(hash)
+	if errors.Is(err, errLegalHold) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "result is under legal hold"})
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "result not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
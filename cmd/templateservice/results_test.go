@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResultStore_Deduplicates(t *testing.T) {
+	store, err := newResultStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("newResultStore() returned error: %v", err)
+	}
+
+	hash := outputChecksum("Dear Alice")
+
+	deduplicated, err := store.put(hash, "Dear Alice", "text/plain")
+	if err != nil {
+		t.Fatalf("put() returned error: %v", err)
+	}
+	if deduplicated {
+		t.Error("First put() should not be deduplicated")
+	}
+
+	deduplicated, err = store.put(hash, "Dear Alice", "text/plain")
+	if err != nil {
+		t.Fatalf("put() returned error: %v", err)
+	}
+	if !deduplicated {
+		t.Error("Second put() of identical output should be deduplicated")
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(store.dir, hash[:2]))
+	if len(entries) != 2 {
+		t.Errorf("Expected one blob and one metadata file, got %d entries", len(entries))
+	}
+
+	data, meta, err := store.get(hash)
+	if err != nil {
+		t.Fatalf("get() returned error: %v", err)
+	}
+	if string(data) != "Dear Alice" || meta.EncodingFormat != "text/plain" {
+		t.Errorf("Unexpected stored result %q (%s)", data, meta.EncodingFormat)
+	}
+}
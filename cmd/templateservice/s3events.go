@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// s3Pipeline renders objects uploaded under a bucket prefix with a stored
+// template and writes the result back to the bucket
+type s3Pipeline struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty"` // e.g. ".json"
+
+	Template       string `json:"template"` // Stored template name
+	EncodingFormat string `json:"encodingFormat,omitempty"`
+
+	OutputBucket string `json:"outputBucket,omitempty"` // Defaults to Bucket
+	OutputPrefix string `json:"outputPrefix"`
+	OutputSuffix string `json:"outputSuffix,omitempty"` // Replaces Suffix, e.g. ".html"
+
+	// Further sinks receiving the output after the bucket (see sinks.go)
+	Webhook      string                `json:"webhook,omitempty"` // URL the output is POSTed to
+	MailTo       string                `json:"mailTo,omitempty"`  // Address the output is mailed to (TEMPLATE_SMTP_*)
+	Compensation *deliveryCompensation `json:"compensation,omitempty"`
+}
+
+// multiSink reports whether the pipeline's deliveries are tracked one by
+// one: it has further sinks or a compensation policy
+func (p s3Pipeline) multiSink() bool {
+	return p.Webhook != "" || p.MailTo != "" || p.Compensation != nil
+}
+
+// matches reports whether an uploaded object is input to the pipeline.
+// Objects the pipeline wrote itself never match, so a pipeline cannot
+// trigger itself.
+func (p s3Pipeline) matches(bucket, key string) bool {
+	if bucket == p.outputBucket() && strings.HasPrefix(key, p.OutputPrefix) {
+		return false
+	}
+	return bucket == p.Bucket && strings.HasPrefix(key, p.Prefix) && strings.HasSuffix(key, p.Suffix)
+}
+
+func (p s3Pipeline) outputBucket() string {
+	if p.OutputBucket != "" {
+		return p.OutputBucket
+	}
+	return p.Bucket
+}
+
+// outputKey maps a source key to its result key: the path below Prefix is
+// kept and Suffix is replaced by OutputSuffix
+func (p s3Pipeline) outputKey(key string) string {
+	rel := strings.TrimSuffix(strings.TrimPrefix(key, p.Prefix), p.Suffix)
+	return p.OutputPrefix + rel + p.OutputSuffix
+}
+
+// s3Client reads and writes objects with path-style requests signed with
+// AWS Signature Version 4, which S3 and MinIO both accept
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	maxBytes  int64
+	client    *http.Client
+	now       func() time.Time
+}
+
+// s3 pipeline settings; s3Events is nil when no pipelines are configured
+var (
+	s3Events       *s3Client
+	s3Pipelines    []s3Pipeline
+	s3WebhookToken string
+	s3Mail         smtpSettings // Server of pipelines mailing their output
+)
+
+// configureS3Events loads the object store connection and the pipelines
+// from TEMPLATE_S3_* environment variables
+func configureS3Events() error {
+	s3Events, s3Pipelines = nil, nil
+	s3WebhookToken = os.Getenv("TEMPLATE_S3_WEBHOOK_TOKEN")
+	config := os.Getenv("TEMPLATE_S3_PIPELINES")
+	if config == "" {
+		return nil
+	}
+
+	var pipelines []s3Pipeline
+	if err := json.Unmarshal([]byte(config), &pipelines); err != nil {
+		return fmt.Errorf("TEMPLATE_S3_PIPELINES: %w", err)
+	}
+	for i, p := range pipelines {
+		if p.Bucket == "" || !validTemplateName(p.Template) {
+			return fmt.Errorf("TEMPLATE_S3_PIPELINES[%d]: bucket and a valid template name are required", i)
+		}
+		if p.outputBucket() == p.Bucket && p.OutputPrefix == "" {
+			return fmt.Errorf("TEMPLATE_S3_PIPELINES[%d]: outputPrefix is required when writing to the source bucket", i)
+		}
+		if u, err := url.Parse(p.Webhook); p.Webhook != "" && (err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https")) {
+			return fmt.Errorf("TEMPLATE_S3_PIPELINES[%d]: webhook must be an http(s) URL, got %q", i, p.Webhook)
+		}
+		if _, err := mail.ParseAddress(p.MailTo); p.MailTo != "" && err != nil {
+			return fmt.Errorf("TEMPLATE_S3_PIPELINES[%d]: invalid mailTo %q", i, p.MailTo)
+		}
+		if p.MailTo != "" {
+			settings, ok := smtpFromEnv()
+			if !ok {
+				return fmt.Errorf("TEMPLATE_S3_PIPELINES[%d]: TEMPLATE_SMTP_ADDR and TEMPLATE_SMTP_FROM are required with mailTo", i)
+			}
+			s3Mail = settings
+		}
+		if p.Compensation != nil {
+			if err := pipelines[i].Compensation.validate(); err != nil {
+				return fmt.Errorf("TEMPLATE_S3_PIPELINES[%d]: %w", i, err)
+			}
+		}
+	}
+	if s3WebhookToken == "" {
+		return errors.New("TEMPLATE_S3_WEBHOOK_TOKEN is required with TEMPLATE_S3_PIPELINES")
+	}
+
+	endpoint, err := url.Parse(os.Getenv("TEMPLATE_S3_ENDPOINT"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return fmt.Errorf("TEMPLATE_S3_ENDPOINT must be an http(s) URL, got %q", os.Getenv("TEMPLATE_S3_ENDPOINT"))
+	}
+	region := os.Getenv("TEMPLATE_S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	s3Events = newS3Client(endpoint, region, os.Getenv("TEMPLATE_S3_ACCESS_KEY"), os.Getenv("TEMPLATE_S3_SECRET_KEY"),
+		int64(envInt("TEMPLATE_S3_MAX_MB", 16))<<20, envDuration("TEMPLATE_S3_TIMEOUT", 30*time.Second))
+	s3Pipelines = pipelines
+	logger.Infof("S3 event pipelines enabled: %d configured for %s", len(pipelines), endpoint.Host)
+	return nil
+}
+
+func newS3Client(endpoint *url.URL, region, accessKey, secretKey string, maxBytes int64, timeout time.Duration) *s3Client {
+	return &s3Client{
+		endpoint:  endpoint,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		maxBytes:  maxBytes,
+		client:    &http.Client{Timeout: timeout},
+		now:       time.Now,
+	}
+}
+
+// objectURL returns the path-style URL of an object
+func (s *s3Client) objectURL(bucket, key string) string {
+	return strings.TrimSuffix(s.endpoint.String(), "/") + s3EscapePath("/"+bucket+"/"+key)
+}
+
+// getObject downloads an object, refusing objects larger than maxBytes
+func (s *s3Client) getObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, sha256Hex(nil))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET s3://%s/%s returned status %d", bucket, key, resp.StatusCode)
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, fmt.Errorf("s3://%s/%s exceeds %d bytes", bucket, key, s.maxBytes)
+	}
+	return data, nil
+}
+
+// putObject uploads an object
+func (s *s3Client) putObject(ctx context.Context, bucket, key, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(bucket, key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, sha256Hex(data))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("PUT s3://%s/%s returned status %d", bucket, key, resp.StatusCode)
+	}
+	return nil
+}
+
+// deleteObject removes an object
+func (s *s3Client) deleteObject(ctx context.Context, bucket, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, sha256Hex(nil))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DELETE s3://%s/%s returned status %d", bucket, key, resp.StatusCode)
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header covering the
+// host, the x-amz-* headers, Content-Type and Range
+func (s *s3Client) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{now.Format("20060102"), s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3EscapePath percent-encodes everything but unreserved characters and
+// slashes, as S3 expects in canonical requests
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3EventNotification is the body of an S3 or MinIO bucket notification
+type s3EventNotification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"` // URL-encoded
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// s3EventResult reports what happened to one notification record
+type s3EventResult struct {
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	Template     string `json:"template,omitempty"`
+	OutputBucket string `json:"outputBucket,omitempty"`
+	OutputKey    string `json:"outputKey,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+	Skipped      bool   `json:"skipped,omitempty"`    // No pipeline matched or not an upload
+	Suppressed   bool   `json:"suppressed,omitempty"` // Output suppressed by the template, nothing written
+	Error        string `json:"error,omitempty"`
+	Status       int    `json:"status,omitempty"`
+
+	Outcome    string          `json:"outcome,omitempty"` // Of pipelines with several sinks: delivered, partial, failed or rolled_back
+	Deliveries []*sinkDelivery `json:"deliveries,omitempty"`
+}
+
+// handleS3Events handles POST /v1/api/s3/events, a bucket notification
+// webhook authenticated by TEMPLATE_S3_WEBHOOK_TOKEN. Each uploaded object
+// matching a pipeline is rendered and written to the pipeline's output
+// location before the request is answered, so a failed record makes the
+// notifier retry. Records delivered to some of their sinks only are answered
+// 207, since retrying them would repeat the deliveries that succeeded.
+func handleS3Events(c echo.Context) error {
+	if s3Events == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "S3 event pipelines are not configured"})
+	}
+	token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	if !hmac.Equal([]byte(token), []byte(s3WebhookToken)) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid webhook token"})
+	}
+	var event s3EventNotification
+	if err := json.NewDecoder(io.LimitReader(c.Request().Body, 1<<20)).Decode(&event); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid event notification"})
+	}
+
+	ctx := c.Request().Context()
+	results := make([]s3EventResult, 0, len(event.Records))
+	status := http.StatusOK
+	for _, record := range event.Records {
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+		result := s3EventResult{Bucket: record.S3.Bucket.Name, Key: key}
+		if !strings.Contains(record.EventName, "ObjectCreated:") {
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+		matched := false
+		for _, p := range s3Pipelines {
+			if !p.matches(result.Bucket, key) {
+				continue
+			}
+			matched = true
+			r := runS3Pipeline(ctx, p, result.Bucket, key)
+			switch {
+			case r.Outcome == deliveryPartial && status == http.StatusOK:
+				status = http.StatusMultiStatus
+			case r.Error != "" && r.Outcome != deliveryPartial:
+				status = http.StatusBadGateway
+			}
+			results = append(results, r)
+		}
+		if !matched {
+			result.Skipped = true
+			results = append(results, result)
+		}
+	}
+	return c.JSON(status, map[string]interface{}{"results": results})
+}
+
+// runS3Pipeline renders one uploaded object and stores the output
+func runS3Pipeline(ctx context.Context, p s3Pipeline, bucket, key string) s3EventResult {
+	result := s3EventResult{Bucket: bucket, Key: key, Template: p.Template}
+	fail := func(err error) s3EventResult {
+		result.Error, result.Status = err.Error(), http.StatusBadGateway
+		var re *render.Error
+		if errors.As(err, &re) {
+			result.Status = re.Status
+		}
+		logger.WithError(err).Error(fmt.Sprintf("S3 pipeline failed for s3://%s/%s", bucket, key))
+		return result
+	}
+
+	data, err := s3Events.getObject(ctx, bucket, key)
+	if err != nil {
+		return fail(err)
+	}
+	var parameters map[string]interface{}
+	if err := json.Unmarshal(data, &parameters); err != nil {
+		return fail(&render.Error{Message: "object must be a JSON object", Status: http.StatusUnprocessableEntity, Err: err})
+	}
+
+	ctx = withRenderCaller(ctx, renderCaller{Principal: "s3:" + bucket, Endpoint: "POST /v1/api/s3/events"})
+	rendered, err := renderTemplate(ctx, renderRequest{
+		TemplateName:   p.Template,
+		Parameters:     parameters,
+		EncodingFormat: p.EncodingFormat,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if rendered.Suppressed {
+		result.Suppressed = true
+		logger.Infof("Output of s3://%s/%s with %s suppressed, nothing written", bucket, key, p.Template)
+		return result
+	}
+
+	result.OutputBucket, result.OutputKey = p.outputBucket(), p.outputKey(key)
+	if p.multiSink() {
+		return deliverS3Pipeline(ctx, p, result, rendered)
+	}
+	if err := s3Events.putObject(ctx, result.OutputBucket, result.OutputKey, rendered.EncodingFormat, []byte(rendered.Output)); err != nil {
+		return fail(err)
+	}
+	result.SHA256 = rendered.SHA256
+	logger.Infof("Rendered s3://%s/%s with %s to s3://%s/%s", bucket, key, p.Template, result.OutputBucket, result.OutputKey)
+	return result
+}
+
+// deliverS3Pipeline writes the output of a pipeline with several sinks to
+// each of them, compensating failures as the pipeline's policy says
+func deliverS3Pipeline(ctx context.Context, p s3Pipeline, result s3EventResult, rendered *renderResult) s3EventResult {
+	source := "s3://" + result.Bucket + "/" + result.Key
+	deliveries := []*sinkDelivery{{
+		Sink:   "s3",
+		Target: "s3://" + result.OutputBucket + "/" + result.OutputKey,
+		send: func(ctx context.Context) error {
+			return s3Events.putObject(ctx, result.OutputBucket, result.OutputKey, rendered.EncodingFormat, []byte(rendered.Output))
+		},
+		undo: func(ctx context.Context) error {
+			return s3Events.deleteObject(ctx, result.OutputBucket, result.OutputKey)
+		},
+	}}
+	if p.Webhook != "" {
+		deliveries = append(deliveries, webhookDelivery(s3Events.client, p.Webhook, source, rendered))
+	}
+	if p.MailTo != "" {
+		deliveries = append(deliveries, mailDelivery(s3Mail, p.MailTo, source, rendered))
+	}
+	var policy deliveryCompensation
+	if p.Compensation != nil {
+		policy = *p.Compensation
+	}
+
+	result.Outcome = deliver(ctx, deliveries, policy)
+	result.Deliveries = deliveries
+	result.SHA256 = rendered.SHA256
+	if result.Outcome == deliveryDelivered {
+		logger.Infof("Rendered %s with %s to %d sinks", source, p.Template, len(deliveries))
+		return result
+	}
+	var failed []string
+	for _, d := range deliveries {
+		if d.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", d.Sink, d.Error))
+		}
+	}
+	result.Error, result.Status = strings.Join(failed, "; "), http.StatusBadGateway
+	logger.Error(fmt.Sprintf("S3 pipeline for %s %s: %s", source, strings.ReplaceAll(result.Outcome, "_", " "), result.Error))
+	return result
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"templateservice/pkg/render"
+)
+
+// sandboxSubcommand makes the service binary render a single template from
+// stdin instead of starting the server
+const sandboxSubcommand = "render-sandbox"
+
+// Sandbox modes
+const (
+	sandboxOff       = ""
+	sandboxUntrusted = "untrusted" // All templates except stored templates marked trusted
+	sandboxAll       = "all"
+)
+
+// sandboxGrace is how long a sandbox may outlive the render timeout before it is killed
+const sandboxGrace = 2 * time.Second
+
+// sandbox settings, from TEMPLATE_SANDBOX, TEMPLATE_SANDBOX_MEMORY_MB and
+// TEMPLATE_SANDBOX_CPU_SECONDS
+var (
+	sandboxMode       = sandboxOff
+	sandboxMemoryMB   = 256
+	sandboxCPUSeconds = 10
+)
+
+// sandboxCommand starts a sandbox process; tests substitute a helper process
+var sandboxCommand = func(ctx context.Context) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, exe, sandboxSubcommand), nil
+}
+
+// configureSandbox loads the sandbox settings from the environment
+func configureSandbox() error {
+	mode := os.Getenv("TEMPLATE_SANDBOX")
+	switch mode {
+	case sandboxOff, sandboxUntrusted, sandboxAll:
+	default:
+		return fmt.Errorf("TEMPLATE_SANDBOX must be %q or %q, got %q", sandboxUntrusted, sandboxAll, mode)
+	}
+	sandboxMode = mode
+	sandboxMemoryMB = envInt("TEMPLATE_SANDBOX_MEMORY_MB", 256)
+	sandboxCPUSeconds = envInt("TEMPLATE_SANDBOX_CPU_SECONDS", 10)
+
+	if sandboxMode != sandboxOff {
+		logger.Infof("Rendering %s templates in sandbox processes (%d MB, %d CPU seconds)", sandboxMode, sandboxMemoryMB, sandboxCPUSeconds)
+	}
+	return nil
+}
+
+// sandboxed reports whether req is rendered in a sandbox process
+func sandboxed(req renderRequest) bool {
+	switch sandboxMode {
+	case sandboxAll:
+		return true
+	case sandboxUntrusted:
+		return !req.Trusted
+	}
+	return false
+}
+
+// sandboxJob is the template and settings handed to a sandbox process. The
+// process gets no environment, so everything it needs is in here.
+type sandboxJob struct {
+	Name         string                 `json:"name,omitempty"`
+	Text         string                 `json:"text"`
+	Layout       string                 `json:"layout,omitempty"`
+	LayoutText   string                 `json:"layoutText,omitempty"`
+	Partials     map[string]string      `json:"partials,omitempty"`
+	Delimiters   []string               `json:"delimiters,omitempty"`
+	MissingKey   string                 `json:"missingKey,omitempty"`
+	MissingValue *string                `json:"missingValue,omitempty"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+	Engine       string                 `json:"engine,omitempty"`
+	Debug        bool                   `json:"debug,omitempty"`
+	Locale       string                 `json:"locale,omitempty"`
+	Messages     map[string]string      `json:"messages,omitempty"`
+
+	Funcs          []string      `json:"funcs"`             // Names of the template functions to expose
+	Plugins        []string      `json:"plugins,omitempty"` // Function plugins to load (see plugins.go)
+	Timeout        time.Duration `json:"timeout"`
+	MaxOutputBytes int64         `json:"maxOutputBytes"`
+	MemoryMB       int           `json:"memoryMB"`
+	CPUSeconds     int           `json:"cpuSeconds"`
+}
+
+// sandboxResult is the sandbox process's answer
+type sandboxResult struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Cause  string `json:"cause,omitempty"`
+	Stage  string `json:"stage,omitempty"`
+}
+
+// renderOutput compiles and executes the request's template, in a sandbox
+// process when configured
+func renderOutput(ctx context.Context, req renderRequest) (string, error) {
+	if format, ok := officeFormatFor(req.EncodingFormat); ok {
+		return renderOfficeDocument(ctx, req, format)
+	}
+	if !sandboxed(req) {
+		return compileAndExecute(ctx, req)
+	}
+	sandboxCtx, s := startSpan(ctx, "template.sandbox", spanKindInternal)
+	output, err := renderInSandbox(sandboxCtx, req)
+	s.SetAttributes(attribute.Int("template.output_size", len(output)))
+	endSpan(s, err)
+	return output, err
+}
+
+// renderInSandbox renders req in a resource-limited child process, killing
+// it when the render timeout passes or the request is cancelled
+func renderInSandbox(ctx context.Context, req renderRequest) (string, error) {
+	text, err := loadTemplateContent(req)
+	if err != nil {
+		return "", err
+	}
+	input, err := json.Marshal(sandboxJob{
+		Name:         req.Name,
+		Text:         text,
+		Layout:       req.Layout,
+		LayoutText:   req.LayoutText,
+		Partials:     req.Partials,
+		Delimiters:   req.Delimiters,
+		MissingKey:   req.MissingKey,
+		MissingValue: req.MissingValue,
+		Parameters:   req.Parameters,
+		Engine:       req.Engine,
+		Debug:        req.Debug,
+		Locale:       req.Locale,
+		Messages:     req.Messages,
+
+		Funcs:          templateFuncNames(),
+		Plugins:        funcPlugins,
+		Timeout:        renderTimeout,
+		MaxOutputBytes: maxOutputBytes,
+		MemoryMB:       sandboxMemoryMB,
+		CPUSeconds:     sandboxCPUSeconds,
+	})
+	if err != nil {
+		return "", &render.Error{Message: "failed to encode template parameters", Status: http.StatusBadRequest, Err: err}
+	}
+
+	runCtx := ctx
+	if renderTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, renderTimeout+sandboxGrace)
+		defer cancel()
+	}
+	cmd, err := sandboxCommand(runCtx)
+	if err != nil {
+		return "", &render.Error{Message: "failed to start render sandbox", Status: http.StatusInternalServerError, Err: err}
+	}
+	cmd.Env = append(cmd.Env, "GOMAXPROCS=1")
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout, limit: sandboxResultLimit()}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: 4096}
+
+	runErr := cmd.Run()
+	if runCtx.Err() != nil {
+		if ctx.Err() != nil {
+			return "", &render.Error{Message: "render cancelled", Status: http.StatusRequestTimeout, Err: ctx.Err(), Stage: stageExecute}
+		}
+		return "", &render.Error{
+			Message: fmt.Sprintf("template execution exceeded %s", renderTimeout),
+			Status:  http.StatusGatewayTimeout,
+			Err:     render.ErrTimeout,
+			Stage:   stageTimeout,
+		}
+	}
+
+	var result sandboxResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		// The process died without answering, typically from a resource limit
+		cause := runErr
+		if cause == nil {
+			cause = err
+		}
+		return "", &render.Error{
+			Message: "template exceeded the sandbox resource limits",
+			Status:  http.StatusUnprocessableEntity,
+			Err:     fmt.Errorf("%v: %s", cause, bytes.TrimSpace(stderr.Bytes())),
+			Stage:   stageSandbox,
+		}
+	}
+	if result.Error != "" {
+		re := &render.Error{Message: result.Error, Status: result.Status, Stage: result.Stage}
+		if result.Cause != "" {
+			re.Err = errors.New(result.Cause)
+		}
+		if result.Status == http.StatusGatewayTimeout {
+			re.Err = render.ErrTimeout
+		}
+		return "", re
+	}
+	return result.Output, nil
+}
+
+// sandboxResultLimit bounds the answer read from a sandbox. JSON escaping
+// can expand the output up to six times.
+func sandboxResultLimit() int64 {
+	if maxOutputBytes <= 0 {
+		return 1 << 40
+	}
+	return 6*maxOutputBytes + 64<<10
+}
+
+// limitedBuffer keeps at most limit bytes, discarding the rest
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int64
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := lb.limit - int64(lb.buf.Len()); remaining > 0 {
+		if int64(len(p)) > remaining {
+			lb.buf.Write(p[:remaining])
+		} else {
+			lb.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// runRenderSandbox is the entry point of a sandbox process: it limits its
+// own resources, renders the job read from stdin and answers on stdout
+func runRenderSandbox(stdin io.Reader, stdout io.Writer) int {
+	var job sandboxJob
+	if err := json.NewDecoder(stdin).Decode(&job); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid sandbox job: %v\n", err)
+		return 2
+	}
+	if err := limitSandboxResources(job.MemoryMB, job.CPUSeconds); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to limit sandbox resources: %v\n", err)
+		return 2
+	}
+
+	if err := loadFuncPlugins(job.Plugins); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	templateFuncMap = render.Funcs(true)
+	for _, provider := range render.FuncProviders() {
+		for name, fn := range provider.Funcs() {
+			if _, ok := templateFuncMap[name]; !ok {
+				templateFuncMap[name] = fn
+			}
+		}
+	}
+	exposed := make(map[string]bool, len(job.Funcs))
+	for _, name := range job.Funcs {
+		exposed[name] = true
+	}
+	for name := range templateFuncMap {
+		if !exposed[name] {
+			delete(templateFuncMap, name)
+		}
+	}
+	templateCache = nil
+	renderTimeout = job.Timeout
+	maxOutputBytes = job.MaxOutputBytes
+
+	var result sandboxResult
+	output, err := compileAndExecute(context.Background(), renderRequest{
+		Name:         job.Name,
+		Text:         job.Text,
+		Layout:       job.Layout,
+		LayoutText:   job.LayoutText,
+		Partials:     job.Partials,
+		Delimiters:   job.Delimiters,
+		MissingKey:   job.MissingKey,
+		MissingValue: job.MissingValue,
+		Parameters:   job.Parameters,
+		Engine:       job.Engine,
+		Debug:        job.Debug,
+		Locale:       job.Locale,
+		Messages:     job.Messages,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		result.Status = http.StatusInternalServerError
+		var re *render.Error
+		if errors.As(err, &re) {
+			result.Error = re.Message
+			result.Status = re.Status
+			result.Stage = re.Stage
+			if re.Err != nil {
+				result.Cause = re.Err.Error()
+			}
+		}
+	} else {
+		result.Output = output
+	}
+	if err := json.NewEncoder(stdout).Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write sandbox result: %v\n", err)
+		return 2
+	}
+	return 0
+}
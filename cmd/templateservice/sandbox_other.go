@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "runtime/debug"
+
+// limitSandboxResources sets a soft memory limit; hard limits need a Unix kernel
+func limitSandboxResources(memoryMB, cpuSeconds int) error {
+	if memoryMB > 0 {
+		debug.SetMemoryLimit(int64(memoryMB) << 20)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+// TestSandboxHelperProcess is the sandbox process started by withSandbox
+func TestSandboxHelperProcess(t *testing.T) {
+	if os.Getenv("TEMPLATE_SANDBOX_HELPER") != "1" {
+		return
+	}
+	os.Exit(runRenderSandbox(os.Stdin, os.Stdout))
+}
+
+// withSandbox renders in sandbox processes that run the test binary
+func withSandbox(t *testing.T, mode string, memoryMB int) {
+	t.Helper()
+	previousMode, previousMemory, previousCommand := sandboxMode, sandboxMemoryMB, sandboxCommand
+	sandboxMode, sandboxMemoryMB = mode, memoryMB
+	sandboxCommand = func(ctx context.Context) (*exec.Cmd, error) {
+		cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestSandboxHelperProcess$")
+		cmd.Env = []string{"TEMPLATE_SANDBOX_HELPER=1"}
+		return cmd, nil
+	}
+	t.Cleanup(func() { sandboxMode, sandboxMemoryMB, sandboxCommand = previousMode, previousMemory, previousCommand })
+}
+
+func TestRenderInSandbox(t *testing.T) {
+	withSandbox(t, sandboxAll, 256)
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       `{{template "greeting" .}} {{upper .name}}`,
+		Partials:   map[string]string{"greeting": "Hello"},
+		Parameters: map[string]interface{}{"name": "ada"},
+	})
+	if err != nil || result.Output != "Hello ADA" {
+		t.Fatalf("renderTemplate() = %v, %v", result, err)
+	}
+
+	_, err = renderTemplate(context.Background(), renderRequest{Text: "{{.a.b}}", MissingKey: "error"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusBadRequest {
+		t.Errorf("Expected the sandbox to relay a 400 execution error, got %v", err)
+	}
+}
+
+func TestRenderInSandboxLimits(t *testing.T) {
+	withSandbox(t, sandboxAll, 256)
+
+	previousTimeout := renderTimeout
+	renderTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { renderTimeout = previousTimeout })
+
+	_, err := renderTemplate(context.Background(), renderRequest{Text: "{{range until 100000}}{{range until 100000}}{{end}}{{end}}"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 for a slow template, got %v", err)
+	}
+
+	renderTimeout = 10 * time.Second
+	_, err = renderTemplate(context.Background(), renderRequest{Text: `{{$s := "xxxxxxxx"}}{{range until 40}}{{$s = print $s $s}}{{end}}{{len $s}}`})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a template exhausting memory, got %v", err)
+	}
+}
+
+func TestSandboxedModes(t *testing.T) {
+	previous := sandboxMode
+	t.Cleanup(func() { sandboxMode = previous })
+
+	tests := []struct {
+		mode     string
+		trusted  bool
+		expected bool
+	}{
+		{sandboxOff, false, false},
+		{sandboxUntrusted, false, true},
+		{sandboxUntrusted, true, false},
+		{sandboxAll, true, true},
+	}
+	for _, tt := range tests {
+		sandboxMode = tt.mode
+		if got := sandboxed(renderRequest{Trusted: tt.trusted}); got != tt.expected {
+			t.Errorf("sandboxed() in mode %q (trusted %v) = %v, want %v", tt.mode, tt.trusted, got, tt.expected)
+		}
+	}
+}
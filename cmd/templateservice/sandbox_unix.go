@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime/debug"
+	"syscall"
+)
+
+// limitSandboxResources caps the data segment and CPU time of the sandbox
+// process, so the kernel stops a runaway template. Zero leaves a limit unset.
+func limitSandboxResources(memoryMB, cpuSeconds int) error {
+	if memoryMB > 0 {
+		limit := uint64(memoryMB) << 20
+		if err := syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return err
+		}
+		// Collect garbage before the hard limit is reached
+		debug.SetMemoryLimit(int64(limit) * 3 / 4)
+	}
+	if cpuSeconds > 0 {
+		limit := uint64(cpuSeconds)
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
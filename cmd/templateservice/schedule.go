@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	// Embedded zone database so window timezones resolve in minimal containers
+	_ "time/tzdata"
+)
+
+// jobSchedule controls when a queued job may run. Higher priorities run
+// first; NotBefore/NotAfter bound the absolute execution window and Window
+// restricts execution to a recurring time of day (e.g. 02:00–05:00).
+type jobSchedule struct {
+	Priority  int          `json:"priority,omitempty"`
+	NotBefore *time.Time   `json:"notBefore,omitempty"`
+	NotAfter  *time.Time   `json:"notAfter,omitempty"`
+	Window    *dailyWindow `json:"window,omitempty"`
+}
+
+// dailyWindow is a recurring time-of-day range. An End before Start wraps
+// past midnight (e.g. 22:00–04:00).
+type dailyWindow struct {
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM
+	Timezone string `json:"timezone,omitempty"` // IANA zone, default UTC
+}
+
+// validate checks the schedule for inconsistent bounds and malformed windows
+func (s jobSchedule) validate() error {
+	if s.NotBefore != nil && s.NotAfter != nil && !s.NotAfter.After(*s.NotBefore) {
+		return fmt.Errorf("notAfter must be after notBefore")
+	}
+	if s.Window != nil {
+		if _, _, _, err := s.Window.parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eligible reports whether a job with this schedule may start at now
+func (s jobSchedule) eligible(now time.Time) bool {
+	if s.NotBefore != nil && now.Before(*s.NotBefore) {
+		return false
+	}
+	if s.Window != nil && !s.Window.contains(now) {
+		return false
+	}
+	return true
+}
+
+// expired reports whether the latest execution time has passed
+func (s jobSchedule) expired(now time.Time) bool {
+	return s.NotAfter != nil && now.After(*s.NotAfter)
+}
+
+// parse returns the window bounds in minutes of the day and its location
+func (w *dailyWindow) parse() (start, end int, loc *time.Location, err error) {
+	loc = time.UTC
+	if w.Timezone != "" {
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid window timezone: %w", err)
+		}
+	}
+	if start, err = minuteOfDay(w.Start); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid window start: %w", err)
+	}
+	if end, err = minuteOfDay(w.End); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid window end: %w", err)
+	}
+	if start == end {
+		return 0, 0, nil, fmt.Errorf("window start and end must differ")
+	}
+	return start, end, loc, nil
+}
+
+// contains reports whether t falls inside the window
+func (w *dailyWindow) contains(t time.Time) bool {
+	start, end, loc, err := w.parse()
+	if err != nil {
+		return false
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// minuteOfDay parses an HH:MM clock time
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDailyWindow_Contains(t *testing.T) {
+	night := &dailyWindow{Start: "22:00", End: "04:00"}
+	batch := &dailyWindow{Start: "02:00", End: "05:00", Timezone: "Europe/Berlin"}
+
+	tests := []struct {
+		window *dailyWindow
+		at     time.Time
+		want   bool
+	}{
+		{night, time.Date(2025, 1, 1, 23, 30, 0, 0, time.UTC), true},
+		{night, time.Date(2025, 1, 1, 3, 59, 0, 0, time.UTC), true},
+		{night, time.Date(2025, 1, 1, 4, 0, 0, 0, time.UTC), false},
+		{night, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), false},
+		// 01:30 UTC is 02:30 in Berlin (CET)
+		{batch, time.Date(2025, 1, 1, 1, 30, 0, 0, time.UTC), true},
+		{batch, time.Date(2025, 1, 1, 4, 30, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.window.contains(tt.at); got != tt.want {
+			t.Errorf("%s-%s contains(%s) = %v, want %v", tt.window.Start, tt.window.End, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestJobManager_PriorityAndSchedule(t *testing.T) {
+	m, err := newJobManager("", 1)
+	if err != nil {
+		t.Fatalf("newJobManager() returned error: %v", err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Minute)
+
+	low := m.submit(renderCaller{}, []TemplateRequest{{Text: "low"}}, jobSchedule{Priority: 1}, false)
+	high := m.submit(renderCaller{}, []TemplateRequest{{Text: "high"}}, jobSchedule{Priority: 10}, false)
+	delayed := m.submit(renderCaller{}, []TemplateRequest{{Text: "delayed"}}, jobSchedule{Priority: 100, NotBefore: &future}, false)
+	expired := m.submit(renderCaller{}, []TemplateRequest{{Text: "expired"}}, jobSchedule{NotAfter: &past}, false)
+
+	m.mu.Lock()
+	first := m.jobs[m.queue[m.pickEligible(time.Now())]]
+	m.mu.Unlock()
+
+	if first.ID != high.ID {
+		t.Errorf("Expected highest-priority eligible job %s first, got %s", high.ID, first.ID)
+	}
+
+	if job, _ := m.get(expired.ID); job.Status != jobDead {
+		t.Errorf("Expired job should be dead-lettered, got %s", job.Status)
+	}
+	if job, _ := m.get(delayed.ID); job.Status != jobQueued {
+		t.Errorf("Delayed job should stay queued, got %s", job.Status)
+	}
+	if job, _ := m.get(low.ID); job.Status != jobQueued {
+		t.Errorf("Low-priority job should stay queued, got %s", job.Status)
+	}
+}
+
+func TestJobSchedule_Validate(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+
+	if err := (jobSchedule{NotBefore: &now, NotAfter: &earlier}).validate(); err == nil {
+		t.Error("validate() should reject notAfter before notBefore")
+	}
+	if err := (jobSchedule{Window: &dailyWindow{Start: "25:00", End: "05:00"}}).validate(); err == nil {
+		t.Error("validate() should reject an invalid window start")
+	}
+}
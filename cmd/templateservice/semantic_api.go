@@ -2,23 +2,31 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
-	"text/template"
+	"strings"
 
 	"eve.evalgo.org/semantic"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+
+	"templateservice/pkg/render"
 )
 
 func handleSemanticAction(c echo.Context) error {
 	// Parse semantic action
+	_, bind := startSpan(c.Request().Context(), "request.bind", spanKindInternal)
 	buf := new(bytes.Buffer)
 	if _, err := buf.ReadFrom(c.Request().Body); err != nil {
+		endSpan(bind, err)
 		return semantic.ReturnActionError(c, nil, "Failed to read request body", err)
 	}
 	bodyBytes := buf.Bytes()
 
 	action, err := semantic.ParseSemanticAction(bodyBytes)
+	bind.SetAttributes(attribute.Int("request.size", len(bodyBytes)))
+	endSpan(bind, err)
 	if err != nil {
 		return semantic.ReturnActionError(c, nil, "Failed to parse semantic action", err)
 	}
@@ -34,23 +42,151 @@ func handleSemanticReplaceImpl(c echo.Context, action *semantic.SemanticAction)
 		return semantic.ReturnActionError(c, action, "object is required", nil)
 	}
 
-	var templateContent string
+	if action.Object.Text == "" && action.Object.ContentUrl == "" && action.Object.Identifier == "" {
+		return semantic.ReturnActionError(c, action, "object.text, object.contentUrl or object.identifier is required", nil)
+	}
 
-	// Try to get inline text
-	if action.Object.Text != "" {
-		templateContent = action.Object.Text
-	} else if action.Object.ContentUrl != "" {
-		// Load from file
-		data, err := os.ReadFile(action.Object.ContentUrl)
-		if err != nil {
-			return semantic.ReturnActionError(c, action, "Failed to read template file", err)
-		}
-		templateContent = string(data)
-	} else {
-		return semantic.ReturnActionError(c, action, "object.text or object.contentUrl is required", nil)
+	var assertions *render.Assertions
+	if err := decodeActionProperty(action, "assertions", &assertions); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid assertions", err)
+	}
+	var delimiters []string
+	if err := decodeActionProperty(action, "delimiters", &delimiters); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid delimiters", err)
+	}
+	var missingKey string
+	if err := decodeActionProperty(action, "missingKey", &missingKey); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid missingKey", err)
+	}
+	var missingKeyValue *string
+	if err := decodeActionProperty(action, "missingKeyValue", &missingKeyValue); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid missingKeyValue", err)
+	}
+
+	var parametersUpload string
+	if err := decodeActionProperty(action, "parametersUpload", &parametersUpload); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid parametersUpload", err)
+	}
+
+	var templateVersion int
+	if err := decodeActionProperty(action, "templateVersion", &templateVersion); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid templateVersion", err)
+	}
+	var effectiveDate string
+	if err := decodeActionProperty(action, "effectiveDate", &effectiveDate); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid effectiveDate", err)
+	}
+
+	var partials map[string]string
+	if err := decodeActionProperty(action, "partials", &partials); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid partials", err)
+	}
+	var layout string
+	if err := decodeActionProperty(action, "layout", &layout); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid layout", err)
+	}
+	var engine string
+	if err := decodeActionProperty(action, "engine", &engine); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid engine", err)
+	}
+	var convertTo string
+	if err := decodeActionProperty(action, "convertTo", &convertTo); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid convertTo", err)
+	}
+	var debug bool
+	if err := decodeActionProperty(action, "debug", &debug); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid debug", err)
+	}
+	var locale string
+	if err := decodeActionProperty(action, "locale", &locale); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid locale", err)
+	}
+	var suppress *suppressOptions
+	if err := decodeActionProperty(action, "suppress", &suppress); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid suppress", err)
+	}
+
+	var stream bool
+	if err := decodeActionProperty(action, "stream", &stream); err != nil {
+		return semantic.ReturnActionError(c, action, "Invalid stream", err)
+	}
+
+	req := renderRequest{
+		Name:           "semantic-template",
+		Text:           action.Object.Text,
+		Identifier:     action.Object.ContentUrl,
+		TemplateName:   action.Object.Identifier,
+		Parameters:     semanticParameters(action),
+		EncodingFormat: action.Object.EncodingFormat,
+		Assertions:     assertions,
+		Suppress:       suppress,
+		Delimiters:     delimiters,
+		MissingKey:     missingKey,
+		MissingValue:   missingKeyValue,
+		ParametersFrom: parametersUpload,
+
+		TemplateVersion: templateVersion,
+		EffectiveDate:   effectiveDate,
+		Partials:        partials,
+		Layout:          layout,
+		Engine:          engine,
+		ConvertTo:       convertTo,
+		Debug:           debug,
+		Locale:          locale,
+	}
+	if stream || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), mimeNDJSON) {
+		return streamSemanticAction(c, action, req)
+	}
+
+	rendered, err := renderTemplate(c.Request().Context(), req)
+	if err != nil {
+		return returnRenderError(c, action, err)
+	}
+	completeSemanticAction(action, rendered)
+	return respondJSON(c, http.StatusOK, action)
+}
+
+// completeSemanticAction sets the result of a successful render on action
+func completeSemanticAction(action *semantic.SemanticAction, rendered *renderResult) {
+	result, contentEncoding := jsonOutput(rendered.EncodingFormat, rendered.Output)
+
+	value := map[string]interface{}{
+		"contentSize": len(rendered.Output),
+		"sha256":      rendered.SHA256,
+	}
+	if contentEncoding != "" {
+		value["contentEncoding"] = contentEncoding
+	}
+	if rendered.ContentURL != "" {
+		value["contentUrl"] = rendered.ContentURL
+	}
+	if rendered.Suppressed {
+		value["suppressed"] = true
 	}
+	if rendered.TemplateCommit != "" {
+		value["templateCommit"] = rendered.TemplateCommit
+	}
+	if rendered.Signature != "" {
+		value["signature"] = rendered.Signature
+		value["signatureAlgorithm"] = rendered.SignatureAlgorithm
+	}
+	if rendered.Options != nil {
+		value["effectiveOptions"] = rendered.Options
+	}
+
+	// Use semantic Result structure
+	action.Result = &semantic.SemanticResult{
+		Type:   "Dataset",
+		Format: rendered.EncodingFormat,
+		Output: result,
+		Value:  value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+}
 
-	// Get parameters from action.Properties (where template params should be)
+// semanticParameters extracts template parameters from the action properties
+func semanticParameters(action *semantic.SemanticAction) map[string]interface{} {
 	parameters := make(map[string]interface{})
 
 	// Check for parameters in Properties map
@@ -66,37 +202,35 @@ func handleSemanticReplaceImpl(c echo.Context, action *semantic.SemanticAction)
 		}
 	}
 
-	// Parse and execute template
-	tmpl, err := template.New("semantic-template").Parse(templateContent)
-	if err != nil {
-		return semantic.ReturnActionError(c, action, "Failed to parse template", err)
-	}
+	return parameters
+}
 
-	var output bytes.Buffer
-	if err := tmpl.Execute(&output, parameters); err != nil {
-		return semantic.ReturnActionError(c, action, "Failed to execute template", err)
+// decodeActionProperty decodes a render option from the action properties into out.
+// Missing properties leave out untouched.
+func decodeActionProperty(action *semantic.SemanticAction, key string, out interface{}) error {
+	value, ok := action.Properties[key]
+	if !ok || value == nil {
+		return nil
 	}
-
-	result := output.String()
-
-	// Determine encoding format
-	encodingFormat := "text/plain"
-	if action.Object.EncodingFormat != "" {
-		encodingFormat = action.Object.EncodingFormat
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(data, out)
+}
 
-	// Use semantic Result structure
-	action.Result = &semantic.SemanticResult{
-		Type:   "Dataset",
-		Format: encodingFormat,
-		Output: result,
-		Value: map[string]interface{}{
-			"contentSize": len(result),
-		},
+// returnRenderError reports a failed render on the action.
+// Errors outside the 4xx range and exhausted quotas are surfaced as HTTP
+// errors with their status.
+func returnRenderError(c echo.Context, action *semantic.SemanticAction, err error) error {
+	var re *render.Error
+	if !errors.As(err, &re) {
+		return semantic.ReturnActionError(c, action, "Failed to render template", err)
 	}
-
-	semantic.SetSuccessOnAction(action)
-	return c.JSON(http.StatusOK, action)
+	if re.Status >= http.StatusInternalServerError || setQuotaRetryAfter(c, err) {
+		return echo.NewHTTPError(re.Status, re.Error())
+	}
+	return semantic.ReturnActionError(c, action, re.Message, re.Err)
 }
 
 // handleSemanticReplace wraps the implementation to match ActionHandler signature
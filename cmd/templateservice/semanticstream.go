@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// Stages of a render reported to streaming semantic clients
+const (
+	actionStarted   = "started"
+	actionFetched   = "fetched"
+	actionRendered  = "rendered"
+	actionDelivered = "delivered"
+)
+
+// renderStageFunc observes the stages of a render with their details
+type renderStageFunc func(stage string, detail map[string]interface{})
+
+type renderStageKey struct{}
+
+// withRenderStages returns ctx with an observer of the render's stages
+func withRenderStages(ctx context.Context, observe renderStageFunc) context.Context {
+	return context.WithValue(ctx, renderStageKey{}, observe)
+}
+
+// reportRenderStage passes a stage to the observer in ctx, if any
+func reportRenderStage(ctx context.Context, stage string, detail map[string]interface{}) {
+	if observe, ok := ctx.Value(renderStageKey{}).(renderStageFunc); ok {
+		observe(stage, detail)
+	}
+}
+
+// semanticStageEvent is an NDJSON line announcing that an action reached a
+// stage: the action in ActiveActionStatus, named after the stage
+type semanticStageEvent struct {
+	Context      string                 `json:"@context"`
+	Type         string                 `json:"@type"`
+	ActionStatus string                 `json:"actionStatus"`
+	Name         string                 `json:"name"`
+	StartTime    time.Time              `json:"startTime"`
+	Result       map[string]interface{} `json:"result,omitempty"`
+}
+
+// streamSemanticAction renders req for action and writes its progress as
+// NDJSON: a status action per stage (started, fetched, rendered, delivered),
+// then the completed or failed action itself. Orchestrators of long pipelines
+// can react to each stage instead of waiting for the final response.
+func streamSemanticAction(c echo.Context, action *semantic.SemanticAction, req renderRequest) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, mimeNDJSON)
+	res.WriteHeader(http.StatusOK)
+
+	actionContext := action.Context
+	if actionContext == "" {
+		actionContext = "https://schema.org"
+	}
+	enc := json.NewEncoder(res)
+	emit := func(stage string, detail map[string]interface{}) {
+		_ = enc.Encode(semanticStageEvent{
+			Context:      actionContext,
+			Type:         action.Type,
+			ActionStatus: "ActiveActionStatus",
+			Name:         stage,
+			StartTime:    time.Now().UTC(),
+			Result:       detail,
+		})
+		res.Flush()
+	}
+
+	emit(actionStarted, nil)
+	ctx := withRenderStages(c.Request().Context(), emit)
+	rendered, err := renderTemplate(ctx, req)
+	if err != nil {
+		action.ActionStatus = "FailedActionStatus"
+		action.Error = semanticStreamError(err)
+	} else {
+		completeSemanticAction(action, rendered)
+	}
+	if err := enc.Encode(action); err != nil {
+		return nil
+	}
+	res.Flush()
+	return nil
+}
+
+// semanticStreamError describes a failed render in the final line of a
+// stream, whose status has already been sent
+func semanticStreamError(err error) map[string]interface{} {
+	description := map[string]interface{}{"@type": "Thing", "name": "Failed to render template", "description": err.Error()}
+	var re *render.Error
+	if errors.As(err, &re) {
+		description["name"] = re.Message
+		description["statusCode"] = re.Status
+		if len(re.Details) > 0 {
+			description["details"] = re.Details
+		}
+	}
+	return description
+}
+
+// fetchedDetail describes the template a render resolved, for the fetched stage
+func fetchedDetail(req renderRequest) map[string]interface{} {
+	detail := map[string]interface{}{"engine": req.Engine}
+	if req.Engine == "" {
+		detail["engine"] = render.GoEngine
+	}
+	if req.TemplateName != "" {
+		detail["templateName"] = req.TemplateName
+	}
+	if req.StoredVersion > 0 {
+		detail["templateVersion"] = req.StoredVersion
+	}
+	if req.TemplateCommit != "" {
+		detail["templateCommit"] = req.TemplateCommit
+	}
+	return detail
+}
+
+// deliveredDetail describes the finished result, for the delivered stage
+func deliveredDetail(result *renderResult) map[string]interface{} {
+	detail := map[string]interface{}{"contentSize": len(result.Output), "sha256": result.SHA256}
+	if result.ContentURL != "" {
+		detail["contentUrl"] = result.ContentURL
+	}
+	if result.Suppressed {
+		detail["suppressed"] = true
+	}
+	return detail
+}
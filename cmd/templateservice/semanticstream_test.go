@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticActionStream(t *testing.T) {
+	stream := func(t *testing.T, text string) []map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set(echo.HeaderAccept, mimeNDJSON)
+		rec := httptest.NewRecorder()
+		action := &semantic.SemanticAction{
+			Type:       "ReplaceAction",
+			Object:     &semantic.Object{Text: text},
+			Properties: map[string]interface{}{"name": "Ada"},
+		}
+		if err := handleSemanticReplaceImpl(echo.New().NewContext(req, rec), action); err != nil {
+			t.Fatal(err)
+		}
+		if ct := rec.Header().Get(echo.HeaderContentType); ct != mimeNDJSON {
+			t.Errorf("Expected NDJSON content type, got %q", ct)
+		}
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(rec.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	lines := stream(t, "Hello {{.name}}")
+	var stages []string
+	for _, line := range lines[:len(lines)-1] {
+		if line["actionStatus"] != "ActiveActionStatus" || line["@type"] != "ReplaceAction" {
+			t.Errorf("Unexpected status event %v", line)
+		}
+		stages = append(stages, line["name"].(string))
+	}
+	if strings.Join(stages, ",") != "started,fetched,rendered,delivered" {
+		t.Errorf("Stages = %v", stages)
+	}
+	if size := lines[2]["result"].(map[string]interface{})["contentSize"]; size != float64(len("Hello Ada")) {
+		t.Errorf("Rendered contentSize = %v", size)
+	}
+	final := lines[len(lines)-1]
+	if final["actionStatus"] != "CompletedActionStatus" || final["result"].(map[string]interface{})["output"] != "Hello Ada" {
+		t.Errorf("Final line = %v", final)
+	}
+
+	lines = stream(t, "Hello {{.name")
+	if len(lines) != 3 || lines[1]["name"] != actionFetched {
+		t.Fatalf("Expected the stream to end after the fetched event, got %v", lines)
+	}
+	if failed := lines[2]; failed["actionStatus"] != "FailedActionStatus" || failed["error"] == nil {
+		t.Errorf("Final line = %v", failed)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Supported output signature algorithms
+const (
+	signatureHMACSHA256 = "hmac-sha256"
+	signatureEd25519    = "ed25519"
+)
+
+// outputSigner signs rendered output so downstream services can verify its origin
+type outputSigner struct {
+	algorithm  string
+	hmacKey    []byte
+	privateKey ed25519.PrivateKey
+}
+
+// signer is nil when output signing is disabled
+var signer *outputSigner
+
+// configureOutputSigning loads the signing key from the environment.
+// TEMPLATE_SIGNING_KEY holds the HMAC secret or the base64 Ed25519 seed/private key,
+// TEMPLATE_SIGNING_ALGORITHM selects hmac-sha256 (default) or ed25519.
+func configureOutputSigning() error {
+	key := os.Getenv("TEMPLATE_SIGNING_KEY")
+	if key == "" {
+		return nil
+	}
+
+	s, err := newOutputSigner(os.Getenv("TEMPLATE_SIGNING_ALGORITHM"), key)
+	if err != nil {
+		return err
+	}
+	signer = s
+	logger.Infof("Output signing enabled (%s)", s.algorithm)
+	return nil
+}
+
+// newOutputSigner creates a signer for the given algorithm and key material
+func newOutputSigner(algorithm, key string) (*outputSigner, error) {
+	switch strings.ToLower(algorithm) {
+	case "", signatureHMACSHA256:
+		return &outputSigner{algorithm: signatureHMACSHA256, hmacKey: []byte(key)}, nil
+	case signatureEd25519:
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("ed25519 signing key must be base64: %w", err)
+		}
+		switch len(raw) {
+		case ed25519.SeedSize:
+			return &outputSigner{algorithm: signatureEd25519, privateKey: ed25519.NewKeyFromSeed(raw)}, nil
+		case ed25519.PrivateKeySize:
+			return &outputSigner{algorithm: signatureEd25519, privateKey: ed25519.PrivateKey(raw)}, nil
+		}
+		return nil, fmt.Errorf("ed25519 signing key must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// sign returns the base64 signature of data
+func (s *outputSigner) sign(data []byte) string {
+	if s.algorithm == signatureEd25519 {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, data))
+	}
+	mac := hmac.New(sha256.New, s.hmacKey)
+	mac.Write(data)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// outputChecksum returns the hex SHA-256 of the rendered output
+func outputChecksum(output string) string {
+	sum := sha256.Sum256([]byte(output))
+	return hex.EncodeToString(sum[:])
+}
+
+// annotateIntegrity adds the checksum and, when configured, the signature to a result
+func annotateIntegrity(result *renderResult) {
+	result.SHA256 = outputChecksum(result.Output)
+	if signer != nil {
+		result.Signature = signer.sign([]byte(result.Output))
+		result.SignatureAlgorithm = signer.algorithm
+	}
+}
+
+// handleSigningKey returns the public verification key for Ed25519 signatures.
+// HMAC keys are shared secrets and are never exposed.
+func handleSigningKey(c echo.Context) error {
+	if signer == nil || signer.algorithm != signatureEd25519 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no public signing key configured"})
+	}
+
+	publicKey := signer.privateKey.Public().(ed25519.PublicKey)
+	return c.JSON(http.StatusOK, map[string]string{
+		"algorithm": signatureEd25519,
+		"publicKey": base64.StdEncoding.EncodeToString(publicKey),
+	})
+}
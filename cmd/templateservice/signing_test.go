@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestOutputChecksum(t *testing.T) {
+	// SHA-256 of "hello"
+	expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := outputChecksum("hello"); got != expected {
+		t.Errorf("Expected checksum %s, got %s", expected, got)
+	}
+}
+
+func TestOutputSigner_HMAC(t *testing.T) {
+	s, err := newOutputSigner("", "secret")
+	if err != nil {
+		t.Fatalf("newOutputSigner() returned error: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("document"))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if got := s.sign([]byte("document")); got != expected {
+		t.Errorf("Expected HMAC signature %s, got %s", expected, got)
+	}
+}
+
+func TestOutputSigner_Ed25519(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	s, err := newOutputSigner("ed25519", base64.StdEncoding.EncodeToString(seed))
+	if err != nil {
+		t.Fatalf("newOutputSigner() returned error: %v", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(s.sign([]byte("document")))
+	if err != nil {
+		t.Fatalf("Signature is not base64: %v", err)
+	}
+
+	publicKey := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	if !ed25519.Verify(publicKey, []byte("document"), signature) {
+		t.Error("Ed25519 signature does not verify")
+	}
+}
+
+func TestOutputSigner_InvalidKey(t *testing.T) {
+	if _, err := newOutputSigner("ed25519", "not-base64!"); err == nil {
+		t.Error("newOutputSigner() should reject a non-base64 Ed25519 key")
+	}
+	if _, err := newOutputSigner("rsa", "key"); err == nil {
+		t.Error("newOutputSigner() should reject unsupported algorithms")
+	}
+}
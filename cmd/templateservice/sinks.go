@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Outcomes of a render delivered to several sinks
+const (
+	deliveryDelivered  = "delivered"   // Every sink received the output
+	deliveryPartial    = "partial"     // Some sinks received it; see the deliveries
+	deliveryFailed     = "failed"      // No sink received it
+	deliveryRolledBack = "rolled_back" // Deliveries were taken back after a failure
+)
+
+// States of a single delivery
+const (
+	sinkDelivered    = "delivered"
+	sinkFailed       = "failed"
+	sinkSkipped      = "skipped"      // Not attempted after an earlier failure (rollback policy)
+	sinkRolledBack   = "rolled_back"  // Delivered, then taken back
+	sinkIrreversible = "irreversible" // Delivered and cannot be taken back (webhooks, mail)
+)
+
+// deliveryCompensation configures what happens when a sink fails: every
+// delivery is retried, then the sinks that did receive the output are kept
+// (onFailure "partial") or taken back where possible ("rollback")
+type deliveryCompensation struct {
+	Retries   int    `json:"retries,omitempty"`   // Further attempts of a failed delivery
+	Backoff   string `json:"backoff,omitempty"`   // Go duration before the first retry, doubled for each further one; 1s by default
+	OnFailure string `json:"onFailure,omitempty"` // partial (default) or rollback
+
+	backoff time.Duration
+}
+
+// validate checks the policy and parses its backoff
+func (c *deliveryCompensation) validate() error {
+	if c.Retries < 0 {
+		return errors.New("compensation.retries must not be negative")
+	}
+	switch c.OnFailure {
+	case "", deliveryPartial, "rollback":
+	default:
+		return fmt.Errorf("compensation.onFailure must be partial or rollback, got %q", c.OnFailure)
+	}
+	c.backoff = time.Second
+	if c.Backoff != "" {
+		backoff, err := time.ParseDuration(c.Backoff)
+		if err != nil || backoff < 0 {
+			return fmt.Errorf("invalid compensation.backoff %q", c.Backoff)
+		}
+		c.backoff = backoff
+	}
+	return nil
+}
+
+// sinkDelivery is the delivery of a render to one sink
+type sinkDelivery struct {
+	Sink     string `json:"sink"` // s3, webhook or email
+	Target   string `json:"target"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	send func(ctx context.Context) error
+	undo func(ctx context.Context) error // nil when a delivery cannot be taken back
+}
+
+// deliver sends the output to every sink in order, retrying and
+// compensating failures as policy says, and returns the outcome. Under the
+// rollback policy the first failure stops the remaining deliveries and takes
+// back the earlier ones, last first.
+func deliver(ctx context.Context, deliveries []*sinkDelivery, policy deliveryCompensation) string {
+	rollback := policy.OnFailure == "rollback"
+	failed := false
+	for _, d := range deliveries {
+		if failed && rollback {
+			d.Status = sinkSkipped
+			continue
+		}
+		delay := policy.backoff
+		for {
+			d.Attempts++
+			err := d.send(ctx)
+			if err == nil {
+				d.Status, d.Error = sinkDelivered, ""
+				break
+			}
+			d.Status, d.Error = sinkFailed, err.Error()
+			if d.Attempts > policy.Retries || ctx.Err() != nil {
+				break
+			}
+			select {
+			case <-time.After(delay):
+				delay *= 2
+			case <-ctx.Done():
+			}
+		}
+		failed = failed || d.Status == sinkFailed
+	}
+
+	if failed && rollback {
+		for i := len(deliveries) - 1; i >= 0; i-- {
+			d := deliveries[i]
+			if d.Status != sinkDelivered {
+				continue
+			}
+			if d.undo == nil {
+				d.Status = sinkIrreversible
+				continue
+			}
+			if err := d.undo(ctx); err != nil {
+				d.Error = fmt.Sprintf("rollback failed: %v", err)
+				continue
+			}
+			d.Status = sinkRolledBack
+		}
+	}
+
+	delivered, rolledBack := 0, 0
+	for _, d := range deliveries {
+		switch d.Status {
+		case sinkDelivered, sinkIrreversible:
+			delivered++
+		case sinkRolledBack:
+			rolledBack++
+		}
+	}
+	switch {
+	case delivered == len(deliveries):
+		return deliveryDelivered
+	case delivered > 0:
+		return deliveryPartial
+	case rolledBack > 0:
+		return deliveryRolledBack
+	}
+	return deliveryFailed
+}
+
+// webhookDelivery POSTs output to url. The Idempotency-Key lets receivers
+// discard the duplicates of retried deliveries.
+func webhookDelivery(client *http.Client, url, source string, rendered *renderResult) *sinkDelivery {
+	return &sinkDelivery{Sink: "webhook", Target: url, send: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(rendered.Output))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", rendered.EncodingFormat)
+		req.Header.Set("Idempotency-Key", rendered.SHA256)
+		req.Header.Set("X-Source-Object", source)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("POST %s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	}}
+}
+
+// smtpSettings is the outgoing mail server of TEMPLATE_SMTP_*
+type smtpSettings struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// smtpFromEnv reads TEMPLATE_SMTP_ADDR, TEMPLATE_SMTP_FROM and the optional
+// TEMPLATE_SMTP_USERNAME and TEMPLATE_SMTP_PASSWORD
+func smtpFromEnv() (smtpSettings, bool) {
+	settings := smtpSettings{addr: os.Getenv("TEMPLATE_SMTP_ADDR"), from: os.Getenv("TEMPLATE_SMTP_FROM")}
+	if user := os.Getenv("TEMPLATE_SMTP_USERNAME"); user != "" {
+		host, _, _ := net.SplitHostPort(settings.addr)
+		settings.auth = smtp.PlainAuth("", user, os.Getenv("TEMPLATE_SMTP_PASSWORD"), host)
+	}
+	return settings, settings.addr != "" && settings.from != ""
+}
+
+// mailDelivery mails output to the address to
+func mailDelivery(settings smtpSettings, to, source string, rendered *renderResult) *sinkDelivery {
+	return &sinkDelivery{Sink: "email", Target: to, send: func(context.Context) error {
+		var body bytes.Buffer
+		header := func(name, value string) {
+			fmt.Fprintf(&body, "%s: %s\r\n", name, strings.NewReplacer("\r", "", "\n", "").Replace(value))
+		}
+		header("From", settings.from)
+		header("To", to)
+		header("Subject", mime.QEncoding.Encode("utf-8", "Rendered "+source))
+		header("Date", time.Now().Format(time.RFC1123Z))
+		header("Auto-Submitted", "auto-generated")
+		header("MIME-Version", "1.0")
+		header("Content-Type", mailContentType(rendered.EncodingFormat))
+		header("Content-Transfer-Encoding", "base64")
+		body.WriteString("\r\n")
+		body.WriteString(mailBase64(rendered.Output))
+		return sendMail(settings.addr, settings.auth, settings.from, []string{to}, body.Bytes())
+	}}
+}
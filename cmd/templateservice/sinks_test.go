@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDeliverCompensation(t *testing.T) {
+	var undone []string
+	sink := func(name string, failures int, reversible bool) *sinkDelivery {
+		calls := 0
+		d := &sinkDelivery{Sink: name, send: func(context.Context) error {
+			calls++
+			if calls <= failures {
+				return errors.New(name + " unavailable")
+			}
+			return nil
+		}}
+		if reversible {
+			d.undo = func(context.Context) error { undone = append(undone, name); return nil }
+		}
+		return d
+	}
+	statuses := func(deliveries []*sinkDelivery) string {
+		var s []string
+		for _, d := range deliveries {
+			s = append(s, d.Sink+"="+d.Status)
+		}
+		return strings.Join(s, ",")
+	}
+
+	deliveries := []*sinkDelivery{sink("s3", 0, true), sink("webhook", 2, false), sink("email", 0, false)}
+	if outcome := deliver(context.Background(), deliveries, deliveryCompensation{Retries: 2}); outcome != deliveryDelivered {
+		t.Errorf("Retries within the limit: outcome %s (%s)", outcome, statuses(deliveries))
+	}
+	if deliveries[1].Attempts != 3 || deliveries[1].Error != "" {
+		t.Errorf("Expected three webhook attempts and no error, got %d, %q", deliveries[1].Attempts, deliveries[1].Error)
+	}
+
+	deliveries = []*sinkDelivery{sink("s3", 0, true), sink("webhook", 5, false), sink("email", 0, false)}
+	if outcome := deliver(context.Background(), deliveries, deliveryCompensation{Retries: 1}); outcome != deliveryPartial {
+		t.Errorf("Partial policy: outcome %s", outcome)
+	}
+	if got := statuses(deliveries); got != "s3=delivered,webhook=failed,email=delivered" {
+		t.Errorf("Partial policy: %s", got)
+	}
+
+	deliveries = []*sinkDelivery{sink("email", 0, false), sink("s3", 0, true), sink("webhook", 5, false), sink("archive", 0, true)}
+	if outcome := deliver(context.Background(), deliveries, deliveryCompensation{OnFailure: "rollback"}); outcome != deliveryPartial {
+		t.Errorf("Rollback with an irreversible delivery: outcome %s", outcome)
+	}
+	if got := statuses(deliveries); got != "email=irreversible,s3=rolled_back,webhook=failed,archive=skipped" {
+		t.Errorf("Rollback policy: %s", got)
+	}
+	if strings.Join(undone, ",") != "s3" {
+		t.Errorf("Rolled back %v", undone)
+	}
+
+	deliveries = []*sinkDelivery{sink("s3", 0, true), sink("webhook", 5, false)}
+	if outcome := deliver(context.Background(), deliveries, deliveryCompensation{OnFailure: "rollback"}); outcome != deliveryRolledBack {
+		t.Errorf("Complete rollback: outcome %s", outcome)
+	}
+	if outcome := deliver(context.Background(), []*sinkDelivery{sink("s3", 5, true)}, deliveryCompensation{}); outcome != deliveryFailed {
+		t.Errorf("Nothing delivered: outcome %s", outcome)
+	}
+}
+
+func TestS3PipelineSinks(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if _, err := saveTemplate("invoice", &templateInput{Text: "Invoice {{.number}}"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var webhookStatus atomic.Int32
+	webhookStatus.Store(http.StatusServiceUnavailable)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Idempotency-Key") == "" || r.Header.Get("X-Source-Object") != "s3://drop/in/1.json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(int(webhookStatus.Load()))
+	}))
+	defer webhook.Close()
+	var mailed []string
+	previous := sendMail
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mailed = append(mailed, to...)
+		return nil
+	}
+	t.Cleanup(func() { sendMail = previous })
+
+	pipeline := s3Pipeline{Bucket: "drop", Prefix: "in/", Template: "invoice", OutputPrefix: "out/", Webhook: webhook.URL, MailTo: "billing@example.com"}
+	store := withS3Events(t, []s3Pipeline{pipeline})
+	store.objects["/drop/in/1.json"] = `{"number": 7}`
+	event := `{"Records": [{"eventName": "s3:ObjectCreated:Put", "s3": {"bucket": {"name": "drop"}, "object": {"key": "in/1.json"}}}]}`
+
+	var response struct {
+		Results []s3EventResult `json:"results"`
+	}
+	rec := postS3Event(t, "s3-token", event)
+	_ = json.Unmarshal(rec.Body.Bytes(), &response)
+	if rec.Code != http.StatusMultiStatus || response.Results[0].Outcome != deliveryPartial {
+		t.Fatalf("Expected 207 with a partial delivery, got %d: %s", rec.Code, rec.Body)
+	}
+	if store.objects["/drop/out/1.json"] != "Invoice 7" || len(mailed) != 1 {
+		t.Errorf("Expected the object and the mail to be delivered, got %v, %v", store.objects, mailed)
+	}
+
+	pipeline.Compensation = &deliveryCompensation{OnFailure: "rollback", Backoff: "1ms", Retries: 1}
+	if err := pipeline.Compensation.validate(); err != nil {
+		t.Fatal(err)
+	}
+	s3Pipelines = []s3Pipeline{pipeline}
+	delete(store.objects, "/drop/out/1.json")
+	rec = postS3Event(t, "s3-token", event)
+	_ = json.Unmarshal(rec.Body.Bytes(), &response)
+	if rec.Code != http.StatusBadGateway || response.Results[0].Outcome != deliveryRolledBack {
+		t.Fatalf("Expected 502 with a rolled back delivery, got %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := store.objects["/drop/out/1.json"]; ok {
+		t.Error("Expected the uploaded object to be deleted")
+	}
+	if d := response.Results[0].Deliveries; d[1].Attempts != 2 || d[2].Status != sinkSkipped || len(mailed) != 1 {
+		t.Errorf("Unexpected deliveries %+v, mailed %v", d, mailed)
+	}
+
+	webhookStatus.Store(http.StatusAccepted)
+	rec = postS3Event(t, "s3-token", event)
+	response.Results = nil
+	_ = json.Unmarshal(rec.Body.Bytes(), &response)
+	if rec.Code != http.StatusOK || response.Results[0].Outcome != deliveryDelivered || response.Results[0].Error != "" {
+		t.Errorf("Expected every sink to be delivered, got %d: %s", rec.Code, rec.Body)
+	}
+}
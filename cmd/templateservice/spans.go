@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Span kinds of the service's spans
+const (
+	spanKindInternal = trace.SpanKindInternal
+	spanKindServer   = trace.SpanKindServer
+)
+
+// spanProvider exports the spans of spanTracer; nil when tracing is disabled
+var spanProvider *sdktrace.TracerProvider
+
+// spanTracer creates the service's spans. Until tracing is configured it
+// creates none, only passing on the trace context of incoming requests.
+var spanTracer trace.Tracer = noop.NewTracerProvider().Tracer("templateservice")
+
+// spanPropagator reads and writes W3C traceparent and baggage headers
+var spanPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// configureSpans enables tracing when an OTLP endpoint is configured. The
+// exporter, sampler and resource follow the standard OTEL_* environment
+// variables.
+func configureSpans() error {
+	if err := shutdownSpans(context.Background()); err != nil {
+		logger.WithError(err).Error("Failed to flush spans")
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" || envBool("OTEL_SDK_DISABLED", false) {
+		return nil
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return fmt.Errorf("OTLP trace exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "templateservice")),
+		resource.WithFromEnv(), // OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return fmt.Errorf("trace resource: %w", err)
+	}
+	spanProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	spanTracer = spanProvider.Tracer("templateservice")
+	logger.Infof("Exporting traces to %s", endpoint)
+	return nil
+}
+
+// shutdownSpans exports the spans still buffered and disables tracing
+func shutdownSpans(ctx context.Context) error {
+	if spanProvider == nil {
+		return nil
+	}
+	provider := spanProvider
+	spanProvider, spanTracer = nil, noop.NewTracerProvider().Tracer("templateservice")
+	return provider.Shutdown(ctx)
+}
+
+// startSpan starts a span as a child of the span in ctx. Without a parent a
+// new trace is started, sampled as OTEL_TRACES_SAMPLER configures.
+func startSpan(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	return spanTracer.Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// endSpan finishes a span, marking it failed when err is not nil
+func endSpan(s trace.Span, err error) {
+	if err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, err.Error())
+	}
+	s.End()
+}
+
+// injectTraceContext propagates the span in ctx to an outgoing request
+func injectTraceContext(ctx context.Context, header http.Header) {
+	spanPropagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// traceMiddleware starts a server span per request, continuing the trace of
+// an incoming traceparent header
+func traceMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if spanProvider == nil {
+			return next(c)
+		}
+		req := c.Request()
+		ctx := spanPropagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		route := c.Path()
+		ctx, s := startSpan(ctx, req.Method+" "+route, spanKindServer)
+		s.SetAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", req.URL.Path),
+		)
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+		status := c.Response().Status
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+		} else if err != nil && !c.Response().Committed {
+			status = http.StatusInternalServerError
+		}
+		s.SetAttributes(attribute.Int("http.response.status_code", status))
+		spanErr := err
+		if spanErr == nil && status >= http.StatusInternalServerError {
+			spanErr = errors.New(http.StatusText(status))
+		}
+		endSpan(s, spanErr)
+		return err
+	}
+}
+
+// bindRequest binds the request body inside a span
+func bindRequest(c echo.Context, v interface{}) error {
+	_, s := startSpan(c.Request().Context(), "request.bind", spanKindInternal)
+	err := c.Bind(v)
+	s.SetAttributes(attribute.Int64("request.size", c.Request().ContentLength))
+	endSpan(s, err)
+	return err
+}
+
+// respondJSON marshals a response body inside a span, so encoding large
+// outputs shows up in traces
+func respondJSON(c echo.Context, status int, body interface{}) error {
+	_, s := startSpan(c.Request().Context(), "response.marshal", spanKindInternal)
+	data, err := json.Marshal(body)
+	s.SetAttributes(attribute.Int("response.size", len(data)))
+	endSpan(s, err)
+	if err != nil {
+		return err
+	}
+	return c.JSONBlob(status, data)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withSpanRecorder enables tracing with the spans recorded in memory
+// instead of exported
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	previousProvider, previousTracer := spanProvider, spanTracer
+	recorder := tracetest.NewSpanRecorder()
+	spanProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	spanTracer = spanProvider.Tracer("templateservice")
+	t.Cleanup(func() { spanProvider, spanTracer = previousProvider, previousTracer })
+	return recorder
+}
+
+func TestRenderSpans(t *testing.T) {
+	var hookTraceparent string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hookTraceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("hooked"))
+	}))
+	defer hook.Close()
+	postRenderHooks = []string{hook.URL}
+	defer func() { postRenderHooks = nil }()
+
+	recorder := withSpanRecorder(t)
+
+	e := echo.New()
+	e.Use(traceMiddleware)
+	e.POST("/v1/api/render", handleRender)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render", strings.NewReader(`{"text": "Hello {{.name}}", "parameters": {"name": "Ada"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Render = %d %s", rec.Code, rec.Body)
+	}
+
+	spans := recorder.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+	server := byName["POST /v1/api/render"]
+	if server == nil {
+		t.Fatalf("Expected a server span, got %d spans", len(spans))
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("Expected the incoming trace ID, got %s", got)
+	}
+	if parent := server.Parent().SpanID().String(); parent != "00f067aa0ba902b7" {
+		t.Errorf("Expected the server span to continue the caller's span, got parent %s", parent)
+	}
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected a server span, got %s", server.SpanKind())
+	}
+	for _, name := range []string{"request.bind", "template.load", "template.parse", "template.execute", "response.marshal"} {
+		s := byName[name]
+		if s == nil {
+			t.Errorf("Missing span %q", name)
+			continue
+		}
+		if s.SpanContext().TraceID() != server.SpanContext().TraceID() {
+			t.Errorf("Span %q is in another trace", name)
+		}
+	}
+	if s := byName["template.load"]; s != nil {
+		var source string
+		for _, attr := range s.Attributes() {
+			if attr.Key == "template.source" {
+				source = attr.Value.AsString()
+			}
+		}
+		if source != "inline" {
+			t.Errorf("Expected template.source inline, got %q", source)
+		}
+	}
+	if !strings.Contains(hookTraceparent, traceID) {
+		t.Errorf("Expected the hook call to carry the trace, got %q", hookTraceparent)
+	}
+}
+
+func TestUnsampledTrace(t *testing.T) {
+	recorder := withSpanRecorder(t)
+
+	e := echo.New()
+	e.Use(traceMiddleware)
+	e.POST("/v1/api/render", handleRender)
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render", strings.NewReader(`{"text": "Hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("Expected no recorded spans for an unsampled caller, got %d", len(spans))
+	}
+}
+
+func TestConfigureSpans(t *testing.T) {
+	previousProvider, previousTracer := spanProvider, spanTracer
+	t.Cleanup(func() { spanProvider, spanTracer = previousProvider, previousTracer })
+
+	exported := make(chan *http.Request, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case exported <- r:
+		default:
+		}
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer collector")
+	if err := configureSpans(); err != nil || spanProvider == nil {
+		t.Fatalf("configureSpans() = %v", err)
+	}
+	_, s := startSpan(context.Background(), "test", spanKindInternal)
+	endSpan(s, nil)
+	if err := shutdownSpans(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-exported:
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer collector" {
+			t.Errorf("Expected spans posted to /v1/traces with the configured headers, got %s %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+	default:
+		t.Error("Expected the buffered spans to be exported on shutdown")
+	}
+}
+
+func TestSpansDisabled(t *testing.T) {
+	previousProvider, previousTracer := spanProvider, spanTracer
+	t.Cleanup(func() { spanProvider, spanTracer = previousProvider, previousTracer })
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if err := configureSpans(); err != nil || spanProvider != nil {
+		t.Fatalf("Expected tracing to be disabled without an endpoint")
+	}
+	_, s := startSpan(context.Background(), "noop", spanKindInternal)
+	if s.IsRecording() {
+		t.Error("Expected spans not to be recorded")
+	}
+	endSpan(s, nil)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	if err := configureSpans(); err != nil || spanProvider != nil {
+		t.Error("Expected OTEL_SDK_DISABLED to disable tracing")
+	}
+}
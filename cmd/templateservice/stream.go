@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// streamChunkSize is how much output is buffered before it is sent to the
+// client; output that fails within the first chunk still gets a JSON error
+const streamChunkSize = 32 << 10
+
+// renderTemplateStream handles REST POST /v1/api/render/stream.
+// It takes the same body as /render/raw but writes the output to the client
+// while the template executes, so multi-megabyte documents are never held in
+// memory whole. The body is plain chunked output, or server-sent events when
+// the client accepts text/event-stream. Renders that need the whole output
+// (post-render hooks, assertions, result persistence, signing, sandboxing)
+// are buffered first and then streamed the same way.
+func renderTemplateStream(c echo.Context) error {
+	var req RenderRequest
+	if err := bindRequest(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+	if req.Template == "" && req.TemplateID == "" && req.TemplateName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "template, templateId or templateName is required"})
+	}
+
+	w := &streamWriter{
+		res: c.Response(),
+		sse: strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream"),
+	}
+	rendered, err := streamRender(c.Request().Context(), rawRenderRequest(req), w)
+	if err != nil {
+		return w.fail(c, err)
+	}
+	return w.finish(rendered)
+}
+
+// streamRender renders req into w, recording the render in the service
+// metrics and the audit log like renderTemplate
+func streamRender(ctx context.Context, req renderRequest, w *streamWriter) (*renderResult, error) {
+	start := time.Now()
+	result, err := runStreamStages(ctx, req, w)
+	observeRender(renderCallerFrom(ctx).Tenant, time.Since(start), result, err)
+	usage.observe(ctx, result, err)
+	audit.recordRender(ctx, req, result, err, time.Since(start))
+	return result, err
+}
+
+// runStreamStages performs the stages of streamRender
+func runStreamStages(ctx context.Context, req renderRequest, w *streamWriter) (*renderResult, error) {
+	req, err := prepareRender(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !streamable(req) {
+		output, err := renderOutput(ctx, req)
+		quarantine.observe(req, err)
+		if err != nil {
+			return nil, err
+		}
+		result, err := finishRender(ctx, req, output)
+		if err != nil {
+			return nil, err
+		}
+		w.result = result
+		if result.Suppressed {
+			return result, nil
+		}
+		if _, err := io.WriteString(w, result.Output); err != nil {
+			return nil, &render.Error{Message: "failed to write response", Status: http.StatusInternalServerError, Err: err}
+		}
+		return result, nil
+	}
+
+	result := &renderResult{
+		EncodingFormat: resultEncodingFormat(req),
+		Trusted:        req.Trusted,
+		TemplateCommit: req.TemplateCommit,
+		Options:        effectiveOptionsFor(req, nil),
+	}
+	w.result = result
+	w.hash = sha256.New()
+	err = compileAndExecuteTo(ctx, req, w)
+	if w.err != nil {
+		// The client went away; that says nothing about the template
+		return nil, &render.Error{Message: "failed to write response", Status: http.StatusInternalServerError, Err: w.err}
+	}
+	quarantine.observe(req, err)
+	if err != nil {
+		return nil, err
+	}
+	result.SHA256 = hex.EncodeToString(w.hash.Sum(nil))
+	result.StreamedBytes = w.size
+	return result, nil
+}
+
+// streamable reports whether req's output can go to the client as it is
+// produced, i.e. no stage needs the complete output first
+func streamable(req renderRequest) bool {
+	return len(postRenderHooks) == 0 && req.Assertions == nil && req.Suppress == nil && results == nil && signer == nil && req.ConvertTo == "" && !sandboxed(req) && !isOfficeFormat(req.EncodingFormat)
+}
+
+// streamWriter sends render output to the client in chunks, committing the
+// response headers with the first chunk
+type streamWriter struct {
+	res    *echo.Response
+	sse    bool
+	result *renderResult // Set before the first write
+	hash   hash.Hash     // Checksum of streamed output, nil when buffered
+	buf    []byte
+	size   int64
+	err    error // First failed write to the client
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.hash != nil {
+		w.hash.Write(p)
+	}
+	w.size += int64(len(p))
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= streamChunkSize {
+		n := streamChunkSize
+		if w.sse {
+			n = runeBoundary(w.buf, n)
+		}
+		if err := w.send(w.buf[:n]); err != nil {
+			w.err = err
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[n:]...)
+	}
+	return len(p), nil
+}
+
+// runeBoundary moves n back to the start of a UTF-8 sequence so an event
+// never splits a character
+func runeBoundary(buf []byte, n int) int {
+	for i := n; i > n-utf8.UTFMax && i > 0; i-- {
+		if utf8.RuneStart(buf[i]) {
+			return i
+		}
+	}
+	return n
+}
+
+// begin writes the response headers
+func (w *streamWriter) begin() {
+	if w.res.Committed {
+		return
+	}
+	header := w.res.Header()
+	if w.sse {
+		header.Set(echo.HeaderContentType, "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("X-Accel-Buffering", "no")
+	} else {
+		header.Set(echo.HeaderContentType, setRawHeaders(header, w.result))
+		header.Set("Trailer", "X-Content-SHA256, X-Render-Error")
+	}
+	w.res.WriteHeader(http.StatusOK)
+}
+
+// send writes one chunk of output
+func (w *streamWriter) send(chunk []byte) error {
+	w.begin()
+	if w.sse {
+		// Each chunk of binary output is base64-encoded on its own
+		text, contentEncoding := jsonOutput(w.result.EncodingFormat, string(chunk))
+		event := map[string]string{"text": text}
+		if contentEncoding != "" {
+			event["contentEncoding"] = contentEncoding
+		}
+		return writeSSE(w.res, "chunk", event)
+	}
+	if _, err := w.res.Write(chunk); err != nil {
+		return err
+	}
+	w.res.Flush()
+	return nil
+}
+
+// finish sends the buffered remainder of the output and its checksum
+func (w *streamWriter) finish(rendered *renderResult) error {
+	if len(w.buf) > 0 {
+		if err := w.send(w.buf); err != nil {
+			return nil
+		}
+	}
+	if rendered.Suppressed && !w.sse {
+		w.res.Header().Set(suppressedHeader, "true")
+		w.res.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.begin()
+	if !w.sse {
+		w.res.Header().Set("X-Content-SHA256", rendered.SHA256)
+		return nil
+	}
+	done := map[string]interface{}{
+		"contentSize":    w.size,
+		"sha256":         rendered.SHA256,
+		"encodingFormat": rendered.EncodingFormat,
+	}
+	if rendered.ContentURL != "" {
+		done["contentUrl"] = rendered.ContentURL
+	}
+	if rendered.Signature != "" {
+		done["signature"] = rendered.Signature
+		done["signatureAlgorithm"] = rendered.SignatureAlgorithm
+	}
+	if rendered.Suppressed {
+		done["suppressed"] = true
+	}
+	if rendered.Options != nil {
+		done["effectiveOptions"] = rendered.Options
+	}
+	_ = writeSSE(w.res, "done", done)
+	return nil
+}
+
+// fail reports a render error: as a JSON error when nothing was sent yet,
+// otherwise as an error event or the X-Render-Error trailer
+func (w *streamWriter) fail(c echo.Context, err error) error {
+	if !w.res.Committed {
+		return renderErrorJSON(c, err)
+	}
+	if w.err != nil {
+		return nil
+	}
+	if !w.sse {
+		w.res.Header().Set("X-Render-Error", err.Error())
+		return nil
+	}
+	status := http.StatusInternalServerError
+	var re *render.Error
+	if errors.As(err, &re) {
+		status = re.Status
+	}
+	_ = writeSSE(w.res, "error", map[string]interface{}{"error": err.Error(), "status": status})
+	return nil
+}
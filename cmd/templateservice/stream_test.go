@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streamRecorder posts body to renderTemplateStream and returns the recorded response
+func streamRecorder(t *testing.T, body, accept string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render/stream", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if accept != "" {
+		req.Header.Set(echo.HeaderAccept, accept)
+	}
+	rec := httptest.NewRecorder()
+	if err := renderTemplateStream(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("renderTemplateStream() returned error: %v", err)
+	}
+	return rec.Result()
+}
+
+const streamRowsBody = `{"template": "{{range .rows}}{{.}}{{end}}", "parameters": {"rows": [%s]}}`
+
+// streamRows returns n rows of 48 bytes with a multi-byte character in each
+func streamRows(n int) string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = `"` + strings.Repeat("x", 45) + `é\n"`
+	}
+	return strings.Join(rows, ",")
+}
+
+func TestRenderTemplateStream(t *testing.T) {
+	res := streamRecorder(t, strings.Replace(streamRowsBody, "%s", streamRows(2000), 1), "")
+	defer res.Body.Close()
+	body := new(strings.Builder)
+	if _, err := bufio.NewReader(res.Body).WriteTo(body); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || body.Len() != 2000*48 {
+		t.Fatalf("Expected 200 and %d bytes, got %d and %d", 2000*48, res.StatusCode, body.Len())
+	}
+	if sha := res.Trailer.Get("X-Content-SHA256"); sha != outputChecksum(body.String()) {
+		t.Errorf("Expected the checksum trailer to match the body, got %q", sha)
+	}
+	if res.Trailer.Get("X-Render-Error") != "" {
+		t.Errorf("Unexpected render error %q", res.Trailer.Get("X-Render-Error"))
+	}
+}
+
+func TestRenderTemplateStreamEvents(t *testing.T) {
+	res := streamRecorder(t, strings.Replace(streamRowsBody, "%s", streamRows(2000), 1), "text/event-stream")
+	if ct := res.Header.Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Fatalf("Unexpected Content-Type %q", ct)
+	}
+
+	var output strings.Builder
+	var done map[string]interface{}
+	chunks := 0
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(nil, 1<<20)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "chunk":
+			var chunk struct{ Text string }
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+				t.Fatal(err)
+			}
+			if strings.ContainsRune(chunk.Text, '�') {
+				t.Error("Expected chunks to end on character boundaries")
+			}
+			output.WriteString(chunk.Text)
+			chunks++
+		case strings.HasPrefix(line, "data: ") && event == "done":
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &done)
+		}
+	}
+	if chunks < 2 || output.Len() != 2000*48 {
+		t.Errorf("Expected several chunks totalling %d bytes, got %d chunks of %d bytes", 2000*48, chunks, output.Len())
+	}
+	if done["sha256"] != outputChecksum(output.String()) || done["contentSize"] != float64(2000*48) {
+		t.Errorf("Unexpected done event %v", done)
+	}
+}
+
+func TestRenderTemplateStreamErrors(t *testing.T) {
+	// Failures before any output keep the JSON error format
+	res := streamRecorder(t, `{"template": "{{.name"}`, "")
+	if res.StatusCode != http.StatusBadRequest || res.Header.Get("Trailer") != "" {
+		t.Errorf("Expected a plain 400, got %d with trailers %q", res.StatusCode, res.Header.Get("Trailer"))
+	}
+
+	// Failures after output was sent are reported at the end of the stream
+	previous := maxOutputBytes
+	maxOutputBytes = 64 << 10
+	t.Cleanup(func() { maxOutputBytes = previous })
+	res = streamRecorder(t, strings.Replace(streamRowsBody, "%s", streamRows(2000), 1), "")
+	_, _ = bufio.NewReader(res.Body).WriteTo(new(strings.Builder))
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Trailer.Get("X-Render-Error"), "exceeds") {
+		t.Errorf("Expected the X-Render-Error trailer, got %d %q", res.StatusCode, res.Trailer.Get("X-Render-Error"))
+	}
+
+	res = streamRecorder(t, strings.Replace(streamRowsBody, "%s", streamRows(2000), 1), "text/event-stream")
+	body := new(strings.Builder)
+	_, _ = bufio.NewReader(res.Body).WriteTo(body)
+	if !strings.Contains(body.String(), "event: error\ndata: {\"error\":") || !strings.Contains(body.String(), `"status":413`) {
+		t.Errorf("Expected an error event, got %q", body.String()[max(0, body.Len()-200):])
+	}
+}
+
+func TestRenderTemplateStreamBuffered(t *testing.T) {
+	// Assertions need the whole output, so the render is buffered first
+	res := streamRecorder(t, `{"template": "{{.n}}", "parameters": {"n": 42}, "assertions": {"validJson": true}}`, "")
+	body := new(strings.Builder)
+	_, _ = bufio.NewReader(res.Body).WriteTo(body)
+	if res.StatusCode != http.StatusOK || body.String() != "42" || res.Trailer.Get("X-Content-SHA256") != outputChecksum("42") {
+		t.Errorf("Unexpected buffered stream %d %q", res.StatusCode, body)
+	}
+
+	res = streamRecorder(t, `{"template": "{{.n}}", "parameters": {"n": "x"}, "assertions": {"validJson": true}}`, "")
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected the failed assertion as a JSON error, got %d", res.StatusCode)
+	}
+}
+
+func TestRuneBoundary(t *testing.T) {
+	buf := []byte("aé")
+	if n := runeBoundary(buf, 2); n != 1 {
+		t.Errorf("runeBoundary() = %d, want 1", n)
+	}
+	if n := runeBoundary([]byte{0x80, 0x80, 0x80, 0x80, 0x80}, 4); n != 4 {
+		t.Errorf("runeBoundary() on invalid input = %d, want 4", n)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"templateservice/pkg/render"
+)
+
+// suppressOptions mark outputs with nothing worth sending, such as a digest
+// without entries. A suppressed render succeeds, but the response flags it
+// and post-render hooks, assertions, result persistence and delivery
+// (S3 pipelines, mailbox replies, job callbacks) are skipped.
+type suppressOptions struct {
+	Empty     bool `json:"empty,omitempty"`     // Suppress whitespace-only output
+	MinLength int  `json:"minLength,omitempty"` // Suppress output shorter than this many characters, ignoring surrounding whitespace
+}
+
+// validate checks the options
+func (o *suppressOptions) validate() error {
+	if o != nil && o.MinLength < 0 {
+		return &render.Error{Message: fmt.Sprintf("suppress.minLength must not be negative, got %d", o.MinLength), Status: http.StatusBadRequest}
+	}
+	return nil
+}
+
+// applies reports whether output is to be suppressed
+func (o *suppressOptions) applies(output string) bool {
+	if o == nil {
+		return false
+	}
+	trimmed := strings.TrimSpace(output)
+	return (o.Empty && trimmed == "") || utf8.RuneCountInString(trimmed) < o.MinLength
+}
+
+// suppressedHeader flags a suppressed render on raw responses
+const suppressedHeader = "X-Render-Suppressed"
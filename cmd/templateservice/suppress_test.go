@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+func TestSuppressOptions(t *testing.T) {
+	tests := []struct {
+		opts   *suppressOptions
+		output string
+		want   bool
+	}{
+		{nil, "", false},
+		{&suppressOptions{Empty: true}, " \n\t", true},
+		{&suppressOptions{Empty: true}, "x", false},
+		{&suppressOptions{MinLength: 5}, "  abcd  ", true},
+		{&suppressOptions{MinLength: 5}, "äöüßé", false},
+		{&suppressOptions{}, "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.applies(tt.output); got != tt.want {
+			t.Errorf("%+v.applies(%q) = %v, want %v", tt.opts, tt.output, got, tt.want)
+		}
+	}
+	if err := (&suppressOptions{MinLength: -1}).validate(); err == nil {
+		t.Error("Expected a negative minLength to be rejected")
+	}
+}
+
+func TestSuppressedRender(t *testing.T) {
+	var hookCalls atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hookCalls.Add(1)
+		_, _ = w.Write([]byte("transformed"))
+	}))
+	defer hook.Close()
+	previous := postRenderHooks
+	postRenderHooks = []string{hook.URL}
+	defer func() { postRenderHooks = previous }()
+
+	template := "{{range .Events}}- {{.}}\n{{end}}"
+	suppress := &suppressOptions{Empty: true}
+	result, err := renderTemplate(context.Background(), renderRequest{
+		Text:       template,
+		Parameters: map[string]interface{}{"Events": []interface{}{}},
+		Suppress:   suppress,
+		Assertions: &render.Assertions{Matches: []string{`\S`}},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if !result.Suppressed || hookCalls.Load() != 0 {
+		t.Errorf("Expected a suppressed render without hook calls, got %+v (%d calls)", result, hookCalls.Load())
+	}
+
+	result, err = renderTemplate(context.Background(), renderRequest{
+		Text:       template,
+		Parameters: map[string]interface{}{"Events": []interface{}{"deploy"}},
+		Suppress:   suppress,
+	})
+	if err != nil || result.Suppressed || result.Output != "transformed" {
+		t.Errorf("Expected non-empty output to be sent through the hooks, got %+v, %v", result, err)
+	}
+}
+
+func TestSuppressedRawResponse(t *testing.T) {
+	e := echo.New()
+	e.POST("/v1/api/render/raw", renderTemplateRaw)
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/render/raw", strings.NewReader(`{"template": "  {{.Body}}  ", "parameters": {"Body": "ok"}, "suppress": {"minLength": 3}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get(suppressedHeader) != "true" || rec.Body.Len() != 0 {
+		t.Errorf("Expected 204 with %s, got %d %v %q", suppressedHeader, rec.Code, rec.Header(), rec.Body)
+	}
+}
+
+func TestSuppressedJobSkipsCallback(t *testing.T) {
+	withJobCallbacks(t, "127.0.0.1")
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer receiver.Close()
+
+	m, err := newJobManager("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.start(1)
+	defer m.stop()
+
+	job := newRenderJob(renderCaller{}, []TemplateRequest{{Text: " ", Suppress: &suppressOptions{Empty: true}}}, jobSchedule{}, false)
+	job.CallbackURL = receiver.URL
+	m.enqueue(job)
+	done := waitForJob(t, m, job.ID)
+	if summary := summarizeJob(done); summary.Succeeded != 1 || summary.Suppressed != 1 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if done.Callback == nil || done.Callback.Status != callbackSkipped || calls.Load() != 0 {
+		t.Errorf("Expected the callback to be skipped, got %+v (%d calls)", done.Callback, calls.Load())
+	}
+}
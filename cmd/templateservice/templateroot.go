@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"templateservice/pkg/render"
+)
+
+// templateRoot confines template files named by identifier or contentUrl to
+// a directory. Empty leaves file paths unrestricted.
+var templateRoot string
+
+// tenantRoots holds a directory per tenant, named after it. Callers with a
+// tenant read template files from their own directory (and Git templates
+// below "<tenant>/" in the repository) instead of templateRoot. Empty
+// leaves tenants with templateRoot.
+var tenantRoots string
+
+// configureTemplateRoot loads TEMPLATE_ROOT and TEMPLATE_TENANT_ROOTS,
+// resolving symlinks so paths can be compared with the real location of
+// template files
+func configureTemplateRoot() error {
+	templateRoot, tenantRoots = "", ""
+	if dir := os.Getenv("TEMPLATE_TENANT_ROOTS"); dir != "" {
+		resolved, err := canonicalRoot(dir)
+		if err != nil {
+			return fmt.Errorf("TEMPLATE_TENANT_ROOTS: %w", err)
+		}
+		tenantRoots = resolved
+		logger.Infof("Template files of tenants confined to their directories in %s", tenantRoots)
+	}
+	root := os.Getenv("TEMPLATE_ROOT")
+	if root == "" {
+		logger.Info("TEMPLATE_ROOT not set, template identifiers may name any file readable by the service")
+		return nil
+	}
+	resolved, err := canonicalRoot(root)
+	if err != nil {
+		return fmt.Errorf("TEMPLATE_ROOT: %w", err)
+	}
+	templateRoot = resolved
+	logger.Infof("Template files confined to %s", templateRoot)
+	return nil
+}
+
+// tenantStorage returns the calling tenant of ctx when it has its own
+// storage root, or "" when the caller reads the shared root
+func tenantStorage(ctx context.Context) (string, error) {
+	tenant := renderCallerFrom(ctx).Tenant
+	if tenantRoots == "" || tenant == "" {
+		return "", nil
+	}
+	if tenant == "." || tenant == ".." || strings.ContainsAny(tenant, `/\`) {
+		return "", &render.Error{Message: fmt.Sprintf("tenant %q cannot have a template root", tenant), Status: http.StatusForbidden}
+	}
+	return tenant, nil
+}
+
+// canonicalRoot returns the absolute, symlink-free form of an existing directory
+func canonicalRoot(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", root)
+	}
+	return resolved, nil
+}
+
+// resolveTemplateFile maps a template identifier to the file to read:
+// upload references to the uploaded file, other paths to a file inside the
+// caller's root, its tenant's directory or templateRoot. Relative paths are
+// taken relative to the root.
+func resolveTemplateFile(ctx context.Context, identifier string) (string, error) {
+	if identifier == "" || strings.HasPrefix(identifier, uploadRefPrefix) {
+		return resolveUploadRef(ctx, identifier)
+	}
+	if isRemoteTemplate(identifier) || isGitTemplate(identifier) || isBuiltinTemplate(identifier) {
+		return identifier, nil
+	}
+	root := templateRoot
+	tenant, err := tenantStorage(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tenant != "" {
+		// Not canonicalized: a tenant directory that is a symlink
+		// resolves outside of it and is refused below
+		root = filepath.Join(tenantRoots, tenant)
+	}
+	if root == "" {
+		return identifier, nil
+	}
+
+	path := identifier
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	if !withinRoot(root, path) {
+		return "", errOutsideTemplateRoot(identifier)
+	}
+
+	// Symlinks inside the root must not lead out of it
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return path, nil // Reported as unreadable when loaded
+	}
+	if err != nil || !withinRoot(root, resolved) {
+		return "", errOutsideTemplateRoot(identifier)
+	}
+	return resolved, nil
+}
+
+// withinRoot reports whether path is root or lies below it
+func withinRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+func errOutsideTemplateRoot(identifier string) error {
+	return &render.Error{Message: fmt.Sprintf("template path %q is outside the template root", identifier), Status: http.StatusForbidden}
+}
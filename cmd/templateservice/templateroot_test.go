@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"templateservice/pkg/render"
+)
+
+func withTemplateRoot(t *testing.T, root string) {
+	t.Helper()
+	resolved, err := canonicalRoot(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := templateRoot
+	templateRoot = resolved
+	t.Cleanup(func() { templateRoot = previous })
+}
+
+func TestResolveTemplateFile(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "templates")
+	if err := os.MkdirAll(filepath.Join(root, "mail"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "mail", "welcome.tmpl"), []byte("Hi {{.name}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(base, "secret.txt")
+	if err := os.WriteFile(secret, []byte("password"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(root, "escape.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	withTemplateRoot(t, root)
+
+	tests := []struct {
+		name       string
+		identifier string
+		allowed    bool
+	}{
+		{"relative", "mail/welcome.tmpl", true},
+		{"absolute inside", filepath.Join(root, "mail", "welcome.tmpl"), true},
+		{"missing inside", "mail/missing.tmpl", true},
+		{"traversal", "../secret.txt", false},
+		{"nested traversal", "mail/../../secret.txt", false},
+		{"absolute outside", secret, false},
+		{"system file", "/etc/passwd", false},
+		{"symlink out", "escape.tmpl", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveTemplateFile(context.Background(), tt.identifier)
+			if tt.allowed && err != nil {
+				t.Errorf("resolveTemplateFile(%q) returned error: %v", tt.identifier, err)
+			}
+			if !tt.allowed {
+				if re, ok := err.(*render.Error); !ok || re.Status != http.StatusForbidden {
+					t.Errorf("Expected 403 for %q, got %v", tt.identifier, err)
+				}
+			}
+		})
+	}
+
+	result, err := renderTemplate(context.Background(), renderRequest{Identifier: "mail/welcome.tmpl", Parameters: map[string]interface{}{"name": "Ada"}})
+	if err != nil || result.Output != "Hi Ada" {
+		t.Errorf("renderTemplate() = %v, %v", result, err)
+	}
+	_, err = renderTemplate(context.Background(), renderRequest{Identifier: "/etc/passwd"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusForbidden {
+		t.Errorf("Expected 403 rendering a file outside the root, got %v", err)
+	}
+}
+
+func TestTenantTemplateRoots(t *testing.T) {
+	base := t.TempDir()
+	for tenant, text := range map[string]string{"acme": "Acme {{.name}}", "globex": "Globex {{.name}}"} {
+		if err := os.MkdirAll(filepath.Join(base, tenant, "mail"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(base, tenant, "mail", "welcome.tmpl"), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(base, "globex"), filepath.Join(base, "initech")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "globex", "mail", "welcome.tmpl"), filepath.Join(base, "acme", "mail", "borrowed.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEMPLATE_TENANT_ROOTS", base)
+	t.Cleanup(func() { templateRoot, tenantRoots = "", "" })
+	if err := configureTemplateRoot(); err != nil {
+		t.Fatal(err)
+	}
+
+	renderAs := func(tenant, identifier string) (*renderResult, error) {
+		ctx := withRenderCaller(context.Background(), renderCaller{Tenant: tenant})
+		return renderTemplate(ctx, renderRequest{Identifier: identifier, Parameters: map[string]interface{}{"name": "Ada"}})
+	}
+	if result, err := renderAs("acme", "mail/welcome.tmpl"); err != nil || result.Output != "Acme Ada" {
+		t.Errorf("acme renderAs() = %v, %v", result, err)
+	}
+	if result, err := renderAs("globex", "mail/welcome.tmpl"); err != nil || result.Output != "Globex Ada" {
+		t.Errorf("globex renderAs() = %v, %v", result, err)
+	}
+
+	tests := []struct {
+		name       string
+		tenant     string
+		identifier string
+	}{
+		{"traversal into another tenant", "acme", "../globex/mail/welcome.tmpl"},
+		{"absolute path of another tenant", "acme", filepath.Join(base, "globex", "mail", "welcome.tmpl")},
+		{"symlink into another tenant", "acme", "mail/borrowed.tmpl"},
+		{"tenant directory linked to another", "initech", "mail/welcome.tmpl"},
+		{"tenant name with a separator", "acme/../globex", "mail/welcome.tmpl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := renderAs(tt.tenant, tt.identifier)
+			if re, ok := err.(*render.Error); !ok || re.Status != http.StatusForbidden {
+				t.Errorf("Expected 403 for %s rendering %q, got %v", tt.tenant, tt.identifier, err)
+			}
+		})
+	}
+}
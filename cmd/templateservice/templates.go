@@ -0,0 +1,788 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// templateNamePattern restricts stored template names to values that are
+// safe as file names and URL path segments. Tenant IDs follow it as well.
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// validTemplateName reports whether name can name a stored template: a
+// shared template's name or a tenant's "<tenant>~<name>" (see tenants.go)
+func validTemplateName(name string) bool {
+	if tenant, base, ok := strings.Cut(name, tenantTemplateSeparator); ok {
+		return templateNamePattern.MatchString(tenant) && templateNamePattern.MatchString(base)
+	}
+	return templateNamePattern.MatchString(name)
+}
+
+// errTemplateNotFound is returned by backends for unknown template names
+var errTemplateNotFound = errors.New("template not found")
+
+// storedTemplate is a named template together with its render defaults.
+// Request options override the defaults.
+type storedTemplate struct {
+	Name            string           `json:"name"`
+	Version         int              `json:"version"`
+	Description     string           `json:"description,omitempty"`
+	Text            string           `json:"text"`
+	EncodingFormat  string           `json:"encodingFormat,omitempty"` // Output format of renders
+	Delimiters      []string         `json:"delimiters,omitempty"`
+	MissingKey      string           `json:"missingKey,omitempty"`
+	MissingKeyValue *string          `json:"missingKeyValue,omitempty"`
+	Engine          string           `json:"engine,omitempty"`        // Template engine (default go, see engine.go)
+	Suppress        *suppressOptions `json:"suppress,omitempty"`      // Default suppression of empty output (see suppress.go)
+	EffectiveFrom   *time.Time       `json:"effectiveFrom,omitempty"` // Scheduled activation; unset takes effect when saved (see effective.go)
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+
+	Trusted bool `json:"trusted,omitempty"` // Raw HTML output may be served as active content
+
+	Partials map[string]string `json:"partials,omitempty"` // Named templates included with {{template}}
+	Layout   string            `json:"layout,omitempty"`   // Default layout to render into
+
+	AllowedCallers []string `json:"allowedCallers,omitempty"` // Key prefixes, signing key IDs or globs; empty allows all
+
+	Owner  string `json:"owner,omitempty"`  // Contact named in quarantine notifications
+	Tenant string `json:"tenant,omitempty"` // Tenant owning the template; empty for shared templates (see tenants.go)
+
+	Published  bool                `json:"published,omitempty"`  // Listed in the marketplace for import (see marketplace.go)
+	License    string              `json:"license,omitempty"`    // SPDX identifier, e.g. "Apache-2.0"
+	Provenance *templateProvenance `json:"provenance,omitempty"` // Origin of an imported template
+}
+
+// templateBackend persists stored templates. Every put adds a new version;
+// earlier versions stay available for inspection, rendering and rollback.
+type templateBackend interface {
+	get(name string) (*storedTemplate, error)
+	getVersion(name string, version int) (*storedTemplate, error)
+	versions(name string) ([]*storedTemplate, error)
+	put(tmpl *storedTemplate) error // Assigns tmpl.Version
+	delete(name string) error       // Removes all versions
+	list() ([]*storedTemplate, error)
+}
+
+// templateStore is the named template registry
+var templateStore templateBackend = newMemoryTemplateBackend()
+
+// configureTemplateStore selects the template backend from the environment.
+// TEMPLATE_STORE_DIR keeps templates on disk; without it they live in memory.
+func configureTemplateStore() error {
+	dir := os.Getenv("TEMPLATE_STORE_DIR")
+	if dir == "" {
+		logger.Info("TEMPLATE_STORE_DIR not set, stored templates will not survive a restart")
+		templateStore = newMemoryTemplateBackend()
+		return nil
+	}
+	backend, err := newFileTemplateBackend(dir)
+	if err != nil {
+		return err
+	}
+	templateStore = backend
+	logger.Infof("Template store in %s", dir)
+	return nil
+}
+
+// memoryTemplateBackend keeps templates in process memory
+type memoryTemplateBackend struct {
+	mu        sync.RWMutex
+	templates map[string][]*storedTemplate // Versions in ascending order
+}
+
+func newMemoryTemplateBackend() *memoryTemplateBackend {
+	return &memoryTemplateBackend{templates: make(map[string][]*storedTemplate)}
+}
+
+func (b *memoryTemplateBackend) get(name string) (*storedTemplate, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	history := b.templates[name]
+	if len(history) == 0 {
+		return nil, errTemplateNotFound
+	}
+	copied := *history[len(history)-1]
+	return &copied, nil
+}
+
+func (b *memoryTemplateBackend) getVersion(name string, version int) (*storedTemplate, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, tmpl := range b.templates[name] {
+		if tmpl.Version == version {
+			copied := *tmpl
+			return &copied, nil
+		}
+	}
+	return nil, errTemplateNotFound
+}
+
+func (b *memoryTemplateBackend) versions(name string) ([]*storedTemplate, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	history := b.templates[name]
+	if len(history) == 0 {
+		return nil, errTemplateNotFound
+	}
+	list := make([]*storedTemplate, len(history))
+	for i, tmpl := range history {
+		copied := *tmpl
+		list[i] = &copied
+	}
+	return list, nil
+}
+
+func (b *memoryTemplateBackend) put(tmpl *storedTemplate) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	history := b.templates[tmpl.Name]
+	tmpl.Version = 1
+	if len(history) > 0 {
+		tmpl.Version = history[len(history)-1].Version + 1
+	}
+	copied := *tmpl
+	b.templates[tmpl.Name] = append(history, &copied)
+	return nil
+}
+
+func (b *memoryTemplateBackend) delete(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.templates[name]; !ok {
+		return errTemplateNotFound
+	}
+	delete(b.templates, name)
+	return nil
+}
+
+func (b *memoryTemplateBackend) list() ([]*storedTemplate, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	list := make([]*storedTemplate, 0, len(b.templates))
+	for _, history := range b.templates {
+		copied := *history[len(history)-1]
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// fileTemplateBackend stores each version of a template as
+// <name>/versions/<n>.json in a directory
+type fileTemplateBackend struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newFileTemplateBackend(dir string) (*fileTemplateBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	b := &fileTemplateBackend{dir: dir}
+	if err := b.migrateUnversioned(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// migrateUnversioned moves templates saved as <name>.json before versioning
+// was introduced into version 1 of their history
+func (b *fileTemplateBackend) migrateUnversioned() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || name == entry.Name() || !validTemplateName(name) {
+			continue
+		}
+		if err := os.MkdirAll(b.versionDir(name), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(b.dir, entry.Name()), b.versionPath(name, 1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *fileTemplateBackend) versionDir(name string) string {
+	return filepath.Join(b.dir, name, "versions")
+}
+
+func (b *fileTemplateBackend) versionPath(name string, version int) string {
+	return filepath.Join(b.versionDir(name), strconv.Itoa(version)+".json")
+}
+
+// versionNumbers returns the stored versions of a template in ascending order
+func (b *fileTemplateBackend) versionNumbers(name string) ([]int, error) {
+	entries, err := os.ReadDir(b.versionDir(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for _, entry := range entries {
+		n, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err == nil && n > 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, errTemplateNotFound
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+func (b *fileTemplateBackend) get(name string) (*storedTemplate, error) {
+	numbers, err := b.versionNumbers(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.getVersion(name, numbers[len(numbers)-1])
+}
+
+func (b *fileTemplateBackend) getVersion(name string, version int) (*storedTemplate, error) {
+	data, err := os.ReadFile(b.versionPath(name, version))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tmpl storedTemplate
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return nil, fmt.Errorf("corrupt template %s version %d: %w", name, version, err)
+	}
+	tmpl.Version = version
+	return &tmpl, nil
+}
+
+func (b *fileTemplateBackend) versions(name string) ([]*storedTemplate, error) {
+	numbers, err := b.versionNumbers(name)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*storedTemplate, 0, len(numbers))
+	for _, n := range numbers {
+		tmpl, err := b.getVersion(name, n)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tmpl)
+	}
+	return list, nil
+}
+
+func (b *fileTemplateBackend) put(tmpl *storedTemplate) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tmpl.Version = 1
+	numbers, err := b.versionNumbers(tmpl.Name)
+	if err != nil && !errors.Is(err, errTemplateNotFound) {
+		return err
+	}
+	if len(numbers) > 0 {
+		tmpl.Version = numbers[len(numbers)-1] + 1
+	}
+
+	data, err := json.MarshalIndent(tmpl, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(b.versionDir(tmpl.Name), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(b.versionPath(tmpl.Name, tmpl.Version), data)
+}
+
+func (b *fileTemplateBackend) delete(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(b.dir, name)); errors.Is(err, os.ErrNotExist) {
+		return errTemplateNotFound
+	}
+	return os.RemoveAll(filepath.Join(b.dir, name))
+}
+
+func (b *fileTemplateBackend) list() ([]*storedTemplate, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	list := []*storedTemplate{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !validTemplateName(entry.Name()) {
+			continue
+		}
+		tmpl, err := b.get(entry.Name())
+		if err != nil {
+			logger.WithError(err).Error("Skipping unreadable stored template " + entry.Name())
+			continue
+		}
+		list = append(list, tmpl)
+	}
+	return list, nil
+}
+
+// resolveStoredTemplate fills a render request from the stored template it
+// names, at the requested version or the one effective at the request's
+// effectiveDate (see effective.go). Legacy requests whose identifier matches
+// a stored template name use the stored template instead of a file path.
+// Options already set on the request take precedence over the template's
+// defaults.
+func resolveStoredTemplate(req renderRequest) (renderRequest, error) {
+	name := req.TemplateName
+	if name == "" {
+		if req.Text != "" || !validTemplateName(req.Identifier) {
+			return req, nil
+		}
+		name = req.Identifier
+	}
+
+	var stored, current *storedTemplate
+	var err error
+	if req.TemplateVersion > 0 {
+		stored, err = templateStore.getVersion(name, req.TemplateVersion)
+	} else {
+		at, parseErr := parseEffectiveDate(req.EffectiveDate)
+		if parseErr != nil {
+			return req, parseErr
+		}
+		stored, current, err = effectiveTemplate(name, at)
+	}
+	if errors.Is(err, errTemplateNotFound) {
+		if req.TemplateName == "" && req.TemplateVersion == 0 {
+			// Not a stored template; fall back to the identifier as a path
+			return req, nil
+		}
+		if req.TemplateVersion > 0 {
+			return req, &render.Error{Message: fmt.Sprintf("template %q version %d not found", name, req.TemplateVersion), Status: http.StatusNotFound}
+		}
+		return req, &render.Error{Message: fmt.Sprintf("template %q not found", name), Status: http.StatusNotFound}
+	}
+	var renderErr *render.Error
+	if errors.As(err, &renderErr) {
+		return req, err
+	}
+	if err != nil {
+		return req, &render.Error{Message: "failed to load stored template", Status: http.StatusInternalServerError, Err: err}
+	}
+
+	req.Name = stored.Name
+	req.Text = stored.Text
+	req.Identifier = ""
+	req.TemplateName = stored.Name
+	req.StoredVersion = stored.Version
+	req.AllowedCallers = stored.AllowedCallers
+	req.OwnerTenant = stored.Tenant
+	if current == nil || current.Version != stored.Version {
+		// Earlier and scheduled versions are restricted like the latest one
+		if current == nil {
+			if current, err = templateStore.get(name); err != nil {
+				return req, &render.Error{Message: "failed to load stored template", Status: http.StatusInternalServerError, Err: err}
+			}
+		}
+		req.AllowedCallers = current.AllowedCallers
+		req.OwnerTenant = current.Tenant
+	}
+	req.Trusted = stored.Trusted
+	req.Partials = mergePartials(stored.Partials, req.Partials)
+	if req.Layout == "" {
+		req.Layout = stored.Layout
+	}
+	if req.EncodingFormat == "" {
+		req.EncodingFormat = stored.EncodingFormat
+	}
+	if len(req.Delimiters) == 0 {
+		req.Delimiters = stored.Delimiters
+	}
+	if req.MissingKey == "" && req.MissingValue == nil {
+		req.MissingKey = stored.MissingKey
+		req.MissingValue = stored.MissingKeyValue
+	}
+	if req.Engine == "" {
+		req.Engine = stored.Engine
+	}
+	if req.Suppress == nil {
+		req.Suppress = stored.Suppress
+	}
+	return req, nil
+}
+
+// templateInput is the body of POST and PUT /v1/api/templates/:name
+type templateInput struct {
+	Description     string           `json:"description,omitempty"`
+	Text            string           `json:"text"`
+	EncodingFormat  string           `json:"encodingFormat,omitempty"`
+	Delimiters      []string         `json:"delimiters,omitempty"`
+	MissingKey      string           `json:"missingKey,omitempty"`
+	MissingKeyValue *string          `json:"missingKeyValue,omitempty"`
+	Engine          string           `json:"engine,omitempty"`
+	Suppress        *suppressOptions `json:"suppress,omitempty"`
+	EffectiveFrom   *time.Time       `json:"effectiveFrom,omitempty"`
+
+	Trusted bool `json:"trusted,omitempty"`
+
+	Partials map[string]string `json:"partials,omitempty"`
+	Layout   string            `json:"layout,omitempty"`
+
+	AllowedCallers []string `json:"allowedCallers,omitempty"`
+
+	Owner string `json:"owner,omitempty"`
+
+	Published bool   `json:"published,omitempty"`
+	License   string `json:"license,omitempty"`
+
+	provenance *templateProvenance // Set by imports, never from the request body
+	tenant     string              // Set from the caller, never from the request body
+}
+
+// bindTemplateInput decodes and validates a template body. The template is
+// compiled so syntax errors are reported on save rather than on first render.
+func bindTemplateInput(c echo.Context) (string, *templateInput, error) {
+	name := c.Param("name")
+	if !validTemplateName(name) {
+		return "", nil, &render.Error{Message: "invalid template name", Status: http.StatusBadRequest}
+	}
+
+	var input templateInput
+	if err := c.Bind(&input); err != nil {
+		return "", nil, &render.Error{Message: "invalid request", Status: http.StatusBadRequest, Err: err}
+	}
+	if input.Text == "" {
+		return "", nil, &render.Error{Message: "text is required", Status: http.StatusBadRequest}
+	}
+	if isBuiltinTemplate(input.Layout) {
+		if _, _, err := lookupBuiltinTemplate(input.Layout); err != nil {
+			return "", nil, &render.Error{Message: fmt.Sprintf("invalid layout %q", input.Layout), Status: http.StatusBadRequest}
+		}
+	} else if input.Layout != "" && (!validTemplateName(input.Layout) || input.Layout == name) {
+		return "", nil, &render.Error{Message: fmt.Sprintf("invalid layout %q", input.Layout), Status: http.StatusBadRequest}
+	}
+	if err := validateAllowedCallers(input.AllowedCallers); err != nil {
+		return "", nil, err
+	}
+
+	if err := parseTemplateInput(name, &input); err != nil {
+		return "", nil, err
+	}
+	// Templates named for a tenant belong to it, also when an administrator
+	// without a tenant creates them
+	input.tenant = renderCallerFrom(c.Request().Context()).Tenant
+	if input.tenant == "" {
+		input.tenant = tenantOfTemplateName(name)
+	}
+	return name, &input, nil
+}
+
+// parseTemplateInput checks a template input's options and that it parses with its engine
+func parseTemplateInput(name string, input *templateInput) error {
+	if err := input.Suppress.validate(); err != nil {
+		return err
+	}
+	req, err := resolveEngine(renderRequest{
+		Name:           name,
+		Text:           input.Text,
+		EncodingFormat: input.EncodingFormat,
+		Delimiters:     input.Delimiters,
+		MissingKey:     input.MissingKey,
+		MissingValue:   input.MissingKeyValue,
+		Partials:       input.Partials,
+		Engine:         input.Engine,
+	})
+	if err != nil {
+		return err
+	}
+	if format, ok := officeFormatFor(req.EncodingFormat); ok {
+		return parseOfficeTemplate(req, format)
+	}
+	_, err = parseTemplate(req)
+	return err
+}
+
+// saveTemplate writes a template built from input, keeping the creation time
+// and tenant of existing
+func saveTemplate(name string, input *templateInput, existing *storedTemplate) (*storedTemplate, error) {
+	now := time.Now().UTC()
+	tmpl := &storedTemplate{
+		Name:            name,
+		Description:     input.Description,
+		Text:            input.Text,
+		EncodingFormat:  input.EncodingFormat,
+		Delimiters:      input.Delimiters,
+		MissingKey:      input.MissingKey,
+		MissingKeyValue: input.MissingKeyValue,
+		Engine:          input.Engine,
+		Suppress:        input.Suppress,
+		EffectiveFrom:   input.EffectiveFrom,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+
+		Trusted:  input.Trusted,
+		Partials: input.Partials,
+		Layout:   input.Layout,
+
+		AllowedCallers: input.AllowedCallers,
+
+		Owner:  input.Owner,
+		Tenant: input.tenant,
+
+		Published:  input.Published,
+		License:    input.License,
+		Provenance: input.provenance,
+	}
+	if existing != nil {
+		tmpl.CreatedAt = existing.CreatedAt
+		tmpl.Tenant = existing.Tenant
+		if tmpl.Provenance == nil {
+			// Edits of an imported template keep its origin
+			tmpl.Provenance = existing.Provenance
+		}
+	}
+	return tmpl, templateStore.put(tmpl)
+}
+
+// handleListTemplates handles GET /v1/api/templates
+func handleListTemplates(c echo.Context) error {
+	list, err := templateStore.list()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Restricted templates are only listed to their allowed callers, and
+	// other tenants' templates not at all
+	caller := renderCallerFrom(c.Request().Context())
+	visible := make([]*storedTemplate, 0, len(list))
+	for _, tmpl := range list {
+		if callerAllowed(caller.Principal, tmpl.AllowedCallers) && tenantVisible(caller.Tenant, tmpl.Tenant) {
+			visible = append(visible, tmpl)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"templates": visible})
+}
+
+// handleGetTemplate handles GET /v1/api/templates/:name
+func handleGetTemplate(c echo.Context) error {
+	if ok, err := templateReadable(c, c.Param("name")); err != nil || !ok {
+		return templateAccessDenied(c, err)
+	}
+	tmpl, err := templateStore.get(c.Param("name"))
+	if errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, tmpl)
+}
+
+// handleCreateTemplate handles POST /v1/api/templates/:name.
+// Creating a name that already exists is a conflict; use PUT to replace.
+func handleCreateTemplate(c echo.Context) error {
+	name, input, err := bindTemplateInput(c)
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+	if _, err := templateStore.get(name); err == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "template already exists"})
+	} else if !errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if err := checkTenantQuota(c.Request().Context()); err != nil {
+		return renderErrorJSON(c, err)
+	}
+	if err := usage.checkStorage(c.Request().Context(), name, templateBytes(input.Text, input.Partials)); err != nil {
+		return renderErrorJSON(c, err)
+	}
+
+	tmpl, err := saveTemplate(name, input, nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, tmpl)
+}
+
+// handlePutTemplate handles PUT /v1/api/templates/:name, creating or replacing the template
+func handlePutTemplate(c echo.Context) error {
+	name, input, err := bindTemplateInput(c)
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+	existing, err := templateStore.get(name)
+	if err != nil && !errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if existing == nil {
+		if err := checkTenantQuota(c.Request().Context()); err != nil {
+			return renderErrorJSON(c, err)
+		}
+	}
+	if err := usage.checkStorage(c.Request().Context(), name, templateBytes(input.Text, input.Partials)); err != nil {
+		return renderErrorJSON(c, err)
+	}
+
+	tmpl, err := saveTemplate(name, input, existing)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if existing == nil {
+		return c.JSON(http.StatusCreated, tmpl)
+	}
+	return c.JSON(http.StatusOK, tmpl)
+}
+
+// handleDeleteTemplate handles DELETE /v1/api/templates/:name. Templates
+// with a legal hold on them or any of their versions cannot be deleted.
+func handleDeleteTemplate(c echo.Context) error {
+	name := c.Param("name")
+	err := legalHolds.removeUnlessHeld(holdTemplate, name, func() error { return templateStore.delete(name) })
+	if errors.Is(err, errLegalHold) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "template is under legal hold"})
+	}
+	if errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// templateVersionSummary describes one version in a template's history
+type templateVersionSummary struct {
+	Version       int        `json:"version"`
+	Description   string     `json:"description,omitempty"`
+	Size          int        `json:"size"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	EffectiveFrom *time.Time `json:"effectiveFrom,omitempty"`
+}
+
+// templateVersionParam parses the :version path parameter
+func templateVersionParam(c echo.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	return version, err == nil && version > 0
+}
+
+// handleListTemplateVersions handles GET /v1/api/templates/:name/versions
+func handleListTemplateVersions(c echo.Context) error {
+	if ok, err := templateReadable(c, c.Param("name")); err != nil || !ok {
+		return templateAccessDenied(c, err)
+	}
+	history, err := templateStore.versions(c.Param("name"))
+	if errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	versions := make([]templateVersionSummary, len(history))
+	for i, tmpl := range history {
+		versions[i] = templateVersionSummary{
+			Version:     tmpl.Version,
+			Description: tmpl.Description,
+			Size:        len(tmpl.Text),
+			UpdatedAt:   tmpl.UpdatedAt,
+
+			EffectiveFrom: tmpl.EffectiveFrom,
+		}
+	}
+	response := map[string]interface{}{
+		"name":     c.Param("name"),
+		"current":  versions[len(versions)-1].Version,
+		"versions": versions,
+	}
+	if active := effectiveVersion(history, time.Now().UTC()); active != nil {
+		response["active"] = active.Version
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleGetTemplateVersion handles GET /v1/api/templates/:name/versions/:version
+func handleGetTemplateVersion(c echo.Context) error {
+	version, ok := templateVersionParam(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid version"})
+	}
+	if ok, err := templateReadable(c, c.Param("name")); err != nil || !ok {
+		return templateAccessDenied(c, err)
+	}
+	tmpl, err := templateStore.getVersion(c.Param("name"), version)
+	if errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template version not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, tmpl)
+}
+
+// handleRollbackTemplate handles POST /v1/api/templates/:name/rollback.
+// The selected version is saved again as the new latest version, so the
+// rollback itself is part of the history and can be undone.
+func handleRollbackTemplate(c echo.Context) error {
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := c.Bind(&req); err != nil || req.Version <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "version is required"})
+	}
+
+	name := c.Param("name")
+	target, err := templateStore.getVersion(name, req.Version)
+	if errors.Is(err, errTemplateNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template version not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	current, err := templateStore.get(name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	tmpl, err := saveTemplate(name, &templateInput{
+		Description:     target.Description,
+		Text:            target.Text,
+		EncodingFormat:  target.EncodingFormat,
+		Delimiters:      target.Delimiters,
+		MissingKey:      target.MissingKey,
+		MissingKeyValue: target.MissingKeyValue,
+		Engine:          target.Engine,
+		Suppress:        target.Suppress,
+
+		Trusted:  target.Trusted,
+		Partials: target.Partials,
+		Layout:   target.Layout,
+
+		// Access restrictions are not rolled back
+		AllowedCallers: current.AllowedCallers,
+
+		Owner: target.Owner,
+	}, current)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, tmpl)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// withTemplateStore swaps the global template store for the duration of a test
+func withTemplateStore(t *testing.T, backend templateBackend) {
+	t.Helper()
+	previous := templateStore
+	templateStore = backend
+	t.Cleanup(func() { templateStore = previous })
+}
+
+func TestFileTemplateBackend_CRUD(t *testing.T) {
+	backend, err := newFileTemplateBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("newFileTemplateBackend() returned error: %v", err)
+	}
+
+	if err := backend.put(&storedTemplate{Name: "welcome", Text: "Hi {{.Name}}"}); err != nil {
+		t.Fatalf("put() returned error: %v", err)
+	}
+	got, err := backend.get("welcome")
+	if err != nil || got.Text != "Hi {{.Name}}" {
+		t.Fatalf("get() = %+v, %v", got, err)
+	}
+
+	list, err := backend.list()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list() = %d templates, %v", len(list), err)
+	}
+
+	if err := backend.delete("welcome"); err != nil {
+		t.Fatalf("delete() returned error: %v", err)
+	}
+	if _, err := backend.get("welcome"); err != errTemplateNotFound {
+		t.Errorf("Expected errTemplateNotFound after delete, got %v", err)
+	}
+}
+
+func TestRenderTemplate_StoredTemplate(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	substitute := "N/A"
+	_ = templateStore.put(&storedTemplate{
+		Name:            "greeting",
+		Text:            "<% .Name %> <% .Title %>",
+		EncodingFormat:  "text/html",
+		Delimiters:      []string{"<%", "%>"},
+		MissingKeyValue: &substitute,
+	})
+
+	result, err := renderTemplate(context.Background(), renderRequest{
+		TemplateName: "greeting",
+		Parameters:   map[string]interface{}{"Name": "Alice"},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if result.Output != "Alice N/A" || result.EncodingFormat != "text/html" {
+		t.Errorf("Unexpected result: %q (%s)", result.Output, result.EncodingFormat)
+	}
+
+	// Legacy templateId resolves stored names before file paths
+	legacy, err := renderTemplate(context.Background(), renderRequestFrom(TemplateRequest{
+		TemplateID: "greeting",
+		Parameters: map[string]interface{}{"Name": "Bob", "Title": "PhD"},
+	}))
+	if err != nil || legacy.Output != "Bob PhD" {
+		t.Errorf("Legacy templateId render = %v, %v", legacy, err)
+	}
+
+	_, err = renderTemplate(context.Background(), renderRequest{TemplateName: "missing"})
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown template, got %v", err)
+	}
+}
+
+func TestTemplateHandlers(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	e := echo.New()
+
+	call := func(handler echo.HandlerFunc, method, name, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/api/templates/"+name, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("name")
+		c.SetParamValues(name)
+		if err := handler(c); err != nil {
+			t.Fatalf("%s returned error: %v", method, err)
+		}
+		return rec
+	}
+
+	if rec := call(handleCreateTemplate, http.MethodPost, "invoice", `{"text": "Total {{.Total}}"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := call(handleCreateTemplate, http.MethodPost, "invoice", `{"text": "again"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Duplicate POST status = %d", rec.Code)
+	}
+	if rec := call(handlePutTemplate, http.MethodPut, "invoice", `{"text": "{{.Total"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT with syntax error status = %d", rec.Code)
+	}
+	if rec := call(handlePutTemplate, http.MethodPut, "invoice", `{"text": "Sum {{.Total}}"}`); rec.Code != http.StatusOK {
+		t.Errorf("PUT status = %d", rec.Code)
+	}
+	if rec := call(handleGetTemplate, http.MethodGet, "invoice", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Sum") {
+		t.Errorf("GET = %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(handleCreateTemplate, http.MethodPost, "../etc", `{"text": "x"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid name status = %d", rec.Code)
+	}
+	if rec := call(handleDeleteTemplate, http.MethodDelete, "invoice", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d", rec.Code)
+	}
+	if rec := call(handleGetTemplate, http.MethodGet, "invoice", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after delete status = %d", rec.Code)
+	}
+}
+
+func TestTemplateVersions_HistoryAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	backend, _ := newFileTemplateBackend(dir)
+	withTemplateStore(t, backend)
+
+	for _, text := range []string{"v1 {{.Name}}", "v2 {{.Name}}"} {
+		existing, _ := templateStore.get("letter")
+		if _, err := saveTemplate("letter", &templateInput{Text: text}, existing); err != nil {
+			t.Fatalf("saveTemplate() returned error: %v", err)
+		}
+	}
+
+	history, err := templateStore.versions("letter")
+	if err != nil || len(history) != 2 || history[1].Version != 2 {
+		t.Fatalf("versions() = %+v, %v", history, err)
+	}
+
+	render := func(version int) string {
+		result, err := renderTemplate(context.Background(), renderRequest{
+			TemplateName:    "letter",
+			TemplateVersion: version,
+			Parameters:      map[string]interface{}{"Name": "Alice"},
+		})
+		if err != nil {
+			t.Fatalf("renderTemplate(version %d) returned error: %v", version, err)
+		}
+		return result.Output
+	}
+	if got := render(1); got != "v1 Alice" {
+		t.Errorf("Version 1 rendered %q", got)
+	}
+	if got := render(0); got != "v2 Alice" {
+		t.Errorf("Latest version rendered %q", got)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/templates/letter/rollback", strings.NewReader(`{"version": 1}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("name")
+	c.SetParamValues("letter")
+	if err := handleRollbackTemplate(c); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("rollback = %d, %v: %s", rec.Code, err, rec.Body)
+	}
+
+	current, _ := templateStore.get("letter")
+	if current.Version != 3 || current.Text != "v1 {{.Name}}" {
+		t.Errorf("Rollback should create version 3 with version 1 content, got %+v", current)
+	}
+}
+
+func TestFileTemplateBackend_MigratesUnversionedTemplates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "legacy.json"), []byte(`{"name": "legacy", "text": "old"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := newFileTemplateBackend(dir)
+	if err != nil {
+		t.Fatalf("newFileTemplateBackend() returned error: %v", err)
+	}
+	tmpl, err := backend.get("legacy")
+	if err != nil || tmpl.Version != 1 || tmpl.Text != "old" {
+		t.Errorf("get() = %+v, %v", tmpl, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// tenantHost maps a Host header pattern to a tenant
+type tenantHost struct {
+	Pattern string // Host name or glob, e.g. "*.acme.example"
+	Tenant  string
+}
+
+// tenantHosts resolves white-labeled domains to tenants, from
+// TEMPLATE_TENANT_HOSTS (first match wins)
+var tenantHosts []tenantHost
+
+// configureTenantHosts parses TEMPLATE_TENANT_HOSTS, a comma-separated list
+// of host=tenant pairs
+func configureTenantHosts() error {
+	hosts, err := parseTenantHosts(envList("TEMPLATE_TENANT_HOSTS"))
+	if err != nil {
+		return err
+	}
+	tenantHosts = hosts
+	if len(hosts) > 0 {
+		logger.Infof("Resolving tenants from %d host mappings", len(hosts))
+	}
+	return nil
+}
+
+func parseTenantHosts(entries []string) ([]tenantHost, error) {
+	hosts := make([]tenantHost, 0, len(entries))
+	for _, entry := range entries {
+		pattern, tenant, ok := strings.Cut(entry, "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		tenant = strings.TrimSpace(tenant)
+		if _, err := path.Match(pattern, ""); !ok || pattern == "" || err != nil || !templateNamePattern.MatchString(tenant) {
+			return nil, fmt.Errorf("TEMPLATE_TENANT_HOSTS: expected host=tenant, got %q", entry)
+		}
+		hosts = append(hosts, tenantHost{Pattern: pattern, Tenant: tenant})
+	}
+	return hosts, nil
+}
+
+// tenantForHost returns the tenant mapped to a Host header value, if any
+func tenantForHost(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, mapping := range tenantHosts {
+		if ok, err := path.Match(mapping.Pattern, host); err == nil && ok {
+			return mapping.Tenant
+		}
+	}
+	return ""
+}
+
+// tenantHostMiddleware sets the tenant of requests to a mapped host. The
+// tenant of a provisioned key takes precedence (see apikeys.go).
+func tenantHostMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if tenant := tenantForHost(c.Request().Host); tenant != "" {
+			c.Set(tenantContextKey, tenant)
+		}
+		return next(c)
+	}
+}
+
+// resolveTenantTemplate renders the calling tenant's own variant of a stored
+// template, named "<tenant>~<name>", in place of the shared one when it
+// exists. Pinned versions always refer to the named template.
+func resolveTenantTemplate(ctx context.Context, req renderRequest) (renderRequest, error) {
+	tenant := renderCallerFrom(ctx).Tenant
+	name := req.TemplateName
+	if name == "" && req.Text == "" && validTemplateName(req.Identifier) {
+		name = req.Identifier
+	}
+	if tenant == "" || name == "" || req.TemplateVersion > 0 || tenantOfTemplateName(name) != "" {
+		return req, nil
+	}
+	variant := tenantTemplateName(tenant, name)
+	if !validTemplateName(variant) {
+		return req, nil
+	}
+	_, err := templateStore.get(variant)
+	if errors.Is(err, errTemplateNotFound) {
+		return req, nil
+	}
+	if err != nil {
+		return req, &render.Error{Message: "failed to load stored template", Status: http.StatusInternalServerError, Err: err}
+	}
+	req.TemplateName = variant
+	req.Identifier = ""
+	return req, nil
+}
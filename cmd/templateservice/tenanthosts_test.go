@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func withTenantHosts(t *testing.T, entries ...string) {
+	t.Helper()
+	hosts, err := parseTenantHosts(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := tenantHosts
+	tenantHosts = hosts
+	t.Cleanup(func() { tenantHosts = previous })
+}
+
+func TestTenantForHost(t *testing.T) {
+	withTenantHosts(t, "docs.acme.example=acme", "*.globex.example=globex")
+	tests := map[string]string{
+		"docs.acme.example":       "acme",
+		"DOCS.ACME.EXAMPLE:8443":  "acme",
+		"docs.acme.example.":      "acme",
+		"billing.globex.example":  "globex",
+		"globex.example":          "",
+		"templates.internal:8095": "",
+	}
+	for host, want := range tests {
+		if got := tenantForHost(host); got != want {
+			t.Errorf("tenantForHost(%q) = %q, want %q", host, got, want)
+		}
+	}
+
+	for _, entry := range []string{"acme.example", "=acme", "acme.example=", "[=acme", "acme.example=no tenant"} {
+		if _, err := parseTenantHosts([]string{entry}); err == nil {
+			t.Errorf("Expected %q to be rejected", entry)
+		}
+	}
+}
+
+func TestTenantHostResolution(t *testing.T) {
+	withTenantHosts(t, "docs.acme.example=acme")
+	withTemplateStore(t, newMemoryTemplateBackend())
+	withThemes(t, "").packs["acme"] = &themePack{Tenant: "acme", FooterText: "ACME Corp"}
+	withProvisioning(t, "")
+	previousKeys, previousSigning := apiKeys, requestSigning
+	t.Cleanup(func() { apiKeys, requestSigning = previousKeys, previousSigning })
+	apiKeys, requestSigning = nil, nil
+
+	for _, tmpl := range []*storedTemplate{
+		{Name: "invoice", Text: "Invoice {{.Theme.FooterText}}"},
+		{Name: "acme~invoice", Text: "ACME invoice {{.Theme.FooterText}}"},
+	} {
+		if err := templateStore.put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := echo.New()
+	e.Use(tenantHostMiddleware)
+	e.POST("/v1/api/render/raw", renderTemplateRaw, apiKeyAuthMiddleware)
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"docs.acme.example", "ACME invoice ACME Corp"},
+		{"templates.internal", "Invoice <no value>"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/render/raw", strings.NewReader(`{"templateName": "invoice"}`))
+		req.Host = tt.host
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+			t.Errorf("%s: got %d %q, want %q", tt.host, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	// Pinned versions and names already carrying the prefix are left alone
+	ctx := withRenderCaller(context.Background(), renderCaller{Tenant: "acme"})
+	for _, req := range []renderRequest{
+		{TemplateName: "invoice", TemplateVersion: 1},
+		{TemplateName: "acme~invoice"},
+		{Text: "inline"},
+	} {
+		if resolved, err := resolveTenantTemplate(ctx, req); err != nil || resolved.TemplateName != req.TemplateName {
+			t.Errorf("resolveTenantTemplate(%+v) = %q, %v", req, resolved.TemplateName, err)
+		}
+	}
+}
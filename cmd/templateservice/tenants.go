@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// Stored templates belong to the tenant that created them. Callers with a
+// tenant (from a provisioned key, a bearer token claim or a white-label host)
+// see and render their own templates and the shared ones, created by callers
+// without a tenant; other tenants' templates do not exist for them. Tenants
+// name their templates "<tenant>~<name>", so rendering "<name>" picks their
+// own variant over a shared template (see tenanthosts.go). Neither tenant
+// IDs nor template names may contain the separator, so the owner of a name
+// is never ambiguous: tenant "acme" cannot claim a name of tenant "acme-corp".
+
+// tenantTemplateSeparator joins a tenant and a template name in the names of
+// tenant-owned templates
+const tenantTemplateSeparator = "~"
+
+// tenantTemplateName returns the name of tenant's own template called name
+func tenantTemplateName(tenant, name string) string {
+	return tenant + tenantTemplateSeparator + name
+}
+
+// tenantOfTemplateName returns the tenant a template name belongs to, "" for
+// shared names
+func tenantOfTemplateName(name string) string {
+	tenant, _, ok := strings.Cut(name, tenantTemplateSeparator)
+	if !ok {
+		return ""
+	}
+	return tenant
+}
+
+// tenantMaxTemplates caps the stored templates of each tenant (0 = unlimited)
+var tenantMaxTemplates int
+
+// configureTenants reads TEMPLATE_TENANT_MAX_TEMPLATES
+func configureTenants() error {
+	tenantMaxTemplates = envInt("TEMPLATE_TENANT_MAX_TEMPLATES", 0)
+	if tenantMaxTemplates < 0 {
+		return fmt.Errorf("TEMPLATE_TENANT_MAX_TEMPLATES must not be negative, got %d", tenantMaxTemplates)
+	}
+	if tenantMaxTemplates > 0 {
+		logger.Infof("Tenants may store up to %d templates each", tenantMaxTemplates)
+	}
+	return nil
+}
+
+// tenantVisible reports whether a template owned by owner exists for a
+// caller of tenant. Callers without a tenant see every template.
+func tenantVisible(tenant, owner string) bool {
+	return tenant == "" || owner == "" || owner == tenant
+}
+
+// tenantTemplateMiddleware confines the template routes of callers with a
+// tenant: other tenants' templates are answered 404, shared templates are
+// read-only, and new templates must be named "<tenant>~<name>"
+func tenantTemplateMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		tenant := renderCallerFrom(c.Request().Context()).Tenant
+		if tenant == "" {
+			return next(c)
+		}
+		name := c.Param("name")
+		current, err := templateStore.get(name)
+		if err != nil && !errors.Is(err, errTemplateNotFound) {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		if current != nil && !tenantVisible(tenant, current.Tenant) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+		}
+		if c.Request().Method == http.MethodGet {
+			return next(c)
+		}
+		if current != nil && current.Tenant == "" {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "shared templates cannot be changed by a tenant"})
+		}
+		if current == nil && tenantOfTemplateName(name) != tenant {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("templates of tenant %s must be named %s", tenant, tenantTemplateName(tenant, "<name>"))})
+		}
+		return next(c)
+	}
+}
+
+// checkTenantQuota rejects a new template of a tenant that already stores
+// tenantMaxTemplates templates
+func checkTenantQuota(ctx context.Context) error {
+	tenant := renderCallerFrom(ctx).Tenant
+	if tenant == "" || tenantMaxTemplates == 0 {
+		return nil
+	}
+	list, err := templateStore.list()
+	if err != nil {
+		return err
+	}
+	owned := 0
+	for _, tmpl := range list {
+		if tmpl.Tenant == tenant {
+			owned++
+		}
+	}
+	if owned >= tenantMaxTemplates {
+		return &render.Error{Message: fmt.Sprintf("tenant %s has reached its quota of %d templates", tenant, tenantMaxTemplates), Status: http.StatusForbidden}
+	}
+	return nil
+}
+
+// authorizeTemplateTenant hides the stored templates of other tenants from
+// renders, as if they did not exist
+func authorizeTemplateTenant(ctx context.Context, req renderRequest) error {
+	if tenantVisible(renderCallerFrom(ctx).Tenant, req.OwnerTenant) {
+		return nil
+	}
+	return &render.Error{Message: fmt.Sprintf("template %q not found", req.TemplateName), Status: http.StatusNotFound}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// tenantTemplateRoutes serves the template routes to callers of the tenant
+// given in X-Tenant and returns a function calling them
+func tenantTemplateRoutes() func(method, target, tenant, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	withTenant := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(withRenderCaller(req.Context(), renderCaller{Tenant: req.Header.Get("X-Tenant")})))
+			return next(c)
+		}
+	}
+	e.GET("/templates", handleListTemplates, withTenant)
+	e.GET("/templates/:name", handleGetTemplate, withTenant, tenantTemplateMiddleware)
+	e.PUT("/templates/:name", handlePutTemplate, withTenant, tenantTemplateMiddleware)
+	return func(method, target, tenant, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Tenant", tenant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+}
+
+func TestTenantTemplates(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	previous := tenantMaxTemplates
+	tenantMaxTemplates = 2
+	t.Cleanup(func() { tenantMaxTemplates = previous })
+	if _, err := saveTemplate("invoice", &templateInput{Text: "shared"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveTemplate("globex~invoice", &templateInput{Text: "globex", tenant: "globex"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	call := tenantTemplateRoutes()
+	if rec := call(http.MethodGet, "/templates/globex~invoice", "acme", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of another tenant's template = %d; want 404", rec.Code)
+	}
+	if rec := call(http.MethodGet, "/templates/invoice", "acme", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET of a shared template = %d", rec.Code)
+	}
+	if rec := call(http.MethodPut, "/templates/invoice", "acme", `{"text": "mine"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT of a shared template = %d; want 403", rec.Code)
+	}
+	if rec := call(http.MethodPut, "/templates/letter", "acme", `{"text": "mine"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT outside the tenant's names = %d; want 403", rec.Code)
+	}
+	if rec := call(http.MethodPut, "/templates/globex~invoice", "acme", `{"text": "mine"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("PUT of another tenant's template = %d; want 404", rec.Code)
+	}
+	for _, name := range []string{"acme~invoice", "acme~letter"} {
+		if rec := call(http.MethodPut, "/templates/"+name, "acme", `{"text": "acme"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("PUT %s = %d %s", name, rec.Code, rec.Body)
+		}
+	}
+	if stored, _ := templateStore.get("acme~invoice"); stored.Tenant != "acme" {
+		t.Errorf("Expected the tenant to own its template, got %q", stored.Tenant)
+	}
+	if rec := call(http.MethodPut, "/templates/acme~memo", "acme", `{"text": "acme"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT over the quota = %d; want 403", rec.Code)
+	}
+	if rec := call(http.MethodPut, "/templates/acme~invoice", "acme", `{"text": "updated"}`); rec.Code != http.StatusOK {
+		t.Errorf("Updates within the quota = %d", rec.Code)
+	}
+
+	listed := func(tenant string) []string {
+		var listing struct {
+			Templates []storedTemplate `json:"templates"`
+		}
+		_ = json.Unmarshal(call(http.MethodGet, "/templates", tenant, "").Body.Bytes(), &listing)
+		var names []string
+		for _, tmpl := range listing.Templates {
+			names = append(names, tmpl.Name)
+		}
+		return names
+	}
+	if names := strings.Join(listed("acme"), ","); names != "acme~invoice,acme~letter,invoice" {
+		t.Errorf("acme lists %s", names)
+	}
+	if names := strings.Join(listed(""), ","); names != "acme~invoice,acme~letter,globex~invoice,invoice" {
+		t.Errorf("Callers without a tenant list %s", names)
+	}
+
+	renderAs := func(tenant, name string) (*renderResult, error) {
+		return renderTemplate(withRenderCaller(context.Background(), renderCaller{Tenant: tenant}), renderRequest{TemplateName: name})
+	}
+	if result, err := renderAs("acme", "invoice"); err != nil || result.Output != "updated" {
+		t.Errorf("acme renders invoice as %v, %v; want its own variant", result, err)
+	}
+	if result, err := renderAs("initech", "invoice"); err != nil || result.Output != "shared" {
+		t.Errorf("initech renders invoice as %v, %v; want the shared template", result, err)
+	}
+	if _, err := renderAs("acme", "globex~invoice"); err == nil || err.(*render.Error).Status != http.StatusNotFound {
+		t.Errorf("Rendering another tenant's template = %v; want 404", err)
+	}
+}
+
+func TestTenantTemplates_PrefixTenants(t *testing.T) {
+	// Tenant IDs may contain dashes and prefix each other
+	withTemplateStore(t, newMemoryTemplateBackend())
+	if _, err := saveTemplate("invoice", &templateInput{Text: "shared"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	call := tenantTemplateRoutes()
+	for _, put := range []struct{ tenant, name, text string }{
+		{"acme", "acme~corp-invoice", "acme"},
+		{"acme-corp", "acme-corp~invoice", "acme-corp"},
+	} {
+		if rec := call(http.MethodPut, "/templates/"+put.name, put.tenant, `{"text": "`+put.text+`"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("%s: PUT %s = %d %s", put.tenant, put.name, rec.Code, rec.Body)
+		}
+	}
+	if rec := call(http.MethodPut, "/templates/acme-corp~memo", "acme", `{"text": "acme"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("acme claiming a name of acme-corp = %d; want 403", rec.Code)
+	}
+	if rec := call(http.MethodPut, "/templates/acme-corp-invoice", "acme", `{"text": "acme"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("acme creating a shared-looking name = %d; want 403", rec.Code)
+	}
+
+	renderAs := func(tenant, name string) (string, error) {
+		result, err := renderTemplate(withRenderCaller(context.Background(), renderCaller{Tenant: tenant}), renderRequest{TemplateName: name})
+		if err != nil {
+			return "", err
+		}
+		return result.Output, nil
+	}
+	for tenant, want := range map[string]string{"acme-corp": "acme-corp", "acme": "shared", "": "shared"} {
+		if output, err := renderAs(tenant, "invoice"); err != nil || output != want {
+			t.Errorf("%q renders invoice as %q, %v; want %q", tenant, output, err, want)
+		}
+	}
+	if output, err := renderAs("acme", "corp-invoice"); err != nil || output != "acme" {
+		t.Errorf("acme renders corp-invoice as %q, %v; want its own variant", output, err)
+	}
+
+	// Names carry their tenant also when created by a caller without one
+	if rec := call(http.MethodPut, "/templates/acme-corp~letter", "", `{"text": "admin"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT by an administrator = %d %s", rec.Code, rec.Body)
+	}
+	if stored, _ := templateStore.get("acme-corp~letter"); stored.Tenant != "acme-corp" {
+		t.Errorf("Owner of acme-corp~letter = %q; want acme-corp", stored.Tenant)
+	}
+	if rec := call(http.MethodGet, "/templates/acme-corp~letter", "acme", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of acme-corp's template by acme = %d; want 404", rec.Code)
+	}
+}
+
+func TestTemplateCacheKeyTenant(t *testing.T) {
+	req := renderRequest{Name: "inline", Text: "Hello"}
+	shared, _ := templateCacheKey(req)
+	req.Tenant = "acme"
+	acme, _ := templateCacheKey(req)
+	if shared == acme {
+		t.Error("Expected tenants not to share cached templates")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultThemeTenant names the theme pack used by callers whose tenant has
+// none of its own
+const defaultThemeTenant = "default"
+
+// tenantContextKey holds the tenant of an authenticated request
+const tenantContextKey = "tenant"
+
+// themePack is a tenant's branding, exposed to every template it renders as
+// .Theme (.Theme.Colors.primary, .Theme.Logos.header, .Theme.FooterText, ...)
+type themePack struct {
+	Tenant     string                 `json:"tenant"`
+	Colors     map[string]string      `json:"colors,omitempty"` // Name to CSS color
+	Logos      map[string]string      `json:"logos,omitempty"`  // Name to http(s) or data:image URL
+	FooterText string                 `json:"footerText,omitempty"`
+	Variables  map[string]interface{} `json:"variables,omitempty"` // Further branding values
+	Updated    time.Time              `json:"updated"`
+}
+
+// templateValue returns the pack as seen by templates
+func (p *themePack) templateValue() map[string]interface{} {
+	return map[string]interface{}{
+		"Tenant":     p.Tenant,
+		"Colors":     p.Colors,
+		"Logos":      p.Logos,
+		"FooterText": p.FooterText,
+		"Variables":  p.Variables,
+	}
+}
+
+// themeStore keeps the theme packs by tenant, in TEMPLATE_THEMES_FILE when set
+type themeStore struct {
+	file string
+
+	mu    sync.RWMutex
+	packs map[string]*themePack
+}
+
+var themes = newThemeStore("")
+
+func newThemeStore(file string) *themeStore {
+	return &themeStore{file: file, packs: make(map[string]*themePack)}
+}
+
+// configureThemes loads the theme packs persisted in TEMPLATE_THEMES_FILE
+func configureThemes() error {
+	store := newThemeStore(os.Getenv("TEMPLATE_THEMES_FILE"))
+	if store.file != "" {
+		if err := store.load(); err != nil {
+			return fmt.Errorf("TEMPLATE_THEMES_FILE: %w", err)
+		}
+		logger.Infof("Loaded %d theme packs from %s", len(store.packs), store.file)
+	}
+	themes = store
+	return nil
+}
+
+func (s *themeStore) load() error {
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var packs []*themePack
+	if err := json.Unmarshal(data, &packs); err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		s.packs[pack.Tenant] = pack
+	}
+	return nil
+}
+
+// save persists the store. The caller holds s.mu.
+func (s *themeStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.file, data)
+}
+
+func (s *themeStore) sorted() []*themePack {
+	packs := make([]*themePack, 0, len(s.packs))
+	for _, pack := range s.packs {
+		packs = append(packs, pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Tenant < packs[j].Tenant })
+	return packs
+}
+
+// forTenant returns the tenant's pack, or the default pack
+func (s *themeStore) forTenant(tenant string) *themePack {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if pack, ok := s.packs[tenant]; ok && tenant != "" {
+		return pack
+	}
+	return s.packs[defaultThemeTenant]
+}
+
+// applyTheme returns the parameters with the caller's theme pack set as
+// "Theme". The pack replaces a Theme parameter sent by the caller, so
+// branding cannot be overridden per request.
+func applyTheme(ctx context.Context, parameters map[string]interface{}) map[string]interface{} {
+	pack := themes.forTenant(renderCallerFrom(ctx).Tenant)
+	if pack == nil {
+		return parameters
+	}
+	themed := make(map[string]interface{}, len(parameters)+1)
+	for key, value := range parameters {
+		themed[key] = value
+	}
+	themed["Theme"] = pack.templateValue()
+	return themed
+}
+
+// validateThemePack checks the colors and logo URLs of a pack, which
+// templates typically place into style and src attributes
+func validateThemePack(pack *themePack) error {
+	for name, color := range pack.Colors {
+		if color == "" || strings.ContainsAny(color, ";{}<>\"'\\") {
+			return fmt.Errorf("invalid color %q for %s", color, name)
+		}
+	}
+	for name, logo := range pack.Logos {
+		u, err := url.Parse(logo)
+		if err != nil {
+			return fmt.Errorf("invalid logo URL for %s: %v", name, err)
+		}
+		switch {
+		case (u.Scheme == "https" || u.Scheme == "http") && u.Host != "":
+		case u.Scheme == "data" && strings.HasPrefix(u.Opaque, "image/"):
+		default:
+			return fmt.Errorf("logo %s must be an http(s) or data:image URL", name)
+		}
+	}
+	return nil
+}
+
+// handleListThemes handles GET /v1/api/themes
+func handleListThemes(c echo.Context) error {
+	themes.mu.RLock()
+	defer themes.mu.RUnlock()
+	return c.JSON(http.StatusOK, map[string]interface{}{"themes": themes.sorted()})
+}
+
+// handleGetTheme handles GET /v1/api/themes/:tenant
+func handleGetTheme(c echo.Context) error {
+	themes.mu.RLock()
+	defer themes.mu.RUnlock()
+	pack, ok := themes.packs[c.Param("tenant")]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "theme not found"})
+	}
+	return c.JSON(http.StatusOK, pack)
+}
+
+// handlePutTheme handles PUT /v1/api/themes/:tenant, creating or replacing
+// the tenant's pack ("default" for callers without a pack of their own)
+func handlePutTheme(c echo.Context) error {
+	tenant := c.Param("tenant")
+	if !templateNamePattern.MatchString(tenant) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid tenant"})
+	}
+	var pack themePack
+	if err := json.NewDecoder(c.Request().Body).Decode(&pack); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid theme: %v", err)})
+	}
+	if err := validateThemePack(&pack); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	pack.Tenant = tenant
+	pack.Updated = time.Now().UTC()
+
+	themes.mu.Lock()
+	defer themes.mu.Unlock()
+	previous, existed := themes.packs[tenant]
+	themes.packs[tenant] = &pack
+	if err := themes.save(); err != nil {
+		if existed {
+			themes.packs[tenant] = previous
+		} else {
+			delete(themes.packs, tenant)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	status := http.StatusOK
+	if !existed {
+		status = http.StatusCreated
+	}
+	return c.JSON(status, pack)
+}
+
+// handleDeleteTheme handles DELETE /v1/api/themes/:tenant
+func handleDeleteTheme(c echo.Context) error {
+	tenant := c.Param("tenant")
+	themes.mu.Lock()
+	defer themes.mu.Unlock()
+	pack, ok := themes.packs[tenant]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "theme not found"})
+	}
+	delete(themes.packs, tenant)
+	if err := themes.save(); err != nil {
+		themes.packs[tenant] = pack
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func withThemes(t *testing.T, file string) *themeStore {
+	t.Helper()
+	previous := themes
+	themes = newThemeStore(file)
+	t.Cleanup(func() { themes = previous })
+	return themes
+}
+
+func themesServer() *echo.Echo {
+	e := echo.New()
+	e.GET("/v1/api/themes", handleListThemes)
+	e.GET("/v1/api/themes/:tenant", handleGetTheme)
+	e.PUT("/v1/api/themes/:tenant", handlePutTheme)
+	e.DELETE("/v1/api/themes/:tenant", handleDeleteTheme)
+	return e
+}
+
+func themesCall(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestThemePacks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "themes.json")
+	withThemes(t, file)
+	e := themesServer()
+
+	if rec := themesCall(e, http.MethodPut, "/v1/api/themes/acme", `{"colors": {"primary": "#d00"}, "logos": {"header": "https://cdn.example.com/acme.png"}, "footerText": "ACME Corp"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Create theme = %d %s", rec.Code, rec.Body)
+	}
+	if rec := themesCall(e, http.MethodPut, "/v1/api/themes/default", `{"colors": {"primary": "#333"}, "footerText": "Shared"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Create default theme = %d %s", rec.Code, rec.Body)
+	}
+	if rec := themesCall(e, http.MethodPut, "/v1/api/themes/acme", `{"colors": {"primary": "#e00"}, "footerText": "ACME Corp"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 replacing a theme, got %d", rec.Code)
+	}
+
+	invalid := map[string]string{
+		"style injection": `{"colors": {"primary": "red; background: url(x)"}}`,
+		"script logo":     `{"logos": {"header": "javascript:alert(1)"}}`,
+		"relative logo":   `{"logos": {"header": "/logo.png"}}`,
+	}
+	for name, body := range invalid {
+		if rec := themesCall(e, http.MethodPut, "/v1/api/themes/acme", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+
+	const text = `{{.Theme.FooterText}} {{.Theme.Colors.primary}}`
+	tests := []struct {
+		tenant string
+		want   string
+	}{
+		{"acme", "ACME Corp #e00"},
+		{"globex", "Shared #333"},
+		{"", "Shared #333"},
+	}
+	for _, tt := range tests {
+		ctx := withRenderCaller(context.Background(), renderCaller{Tenant: tt.tenant})
+		result, err := renderTemplate(ctx, renderRequest{Text: text, Parameters: map[string]interface{}{"Theme": "spoofed"}})
+		if err != nil || result.Output != tt.want {
+			t.Errorf("tenant %q: renderTemplate() = %v, %v; want %q", tt.tenant, result, err, tt.want)
+		}
+	}
+
+	// Reloading the file keeps the packs
+	reloaded := newThemeStore(file)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if pack := reloaded.forTenant("acme"); pack == nil || pack.Colors["primary"] != "#e00" {
+		t.Errorf("Expected the acme theme to survive a reload, got %+v", pack)
+	}
+
+	if rec := themesCall(e, http.MethodDelete, "/v1/api/themes/default", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Delete theme = %d", rec.Code)
+	}
+	if rec := themesCall(e, http.MethodGet, "/v1/api/themes/default", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", rec.Code)
+	}
+	result, err := renderTemplate(context.Background(), renderRequest{Text: `{{.Theme}}`, Parameters: map[string]interface{}{"Theme": "own"}})
+	if err != nil || result.Output != "own" {
+		t.Errorf("Expected parameters untouched without a theme, got %v, %v", result, err)
+	}
+}
+
+func TestProvisionedKeyTenant(t *testing.T) {
+	store := withProvisioning(t, "")
+	store.keys["tsk_abcd"] = &provisionedKey{ID: "tsk_abcd", Roles: []keyRole{{Namespace: "acme", Role: roleViewer}, {Namespace: "shared", Role: roleViewer}}}
+	if tenant := store.tenant("tsk_abcd"); tenant != "acme" {
+		t.Errorf("tenant() = %q, want acme", tenant)
+	}
+	if tenant := store.tenant("tsk_none"); tenant != "" {
+		t.Errorf("tenant() of an unknown key = %q", tenant)
+	}
+}
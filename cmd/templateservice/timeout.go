@@ -0,0 +1,20 @@
+package main
+
+import (
+	"time"
+
+	"templateservice/pkg/render"
+)
+
+// renderTimeout bounds a single template execution (0 disables the limit)
+var renderTimeout = 30 * time.Second
+
+// configureRenderTimeout reads the execution timeout from the environment
+func configureRenderTimeout() {
+	renderTimeout = envDuration("TEMPLATE_RENDER_TIMEOUT", 30*time.Second)
+}
+
+// renderLimits are the configured limits of a template execution
+func renderLimits() render.Limits {
+	return render.Limits{Timeout: renderTimeout, MaxOutputBytes: maxOutputBytes}
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// Resumable upload headers (modelled on the tus protocol)
+const (
+	headerUploadOffset = "Upload-Offset"
+	headerUploadLength = "Upload-Length"
+)
+
+// uploadRefPrefix marks template identifiers that refer to a completed upload
+const uploadRefPrefix = "upload:"
+
+var (
+	errUploadNotFound   = errors.New("upload not found")
+	errUploadIncomplete = errors.New("upload is not complete")
+	errUploadBusy       = errors.New("another chunk is being written to this upload")
+)
+
+// uploadManager stores large template and data files that clients send in
+// chunks. The bytes received so far are kept on disk, so an interrupted
+// upload resumes from the last persisted offset, also across restarts.
+type uploadManager struct {
+	dir       string
+	maxSize   int64
+	retention time.Duration
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// uploadInfo is the metadata journaled next to each upload
+type uploadInfo struct {
+	ID          string     `json:"id"`
+	Filename    string     `json:"filename,omitempty"`
+	Length      int64      `json:"length"`
+	Offset      int64      `json:"offset"`
+	Complete    bool       `json:"complete"`
+	Sha256      string     `json:"sha256,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Principal   string     `json:"principal,omitempty"` // Creator, the only caller who may use the upload
+	Tenant      string     `json:"tenant,omitempty"`    // Tenant of the creator (see tenants.go)
+}
+
+// visibleTo reports whether caller may read, extend, delete or render the
+// upload: uploads created by a principal belong to it, within its tenant
+func (info *uploadInfo) visibleTo(caller renderCaller) bool {
+	if info.Principal != "" && info.Principal != caller.Principal {
+		return false
+	}
+	return tenantVisible(caller.Tenant, info.Tenant)
+}
+
+var uploads *uploadManager
+
+// configureUploads creates the upload manager from the environment
+func configureUploads() error {
+	dir := os.Getenv("TEMPLATE_UPLOAD_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "templateservice-uploads")
+	}
+	m, err := newUploadManager(
+		dir,
+		int64(envInt("TEMPLATE_UPLOAD_MAX_MB", 1024))<<20,
+		envDuration("TEMPLATE_UPLOAD_RETENTION", 24*time.Hour),
+	)
+	if err != nil {
+		return err
+	}
+	uploads = m
+	return nil
+}
+
+// newUploadManager creates an upload manager rooted at dir
+func newUploadManager(dir string, maxSize int64, retention time.Duration) (*uploadManager, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &uploadManager{
+		dir:       dir,
+		maxSize:   maxSize,
+		retention: retention,
+		busy:      make(map[string]bool),
+	}, nil
+}
+
+func (m *uploadManager) dataPath(id string) string { return filepath.Join(m.dir, id+".bin") }
+func (m *uploadManager) infoPath(id string) string { return filepath.Join(m.dir, id+".json") }
+
+// create registers a new upload of length bytes owned by caller
+func (m *uploadManager) create(length int64, filename string, caller renderCaller) (*uploadInfo, error) {
+	info := &uploadInfo{
+		ID:        uuid.NewString(),
+		Length:    length,
+		CreatedAt: time.Now().UTC(),
+		Principal: caller.Principal,
+		Tenant:    caller.Tenant,
+	}
+	if filename != "" {
+		info.Filename = filepath.Base(filename)
+	}
+	if err := os.WriteFile(m.dataPath(info.ID), nil, 0o600); err != nil {
+		return nil, err
+	}
+	if err := m.save(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// get returns the state of an upload. The offset is taken from the data file
+// so bytes written before a crash are never requested again.
+func (m *uploadManager) get(id string) (*uploadInfo, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errUploadNotFound
+	}
+	raw, err := os.ReadFile(m.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info uploadInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(m.dataPath(id))
+	if err != nil {
+		return nil, err
+	}
+	info.Offset = stat.Size()
+	return &info, nil
+}
+
+// getFor returns the state of an upload caller may use. Uploads of other
+// callers are reported as not found.
+func (m *uploadManager) getFor(id string, caller renderCaller) (*uploadInfo, error) {
+	info, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !info.visibleTo(caller) {
+		return nil, errUploadNotFound
+	}
+	return info, nil
+}
+
+// save journals upload metadata
+func (m *uploadManager) save(info *uploadInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.infoPath(info.ID), data)
+}
+
+// writeChunk appends body at offset. A chunk cut short by a dropped
+// connection keeps the bytes that arrived; the client resumes from the
+// returned offset.
+func (m *uploadManager) writeChunk(id string, offset int64, body io.Reader) (*uploadInfo, error) {
+	m.mu.Lock()
+	if m.busy[id] {
+		m.mu.Unlock()
+		return nil, errUploadBusy
+	}
+	m.busy[id] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.busy, id)
+		m.mu.Unlock()
+	}()
+
+	info, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Complete || offset != info.Offset {
+		return info, &uploadOffsetError{Expected: info.Offset}
+	}
+
+	f, err := os.OpenFile(m.dataPath(id), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	remaining := info.Length - info.Offset
+	written, copyErr := io.Copy(f, io.LimitReader(body, remaining))
+	closeErr := f.Close()
+	info.Offset += written
+
+	if copyErr != nil {
+		return info, copyErr
+	}
+	if closeErr != nil {
+		return info, closeErr
+	}
+	if written == remaining {
+		// Anything beyond the declared length is a client error
+		if n, _ := body.Read(make([]byte, 1)); n > 0 {
+			return info, fmt.Errorf("chunk exceeds the declared upload length of %d bytes", info.Length)
+		}
+	}
+
+	if info.Offset == info.Length {
+		if err := m.complete(info); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+// complete checksums a fully received upload and marks it complete
+func (m *uploadManager) complete(info *uploadInfo) error {
+	f, err := os.Open(m.dataPath(info.ID))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	info.Complete = true
+	info.Sha256 = hex.EncodeToString(h.Sum(nil))
+	info.CompletedAt = &now
+	return m.save(info)
+}
+
+// remove deletes an upload
+func (m *uploadManager) remove(id string) error {
+	if _, err := m.get(id); err != nil {
+		return err
+	}
+	os.Remove(m.infoPath(id))
+	return os.Remove(m.dataPath(id))
+}
+
+// path returns the data file of a completed upload caller may use
+func (m *uploadManager) path(id string, caller renderCaller) (string, error) {
+	info, err := m.getFor(id, caller)
+	if err != nil {
+		return "", err
+	}
+	if !info.Complete {
+		return "", errUploadIncomplete
+	}
+	return m.dataPath(id), nil
+}
+
+// expire removes uploads older than the retention period
+func (m *uploadManager) expire() int {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list uploads")
+		return 0
+	}
+	expired := 0
+	cutoff := time.Now().Add(-m.retention)
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if id == entry.Name() {
+			continue
+		}
+		info, err := m.get(id)
+		if err != nil || info.CreatedAt.After(cutoff) {
+			continue
+		}
+		if err := m.remove(id); err == nil {
+			expired++
+		}
+	}
+	return expired
+}
+
+// runJanitor periodically removes expired uploads until stop is closed
+func (m *uploadManager) runJanitor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.expire()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// uploadOffsetError reports a chunk sent for the wrong offset
+type uploadOffsetError struct {
+	Expected int64
+}
+
+func (e *uploadOffsetError) Error() string {
+	return fmt.Sprintf("upload offset mismatch, expected %d", e.Expected)
+}
+
+// resolveUploadRef maps an "upload:<id>" identifier to the upload's data
+// file, if the caller in ctx created it. Other identifiers are returned
+// unchanged.
+func resolveUploadRef(ctx context.Context, identifier string) (string, error) {
+	if !strings.HasPrefix(identifier, uploadRefPrefix) {
+		return identifier, nil
+	}
+	if uploads == nil {
+		return "", &render.Error{Message: "uploads are not configured", Status: http.StatusBadRequest}
+	}
+	path, err := uploads.path(strings.TrimPrefix(identifier, uploadRefPrefix), renderCallerFrom(ctx))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errUploadNotFound) {
+			status = http.StatusNotFound
+		}
+		return "", &render.Error{Message: "failed to resolve upload", Status: status, Err: err}
+	}
+	return path, nil
+}
+
+// loadUploadedParameters reads template parameters from a completed JSON
+// upload, referenced by ID with or without the "upload:" prefix. Parameters
+// given in the request override uploaded ones.
+func loadUploadedParameters(ctx context.Context, ref string, overrides map[string]interface{}) (map[string]interface{}, error) {
+	path, err := resolveUploadRef(ctx, uploadRefPrefix+strings.TrimPrefix(ref, uploadRefPrefix))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &render.Error{Message: "failed to read uploaded parameters", Status: http.StatusInternalServerError, Err: err}
+	}
+	var parameters map[string]interface{}
+	if err := json.Unmarshal(data, &parameters); err != nil {
+		return nil, &render.Error{Message: "uploaded parameters must be a JSON object", Status: http.StatusBadRequest, Err: err}
+	}
+	for key, value := range overrides {
+		parameters[key] = value
+	}
+	return parameters, nil
+}
+
+// setUploadHeaders reports the upload position in the response headers
+func setUploadHeaders(c echo.Context, info *uploadInfo) {
+	c.Response().Header().Set(headerUploadOffset, strconv.FormatInt(info.Offset, 10))
+	c.Response().Header().Set(headerUploadLength, strconv.FormatInt(info.Length, 10))
+	c.Response().Header().Set("Cache-Control", "no-store")
+}
+
+// handleCreateUpload handles POST /v1/api/uploads. The total size is given in
+// the Upload-Length header or as "length" in a JSON body.
+func handleCreateUpload(c echo.Context) error {
+	var req struct {
+		Length   int64  `json:"length"`
+		Filename string `json:"filename"`
+	}
+	if header := c.Request().Header.Get(headerUploadLength); header != "" {
+		n, err := strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid Upload-Length"})
+		}
+		req.Length = n
+		req.Filename = c.QueryParam("filename")
+	} else if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+
+	if req.Length <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "upload length must be positive"})
+	}
+	if uploads.maxSize > 0 && req.Length > uploads.maxSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("uploads are limited to %d bytes", uploads.maxSize)})
+	}
+
+	info, err := uploads.create(req.Length, req.Filename, renderCallerFrom(c.Request().Context()))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	setUploadHeaders(c, info)
+	c.Response().Header().Set(echo.HeaderLocation, "/v1/api/uploads/"+info.ID)
+	return c.JSON(http.StatusCreated, info)
+}
+
+// handleUploadStatus handles HEAD and GET /v1/api/uploads/:id
+func handleUploadStatus(c echo.Context) error {
+	info, err := uploads.getFor(c.Param("id"), renderCallerFrom(c.Request().Context()))
+	if errors.Is(err, errUploadNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	setUploadHeaders(c, info)
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(http.StatusOK)
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+// handleUploadChunk handles PATCH /v1/api/uploads/:id. The Upload-Offset
+// header must match the number of bytes already received.
+func handleUploadChunk(c echo.Context) error {
+	offset, err := strconv.ParseInt(c.Request().Header.Get(headerUploadOffset), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Upload-Offset header is required"})
+	}
+	if _, err := uploads.getFor(c.Param("id"), renderCallerFrom(c.Request().Context())); errors.Is(err, errUploadNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+
+	info, err := uploads.writeChunk(c.Param("id"), offset, c.Request().Body)
+	var offsetErr *uploadOffsetError
+	switch {
+	case errors.Is(err, errUploadNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errUploadBusy):
+		return c.JSON(http.StatusLocked, map[string]string{"error": err.Error()})
+	case errors.As(err, &offsetErr):
+		setUploadHeaders(c, info)
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil && info != nil:
+		// Bytes received before the failure are kept for resumption
+		setUploadHeaders(c, info)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	setUploadHeaders(c, info)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// handleDeleteUpload handles DELETE /v1/api/uploads/:id
+func handleDeleteUpload(c echo.Context) error {
+	_, err := uploads.getFor(c.Param("id"), renderCallerFrom(c.Request().Context()))
+	if err == nil {
+		err = uploads.remove(c.Param("id"))
+	}
+	if errors.Is(err, errUploadNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
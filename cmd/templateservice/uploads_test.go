@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// failingReader returns data and then a transport error, like a dropped connection
+type failingReader struct {
+	data string
+	done bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, errors.New("connection reset")
+	}
+	r.done = true
+	return copy(p, r.data), nil
+}
+
+func TestUploadManager_ResumesInterruptedChunk(t *testing.T) {
+	m, err := newUploadManager(t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("newUploadManager() returned error: %v", err)
+	}
+
+	content := `{"Name": "Alice", "City": "Berlin"}`
+	info, err := m.create(int64(len(content)), "params.json", renderCaller{})
+	if err != nil {
+		t.Fatalf("create() returned error: %v", err)
+	}
+
+	// First chunk is cut off after 10 bytes
+	got, err := m.writeChunk(info.ID, 0, &failingReader{data: content[:10]})
+	if err == nil || got.Offset != 10 {
+		t.Fatalf("Expected interrupted chunk at offset 10, got %+v, %v", got, err)
+	}
+
+	// A chunk for a stale offset is rejected
+	var offsetErr *uploadOffsetError
+	if _, err := m.writeChunk(info.ID, 0, strings.NewReader(content)); !errors.As(err, &offsetErr) || offsetErr.Expected != 10 {
+		t.Errorf("Expected offset mismatch at 10, got %v", err)
+	}
+
+	if _, err := m.path(info.ID, renderCaller{}); !errors.Is(err, errUploadIncomplete) {
+		t.Errorf("Expected incomplete upload, got %v", err)
+	}
+
+	got, err = m.writeChunk(info.ID, 10, strings.NewReader(content[10:]))
+	if err != nil || !got.Complete || got.Sha256 == "" {
+		t.Fatalf("Expected completed upload, got %+v, %v", got, err)
+	}
+
+	if _, err := m.writeChunk(info.ID, got.Offset, strings.NewReader("more")); err == nil {
+		t.Error("Writing to a completed upload should fail")
+	}
+}
+
+func TestUploadManager_RejectsOversizedChunk(t *testing.T) {
+	m, _ := newUploadManager(t.TempDir(), 1<<20, time.Hour)
+	info, _ := m.create(3, "", renderCaller{})
+
+	if _, err := m.writeChunk(info.ID, 0, strings.NewReader("abcdef")); err == nil {
+		t.Error("Expected error for chunk exceeding the declared length")
+	}
+}
+
+func TestRenderTemplate_FromUploads(t *testing.T) {
+	previous := uploads
+	m, _ := newUploadManager(t.TempDir(), 1<<20, time.Hour)
+	uploads = m
+	defer func() { uploads = previous }()
+
+	upload := func(content string) string {
+		info, _ := m.create(int64(len(content)), "", renderCaller{})
+		if _, err := m.writeChunk(info.ID, 0, io.NopCloser(strings.NewReader(content))); err != nil {
+			t.Fatalf("writeChunk() returned error: %v", err)
+		}
+		return info.ID
+	}
+	templateID := upload("Hello {{.Name}} from {{.City}}")
+	paramsID := upload(`{"Name": "Alice", "City": "Berlin"}`)
+
+	result, err := renderTemplate(context.Background(), renderRequestFrom(TemplateRequest{
+		Identifier:         uploadRefPrefix + templateID,
+		ParametersUpload:   paramsID,
+		TemplateParameters: map[string]interface{}{"City": "Paris"},
+	}))
+	if err != nil {
+		t.Fatalf("renderTemplate() returned error: %v", err)
+	}
+	if result.Output != "Hello Alice from Paris" {
+		t.Errorf("Unexpected output %q", result.Output)
+	}
+}
+
+func TestUploads_OwnedByCreator(t *testing.T) {
+	previous := uploads
+	m, _ := newUploadManager(t.TempDir(), 1<<20, time.Hour)
+	uploads = m
+	defer func() { uploads = previous }()
+
+	owner := renderCaller{Principal: "tsk_acme", Tenant: "acme"}
+	info, _ := m.create(int64(len("Hello")), "", owner)
+	if _, err := m.writeChunk(info.ID, 0, strings.NewReader("Hel")); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	withCaller := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			caller := renderCaller{Principal: req.Header.Get("X-Principal"), Tenant: req.Header.Get("X-Tenant")}
+			c.SetRequest(req.WithContext(withRenderCaller(req.Context(), caller)))
+			return next(c)
+		}
+	}
+	e.GET("/uploads/:id", handleUploadStatus, withCaller)
+	e.PATCH("/uploads/:id", handleUploadChunk, withCaller)
+	e.DELETE("/uploads/:id", handleDeleteUpload, withCaller)
+	call := func(method, body string, caller renderCaller) int {
+		req := httptest.NewRequest(method, "/uploads/"+info.ID, strings.NewReader(body))
+		req.Header.Set(headerUploadOffset, "3")
+		req.Header.Set("X-Principal", caller.Principal)
+		req.Header.Set("X-Tenant", caller.Tenant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, other := range []renderCaller{{Principal: "tsk_globex", Tenant: "globex"}, {Principal: "tsk_acme", Tenant: "globex"}, {}} {
+		for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+			if code := call(method, "lo", other); code != http.StatusNotFound {
+				t.Errorf("%s by %+v: expected 404, got %d", method, other, code)
+			}
+		}
+	}
+	if code := call(http.MethodPatch, "lo", owner); code != http.StatusNoContent {
+		t.Fatalf("Expected the creator to complete the upload, got %d", code)
+	}
+
+	ref := renderRequest{Identifier: uploadRefPrefix + info.ID}
+	if result, err := renderTemplate(withRenderCaller(context.Background(), owner), ref); err != nil || result.Output != "Hello" {
+		t.Errorf("Render of an own upload = %v, %v", result, err)
+	}
+	_, err := renderTemplate(withRenderCaller(context.Background(), renderCaller{Principal: "tsk_globex", Tenant: "globex"}), ref)
+	if re, ok := err.(*render.Error); !ok || re.Status != http.StatusNotFound {
+		t.Errorf("Expected 404 rendering another caller's upload, got %v", err)
+	}
+	if code := call(http.MethodDelete, "", owner); code != http.StatusNoContent {
+		t.Errorf("Expected the creator to delete the upload, got %d", code)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// Usage metering: every render of an authenticated consumer counts towards
+// its daily and monthly usage, as the tenant of the request when it has one
+// (so all keys of a tenant share their usage), otherwise as its principal.
+// Quotas cap renders and rendered bytes per UTC day and month, and the bytes
+// a tenant keeps in the template store. A consumer over a daily quota is
+// answered 429 until the next day; over a monthly or storage quota, 402.
+
+// Quota names of TEMPLATE_QUOTAS
+const (
+	quotaDailyRenders   = "dailyRenders"
+	quotaMonthlyRenders = "monthlyRenders"
+	quotaDailyBytes     = "dailyBytes"
+	quotaMonthlyBytes   = "monthlyBytes"
+	quotaStorageBytes   = "storageBytes"
+)
+
+// quotaNames lists the quotas in the order they are checked: a consumer out
+// of its monthly quota is not told to retry the next day
+var quotaNames = []string{quotaMonthlyRenders, quotaMonthlyBytes, quotaDailyRenders, quotaDailyBytes, quotaStorageBytes}
+
+// quotaLimits are limits by quota name; absent or 0 is unlimited
+type quotaLimits map[string]int64
+
+// usageCounters are the renders and rendered bytes of one period
+type usageCounters struct {
+	Renders int64 `json:"renders"`
+	Bytes   int64 `json:"bytes"` // Rendered output
+}
+
+// consumerUsage is the usage of a consumer in the current day and month
+type consumerUsage struct {
+	day, month     string // "2006-01-02" and "2006-01" in UTC
+	daily, monthly usageCounters
+}
+
+// usageMeter counts usage and holds the configured quotas
+type usageMeter struct {
+	defaults  quotaLimits
+	overrides map[string]quotaLimits // By tenant or principal; merged over defaults
+	now       func() time.Time
+
+	mu        sync.Mutex
+	consumers map[string]*consumerUsage
+}
+
+// usage meters every authenticated consumer; quotas are optional
+var usage = newUsageMeter(nil, nil)
+
+func newUsageMeter(defaults quotaLimits, overrides map[string]quotaLimits) *usageMeter {
+	return &usageMeter{
+		defaults:  defaults,
+		overrides: overrides,
+		now:       time.Now,
+		consumers: make(map[string]*consumerUsage),
+	}
+}
+
+// configureUsageQuotas reads TEMPLATE_QUOTAS, comma-separated
+// [consumer/]quota=limit entries. Entries without a consumer are the
+// defaults of every consumer; those with a tenant or principal override them
+// for that consumer, where a limit of 0 exempts it.
+func configureUsageQuotas() error {
+	defaults := quotaLimits{}
+	overrides := make(map[string]quotaLimits)
+	for _, entry := range envList("TEMPLATE_QUOTAS") {
+		name, value, ok := strings.Cut(entry, "=")
+		consumer, quota, scoped := strings.Cut(name, "/")
+		if !scoped {
+			consumer, quota = "", name
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if !ok || err != nil || limit < 0 || !isQuotaName(quota) || (scoped && consumer == "") {
+			return fmt.Errorf("TEMPLATE_QUOTAS: expected [consumer/]quota=limit with quota one of %s, got %q", strings.Join(quotaNames, ", "), entry)
+		}
+		if !scoped {
+			defaults[quota] = limit
+			continue
+		}
+		if overrides[consumer] == nil {
+			overrides[consumer] = quotaLimits{}
+		}
+		overrides[consumer][quota] = limit
+	}
+	usage = newUsageMeter(defaults, overrides)
+	if len(defaults) > 0 || len(overrides) > 0 {
+		logger.Infof("Usage quotas enabled: %d defaults, %d consumer overrides", len(defaults), len(overrides))
+	}
+	return nil
+}
+
+func isQuotaName(name string) bool {
+	for _, quota := range quotaNames {
+		if name == quota {
+			return true
+		}
+	}
+	return false
+}
+
+// usageConsumer identifies the consumer of a caller like rate limits do;
+// callers of unauthenticated deployments are not metered
+func usageConsumer(caller renderCaller) (string, bool) {
+	switch {
+	case caller.Tenant != "":
+		return "tenant:" + caller.Tenant, true
+	case caller.Principal != "":
+		return "principal:" + caller.Principal, true
+	}
+	return "", false
+}
+
+// limitsFor returns the quotas of a caller: the defaults, overridden by
+// those of its tenant, or else of its principal
+func (m *usageMeter) limitsFor(caller renderCaller) quotaLimits {
+	limits := make(quotaLimits, len(m.defaults))
+	for quota, limit := range m.defaults {
+		limits[quota] = limit
+	}
+	override, ok := m.overrides[caller.Tenant]
+	if !ok || caller.Tenant == "" {
+		override = m.overrides[caller.Principal]
+	}
+	for quota, limit := range override {
+		limits[quota] = limit
+	}
+	return limits
+}
+
+// current returns the consumer's usage, starting new counters when a day or
+// month has passed. The caller holds m.mu.
+func (m *usageMeter) current(consumer string, now time.Time) *consumerUsage {
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	u, ok := m.consumers[consumer]
+	if !ok {
+		u = &consumerUsage{day: day, month: month}
+		m.consumers[consumer] = u
+	}
+	if u.day != day {
+		u.day, u.daily = day, usageCounters{}
+	}
+	if u.month != month {
+		u.month, u.monthly = month, usageCounters{}
+	}
+	return u
+}
+
+// observe counts a successful render towards the usage of its caller
+func (m *usageMeter) observe(ctx context.Context, result *renderResult, err error) {
+	consumer, ok := usageConsumer(renderCallerFrom(ctx))
+	if !ok || err != nil {
+		return
+	}
+	size := int64(len(result.Output))
+	if result.StreamedBytes > 0 {
+		size = result.StreamedBytes
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.current(consumer, m.now().UTC())
+	u.daily.Renders++
+	u.daily.Bytes += size
+	u.monthly.Renders++
+	u.monthly.Bytes += size
+}
+
+// quotaExceededError reports an exhausted quota and when it resets
+type quotaExceededError struct {
+	quota  string
+	limit  int64
+	resets time.Time // Zero for storage, which does not reset
+}
+
+func (e *quotaExceededError) Error() string {
+	if e.resets.IsZero() {
+		return fmt.Sprintf("%s quota of %d exceeded", e.quota, e.limit)
+	}
+	return fmt.Sprintf("%s quota of %d exceeded until %s", e.quota, e.limit, e.resets.Format(time.RFC3339))
+}
+
+// checkRender rejects a render of a consumer that has used up a render or
+// byte quota of the day (429) or month (402). The render that crosses a
+// byte quota completes; the next one is refused.
+func (m *usageMeter) checkRender(ctx context.Context) error {
+	caller := renderCallerFrom(ctx)
+	consumer, ok := usageConsumer(caller)
+	if !ok {
+		return nil
+	}
+	limits := m.limitsFor(caller)
+	if len(limits) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	now := m.now().UTC()
+	u := *m.current(consumer, now)
+	m.mu.Unlock()
+
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	for _, q := range []struct {
+		quota  string
+		used   int64
+		resets time.Time
+	}{
+		{quotaMonthlyRenders, u.monthly.Renders, nextMonth},
+		{quotaMonthlyBytes, u.monthly.Bytes, nextMonth},
+		{quotaDailyRenders, u.daily.Renders, tomorrow},
+		{quotaDailyBytes, u.daily.Bytes, tomorrow},
+	} {
+		if limit := limits[q.quota]; limit > 0 && q.used >= limit {
+			return quotaError(&quotaExceededError{quota: q.quota, limit: limit, resets: q.resets})
+		}
+	}
+	return nil
+}
+
+// checkStorage rejects storing a template of size bytes under name when the
+// tenant's templates would exceed its storage quota (402). The current
+// versions of its templates count; the one replaced by name does not.
+func (m *usageMeter) checkStorage(ctx context.Context, name string, size int64) error {
+	caller := renderCallerFrom(ctx)
+	limit := m.limitsFor(caller)[quotaStorageBytes]
+	if caller.Tenant == "" || limit == 0 {
+		return nil
+	}
+	stored, err := storedBytes(caller.Tenant, name)
+	if err != nil {
+		return err
+	}
+	if stored+size > limit {
+		return quotaError(&quotaExceededError{quota: quotaStorageBytes, limit: limit})
+	}
+	return nil
+}
+
+// quotaError wraps an exhausted quota as the error of a refused request
+func quotaError(exceeded *quotaExceededError) error {
+	status := http.StatusPaymentRequired
+	if exceeded.quota == quotaDailyRenders || exceeded.quota == quotaDailyBytes {
+		status = http.StatusTooManyRequests
+	}
+	return &render.Error{Message: "usage quota exceeded", Status: status, Err: exceeded}
+}
+
+// setQuotaRetryAfter sets Retry-After on the response to a request refused
+// by a quota that resets, and reports whether err is such a refusal
+func setQuotaRetryAfter(c echo.Context, err error) bool {
+	var exceeded *quotaExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+	if !exceeded.resets.IsZero() {
+		wait := time.Until(exceeded.resets)
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+	}
+	return true
+}
+
+// templateBytes is the stored size of a template: its text and partials
+func templateBytes(text string, partials map[string]string) int64 {
+	size := int64(len(text))
+	for name, partial := range partials {
+		size += int64(len(name) + len(partial))
+	}
+	return size
+}
+
+// storedBytes sums the sizes of the current versions of a tenant's stored
+// templates, except the template named except
+func storedBytes(tenant, except string) (int64, error) {
+	list, err := templateStore.list()
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, tmpl := range list {
+		if tmpl.Tenant == tenant && tmpl.Name != except {
+			size += templateBytes(tmpl.Text, tmpl.Partials)
+		}
+	}
+	return size, nil
+}
+
+// usageReport is the usage of a consumer and its quotas
+type usageReport struct {
+	Consumer     string        `json:"consumer"` // tenant:<name> or principal:<prefix>
+	Day          string        `json:"day"`
+	Month        string        `json:"month"`
+	Daily        usageCounters `json:"daily"`
+	Monthly      usageCounters `json:"monthly"`
+	StorageBytes int64         `json:"storageBytes,omitempty"` // Template store bytes of a tenant
+	Quotas       quotaLimits   `json:"quotas,omitempty"`
+}
+
+// report returns the usage of the consumer of caller
+func (m *usageMeter) report(caller renderCaller) (usageReport, error) {
+	consumer, _ := usageConsumer(caller)
+	m.mu.Lock()
+	u := *m.current(consumer, m.now().UTC())
+	m.mu.Unlock()
+
+	report := usageReport{Consumer: consumer, Day: u.day, Month: u.month, Daily: u.daily, Monthly: u.monthly}
+	for quota, limit := range m.limitsFor(caller) {
+		if limit > 0 {
+			if report.Quotas == nil {
+				report.Quotas = quotaLimits{}
+			}
+			report.Quotas[quota] = limit
+		}
+	}
+	if caller.Tenant != "" {
+		stored, err := storedBytes(caller.Tenant, "")
+		if err != nil {
+			return report, err
+		}
+		report.StorageBytes = stored
+	}
+	return report, nil
+}
+
+// handleGetUsage handles GET /v1/api/usage: the caller's usage in the
+// current day and month, and its quotas
+func handleGetUsage(c echo.Context) error {
+	caller := renderCallerFrom(c.Request().Context())
+	if _, ok := usageConsumer(caller); !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "usage is only metered for authenticated callers"})
+	}
+	report, err := usage.report(caller)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// handleListUsage handles GET /v1/api/usage/all: the usage of every metered
+// consumer, for administrators
+func handleListUsage(c echo.Context) error {
+	usage.mu.Lock()
+	consumers := make([]string, 0, len(usage.consumers))
+	for consumer := range usage.consumers {
+		consumers = append(consumers, consumer)
+	}
+	usage.mu.Unlock()
+	sort.Strings(consumers)
+
+	reports := make([]usageReport, 0, len(consumers))
+	for _, consumer := range consumers {
+		var caller renderCaller
+		if tenant, ok := strings.CutPrefix(consumer, "tenant:"); ok {
+			caller.Tenant = tenant
+		} else {
+			caller.Principal = strings.TrimPrefix(consumer, "principal:")
+		}
+		report, err := usage.report(caller)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		reports = append(reports, report)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"count": len(reports), "consumers": reports})
+}
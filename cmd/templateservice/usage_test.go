@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// withUsageQuotas meters renders against quotas for the duration of a test
+func withUsageQuotas(t *testing.T, quotas string) *usageMeter {
+	t.Helper()
+	previous := usage
+	t.Cleanup(func() { usage = previous })
+	t.Setenv("TEMPLATE_QUOTAS", quotas)
+	if err := configureUsageQuotas(); err != nil {
+		t.Fatal(err)
+	}
+	return usage
+}
+
+func TestConfigureUsageQuotas(t *testing.T) {
+	m := withUsageQuotas(t, "dailyRenders=100,monthlyBytes=1000,acme/dailyRenders=0,tsk_ci01/storageBytes=50")
+	if limits := m.limitsFor(renderCaller{Principal: "tsk_live"}); limits[quotaDailyRenders] != 100 || limits[quotaMonthlyBytes] != 1000 {
+		t.Errorf("Default limits = %v", limits)
+	}
+	if limits := m.limitsFor(renderCaller{Tenant: "acme", Principal: "tsk_ci01"}); limits[quotaDailyRenders] != 0 || limits[quotaStorageBytes] != 0 {
+		t.Errorf("Expected the tenant override to take precedence, got %v", limits)
+	}
+	if limits := m.limitsFor(renderCaller{Principal: "tsk_ci01"}); limits[quotaStorageBytes] != 50 || limits[quotaDailyRenders] != 100 {
+		t.Errorf("Principal limits = %v", limits)
+	}
+
+	for _, quotas := range []string{"dailyRenders", "hourlyRenders=5", "dailyRenders=-1", "/dailyRenders=5", "dailyBytes=1MB"} {
+		t.Setenv("TEMPLATE_QUOTAS", quotas)
+		if err := configureUsageQuotas(); err == nil {
+			t.Errorf("configureUsageQuotas() accepted %q", quotas)
+		}
+	}
+}
+
+func TestUsageQuotas(t *testing.T) {
+	m := withUsageQuotas(t, "dailyRenders=2,monthlyBytes=20")
+	now := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	ctx := withRenderCaller(context.Background(), renderCaller{Tenant: "acme", Principal: "tsk_acme"})
+	renderHello := func() error {
+		_, err := renderTemplate(ctx, renderRequest{Text: "Hello {{.name}}", Parameters: map[string]interface{}{"name": "Ada"}})
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := renderHello(); err != nil {
+			t.Fatalf("Render %d within the quota failed: %v", i, err)
+		}
+	}
+	var re *render.Error
+	var exceeded *quotaExceededError
+	if err := renderHello(); !errors.As(err, &re) || re.Status != http.StatusTooManyRequests || !errors.As(err, &exceeded) || exceeded.quota != quotaDailyRenders {
+		t.Fatalf("Render over the daily quota = %v; want 429", err)
+	}
+	if !exceeded.resets.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Daily quota resets at %s", exceeded.resets)
+	}
+
+	// Callers without a tenant or principal are not metered
+	if _, err := renderTemplate(context.Background(), renderRequest{Text: "Hello"}); err != nil {
+		t.Errorf("Unmetered render failed: %v", err)
+	}
+
+	// The next day starts a new month, resetting both counters
+	now = now.Add(2 * time.Hour)
+	if err := renderHello(); err != nil {
+		t.Fatalf("Render on the next day failed: %v", err)
+	}
+	report, _ := m.report(renderCaller{Tenant: "acme"})
+	if report.Daily.Renders != 1 || report.Monthly.Renders != 1 || report.Monthly.Bytes != 9 || report.Month != "2026-02" {
+		t.Errorf("Usage after the month changed = %+v", report)
+	}
+	if err := renderHello(); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(24 * time.Hour)
+	if err := renderHello(); err != nil {
+		t.Fatalf("Render crossing the byte quota failed: %v", err)
+	}
+	if err := renderHello(); !errors.As(err, &re) || re.Status != http.StatusPaymentRequired {
+		t.Errorf("Render over the monthly quota = %v; want 402", err)
+	}
+}
+
+func TestStorageQuota(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	withUsageQuotas(t, "acme/storageBytes=10")
+	if _, err := saveTemplate("acme-invoice", &templateInput{Text: "12345678", tenant: "acme"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.PUT("/templates/:name", handlePutTemplate, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(withRenderCaller(req.Context(), renderCaller{Tenant: req.Header.Get("X-Tenant")})))
+			return next(c)
+		}
+	})
+	put := func(name, tenant, text string) int {
+		req := httptest.NewRequest(http.MethodPut, "/templates/"+name, strings.NewReader(`{"text": "`+text+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Tenant", tenant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := put("acme-letter", "acme", "abc"); code != http.StatusPaymentRequired {
+		t.Errorf("PUT over the storage quota = %d; want 402", code)
+	}
+	if code := put("acme-invoice", "acme", "1234567890"); code != http.StatusOK {
+		t.Errorf("Replacing a template within the quota = %d", code)
+	}
+	if code := put("globex-letter", "globex", "abcdefghijklmnop"); code != http.StatusCreated {
+		t.Errorf("PUT of a tenant without a storage quota = %d", code)
+	}
+}
+
+func TestUsageEndpoints(t *testing.T) {
+	withTemplateStore(t, newMemoryTemplateBackend())
+	m := withUsageQuotas(t, "dailyRenders=1")
+	ctx := withRenderCaller(context.Background(), renderCaller{Principal: "tsk_live"})
+	if _, err := renderTemplate(ctx, renderRequest{Text: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	withCaller := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(withRenderCaller(req.Context(), renderCaller{Principal: req.Header.Get("X-API-Key")})))
+			return next(c)
+		}
+	}
+	e.GET("/usage", handleGetUsage, withCaller)
+	e.GET("/usage/all", handleListUsage, withCaller)
+	e.POST("/render/raw", renderTemplateRaw, withCaller)
+	call := func(method, target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(http.MethodGet, "/usage", "tsk_live", "")
+	var report usageReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /usage = %d %s", rec.Code, rec.Body)
+	}
+	if report.Consumer != "principal:tsk_live" || report.Daily != (usageCounters{Renders: 1, Bytes: 5}) || report.Quotas[quotaDailyRenders] != 1 {
+		t.Errorf("Unexpected usage %+v", report)
+	}
+	if rec := call(http.MethodGet, "/usage", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /usage without a consumer = %d; want 404", rec.Code)
+	}
+
+	rec = call(http.MethodPost, "/render/raw", "tsk_live", `{"template": "Hello"}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Render over the quota = %d with Retry-After %q; want 429", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	m.observe(withRenderCaller(context.Background(), renderCaller{Tenant: "acme"}), &renderResult{Output: "x"}, nil)
+	var listing struct {
+		Count     int           `json:"count"`
+		Consumers []usageReport `json:"consumers"`
+	}
+	_ = json.Unmarshal(call(http.MethodGet, "/usage/all", "", "").Body.Bytes(), &listing)
+	if listing.Count != 2 || listing.Consumers[0].Consumer != "principal:tsk_live" || listing.Consumers[1].Consumer != "tenant:acme" {
+		t.Errorf("Unexpected usage listing %+v", listing)
+	}
+}
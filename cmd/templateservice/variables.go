@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/labstack/echo/v4"
+
+	"templateservice/pkg/render"
+)
+
+// unknownScope marks a dot whose data path cannot be determined statically
+// (e.g. the result of a function call); fields relative to it are skipped
+const unknownScope = "?"
+
+// variablesResponse is the result of variable extraction
+type variablesResponse struct {
+	Variables []render.Variable `json:"variables"`
+	Missing   []string          `json:"missing,omitempty"` // Paths absent from the given parameters
+}
+
+// handleExtractVariables handles POST /v1/api/variables: it parses the
+// template without executing it and lists the parameters it references.
+// When parameters are given, the referenced paths they lack are reported.
+func handleExtractVariables(c echo.Context) error {
+	var req RenderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+	}
+	if req.Template == "" && req.TemplateID == "" && req.TemplateName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "template, templateId or templateName is required"})
+	}
+
+	variables, err := extractVariables(c.Request().Context(), renderRequest{
+		Name:            "template",
+		Text:            req.Template,
+		Identifier:      req.TemplateID,
+		TemplateName:    req.TemplateName,
+		TemplateVersion: req.TemplateVersion,
+		Delimiters:      req.Delimiters,
+		Partials:        req.Partials,
+		Layout:          req.Layout,
+		EncodingFormat:  req.EncodingFormat,
+		Engine:          req.Engine,
+	})
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+
+	response := variablesResponse{Variables: variables}
+	if req.Parameters != nil {
+		response.Missing = missingVariables(variables, req.Parameters)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleTemplateVariables handles GET /v1/api/templates/:name/variables
+func handleTemplateVariables(c echo.Context) error {
+	if ok, err := templateReadable(c, c.Param("name")); err != nil || !ok {
+		return templateAccessDenied(c, err)
+	}
+	variables, err := extractVariables(c.Request().Context(), renderRequest{TemplateName: c.Param("name")})
+	if err != nil {
+		return renderErrorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, variablesResponse{Variables: variables})
+}
+
+// extractVariables compiles the requested template and walks its parse tree
+func extractVariables(ctx context.Context, req renderRequest) ([]render.Variable, error) {
+	req, err := resolveTemplateSources(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeTemplateTenant(ctx, req); err != nil {
+		return nil, err
+	}
+	if err := authorizeTemplateCaller(ctx, req); err != nil {
+		return nil, err
+	}
+	// Missing-value rewriting only adds function calls, so the plain parse is walked
+	req.MissingValue = nil
+	if format, ok := officeFormatFor(req.EncodingFormat); ok {
+		return officeVariables(req, format)
+	}
+	return parsedVariables(req)
+}
+
+// parsedVariables lists the variables of a resolved request's template
+func parsedVariables(req renderRequest) ([]render.Variable, error) {
+	if req.Engine != render.GoEngine {
+		return engineVariables(req)
+	}
+	compiled, err := compileTemplate(req)
+	if err != nil {
+		return nil, withStage(err, stageParse)
+	}
+	tmpl := compiled.(*template.Template)
+
+	w := &variableWalker{tmpl: tmpl, found: make(map[string]*render.Variable)}
+	if tmpl.Tree != nil {
+		w.walkList(tmpl.Tree.Root, "", map[string]string{"$": ""})
+	}
+
+	variables := make([]render.Variable, 0, len(w.found))
+	for _, v := range w.found {
+		variables = append(variables, *v)
+	}
+	sortVariables(variables)
+	return variables, nil
+}
+
+// sortVariables orders variables by name
+func sortVariables(variables []render.Variable) {
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+}
+
+// missingVariables returns the referenced paths absent from parameters.
+// Only the outermost missing path is reported, and paths below ranged
+// collections are not checked.
+func missingVariables(variables []render.Variable, parameters map[string]interface{}) []string {
+	var missing []string
+	for _, v := range variables {
+		if strings.Contains(v.Name, "[]") {
+			continue
+		}
+		covered := false
+		for _, m := range missing {
+			if strings.HasPrefix(v.Name, m+".") {
+				covered = true
+				break
+			}
+		}
+		if !covered && !hasParameterPath(parameters, v.Name) {
+			missing = append(missing, v.Name)
+		}
+	}
+	return missing
+}
+
+// hasParameterPath reports whether a ".a.b" path resolves in parameters.
+// Non-map values (e.g. structs of methods) are assumed to resolve.
+func hasParameterPath(parameters map[string]interface{}, path string) bool {
+	var current interface{} = parameters
+	for _, key := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return true
+		}
+		if current, ok = m[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// variableWalker collects field references, tracking what dot and each
+// declared variable refer to as it descends into range, with and template
+type variableWalker struct {
+	tmpl  *template.Template
+	found map[string]*render.Variable
+	depth int
+}
+
+func (w *variableWalker) record(path string, iterated bool) {
+	if path == "" || strings.HasPrefix(path, unknownScope) {
+		return
+	}
+	v, ok := w.found[path]
+	if !ok {
+		v = &render.Variable{Name: path}
+		w.found[path] = v
+	}
+	v.Iterated = v.Iterated || iterated
+}
+
+func (w *variableWalker) walkList(list *parse.ListNode, dot string, vars map[string]string) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			path := w.walkPipe(n.Pipe, dot, vars)
+			for _, decl := range n.Pipe.Decl {
+				vars[decl.Ident[0]] = path
+			}
+		case *parse.IfNode:
+			w.walkPipe(n.Pipe, dot, vars)
+			w.walkList(n.List, dot, copyScope(vars))
+			w.walkList(n.ElseList, dot, copyScope(vars))
+		case *parse.WithNode:
+			path := w.walkPipe(n.Pipe, dot, vars)
+			scope := copyScope(vars)
+			for _, decl := range n.Pipe.Decl {
+				scope[decl.Ident[0]] = path
+			}
+			w.walkList(n.List, path, scope)
+			w.walkList(n.ElseList, dot, copyScope(vars))
+		case *parse.RangeNode:
+			path := w.walkPipe(n.Pipe, dot, vars)
+			w.record(path, true)
+			element := unknownScope
+			if path != unknownScope {
+				element = path + "[]"
+			}
+			scope := copyScope(vars)
+			switch len(n.Pipe.Decl) {
+			case 1:
+				scope[n.Pipe.Decl[0].Ident[0]] = element
+			case 2:
+				scope[n.Pipe.Decl[0].Ident[0]] = unknownScope
+				scope[n.Pipe.Decl[1].Ident[0]] = element
+			}
+			w.walkList(n.List, element, scope)
+			w.walkList(n.ElseList, dot, copyScope(vars))
+		case *parse.TemplateNode:
+			path := unknownScope
+			if n.Pipe != nil {
+				path = w.walkPipe(n.Pipe, dot, vars)
+			}
+			if t := w.tmpl.Lookup(n.Name); t != nil && t.Tree != nil && w.depth < render.MaxTemplateDepth {
+				w.depth++
+				w.walkList(t.Tree.Root, path, map[string]string{"$": path})
+				w.depth--
+			}
+		}
+	}
+}
+
+// walkPipe records the references of a pipeline and returns the path of
+// its value when it is a plain field reference, or unknownScope
+func (w *variableWalker) walkPipe(pipe *parse.PipeNode, dot string, vars map[string]string) string {
+	if pipe == nil {
+		return unknownScope
+	}
+	result := unknownScope
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			path := w.walkArg(arg, dot, vars)
+			if len(pipe.Cmds) == 1 && len(cmd.Args) == 1 {
+				result = path
+			}
+		}
+	}
+	return result
+}
+
+func (w *variableWalker) walkArg(node parse.Node, dot string, vars map[string]string) string {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return w.walkFields(dot, n.Ident)
+	case *parse.VariableNode:
+		base, ok := vars[n.Ident[0]]
+		if !ok {
+			return unknownScope
+		}
+		return w.walkFields(base, n.Ident[1:])
+	case *parse.ChainNode:
+		return w.walkFields(w.walkArg(n.Node, dot, vars), n.Field)
+	case *parse.PipeNode:
+		return w.walkPipe(n, dot, vars)
+	}
+	return unknownScope
+}
+
+// walkFields records base.f1, base.f1.f2, ... and returns the full path
+func (w *variableWalker) walkFields(base string, fields []string) string {
+	if base == unknownScope {
+		return unknownScope
+	}
+	path := base
+	for _, field := range fields {
+		path += "." + field
+	}
+	if len(fields) > 0 {
+		w.record(path, false)
+	}
+	return path
+}
+
+func copyScope(vars map[string]string) map[string]string {
+	scope := make(map[string]string, len(vars))
+	for k, v := range vars {
+		scope[k] = v
+	}
+	return scope
+}
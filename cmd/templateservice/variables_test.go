@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestExtractVariables(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{"fields", "{{.user.name}} {{.user.email | upper}}", []string{".user.email", ".user.name"}},
+		{"range", "{{range .items}}{{.title}}{{$.footer}}{{end}}", []string{".footer", ".items", ".items[].title"}},
+		{"range variables", "{{range $i, $item := .items}}{{$item.price}}{{end}}", []string{".items", ".items[].price"}},
+		{"with", "{{with .order}}{{.id}}{{else}}{{.fallback}}{{end}}", []string{".fallback", ".order", ".order.id"}},
+		{"declared variable", "{{$u := .user}}{{$u.name}}", []string{".user", ".user.name"}},
+		{"conditions and calls", `{{if and .enabled (eq .mode "x")}}{{printf "%s" .label}}{{end}}`, []string{".enabled", ".label", ".mode"}},
+		{"named template", `{{define "addr"}}{{.street}}{{end}}{{template "addr" .shipping}}`, []string{".shipping", ".shipping.street"}},
+		{"function result", "{{with index .rows 0}}{{.skipped}}{{end}}", []string{".rows"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variables, err := extractVariables(context.Background(), renderRequest{Text: tt.text})
+			if err != nil {
+				t.Fatalf("extractVariables() returned error: %v", err)
+			}
+			var names []string
+			for _, v := range variables {
+				names = append(names, v.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestHandleExtractVariablesMissing(t *testing.T) {
+	e := echo.New()
+	body := `{"template": "{{.user.name}} {{.user.email}} {{.title}} {{range .items}}{{.x}}{{end}}", "parameters": {"title": "T", "items": []}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/variables", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if err := handleExtractVariables(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handleExtractVariables() returned error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var response variablesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{".user.email", ".user.name"}; !reflect.DeepEqual(response.Missing, expected) {
+		t.Errorf("Expected missing %v, got %v", expected, response.Missing)
+	}
+	if !response.Variables[0].Iterated || response.Variables[0].Name != ".items" {
+		t.Errorf("Expected .items to be marked iterated, got %+v", response.Variables[0])
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// errWorkspaceQuota is returned when a write would exceed the workspace quota
+var errWorkspaceQuota = errors.New("workspace quota exceeded")
+
+// workspaceManager hands out per-job scratch directories for multi-step
+// pipelines (HTML→PDF, archive composition). Workspaces are removed when
+// released, and anything left behind by a crash is swept once it is older
+// than the retention period.
+type workspaceManager struct {
+	root      string
+	quota     int64
+	retention time.Duration
+
+	mu     sync.Mutex
+	active map[string]*workspace
+	stats  workspaceStats
+}
+
+// workspaceStats are cumulative workspace metrics
+type workspaceStats struct {
+	Active        int   `json:"active"`
+	BytesInUse    int64 `json:"bytesInUse"`
+	Created       int64 `json:"created"`
+	Released      int64 `json:"released"`
+	Swept         int64 `json:"swept"`
+	QuotaExceeded int64 `json:"quotaExceeded"`
+}
+
+// workspace is a scratch directory owned by a single job
+type workspace struct {
+	ID      string
+	Dir     string
+	Created time.Time
+
+	manager *workspaceManager
+	used    int64
+}
+
+var workspaces *workspaceManager
+
+// configureWorkspaces creates the workspace manager from the environment and
+// removes workspaces orphaned by a previous run
+func configureWorkspaces() error {
+	root := os.Getenv("TEMPLATE_WORKSPACE_DIR")
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "templateservice-work")
+	}
+
+	m, err := newWorkspaceManager(
+		root,
+		int64(envInt("TEMPLATE_WORKSPACE_QUOTA_MB", 256))<<20,
+		envDuration("TEMPLATE_WORKSPACE_RETENTION", time.Hour),
+	)
+	if err != nil {
+		return err
+	}
+	workspaces = m
+
+	if swept := m.sweep(0); swept > 0 {
+		logger.Infof("Removed %d orphaned workspaces from %s", swept, root)
+	}
+	return nil
+}
+
+// newWorkspaceManager creates a manager rooted at root
+func newWorkspaceManager(root string, quota int64, retention time.Duration) (*workspaceManager, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &workspaceManager{
+		root:      root,
+		quota:     quota,
+		retention: retention,
+		active:    make(map[string]*workspace),
+	}, nil
+}
+
+// create allocates a new workspace for a job
+func (m *workspaceManager) create(prefix string) (*workspace, error) {
+	id := prefix + "-" + uuid.NewString()
+	dir := filepath.Join(m.root, id)
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	ws := &workspace{ID: id, Dir: dir, Created: time.Now(), manager: m}
+
+	m.mu.Lock()
+	m.active[id] = ws
+	m.stats.Created++
+	m.mu.Unlock()
+
+	return ws, nil
+}
+
+// writeFile writes a file into the workspace, enforcing the size quota
+func (w *workspace) writeFile(name string, data []byte) (string, error) {
+	path, err := w.path(name)
+	if err != nil {
+		return "", err
+	}
+
+	m := w.manager
+	m.mu.Lock()
+	if m.quota > 0 && w.used+int64(len(data)) > m.quota {
+		m.stats.QuotaExceeded++
+		m.mu.Unlock()
+		return "", fmt.Errorf("%w: %d bytes allowed", errWorkspaceQuota, m.quota)
+	}
+	w.used += int64(len(data))
+	m.stats.BytesInUse += int64(len(data))
+	m.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// path resolves a file name inside the workspace, rejecting escapes
+func (w *workspace) path(name string) (string, error) {
+	path := filepath.Join(w.Dir, name)
+	if !strings.HasPrefix(path, w.Dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid workspace file name %q", name)
+	}
+	return path, nil
+}
+
+// release removes the workspace and everything in it
+func (w *workspace) release() {
+	m := w.manager
+	if err := os.RemoveAll(w.Dir); err != nil {
+		logger.WithError(err).Error("Failed to remove workspace " + w.ID)
+	}
+
+	m.mu.Lock()
+	if _, ok := m.active[w.ID]; ok {
+		delete(m.active, w.ID)
+		m.stats.Released++
+		m.stats.BytesInUse -= w.used
+	}
+	m.mu.Unlock()
+}
+
+// sweep removes directories under the root that are not active and older than maxAge.
+// A zero maxAge removes every inactive directory.
+func (m *workspaceManager) sweep(maxAge time.Duration) int {
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list workspaces")
+		return 0
+	}
+
+	swept := 0
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		m.mu.Lock()
+		_, active := m.active[entry.Name()]
+		m.mu.Unlock()
+		if active {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(m.root, entry.Name())); err == nil {
+			swept++
+		}
+	}
+
+	m.mu.Lock()
+	m.stats.Swept += int64(swept)
+	m.mu.Unlock()
+	return swept
+}
+
+// expire releases active workspaces that outlived the retention period
+// (e.g. a pipeline that hung) and sweeps untracked leftovers
+func (m *workspaceManager) expire() {
+	m.mu.Lock()
+	var expired []*workspace
+	for _, ws := range m.active {
+		if time.Since(ws.Created) > m.retention {
+			expired = append(expired, ws)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, ws := range expired {
+		ws.release()
+	}
+	m.sweep(m.retention)
+}
+
+// runJanitor periodically expires workspaces until stop is closed
+func (m *workspaceManager) runJanitor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.expire()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// snapshot returns the current workspace metrics
+func (m *workspaceManager) snapshot() workspaceStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.stats
+	stats.Active = len(m.active)
+	return stats
+}
+
+// handleWorkspaceStats serves GET /v1/api/workspaces/stats
+func handleWorkspaceStats(c echo.Context) error {
+	if workspaces == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "workspaces are not configured"})
+	}
+	return c.JSON(http.StatusOK, workspaces.snapshot())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWorkspace_QuotaAndRelease(t *testing.T) {
+	m, err := newWorkspaceManager(t.TempDir(), 10, time.Hour)
+	if err != nil {
+		t.Fatalf("newWorkspaceManager() returned error: %v", err)
+	}
+
+	ws, err := m.create("job")
+	if err != nil {
+		t.Fatalf("create() returned error: %v", err)
+	}
+
+	if _, err := ws.writeFile("page.html", []byte("12345678")); err != nil {
+		t.Fatalf("writeFile() returned error: %v", err)
+	}
+	if _, err := ws.writeFile("more.html", []byte("12345")); !errors.Is(err, errWorkspaceQuota) {
+		t.Errorf("Expected quota error, got %v", err)
+	}
+	if _, err := ws.writeFile("../escape.txt", []byte("x")); err == nil {
+		t.Error("writeFile() should reject paths outside the workspace")
+	}
+
+	ws.release()
+	if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+		t.Error("release() should remove the workspace directory")
+	}
+
+	stats := m.snapshot()
+	if stats.Active != 0 || stats.Created != 1 || stats.Released != 1 || stats.QuotaExceeded != 1 || stats.BytesInUse != 0 {
+		t.Errorf("Unexpected workspace stats: %+v", stats)
+	}
+}
+
+func TestWorkspace_SweepOrphans(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(root+"/orphan", 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := newWorkspaceManager(root, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("newWorkspaceManager() returned error: %v", err)
+	}
+	active, _ := m.create("job")
+
+	if swept := m.sweep(0); swept != 1 {
+		t.Errorf("Expected 1 orphan swept, got %d", swept)
+	}
+	if _, err := os.Stat(active.Dir); err != nil {
+		t.Error("sweep() must not remove active workspaces")
+	}
+}
@@ -0,0 +1,165 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+// addressFormat is the layout of addresses in a country. Layout lines use
+// %N name, %O organization, %A street lines, %Z postal code, %C city and
+// %S region; fields in Upper are upper-cased.
+type addressFormat struct {
+	Layout string
+	Upper  string
+}
+
+// defaultAddressFormat lays out addresses of countries without a built-in format
+var defaultAddressFormat = addressFormat{Layout: "%N\n%O\n%A\n%Z %C"}
+
+// addressFormats holds the built-in address layouts by ISO 3166 country
+var addressFormats = map[string]addressFormat{
+	"US": {Layout: "%N\n%O\n%A\n%C, %S %Z", Upper: "CS"},
+	"CA": {Layout: "%N\n%O\n%A\n%C %S %Z", Upper: "CS"},
+	"AU": {Layout: "%O\n%N\n%A\n%C %S %Z", Upper: "CS"},
+	"GB": {Layout: "%N\n%O\n%A\n%C\n%Z", Upper: "CZ"},
+	"IE": {Layout: "%N\n%O\n%A\n%C\n%S\n%Z", Upper: "Z"},
+	"FR": {Layout: "%O\n%N\n%A\n%Z %C", Upper: "C"},
+	"NL": {Layout: "%O\n%N\n%A\n%Z %C"},
+	"IT": {Layout: "%N\n%O\n%A\n%Z %C %S", Upper: "S"},
+	"ES": {Layout: "%N\n%O\n%A\n%Z %C %S"},
+	"BR": {Layout: "%O\n%N\n%A\n%C-%S\n%Z", Upper: "S"},
+	"IN": {Layout: "%N\n%O\n%A\n%C %Z\n%S"},
+	"JP": {Layout: "%N\n%O\n%A\n%C, %S\n%Z", Upper: "S"},
+	"CN": {Layout: "%N\n%O\n%A\n%C\n%S, %Z"},
+}
+
+// addressCountryNames are the English names of countries for the last
+// line of international mail; others are written as their code
+var addressCountryNames = map[string]string{
+	"AT": "Austria", "AU": "Australia", "BE": "Belgium", "BR": "Brazil", "CA": "Canada",
+	"CH": "Switzerland", "CN": "China", "DE": "Germany", "DK": "Denmark", "ES": "Spain",
+	"FR": "France", "GB": "United Kingdom", "IE": "Ireland", "IN": "India", "IT": "Italy",
+	"JP": "Japan", "LI": "Liechtenstein", "LU": "Luxembourg", "NL": "Netherlands", "NO": "Norway",
+	"PL": "Poland", "PT": "Portugal", "SE": "Sweden", "US": "United States",
+}
+
+// addressFields are the keys read for each layout field, schema.org
+// PostalAddress properties first
+var addressFields = map[byte][]string{
+	'N': {"name", "recipient"},
+	'O': {"organization", "company"},
+	'Z': {"postalCode", "zip", "postcode"},
+	'C': {"addressLocality", "city", "locality"},
+	'S': {"addressRegion", "region", "state", "province"},
+}
+
+// addressStreetFields are the keys of the street lines, each a string
+// (possibly with line breaks) or a list of lines
+var addressStreetFields = []string{"streetAddress", "street", "addressLine1", "addressLine2", "lines"}
+
+// formatAddress lays out a postal address (a map or struct with schema.org
+// PostalAddress or common field names) by the conventions of its country,
+// one line per row. The optional country the mail is sent from comes
+// first; addresses in another country end with the upper-cased country name:
+//
+//	{{formatAddress .ShipTo}}
+//	{{formatAddress "CH" .ShipTo}}
+func formatAddress(args ...interface{}) (string, error) {
+	origin := ""
+	switch len(args) {
+	case 1:
+	case 2:
+		code, ok := args[0].(string)
+		if !ok {
+			return "", fmt.Errorf("formatAddress: origin country must be a string, got %T", args[0])
+		}
+		origin = strings.ToUpper(code)
+	default:
+		return "", fmt.Errorf("formatAddress expects an optional origin country and an address")
+	}
+	address := args[len(args)-1]
+
+	country := strings.ToUpper(addressField(address, "addressCountry.name", "addressCountry", "country", "countryCode"))
+	format, ok := addressFormats[country]
+	if !ok {
+		format = defaultAddressFormat
+	}
+
+	var lines []string
+	for _, layoutLine := range strings.Split(format.Layout, "\n") {
+		var line strings.Builder
+		for i := 0; i < len(layoutLine); i++ {
+			if layoutLine[i] != '%' || i+1 == len(layoutLine) {
+				line.WriteByte(layoutLine[i])
+				continue
+			}
+			i++
+			field := layoutLine[i]
+			if field == 'A' {
+				line.WriteString(strings.Join(addressStreet(address), "\n"))
+				continue
+			}
+			value := addressField(address, addressFields[field]...)
+			if strings.IndexByte(format.Upper, field) >= 0 {
+				value = strings.ToUpper(value)
+			}
+			line.WriteString(value)
+		}
+		for _, l := range strings.Split(line.String(), "\n") {
+			if l = tidyAddressLine(l); l != "" {
+				lines = append(lines, l)
+			}
+		}
+	}
+
+	if country != "" && origin != "" && country != origin {
+		name, ok := addressCountryNames[country]
+		if !ok {
+			name = country
+		}
+		lines = append(lines, strings.ToUpper(name))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// addressField returns the first non-empty value of keys in address
+func addressField(address interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := LookupPath(address, key); ok && value != nil {
+			if s := strings.TrimSpace(fmt.Sprint(value)); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// addressStreet returns the street lines of address
+func addressStreet(address interface{}) []string {
+	var lines []string
+	for _, key := range addressStreetFields {
+		value, ok := LookupPath(address, key)
+		if !ok || value == nil {
+			continue
+		}
+		if s, isString := value.(string); isString {
+			lines = append(lines, strings.Split(s, "\n")...)
+			continue
+		}
+		if items, err := digestItems(value); err == nil {
+			for _, item := range items {
+				lines = append(lines, fmt.Sprint(item))
+			}
+			continue
+		}
+		lines = append(lines, fmt.Sprint(value))
+	}
+	return lines
+}
+
+// tidyAddressLine collapses the spaces and separators left by empty fields
+func tidyAddressLine(line string) string {
+	line = strings.Join(strings.Fields(line), " ")
+	line = strings.ReplaceAll(line, " ,", ",")
+	return strings.Trim(line, " ,-")
+}
@@ -0,0 +1,72 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFormatAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		address map[string]interface{}
+		want    string
+	}{
+		{
+			"US", "US",
+			map[string]interface{}{"name": "Jane Doe", "streetAddress": "1600 Amphitheatre Pkwy", "addressLocality": "Mountain View", "addressRegion": "ca", "postalCode": "94043", "addressCountry": "US"},
+			"Jane Doe\n1600 Amphitheatre Pkwy\nMOUNTAIN VIEW, CA 94043",
+		},
+		{
+			"DE from CH", "CH",
+			map[string]interface{}{"name": "Max Muster", "organization": "Muster GmbH", "street": "Hauptstr. 5\nHinterhaus", "postalCode": "10115", "city": "Berlin", "country": "de"},
+			"Max Muster\nMuster GmbH\nHauptstr. 5\nHinterhaus\n10115 Berlin\nGERMANY",
+		},
+		{
+			"GB", "",
+			map[string]interface{}{"name": "J. Smith", "lines": []interface{}{"Flat 2", "10 Downing St"}, "city": "London", "postalCode": "sw1a 2aa", "country": "GB"},
+			"J. Smith\nFlat 2\n10 Downing St\nLONDON\nSW1A 2AA",
+		},
+		{
+			"FR organization first", "",
+			map[string]interface{}{"name": "Marie Curie", "organization": "Institut", "streetAddress": "11 rue Pierre", "postalCode": "75005", "addressLocality": "Paris", "addressCountry": map[string]interface{}{"@type": "Country", "name": "FR"}},
+			"Institut\nMarie Curie\n11 rue Pierre\n75005 PARIS",
+		},
+		{
+			"US without region", "",
+			map[string]interface{}{"streetAddress": "1 Main St", "city": "Springfield", "zip": "12345", "country": "US"},
+			"1 Main St\nSPRINGFIELD, 12345",
+		},
+		{
+			"unknown country", "DE",
+			map[string]interface{}{"name": "A", "street": "B 1", "postalCode": "123", "city": "C", "country": "ZZ"},
+			"A\nB 1\n123 C\nZZ",
+		},
+	}
+	for _, tt := range tests {
+		args := []interface{}{tt.address}
+		if tt.origin != "" {
+			args = []interface{}{tt.origin, tt.address}
+		}
+		got, err := formatAddress(args...)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: formatAddress() = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := formatAddress(); err == nil {
+		t.Error("formatAddress() should require an address")
+	}
+}
+
+func TestFormatAddressTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{formatAddress "DE" .ShipTo | replace "\n" "<br>"}}`,
+		Parameters: map[string]interface{}{"ShipTo": map[string]interface{}{"name": "Anna", "street": "Bahnhofstr. 1", "postalCode": "8001", "city": "Zürich", "country": "CH"}},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if want := "Anna<br>Bahnhofstr. 1<br>8001 Zürich<br>SWITZERLAND"; output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
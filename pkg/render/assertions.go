@@ -0,0 +1,263 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Assertions are contract checks a caller attaches to a render request.
+// A render whose output violates any assertion fails with the list of violations.
+type Assertions struct {
+	Matches     []string               `json:"matches,omitempty"`     // Regular expressions the output must match
+	ValidJSON   bool                   `json:"validJson,omitempty"`   // Output must parse as JSON
+	ValidFormat bool                   `json:"validFormat,omitempty"` // Output must parse in its encodingFormat (JSON, YAML, SPARQL or SQL)
+	JSONSchema  map[string]interface{} `json:"jsonSchema,omitempty"`  // Output must be valid against this schema, parsed as YAML for YAML formats
+	MaxLength   int                    `json:"maxLength,omitempty"`   // Maximum output size in bytes
+
+	// Schemas of Kubernetes manifests by "apiVersion/kind" or kind, checked
+	// by validFormat for application/vnd.kubernetes+yaml (see kubernetes.go)
+	KubernetesSchemas map[string]map[string]interface{} `json:"kubernetesSchemas,omitempty"`
+}
+
+// Violation is a failed assertion, located in the output where possible
+type Violation struct {
+	Assertion string `json:"assertion"`        // matches, maxLength, validJson, validFormat, jsonSchema or kubernetesSchemas
+	Message   string `json:"message"`          // What is wrong
+	Path      string `json:"path,omitempty"`   // JSON path of a schema violation
+	Line      int    `json:"line,omitempty"`   // 1-based line of a parse error or manifest field
+	Column    int    `json:"column,omitempty"` // 1-based column of a parse error or manifest field
+}
+
+// String formats the violation as a single detail line
+func (v Violation) String() string {
+	switch {
+	case v.Line > 0 && v.Column > 0:
+		return fmt.Sprintf("line %d, column %d: %s", v.Line, v.Column, v.Message)
+	case v.Line > 0:
+		return fmt.Sprintf("line %d: %s", v.Line, v.Message)
+	case v.Path != "":
+		return v.Path + ": " + v.Message
+	}
+	return v.Message
+}
+
+// Output formats checked by the validFormat assertion
+const (
+	outputFormatJSON         = "json"
+	outputFormatYAML         = "yaml"
+	outputFormatSPARQLQuery  = "sparql-query"
+	outputFormatSPARQLUpdate = "sparql-update"
+	outputFormatSQL          = "sql"
+)
+
+// outputFormat classifies an encoding format as JSON, YAML, a SPARQL query
+// or update, SQL or none of them ("")
+func outputFormat(encodingFormat string) string {
+	mediaType, _, err := mime.ParseMediaType(encodingFormat)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return outputFormatJSON
+	case mediaType == "application/yaml" || mediaType == "application/x-yaml" ||
+		mediaType == "text/yaml" || strings.HasSuffix(mediaType, "+yaml"):
+		return outputFormatYAML
+	case mediaType == "application/sparql-query":
+		return outputFormatSPARQLQuery
+	case mediaType == "application/sparql-update":
+		return outputFormatSPARQLUpdate
+	case mediaType == "application/sql":
+		return outputFormatSQL
+	}
+	return ""
+}
+
+// CheckAssertions returns an *Error listing every failed assertion on
+// output rendered in encodingFormat
+func CheckAssertions(assertions *Assertions, encodingFormat, output string) error {
+	if assertions == nil {
+		return nil
+	}
+
+	var violations []Violation
+
+	for _, pattern := range assertions.Matches {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			violations = append(violations, Violation{Assertion: "matches", Message: fmt.Sprintf("invalid pattern %q: %v", pattern, err)})
+			continue
+		}
+		if !re.MatchString(output) {
+			violations = append(violations, Violation{Assertion: "matches", Message: fmt.Sprintf("output does not match %q", pattern)})
+		}
+	}
+
+	if assertions.MaxLength > 0 && len(output) > assertions.MaxLength {
+		violations = append(violations, Violation{Assertion: "maxLength", Message: fmt.Sprintf("output length %d exceeds maximum %d", len(output), assertions.MaxLength)})
+	}
+
+	format := outputFormat(encodingFormat)
+	if assertions.ValidFormat && format == "" {
+		violations = append(violations, Violation{Assertion: "validFormat", Message: fmt.Sprintf("encodingFormat %q is not JSON, YAML, SPARQL or SQL", encodingFormat)})
+	}
+	if assertions.ValidFormat && (format == outputFormatSPARQLQuery || format == outputFormatSPARQLUpdate) {
+		var syntaxErr *sparqlSyntaxError
+		if err := checkSPARQL(output, format == outputFormatSPARQLUpdate); errors.As(err, &syntaxErr) {
+			violations = append(violations, Violation{Assertion: "validFormat", Message: "output is not valid SPARQL: " + syntaxErr.Message, Line: syntaxErr.Line, Column: syntaxErr.Column})
+		}
+	}
+	if assertions.ValidFormat && format == outputFormatSQL {
+		var syntaxErr *sqlSyntaxError
+		dialect, err := sqlDialect(encodingFormat)
+		if err == nil {
+			err = checkSQL(dialect, output)
+		}
+		if errors.As(err, &syntaxErr) {
+			violations = append(violations, Violation{Assertion: "validFormat", Message: "output is not valid SQL: " + syntaxErr.Message, Line: syntaxErr.Line, Column: syntaxErr.Column})
+		} else if err != nil {
+			violations = append(violations, Violation{Assertion: "validFormat", Message: err.Error()})
+		}
+	}
+	if format == outputFormatYAML && (assertions.ValidFormat || assertions.JSONSchema != nil) {
+		violations = append(violations, checkYAMLOutput(assertions, assertions.ValidFormat && isKubernetesFormat(encodingFormat), output)...)
+	} else if assertions.ValidJSON || assertions.JSONSchema != nil || (assertions.ValidFormat && format == outputFormatJSON) {
+		violations = append(violations, checkJSONOutput(assertions, output)...)
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	failures := make([]string, len(violations))
+	for i, violation := range violations {
+		failures[i] = violation.String()
+	}
+	return &Error{
+		Message:    "output assertions failed",
+		Status:     http.StatusUnprocessableEntity,
+		Err:        errors.New(strings.Join(failures, "; ")),
+		Details:    failures,
+		Violations: violations,
+	}
+}
+
+// checkJSONOutput parses output as JSON and validates it against the schema
+func checkJSONOutput(assertions *Assertions, output string) []Violation {
+	assertion := "validJson"
+	if !assertions.ValidJSON && assertions.ValidFormat {
+		assertion = "validFormat"
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		violation := Violation{Assertion: assertion, Message: fmt.Sprintf("output is not valid JSON: %v", err)}
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			violation.Line, violation.Column = lineColumn(output, syntaxErr.Offset)
+		}
+		return []Violation{violation}
+	}
+	if assertions.JSONSchema == nil {
+		return nil
+	}
+	return schemaViolations(validateJSONSchema(assertions.JSONSchema, doc, ""))
+}
+
+// yamlLinePattern extracts the line of a YAML parse error
+var yamlLinePattern = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// checkYAMLOutput parses every document of output as YAML and validates
+// each against the schema and, for manifests, the Kubernetes checks
+func checkYAMLOutput(assertions *Assertions, manifests bool, output string) []Violation {
+	decoder := yaml.NewDecoder(strings.NewReader(output))
+	var violations []Violation
+	for document := 0; ; document++ {
+		var node yaml.Node
+		var doc interface{}
+		err := decoder.Decode(&node)
+		if err == nil {
+			err = node.Decode(&doc)
+		}
+		if errors.Is(err, io.EOF) {
+			return violations
+		}
+		if err != nil {
+			violation := Violation{Assertion: "validFormat", Message: "output is not valid YAML: " + strings.TrimPrefix(err.Error(), "yaml: ")}
+			if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+				violation.Line, _ = strconv.Atoi(m[1])
+				violation.Message = "output is not valid YAML: " + strings.TrimPrefix(err.Error(), m[0])
+			}
+			return append(violations, violation)
+		}
+		path := ""
+		if document > 0 {
+			path = fmt.Sprintf("$[document %d]", document)
+		}
+		if manifests {
+			violations = append(violations, checkKubernetesManifest(&node, jsonValue(doc), path, assertions.KubernetesSchemas)...)
+		}
+		if assertions.JSONSchema != nil {
+			violations = append(violations, schemaViolations(validateJSONSchema(assertions.JSONSchema, jsonValue(doc), path))...)
+		}
+	}
+}
+
+// schemaViolations wraps validateJSONSchema messages ("path: message")
+func schemaViolations(messages []string) []Violation {
+	violations := make([]Violation, len(messages))
+	for i, message := range messages {
+		path, text, _ := strings.Cut(message, ": ")
+		violations[i] = Violation{Assertion: "jsonSchema", Path: path, Message: text}
+	}
+	return violations
+}
+
+// jsonValue converts a decoded YAML value to the types encoding/json
+// decodes to, so that JSON Schema validation treats both alike
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// lineColumn returns the 1-based line and column of the last byte before
+// offset, where encoding/json reports a syntax error
+func lineColumn(output string, offset int64) (int, int) {
+	before := []byte(output[:min(max(offset, 1), int64(len(output)))])
+	line := bytes.Count(before[:max(len(before)-1, 0)], []byte("\n")) + 1
+	return line, len(before) - 1 - bytes.LastIndexByte(before[:max(len(before)-1, 0)], '\n')
+}
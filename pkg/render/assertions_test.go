@@ -0,0 +1,124 @@
+package render
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOutputAssertions_Pass(t *testing.T) {
+	assertions := &Assertions{
+		Matches:   []string{`^\{`},
+		MaxLength: 100,
+		JSONSchema: map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"name"},
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "string", "minLength": float64(1)},
+			},
+		},
+	}
+
+	if err := CheckAssertions(assertions, "application/json", `{"name": "Alice"}`); err != nil {
+		t.Errorf("CheckAssertions() returned unexpected error: %v", err)
+	}
+}
+
+func TestOutputAssertions_Failures(t *testing.T) {
+	assertions := &Assertions{
+		Matches:   []string{`^Hello`},
+		MaxLength: 5,
+		JSONSchema: map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"name"},
+		},
+	}
+
+	err := CheckAssertions(assertions, "application/json", `{"other": 1}`)
+	if err == nil {
+		t.Fatal("CheckAssertions() should fail")
+	}
+
+	re, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %T", err)
+	}
+	if re.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, re.Status)
+	}
+	if len(re.Details) != 3 {
+		t.Errorf("Expected 3 failed assertions, got %d: %v", len(re.Details), re.Details)
+	}
+}
+
+func TestOutputAssertions_InvalidJSON(t *testing.T) {
+	err := CheckAssertions(&Assertions{ValidJSON: true}, "text/plain", "not json")
+	if err == nil {
+		t.Error("CheckAssertions() should reject invalid JSON output")
+	}
+}
+
+func TestOutputAssertions_ValidFormatJSON(t *testing.T) {
+	err := CheckAssertions(&Assertions{ValidFormat: true}, "application/json", "{\n  \"name\": \"Alice\",\n  \"age\": ,\n}")
+	re, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %T (%v)", err, err)
+	}
+	if len(re.Violations) != 1 {
+		t.Fatalf("Expected 1 violation, got %v", re.Violations)
+	}
+	v := re.Violations[0]
+	if v.Assertion != "validFormat" || v.Line != 3 || v.Column != 10 {
+		t.Errorf("Unexpected violation %+v", v)
+	}
+
+	if err := CheckAssertions(&Assertions{ValidFormat: true}, "application/ld+json; charset=utf-8", `{"@id": "x"}`); err != nil {
+		t.Errorf("CheckAssertions() returned unexpected error: %v", err)
+	}
+}
+
+func TestOutputAssertions_ValidFormatYAML(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name", "replicas"},
+		"properties": map[string]interface{}{
+			"replicas": map[string]interface{}{"type": "integer", "minimum": float64(1)},
+		},
+	}
+	assertions := &Assertions{ValidFormat: true, JSONSchema: schema}
+	if err := CheckAssertions(assertions, "application/yaml", "name: api\nreplicas: 3\n"); err != nil {
+		t.Errorf("CheckAssertions() returned unexpected error: %v", err)
+	}
+
+	err := CheckAssertions(assertions, "application/yaml", "name: api\nreplicas: 0\n---\nreplicas: 2\n")
+	re, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %T (%v)", err, err)
+	}
+	want := []string{"$.replicas: minimum: got 0, want 1", "$[document 1]: missing property 'name'"}
+	if len(re.Details) != len(want) {
+		t.Fatalf("Expected %q, got %q", want, re.Details)
+	}
+	for i := range want {
+		if re.Details[i] != want[i] {
+			t.Errorf("Detail %d = %q, want %q", i, re.Details[i], want[i])
+		}
+	}
+	if re.Violations[0].Assertion != "jsonSchema" || re.Violations[0].Path != "$.replicas" {
+		t.Errorf("Unexpected violation %+v", re.Violations[0])
+	}
+
+	err = CheckAssertions(&Assertions{ValidFormat: true}, "application/yaml", "name: api\n  replicas: [3\n")
+	re, ok = err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %T (%v)", err, err)
+	}
+	if v := re.Violations[0]; v.Assertion != "validFormat" || v.Line != 2 {
+		t.Errorf("Unexpected violation %+v", v)
+	}
+}
+
+func TestOutputAssertions_ValidFormatUnknown(t *testing.T) {
+	if err := CheckAssertions(&Assertions{ValidFormat: true}, "text/plain", "anything"); err == nil {
+		t.Error("CheckAssertions() should reject validFormat on text/plain output")
+	}
+}
@@ -0,0 +1,208 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// collectionFuncs are the helpers for reports over lists of maps or structs
+// in parameters: sorting, grouping, summing, deduplicating and filtering by
+// a key or dotted path, so that callers need not pre-aggregate data.
+//
+//	{{range sortBy "region,-total" .Sales}}...{{end}}
+//	{{range $region, $rows := groupBy "region" .Sales}}{{$region}}: {{sumBy "total" $rows}}{{end}}
+//	{{range uniqBy "customer.id" .Orders}}...{{end}}
+//	{{range filterBy "total" ">=" 100 .Orders}}...{{end}}
+func collectionFuncs() template.FuncMap {
+	return template.FuncMap{
+		"sortBy":   sortBy,
+		"groupBy":  groupBy,
+		"sumBy":    sumBy,
+		"uniqBy":   uniqBy,
+		"filterBy": filterBy,
+	}
+}
+
+// sortBy returns the items of list sorted by one or more comma-separated
+// paths, each descending when prefixed with "-". The sort is stable, numbers
+// and times compare by value, and items missing a path sort last.
+func sortBy(keys string, list interface{}) ([]interface{}, error) {
+	items, err := digestItems(list)
+	if err != nil {
+		return nil, fmt.Errorf("sortBy: %w", err)
+	}
+	var paths []string
+	var descending []bool
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		if key == "" {
+			return nil, fmt.Errorf("sortBy: empty key in %q", keys)
+		}
+		paths = append(paths, key)
+		descending = append(descending, desc)
+	}
+	sorted := append([]interface{}(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for k, path := range paths {
+			a, aok := LookupPath(sorted[i], path)
+			b, bok := LookupPath(sorted[j], path)
+			aok, bok = aok && a != nil, bok && b != nil
+			if !aok || !bok {
+				if aok != bok {
+					return aok
+				}
+				continue
+			}
+			if c := compareValues(a, b); c != 0 {
+				return (c < 0) != descending[k]
+			}
+		}
+		return false
+	})
+	return sorted, nil
+}
+
+// groupBy groups the items of list by the value at path. Ranging over the
+// result visits the groups in key order; items missing the path are grouped
+// under "".
+func groupBy(path string, list interface{}) (map[string][]interface{}, error) {
+	items, err := digestItems(list)
+	if err != nil {
+		return nil, fmt.Errorf("groupBy: %w", err)
+	}
+	groups := make(map[string][]interface{})
+	for _, item := range items {
+		key := ""
+		if v, ok := LookupPath(item, path); ok && v != nil {
+			key = fmt.Sprint(v)
+		}
+		groups[key] = append(groups[key], item)
+	}
+	return groups, nil
+}
+
+// sumBy adds up the numbers at path over the items of list, skipping items
+// that do not have it
+func sumBy(path string, list interface{}) (float64, error) {
+	items, err := digestItems(list)
+	if err != nil {
+		return 0, fmt.Errorf("sumBy: %w", err)
+	}
+	var sum float64
+	for _, item := range items {
+		v, ok := LookupPath(item, path)
+		if !ok || v == nil {
+			continue
+		}
+		n, err := numberValue(v)
+		if err != nil {
+			return 0, fmt.Errorf("sumBy %s: %w", path, err)
+		}
+		sum += n
+	}
+	return sum, nil
+}
+
+// uniqBy keeps the first item of list for each distinct value at path
+func uniqBy(path string, list interface{}) ([]interface{}, error) {
+	items, err := digestItems(list)
+	if err != nil {
+		return nil, fmt.Errorf("uniqBy: %w", err)
+	}
+	seen := make(map[string]bool)
+	unique := []interface{}{}
+	for _, item := range items {
+		v, _ := LookupPath(item, path)
+		key := fmt.Sprintf("%T:%v", v, v)
+		if isNumber(v) {
+			n, _ := numberValue(v)
+			key = fmt.Sprint("number:", n)
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique, nil
+}
+
+// filterOperators are the comparisons of filterBy
+var filterOperators = map[string]func(c int) bool{
+	"==": func(c int) bool { return c == 0 },
+	"!=": func(c int) bool { return c != 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+// filterBy keeps the items of list whose value at path equals value, or
+// compares to it with an operator (==, !=, <, <=, >, >=):
+//
+//	{{filterBy "status" "open" .Tickets}}
+//	{{filterBy "total" ">=" 100 .Orders}}
+//
+// Items missing the path only pass the != comparison.
+func filterBy(path string, args ...interface{}) ([]interface{}, error) {
+	operator, value, list := "==", interface{}(nil), interface{}(nil)
+	switch len(args) {
+	case 2:
+		value, list = args[0], args[1]
+	case 3:
+		op, ok := args[0].(string)
+		if _, known := filterOperators[op]; !ok || !known {
+			return nil, fmt.Errorf("filterBy: unknown operator %v (expected ==, !=, <, <=, > or >=)", args[0])
+		}
+		operator, value, list = op, args[1], args[2]
+	default:
+		return nil, fmt.Errorf("filterBy expects a path, an optional operator, a value and a list")
+	}
+	items, err := digestItems(list)
+	if err != nil {
+		return nil, fmt.Errorf("filterBy: %w", err)
+	}
+	matches := []interface{}{}
+	for _, item := range items {
+		v, ok := LookupPath(item, path)
+		if !ok || v == nil {
+			if operator == "!=" && value != nil {
+				matches = append(matches, item)
+			}
+			continue
+		}
+		if filterOperators[operator](compareValues(v, value)) {
+			matches = append(matches, item)
+		}
+	}
+	return matches, nil
+}
+
+// compareValues orders two template values: numbers (and numeric strings
+// compared with a number) by value, times chronologically and anything else
+// by its printed form
+func compareValues(a, b interface{}) int {
+	if isNumber(a) || isNumber(b) {
+		x, errA := numberValue(a)
+		y, errB := numberValue(b)
+		if errA == nil && errB == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func collectionSales() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"id": "a", "region": "west", "total": float64(120), "customer": map[string]interface{}{"id": float64(1)}},
+		map[string]interface{}{"id": "b", "region": "east", "total": float64(40), "customer": map[string]interface{}{"id": float64(2)}},
+		map[string]interface{}{"id": "c", "region": "west", "total": float64(75.5), "customer": map[string]interface{}{"id": float64(1)}},
+		map[string]interface{}{"id": "d", "region": "east", "total": float64(310)},
+		map[string]interface{}{"id": "e", "total": "9"},
+	}
+}
+
+func collectionIDs(t *testing.T, items []interface{}, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids := ""
+	for _, item := range items {
+		ids += item.(map[string]interface{})["id"].(string)
+	}
+	return ids
+}
+
+func TestSortBy(t *testing.T) {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"total", "ebcad"},
+		{"-total", "dacbe"},
+		{"region,-total", "dbace"},
+		{"-region,id", "acbde"},
+	}
+	for _, tt := range tests {
+		items, err := sortBy(tt.keys, collectionSales())
+		if got := collectionIDs(t, items, err); got != tt.want {
+			t.Errorf("sortBy(%q) = %s, want %s", tt.keys, got, tt.want)
+		}
+	}
+	if _, err := sortBy("region,", collectionSales()); err == nil {
+		t.Error("sortBy() should reject an empty key")
+	}
+}
+
+func TestFilterAndUniqBy(t *testing.T) {
+	items, err := filterBy("region", "west", collectionSales())
+	if got := collectionIDs(t, items, err); got != "ac" {
+		t.Errorf("filterBy(region == west) = %s", got)
+	}
+	items, err = filterBy("total", ">=", 100, collectionSales())
+	if got := collectionIDs(t, items, err); got != "ad" {
+		t.Errorf("filterBy(total >= 100) = %s", got)
+	}
+	items, err = filterBy("region", "!=", "east", collectionSales())
+	if got := collectionIDs(t, items, err); got != "ace" {
+		t.Errorf("filterBy(region != east) = %s", got)
+	}
+	if _, err := filterBy("total", "~", 1, collectionSales()); err == nil {
+		t.Error("filterBy() should reject an unknown operator")
+	}
+
+	items, err = uniqBy("customer.id", collectionSales())
+	if got := collectionIDs(t, items, err); got != "abd" {
+		t.Errorf("uniqBy(customer.id) = %s", got)
+	}
+}
+
+func TestCollectionTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{range $region, $rows := groupBy "region" .Sales}}{{$region}}={{sumBy "total" $rows}};{{end}}`,
+		Parameters: map[string]interface{}{"Sales": collectionSales()},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if want := "=9;east=350;west=195.5;"; output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+
+	_, err = Render(context.Background(), Request{
+		Text:       `{{sumBy "region" .Sales}}`,
+		Parameters: map[string]interface{}{"Sales": collectionSales()},
+	}, DefaultLimits)
+	if err == nil {
+		t.Error("sumBy over strings should fail")
+	}
+}
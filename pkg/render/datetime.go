@@ -0,0 +1,174 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// dateNames are the month and weekday names of a language, Sunday first
+type dateNames struct {
+	Months, ShortMonths [12]string
+	Days, ShortDays     [7]string
+	Styles              map[string]string // short, medium, long and full date layouts
+}
+
+// localeDateNames holds the built-in date names by language. Locales of
+// other languages format in English.
+var localeDateNames = map[string]*dateNames{
+	"en": {
+		Months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		ShortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		Days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		ShortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		Styles:      map[string]string{"short": "1/2/06", "medium": "Jan 2, 2006", "long": "January 2, 2006", "full": "Monday, January 2, 2006"},
+	},
+	"de": {
+		Months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		ShortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		Days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		ShortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		Styles:      map[string]string{"short": "02.01.06", "medium": "02.01.2006", "long": "2. January 2006", "full": "Monday, 2. January 2006"},
+	},
+	"fr": {
+		Months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		ShortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		ShortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		Styles:      map[string]string{"short": "02/01/2006", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday 2 January 2006"},
+	},
+	"es": {
+		Months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		ShortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		Days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		ShortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		Styles:      map[string]string{"short": "2/1/06", "medium": "2 Jan 2006", "long": "2 de January de 2006", "full": "Monday, 2 de January de 2006"},
+	},
+	"it": {
+		Months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		ShortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		Days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		ShortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		Styles:      map[string]string{"short": "02/01/06", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday 2 January 2006"},
+	},
+	"nl": {
+		Months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		ShortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		Days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		ShortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		Styles:      map[string]string{"short": "02-01-2006", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday 2 January 2006"},
+	},
+	"pt": {
+		Months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		ShortMonths: [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		Days:        [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		ShortDays:   [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+		Styles:      map[string]string{"short": "02/01/2006", "medium": "2 de Jan de 2006", "long": "2 de January de 2006", "full": "Monday, 2 de January de 2006"},
+	},
+}
+
+// namesFor returns the date names of a locale's language
+func namesFor(locale string) *dateNames {
+	if names, ok := localeDateNames[localeLanguage(locale)]; ok {
+		return names
+	}
+	return localeDateNames["en"]
+}
+
+// dateFuncs format timestamps with the month and day names of locale.
+// Values are RFC 3339 strings, YYYY-MM-DD dates, Unix seconds or times. The
+// layout is a Go reference layout or one of the locale's styles short,
+// medium, long and full:
+//
+//	{{formatDate "long" .CreatedAt}}
+//	{{.CreatedAt | formatDate "Monday, 2 January 2006 15:04"}}
+//	{{formatDateIn "Europe/Zurich" "02.01.2006 15:04 MST" .CreatedAt}}
+//
+// formatDate keeps the value's own UTC offset (UTC for Unix seconds),
+// formatDateIn converts it to an IANA time zone first.
+func dateFuncs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"formatDate": func(layout string, value interface{}) (string, error) {
+			return formatDate(locale, layout, "", value)
+		},
+		"formatDateIn": func(zone, layout string, value interface{}) (string, error) {
+			return formatDate(locale, layout, zone, value)
+		},
+	}
+}
+
+// formatDate formats value with layout in locale, converted to zone unless empty
+func formatDate(locale, layout, zone string, value interface{}) (string, error) {
+	t, err := dateValue(value)
+	if err != nil {
+		return "", err
+	}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %q", zone)
+		}
+		t = t.In(loc)
+	}
+	names := namesFor(locale)
+	if style, ok := names.Styles[layout]; ok {
+		layout = style
+	}
+	return localizedFormat(t, layout, names), nil
+}
+
+// dateValue interprets a template value as a time
+func dateValue(value interface{}) (time.Time, error) {
+	if s, ok := value.(string); ok {
+		if t, err := time.Parse(time.DateOnly, s); err == nil {
+			return t, nil
+		}
+	}
+	t, err := digestTime(value)
+	if err != nil {
+		return t, err
+	}
+	if t.Location() == time.Local {
+		t = t.UTC()
+	}
+	return t, nil
+}
+
+// localizedFormat formats t like t.Format(layout), with the month and day
+// names of the layout taken from names
+func localizedFormat(t time.Time, layout string, names *dateNames) string {
+	var out strings.Builder
+	for layout != "" {
+		i, token := nextNameToken(layout)
+		out.WriteString(t.Format(layout[:i]))
+		if token == "" {
+			break
+		}
+		switch token {
+		case "January":
+			out.WriteString(names.Months[t.Month()-1])
+		case "Jan":
+			out.WriteString(names.ShortMonths[t.Month()-1])
+		case "Monday":
+			out.WriteString(names.Days[t.Weekday()])
+		case "Mon":
+			out.WriteString(names.ShortDays[t.Weekday()])
+		}
+		layout = layout[i+len(token):]
+	}
+	return out.String()
+}
+
+// nextNameToken finds the first month or day name token of a Go layout,
+// returning its offset and the token, or len(layout) and "" when there is none
+func nextNameToken(layout string) (int, string) {
+	for i := 0; i < len(layout); i++ {
+		for _, token := range []string{"January", "Jan", "Monday", "Mon"} {
+			if strings.HasPrefix(layout[i:], token) {
+				return i, token
+			}
+		}
+	}
+	return len(layout), ""
+}
@@ -0,0 +1,51 @@
+package render
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFormatDateTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{formatDate "long" .At}}|{{.At | formatDate "Mon 2 Jan 15:04"}}|{{formatDateIn "Europe/Zurich" "Monday 15:04 MST" .At}}`,
+		Locale:     "de-CH",
+		Parameters: map[string]interface{}{"At": "2025-03-02T23:30:00Z"},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "2. März 2025|So. 2 März 23:30|Montag 00:30 CET"
+	if output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	at := time.Date(2024, 12, 24, 18, 5, 0, 0, time.FixedZone("", 3600))
+	tests := []struct {
+		locale string
+		layout string
+		value  interface{}
+		want   string
+	}{
+		{"en", "full", at, "Tuesday, December 24, 2024"},
+		{"fr-CA", "full", at, "mardi 24 décembre 2024"},
+		{"es", "long", "2024-12-24", "24 de diciembre de 2024"},
+		{"ja", "medium", at, "Dec 24, 2024"},
+		{"nl", "2006-01-02T15:04Z07:00", at, "2024-12-24T18:05+01:00"},
+		{"de", "02.01.2006 15:04", float64(0), "01.01.1970 00:00"},
+	}
+	for _, tt := range tests {
+		got, err := formatDate(tt.locale, tt.layout, "", tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("formatDate(%q, %q, %v) = %q, %v; want %q", tt.locale, tt.layout, tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := formatDate("en", "long", "Mars/Olympus", at); err == nil {
+		t.Error("Expected an error for an unknown time zone")
+	}
+	if _, err := formatDate("en", "long", "", "next week"); err == nil {
+		t.Error("Expected an error for an unparseable time")
+	}
+}
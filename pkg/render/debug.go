@@ -0,0 +1,104 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// maxDumpDepth bounds how deep dump descends into nested values
+const maxDumpDepth = 32
+
+// debugFuncs are added to Go templates rendered in debug mode
+func debugFuncs() template.FuncMap {
+	return template.FuncMap{
+		"dump":      dumpValue,
+		"debugJSON": debugJSON,
+	}
+}
+
+// debugJSON returns v as indented JSON
+//
+//	<pre>{{debugJSON .Customer}}</pre>
+func debugJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// dumpValue describes v as an indented tree naming the Go type of every
+// value, which shows authors what comparisons and functions will accept
+// (JSON numbers, for instance, arrive as float64)
+//
+//	{{dump .}}
+func dumpValue(v interface{}) string {
+	var b strings.Builder
+	writeDump(&b, reflect.ValueOf(v), "", 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// writeDump writes one value of a dump and its children
+func writeDump(b *strings.Builder, v reflect.Value, indent string, depth int) {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || ((v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) && v.IsNil()) {
+		b.WriteString("nil\n")
+		return
+	}
+	if depth >= maxDumpDepth {
+		b.WriteString(v.Type().String() + " ...\n")
+		return
+	}
+
+	child := indent + "  "
+	switch v.Kind() {
+	case reflect.Map:
+		fmt.Fprintf(b, "map (%d keys)\n", v.Len())
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			fmt.Fprintf(b, "%s%v: ", child, key)
+			writeDump(b, v.MapIndex(key), child, depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			fmt.Fprintf(b, "bytes (%d)\n", v.Len())
+			return
+		}
+		fmt.Fprintf(b, "list (%d items)\n", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			fmt.Fprintf(b, "%s[%d]: ", child, i)
+			writeDump(b, v.Index(i), child, depth+1)
+		}
+	case reflect.Struct:
+		fmt.Fprintf(b, "%s\n", v.Type())
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() {
+				fmt.Fprintf(b, "%s%s: ", child, field.Name)
+				writeDump(b, v.Field(i), child, depth+1)
+			}
+		}
+	case reflect.String:
+		fmt.Fprintf(b, "string %s\n", strconv.Quote(v.String()))
+	default:
+		if v.CanInterface() {
+			fmt.Fprintf(b, "%s %v\n", v.Type(), v.Interface())
+		} else {
+			fmt.Fprintf(b, "%s\n", v.Type())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package render
+
+import "testing"
+
+func TestDumpValue(t *testing.T) {
+	got := dumpValue(map[string]interface{}{
+		"Name":  "Ada",
+		"Total": 19.5,
+		"Items": []interface{}{map[string]interface{}{"Sku": "A-1"}, nil},
+		"Paid":  true,
+	})
+	want := `map (4 keys)
+  Items: list (2 items)
+    [0]: map (1 keys)
+      Sku: string "A-1"
+    [1]: nil
+  Name: string "Ada"
+  Paid: bool true
+  Total: float64 19.5`
+	if got != want {
+		t.Errorf("dumpValue() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := dumpValue(digestGroup{Key: "x", Count: 1}); got != "render.digestGroup\n  Key: string \"x\"\n  Items: list (0 items)\n  Count: int 1" {
+		t.Errorf("Unexpected struct dump %q", got)
+	}
+}
+
+func TestDebugJSON(t *testing.T) {
+	got, err := debugJSON(map[string]interface{}{"a": []interface{}{1, "<b>"}})
+	if err != nil {
+		t.Fatalf("debugJSON() returned error: %v", err)
+	}
+	if want := "{\n  \"a\": [\n    1,\n    \"<b>\"\n  ]\n}"; got != want {
+		t.Errorf("debugJSON() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/shopspring/decimal"
+)
+
+// divisionPlaces is the number of decimal places divDec keeps
+const divisionPlaces = 16
+
+// decimalFuncs are arithmetic helpers for money amounts that never pass
+// through a float. Operands are numbers or decimal strings; results are
+// plain decimal strings, which print exactly and feed into the other
+// helpers and formatNumber/formatCurrency unchanged:
+//
+//	{{mulDec .Price .Quantity}}                          → 59.97
+//	{{round (addDec .Subtotal (mulDec .Subtotal "0.081")) 2}}
+//	{{currencyCents .Total}}                             → 5997
+//
+// round replaces the float-based Sprig function of the same name, keeping
+// its argument order ({{round .Amount 2}}) and rounding half away from zero.
+func decimalFuncs() template.FuncMap {
+	return template.FuncMap{
+		"addDec":        addDec,
+		"subDec":        subDec,
+		"mulDec":        mulDec,
+		"divDec":        divDec,
+		"round":         roundDec,
+		"currencyCents": currencyCents,
+	}
+}
+
+// decimalValue interprets a template value as an exact decimal
+func decimalValue(value interface{}) (decimal.Decimal, error) {
+	digits, err := decimalDigits(value)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromString(digits)
+}
+
+// decimalValues interprets the operands of an arithmetic helper
+func decimalValues(name string, values []interface{}) ([]decimal.Decimal, error) {
+	if len(values) < 2 {
+		return nil, fmt.Errorf("%s expects at least two operands", name)
+	}
+	operands := make([]decimal.Decimal, len(values))
+	for i, value := range values {
+		d, err := decimalValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		operands[i] = d
+	}
+	return operands, nil
+}
+
+// addDec returns the exact sum of its operands
+func addDec(values ...interface{}) (string, error) {
+	operands, err := decimalValues("addDec", values)
+	if err != nil {
+		return "", err
+	}
+	return decimal.Sum(operands[0], operands[1:]...).String(), nil
+}
+
+// subDec subtracts the other operands from the first
+func subDec(values ...interface{}) (string, error) {
+	operands, err := decimalValues("subDec", values)
+	if err != nil {
+		return "", err
+	}
+	result := operands[0]
+	for _, d := range operands[1:] {
+		result = result.Sub(d)
+	}
+	return result.String(), nil
+}
+
+// mulDec returns the exact product of its operands
+func mulDec(values ...interface{}) (string, error) {
+	operands, err := decimalValues("mulDec", values)
+	if err != nil {
+		return "", err
+	}
+	result := operands[0]
+	for _, d := range operands[1:] {
+		result = result.Mul(d)
+	}
+	return result.String(), nil
+}
+
+// divDec divides a by b, to divisionPlaces decimal places
+func divDec(a, b interface{}) (string, error) {
+	operands, err := decimalValues("divDec", []interface{}{a, b})
+	if err != nil {
+		return "", err
+	}
+	if operands[1].IsZero() {
+		return "", fmt.Errorf("divDec: division by zero")
+	}
+	return operands[0].DivRound(operands[1], divisionPlaces).String(), nil
+}
+
+// roundDec rounds value to places decimal places, half away from zero,
+// keeping trailing zeros (12.50). Negative places round to tens, hundreds
+// and so on.
+func roundDec(value interface{}, places int) (string, error) {
+	d, err := decimalValue(value)
+	if err != nil {
+		return "", fmt.Errorf("round: %w", err)
+	}
+	if places < 0 {
+		return d.Round(int32(places)).String(), nil
+	}
+	return d.StringFixed(int32(places)), nil
+}
+
+// currencyCents converts an amount to integer minor units, as payment APIs
+// expect, rounding half away from zero. The optional ISO 4217 code before
+// the amount selects its minor unit digits (JPY has none, KWD three),
+// defaulting to two:
+//
+//	{{currencyCents .Total}}          → 1999
+//	{{currencyCents "JPY" .Total}}    → 1999 yen
+func currencyCents(args ...interface{}) (int64, error) {
+	decimals := 2
+	switch len(args) {
+	case 1:
+	case 2:
+		code, ok := args[0].(string)
+		if !ok {
+			return 0, fmt.Errorf("currencyCents: currency code must be a string, got %T", args[0])
+		}
+		if _, n, ok := currencyUnit(strings.ToUpper(code)); ok {
+			decimals = n
+		}
+	default:
+		return 0, fmt.Errorf("currencyCents expects an optional currency code and an amount")
+	}
+	d, err := decimalValue(args[len(args)-1])
+	if err != nil {
+		return 0, fmt.Errorf("currencyCents: %w", err)
+	}
+	minor := d.Shift(int32(decimals)).Round(0)
+	if !minor.IsInteger() || minor.Abs().GreaterThan(decimal.New(1, 18)) {
+		return 0, fmt.Errorf("currencyCents: amount %s is out of range", d)
+	}
+	return minor.IntPart(), nil
+}
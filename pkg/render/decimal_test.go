@@ -0,0 +1,76 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecimalArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  func() (string, error)
+		want string
+	}{
+		{"addDec floats", func() (string, error) { return addDec(0.1, 0.2) }, "0.3"},
+		{"addDec mixed", func() (string, error) { return addDec("19.99", 5, 0.01) }, "25"},
+		{"subDec", func() (string, error) { return subDec("100", "0.1", 0.2) }, "99.7"},
+		{"mulDec", func() (string, error) { return mulDec("19.99", 3) }, "59.97"},
+		{"mulDec tax", func() (string, error) { return mulDec("1.15", "0.081") }, "0.09315"},
+		{"divDec", func() (string, error) { return divDec(10, 4) }, "2.5"},
+		{"round half up", func() (string, error) { return roundDec(2.675, 2) }, "2.68"},
+		{"round negative", func() (string, error) { return roundDec("-0.125", 2) }, "-0.13"},
+		{"round pads", func() (string, error) { return roundDec("12.5", 2) }, "12.50"},
+		{"round tens", func() (string, error) { return roundDec(1245, -1) }, "1250"},
+	}
+	for _, tt := range tests {
+		got, err := tt.got()
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := addDec(1); err == nil {
+		t.Error("addDec() should require two operands")
+	}
+	if _, err := mulDec("1.5", "abc"); err == nil {
+		t.Error("mulDec() should reject a non-numeric operand")
+	}
+	if _, err := divDec(1, "0.00"); err == nil {
+		t.Error("divDec() should reject division by zero")
+	}
+}
+
+func TestCurrencyCents(t *testing.T) {
+	tests := []struct {
+		args []interface{}
+		want int64
+	}{
+		{[]interface{}{19.99}, 1999},
+		{[]interface{}{"0.285"}, 29},
+		{[]interface{}{-1.005}, -101},
+		{[]interface{}{"JPY", "1999.5"}, 2000},
+		{[]interface{}{"kwd", 1.2345}, 1235},
+	}
+	for _, tt := range tests {
+		got, err := currencyCents(tt.args...)
+		if err != nil || got != tt.want {
+			t.Errorf("currencyCents(%v) = %d, %v; want %d", tt.args, got, err, tt.want)
+		}
+	}
+	if _, err := currencyCents("1e30"); err == nil {
+		t.Error("currencyCents() should reject amounts out of range")
+	}
+}
+
+func TestDecimalTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{$net := mulDec .Price .Quantity}}{{$net}} + {{round (mulDec $net "0.081") 2}} = {{formatNumber 2 (addDec $net (round (mulDec $net "0.081") 2))}} ({{currencyCents (addDec $net "4.86")}})`,
+		Parameters: map[string]interface{}{"Price": 19.99, "Quantity": 3},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if want := "59.97 + 4.86 = 64.83 (6483)"; output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
@@ -0,0 +1,234 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// digestFuncs are the helpers for digest-style templates (daily summaries,
+// notification emails): grouping events, capping lists with a remainder and
+// relative times
+func digestFuncs() template.FuncMap {
+	return template.FuncMap{
+		"groupEvents": groupEvents,
+		"limitItems":  limitItems,
+		"timeAgo":     timeAgo,
+	}
+}
+
+// digestGroup is one group returned by groupEvents
+type digestGroup struct {
+	Key   string
+	Items []interface{}
+	Count int
+}
+
+// digestSlice is a list capped by limitItems. More is the number of items
+// left out, for "and 3 more" lines.
+type digestSlice struct {
+	Items []interface{}
+	More  int
+	Total int
+}
+
+// groupEvents groups the items of list by the value at key, a map key or
+// struct field (dotted for nested values). Groups keep the order in which
+// their key first appears; items without the key are grouped under "".
+//
+//	{{range groupEvents "repository" .Events}}{{.Key}}: {{.Count}}{{end}}
+func groupEvents(key string, list interface{}) ([]digestGroup, error) {
+	items, err := digestItems(list)
+	if err != nil {
+		return nil, err
+	}
+	groups := []digestGroup{}
+	index := map[string]int{}
+	for _, item := range items {
+		value := ""
+		if v, ok := LookupPath(item, key); ok && v != nil {
+			value = fmt.Sprint(v)
+		}
+		i, ok := index[value]
+		if !ok {
+			i = len(groups)
+			index[value] = i
+			groups = append(groups, digestGroup{Key: value})
+		}
+		groups[i].Items = append(groups[i].Items, item)
+		groups[i].Count++
+	}
+	return groups, nil
+}
+
+// limitItems returns at most n items of list and how many were left out.
+//
+//	{{with limitItems 5 .Events}}{{range .Items}}...{{end}}{{if .More}}and {{.More}} more{{end}}{{end}}
+func limitItems(n int, list interface{}) (digestSlice, error) {
+	items, err := digestItems(list)
+	if err != nil {
+		return digestSlice{}, err
+	}
+	if n < 0 {
+		n = 0
+	}
+	if len(items) <= n {
+		return digestSlice{Items: items, Total: len(items)}, nil
+	}
+	return digestSlice{Items: items[:n], More: len(items) - n, Total: len(items)}, nil
+}
+
+// timeAgo describes t relative to now, or to the optional reference time,
+// as "5 minutes ago", "in 2 days" or "just now". Times may be time.Time
+// values, RFC 3339 strings or Unix seconds.
+func timeAgo(t interface{}, reference ...interface{}) (string, error) {
+	at, err := digestTime(t)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if len(reference) > 0 {
+		if now, err = digestTime(reference[0]); err != nil {
+			return "", err
+		}
+	}
+
+	d := now.Sub(at)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < time.Minute {
+		return "just now", nil
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		if d < unit.size {
+			continue
+		}
+		count := int(d / unit.size)
+		phrase := fmt.Sprintf("%d %ss", count, unit.name)
+		if count == 1 {
+			phrase = "1 " + unit.name
+		}
+		if future {
+			return "in " + phrase, nil
+		}
+		return phrase + " ago", nil
+	}
+	return "just now", nil
+}
+
+// digestItems converts a slice or array of any element type to []interface{}
+func digestItems(list interface{}) ([]interface{}, error) {
+	if list == nil {
+		return nil, nil
+	}
+	if items, ok := list.([]interface{}); ok {
+		return items, nil
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list, got %T", list)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// LookupPath returns the value at a dotted path of map keys, struct fields
+// and list indexes
+func LookupPath(item interface{}, key string) (interface{}, bool) {
+	current := item
+	for _, part := range strings.Split(key, ".") {
+		var ok bool
+		if current, ok = lookupField(current, part); !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// lookupField returns the map entry, struct field or list element name refers to
+func lookupField(item interface{}, name string) (interface{}, bool) {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return nil, false
+		}
+		return value.Interface(), true
+	case reflect.Struct:
+		field := v.FieldByName(name)
+		if !field.IsValid() || !field.CanInterface() {
+			return nil, false
+		}
+		return field.Interface(), true
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i >= v.Len() {
+			return nil, false
+		}
+		return v.Index(i).Interface(), true
+	}
+	return nil, false
+}
+
+// digestTime converts a template value to a time
+func digestTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			return unixTime(seconds), nil
+		}
+	case int:
+		return time.Unix(int64(v), 0), nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case float64:
+		// JSON numbers decode as float64
+		return unixTime(v), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot interpret %v (%T) as a time", value, value)
+}
+
+// unixTime converts fractional Unix seconds to a time
+func unixTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9))
+}
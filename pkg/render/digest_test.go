@@ -0,0 +1,70 @@
+package render
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDigestTemplate(t *testing.T) {
+	events := []interface{}{
+		map[string]interface{}{"repo": "api", "title": "Fix login"},
+		map[string]interface{}{"repo": "web", "title": "New header"},
+		map[string]interface{}{"repo": "api", "title": "Add tokens"},
+		map[string]interface{}{"repo": "api", "title": "Bump deps"},
+		map[string]interface{}{"title": "Orphan"},
+	}
+	output, err := Render(context.Background(), Request{
+		Text:       `{{range groupEvents "repo" .Events}}[{{.Key}} {{.Count}}:{{with limitItems 2 .Items}}{{range .Items}} {{.title}}{{end}}{{if .More}} and {{.More}} more{{end}}{{end}}]{{end}}`,
+		Parameters: map[string]interface{}{"Events": events},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "[api 3: Fix login Add tokens and 1 more][web 1: New header][ 1: Orphan]"
+	if output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
+
+func TestGroupEvents_StructFields(t *testing.T) {
+	type owner struct{ Team string }
+	type event struct {
+		Owner owner
+		Name  string
+	}
+	groups, err := groupEvents("Owner.Team", []event{{owner{"ops"}, "a"}, {owner{"dev"}, "b"}, {owner{"ops"}, "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Key != "ops" || groups[0].Count != 2 || groups[1].Key != "dev" {
+		t.Errorf("Unexpected groups %+v", groups)
+	}
+	if _, err := groupEvents("x", "not a list"); err == nil {
+		t.Error("Expected an error for a non-list value")
+	}
+}
+
+func TestTimeAgo(t *testing.T) {
+	reference := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at   interface{}
+		want string
+	}{
+		{reference.Add(-30 * time.Second), "just now"},
+		{reference.Add(-time.Minute), "1 minute ago"},
+		{"2025-03-10T09:00:00Z", "3 hours ago"},
+		{float64(reference.Add(-49 * time.Hour).Unix()), "2 days ago"},
+		{reference.Add(15 * 24 * time.Hour), "in 2 weeks"},
+		{reference.AddDate(-2, 0, -1), "2 years ago"},
+	}
+	for _, tt := range tests {
+		got, err := timeAgo(tt.at, reference)
+		if err != nil || got != tt.want {
+			t.Errorf("timeAgo(%v) = %q, %v; want %q", tt.at, got, err, tt.want)
+		}
+	}
+	if _, err := timeAgo("yesterday"); err == nil {
+		t.Error("Expected an error for an unparseable time")
+	}
+}
@@ -0,0 +1,148 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// GoEngine is the name of the default text/template engine
+const GoEngine = "go"
+
+// Engine parses templates in one template syntax. The Go text/template
+// engine is the default; other engines render templates written for other
+// ecosystems unchanged.
+type Engine interface {
+	Parse(req Request) (Template, error)
+}
+
+// Template is a parsed template. Parsed templates may be cached and
+// shared, so Execute must be safe for concurrent use.
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Variable is a parameter path referenced by a template. Elements of
+// ranged collections are written as ".items[].name".
+type Variable struct {
+	Name     string `json:"name"`
+	Iterated bool   `json:"iterated,omitempty"` // Ranged over
+}
+
+// VariableLister is implemented by the templates of engines other than Go
+// that can list the variables they reference
+type VariableLister interface {
+	Variables() []Variable
+}
+
+// engines are the available engines by name
+var engines = map[string]Engine{
+	GoEngine:     goEngine{},
+	"mustache":   mustacheEngine{},
+	"handlebars": handlebarsEngine{},
+	"jinja2":     jinjaEngine{},
+	"liquid":     liquidEngine{},
+}
+
+// EngineFor returns the engine registered under name ("" for the default)
+func EngineFor(name string) (Engine, error) {
+	if name == "" {
+		name = GoEngine
+	}
+	engine, ok := engines[name]
+	if !ok {
+		return nil, &Error{
+			Message: fmt.Sprintf("unknown template engine %q (expected %s)", name, strings.Join(EngineNames(), ", ")),
+			Status:  http.StatusBadRequest,
+		}
+	}
+	return engine, nil
+}
+
+// EngineNames lists the registered engines
+func EngineNames() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EngineFromFormat returns the engine an encoding format names and the
+// output format left once the engine is removed: "text/html+mustache"
+// renders HTML with the mustache engine, "text/x-mustache" plain text.
+func EngineFromFormat(format string) (engine, output string, ok bool) {
+	for name := range engines {
+		switch {
+		case strings.EqualFold(format, "text/x-"+name):
+			return name, "", true
+		case strings.HasSuffix(strings.ToLower(format), "+"+name):
+			return name, format[:len(format)-len(name)-1], true
+		}
+	}
+	return "", format, false
+}
+
+// goEngine is the text/template engine with the template function library
+type goEngine struct{}
+
+func (goEngine) Parse(req Request) (Template, error) {
+	tmpl, err := CompileGo(req)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// CompileGo parses the request's template as a Go template, for callers
+// that inspect its parse tree. Missing-key substitutes, locales and SQL
+// dialects are left to Bind.
+func CompileGo(req Request) (*template.Template, error) {
+	if len(req.Delimiters) > 0 && (len(req.Delimiters) != 2 || req.Delimiters[0] == "" || req.Delimiters[1] == "") {
+		return nil, &Error{Message: "delimiters must be a pair of non-empty strings", Status: http.StatusBadRequest}
+	}
+	missingKey, err := missingKeyOption(req.MissingKey, req.MissingValue != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "template"
+	}
+	tmpl := template.New(name).Funcs(req.funcMap()).Funcs(contextCheckFuncs).Option("missingkey=" + missingKey)
+	if req.Debug {
+		tmpl = tmpl.Funcs(debugFuncs())
+	}
+	if len(req.Delimiters) > 0 {
+		tmpl = tmpl.Delims(req.Delimiters[0], req.Delimiters[1])
+	}
+	if req.MissingValue != nil {
+		// Bound to the request's substitute value at execution time
+		tmpl = tmpl.Funcs(template.FuncMap{missingKeyFunc: func(v interface{}) interface{} { return v }})
+	}
+
+	if req.LayoutText != "" {
+		if tmpl, err = tmpl.Parse(req.LayoutText); err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to parse layout %q", req.Layout), Status: http.StatusBadRequest, Err: err}
+		}
+		// The content's body fills the layout's content block
+		if _, err = tmpl.New(LayoutContentBlock).Parse(req.Text); err != nil {
+			return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+		}
+	} else if tmpl, err = tmpl.Parse(req.Text); err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	if err := parsePartials(tmpl, req.Partials); err != nil {
+		return nil, err
+	}
+	if req.MissingValue != nil {
+		substituteMissingValues(tmpl)
+	}
+	checkRanges(tmpl)
+	return tmpl, nil
+}
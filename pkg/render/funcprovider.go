@@ -0,0 +1,55 @@
+package render
+
+import (
+	"sync"
+	"text/template"
+)
+
+// FuncProvider supplies domain-specific template functions. Providers
+// register themselves with RegisterFuncProvider, usually from an init
+// function of a package linked into the service or of a Go plugin loaded
+// at startup; which of their functions templates may call is left to the
+// embedding service.
+type FuncProvider interface {
+	Name() string            // Name of the provider, for logs and errors
+	Funcs() template.FuncMap // Functions by the name templates call them with
+}
+
+var (
+	providersMu sync.Mutex
+	providers   []FuncProvider
+)
+
+// RegisterFuncProvider adds a provider of template functions. Providers
+// registered twice under the same name are kept once.
+func RegisterFuncProvider(p FuncProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	for _, registered := range providers {
+		if registered.Name() == p.Name() {
+			return
+		}
+	}
+	providers = append(providers, p)
+}
+
+// FuncProviders returns the registered providers in registration order
+func FuncProviders() []FuncProvider {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	return append([]FuncProvider(nil), providers...)
+}
+
+// funcProviderFunc adapts a name and function map to a FuncProvider
+type funcProviderFunc struct {
+	name  string
+	funcs template.FuncMap
+}
+
+func (p funcProviderFunc) Name() string            { return p.name }
+func (p funcProviderFunc) Funcs() template.FuncMap { return p.funcs }
+
+// NewFuncProvider returns a provider of a fixed set of functions
+func NewFuncProvider(name string, funcs template.FuncMap) FuncProvider {
+	return funcProviderFunc{name: name, funcs: funcs}
+}
@@ -0,0 +1,58 @@
+package render
+
+import (
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// sprigExcluded are Sprig functions never exposed to templates because they
+// read the process environment (which holds API keys and signing secrets)
+var sprigExcluded = []string{"env", "expandenv"}
+
+// Funcs assembles the template function library: the package's own
+// functions and, when withSprig is set, the Sprig library without the
+// functions that read the process environment
+func Funcs(withSprig bool) template.FuncMap {
+	funcs := template.FuncMap{}
+
+	if withSprig {
+		for name, fn := range sprig.TxtFuncMap() {
+			funcs[name] = fn
+		}
+		for _, name := range sprigExcluded {
+			delete(funcs, name)
+		}
+	}
+	for name, fn := range digestFuncs() {
+		funcs[name] = fn
+	}
+	for name, fn := range collectionFuncs() {
+		funcs[name] = fn
+	}
+	// Replaces Sprig's float-based round
+	for name, fn := range decimalFuncs() {
+		funcs[name] = fn
+	}
+	for name, fn := range ibanFuncs() {
+		funcs[name] = fn
+	}
+	for name, fn := range maskFuncs() {
+		funcs[name] = fn
+	}
+	for name, fn := range truncateFuncs() {
+		funcs[name] = fn
+	}
+	funcs["textTable"] = textTable
+	funcs["formatAddress"] = formatAddress
+	// Bound to the dialect of application/sql renders at execution time (see bindSQLDialect)
+	for name, fn := range sqlFuncs(sqlDialectPostgres) {
+		funcs[name] = fn
+	}
+	// Bound to the request's locale at execution time (see bindLocale)
+	for name, fn := range localeFuncs("en", nil) {
+		funcs[name] = fn
+	}
+
+	return funcs
+}
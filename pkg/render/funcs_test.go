@@ -0,0 +1,12 @@
+package render
+
+import "testing"
+
+func TestFuncs_EnvExcluded(t *testing.T) {
+	funcs := Funcs(true)
+	for _, name := range sprigExcluded {
+		if _, ok := funcs[name]; ok {
+			t.Errorf("Function %q must not be exposed to templates", name)
+		}
+	}
+}
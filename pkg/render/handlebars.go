@@ -0,0 +1,608 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/aymerick/raymond"
+	"github.com/aymerick/raymond/ast"
+	"github.com/aymerick/raymond/parser"
+)
+
+// handlebarsEngine renders Handlebars templates with raymond: paths with
+// this, ../ and @root, the if, unless, each, with, lookup and log helpers,
+// else chains, block parameters, partials with a context or hash arguments,
+// subexpressions and whitespace control. Every template function (Sprig,
+// digest) is a helper called with positional arguments, and eq, ne, lt, le,
+// gt, ge, and, or and not are available for conditions.
+type handlebarsEngine struct{}
+
+// handlebarsBuiltins are the helpers raymond provides itself
+var handlebarsBuiltins = map[string]bool{"if": true, "unless": true, "with": true, "each": true, "log": true, "lookup": true, "equal": true}
+
+// handlebarsTemplate is a parsed Handlebars template with its partials
+type handlebarsTemplate struct {
+	name     string
+	tmpl     *raymond.Template
+	program  *ast.Program            // Syntax tree of the template, for Variables
+	partials map[string]*ast.Program // Syntax trees of the partials
+}
+
+func (handlebarsEngine) Parse(req Request) (Template, error) {
+	if req.LayoutText != "" {
+		return nil, &Error{Message: "layouts are not supported by the handlebars engine", Status: http.StatusBadRequest}
+	}
+	if len(req.Delimiters) > 0 {
+		return nil, &Error{Message: "custom delimiters are not supported by the handlebars engine", Status: http.StatusBadRequest}
+	}
+	missingKey, err := missingKeyOption(req.MissingKey, req.MissingValue != nil)
+	if err != nil {
+		return nil, err
+	}
+	if missingKey == "error" || req.MissingValue != nil {
+		return nil, &Error{Message: "missingKey error and missing value substitutes are not supported by the handlebars engine", Status: http.StatusBadRequest}
+	}
+
+	tmpl, program, err := parseHandlebars(req.Text)
+	if err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	t := &handlebarsTemplate{name: req.Name, tmpl: tmpl, program: program, partials: make(map[string]*ast.Program, len(req.Partials))}
+	usage := scanHandlebars(program)
+	partialUsage := make(map[string]*hbUsage, len(req.Partials))
+	for _, name := range sortedKeys(req.Partials) {
+		partial, program, err := parseHandlebars(req.Partials[name])
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to parse partial %q", name), Status: http.StatusBadRequest, Err: err}
+		}
+		tmpl.RegisterPartialTemplate(name, partial)
+		t.partials[name] = program
+		partialUsage[name] = scanHandlebars(program)
+	}
+	if err := checkHandlebarsPartials(partialUsage); err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+
+	// Helpers are registered with the number of arguments they are called
+	// with, as raymond passes exactly that many. A name printed without
+	// arguments is a call when a function of that name exists, so a name
+	// is either a helper or a plain value throughout.
+	funcs := req.funcMap()
+	for _, u := range partialUsage {
+		usage.merge(u)
+	}
+	for name := range usage.bare {
+		if _, ok := handlebarsFunc(name, funcs); ok {
+			usage.call(name, 0)
+		}
+	}
+	for name, counts := range usage.calls {
+		if handlebarsBuiltins[name] {
+			continue
+		}
+		fn, ok := handlebarsFunc(name, funcs)
+		switch {
+		case !ok:
+			return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: fmt.Errorf("unknown helper %q", name)}
+		case len(counts) > 1:
+			return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: fmt.Errorf("helper %q is called with different numbers of arguments", name)}
+		}
+		for n := range counts {
+			tmpl.RegisterHelper(name, handlebarsHelper(name, fn, n))
+		}
+	}
+	tmpl.RegisterHelper("if", func(conditional interface{}, options *raymond.Options) interface{} {
+		if handlebarsCondition(conditional, options) {
+			return options.Fn()
+		}
+		return options.Inverse()
+	})
+	tmpl.RegisterHelper("unless", func(conditional interface{}, options *raymond.Options) interface{} {
+		if handlebarsCondition(conditional, options) {
+			return options.Inverse()
+		}
+		return options.Fn()
+	})
+	return t, nil
+}
+
+// parseHandlebars parses text for raymond and returns its syntax tree
+func parseHandlebars(text string) (*raymond.Template, *ast.Program, error) {
+	tmpl, err := raymond.Parse(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	program, err := parser.Parse(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tmpl, program, nil
+}
+
+// Execute renders the template with data as the root context
+func (t *handlebarsTemplate) Execute(w io.Writer, data interface{}) (err error) {
+	defer func() {
+		// raymond panics again on runtime errors it does not expect
+		if r := recover(); r != nil {
+			err = fmt.Errorf("template: %s: %v", t.name, r)
+		}
+	}()
+	output, err := t.tmpl.Exec(data)
+	if err != nil {
+		return fmt.Errorf("template: %s: %w", t.name, err)
+	}
+	_, err = io.WriteString(w, output)
+	return err
+}
+
+// handlebarsCondition is the test of if and unless. As in Handlebars,
+// includeZero=true makes 0 pass; raymond only recognises integer zeros,
+// where JSON numbers are floats.
+func handlebarsCondition(value interface{}, options *raymond.Options) bool {
+	if n, ok := hbFloat(value); ok && n == 0 && options.HashProp("includeZero") == true {
+		return true
+	}
+	return raymond.IsTrue(value)
+}
+
+// handlebarsFunc returns the comparison helper or template function name
+func handlebarsFunc(name string, funcs template.FuncMap) (interface{}, bool) {
+	if fn, ok := handlebarsHelpers[name]; ok {
+		return fn, true
+	}
+	fn, ok := funcs[name]
+	return fn, ok
+}
+
+// hbAnyType is the type of helper arguments and results
+var hbAnyType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// handlebarsHelper adapts a template function to a raymond helper taking n
+// arguments, converted to the function's parameter types by callHelper.
+// Without arguments, a value of the same name in the context wins, so data
+// fields may share names with template functions.
+func handlebarsHelper(name string, fn interface{}, n int) interface{} {
+	in := make([]reflect.Type, n+1)
+	for i := 0; i < n; i++ {
+		in[i] = hbAnyType
+	}
+	in[n] = reflect.TypeOf((*raymond.Options)(nil))
+	helperType := reflect.FuncOf(in, []reflect.Type{hbAnyType}, false)
+	return reflect.MakeFunc(helperType, func(args []reflect.Value) []reflect.Value {
+		options := args[n].Interface().(*raymond.Options)
+		if len(options.Hash()) > 0 {
+			panic(fmt.Errorf("helper %q does not take hash arguments", name))
+		}
+		var value interface{}
+		if n == 0 {
+			value = options.Value(name)
+		}
+		if value == nil {
+			params := make([]interface{}, n)
+			for i := range params {
+				params[i] = args[i].Interface()
+			}
+			var err error
+			if value, err = callHelper(fn, params); err != nil {
+				// raymond reports panics with an error as render errors
+				panic(fmt.Errorf("error calling %s: %w", name, err))
+			}
+		}
+		return []reflect.Value{reflect.ValueOf(&value).Elem()}
+	}).Interface()
+}
+
+// hbUsage records the names a template calls as helpers with the numbers
+// of arguments it passes, the names it prints without arguments and the
+// partials it includes
+type hbUsage struct {
+	calls    map[string]map[int]bool
+	bare     map[string]bool
+	partials map[string]bool
+	dynamic  bool // A partial is named by a subexpression
+}
+
+// scanHandlebars collects the usage of a syntax tree
+func scanHandlebars(program *ast.Program) *hbUsage {
+	u := &hbUsage{calls: map[string]map[int]bool{}, bare: map[string]bool{}, partials: map[string]bool{}}
+	u.program(program)
+	return u
+}
+
+func (u *hbUsage) program(program *ast.Program) {
+	if program == nil {
+		return
+	}
+	for _, node := range program.Body {
+		switch n := node.(type) {
+		case *ast.MustacheStatement:
+			u.expr(n.Expression, false)
+		case *ast.BlockStatement:
+			// Blocks without arguments are sections over a value
+			if len(n.Expression.Params) > 0 || n.Expression.Hash != nil {
+				u.expr(n.Expression, true)
+			}
+			u.program(n.Program)
+			u.program(n.Inverse)
+		case *ast.PartialStatement:
+			if sub, ok := n.Name.(*ast.SubExpression); ok {
+				u.dynamic = true
+				u.expr(sub.Expression, true)
+			} else if name, ok := ast.HelperNameStr(n.Name); ok {
+				u.partials[name] = true
+			}
+			u.args(n.Params, n.Hash)
+		}
+	}
+}
+
+// expr records a helper call, or a plain name unless call is set
+func (u *hbUsage) expr(expr *ast.Expression, call bool) {
+	if name := expr.HelperName(); name != "" {
+		if call || len(expr.Params) > 0 || expr.Hash != nil {
+			u.call(name, len(expr.Params))
+		} else {
+			u.bare[name] = true
+		}
+	}
+	u.args(expr.Params, expr.Hash)
+}
+
+func (u *hbUsage) args(params []ast.Node, hash *ast.Hash) {
+	if hash != nil {
+		for _, pair := range hash.Pairs {
+			params = append(params, pair.Val)
+		}
+	}
+	for _, param := range params {
+		if sub, ok := param.(*ast.SubExpression); ok {
+			u.expr(sub.Expression, true)
+		}
+	}
+}
+
+// call records a call of name with n arguments
+func (u *hbUsage) call(name string, n int) {
+	if u.calls[name] == nil {
+		u.calls[name] = map[int]bool{}
+	}
+	u.calls[name][n] = true
+}
+
+// merge adds the calls and plain names of a partial
+func (u *hbUsage) merge(other *hbUsage) {
+	for name, counts := range other.calls {
+		for n := range counts {
+			u.call(name, n)
+		}
+	}
+	for name := range other.bare {
+		u.bare[name] = true
+	}
+}
+
+// checkHandlebarsPartials rejects partials that include themselves, directly
+// or through other partials, and partials named by a subexpression in
+// partials: raymond would recurse without bound, which overflows the stack
+// and cannot be recovered
+func checkHandlebarsPartials(usage map[string]*hbUsage) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(usage))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("partial %q includes itself", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		u := usage[name]
+		if u.dynamic {
+			return fmt.Errorf("partial %q names a partial with a subexpression, which only the template itself may", name)
+		}
+		for next := range u.partials {
+			if _, ok := usage[next]; ok {
+				if err := visit(next); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for name := range usage {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Variables lists the paths the template references. Paths inside #each
+// are reported below the list as ".items[].name" and inside #with below the
+// object; helper names, data variables and block parameters are left out.
+func (t *handlebarsTemplate) Variables() []Variable {
+	found := map[string]*Variable{}
+	add := func(name string) *Variable {
+		v, ok := found[name]
+		if !ok {
+			v = &Variable{Name: name}
+			found[name] = v
+		}
+		return v
+	}
+	// pathName returns the variable a path names in the scopes, or "" for
+	// nodes that are not data
+	pathName := func(node ast.Node, scopes []string, params map[string]bool) string {
+		path, ok := node.(*ast.PathExpression)
+		if !ok || path.Data || len(path.Parts) == 0 {
+			return ""
+		}
+		if path.Depth == 0 && params[path.Parts[0]] {
+			return ""
+		}
+		scope := len(scopes) - 1 - path.Depth
+		if scope < 0 {
+			scope = 0
+		}
+		return scopes[scope] + "." + strings.Join(path.Parts, ".")
+	}
+
+	var walkProgram func(program *ast.Program, scopes []string, params map[string]bool)
+	var walkExpr func(expr *ast.Expression, scopes []string, params map[string]bool, call bool)
+	walkExpr = func(expr *ast.Expression, scopes []string, params map[string]bool, call bool) {
+		if !call && len(expr.Params) == 0 && expr.Hash == nil {
+			if name := pathName(expr.Path, scopes, params); name != "" {
+				add(name)
+			}
+			return
+		}
+		args := expr.Params
+		if expr.Hash != nil {
+			for _, pair := range expr.Hash.Pairs {
+				args = append(args, pair.Val)
+			}
+		}
+		for _, arg := range args {
+			if sub, ok := arg.(*ast.SubExpression); ok {
+				walkExpr(sub.Expression, scopes, params, true)
+			} else if name := pathName(arg, scopes, params); name != "" {
+				add(name)
+			}
+		}
+	}
+	walkProgram = func(program *ast.Program, scopes []string, params map[string]bool) {
+		if program == nil {
+			return
+		}
+		if len(program.BlockParams) > 0 {
+			inner := make(map[string]bool, len(params)+len(program.BlockParams))
+			for name := range params {
+				inner[name] = true
+			}
+			for _, name := range program.BlockParams {
+				inner[name] = true
+			}
+			params = inner
+		}
+		for _, node := range program.Body {
+			switch n := node.(type) {
+			case *ast.MustacheStatement:
+				walkExpr(n.Expression, scopes, params, false)
+			case *ast.PartialStatement:
+				// Partials do not include themselves, which Parse checks
+				name, _ := ast.HelperNameStr(n.Name)
+				if partial, ok := t.partials[name]; ok {
+					inner := scopes
+					if len(n.Params) > 0 {
+						if name := pathName(n.Params[0], scopes, params); name != "" {
+							inner = append(append([]string(nil), scopes...), name)
+						}
+					}
+					walkProgram(partial, inner, params)
+				}
+			case *ast.BlockStatement:
+				expr := n.Expression
+				helper := expr.HelperName()
+				programScopes := scopes
+				switch {
+				case n.Program == nil:
+					walkExpr(expr, scopes, params, false)
+				case helper == "each" || helper == "with":
+					walkExpr(expr, scopes, params, true)
+					if len(expr.Params) == 1 {
+						if name := pathName(expr.Params[0], scopes, params); name != "" {
+							if helper == "each" {
+								add(name).Iterated = true
+								name += "[]"
+							}
+							programScopes = append(append([]string(nil), scopes...), name)
+						}
+					}
+				case helper == "if" || helper == "unless" || len(expr.Params) > 0 || expr.Hash != nil:
+					walkExpr(expr, scopes, params, true)
+				default:
+					if name := pathName(expr.Path, scopes, params); name != "" {
+						add(name).Iterated = true
+						programScopes = append(append([]string(nil), scopes...), name+"[]")
+					}
+				}
+				walkProgram(n.Program, programScopes, params)
+				walkProgram(n.Inverse, scopes, params)
+			}
+		}
+	}
+	walkProgram(t.program, []string{""}, nil)
+
+	variables := make([]Variable, 0, len(found))
+	for _, v := range found {
+		variables = append(variables, *v)
+	}
+	return variables
+}
+
+// callHelper calls a template function with positional arguments,
+// converting numbers to the parameter types
+func callHelper(fn interface{}, args []interface{}) (result interface{}, err error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	n := ft.NumIn()
+	if (ft.IsVariadic() && len(args) < n-1) || (!ft.IsVariadic() && len(args) != n) {
+		return nil, fmt.Errorf("wrong number of arguments: got %d, want %d", len(args), n)
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var pt reflect.Type
+		if ft.IsVariadic() && i >= n-1 {
+			pt = ft.In(n - 1).Elem()
+		} else {
+			pt = ft.In(i)
+		}
+		if in[i], err = helperArg(arg, pt); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+	}
+
+	// Template functions may panic on bad input, as text/template expects
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	out := fv.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// helperArg converts an argument to a helper parameter type
+func helperArg(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	if hbNumeric(v.Kind()) && hbNumeric(t.Kind()) {
+		return v.Convert(t), nil
+	}
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(hbString(arg)).Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %T as %s", arg, t)
+}
+
+func hbNumeric(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// handlebarsHelpers are the comparison and logic helpers commonly used
+// with Handlebars, which text/template provides as built-ins
+var handlebarsHelpers = template.FuncMap{
+	"eq":  func(a, b interface{}) bool { c, ok := hbCompare(a, b); return ok && c == 0 },
+	"ne":  func(a, b interface{}) bool { c, ok := hbCompare(a, b); return !ok || c != 0 },
+	"lt":  func(a, b interface{}) bool { c, ok := hbCompare(a, b); return ok && c < 0 },
+	"le":  func(a, b interface{}) bool { c, ok := hbCompare(a, b); return ok && c <= 0 },
+	"gt":  func(a, b interface{}) bool { c, ok := hbCompare(a, b); return ok && c > 0 },
+	"ge":  func(a, b interface{}) bool { c, ok := hbCompare(a, b); return ok && c >= 0 },
+	"not": func(v interface{}) bool { return !hbTruthy(v, false) },
+	"and": func(values ...interface{}) bool {
+		for _, v := range values {
+			if !hbTruthy(v, false) {
+				return false
+			}
+		}
+		return len(values) > 0
+	},
+	"or": func(values ...interface{}) bool {
+		for _, v := range values {
+			if hbTruthy(v, false) {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// hbCompare orders two values, numerically when both are numbers. The
+// boolean is false when only equality can be decided and they differ.
+func hbCompare(a, b interface{}) (int, bool) {
+	if x, ok := hbFloat(a); ok {
+		if y, ok := hbFloat(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if a == nil || b == nil {
+		return 0, a == nil && b == nil
+	}
+	return strings.Compare(hbString(a), hbString(b)), true
+}
+
+func hbFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch {
+	case !v.IsValid():
+		return 0, false
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return float64(v.Int()), true
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		return float64(v.Uint()), true
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// hbTruthy reports whether a value passes #if: false, nil, empty strings,
+// empty lists and zero (unless includeZero) do not
+func hbTruthy(value interface{}, includeZero bool) bool {
+	if n, ok := hbFloat(value); ok {
+		return n != 0 || includeZero
+	}
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		return rv.Len() > 0
+	}
+	return true
+}
+
+// hbString formats a value for output; whole floats print without a fraction
+func hbString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func renderHandlebars(t *testing.T, req Request) (string, error) {
+	t.Helper()
+	req.Engine = "handlebars"
+	return Render(context.Background(), req, DefaultLimits)
+}
+
+func TestHandlebars(t *testing.T) {
+	data := map[string]interface{}{
+		"name":    "Chris",
+		"title":   "Report",
+		"html":    "<b>&\"'=</b>",
+		"empty":   []interface{}{},
+		"zero":    float64(0),
+		"count":   float64(3),
+		"person":  map[string]interface{}{"first": "Ada", "address": map[string]interface{}{"city": "London"}},
+		"items":   []interface{}{map[string]interface{}{"n": "a"}, map[string]interface{}{"n": "b"}},
+		"enabled": true,
+	}
+	tests := []struct {
+		name     string
+		text     string
+		partials map[string]string
+		want     string
+	}{
+		{"variable", "Hello {{name}}!", nil, "Hello Chris!"},
+		{"escaped", "{{html}}", nil, "&lt;b&gt;&amp;&quot;&apos;=&lt;/b&gt;"},
+		{"triple", "{{{html}}}", nil, `<b>&"'=</b>`},
+		{"ampersand", "{{& html}}", nil, `<b>&"'=</b>`},
+		{"missing", "[{{nope}}]", nil, "[]"},
+		{"paths", "{{person.address.city}} {{person/first}} {{items.[1].n}} {{this.name}}", nil, "London Ada b Chris"},
+		{"if else", "{{#if enabled}}on{{else}}off{{/if}} {{#if empty}}x{{else}}none{{/if}}", nil, "on none"},
+		{"else if", "{{#if empty}}a{{else if zero}}b{{else if count}}c{{else}}d{{/if}}", nil, "c"},
+		{"include zero", "{{#if zero}}x{{/if}}{{#if zero includeZero=true}}zero{{/if}}", nil, "zero"},
+		{"unless", "{{#unless enabled}}off{{else}}on{{/unless}}", nil, "on"},
+		{"each", "{{#each items}}{{@index}}:{{n}}{{#if @first}}(first){{/if}}{{#unless @last}},{{/unless}}{{/each}}", nil, "0:a(first),1:b"},
+		{"each object", "{{#each person.address}}{{@key}}={{this}}{{/each}}", nil, "city=London"},
+		{"each else", "{{#each empty}}x{{else}}nothing{{/each}}", nil, "nothing"},
+		{"block params", "{{#each items as |item i|}}{{i}}{{item.n}}{{/each}}", nil, "0a1b"},
+		{"parent and root", "{{#each items}}{{n}}-{{../name}}-{{@root.title}} {{/each}}", nil, "a-Chris-Report b-Chris-Report "},
+		{"with", "{{#with person}}{{first}} from {{address.city}}{{/with}}{{#with nope}}x{{else}}-{{/with}}", nil, "Ada from London-"},
+		{"section", "{{#items}}<{{n}}>{{/items}}{{^empty}}none{{/empty}}", nil, "<a><b>none"},
+		{"helpers", "{{upper name}} {{lookup person \"first\"}} {{#if (gt count 2)}}many{{/if}} {{join \"-\" (list \"a\" \"b\")}}", nil, "CHRIS Ada many a-b"},
+		{"data shadows helper", "{{title}}", nil, "Report"},
+		{"comments", "a{{! short }}b{{!-- long }} --}}c", nil, "abc"},
+		{"whitespace control", "<ul>\n  {{~#each items~}}\n    <li>{{n}}</li>\n  {{~/each~}}\n</ul>", nil, "<ul><li>a</li><li>b</li></ul>"},
+		{"standalone", "begin\n  {{#each items}}\n  {{n}}\n  {{/each}}\nend\n", nil, "begin\n  a\n  b\nend\n"},
+		{"escaped mustache", `\{{name}}`, nil, "{{name}}"},
+		{"partial", "{{#each items}}{{> item}}{{/each}}", map[string]string{"item": "({{n}})"}, "(a)(b)"},
+		{"partial context", "{{> card person}}", map[string]string{"card": "{{first}} from {{address.city}}"}, "Ada from London"},
+		{"partial hash", "{{> card greeting=\"Hi\" who=person.first}}", map[string]string{"card": "{{greeting}} {{who}}"}, "Hi Ada"},
+		{"dynamic partial", "{{> (lower \"CARD\")}}", map[string]string{"card": "{{name}}"}, "Chris"},
+		{"indented partial", "list:\n  {{> lines}}\n", map[string]string{"lines": "one\ntwo\n"}, "list:\n  one\n  two\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderHandlebars(t, Request{Text: tt.text, Partials: tt.partials, Parameters: data})
+			if err != nil {
+				t.Fatalf("render returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlebarsOptionsAndErrors(t *testing.T) {
+	value := "n/a"
+	if _, err := renderHandlebars(t, Request{Text: "{{nope}}", MissingValue: &value}); err == nil {
+		t.Error("Expected missing value substitutes to be rejected")
+	}
+	if _, err := renderHandlebars(t, Request{Text: "{{nope}}", MissingKey: "error"}); err == nil {
+		t.Error("Expected missingKey error to be rejected")
+	}
+	if _, err := renderHandlebars(t, Request{Text: "{{name}}", Delimiters: []string{"<%", "%>"}}); err == nil {
+		t.Error("Expected custom delimiters to be rejected")
+	}
+
+	for _, text := range []string{"{{#if a}}", "{{#if a}}{{/each}}", "{{/if}}", "{{name", "{{else}}", "{{#> layout}}{{/layout}}", "{{upper (lower name}}", "{{nosuchhelper 1}}", "{{and a b}}{{and a b c}}"} {
+		if _, err := renderHandlebars(t, Request{Text: text}); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("%q: expected a parse error, got %v", text, err)
+		}
+	}
+	for _, text := range []string{"{{> nope}}", "{{upper}}", "{{upper name x=1}}"} {
+		if _, err := renderHandlebars(t, Request{Text: text}); err == nil {
+			t.Errorf("%q: expected a render error", text)
+		}
+	}
+	for _, partials := range []map[string]string{
+		{"self": "x{{> self}}"},
+		{"a": "{{> b}}", "b": "{{#if x}}{{> a}}{{/if}}"},
+		{"self": "{{> (lower \"SELF\")}}"},
+	} {
+		if _, err := renderHandlebars(t, Request{Text: "{{> self}}{{> a}}", Partials: partials}); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("%v: expected recursive partials to be rejected, got %v", partials, err)
+		}
+	}
+}
+
+func TestHandlebarsVariables(t *testing.T) {
+	variables, err := engineVariables(Request{
+		Engine:   "handlebars",
+		Text:     "{{title}} {{#each items as |item|}}{{name}}{{item.id}}{{../site}}{{@index}}{{/each}}{{#if (eq status \"open\")}}{{#with owner}}{{email}}{{/with}}{{/if}} {{> footer}}",
+		Partials: map[string]string{"footer": "{{company}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range variables {
+		names = append(names, v.Name)
+	}
+	if got := strings.Join(names, " "); got != ".company .items .items[].name .owner .owner.email .site .status .title" {
+		t.Errorf("Unexpected variables %q", got)
+	}
+}
@@ -0,0 +1,314 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// numberSymbols are the decimal and grouping separators of a locale
+type numberSymbols struct {
+	Decimal, Group string
+}
+
+// languageNumberSymbols holds the separators by language; locales of other
+// languages use the English ones
+var languageNumberSymbols = map[string]numberSymbols{
+	"en": {".", ","},
+	"de": {",", "."},
+	"fr": {",", "\u202f"},
+	"es": {",", "."},
+	"it": {",", "."},
+	"nl": {",", "."},
+	"pt": {",", "."},
+}
+
+// regionNumberSymbols overrides the separators of a language in a region
+var regionNumberSymbols = map[string]numberSymbols{
+	"de-CH": {".", "’"},
+	"it-CH": {".", "’"},
+	"fr-CH": {",", "\u202f"},
+	"de-AT": {",", "\u00a0"},
+	"pt-PT": {",", "\u00a0"},
+}
+
+// compactSuffixes are the suffixes of thousands, millions, billions and
+// trillions in humanizeNumber, by language
+var compactSuffixes = map[string][4]string{
+	"en": {"K", "M", "B", "T"},
+	"de": {" Tsd.", " Mio.", " Mrd.", " Bio."},
+	"fr": {" k", " M", " Md", " Bn"},
+	"es": {" mil", " M", " mil M", " B"},
+	"it": {" mila", " Mln", " Mrd", " Bln"},
+	"nl": {"K", " mln.", " mld.", " bln."},
+	"pt": {" mil", " mi", " bi", " tri"},
+}
+
+// localeLanguage returns the language of a locale (de for de-CH)
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	return language
+}
+
+// numberSymbolsFor returns the separators of a locale
+func numberSymbolsFor(locale string) numberSymbols {
+	if symbols, ok := regionNumberSymbols[locale]; ok {
+		return symbols
+	}
+	if symbols, ok := languageNumberSymbols[localeLanguage(locale)]; ok {
+		return symbols
+	}
+	return languageNumberSymbols["en"]
+}
+
+// humanizeFuncs are the pluralization and humanizing helpers of a render
+// in locale:
+//
+//	{{.Count}} {{pluralize .Count "file" "files"}}
+//	{{ordinal .Rank}} place
+//	{{humanizeNumber .Followers}} followers      → 12.3K
+//	{{humanizeBytes .Size}}                      → 4.2 MB
+func humanizeFuncs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"pluralize": func(count interface{}, forms ...string) (string, error) {
+			return pluralize(locale, count, forms)
+		},
+		"ordinal": func(n interface{}) (string, error) {
+			return ordinal(locale, n)
+		},
+		"humanizeNumber": func(n interface{}) (string, error) {
+			return humanizeNumber(locale, n)
+		},
+		"humanizeBytes": func(n interface{}) (string, error) {
+			return humanizeBytes(locale, n)
+		},
+	}
+}
+
+// numberValue interprets a template value as a number
+func numberValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot interpret %v (%T) as a number", value, value)
+}
+
+// pluralCategory returns the index of the plural form of n in a language,
+// with the forms in CLDR order (one, few, many, other) as far as the
+// language distinguishes them
+func pluralCategory(language string, n float64) int {
+	if n != math.Trunc(n) {
+		// Fractions take the last form
+		return math.MaxInt
+	}
+	i := int64(math.Abs(n))
+	mod10, mod100 := i%10, i%100
+	switch language {
+	case "ja", "ko", "zh", "th", "vi", "id":
+		return 0
+	case "fr", "pt":
+		if i <= 1 {
+			return 0
+		}
+		return 1
+	case "ru", "uk", "be":
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return 0
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return 1
+		}
+		return 2
+	case "pl":
+		switch {
+		case i == 1:
+			return 0
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return 1
+		}
+		return 2
+	case "cs", "sk":
+		switch {
+		case i == 1:
+			return 0
+		case i >= 2 && i <= 4:
+			return 1
+		}
+		return 2
+	}
+	if i == 1 {
+		return 0
+	}
+	return 1
+}
+
+// pluralize returns the form of a word for count. Forms are given in the
+// order the language's plural categories (one, few, many, other), the last
+// form serving the categories beyond those given. A single English form is
+// pluralized by the usual suffix rules.
+func pluralize(locale string, count interface{}, forms []string) (string, error) {
+	if len(forms) == 0 {
+		return "", fmt.Errorf("pluralize expects a count and at least one form")
+	}
+	n, err := numberValue(count)
+	if err != nil {
+		return "", err
+	}
+	language := localeLanguage(locale)
+	if len(forms) == 1 && language == "en" {
+		forms = append(forms, englishPlural(forms[0]))
+	}
+	index := min(pluralCategory(language, n), len(forms)-1)
+	return forms[index], nil
+}
+
+// englishPlural returns the regular English plural of word
+func englishPlural(word string) string {
+	lower := strings.ToLower(word)
+	switch {
+	case word == "":
+		return word
+	case len(lower) > 1 && strings.HasSuffix(lower, "y") && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return word[:len(word)-1] + "ies"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return word + "es"
+	}
+	return word + "s"
+}
+
+// ordinal returns n as an ordinal number in the locale's language (1st,
+// 1., 1er, 1.º), English for languages without a built-in rule
+func ordinal(locale string, value interface{}) (string, error) {
+	f, err := numberValue(value)
+	if err != nil {
+		return "", err
+	}
+	if f != math.Trunc(f) {
+		return "", fmt.Errorf("ordinal of a fraction %v", value)
+	}
+	n := int64(f)
+	s := strconv.FormatInt(n, 10)
+	switch localeLanguage(locale) {
+	case "de", "da", "no", "nb", "fi", "cs", "sk", "pl":
+		return s + ".", nil
+	case "fr":
+		if n == 1 {
+			return s + "er", nil
+		}
+		return s + "e", nil
+	case "nl":
+		return s + "e", nil
+	case "es":
+		return s + ".º", nil
+	case "it", "pt":
+		return s + "º", nil
+	}
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs%100 >= 11 && abs%100 <= 13:
+		return s + "th", nil
+	case abs%10 == 1:
+		return s + "st", nil
+	case abs%10 == 2:
+		return s + "nd", nil
+	case abs%10 == 3:
+		return s + "rd", nil
+	}
+	return s + "th", nil
+}
+
+// humanizeNumber abbreviates large numbers to one decimal with the
+// locale's suffixes (12.3K, 4,5 Mio.). Numbers below a thousand are kept.
+func humanizeNumber(locale string, value interface{}) (string, error) {
+	n, err := numberValue(value)
+	if err != nil {
+		return "", err
+	}
+	suffixes, ok := compactSuffixes[localeLanguage(locale)]
+	if !ok {
+		suffixes = compactSuffixes["en"]
+	}
+	scaled, suffix := n, ""
+	for i := len(suffixes) - 1; i >= 0; i-- {
+		if unit := math.Pow(1000, float64(i+1)); math.Abs(n) >= unit {
+			scaled, suffix = n/unit, suffixes[i]
+			// 999,950 rounds up to the next suffix rather than to 1000K
+			if math.Abs(math.Round(scaled*10)/10) >= 1000 && i+1 < len(suffixes) {
+				scaled, suffix = scaled/1000, suffixes[i+1]
+			}
+			break
+		}
+	}
+	if suffix == "" {
+		return localizeDecimal(locale, strconv.FormatFloat(n, 'f', -1, 64)), nil
+	}
+	return oneDecimal(locale, scaled) + suffix, nil
+}
+
+// humanizeBytes formats a byte count in decimal (SI) units with one
+// decimal, octets for French (4.2 MB, 4,2 Mo)
+func humanizeBytes(locale string, value interface{}) (string, error) {
+	n, err := numberValue(value)
+	if err != nil {
+		return "", err
+	}
+	unit := "B"
+	if localeLanguage(locale) == "fr" {
+		unit = "o"
+	}
+	prefixes := []string{"", "k", "M", "G", "T", "P", "E"}
+	i := 0
+	for math.Abs(math.Round(n*10)/10) >= 1000 && i < len(prefixes)-1 {
+		n /= 1000
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatFloat(n, 'f', 0, 64) + " " + unit, nil
+	}
+	return oneDecimal(locale, n) + " " + prefixes[i] + unit, nil
+}
+
+// oneDecimal formats n with at most one decimal in the locale
+func oneDecimal(locale string, n float64) string {
+	s := strconv.FormatFloat(math.Round(n*10)/10, 'f', 1, 64)
+	return localizeDecimal(locale, strings.TrimSuffix(s, ".0"))
+}
+
+// localizeDecimal replaces the decimal point of a formatted number with the
+// locale's decimal separator
+func localizeDecimal(locale, s string) string {
+	return strings.Replace(s, ".", numberSymbolsFor(locale).Decimal, 1)
+}
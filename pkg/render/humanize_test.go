@@ -0,0 +1,93 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHumanizeTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{.Count}} {{pluralize .Count "reply"}}, {{ordinal .Rank}}, {{humanizeNumber .Views}}, {{humanizeBytes .Size}}`,
+		Parameters: map[string]interface{}{"Count": float64(3), "Rank": float64(22), "Views": float64(12345), "Size": float64(4200000)},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "3 replies, 22nd, 12.3K, 4.2 MB"
+	if output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	tests := []struct {
+		locale string
+		count  interface{}
+		forms  []string
+		want   string
+	}{
+		{"en", 1, []string{"box"}, "box"},
+		{"en", 0, []string{"box"}, "boxes"},
+		{"en-GB", 2, []string{"day"}, "days"},
+		{"en", 1.5, []string{"hour", "hours"}, "hours"},
+		{"de", 1, []string{"Datei", "Dateien"}, "Datei"},
+		{"fr", 0, []string{"fichier", "fichiers"}, "fichier"},
+		{"ru", 21, []string{"файл", "файла", "файлов"}, "файл"},
+		{"ru", 3, []string{"файл", "файла", "файлов"}, "файла"},
+		{"ru", 12, []string{"файл", "файла", "файлов"}, "файлов"},
+		{"pl", 25, []string{"plik", "pliki"}, "pliki"},
+		{"ja", 5, []string{"ファイル"}, "ファイル"},
+		{"en", "2", []string{"item", "items"}, "items"},
+	}
+	for _, tt := range tests {
+		got, err := pluralize(tt.locale, tt.count, tt.forms)
+		if err != nil || got != tt.want {
+			t.Errorf("pluralize(%q, %v, %v) = %q, %v; want %q", tt.locale, tt.count, tt.forms, got, err, tt.want)
+		}
+	}
+	if _, err := pluralize("en", 1, nil); err == nil {
+		t.Error("Expected an error without forms")
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	tests := []struct {
+		locale string
+		n      int
+		want   string
+	}{
+		{"en", 1, "1st"}, {"en", 2, "2nd"}, {"en", 3, "3rd"}, {"en", 11, "11th"},
+		{"en", 112, "112th"}, {"en", 101, "101st"}, {"de", 3, "3."}, {"fr", 1, "1er"},
+		{"fr", 2, "2e"}, {"es", 4, "4.º"}, {"sv", 2, "2nd"},
+	}
+	for _, tt := range tests {
+		if got, err := ordinal(tt.locale, tt.n); err != nil || got != tt.want {
+			t.Errorf("ordinal(%q, %d) = %q, %v; want %q", tt.locale, tt.n, got, err, tt.want)
+		}
+	}
+}
+
+func TestHumanizeNumbers(t *testing.T) {
+	tests := []struct {
+		locale string
+		fn     func(string, interface{}) (string, error)
+		n      float64
+		want   string
+	}{
+		{"en", humanizeNumber, 999, "999"},
+		{"en", humanizeNumber, 1000, "1K"},
+		{"en", humanizeNumber, -2500000, "-2.5M"},
+		{"en", humanizeNumber, 999950, "1M"},
+		{"de", humanizeNumber, 4530000, "4,5 Mio."},
+		{"de-CH", humanizeNumber, 12.5, "12.5"},
+		{"en", humanizeBytes, 512, "512 B"},
+		{"en", humanizeBytes, 1536, "1.5 kB"},
+		{"fr", humanizeBytes, 3200000000, "3,2 Go"},
+		{"en", humanizeBytes, 999999, "1 MB"},
+	}
+	for _, tt := range tests {
+		if got, err := tt.fn(tt.locale, tt.n); err != nil || got != tt.want {
+			t.Errorf("%s %v = %q, %v; want %q", tt.locale, tt.n, got, err, tt.want)
+		}
+	}
+}
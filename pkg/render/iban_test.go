@@ -0,0 +1,29 @@
+package render
+
+import "testing"
+
+func TestIBAN(t *testing.T) {
+	valid := map[string]string{
+		"DE89370400440532013000":      "DE89 3704 0044 0532 0130 00",
+		"ch93 0076 2011 6238 5295 7":  "CH93 0076 2011 6238 5295 7",
+		"GB29-NWBK-6016-1331-9268-19": "GB29 NWBK 6016 1331 9268 19",
+		"NO9386011117947":             "NO93 8601 1117 947",
+	}
+	for input, want := range valid {
+		if !validIBAN(input) {
+			t.Errorf("validIBAN(%q) = false", input)
+		}
+		if got, err := formatIBAN(input); err != nil || got != want {
+			t.Errorf("formatIBAN(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []interface{}{"DE89370400440532013001", "DE8937040044053201300", "XX89370400440532013000", "DE89 3704 0044 0532 0130 0!", nil} {
+		if validIBAN(input) {
+			t.Errorf("validIBAN(%v) = true", input)
+		}
+		if _, err := formatIBAN(input); err == nil {
+			t.Errorf("formatIBAN(%v) should fail", input)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// jinjaEngine renders Jinja2-style templates with pongo2: Django and Jinja2
+// filters and tags, macros, include and import, and template inheritance
+// with extends, block and block.Super. Templates named by extends, include
+// and import come from the request's partials. The Ansible "#jinja2:"
+// header selects trim_blocks, lstrip_blocks and keep_trailing_newline;
+// autoescaping is off as in plain Jinja2.
+type jinjaEngine struct{}
+
+// jinjaBannedTags are the pongo2 tags templates may not use: ssi reads
+// server files, lorem generates unbounded text
+var jinjaBannedTags = []string{"ssi", "lorem"}
+
+// jinjaBannedFilters pad their input to a width the template chooses, which
+// would allocate before the output limit applies
+var jinjaBannedFilters = []string{"center", "ljust", "rjust"}
+
+// jinjaMaxLoads bounds the partials loaded while parsing one template, so
+// templates that include themselves fail instead of recursing forever
+const jinjaMaxLoads = 1000
+
+var (
+	jinjaHeader         = regexp.MustCompile(`^#jinja2:([^\n]*)\n?`)
+	jinjaDynamicInclude = regexp.MustCompile(`\{%-?\s*include\s+[^"'\s]`)
+	jinjaMacroBody      = regexp.MustCompile(`(?s)\{%-?\s*macro\s.*?%\}(.*?)\{%-?\s*endmacro\s*-?%\}`)
+	jinjaTag            = regexp.MustCompile(`(?s)\{\{.*?\}\}|\{%.*?%\}`)
+	jinjaStringLiteral  = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	jinjaCall           = regexp.MustCompile(`(?:^|[^\w.])([A-Za-z_]\w*)\s*\(`)
+	jinjaIncludeTag     = regexp.MustCompile(`^\{%-?\s*include\b`)
+
+	errJinjaDynamicInclude = errors.New("include needs the partial's name in quotes")
+)
+
+// jinjaKeywords may precede a parenthesis without being called
+var jinjaKeywords = map[string]bool{"if": true, "elif": true, "and": true, "or": true, "not": true, "in": true, "for": true, "set": true, "with": true, "filter": true}
+
+func init() {
+	pongo2.SetAutoescape(false)
+}
+
+// jinjaTemplate is a parsed Jinja2 template
+type jinjaTemplate struct {
+	name string
+	tmpl *pongo2.Template
+}
+
+func (jinjaEngine) Parse(req Request) (Template, error) {
+	if req.LayoutText != "" {
+		return nil, &Error{Message: "layouts are not supported by the jinja2 engine, use extends", Status: http.StatusBadRequest}
+	}
+	if len(req.Delimiters) > 0 {
+		return nil, &Error{Message: "custom delimiters are not supported by the jinja2 engine", Status: http.StatusBadRequest}
+	}
+	missingKey, err := missingKeyOption(req.MissingKey, req.MissingValue != nil)
+	if err != nil {
+		return nil, err
+	}
+	if missingKey == "error" || req.MissingValue != nil {
+		return nil, &Error{Message: "missingKey error and missing value substitutes are not supported by the jinja2 engine, use the default filter", Status: http.StatusBadRequest}
+	}
+
+	opts, text, err := parseJinjaHeader(req.Text)
+	if err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	funcs := req.funcMap()
+	if err := checkJinjaRecursion(text, funcs); err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	for _, name := range sortedKeys(req.Partials) {
+		if err := checkJinjaRecursion(req.Partials[name], funcs); err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to parse partial %q", name), Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	set := pongo2.NewSet("request", &jinjaLoader{partials: req.Partials})
+	for _, tag := range jinjaBannedTags {
+		if err := set.BanTag(tag); err != nil {
+			return nil, &Error{Message: "failed to prepare the jinja2 engine", Status: http.StatusInternalServerError, Err: err}
+		}
+	}
+	for _, filter := range jinjaBannedFilters {
+		if err := set.BanFilter(filter); err != nil {
+			return nil, &Error{Message: "failed to prepare the jinja2 engine", Status: http.StatusInternalServerError, Err: err}
+		}
+	}
+	set.Options.TrimBlocks = opts.trimBlocks
+	set.Options.LStripBlocks = opts.lstripBlocks
+	// Template functions are called as functions, e.g. {{ upper(name) }}
+	for name, fn := range funcs {
+		set.Globals[name] = fn
+	}
+
+	if !opts.keepTrailingNewline {
+		text = strings.TrimSuffix(text, "\n")
+	}
+	tmpl, err := set.FromString(text)
+	if err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	return &jinjaTemplate{name: req.Name, tmpl: tmpl}, nil
+}
+
+// Execute renders the template with data, a map of parameters, as the
+// context. Parameters whose names are not identifiers are left out.
+func (t *jinjaTemplate) Execute(w io.Writer, data interface{}) (err error) {
+	ctx := pongo2.Context{}
+	if params, ok := data.(map[string]interface{}); ok {
+		for name, value := range params {
+			if jinjaIdentifier.MatchString(name) {
+				ctx[name] = jinjaValue(value)
+			}
+		}
+	}
+	defer func() {
+		// pongo2 panics on some runtime errors, such as division by zero
+		if r := recover(); r != nil {
+			err = fmt.Errorf("template: %s: %v", t.name, r)
+		}
+	}()
+	if err := t.tmpl.ExecuteWriterUnbuffered(ctx, w); err != nil {
+		return fmt.Errorf("template: %s: %w", t.name, err)
+	}
+	return nil
+}
+
+// jinjaFloat prints a float parameter as JSON does, where pongo2 would
+// print six decimals
+type jinjaFloat float64
+
+func (f jinjaFloat) String() string { return strconv.FormatFloat(float64(f), 'f', -1, 64) }
+
+// jinjaValue prepares a parameter for pongo2: whole JSON numbers become
+// integers, so they print and divide as in Python, and other floats print
+// without trailing zeros
+func jinjaValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v)
+		}
+		return jinjaFloat(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = jinjaValue(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = jinjaValue(item)
+		}
+		return items
+	}
+	return value
+}
+
+// checkJinjaRecursion rejects the constructs pongo2 would recurse on without
+// bound, which overflows the stack and cannot be recovered: includes named by
+// an expression, and macros that call anything but template functions or
+// include partials. Static includes are resolved while parsing, where
+// jinjaMaxLoads bounds them.
+func checkJinjaRecursion(text string, funcs template.FuncMap) error {
+	if jinjaDynamicInclude.MatchString(text) {
+		return errJinjaDynamicInclude
+	}
+	for _, body := range jinjaMacroBody.FindAllStringSubmatch(text, -1) {
+		for _, tag := range jinjaTag.FindAllString(body[1], -1) {
+			if jinjaIncludeTag.MatchString(tag) {
+				return errors.New("macros cannot include partials")
+			}
+			for _, call := range jinjaCall.FindAllStringSubmatch(jinjaStringLiteral.ReplaceAllString(tag, ""), -1) {
+				if _, ok := funcs[call[1]]; !ok && !jinjaKeywords[call[1]] {
+					return fmt.Errorf("macros can only call template functions, not %s()", call[1])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jinjaIdentifier matches the names pongo2 accepts as context variables
+var jinjaIdentifier = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// jinjaLoader serves the request's partials to extends, include and import
+type jinjaLoader struct {
+	partials map[string]string
+	loads    int
+}
+
+func (l *jinjaLoader) Abs(base, name string) string {
+	return name
+}
+
+func (l *jinjaLoader) Get(name string) (io.Reader, error) {
+	if l.loads++; l.loads > jinjaMaxLoads {
+		return nil, fmt.Errorf("more than %d partials loaded, do partials include themselves?", jinjaMaxLoads)
+	}
+	text, ok := l.partials[name]
+	if !ok {
+		return nil, fmt.Errorf("partial %q not found", name)
+	}
+	return bytes.NewReader([]byte(text)), nil
+}
+
+// jinjaOptions are the Ansible-style "#jinja2:" header options
+type jinjaOptions struct {
+	trimBlocks, lstripBlocks, keepTrailingNewline bool
+}
+
+// parseJinjaHeader reads the "#jinja2: trim_blocks: True, ..." line
+func parseJinjaHeader(text string) (jinjaOptions, string, error) {
+	var opts jinjaOptions
+	m := jinjaHeader.FindStringSubmatch(text)
+	if m == nil {
+		return opts, text, nil
+	}
+	for _, setting := range strings.Split(m[1], ",") {
+		name, value, ok := strings.Cut(setting, ":")
+		if !ok {
+			return opts, text, fmt.Errorf("invalid #jinja2 setting %q", strings.TrimSpace(setting))
+		}
+		on := strings.EqualFold(strings.TrimSpace(value), "true")
+		switch strings.TrimSpace(name) {
+		case "trim_blocks":
+			opts.trimBlocks = on
+		case "lstrip_blocks":
+			opts.lstripBlocks = on
+		case "keep_trailing_newline":
+			opts.keepTrailingNewline = on
+		case "newline_sequence", "variable_start_string", "variable_end_string", "block_start_string", "block_end_string":
+			return opts, text, fmt.Errorf("#jinja2 setting %q is not supported", strings.TrimSpace(name))
+		default:
+			return opts, text, fmt.Errorf("unknown #jinja2 setting %q", strings.TrimSpace(name))
+		}
+	}
+	return opts, text[len(m[0]):], nil
+}
@@ -0,0 +1,157 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func renderJinja(t *testing.T, req Request) (string, error) {
+	t.Helper()
+	req.Engine = "jinja2"
+	return Render(context.Background(), req, DefaultLimits)
+}
+
+func jinjaTestData() map[string]interface{} {
+	return map[string]interface{}{
+		"name":   "Chris",
+		"count":  float64(3),
+		"price":  2.5,
+		"empty":  []interface{}{},
+		"tags":   []interface{}{"b", "a", "c"},
+		"person": map[string]interface{}{"first": "Ada", "address": map[string]interface{}{"city": "London"}},
+		"users": []interface{}{
+			map[string]interface{}{"name": "bob", "age": float64(40), "active": true},
+			map[string]interface{}{"name": "alice", "age": float64(30), "active": false},
+		},
+		"ports":      map[string]interface{}{"http": float64(80), "https": float64(443)},
+		"first-name": "skipped",
+	}
+}
+
+func TestJinja(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"variable", "Hello {{ name }}!", "Hello Chris!"},
+		{"attributes", "{{ person.first }} {{ person.address.city }} {{ tags.0 }} {{ tags[1] }}", "Ada London b a"},
+		{"undefined", "[{{ nope }}][{{ nope.deeper }}]", "[][]"},
+		{"numbers", "{{ count + 1 }} {{ count / 2 }} {{ 7 % 3 }} {{ -count }} {{ price }}", "4 1 1 -3 2.5"},
+		{"comparison", "{{ count > 2 and count <= 3 }} {{ name == 'Chris' }} {{ not empty }} {{ 'a' in tags }}", "True True True True"},
+		{"if", "{% if count > 5 %}big{% elif count > 2 %}medium{% else %}small{% endif %}", "medium"},
+		{"for", "{% for tag in tags %}{{ forloop.Counter }}{{ tag }}{% if not forloop.Last %},{% endif %}{% endfor %}", "1b,2a,3c"},
+		{"for empty", "{% for x in empty %}{{ x }}{% empty %}none{% endfor %}", "none"},
+		{"for dict", "{% for key, value in ports sorted %}{{ key }}={{ value }};{% endfor %}", "http=80;https=443;"},
+		{"cycle", "{% for t in tags %}{% cycle 'odd' 'even' %} {% endfor %}", "odd even odd "},
+		{"set", "{% set greeting = 'Hi '|add:name %}{{ greeting }}", "Hi Chris"},
+		{"with", "{% with greeting = 'Hey' %}{{ greeting }} {{ name }}{% endwith %}[{{ greeting }}]", "Hey Chris[]"},
+		{"macro", "{% macro tag(name, cls='x') %}<{{ name }} class={{ cls }}>{% endmacro %}{{ tag('p') }}{{ tag('a', 'y') }}", "<p class=x><a class=y>"},
+		{"filters", "{{ name|lower|capfirst }} {{ tags|join:', ' }} {{ users|length }} {{ price|floatformat:2 }} {{ nope|default:'x' }}", "Chris b, a, c 2 2.50 x"},
+		{"filter block", "{% filter upper %}hello {{ name }}{% endfilter %}", "HELLO CHRIS"},
+		{"template functions", "{{ upper(name) }} {{ repeat(2, name) }}", "CHRIS ChrisChris"},
+		{"not autoescaped", "{{ '<b>' }} {{ '<b>'|escape }}", "<b> &lt;b&gt;"},
+		{"comments", "a{# ignored #}b{% comment %}gone{% endcomment %}", "ab"},
+		{"whitespace control", "<ul>\n  {%- for t in tags %}\n  <li>{{ t }}</li>\n  {%- endfor %}\n</ul>", "<ul>\n  <li>b</li>\n  <li>a</li>\n  <li>c</li>\n</ul>"},
+		{"verbatim", "{% verbatim %}{{ name }}{% endverbatim %}", "{{ name }}"},
+		{"trailing newline", "{{ name }}\n", "Chris"},
+		{"ansible header", "#jinja2: trim_blocks: True, lstrip_blocks: True\n{% for t in tags %}\n  {% if t != 'a' %}\n{{ t }}\n  {% endif %}\n{% endfor %}\n", "b\nc\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderJinja(t, Request{Text: tt.text, Parameters: jinjaTestData()})
+			if err != nil {
+				t.Fatalf("render returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJinjaInheritanceAndIncludes(t *testing.T) {
+	partials := map[string]string{
+		"base.html":   "<title>{% block title %}Site{% endblock %}</title>{% block body %}{% endblock %}",
+		"page.html":   "{% extends 'base.html' %}{% block title %}Page - {{ block.Super }}{% endblock %}",
+		"header.html": "<h1>{{ name }}</h1>",
+		"macros.html": "{% macro shout(s) export %}{{ s|upper }}!{% endmacro %}",
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"extends", "{% extends 'base.html' %}{% block body %}<p>{{ name }}</p>{% endblock %}ignored", "<title>Site</title><p>Chris</p>"},
+		{"multi-level super", "{% extends 'page.html' %}{% block title %}{{ block.Super }} | Home{% endblock %}", "<title>Page - Site | Home</title>"},
+		{"include", "{% include 'header.html' %}{% include 'missing.html' if_exists %}{% include 'header.html' with name='Ada' only %}", "<h1>Chris</h1><h1>Ada</h1>"},
+		{"import", "{% import 'macros.html' shout as s %}{{ s('hi') }}", "HI!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderJinja(t, Request{Text: tt.text, Partials: partials, Parameters: jinjaTestData()})
+			if err != nil {
+				t.Fatalf("render returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJinjaOptionsAndErrors(t *testing.T) {
+	value := "n/a"
+	for _, req := range []Request{
+		{Text: "{{ nope }}", MissingValue: &value},
+		{Text: "{{ nope }}", MissingKey: "error"},
+		{Text: "{{ name }}", Delimiters: []string{"<%", "%>"}},
+		{Text: "{{ name }}", LayoutText: "{{ content }}"},
+	} {
+		if _, err := renderJinja(t, req); err == nil {
+			t.Errorf("%+v: expected an unsupported option to fail", req)
+		}
+	}
+
+	for _, text := range []string{"{% if x %}", "{% for x in y %}{% endif %}", "{% endfor %}", "{{ name", "{% bogus %}", "{{ x|nosuchfilter }}", "#jinja2: bogus: True\nx", "{% include 'missing' %}", "{% extends 'missing' %}"} {
+		if _, err := renderJinja(t, Request{Text: text}); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("%q: expected a parse error, got %v", text, err)
+		}
+	}
+	if _, err := renderJinja(t, Request{Text: "{{ 1 / 0 }}"}); err == nil {
+		t.Error("Expected division by zero to fail the render")
+	}
+}
+
+func TestJinjaSandbox(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		partials map[string]string
+	}{
+		{"server files", "{% ssi '/etc/passwd' %}", nil},
+		{"unbounded text", "{% lorem 100000000 w %}", nil},
+		{"padding", "{{ name|ljust:1000000000 }}", nil},
+		{"recursive include", "{% include 'self' %}", map[string]string{"self": "x{% include 'self' %}"}},
+		{"recursive extends", "{% extends 'a' %}", map[string]string{"a": "{% extends 'b' %}", "b": "{% extends 'a' %}"}},
+		{"dynamic include", "{% include name %}", map[string]string{"Chris": "x"}},
+		{"recursive macro", "{% macro f(n) %}{{ f(n) }}{% endmacro %}{{ f(1) }}", nil},
+		{"macro argument call", "{% macro f(x) %}{{ x(x) }}{% endmacro %}{{ f(f) }}", nil},
+		{"macro include", "{% macro f() %}{% include 'p' %}{% endmacro %}", map[string]string{"p": "{{ f() }}"}},
+		{"recursive partial macro", "{% import 'm' f %}", map[string]string{"m": "{% macro f() export %}{{ f() }}{% endmacro %}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := renderJinja(t, Request{Text: tt.text, Partials: tt.partials, Parameters: jinjaTestData()}); err == nil {
+				t.Error("Expected the template to be rejected")
+			}
+		})
+	}
+
+	// Macros may call template functions
+	got, err := renderJinja(t, Request{Text: "{% macro f(n) %}{{ upper(n) }}{% if (n) %}!{% endif %}{{ 'g(1)' }}{% endmacro %}{{ f(name) }}", Parameters: jinjaTestData()})
+	if err != nil || got != "CHRIS!g(1)" {
+		t.Errorf("Got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,91 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// jsonSchemaURL is the location request schemas are compiled at. They load
+// no other resources, so "$ref" can only point into the schema itself or the
+// JSON Schema meta-schemas.
+const jsonSchemaURL = "urn:templateservice:schema"
+
+// jsonSchemaPrinter formats validation messages
+var jsonSchemaPrinter = message.NewPrinter(language.English)
+
+// compileJSONSchema compiles a schema given as a decoded JSON object. Drafts
+// named by "$schema" are honored, draft 2020-12 applies otherwise, and
+// "format" is asserted.
+func compileJSONSchema(schema map[string]interface{}) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.AssertFormat()
+	compiler.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := compiler.AddResource(jsonSchemaURL, schema); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(jsonSchemaURL)
+}
+
+// validateJSONSchema checks a decoded JSON value against a JSON Schema and
+// returns one message per violation ("$.items[0].name: message"), paths
+// starting at path. A schema that does not compile is reported as a
+// violation of the root.
+func validateJSONSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	if path == "" {
+		path = "$"
+	}
+	compiled, err := compileJSONSchema(schema)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: invalid schema: %v", path, err)}
+	}
+	err = compiled.Validate(value)
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+	var violations []string
+	collectSchemaViolations(validationErr, value, path, &violations)
+	sort.Strings(violations)
+	return violations
+}
+
+// collectSchemaViolations appends the innermost causes of a validation error,
+// which name the failing keyword and value
+func collectSchemaViolations(err *jsonschema.ValidationError, value interface{}, path string, violations *[]string) {
+	if len(err.Causes) == 0 {
+		*violations = append(*violations, fmt.Sprintf("%s: %s", schemaInstancePath(value, path, err.InstanceLocation), err.ErrorKind.LocalizedString(jsonSchemaPrinter)))
+		return
+	}
+	for _, cause := range err.Causes {
+		collectSchemaViolations(cause, value, path, violations)
+	}
+}
+
+// schemaInstancePath writes an instance location as a path below path,
+// with array elements as "[i]" and object properties as ".key"
+func schemaInstancePath(value interface{}, path string, location []string) string {
+	for _, token := range location {
+		switch v := value.(type) {
+		case []interface{}:
+			path += "[" + token + "]"
+			if i, err := strconv.Atoi(token); err == nil && i < len(v) {
+				value = v[i]
+			}
+		case map[string]interface{}:
+			path += "." + token
+			value = v[token]
+		default:
+			path += "." + token
+		}
+	}
+	return path
+}
@@ -0,0 +1,43 @@
+package render
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	tests := []struct {
+		name, schema, value string
+		want                []string
+	}{
+		{"valid", `{"type": "object", "required": ["name"]}`, `{"name": "Ada"}`, nil},
+		{"ref", `{"$defs": {"id": {"type": "integer"}}, "properties": {"id": {"$ref": "#/$defs/id"}}}`, `{"id": "x"}`, []string{"$.id: got string, want integer"}},
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "number"}]}`, `true`, []string{"$: got boolean, want number", "$: got boolean, want string"}},
+		{"not", `{"not": {"const": "secret"}}`, `"secret"`, []string{"$: 'not' failed"}},
+		{"format", `{"properties": {"mail": {"format": "email"}}}`, `{"mail": "nope"}`, []string{"$.mail: 'nope' is not valid email: missing @"}},
+		{"array index", `{"items": {"type": "string"}}`, `["a", 2]`, []string{"$[1]: got number, want string"}},
+		{"external ref", `{"$ref": "file:///etc/passwd"}`, `{}`, []string{"$: invalid schema: "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]interface{}
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			got := validateJSONSchema(schema, value, "")
+			if len(got) != len(tt.want) {
+				t.Fatalf("validateJSONSchema() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], tt.want[i]) {
+					t.Errorf("Violation %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package render
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kubernetesMediaType is the encodingFormat of rendered Kubernetes manifests
+const kubernetesMediaType = "application/vnd.kubernetes+yaml"
+
+// kubernetesNamePattern matches a DNS subdomain name (RFC 1123), which
+// Kubernetes requires of most object names
+var kubernetesNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// schemaPathSegment matches one key or list index of a validateJSONSchema path
+var schemaPathSegment = regexp.MustCompile(`\.([^.\[]+)|\[(\d+)\]`)
+
+// isKubernetesFormat reports whether an encodingFormat declares Kubernetes manifests
+func isKubernetesFormat(encodingFormat string) bool {
+	mediaType, _, err := mime.ParseMediaType(encodingFormat)
+	return err == nil && mediaType == kubernetesMediaType
+}
+
+// checkKubernetesManifest checks one YAML document of a manifest stream:
+// it must be a mapping with apiVersion, kind and a valid metadata.name (or
+// generateName), and match the schema registered for its apiVersion/kind or
+// kind, if any. Empty documents are skipped. Violations carry the line and
+// column of the offending node.
+func checkKubernetesManifest(node *yaml.Node, doc interface{}, path string, schemas map[string]map[string]interface{}) []Violation {
+	if doc == nil {
+		return nil
+	}
+	if path == "" {
+		path = "$"
+	}
+	violation := func(fieldPath, message string) Violation {
+		at := yamlNodeAt(node, strings.TrimPrefix(fieldPath, path))
+		return Violation{Assertion: "validFormat", Path: fieldPath, Message: message, Line: at.Line, Column: at.Column}
+	}
+	manifest, ok := doc.(map[string]interface{})
+	if !ok {
+		return []Violation{violation(path, "manifest is not a mapping")}
+	}
+
+	var violations []Violation
+	apiVersion, _ := manifest["apiVersion"].(string)
+	kind, _ := manifest["kind"].(string)
+	if apiVersion == "" {
+		violations = append(violations, violation(path+".apiVersion", "apiVersion is required"))
+	}
+	if kind == "" {
+		violations = append(violations, violation(path+".kind", "kind is required"))
+	}
+	if !strings.HasSuffix(kind, "List") {
+		metadata, _ := manifest["metadata"].(map[string]interface{})
+		name, hasName := metadata["name"].(string)
+		generateName, _ := metadata["generateName"].(string)
+		switch {
+		case metadata == nil:
+			violations = append(violations, violation(path+".metadata", "metadata is required"))
+		case !hasName && generateName == "":
+			violations = append(violations, violation(path+".metadata.name", "metadata.name is required"))
+		case hasName && (len(name) > 253 || !kubernetesNamePattern.MatchString(name)):
+			violations = append(violations, violation(path+".metadata.name", fmt.Sprintf("%q is not a valid name (lowercase letters, digits, '-' and '.')", name)))
+		}
+	}
+
+	schema, ok := schemas[apiVersion+"/"+kind]
+	if !ok {
+		schema, ok = schemas[kind]
+	}
+	if ok && apiVersion != "" && kind != "" {
+		for _, v := range schemaViolations(validateJSONSchema(schema, manifest, path)) {
+			at := yamlNodeAt(node, strings.TrimPrefix(v.Path, path))
+			v.Assertion, v.Line, v.Column = "kubernetesSchemas", at.Line, at.Column
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// yamlNodeAt returns the node of a document at a path relative to its root
+// (".spec.containers[0]"), or the deepest node of the path that exists
+func yamlNodeAt(node *yaml.Node, path string) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, m := range schemaPathSegment.FindAllStringSubmatch(path, -1) {
+		var next *yaml.Node
+		switch {
+		case m[1] != "" && node.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == m[1] {
+					next = node.Content[i+1]
+					if next.Kind == yaml.ScalarNode || next.Kind == yaml.AliasNode {
+						// Point at the key of a scalar value rather than past it
+						next = node.Content[i]
+					}
+					break
+				}
+			}
+		case m[2] != "" && node.Kind == yaml.SequenceNode:
+			if i, _ := strconv.Atoi(m[2]); i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+	return node
+}
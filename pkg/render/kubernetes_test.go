@@ -0,0 +1,61 @@
+package render
+
+import (
+	"errors"
+	"testing"
+)
+
+const kubernetesManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: Web_Service
+---
+kind: ConfigMap
+metadata:
+  labels: {}
+`
+
+func TestKubernetesManifests(t *testing.T) {
+	assertions := &Assertions{
+		ValidFormat: true,
+		KubernetesSchemas: map[string]map[string]interface{}{
+			"apps/v1/Deployment": {
+				"type":     "object",
+				"required": []interface{}{"spec"},
+				"properties": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"replicas": map[string]interface{}{"type": "integer", "minimum": float64(1)},
+						},
+					},
+				},
+			},
+		},
+	}
+	err := CheckAssertions(assertions, kubernetesMediaType, kubernetesManifests)
+	var re *Error
+	if !errors.As(err, &re) {
+		t.Fatalf("CheckAssertions() = %v, want a Error", err)
+	}
+	want := []Violation{
+		{Assertion: "kubernetesSchemas", Path: "$.spec.replicas", Message: "minimum: got 0, want 1", Line: 6, Column: 3},
+		{Assertion: "validFormat", Path: "$[document 1].metadata.name", Message: `"Web_Service" is not a valid name (lowercase letters, digits, '-' and '.')`, Line: 11, Column: 3},
+		{Assertion: "validFormat", Path: "$[document 2].apiVersion", Message: "apiVersion is required", Line: 13, Column: 1},
+		{Assertion: "validFormat", Path: "$[document 2].metadata.name", Message: "metadata.name is required", Line: 15, Column: 3},
+	}
+	if len(re.Violations) != len(want) {
+		t.Fatalf("Expected %d violations, got %+v", len(want), re.Violations)
+	}
+	for i := range want {
+		if re.Violations[i] != want[i] {
+			t.Errorf("Violation %d = %+v, want %+v", i, re.Violations[i], want[i])
+		}
+	}
+}
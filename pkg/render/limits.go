@@ -0,0 +1,220 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Limits bound the execution of a template. Zero values disable a limit.
+type Limits struct {
+	Timeout        time.Duration // Deadline of a single execution
+	MaxOutputBytes int64         // Maximum size of the output
+}
+
+// DefaultLimits are the template service's default limits
+var DefaultLimits = Limits{Timeout: 30 * time.Second, MaxOutputBytes: 64 << 20}
+
+// ErrTimeout is returned when execution exceeds Limits.Timeout
+var ErrTimeout = errors.New("render timeout")
+
+// ErrOutputTooLarge is returned when output exceeds Limits.MaxOutputBytes
+var ErrOutputTooLarge = errors.New("rendered output too large")
+
+// limitedWriter fails once more than limit bytes have been written, which
+// makes text/template abort before the buffer grows further
+type limitedWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if lw.written+int64(len(p)) > lw.limit {
+		return 0, ErrOutputTooLarge
+	}
+	n, err := lw.w.Write(p)
+	lw.written += int64(n)
+	return n, err
+}
+
+// contextWriter fails writes once its context is done, which makes
+// text/template abort at the next piece of output
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// closableWriter stops passing writes through once closed, so an execution
+// abandoned on timeout cannot write to a response that has moved on
+type closableWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+func (cw *closableWriter) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.closed {
+		return 0, context.Canceled
+	}
+	return cw.w.Write(p)
+}
+
+func (cw *closableWriter) close() {
+	cw.mu.Lock()
+	cw.closed = true
+	cw.mu.Unlock()
+}
+
+// contextCheckFunc is declared at the top of every range body of Go
+// templates. It is a no-op until ExecuteTo binds it to the execution's
+// context, which stops loops that compute without writing any output.
+const contextCheckFunc = "renderContextCheck"
+
+// contextCheckFuncs are the funcs templates are parsed with
+var contextCheckFuncs = template.FuncMap{contextCheckFunc: func() (string, error) { return "", nil }}
+
+// checkRanges rewrites every range of the parsed templates to call
+// contextCheckFunc before each iteration. The result is assigned to a
+// variable, so nothing is printed.
+func checkRanges(tmpl *template.Template) {
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			checkRangesInList(t.Tree.Root)
+		}
+	}
+}
+
+func checkRangesInList(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			checkRangesInList(n.List)
+			checkRangesInList(n.ElseList)
+		case *parse.WithNode:
+			checkRangesInList(n.List)
+			checkRangesInList(n.ElseList)
+		case *parse.RangeNode:
+			checkRangesInList(n.List)
+			checkRangesInList(n.ElseList)
+			if n.List != nil {
+				n.List.Nodes = append([]parse.Node{contextCheckAction(n.Position())}, n.List.Nodes...)
+			}
+		}
+	}
+}
+
+// contextCheckAction returns {{$renderContextCheck := renderContextCheck}}
+func contextCheckAction(pos parse.Pos) *parse.ActionNode {
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$" + contextCheckFunc}}},
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args:     []parse.Node{parse.NewIdentifier(contextCheckFunc).SetPos(pos)},
+			}},
+		},
+	}
+}
+
+// bindContext returns a copy of a Go template whose loops stop once ctx is
+// done. The copy keeps cached templates shareable.
+func bindContext(ctx context.Context, tmpl *template.Template) (*template.Template, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, &Error{Message: "failed to prepare template", Status: http.StatusInternalServerError, Err: err}
+	}
+	return clone.Funcs(template.FuncMap{
+		contextCheckFunc: func() (string, error) { return "", ctx.Err() },
+	}), nil
+}
+
+// Execute runs tmpl within limits and returns its output
+func Execute(ctx context.Context, tmpl Template, data interface{}, limits Limits) (string, error) {
+	var output bytes.Buffer
+	if err := ExecuteTo(ctx, tmpl, data, &output, limits); err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// ExecuteTo runs tmpl within limits, writing its output to dst. Execution happens on its own goroutine so the
+// caller is released on timeout (or client disconnect) even while the
+// template computes without writing; the goroutine stops at its next write
+// or, for Go templates, at the next iteration of a loop.
+func ExecuteTo(ctx context.Context, tmpl Template, data interface{}, dst io.Writer, limits Limits) error {
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	if goTmpl, ok := tmpl.(*template.Template); ok && ctx.Done() != nil {
+		bound, err := bindContext(ctx, goTmpl)
+		if err != nil {
+			return err
+		}
+		tmpl = bound
+	}
+
+	var w io.Writer = dst
+	if limits.MaxOutputBytes > 0 {
+		w = &limitedWriter{w: w, limit: limits.MaxOutputBytes}
+	}
+	guard := &closableWriter{w: w}
+	defer guard.close()
+	done := make(chan error, 1)
+	go func() {
+		done <- tmpl.Execute(&contextWriter{ctx: ctx, w: guard}, data)
+	}()
+
+	select {
+	case err := <-done:
+		if errors.Is(err, ErrOutputTooLarge) {
+			return &Error{
+				Message: fmt.Sprintf("rendered output exceeds %d bytes", limits.MaxOutputBytes),
+				Status:  http.StatusRequestEntityTooLarge,
+				Err:     err,
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			return &Error{Message: "failed to execute template", Status: http.StatusBadRequest, Err: err}
+		}
+		if err == nil {
+			return nil
+		}
+	case <-ctx.Done():
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &Error{
+			Message: fmt.Sprintf("template execution exceeded %s", limits.Timeout),
+			Status:  http.StatusGatewayTimeout,
+			Err:     ErrTimeout,
+		}
+	}
+	return &Error{Message: "render cancelled", Status: http.StatusRequestTimeout, Err: ctx.Err()}
+}
@@ -0,0 +1,114 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func slowTemplate(t *testing.T) *template.Template {
+	t.Helper()
+	return template.Must(template.New("slow").Funcs(template.FuncMap{
+		"slow": func() string { time.Sleep(20 * time.Millisecond); return "" },
+	}).Parse("{{range .}}{{slow}}x{{end}}"))
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	limits := Limits{Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	_, err := Execute(context.Background(), slowTemplate(t), make([]int, 1000), limits)
+	var renderErr *Error
+	if !errors.As(err, &renderErr) || renderErr.Status != http.StatusGatewayTimeout {
+		t.Fatalf("Expected 504 render error, got %v", err)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Timeout took %s", elapsed)
+	}
+
+	output, err := Execute(context.Background(), slowTemplate(t), make([]int, 1), limits)
+	if err != nil || output != "x" {
+		t.Errorf("Expected fast render to succeed, got %q, %v", output, err)
+	}
+}
+
+func TestExecuteCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Execute(ctx, slowTemplate(t), make([]int, 1000), DefaultLimits)
+	var renderErr *Error
+	if !errors.As(err, &renderErr) || renderErr.Status != http.StatusRequestTimeout {
+		t.Fatalf("Expected 408 render error, got %v", err)
+	}
+}
+
+func TestExecuteTimeout_StopsLoops(t *testing.T) {
+	// Loops that never write are stopped too, rather than left running
+	var iterations atomic.Int64
+	funcs := template.FuncMap{"tick": func() int { return int(iterations.Add(1)) }}
+	before := runtime.NumGoroutine()
+	for _, text := range []string{
+		`{{range 2000000000}}{{$n := tick}}{{end}}`,
+		`{{range $i := until 100000}}{{range until 100000}}{{$n := tick}}{{end}}{{end}}`,
+	} {
+		iterations.Store(0)
+		tmpl, err := Parse(Request{Text: text, Funcs: mergeFuncs(Funcs(true), funcs)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Execute(context.Background(), tmpl, nil, Limits{Timeout: 20 * time.Millisecond}); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("%s: expected ErrTimeout, got %v", text, err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if running := runtime.NumGoroutine(); running > before {
+			t.Fatalf("%s: %d goroutines still running after the timeout; want %d", text, running, before)
+		}
+		// Goroutines left by other tests may hide the render's, so wait
+		// for the loop itself to stop
+		for stopped := int64(-1); iterations.Load() != stopped; time.Sleep(20 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Errorf("%s: loop still iterating after the timeout", text)
+				break
+			}
+			stopped = iterations.Load()
+		}
+	}
+}
+
+// mergeFuncs returns the functions of both maps, b's taking precedence
+func mergeFuncs(a, b template.FuncMap) template.FuncMap {
+	merged := template.FuncMap{}
+	for name, fn := range a {
+		merged[name] = fn
+	}
+	for name, fn := range b {
+		merged[name] = fn
+	}
+	return merged
+}
+
+func TestExecuteOutputLimit(t *testing.T) {
+	limits := Limits{MaxOutputBytes: 1024}
+	tmpl := template.Must(template.New("big").Parse("{{range .}}{{range $}}0123456789{{end}}{{end}}"))
+	_, err := Execute(context.Background(), tmpl, make([]int, 100), limits)
+	var renderErr *Error
+	if !errors.As(err, &renderErr) || renderErr.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 render error, got %v", err)
+	}
+
+	output, err := Execute(context.Background(), tmpl, make([]int, 10), limits)
+	if err != nil || len(output) != 1000 {
+		t.Errorf("Expected 1000 bytes within the limit, got %d, %v", len(output), err)
+	}
+}
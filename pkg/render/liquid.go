@@ -0,0 +1,201 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"regexp"
+
+	"github.com/osteele/liquid"
+)
+
+// liquidEngine renders Liquid templates with osteele/liquid, which follows
+// Shopify's semantics: output with filters, assign and capture, if, unless
+// and case, for and tablerow loops with the forloop object, cycle, raw and
+// comment, and include of the request's partials. As in Liquid, only nil
+// and false are falsey. Template functions are available as filters that
+// take the filtered value as their last argument.
+type liquidEngine struct{}
+
+// liquidStandardFilters are the filters of osteele/liquid, which template
+// functions of the same name do not replace
+var liquidStandardFilters = map[string]bool{
+	"default": true, "json": true, "compact": true, "concat": true, "join": true, "map": true, "reverse": true,
+	"sort": true, "first": true, "last": true, "uniq": true, "date": true, "abs": true, "ceil": true,
+	"floor": true, "modulo": true, "minus": true, "plus": true, "times": true, "divided_by": true,
+	"round": true, "size": true, "append": true, "capitalize": true, "downcase": true, "escape": true,
+	"escape_once": true, "newline_to_br": true, "prepend": true, "remove": true, "remove_first": true,
+	"replace": true, "replace_first": true, "sort_natural": true, "slice": true, "split": true,
+	"strip_html": true, "strip_newlines": true, "strip": true, "lstrip": true, "rstrip": true,
+	"truncate": true, "truncatewords": true, "upcase": true, "url_encode": true, "url_decode": true,
+	"inspect": true, "type": true,
+}
+
+var (
+	liquidIncludeTag = regexp.MustCompile(`(?s)\{%-?\s*include\s+(.*?)\s*-?%\}`)
+	liquidQuotedName = regexp.MustCompile(`^(?:'([^']*)'|"([^"]*)")$`)
+)
+
+// liquidTemplate is a parsed Liquid template
+type liquidTemplate struct {
+	name string
+	tmpl *liquid.Template
+}
+
+func (liquidEngine) Parse(req Request) (Template, error) {
+	if req.LayoutText != "" {
+		return nil, &Error{Message: "layouts are not supported by the liquid engine", Status: http.StatusBadRequest}
+	}
+	if len(req.Delimiters) > 0 {
+		return nil, &Error{Message: "custom delimiters are not supported by the liquid engine", Status: http.StatusBadRequest}
+	}
+	missingKey, err := missingKeyOption(req.MissingKey, req.MissingValue != nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.MissingValue != nil {
+		return nil, &Error{Message: "missing value substitutes are not supported by the liquid engine, use the default filter", Status: http.StatusBadRequest}
+	}
+	if err := checkLiquidIncludes(req.Partials); err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+
+	engine := liquid.NewEngine()
+	engine.RegisterTemplateStore(liquidPartials(req.Partials))
+	if missingKey == "error" {
+		engine.StrictVariables()
+	}
+	for name, fn := range req.funcMap() {
+		if liquidStandardFilters[name] {
+			continue
+		}
+		fn := fn
+		engine.RegisterFilter(name, func(value interface{}, args ...interface{}) (interface{}, error) {
+			return callHelper(fn, append(args, value))
+		})
+	}
+
+	// Partials are parsed when they are included; parsing them here
+	// reports their errors with the template's
+	for _, name := range sortedKeys(req.Partials) {
+		if _, err := engine.ParseString(req.Partials[name]); err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to parse partial %q", name), Status: http.StatusBadRequest, Err: err}
+		}
+	}
+	tmpl, err := engine.ParseString(req.Text)
+	if err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	return &liquidTemplate{name: req.Name, tmpl: tmpl}, nil
+}
+
+// Execute renders the template with data, a map of parameters, as the
+// bindings
+func (t *liquidTemplate) Execute(w io.Writer, data interface{}) (err error) {
+	bindings := liquid.Bindings{}
+	if params, ok := data.(map[string]interface{}); ok {
+		for name, value := range params {
+			bindings[name] = liquidNormalize(value)
+		}
+	}
+	defer func() {
+		// osteele/liquid panics on undefined filters
+		if r := recover(); r != nil {
+			err = fmt.Errorf("template: %s: %v", t.name, r)
+		}
+	}()
+	if err := t.tmpl.FRender(w, bindings); err != nil {
+		return fmt.Errorf("template: %s: %w", t.name, err)
+	}
+	return nil
+}
+
+// liquidNormalize copies JSON data, turning whole float64s into ints so
+// that divided_by truncates as it does for Liquid integers
+func liquidNormalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v)
+		}
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = liquidNormalize(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = liquidNormalize(item)
+		}
+		return items
+	}
+	return value
+}
+
+// liquidPartials serves the request's partials to the include tag, by name
+// with or without a .liquid extension
+type liquidPartials map[string]string
+
+func (p liquidPartials) ReadTemplate(name string) ([]byte, error) {
+	if key, ok := p.lookup(name); ok {
+		return []byte(p[key]), nil
+	}
+	return nil, fmt.Errorf("partial %q not found", name)
+}
+
+// lookup returns the partial's key for a name
+func (p liquidPartials) lookup(name string) (string, bool) {
+	for _, key := range []string{name, name + ".liquid"} {
+		if _, ok := p[key]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// checkLiquidIncludes rejects partials that include themselves, directly or
+// through other partials, and includes named by an expression in partials:
+// osteele/liquid would recurse without bound, which overflows the stack and
+// cannot be recovered
+func checkLiquidIncludes(partials map[string]string) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(partials))
+	var visit func(name string) error
+	visit = func(name string) error {
+		name, ok := liquidPartials(partials).lookup(name)
+		if !ok {
+			return nil
+		}
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("partial %q includes itself", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, tag := range liquidIncludeTag.FindAllStringSubmatch(partials[name], -1) {
+			quoted := liquidQuotedName.FindStringSubmatch(tag[1])
+			if quoted == nil {
+				return fmt.Errorf("partial %q: include needs the partial's name in quotes", name)
+			}
+			if err := visit(filepath.Clean(quoted[1] + quoted[2])); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, name := range sortedKeys(partials) {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
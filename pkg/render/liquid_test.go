@@ -0,0 +1,144 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func renderLiquid(t *testing.T, req Request) (string, error) {
+	t.Helper()
+	req.Engine = "liquid"
+	return Render(context.Background(), req, DefaultLimits)
+}
+
+func liquidTestData() map[string]interface{} {
+	return map[string]interface{}{
+		"name":  "Chris",
+		"count": float64(3),
+		"price": 2.5,
+		"tags":  []interface{}{"b", "a", "c"},
+		"product": map[string]interface{}{
+			"title": "Shirt", "price": float64(1999), "available": true,
+			"variants": []interface{}{
+				map[string]interface{}{"title": "S", "price": float64(1999), "available": false},
+				map[string]interface{}{"title": "M", "price": float64(2499), "available": true},
+			},
+		},
+		"created": "2026-03-05T14:07:09Z",
+	}
+}
+
+func TestLiquid(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"variable", "Hello {{ name }}!", "Hello Chris!"},
+		{"lookups", "{{ product.title }} {{ product['price'] }} {{ tags[0] }} {{ tags[-1] }} {{ tags.size }} {{ tags.first }}", "Shirt 1999 b c 3 b"},
+		{"undefined", "[{{ nope }}][{{ nope.deeper }}]", "[][]"},
+		{"integer math", "{{ 7 | divided_by: 2 }} {{ 7 | modulo: 3 }} {{ count | plus: 1 }} {{ '3' | times: 2 }}", "3 1 4 6"},
+		{"float math", "{{ product.price | divided_by: 100.0 }} {{ price | times: 2 }} {{ 4.6 | floor }} {{ 4.4 | ceil }} {{ 3.14159 | round: 2 }}", "19.99 5 4 5 3.14"},
+		{"strings", "{{ name | upcase }} {{ 'hello world' | capitalize }} {{ name | append: '!' | prepend: '>' }} {{ 'a-b-a' | replace_first: 'a', 'x' }}", "CHRIS Hello world >Chris! x-b-a"},
+		{"truncate", "{{ 'Ground control to Major Tom.' | truncate: 20 }} {{ 'Ground control to Major Tom.' | truncatewords: 3, '--' }}", "Ground control to... Ground control to--"},
+		{"escape", "{{ '<p>\"Tom\" & Jerry</p>' | escape }} {{ '&lt;b&gt; &' | escape_once }} {{ '<b>bold</b>' | strip_html }}", "&lt;p&gt;&#34;Tom&#34; &amp; Jerry&lt;/p&gt; &lt;b&gt; &amp; bold"},
+		{"split join", "{{ 'a, b,c' | split: ',' | join: '|' }} {{ tags | sort | join }} {{ tags | reverse | join: '' }}", "a| b|c a b c cab"},
+		{"array filters", "{{ product.variants | map: 'title' | join: ',' }} {{ tags | concat: tags | uniq | join: '' }} {{ tags | first }}{{ tags | last }}", "S,M bac bc"},
+		{"sort natural", "{{ 'b,A,c' | split: ',' | sort_natural | join }} {{ 'b,a,b' | split: ',' | uniq | join }} {{ 'Chris' | slice: 1, 2 }}", "A b c b a hr"},
+		{"date", "{{ created | date: '%a, %b %-d, %Y %H:%M' }} {{ created | date: '%^B %e' }}", "Thu, Mar 5, 2026 14:07 MARCH  5"},
+		{"default", "{{ nope | default: 'x' }} {{ '' | default: 'y' }} {{ 0 | default: 1 }}", "x y 0"},
+		{"output types", "{{ tags }} {{ 2.0 }} {{ nil }} {{ true }}", "bac 2  true"},
+		{"json", "{{ product.variants[0] | json }}", `{"available":false,"price":1999,"title":"S"}`},
+		{"assign capture", "{% assign greeting = 'Hi ' | append: name %}{% capture line %}{{ greeting }}!{% endcapture %}{{ line }}", "Hi Chris!"},
+		{"if", "{% if count > 5 %}big{% elsif count > 2 and name == 'Chris' %}medium{% else %}small{% endif %}", "medium"},
+		{"truthiness", "{% if 0 %}zero{% endif %}{% if '' %}blank{% endif %}{% if nope %}no{% endif %}{% unless nope %}unless{% endunless %}", "zeroblankunless"},
+		{"contains", "{% if name contains 'hr' and tags contains 'a' and product contains 'title' %}yes{% endif %}", "yes"},
+		{"case", "{% case name %}{% when 'Ada', 'Chris' %}known{% else %}unknown{% endcase %}", "known"},
+		{"for", "{% for tag in tags %}{{ forloop.index }}{{ tag }}{% unless forloop.last %},{% endunless %}{% endfor %}", "1b,2a,3c"},
+		{"for options", "{% for i in (1..10) limit: 3 offset: 2 %}{{ i }}{% endfor %}", "345"},
+		{"loop controls", "{% for i in (1..10) %}{% if i == 2 %}{% continue %}{% endif %}{% if i > 4 %}{% break %}{% endif %}{{ i }}{% endfor %}", "134"},
+		{"cycle", "{% for t in tags %}{% cycle 'odd', 'even' %} {% endfor %}", "odd even odd "},
+		{"tablerow", "{% tablerow t in tags cols: 2 %}{{ t }}{% endtablerow %}", "<tr class=\"row1\"><td class=\"col1\">b</td><td class=\"col2\">a</td></tr><tr class=\"row2\"><td class=\"col1\">c</td></tr>"},
+		{"whitespace control", "<ul>\n  {%- for t in tags %}\n  <li>{{ t }}</li>\n  {%- endfor %}\n</ul>", "<ul>\n  <li>b</li>\n  <li>a</li>\n  <li>c</li>\n</ul>"},
+		{"raw and comments", "{% raw %}{{ name }}{% endraw %}{% comment %}{{ name }}{% endcomment %}", "{{ name }}"},
+		{"template functions", "{{ name | lower }}", "chris"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderLiquid(t, Request{Text: tt.text, Parameters: liquidTestData()})
+			if err != nil {
+				t.Fatalf("render returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiquidInclude(t *testing.T) {
+	partials := map[string]string{
+		"price.liquid": "{{ amount | divided_by: 100.0 }}{% assign leaked = 'yes' %}",
+		"variant":      "{% for variant in product.variants %}[{{ variant.title }}{% include 'price' %}]{% endfor %}",
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"include keeps assigns", "{% assign amount = 1999 %}{% include 'price' %}|{{ leaked }}", "19.99|"},
+		{"nested include", "{% assign amount = 500 %}{% include 'variant' %}", "[S5][M5]"},
+		{"include by variable", "{% assign partial = 'price' %}{% assign amount = 100 %}{% include partial %}", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderLiquid(t, Request{Text: tt.text, Partials: partials, Parameters: liquidTestData()})
+			if err != nil {
+				t.Fatalf("render returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiquidOptionsAndErrors(t *testing.T) {
+	if _, err := renderLiquid(t, Request{Text: "{{ nope }}", MissingKey: "error"}); err == nil {
+		t.Error("Expected missingKey error to fail the render")
+	}
+	if got, err := renderLiquid(t, Request{Text: "{{ name }}", MissingKey: "error", Parameters: liquidTestData()}); err != nil || got != "Chris" {
+		t.Errorf("Expected defined variables to satisfy missingKey error, got %q, %v", got, err)
+	}
+	value := "n/a"
+	if _, err := renderLiquid(t, Request{Text: "{{ nope }}", MissingValue: &value}); err == nil {
+		t.Error("Expected missing value substitutes to be rejected")
+	}
+
+	for _, text := range []string{"{% if x %}", "{% for x in y %}{% endif %}", "{% endfor %}", "{% bogus %}", "{% for x y %}{% endfor %}", "{% render 'header' %}"} {
+		if _, err := renderLiquid(t, Request{Text: text}); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("%q: expected a parse error, got %v", text, err)
+		}
+	}
+	for _, text := range []string{"{{ 1 | divided_by: 0 }}", "{% include 'missing' %}", "{{ x | nosuchfilter }}", "{% include 1 %}"} {
+		if _, err := renderLiquid(t, Request{Text: text}); err == nil {
+			t.Errorf("%q: expected a render error", text)
+		}
+	}
+	for _, partials := range []map[string]string{
+		{"self": "x{% include 'self' %}"},
+		{"a.liquid": "{% include 'b' %}", "b": "{%- include \"a\" -%}"},
+		{"dynamic": "{% include name %}"},
+	} {
+		if _, err := renderLiquid(t, Request{Text: "{% include 'self' %}", Partials: partials}); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("%v: expected recursive includes to be rejected, got %v", partials, err)
+		}
+	}
+	if _, err := renderLiquid(t, Request{Text: "x", Partials: map[string]string{"ok": "{% include 'x' %}"}}); err != nil {
+		t.Errorf("Expected includes of missing partials to fail only when rendered, got %v", err)
+	}
+	if _, err := renderLiquid(t, Request{Text: "x", LayoutText: "{{ content }}"}); err == nil {
+		t.Error("Expected layouts to be rejected")
+	}
+}
@@ -0,0 +1,74 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// localeFuncs are the translation functions of a render in locale:
+//
+//	{{t "welcome.subject"}}
+//	{{t "welcome.greeting" "name" .Customer.Name}}
+//
+// t returns the message for a key with its {name} placeholders replaced by
+// the given name/value pairs, or the key itself when messages lack it.
+// locale returns the render's locale. The locale's date, humanizing and
+// number functions are included (see datetime.go, humanize.go and
+// numbers.go).
+func localeFuncs(locale string, messages map[string]string) template.FuncMap {
+	funcs := template.FuncMap{
+		"t": func(key string, pairs ...interface{}) (string, error) {
+			return translate(messages, key, pairs)
+		},
+		"locale": func() string { return locale },
+	}
+	for name, fn := range dateFuncs(locale) {
+		funcs[name] = fn
+	}
+	for name, fn := range humanizeFuncs(locale) {
+		funcs[name] = fn
+	}
+	for name, fn := range numberFuncs(locale) {
+		funcs[name] = fn
+	}
+	for name, fn := range phoneFuncs(locale) {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// translate looks up key in messages and fills in its placeholders
+func translate(messages map[string]string, key string, pairs []interface{}) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("t %q: expected name/value pairs after the key", key)
+	}
+	message, ok := messages[key]
+	if !ok {
+		message = key
+	}
+	if len(pairs) == 0 {
+		return message, nil
+	}
+	replacements := make([]string, 0, len(pairs))
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return "", fmt.Errorf("t %q: placeholder name %v is not a string", key, pairs[i])
+		}
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(pairs[i+1]))
+	}
+	return strings.NewReplacer(replacements...).Replace(message), nil
+}
+
+// bindLocale returns a copy of a compiled template whose translation
+// functions use the request's locale and messages. The copy keeps cached
+// templates shareable.
+func bindLocale(tmpl *template.Template, locale string, messages map[string]string) (*template.Template, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, &Error{Message: "failed to prepare template", Status: http.StatusInternalServerError, Err: err}
+	}
+	return clone.Funcs(localeFuncs(locale, messages)), nil
+}
@@ -0,0 +1,13 @@
+package render
+
+import "testing"
+
+func TestTranslatePlaceholders(t *testing.T) {
+	if _, err := translate(nil, "key", []interface{}{"name"}); err == nil {
+		t.Error("Expected an error for an unpaired placeholder")
+	}
+	got, err := translate(map[string]string{"items": "{count} items in {cart}"}, "items", []interface{}{"count", 3, "cart", "Basket"})
+	if err != nil || got != "3 items in Basket" {
+		t.Errorf("translate() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// maskRune replaces hidden characters of masked values
+const maskRune = '*'
+
+// maskFuncs display sensitive values partially hidden, the same way in
+// every template:
+//
+//	{{maskEmail .Email}}     → a***@example.com
+//	{{maskPAN .Card}}        → **** **** **** 1234
+//	{{maskPhone .Phone}}     → +** ** *** ** 67
+//	ending in {{last4 .Card}}
+func maskFuncs() template.FuncMap {
+	return template.FuncMap{
+		"maskEmail": maskEmail,
+		"maskPAN":   maskPAN,
+		"maskPhone": maskPhone,
+		"last4":     last4,
+	}
+}
+
+// maskString returns a template value as a string, nil as ""
+func maskString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprint(value)
+}
+
+// maskEmail keeps the first character of the local part and the domain of
+// an address. Values that are not addresses are masked entirely.
+func maskEmail(value interface{}) string {
+	s := strings.TrimSpace(maskString(value))
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" || domain == "" {
+		return strings.Repeat(string(maskRune), 3)
+	}
+	first := []rune(local)[0]
+	if len([]rune(local)) == 1 {
+		first = maskRune
+	}
+	return string(first) + strings.Repeat(string(maskRune), 3) + "@" + domain
+}
+
+// maskPAN masks the digits of a card number except the last four, keeping
+// its separators. Numbers too short to be card numbers are masked entirely.
+func maskPAN(value interface{}) string {
+	return maskDigits(maskString(value), 4, 12)
+}
+
+// maskPhone masks the digits of a phone number except the last two, keeping
+// a leading + and the separators
+func maskPhone(value interface{}) string {
+	return maskDigits(maskString(value), 2, 6)
+}
+
+// maskDigits replaces every digit of s except the last visible ones with
+// maskRune, or every digit when s has fewer than minDigits
+func maskDigits(s string, visible, minDigits int) string {
+	total := 0
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			total++
+		}
+	}
+	if total < minDigits {
+		visible = 0
+	}
+	var out strings.Builder
+	seen := 0
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			seen++
+			if seen <= total-visible {
+				r = maskRune
+			}
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// last4 returns the last four letters or digits of a value, ignoring
+// separators, for "card ending in 1234" lines. Shorter values give "".
+func last4(value interface{}) string {
+	var kept []rune
+	for _, r := range maskString(value) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) <= 4 {
+		return ""
+	}
+	return string(kept[len(kept)-4:])
+}
@@ -0,0 +1,44 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMaskFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"maskEmail", maskEmail("alice.smith@example.com"), "a***@example.com"},
+		{"maskEmail single", maskEmail("a@example.com"), "****@example.com"},
+		{"maskEmail invalid", maskEmail("not an address"), "***"},
+		{"maskPAN spaced", maskPAN("4111 1111 1111 1234"), "**** **** **** 1234"},
+		{"maskPAN number", maskPAN(4111111111111234.0), "************1234"},
+		{"maskPAN short", maskPAN("12345"), "*****"},
+		{"maskPhone", maskPhone("+41 79 123 45 67"), "+** ** *** ** 67"},
+		{"maskPhone short", maskPhone("112"), "***"},
+		{"last4", last4("DE89 3704 0044 0532 0130 00"), "3000"},
+		{"last4 short", last4("1234"), ""},
+		{"last4 nil", last4(nil), ""},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestMaskTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{maskEmail .Email}}, card ending in {{last4 .Card}}`,
+		Parameters: map[string]interface{}{"Email": "bob@example.org", "Card": "5500-0000-0000-0004"},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if want := "b***@example.org, card ending in 0004"; output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
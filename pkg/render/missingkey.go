@@ -0,0 +1,86 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"text/template"
+	"text/template/parse"
+)
+
+// missingKeyFunc is the function appended to printing actions when a
+// substitute value for missing keys is requested
+const missingKeyFunc = "missingKeyValue"
+
+// missingKeyOption returns the text/template missingkey option for a mode:
+// "default" prints "<no value>", "zero" the zero value and "error" fails the
+// render. When a substitute value is requested the default mode is used and
+// printing actions are rewritten to pipe through missingKeyFunc.
+func missingKeyOption(mode string, substitute bool) (string, error) {
+	if substitute || mode == "" {
+		return "default", nil
+	}
+	switch mode {
+	case "default", "zero", "error":
+		return mode, nil
+	}
+	return "", &Error{
+		Message: fmt.Sprintf("invalid missingKey %q (expected default, zero or error)", mode),
+		Status:  http.StatusBadRequest,
+	}
+}
+
+// bindMissingValue returns a copy of a compiled template whose missing
+// values render as value. The copy keeps cached templates shareable.
+func bindMissingValue(tmpl *template.Template, value string) (*template.Template, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, &Error{Message: "failed to prepare template", Status: http.StatusInternalServerError, Err: err}
+	}
+	return clone.Funcs(template.FuncMap{
+		missingKeyFunc: func(v interface{}) interface{} {
+			if v == nil {
+				return value
+			}
+			return v
+		},
+	}), nil
+}
+
+// substituteMissingValues rewrites every printing action of the parsed
+// templates so its value is piped through missingKeyFunc
+func substituteMissingValues(tmpl *template.Template) {
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			substituteInList(t.Tree.Root)
+		}
+	}
+}
+
+func substituteInList(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			// Variable declarations do not print anything
+			if n.Pipe == nil || len(n.Pipe.Decl) > 0 {
+				continue
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(missingKeyFunc).SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			substituteInList(n.List)
+			substituteInList(n.ElseList)
+		case *parse.RangeNode:
+			substituteInList(n.List)
+			substituteInList(n.ElseList)
+		case *parse.WithNode:
+			substituteInList(n.List)
+			substituteInList(n.ElseList)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cbroglie/mustache"
+)
+
+// mustacheEngine renders logic-less Mustache templates with
+// cbroglie/mustache: variables, sections, inverted sections, comments,
+// partials and delimiter changes. Lambdas are not reachable since
+// parameters are data.
+type mustacheEngine struct{}
+
+// mustacheTemplate is a parsed Mustache template with its partials
+type mustacheTemplate struct {
+	tmpl     *mustache.Template
+	partials map[string]string
+}
+
+func (mustacheEngine) Parse(req Request) (Template, error) {
+	if req.LayoutText != "" {
+		return nil, &Error{Message: "layouts are not supported by the mustache engine", Status: http.StatusBadRequest}
+	}
+	missingKey, err := missingKeyOption(req.MissingKey, req.MissingValue != nil)
+	if err != nil {
+		return nil, err
+	}
+	if missingKey == "error" || req.MissingValue != nil {
+		return nil, &Error{Message: "missingKey error and missing value substitutes are not supported by the mustache engine", Status: http.StatusBadRequest}
+	}
+	text := req.Text
+	if len(req.Delimiters) > 0 {
+		if len(req.Delimiters) != 2 || !validMustacheDelimiter(req.Delimiters[0]) || !validMustacheDelimiter(req.Delimiters[1]) {
+			return nil, &Error{Message: "delimiters must be a pair of non-empty strings without spaces or '='", Status: http.StatusBadRequest}
+		}
+		// Switch delimiters with a set-delimiter tag followed by an empty
+		// comment, so the tag is never standalone and keeps the first line
+		text = "{{=" + req.Delimiters[0] + " " + req.Delimiters[1] + "=}}" + req.Delimiters[0] + "!" + req.Delimiters[1] + text
+	}
+
+	provider := &mustache.StaticProvider{Partials: req.Partials}
+	tmpl, err := mustache.ParseStringPartials(text, provider)
+	if err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	// Partials are parsed when they are rendered; parsing them here reports
+	// syntax errors and recursion before any output is written
+	includes := make(map[string][]string, len(req.Partials))
+	for _, name := range sortedKeys(req.Partials) {
+		partial, err := mustache.ParseStringPartials(req.Partials[name], provider)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to parse partial %q", name), Status: http.StatusBadRequest, Err: err}
+		}
+		includes[name] = mustachePartialNames(partial.Tags())
+	}
+	if err := checkMustacheRecursion(sortedKeys(req.Partials), includes); err != nil {
+		return nil, &Error{Message: "failed to parse template", Status: http.StatusBadRequest, Err: err}
+	}
+	return &mustacheTemplate{tmpl: tmpl, partials: req.Partials}, nil
+}
+
+// validMustacheDelimiter reports whether s can be set with a set-delimiter tag
+func validMustacheDelimiter(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "= \t\r\n")
+}
+
+// mustachePartialNames lists the partials tags include, sections included
+func mustachePartialNames(tags []mustache.Tag) []string {
+	var names []string
+	for _, tag := range tags {
+		switch tag.Type() {
+		case mustache.Partial:
+			names = append(names, tag.Name())
+		case mustache.Section, mustache.InvertedSection:
+			names = append(names, mustachePartialNames(tag.Tags())...)
+		}
+	}
+	return names
+}
+
+// checkMustacheRecursion fails when a partial includes itself, directly or
+// through other partials, which would render without end
+func checkMustacheRecursion(names []string, includes map[string][]string) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(includes))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("partial %q includes itself", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, included := range includes[name] {
+			if _, ok := includes[included]; !ok {
+				continue
+			}
+			if err := visit(included); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Execute renders the template with data as the root context
+func (t *mustacheTemplate) Execute(w io.Writer, data interface{}) error {
+	return t.tmpl.FRender(w, data)
+}
+
+// Variables lists the names the template references. Names inside sections
+// are reported below the section as ".section[].name", although Mustache
+// also resolves them against enclosing contexts.
+func (t *mustacheTemplate) Variables() []Variable {
+	found := map[string]*Variable{}
+	var walk func(tags []mustache.Tag, prefix string, depth int)
+	walk = func(tags []mustache.Tag, prefix string, depth int) {
+		for _, tag := range tags {
+			if tag.Type() == mustache.Partial {
+				text, ok := t.partials[tag.Name()]
+				if !ok || depth >= MaxTemplateDepth {
+					continue
+				}
+				if partial, err := mustache.ParseStringPartials(text, &mustache.StaticProvider{Partials: t.partials}); err == nil {
+					walk(partial.Tags(), prefix, depth+1)
+				}
+				continue
+			}
+			if tag.Name() == "." {
+				continue
+			}
+			name := prefix + "." + tag.Name()
+			v, ok := found[name]
+			if !ok {
+				v = &Variable{Name: name}
+				found[name] = v
+			}
+			switch tag.Type() {
+			case mustache.Section:
+				v.Iterated = true
+				walk(tag.Tags(), name+"[]", depth)
+			case mustache.InvertedSection:
+				walk(tag.Tags(), prefix, depth)
+			}
+		}
+	}
+	walk(t.tmpl.Tags(), "", 0)
+
+	variables := make([]Variable, 0, len(found))
+	for _, v := range found {
+		variables = append(variables, *v)
+	}
+	return variables
+}
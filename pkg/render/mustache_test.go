@@ -0,0 +1,104 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func renderMustache(t *testing.T, req Request) (string, error) {
+	t.Helper()
+	req.Engine = "mustache"
+	return Render(context.Background(), req, DefaultLimits)
+}
+
+func TestMustache(t *testing.T) {
+	data := map[string]interface{}{
+		"name":    "Chris",
+		"html":    "<b>&\"</b>",
+		"empty":   []interface{}{},
+		"blank":   "",
+		"person":  map[string]interface{}{"first": "Ada", "address": map[string]interface{}{"city": "London"}},
+		"items":   []interface{}{map[string]interface{}{"n": "a"}, map[string]interface{}{"n": "b"}},
+		"numbers": []interface{}{float64(1), float64(2), 2.5},
+		"enabled": true,
+	}
+	tests := []struct {
+		name     string
+		text     string
+		partials map[string]string
+		want     string
+	}{
+		{"variable", "Hello {{name}}!", nil, "Hello Chris!"},
+		{"escaped", "{{html}}", nil, "&lt;b&gt;&amp;&#34;&lt;/b&gt;"},
+		{"triple", "{{{html}}}", nil, `<b>&"</b>`},
+		{"ampersand", "{{& html}}", nil, `<b>&"</b>`},
+		{"missing", "[{{nope}}]", nil, "[]"},
+		{"dotted", "{{person.address.city}}", nil, "London"},
+		{"list section", "{{#items}}<{{n}}>{{/items}}", nil, "<a><b>"},
+		{"implicit iterator", "{{#numbers}}{{.}},{{/numbers}}", nil, "1,2,2.5,"},
+		{"object section", "{{#person}}{{first}} from {{address.city}}, {{name}}{{/person}}", nil, "Ada from London, Chris"},
+		{"falsey", "{{#empty}}x{{/empty}}{{#blank}}x{{/blank}}{{#nope}}x{{/nope}}{{#enabled}}on{{/enabled}}", nil, "on"},
+		{"inverted", "{{^empty}}none{{/empty}}{{^enabled}}off{{/enabled}}", nil, "none"},
+		{"comment", "a{{! ignored }}b", nil, "ab"},
+		{"standalone", "begin\n  {{#items}}\n  {{n}}\n  {{/items}}\nend\n", nil, "begin\n  a\n  b\nend\n"},
+		{"delimiters", "{{=<% %>=}}<% name %> {{name}} <%={{ }}=%>{{name}}", nil, "Chris {{name}} Chris"},
+		{"partial", "{{#items}}{{> item}}{{/items}}", map[string]string{"item": "({{n}})"}, "(a)(b)"},
+		{"indented partial", "list:\n  {{> lines}}\n", map[string]string{"lines": "one\ntwo\n"}, "list:\n  one\n  two\n"},
+		{"unknown partial", "[{{> nope}}]", nil, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderMustache(t, Request{Text: tt.text, Partials: tt.partials, Parameters: data})
+			if err != nil {
+				t.Fatalf("render returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMustacheOptionsAndErrors(t *testing.T) {
+	value := "n/a"
+	if _, err := renderMustache(t, Request{Text: "{{nope}}", MissingValue: &value}); err == nil {
+		t.Error("Expected missing value substitutes to be refused")
+	}
+	if _, err := renderMustache(t, Request{Text: "{{nope}}", MissingKey: "error"}); err == nil {
+		t.Error("Expected missingKey error to be refused")
+	}
+	if got, err := renderMustache(t, Request{Text: "\n<% name %>\n", Delimiters: []string{"<%", "%>"}, Parameters: map[string]interface{}{"name": "x"}}); err != nil || got != "\nx\n" {
+		t.Errorf("Expected request delimiters to apply, got %q, %v", got, err)
+	}
+	if _, err := renderMustache(t, Request{Text: "x", Delimiters: []string{"<%", "= %>"}}); err == nil {
+		t.Error("Expected delimiters with spaces or '=' to be refused")
+	}
+
+	for _, text := range []string{"{{#a}}", "{{#a}}{{/b}}", "{{/a}}", "{{name"} {
+		if _, err := renderMustache(t, Request{Text: text}); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("%q: expected a parse error, got %v", text, err)
+		}
+	}
+	if _, err := renderMustache(t, Request{Text: "{{> self}}", Partials: map[string]string{"self": "x{{> self}}"}}); err == nil {
+		t.Error("Expected recursive partials to fail")
+	}
+}
+
+func TestMustacheVariables(t *testing.T) {
+	variables, err := engineVariables(Request{
+		Engine:   "mustache",
+		Text:     "{{title}} {{#items}}{{name}}{{/items}}{{^items}}{{fallback}}{{/items}} {{> footer}}",
+		Partials: map[string]string{"footer": "{{company}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range variables {
+		names = append(names, v.Name)
+	}
+	if got := strings.Join(names, " "); got != ".company .fallback .items .items[].name .title" {
+		t.Errorf("Unexpected variables %q", got)
+	}
+}
@@ -0,0 +1,220 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// decimalPattern matches plain decimal numbers, which are formatted digit
+// by digit rather than through a float
+var decimalPattern = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`)
+
+// currencyAfterLanguages write the currency after the amount (1.234,50 €)
+var currencyAfterLanguages = map[string]bool{
+	"de": true, "fr": true, "es": true, "it": true, "pl": true, "cs": true, "sk": true, "ru": true,
+}
+
+// currencyAfterLocales overrides the currency position of a language in a
+// region. Symbols and minor units come from CLDR through x/text/currency,
+// which has no currency patterns, so the position is kept here.
+var currencyAfterLocales = map[string]bool{"de-CH": false, "it-CH": false, "pt-PT": true}
+
+// unspacedCurrencyLanguages write a leading currency symbol right before
+// the amount ($12.50); other languages and currency codes take a space
+var unspacedCurrencyLanguages = map[string]bool{"en": true, "ja": true, "zh": true, "ko": true}
+
+// numberFuncs format numbers, percentages and amounts with the separators
+// and currency conventions of locale, rounding half away from zero:
+//
+//	{{formatNumber 2 .Total}}             → 1,234.50 (en), 1.234,50 (de)
+//	{{formatCurrency "EUR" .Total}}       → €1,234.50 (en), 1.234,50 € (de)
+//	{{formatPercent 1 .Share}}            → 12.5% (en), 12,5 % (de)
+//
+// Amounts may be numbers or decimal strings; strings keep every digit, so
+// "0.005" rounds to 0.01.
+func numberFuncs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"formatNumber": func(decimals int, value interface{}) (string, error) {
+			return formatNumber(locale, decimals, value)
+		},
+		"formatCurrency": func(code string, value interface{}) (string, error) {
+			return formatCurrency(locale, code, value)
+		},
+		"formatPercent": func(decimals int, value interface{}) (string, error) {
+			return formatPercent(locale, decimals, value)
+		},
+	}
+}
+
+// formatNumber rounds value to decimals digits and groups its thousands
+func formatNumber(locale string, decimals int, value interface{}) (string, error) {
+	digits, err := decimalDigits(value)
+	if err != nil {
+		return "", err
+	}
+	return groupDecimal(locale, roundDecimal(digits, decimals)), nil
+}
+
+// localeTag returns the language tag of locale, English when it has none
+func localeTag(locale string) language.Tag {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return language.English
+	}
+	return tag
+}
+
+// currencyUnit looks up an ISO 4217 code and the digits of its minor unit
+func currencyUnit(code string) (currency.Unit, int, bool) {
+	unit, err := currency.ParseISO(code)
+	if err != nil || len(code) != 3 {
+		return currency.Unit{}, 0, false
+	}
+	decimals, _ := currency.Standard.Rounding(unit)
+	return unit, decimals, true
+}
+
+// formatCurrency formats value as an amount of the currency with ISO 4217
+// code, with the CLDR symbol of the currency in locale and its minor units
+func formatCurrency(locale, code string, value interface{}) (string, error) {
+	code = strings.ToUpper(code)
+	unit, decimals, ok := currencyUnit(code)
+	if !ok {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	amount, err := formatNumber(locale, decimals, value)
+	if err != nil {
+		return "", err
+	}
+	sign := ""
+	if strings.HasPrefix(amount, "-") {
+		sign, amount = "-", amount[1:]
+	}
+	symbol := message.NewPrinter(localeTag(locale)).Sprint(currency.Symbol(unit))
+	after, ok := currencyAfterLocales[locale]
+	if !ok {
+		after = currencyAfterLanguages[localeLanguage(locale)]
+	}
+	switch {
+	case after:
+		return sign + amount + "\u00a0" + symbol, nil
+	case symbol == code || !unspacedCurrencyLanguages[localeLanguage(locale)]:
+		return sign + symbol + "\u00a0" + amount, nil
+	}
+	return sign + symbol + amount, nil
+}
+
+// formatPercent formats a fraction (0.125) as a percentage (12.5%)
+func formatPercent(locale string, decimals int, value interface{}) (string, error) {
+	digits, err := decimalDigits(value)
+	if err != nil {
+		return "", err
+	}
+	formatted := groupDecimal(locale, roundDecimal(shiftDecimal(digits, 2), decimals))
+	// The percent sign and its spacing follow the locale's CLDR pattern
+	pattern := message.NewPrinter(localeTag(locale)).Sprint(number.Percent(0.5))
+	if !strings.Contains(pattern, "50") {
+		return formatted + "%", nil
+	}
+	return strings.Replace(pattern, "50", formatted, 1), nil
+}
+
+// decimalDigits returns value as a plain decimal string
+func decimalDigits(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		s = strings.TrimSpace(s)
+		if decimalPattern.MatchString(s) {
+			return strings.TrimPrefix(s, "+"), nil
+		}
+	}
+	f, err := numberValue(value)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+// shiftDecimal multiplies a plain decimal string by 10^places
+func shiftDecimal(s string, places int) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	fraction += strings.Repeat("0", max(places-len(fraction), 0))
+	whole, fraction = whole+fraction[:places], fraction[places:]
+	whole = strings.TrimLeft(whole, "0")
+	if whole == "" {
+		whole = "0"
+	}
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
+
+// roundDecimal rounds a plain decimal string to decimals digits, half away
+// from zero, padding with zeros
+func roundDecimal(s string, decimals int) string {
+	decimals = max(decimals, 0)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, fraction, _ := strings.Cut(s, ".")
+	roundUp := len(fraction) > decimals && fraction[decimals] >= '5'
+	fraction += strings.Repeat("0", max(decimals-len(fraction), 0))
+	digits := []byte(whole + fraction[:decimals])
+	if roundUp {
+		i := len(digits) - 1
+		for ; i >= 0 && digits[i] == '9'; i-- {
+			digits[i] = '0'
+		}
+		if i < 0 {
+			digits = append([]byte{'1'}, digits...)
+		} else {
+			digits[i]++
+		}
+	}
+	whole = strings.TrimLeft(string(digits[:len(digits)-decimals]), "0")
+	if whole == "" {
+		whole = "0"
+	}
+	result := whole
+	if decimals > 0 {
+		result += "." + string(digits[len(digits)-decimals:])
+	}
+	if negative && strings.Trim(result, "0.") != "" {
+		result = "-" + result
+	}
+	return result
+}
+
+// groupDecimal applies the locale's separators to a plain decimal string
+func groupDecimal(locale, s string) string {
+	symbols := numberSymbolsFor(locale)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction, hasFraction := strings.Cut(s, ".")
+	var out strings.Builder
+	out.WriteString(sign)
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			out.WriteString(symbols.Group)
+		}
+		out.WriteRune(digit)
+	}
+	if hasFraction {
+		out.WriteString(symbols.Decimal)
+		out.WriteString(fraction)
+	}
+	return out.String()
+}
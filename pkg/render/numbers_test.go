@@ -0,0 +1,96 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNumberTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{formatNumber 2 .Total}} | {{formatCurrency "EUR" .Total}} | {{formatPercent 1 .Share}}`,
+		Locale:     "de",
+		Parameters: map[string]interface{}{"Total": float64(1234.5), "Share": float64(0.125)},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "1.234,50 | 1.234,50\u00a0€ | 12,5\u00a0%"
+	if output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		locale   string
+		decimals int
+		value    interface{}
+		want     string
+	}{
+		{"en", 2, 1234567.891, "1,234,567.89"},
+		{"en", 0, 999.5, "1,000"},
+		{"en", 2, "1.005", "1.01"},
+		{"en", 2, 1.005, "1.01"},
+		{"en", 1, -0.04, "0.0"},
+		{"en", 2, "-12345678901234567890.125", "-12,345,678,901,234,567,890.13"},
+		{"de-CH", 2, 1234.5, "1’234.50"},
+		{"fr", 0, 1234567, "1\u202f234\u202f567"},
+		{"ja", 3, "+7", "7.000"},
+	}
+	for _, tt := range tests {
+		got, err := formatNumber(tt.locale, tt.decimals, tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("formatNumber(%q, %d, %v) = %q, %v; want %q", tt.locale, tt.decimals, tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := formatNumber("en", 2, "12,50"); err == nil {
+		t.Error("Expected an error for a non-numeric string")
+	}
+}
+
+func TestFormatCurrency(t *testing.T) {
+	tests := []struct {
+		locale string
+		code   string
+		value  interface{}
+		want   string
+	}{
+		{"en", "USD", 1234.5, "$1,234.50"},
+		{"en", "eur", -5, "-€5.00"},
+		{"en", "CHF", 12.5, "CHF\u00a012.50"},
+		{"de", "EUR", 1234.5, "1.234,50\u00a0€"},
+		{"de", "USD", 3, "3,00\u00a0$"},
+		{"de-CH", "CHF", 1234.5, "CHF\u00a01’234.50"},
+		{"nl", "EUR", 10, "€\u00a010,00"},
+		{"ja", "JPY", 1234.5, "￥1,235"},
+		{"en", "KWD", "1.2345", "KWD\u00a01.235"},
+	}
+	for _, tt := range tests {
+		got, err := formatCurrency(tt.locale, tt.code, tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("formatCurrency(%q, %q, %v) = %q, %v; want %q", tt.locale, tt.code, tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := formatCurrency("en", "EURO", 1); err == nil {
+		t.Error("Expected an error for an invalid currency code")
+	}
+}
+
+func TestFormatPercent(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"en", "12.5%"},
+		{"de", "12,5\u00a0%"},
+		{"nl", "12,5%"},
+		{"de-CH", "12.5%"},
+		{"", "12.5%"},
+	}
+	for _, tt := range tests {
+		got, err := formatPercent(tt.locale, 1, 0.125)
+		if err != nil || got != tt.want {
+			t.Errorf("formatPercent(%q, 1, 0.125) = %q, %v; want %q", tt.locale, got, err, tt.want)
+		}
+	}
+}
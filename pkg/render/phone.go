@@ -0,0 +1,70 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// phoneFormats are the styles of formatPhone
+var phoneFormats = map[string]phonenumbers.PhoneNumberFormat{
+	"e164":          phonenumbers.E164,
+	"international": phonenumbers.INTERNATIONAL,
+	"national":      phonenumbers.NATIONAL,
+}
+
+// phoneFuncs format phone numbers for a render in locale:
+//
+//	{{formatPhone "e164" .Phone}}                 → +41446681800
+//	{{formatPhone "international" .Phone}}        → +41 44 668 18 00
+//	{{formatPhone "national" "CH" "044 668 1800"}} → 044 668 18 00
+//
+// Numbers without a + and calling code are read in the given region, or
+// in the region of the locale (de-CH reads them as Swiss).
+func phoneFuncs(locale string) template.FuncMap {
+	parts := strings.Split(locale, "-")
+	region := ""
+	if last := parts[len(parts)-1]; len(parts) > 1 && len(last) == 2 {
+		region = last
+	}
+	return template.FuncMap{
+		"formatPhone": func(style string, args ...interface{}) (string, error) {
+			numberRegion := region
+			switch len(args) {
+			case 1:
+			case 2:
+				r, ok := args[0].(string)
+				if !ok {
+					return "", fmt.Errorf("formatPhone: region must be a string, got %T", args[0])
+				}
+				numberRegion = strings.ToUpper(r)
+			default:
+				return "", fmt.Errorf("formatPhone expects a style, an optional region and a number")
+			}
+			return formatPhone(style, numberRegion, maskString(args[len(args)-1]))
+		},
+	}
+}
+
+// formatPhone formats number in style e164, international or national,
+// reading national numbers in region. Parsing, validation and formatting
+// follow libphonenumber's metadata.
+func formatPhone(style, region, number string) (string, error) {
+	format, ok := phoneFormats[style]
+	if !ok {
+		return "", fmt.Errorf("formatPhone: unknown style %q (expected e164, international or national)", style)
+	}
+	parsed, err := phonenumbers.Parse(number, region)
+	if err != nil {
+		if region == "" && err == phonenumbers.ErrInvalidCountryCode {
+			return "", fmt.Errorf("formatPhone: %q has no calling code and no region is given", number)
+		}
+		return "", fmt.Errorf("formatPhone: %q is not a phone number: %w", number, err)
+	}
+	if !phonenumbers.IsValidNumber(parsed) {
+		return "", fmt.Errorf("formatPhone: %q is not a valid phone number", number)
+	}
+	return phonenumbers.Format(parsed, format), nil
+}
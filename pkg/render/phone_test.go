@@ -0,0 +1,62 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFormatPhone(t *testing.T) {
+	tests := []struct {
+		style, region, number string
+		want                  string
+	}{
+		{"e164", "", "+41 44 668 18 00", "+41446681800"},
+		{"international", "CH", "044 668 1800", "+41 44 668 18 00"},
+		{"national", "CH", "0041 (0)44 668 18 00", "044 668 18 00"},
+		{"international", "", "+1 (201) 555-0123", "+1 201-555-0123"},
+		{"national", "US", "1-201-555-0123", "(201) 555-0123"},
+		{"international", "DE", "0151 23456789", "+49 1512 3456789"},
+		{"national", "DE", "+49 30 12345678", "030 12345678"},
+		{"international", "DE", "07071 123456", "+49 7071 123456"},
+		{"international", "", "+81 3-1234-5678", "+81 3-1234-5678"},
+		{"national", "BR", "+55 11 91234-5678", "(11) 91234-5678"},
+		{"international", "FR", "01 23 45 67 89", "+33 1 23 45 67 89"},
+		{"international", "GB", "07400 123456", "+44 7400 123456"},
+		{"international", "IT", "02 1234 5678", "+39 02 1234 5678"},
+		{"international", "", "+351 912 345 678", "+351 912 345 678"},
+	}
+	for _, tt := range tests {
+		got, err := formatPhone(tt.style, tt.region, tt.number)
+		if err != nil || got != tt.want {
+			t.Errorf("formatPhone(%s, %s, %q) = %q, %v; want %q", tt.style, tt.region, tt.number, got, err, tt.want)
+		}
+	}
+
+	invalid := []struct{ style, region, number string }{
+		{"e164", "", "044 668 18 00"},
+		{"e164", "CH", "044 668 18"},
+		{"e164", "", "+999 123"},
+		{"e164", "CH", "call me"},
+		{"e164", "XX", "123456"},
+		{"rfc3966", "CH", "044 668 18 00"},
+	}
+	for _, tt := range invalid {
+		if got, err := formatPhone(tt.style, tt.region, tt.number); err == nil {
+			t.Errorf("formatPhone(%s, %s, %q) = %q, want an error", tt.style, tt.region, tt.number, got)
+		}
+	}
+}
+
+func TestFormatPhoneLocale(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{formatPhone "international" .Phone}}|{{formatPhone "national" "FR" "+33123456789"}}`,
+		Parameters: map[string]interface{}{"Phone": "044 668 18 00"},
+		Locale:     "de-CH",
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	if want := "+41 44 668 18 00|01 23 45 67 89"; output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
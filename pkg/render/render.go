@@ -0,0 +1,175 @@
+// Package render is the rendering engine of the template service: the Go
+// text/template, Mustache, Handlebars, Jinja2 and Liquid engines, the
+// template function library, execution limits and output assertions. Go
+// services that render on latency-critical paths embed it instead of
+// calling the service over HTTP; the service itself wraps it with template
+// storage, caching, access policy and delivery.
+//
+//	output, err := render.Render(ctx, render.Request{
+//		Text:       "Hello {{.name}}",
+//		Parameters: map[string]interface{}{"name": "Ada"},
+//	}, render.DefaultLimits)
+//
+// Parsed templates are safe for concurrent use, so callers rendering the
+// same template repeatedly can Parse it once and Execute it many times.
+// A Renderer does this for the templates of a file system and applies
+// shared Options to every render:
+//
+//	renderer := render.New(render.Options{Templates: os.DirFS("templates")})
+//	result, err := renderer.RenderFile(ctx, "invoice.html", params)
+package render
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"text/template"
+)
+
+// LayoutContentBlock is the block of a layout that receives the body of
+// the content template
+const LayoutContentBlock = "content"
+
+// MaxTemplateDepth bounds how deep partials, includes and inheritance are
+// followed
+const MaxTemplateDepth = 16
+
+// Request is a template to render and the options it is rendered with
+type Request struct {
+	Name           string                 // Template name, used in errors (default "template")
+	Text           string                 // Template content
+	Parameters     map[string]interface{} // Template variables
+	Engine         string                 // Template engine (default go, see EngineNames)
+	EncodingFormat string                 // Output format; application/sql binds the SQL functions to its dialect
+
+	Partials   map[string]string // Named templates available to {{template "name" .}} and includes
+	Layout     string            // Name of the layout, for errors
+	LayoutText string            // Layout whose content block the template fills (Go engine only)
+
+	Delimiters   []string // Optional [left, right] action delimiters (default "{{", "}}")
+	MissingKey   string   // Missing map key handling: default, zero or error
+	MissingValue *string  // Substitute printed for missing keys (overrides MissingKey)
+
+	Locale   string            // Locale of the translation, date and number functions
+	Messages map[string]string // Translated messages of {{t "key"}}, by dotted key
+	Debug    bool              // Add the dump and debugJSON functions (Go engine only)
+
+	Funcs template.FuncMap // Template functions (default the full library, see Funcs)
+}
+
+// defaultFuncs is the function library of requests that bring none
+var defaultFuncs = Funcs(true)
+
+// funcMap returns the request's template functions
+func (r Request) funcMap() template.FuncMap {
+	if r.Funcs != nil {
+		return r.Funcs
+	}
+	return defaultFuncs
+}
+
+// Error describes a failed render. Message is the client-facing summary,
+// Status the HTTP status a service reports for it, Details optional
+// itemized causes (e.g. failed assertions).
+type Error struct {
+	Message string
+	Status  int
+	Err     error
+	Details []string
+
+	Violations []Violation // Structured output assertion failures, in the order of Details
+
+	Stage string // Stage that failed, for metrics: parse, execute, timeout, ...
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Render parses the request's template and executes it with the request's
+// parameters within limits
+func Render(ctx context.Context, req Request, limits Limits) (string, error) {
+	tmpl, err := Parse(req)
+	if err != nil {
+		return "", err
+	}
+	return Execute(ctx, tmpl, req.Parameters, limits)
+}
+
+// Parse parses the request's template, ready to execute
+func Parse(req Request) (Template, error) {
+	tmpl, err := Compile(req)
+	if err != nil {
+		return nil, err
+	}
+	return Bind(tmpl, req)
+}
+
+// Compile parses the request's template with its engine. Compiled
+// templates may be cached and shared by the renders of the same template;
+// Bind applies the options of the render that executes one.
+func Compile(req Request) (Template, error) {
+	engine, err := EngineFor(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	return engine.Parse(req)
+}
+
+// Bind returns the compiled template bound to the request's locale,
+// messages, missing-key substitute and SQL dialect. Go templates are
+// copied, which keeps the compiled one shareable; templates of other
+// engines take these options when compiled.
+func Bind(tmpl Template, req Request) (Template, error) {
+	goTmpl, ok := tmpl.(*template.Template)
+	if !ok {
+		return tmpl, nil
+	}
+	var err error
+	if req.MissingValue != nil {
+		goTmpl, err = bindMissingValue(goTmpl, *req.MissingValue)
+	}
+	if err == nil && req.Locale != "" {
+		goTmpl, err = bindLocale(goTmpl, req.Locale, req.Messages)
+	}
+	if err == nil && outputFormat(req.EncodingFormat) == outputFormatSQL {
+		var dialect string
+		if dialect, err = sqlDialect(req.EncodingFormat); err == nil && dialect != sqlDialectPostgres {
+			goTmpl, err = bindSQLDialect(goTmpl, dialect)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return goTmpl, nil
+}
+
+// parsePartials adds the named partials to tmpl. They share its delimiters,
+// functions and options and may include each other.
+func parsePartials(tmpl *template.Template, partials map[string]string) error {
+	for _, name := range sortedKeys(partials) {
+		if name == "" || name == tmpl.Name() {
+			return &Error{Message: fmt.Sprintf("invalid partial name %q", name), Status: http.StatusBadRequest}
+		}
+		if _, err := tmpl.New(name).Parse(partials[name]); err != nil {
+			return &Error{Message: fmt.Sprintf("failed to parse partial %q", name), Status: http.StatusBadRequest, Err: err}
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, for deterministic parsing
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+)
+
+// engineVariables lists the variables of req's template by name
+func engineVariables(req Request) ([]Variable, error) {
+	tmpl, err := Compile(req)
+	if err != nil {
+		return nil, err
+	}
+	variables := tmpl.(VariableLister).Variables()
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+	return variables, nil
+}
+
+func TestRender(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{.name | upper}} {{template "sig" .}}`,
+		Parameters: map[string]interface{}{"name": "ada"},
+		Partials:   map[string]string{"sig": "-- {{.name}}"},
+	}, DefaultLimits)
+	if err != nil || output != "ADA -- ada" {
+		t.Errorf("Render() = %q, %v", output, err)
+	}
+
+	_, err = Render(context.Background(), Request{Text: "{{.name", Name: "greeting"}, DefaultLimits)
+	var re *Error
+	if !errors.As(err, &re) || re.Status != http.StatusBadRequest || !strings.Contains(err.Error(), "greeting") {
+		t.Errorf("Render() error = %v, want a 400 naming the template", err)
+	}
+
+	if _, err := Render(context.Background(), Request{Text: "x", Engine: "erb"}, DefaultLimits); err == nil {
+		t.Error("Render() should reject unknown engines")
+	}
+}
+
+func TestRender_Funcs(t *testing.T) {
+	funcs := template.FuncMap{"shout": func(s string) string { return s + "!" }}
+	output, err := Render(context.Background(), Request{Text: `{{shout "hi"}}`, Funcs: funcs}, DefaultLimits)
+	if err != nil || output != "hi!" {
+		t.Errorf("Render() = %q, %v", output, err)
+	}
+	if _, err := Render(context.Background(), Request{Text: `{{upper "hi"}}`, Funcs: funcs}, DefaultLimits); err == nil {
+		t.Error("Render() should only offer the request's functions")
+	}
+}
+
+func TestCompileBind(t *testing.T) {
+	// One compiled template serves renders with different options
+	tmpl, err := Compile(Request{Text: `{{.missing}} {{t "hello"}}`, MissingValue: new(string)})
+	if err != nil {
+		t.Fatalf("Compile() returned error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, tt := range []struct{ locale, value, hello, want string }{
+		{"en", "-", "Hello", "- Hello"},
+		{"de", "?", "Hallo", "? Hallo"},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value := tt.value
+			bound, err := Bind(tmpl, Request{Locale: tt.locale, Messages: map[string]string{"hello": tt.hello}, MissingValue: &value})
+			if err != nil {
+				t.Errorf("Bind(%s) returned error: %v", tt.locale, err)
+				return
+			}
+			if output, err := Execute(context.Background(), bound, nil, DefaultLimits); err != nil || output != tt.want {
+				t.Errorf("Execute(%s) = %q, %v; want %q", tt.locale, output, err, tt.want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEngineFromFormat(t *testing.T) {
+	tests := []struct {
+		format, engine, output string
+		ok                     bool
+	}{
+		{"text/html+mustache", "mustache", "text/html", true},
+		{"text/x-liquid", "liquid", "", true},
+		{"text/html", "", "text/html", false},
+	}
+	for _, tt := range tests {
+		engine, output, ok := EngineFromFormat(tt.format)
+		if engine != tt.engine || output != tt.output || ok != tt.ok {
+			t.Errorf("EngineFromFormat(%q) = %q, %q, %v", tt.format, engine, output, ok)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Options configure a Renderer. The zero value renders inline templates
+// with the full function library within DefaultLimits.
+type Options struct {
+	Templates fs.FS             // Templates loaded by name with Load and RenderFile (optional)
+	Partials  map[string]string // Named templates available to every render
+
+	Engine         string            // Engine of templates that name none (default go)
+	EncodingFormat string            // Output format of templates that name none
+	MissingKey     string            // Missing map key handling: default, zero or error
+	Locale         string            // Locale of templates that name none
+	Messages       map[string]string // Translated messages of {{t "key"}}
+
+	Funcs  template.FuncMap // Template functions (default the full library, see Funcs)
+	Limits *Limits          // Execution limits (default DefaultLimits)
+}
+
+// Result is the output of a render and how it was produced
+type Result struct {
+	Output         string
+	EncodingFormat string        // Output format, without an engine suffix
+	Engine         string        // Engine that rendered the template
+	SHA256         string        // Hex SHA-256 of Output
+	Duration       time.Duration // Time spent parsing and executing
+}
+
+// Renderer renders templates with shared options. Templates loaded from
+// Options.Templates are parsed once and cached, so a Renderer is meant to
+// live as long as its templates do; it is safe for concurrent use.
+type Renderer struct {
+	opts   Options
+	limits Limits
+
+	mu     sync.Mutex
+	loaded map[string]*loadedTemplate
+}
+
+// loadedTemplate is a template of Options.Templates parsed with the
+// renderer's options
+type loadedTemplate struct {
+	tmpl           Template
+	engine         string
+	encodingFormat string
+}
+
+// New returns a Renderer with the given options
+func New(opts Options) *Renderer {
+	limits := DefaultLimits
+	if opts.Limits != nil {
+		limits = *opts.Limits
+	}
+	return &Renderer{opts: opts, limits: limits, loaded: make(map[string]*loadedTemplate)}
+}
+
+// Render renders an inline template. Options of the renderer fill in what
+// the request leaves unset, and the engine may be named by the encoding
+// format (e.g. "text/html+mustache").
+func (r *Renderer) Render(ctx context.Context, req Request) (*Result, error) {
+	start := time.Now()
+	req = r.defaults(req)
+	tmpl, err := Parse(req)
+	if err != nil {
+		return nil, err
+	}
+	return r.execute(ctx, tmpl, req.Engine, req.EncodingFormat, req.Parameters, start)
+}
+
+// RenderFile renders the template of Options.Templates at name (see Load)
+func (r *Renderer) RenderFile(ctx context.Context, name string, params map[string]interface{}) (*Result, error) {
+	start := time.Now()
+	loaded, err := r.load(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.execute(ctx, loaded.tmpl, loaded.engine, loaded.encodingFormat, params, start)
+}
+
+// Load parses the template of Options.Templates at name, a slash-separated
+// path. Its engine and output format follow from the file's extensions:
+// "invoice.html.mustache" is HTML rendered with the mustache engine,
+// "invoice.html" HTML rendered with the renderer's engine. Parsed templates
+// are cached by name.
+func (r *Renderer) Load(name string) (Template, error) {
+	loaded, err := r.load(name)
+	if err != nil {
+		return nil, err
+	}
+	return loaded.tmpl, nil
+}
+
+func (r *Renderer) load(name string) (*loadedTemplate, error) {
+	r.mu.Lock()
+	loaded, ok := r.loaded[name]
+	r.mu.Unlock()
+	if ok {
+		return loaded, nil
+	}
+
+	if r.opts.Templates == nil {
+		return nil, &Error{Message: "renderer has no templates to load", Status: http.StatusNotFound}
+	}
+	data, err := fs.ReadFile(r.opts.Templates, name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			status = http.StatusNotFound
+		}
+		return nil, &Error{Message: fmt.Sprintf("failed to load template %q", name), Status: status, Err: err}
+	}
+	engine, format := fileFormat(name)
+	req := r.defaults(Request{Name: name, Text: string(data), Engine: engine, EncodingFormat: format})
+	tmpl, err := Parse(req)
+	if err != nil {
+		return nil, err
+	}
+	loaded = &loadedTemplate{tmpl: tmpl, engine: req.Engine, encodingFormat: req.EncodingFormat}
+
+	r.mu.Lock()
+	r.loaded[name] = loaded
+	r.mu.Unlock()
+	return loaded, nil
+}
+
+// defaults fills in the options req leaves unset and resolves its engine
+func (r *Renderer) defaults(req Request) Request {
+	if req.EncodingFormat == "" {
+		req.EncodingFormat = r.opts.EncodingFormat
+	}
+	if name, output, ok := EngineFromFormat(req.EncodingFormat); ok {
+		if req.Engine == "" {
+			req.Engine = name
+		}
+		req.EncodingFormat = output
+	}
+	if req.Engine == "" {
+		req.Engine = r.opts.Engine
+	}
+	if req.Engine == "" {
+		req.Engine = GoEngine
+	}
+	if req.MissingKey == "" {
+		req.MissingKey = r.opts.MissingKey
+	}
+	if req.Locale == "" {
+		req.Locale = r.opts.Locale
+	}
+	if req.Messages == nil {
+		req.Messages = r.opts.Messages
+	}
+	if req.Funcs == nil {
+		req.Funcs = r.opts.Funcs
+	}
+	if len(r.opts.Partials) > 0 {
+		partials := make(map[string]string, len(r.opts.Partials)+len(req.Partials))
+		for name, text := range r.opts.Partials {
+			partials[name] = text
+		}
+		for name, text := range req.Partials {
+			partials[name] = text
+		}
+		req.Partials = partials
+	}
+	return req
+}
+
+func (r *Renderer) execute(ctx context.Context, tmpl Template, engine, format string, params map[string]interface{}, start time.Time) (*Result, error) {
+	output, err := Execute(ctx, tmpl, params, r.limits)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(output))
+	return &Result{
+		Output:         output,
+		EncodingFormat: format,
+		Engine:         engine,
+		SHA256:         hex.EncodeToString(sum[:]),
+		Duration:       time.Since(start),
+	}, nil
+}
+
+// fileEngines are the engines named by template file extensions
+var fileEngines = map[string]string{
+	".mustache":   "mustache",
+	".hbs":        "handlebars",
+	".handlebars": "handlebars",
+	".j2":         "jinja2",
+	".jinja":      "jinja2",
+	".jinja2":     "jinja2",
+	".liquid":     "liquid",
+}
+
+// fileFormat returns the engine and output format named by the extensions
+// of a template file, "" for those it does not name
+func fileFormat(name string) (engine, format string) {
+	ext := strings.ToLower(path.Ext(name))
+	if e, ok := fileEngines[ext]; ok {
+		engine = e
+		name = strings.TrimSuffix(name, path.Ext(name))
+		ext = strings.ToLower(path.Ext(name))
+	}
+	switch ext {
+	case "", ".tmpl", ".tpl", ".gotmpl":
+	case ".txt", ".text":
+		format = "text/plain"
+	default:
+		if mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil {
+			format = mediaType
+		}
+	}
+	return engine, format
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderer_Render(t *testing.T) {
+	r := New(Options{
+		Partials:       map[string]string{"sig": "-- {{.team}}"},
+		EncodingFormat: "text/plain",
+		Locale:         "de-DE",
+		Messages:       map[string]string{"greeting": "Hallo"},
+	})
+	result, err := r.Render(context.Background(), Request{
+		Text:       `{{t "greeting"}} {{.name}} {{template "sig" .}}`,
+		Parameters: map[string]interface{}{"name": "Ada", "team": "Ops"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "Hallo Ada -- Ops" || result.Engine != GoEngine || result.EncodingFormat != "text/plain" {
+		t.Errorf("Render() = %+v", result)
+	}
+	if sum := sha256.Sum256([]byte(result.Output)); result.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %q", result.SHA256)
+	}
+
+	// Messages of the request replace the renderer's, under its locale
+	result, err = r.Render(context.Background(), Request{
+		Text:     `{{t "greeting"}}`,
+		Messages: map[string]string{"greeting": "Servus"},
+	})
+	if err != nil || result.Output != "Servus" {
+		t.Errorf("Render() with the request's messages = %+v, %v", result, err)
+	}
+
+	// The encoding format names the engine
+	result, err = r.Render(context.Background(), Request{
+		Text:           "<p>{{name}}</p>",
+		EncodingFormat: "text/html+mustache",
+		Parameters:     map[string]interface{}{"name": "<Ada>"},
+	})
+	if err != nil || result.Output != "<p>&lt;Ada&gt;</p>" || result.Engine != "mustache" || result.EncodingFormat != "text/html" {
+		t.Errorf("Render() of mustache = %+v, %v", result, err)
+	}
+}
+
+func TestRenderer_RenderFile(t *testing.T) {
+	templates := fstest.MapFS{
+		"mail/invoice.html.mustache": {Data: []byte("<b>{{total}}</b>")},
+		"mail/invoice.txt":           {Data: []byte("Total: {{.total}}")},
+		"broken.tmpl":                {Data: []byte("{{.total")},
+	}
+	r := New(Options{Templates: templates, Limits: &Limits{MaxOutputBytes: 64}})
+	params := map[string]interface{}{"total": "42.00"}
+
+	for name, want := range map[string]Result{
+		"mail/invoice.html.mustache": {Output: "<b>42.00</b>", Engine: "mustache", EncodingFormat: "text/html"},
+		"mail/invoice.txt":           {Output: "Total: 42.00", Engine: GoEngine, EncodingFormat: "text/plain"},
+	} {
+		result, err := r.RenderFile(context.Background(), name, params)
+		if err != nil {
+			t.Errorf("RenderFile(%q) returned error: %v", name, err)
+			continue
+		}
+		if result.Output != want.Output || result.Engine != want.Engine || result.EncodingFormat != want.EncodingFormat {
+			t.Errorf("RenderFile(%q) = %+v; want %+v", name, result, want)
+		}
+	}
+
+	// Loaded templates are cached
+	first, _ := r.Load("mail/invoice.txt")
+	second, _ := r.Load("mail/invoice.txt")
+	if first != second {
+		t.Error("Load() parsed a cached template again")
+	}
+
+	var re *Error
+	if _, err := r.RenderFile(context.Background(), "missing.txt", nil); !errors.As(err, &re) || re.Status != http.StatusNotFound {
+		t.Errorf("RenderFile() of a missing template = %v; want 404", err)
+	}
+	if _, err := r.RenderFile(context.Background(), "broken.tmpl", nil); !errors.As(err, &re) || re.Status != http.StatusBadRequest {
+		t.Errorf("RenderFile() of a broken template = %v; want 400", err)
+	}
+	if _, err := r.RenderFile(context.Background(), "mail/invoice.txt", map[string]interface{}{"total": string(make([]byte, 100))}); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("RenderFile() beyond the output limit = %v; want ErrOutputTooLarge", err)
+	}
+	if _, err := New(Options{}).Load("invoice.txt"); !errors.As(err, &re) || re.Status != http.StatusNotFound {
+		t.Errorf("Load() without templates = %v; want 404", err)
+	}
+}
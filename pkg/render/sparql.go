@@ -0,0 +1,305 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// sparqlQueryForms and sparqlUpdateOperations are the keywords a query or
+// an update request starts with after its prologue
+var (
+	sparqlQueryForms       = []string{"SELECT", "CONSTRUCT", "DESCRIBE", "ASK"}
+	sparqlUpdateOperations = []string{"INSERT", "DELETE", "LOAD", "CLEAR", "CREATE", "DROP", "COPY", "MOVE", "ADD", "WITH"}
+)
+
+// sparqlIRIPattern matches an IRI reference at the start of the input
+var sparqlIRIPattern = regexp.MustCompile(`^<[^<>"{}|^` + "`" + `\\\x00-\x20]*>`)
+
+// sparqlSyntaxError is the first syntax error of a SPARQL query, at a
+// 1-based line and column (in characters)
+type sparqlSyntaxError struct {
+	Line, Column int
+	Message      string
+}
+
+func (e *sparqlSyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// sparqlToken is a lexical token of a SPARQL query
+type sparqlToken struct {
+	kind         string // iri, pname, var, bnode, string, number, langtag, word or punct
+	text         string
+	line, column int
+}
+
+// checkSPARQL checks the syntax of a SPARQL 1.1 query, or of an update
+// request when update is set. The check is lexical and structural: tokens,
+// balanced brackets, the prologue, declared prefixes and the query form. It
+// catches the typical results of a broken template (unterminated strings
+// and IRIs, unclosed groups, missing projections, undeclared prefixes)
+// without implementing the full grammar.
+func checkSPARQL(query string, update bool) error {
+	tokens, err := scanSPARQL(query)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return &sparqlSyntaxError{Line: 1, Column: 1, Message: "empty query"}
+	}
+	if err := checkSPARQLBrackets(tokens); err != nil {
+		return err
+	}
+
+	prefixes := map[string]bool{}
+	i := 0
+	for i < len(tokens) && tokens[i].kind == "word" {
+		switch keyword := strings.ToUpper(tokens[i].text); keyword {
+		case "PREFIX":
+			if i+2 >= len(tokens) || tokens[i+1].kind != "pname" || !strings.HasSuffix(tokens[i+1].text, ":") || tokens[i+2].kind != "iri" {
+				return sparqlErrorAt(tokens, i, "PREFIX expects a prefix name such as ex: followed by an <IRI>")
+			}
+			prefixes[strings.TrimSuffix(tokens[i+1].text, ":")] = true
+			i += 3
+			continue
+		case "BASE":
+			if i+1 >= len(tokens) || tokens[i+1].kind != "iri" {
+				return sparqlErrorAt(tokens, i, "BASE expects an <IRI>")
+			}
+			i += 2
+			continue
+		}
+		break
+	}
+
+	for j := i; j < len(tokens); j++ {
+		if tokens[j].kind != "pname" {
+			continue
+		}
+		if prefix, _, _ := strings.Cut(tokens[j].text, ":"); !prefixes[prefix] {
+			return sparqlErrorAt(tokens, j, fmt.Sprintf("undeclared prefix %q", prefix+":"))
+		}
+	}
+
+	if update {
+		if i >= len(tokens) || !sparqlKeywordIn(tokens[i], sparqlUpdateOperations) {
+			return sparqlErrorAt(tokens, i, "expected an update operation such as INSERT, DELETE or LOAD")
+		}
+		return nil
+	}
+	if i >= len(tokens) || !sparqlKeywordIn(tokens[i], sparqlQueryForms) {
+		return sparqlErrorAt(tokens, i, "expected SELECT, CONSTRUCT, DESCRIBE or ASK")
+	}
+	form := strings.ToUpper(tokens[i].text)
+	if form == "SELECT" {
+		j := i + 1
+		if j < len(tokens) && sparqlKeywordIn(tokens[j], []string{"DISTINCT", "REDUCED"}) {
+			j++
+		}
+		if j >= len(tokens) || !(tokens[j].kind == "var" || tokens[j].text == "*" || tokens[j].text == "(") {
+			return sparqlErrorAt(tokens, j, "SELECT expects *, variables or expressions")
+		}
+	}
+	if form != "DESCRIBE" {
+		hasGroup := false
+		for _, token := range tokens[i:] {
+			if token.text == "{" {
+				hasGroup = true
+				break
+			}
+		}
+		if !hasGroup {
+			return sparqlErrorAt(tokens, len(tokens), form+" query has no { } graph pattern")
+		}
+	}
+	return nil
+}
+
+// sparqlKeywordIn reports whether token is one of keywords, case-insensitively
+func sparqlKeywordIn(token sparqlToken, keywords []string) bool {
+	if token.kind != "word" {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(token.text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// sparqlErrorAt returns an error at token i, or just after the last token
+func sparqlErrorAt(tokens []sparqlToken, i int, message string) error {
+	if i < len(tokens) {
+		return &sparqlSyntaxError{Line: tokens[i].line, Column: tokens[i].column, Message: message}
+	}
+	last := tokens[len(tokens)-1]
+	return &sparqlSyntaxError{Line: last.line, Column: last.column + len([]rune(last.text)), Message: message}
+}
+
+// checkSPARQLBrackets checks that braces, parentheses and square brackets
+// are balanced and properly nested
+func checkSPARQLBrackets(tokens []sparqlToken) error {
+	closing := map[string]string{"{": "}", "(": ")", "[": "]"}
+	var open []int
+	for i, token := range tokens {
+		if token.kind != "punct" {
+			continue
+		}
+		switch token.text {
+		case "{", "(", "[":
+			open = append(open, i)
+		case "}", ")", "]":
+			if len(open) == 0 {
+				return sparqlErrorAt(tokens, i, fmt.Sprintf("unexpected %q", token.text))
+			}
+			if want := closing[tokens[open[len(open)-1]].text]; token.text != want {
+				return sparqlErrorAt(tokens, i, fmt.Sprintf("expected %q, found %q", want, token.text))
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		i := open[len(open)-1]
+		return sparqlErrorAt(tokens, i, fmt.Sprintf("%q is never closed", tokens[i].text))
+	}
+	return nil
+}
+
+// scanSPARQL splits a query into tokens, skipping whitespace and comments
+func scanSPARQL(query string) ([]sparqlToken, error) {
+	src := []rune(query)
+	var tokens []sparqlToken
+	line, column := 1, 1
+	pos := 0
+	advance := func(n int) {
+		for _, r := range src[pos : pos+n] {
+			if r == '\n' {
+				line, column = line+1, 1
+			} else {
+				column++
+			}
+		}
+		pos += n
+	}
+	isName := func(r rune) bool { return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	nameEnd := func(from int) int {
+		end := from
+		for end < len(src) && (isName(src[end]) || (src[end] == '.' && end+1 < len(src) && isName(src[end+1]))) {
+			end++
+		}
+		return end
+	}
+
+	for pos < len(src) {
+		r := src[pos]
+		if unicode.IsSpace(r) {
+			advance(1)
+			continue
+		}
+		if r == '#' {
+			n := 0
+			for pos+n < len(src) && src[pos+n] != '\n' {
+				n++
+			}
+			advance(n)
+			continue
+		}
+
+		token := sparqlToken{line: line, column: column}
+		n := 0
+		switch {
+		case r == '<' && sparqlIRIPattern.MatchString(string(src[pos:min(pos+4096, len(src))])):
+			token.kind = "iri"
+			n = len([]rune(sparqlIRIPattern.FindString(string(src[pos:min(pos+4096, len(src))]))))
+		case r == '"' || r == '\'':
+			token.kind = "string"
+			length, message := sparqlStringLength(src[pos:])
+			if message != "" {
+				return nil, &sparqlSyntaxError{Line: line, Column: column, Message: message}
+			}
+			n = length
+		case (r == '?' || r == '$') && pos+1 < len(src) && isName(src[pos+1]):
+			token.kind = "var"
+			n = nameEnd(pos+1) - pos
+		case r == '_' && pos+1 < len(src) && src[pos+1] == ':':
+			token.kind = "bnode"
+			n = nameEnd(pos+2) - pos
+		case r == '@' && pos+1 < len(src) && unicode.IsLetter(src[pos+1]):
+			token.kind = "langtag"
+			n = nameEnd(pos+1) - pos
+		case unicode.IsDigit(r) || (r == '.' && pos+1 < len(src) && unicode.IsDigit(src[pos+1])):
+			token.kind = "number"
+			for n = 1; pos+n < len(src); n++ {
+				c := src[pos+n]
+				if !unicode.IsDigit(c) && c != '.' && c != 'e' && c != 'E' &&
+					!((c == '+' || c == '-') && (src[pos+n-1] == 'e' || src[pos+n-1] == 'E')) {
+					break
+				}
+			}
+			// A trailing dot ends the triple rather than the number
+			if src[pos+n-1] == '.' {
+				n--
+			}
+		case r == ':' || unicode.IsLetter(r):
+			end := nameEnd(pos)
+			if end < len(src) && src[end] == ':' {
+				token.kind = "pname"
+				end = nameEnd(end + 1)
+			} else if r == ':' {
+				token.kind = "pname"
+				end = nameEnd(pos + 1)
+			} else {
+				token.kind = "word"
+			}
+			n = end - pos
+		default:
+			token.kind = "punct"
+			n = 1
+			if pos+1 < len(src) {
+				switch string(src[pos : pos+2]) {
+				case "&&", "||", "!=", "<=", ">=", "^^":
+					n = 2
+				}
+			}
+			if !strings.ContainsRune("{}()[].,;*+-/!=<>&|^?", r) {
+				return nil, &sparqlSyntaxError{Line: line, Column: column, Message: fmt.Sprintf("unexpected character %q", r)}
+			}
+		}
+		token.text = string(src[pos : pos+n])
+		tokens = append(tokens, token)
+		advance(n)
+	}
+	return tokens, nil
+}
+
+// sparqlStringLength returns the length of the string literal src starts
+// with, in short ("...") or long ("""...""") form, or why it is invalid
+func sparqlStringLength(src []rune) (int, string) {
+	quote := src[0]
+	long := len(src) >= 3 && src[1] == quote && src[2] == quote
+	i := 1
+	if long {
+		i = 3
+	}
+	for i < len(src) {
+		switch {
+		case src[i] == '\\':
+			if i+1 >= len(src) || !strings.ContainsRune(`tbnrf"'\u`+"U", src[i+1]) {
+				return 0, "invalid escape sequence in string literal"
+			}
+			i += 2
+			continue
+		case long && i+2 < len(src) && src[i] == quote && src[i+1] == quote && src[i+2] == quote:
+			return i + 3, ""
+		case !long && src[i] == quote:
+			return i + 1, ""
+		case !long && (src[i] == '\n' || src[i] == '\r'):
+			return 0, "line break in string literal; use a long \"\"\" string"
+		}
+		i++
+	}
+	return 0, "unterminated string literal"
+}
@@ -0,0 +1,59 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckSPARQL_Valid(t *testing.T) {
+	queries := []string{
+		`PREFIX schema: <https://schema.org/>
+SELECT DISTINCT ?name (COUNT(?order) AS ?orders) WHERE {
+  ?person a schema:Person ; schema:name ?name .
+  OPTIONAL { ?order schema:customer ?person }
+  FILTER (lang(?name) = "en" && ?age >= 18.5)   # adults only
+} GROUP BY ?name ORDER BY DESC(?orders) LIMIT 10`,
+		`ASK { <http://example.org/a> ?p """multi
+line""" }`,
+		`DESCRIBE <http://example.org/a>`,
+		`BASE <http://example.org/> PREFIX : <#> CONSTRUCT { ?s :label ?l } WHERE { ?s :name ?l . FILTER(?l != 'x'@de) }`,
+	}
+	for _, query := range queries {
+		if err := checkSPARQL(query, false); err != nil {
+			t.Errorf("checkSPARQL(%q) returned error: %v", query, err)
+		}
+	}
+	if err := checkSPARQL(`PREFIX ex: <http://example.org/> INSERT DATA { ex:a ex:b 1 }`, true); err != nil {
+		t.Errorf("checkSPARQL(update) returned error: %v", err)
+	}
+}
+
+func TestCheckSPARQL_Errors(t *testing.T) {
+	tests := []struct {
+		query        string
+		line, column int
+		message      string
+	}{
+		{"SELECT ?s WHERE {\n  ?s ?p \"open\n}", 2, 9, "line break in string literal"},
+		{"SELECT ?s WHERE {\n  ?s ?p ?o .\n", 1, 17, `"{" is never closed`},
+		{"SELECT ?s WHERE { ?s ?p ?o )", 1, 28, `expected "}", found ")"`},
+		{"SELECT WHERE { ?s ?p ?o }", 1, 8, "SELECT expects"},
+		{"SELECT ?s WHERE { ?s ex:name ?o }", 1, 22, `undeclared prefix "ex:"`},
+		{"PREFIX ex <http://example.org/> SELECT * {}", 1, 1, "PREFIX expects"},
+		{"INSERT DATA { <a> <b> <c> }", 1, 1, "expected SELECT"},
+		{"SELECT * { ?s ?p ?o } ~", 1, 23, "unexpected character"},
+		{"  \n", 1, 1, "empty query"},
+	}
+	for _, tt := range tests {
+		var syntaxErr *sparqlSyntaxError
+		err := checkSPARQL(tt.query, false)
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("checkSPARQL(%q) = %v, want a syntax error", tt.query, err)
+			continue
+		}
+		if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column || !strings.Contains(syntaxErr.Message, tt.message) {
+			t.Errorf("checkSPARQL(%q) = %v, want line %d, column %d: %s", tt.query, err, tt.line, tt.column, tt.message)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SQL dialects of the sqlQuote and sqlIdent functions, chosen with the
+// dialect parameter of an application/sql encodingFormat
+const (
+	sqlDialectPostgres = "postgres"
+	sqlDialectMySQL    = "mysql"
+	sqlDialectSQLite   = "sqlite"
+)
+
+// sqlDialect returns the dialect named by an encodingFormat such as
+// "application/sql; dialect=mysql", postgres when it names none
+func sqlDialect(encodingFormat string) (string, error) {
+	_, params, err := mime.ParseMediaType(encodingFormat)
+	if err != nil || params["dialect"] == "" {
+		return sqlDialectPostgres, nil
+	}
+	switch dialect := strings.ToLower(params["dialect"]); dialect {
+	case sqlDialectPostgres, "postgresql":
+		return sqlDialectPostgres, nil
+	case sqlDialectMySQL, "mariadb":
+		return sqlDialectMySQL, nil
+	case sqlDialectSQLite, "sqlite3":
+		return sqlDialectSQLite, nil
+	}
+	return "", &Error{
+		Message: fmt.Sprintf("unknown SQL dialect %q (expected postgres, mysql or sqlite)", params["dialect"]),
+		Status:  http.StatusBadRequest,
+	}
+}
+
+// sqlFuncs quote values and identifiers for SQL in dialect, so that
+// parameters cannot change the structure of a templated statement:
+//
+//	SELECT {{sqlIdent "public" .Table}} WHERE name = {{sqlQuote .Name}}
+//	  AND id IN ({{sqlQuote .IDs}})
+func sqlFuncs(dialect string) template.FuncMap {
+	return template.FuncMap{
+		"sqlQuote": func(value interface{}) (string, error) {
+			return sqlQuote(dialect, value)
+		},
+		"sqlIdent": func(parts ...string) (string, error) {
+			return sqlIdent(dialect, parts)
+		},
+	}
+}
+
+// bindSQLDialect returns a copy of a compiled template whose SQL functions
+// quote for dialect
+func bindSQLDialect(tmpl *template.Template, dialect string) (*template.Template, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, &Error{Message: "failed to prepare template", Status: http.StatusInternalServerError, Err: err}
+	}
+	return clone.Funcs(sqlFuncs(dialect)), nil
+}
+
+// sqlQuote writes value as a SQL literal: strings quoted and escaped, nil as
+// NULL, numbers and booleans bare, times as quoted RFC 3339 and lists as
+// comma-separated literals for IN clauses
+func sqlQuote(dialect string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return sqlString(dialect, v)
+	case bool:
+		switch {
+		case dialect == sqlDialectSQLite && v:
+			return "1", nil
+		case dialect == sqlDialectSQLite:
+			return "0", nil
+		case v:
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("sqlQuote: %v has no SQL literal", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return sqlQuote(dialect, float64(v))
+	case time.Time:
+		return sqlString(dialect, v.Format(time.RFC3339Nano))
+	case fmt.Stringer:
+		return sqlString(dialect, v.String())
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 {
+			return "", fmt.Errorf("sqlQuote: empty list")
+		}
+		literals := make([]string, rv.Len())
+		for i := range literals {
+			literal, err := sqlQuote(dialect, rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			literals[i] = literal
+		}
+		return strings.Join(literals, ", "), nil
+	}
+	return "", fmt.Errorf("sqlQuote: cannot quote %T", value)
+}
+
+// sqlString quotes a string literal, doubling single quotes in every dialect.
+// MySQL also escapes backslashes and control characters as its default
+// sql_mode requires; doubled quotes stay safe under NO_BACKSLASH_ESCAPES.
+func sqlString(dialect, s string) (string, error) {
+	if strings.ContainsRune(s, 0) && dialect != sqlDialectMySQL {
+		return "", fmt.Errorf("sqlQuote: string contains a NUL character")
+	}
+	if dialect != sqlDialectMySQL {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+	}
+	var out strings.Builder
+	out.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case 0:
+			out.WriteString(`\0`)
+		case '\'':
+			out.WriteString(`''`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case 0x1a:
+			out.WriteString(`\Z`)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('\'')
+	return out.String(), nil
+}
+
+// sqlIdent quotes a table, column or schema name, joining several parts
+// with dots (schema.table)
+func sqlIdent(dialect string, parts []string) (string, error) {
+	if len(parts) == 0 {
+		return "", fmt.Errorf("sqlIdent expects at least one name")
+	}
+	quote := `"`
+	if dialect == sqlDialectMySQL {
+		quote = "`"
+	}
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		if part == "" || strings.ContainsRune(part, 0) {
+			return "", fmt.Errorf("sqlIdent: invalid identifier %q", part)
+		}
+		quoted[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+	return strings.Join(quoted, "."), nil
+}
+
+// sqlDollarTag matches the opening tag of a PostgreSQL dollar-quoted string
+var sqlDollarTag = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+// sqlSyntaxError is the first lexical error of a SQL statement, at a 1-based
+// line and column (in characters)
+type sqlSyntaxError struct {
+	Line, Column int
+	Message      string
+}
+
+func (e *sqlSyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// checkSQL scans rendered SQL in dialect for unterminated string literals,
+// quoted identifiers, dollar-quoted strings and block comments and for
+// unbalanced parentheses,
+// the typical traces of a value interpolated without sqlQuote
+func checkSQL(dialect, sql string) error {
+	src := []rune(sql)
+	errorAt := func(offset int, message string) error {
+		line, column := 1, 1
+		for _, r := range src[:offset] {
+			if r == '\n' {
+				line, column = line+1, 1
+			} else {
+				column++
+			}
+		}
+		return &sqlSyntaxError{Line: line, Column: column, Message: message}
+	}
+	var open []int
+	for i := 0; i < len(src); i++ {
+		r := src[i]
+		switch {
+		case r == '-' && i+1 < len(src) && src[i+1] == '-', r == '#' && dialect == sqlDialectMySQL:
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(string(src[i+2:]), "*/")
+			if end < 0 {
+				return errorAt(i, "unterminated block comment")
+			}
+			i += 2 + len([]rune(string(src[i+2:])[:end])) + 1
+		case r == '\'' || r == '"' || (r == '`' && dialect == sqlDialectMySQL):
+			end := sqlQuotedEnd(src, i, dialect == sqlDialectMySQL && r != '`')
+			if end < 0 {
+				if r == '\'' {
+					return errorAt(i, "unterminated string literal")
+				}
+				return errorAt(i, "unterminated quoted identifier")
+			}
+			i = end
+		case r == '$' && dialect == sqlDialectPostgres && sqlDollarTag.MatchString(string(src[i:min(i+64, len(src))])):
+			tag := sqlDollarTag.FindString(string(src[i:min(i+64, len(src))]))
+			end := strings.Index(string(src[i+len(tag):]), tag)
+			if end < 0 {
+				return errorAt(i, "unterminated dollar-quoted string")
+			}
+			i += len(tag) + len([]rune(string(src[i+len(tag):])[:end])) + len(tag) - 1
+		case r == '(':
+			open = append(open, i)
+		case r == ')':
+			if len(open) == 0 {
+				return errorAt(i, `unexpected ")"`)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return errorAt(open[len(open)-1], `"(" is never closed`)
+	}
+	return nil
+}
+
+// sqlQuotedEnd returns the offset of the quote closing the literal or
+// identifier starting at start, or -1. Doubled quotes are part of the
+// value, as are backslash escapes when backslash is set.
+func sqlQuotedEnd(src []rune, start int, backslash bool) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case backslash && src[i] == '\\':
+			i++
+		case src[i] == quote && i+1 < len(src) && src[i+1] == quote:
+			i++
+		case src[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,84 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLQuote(t *testing.T) {
+	tests := []struct {
+		dialect string
+		value   interface{}
+		want    string
+	}{
+		{sqlDialectPostgres, "O'Brien", `'O''Brien'`},
+		{sqlDialectPostgres, `a\b`, `'a\b'`},
+		{sqlDialectMySQL, "O'Brien\\\n", `'O''Brien\\\n'`},
+		{sqlDialectMySQL, `\' OR 1=1 -- "x"`, `'\\'' OR 1=1 -- "x"'`},
+		{sqlDialectSQLite, "it's", `'it''s'`},
+		{sqlDialectPostgres, nil, "NULL"},
+		{sqlDialectPostgres, true, "TRUE"},
+		{sqlDialectSQLite, false, "0"},
+		{sqlDialectPostgres, float64(12.5), "12.5"},
+		{sqlDialectPostgres, 42, "42"},
+		{sqlDialectPostgres, []interface{}{float64(1), "b"}, "1, 'b'"},
+		{sqlDialectPostgres, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), "'2024-03-01T12:00:00Z'"},
+	}
+	for _, tt := range tests {
+		got, err := sqlQuote(tt.dialect, tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("sqlQuote(%s, %v) = %q, %v; want %q", tt.dialect, tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []interface{}{"a\x00b", []interface{}{}, map[string]interface{}{}} {
+		if _, err := sqlQuote(sqlDialectPostgres, value); err == nil {
+			t.Errorf("sqlQuote(%v) should fail", value)
+		}
+	}
+}
+
+func TestSQLIdent(t *testing.T) {
+	if got, _ := sqlIdent(sqlDialectPostgres, []string{"public", `we"ird`}); got != `"public"."we""ird"` {
+		t.Errorf("sqlIdent(postgres) = %s", got)
+	}
+	if got, _ := sqlIdent(sqlDialectMySQL, []string{"ta`ble"}); got != "`ta``ble`" {
+		t.Errorf("sqlIdent(mysql) = %s", got)
+	}
+	if _, err := sqlIdent(sqlDialectSQLite, []string{""}); err == nil {
+		t.Error("sqlIdent() should reject an empty name")
+	}
+}
+
+func TestCheckSQL(t *testing.T) {
+	valid := []struct{ dialect, sql string }{
+		{sqlDialectPostgres, "SELECT 'it''s', \"col\" FROM t -- it's a comment\nWHERE (a = 1) /* (' */"},
+		{sqlDialectPostgres, "CREATE FUNCTION f() RETURNS int AS $body$ SELECT ')' $body$ LANGUAGE sql"},
+		{sqlDialectMySQL, "SELECT 'O\\'Brien', `col` FROM t # it's"},
+	}
+	for _, tt := range valid {
+		if err := checkSQL(tt.dialect, tt.sql); err != nil {
+			t.Errorf("checkSQL(%q) returned error: %v", tt.sql, err)
+		}
+	}
+
+	invalid := []struct {
+		dialect, sql string
+		line, column int
+		message      string
+	}{
+		{sqlDialectPostgres, "SELECT *\nFROM users WHERE name = 'O'Brien'", 2, 33, "unterminated string literal"},
+		{sqlDialectPostgres, "SELECT count(* FROM t", 1, 13, "never closed"},
+		{sqlDialectPostgres, "SELECT 1) ", 1, 9, "unexpected"},
+		{sqlDialectSQLite, "SELECT 1 /* open", 1, 10, "block comment"},
+		{sqlDialectMySQL, "SELECT `col FROM t", 1, 8, "quoted identifier"},
+	}
+	for _, tt := range invalid {
+		var syntaxErr *sqlSyntaxError
+		err := checkSQL(tt.dialect, tt.sql)
+		if !errors.As(err, &syntaxErr) || syntaxErr.Line != tt.line || syntaxErr.Column != tt.column || !strings.Contains(syntaxErr.Message, tt.message) {
+			t.Errorf("checkSQL(%q) = %v, want line %d, column %d: %s", tt.sql, err, tt.line, tt.column, tt.message)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package render
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Table styles of textTable
+const (
+	tableStyleASCII    = "ascii"
+	tableStyleMarkdown = "markdown"
+	tableStylePlain    = "plain"
+)
+
+// tableColumn is a column of textTable: the path of its values in each row
+// and its header
+type tableColumn struct {
+	Path, Header string
+	numeric      bool
+	width        int
+}
+
+// tableOptions are the settings of textTable
+type tableOptions struct {
+	Columns  []tableColumn
+	Style    string
+	MaxWidth int // Cells wider than this are truncated with an ellipsis; 0 = unlimited
+}
+
+// textTable renders a list of maps or structs as an aligned table for
+// plain-text output. Options precede the rows as key=value strings:
+//
+//	{{textTable .Orders}}
+//	{{textTable "columns=id,customer.name:Customer,total:Total" "style=markdown" "maxWidth=24" .Orders}}
+//
+// columns selects and orders the columns, each a key or dotted path with an
+// optional :Header; by default every map key is a column, in sorted order,
+// or every exported struct field. style is ascii (default), markdown or
+// plain. maxWidth truncates long cells. Numeric columns are right-aligned.
+func textTable(args ...interface{}) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("textTable expects options and a list of rows")
+	}
+	opts, err := parseTableOptions(args[:len(args)-1])
+	if err != nil {
+		return "", err
+	}
+	rows, err := digestItems(args[len(args)-1])
+	if err != nil {
+		return "", fmt.Errorf("textTable: %w", err)
+	}
+	if len(opts.Columns) == 0 {
+		opts.Columns = tableColumns(rows)
+	}
+	if len(opts.Columns) == 0 {
+		return "", nil
+	}
+
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(opts.Columns))
+		for j := range opts.Columns {
+			value, _ := LookupPath(row, opts.Columns[j].Path)
+			cells[i][j] = tableCell(value, opts)
+		}
+	}
+	for j := range opts.Columns {
+		column := &opts.Columns[j]
+		column.Header = tableCell(column.Header, opts)
+		column.width = max(utf8.RuneCountInString(column.Header), 1)
+		column.numeric = len(rows) > 0
+		for i, row := range rows {
+			column.width = max(column.width, utf8.RuneCountInString(cells[i][j]))
+			if value, _ := LookupPath(row, column.Path); value != nil && !isNumber(value) {
+				column.numeric = false
+			}
+		}
+	}
+	return renderTable(opts, cells), nil
+}
+
+// parseTableOptions reads the key=value options of textTable
+func parseTableOptions(args []interface{}) (tableOptions, error) {
+	opts := tableOptions{Style: tableStyleASCII}
+	for _, arg := range args {
+		option, ok := arg.(string)
+		key, value, found := strings.Cut(option, "=")
+		if !ok || !found {
+			return opts, fmt.Errorf("textTable: option %v is not key=value", arg)
+		}
+		switch key {
+		case "columns":
+			for _, spec := range strings.Split(value, ",") {
+				path, header, hasHeader := strings.Cut(strings.TrimSpace(spec), ":")
+				if path == "" {
+					return opts, fmt.Errorf("textTable: empty column in %q", value)
+				}
+				if !hasHeader {
+					header = path
+				}
+				opts.Columns = append(opts.Columns, tableColumn{Path: path, Header: header})
+			}
+		case "style":
+			switch value {
+			case tableStyleASCII, tableStyleMarkdown, tableStylePlain:
+				opts.Style = value
+			default:
+				return opts, fmt.Errorf("textTable: unknown style %q (expected ascii, markdown or plain)", value)
+			}
+		case "maxWidth":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("textTable: invalid maxWidth %q", value)
+			}
+			opts.MaxWidth = n
+		default:
+			return opts, fmt.Errorf("textTable: unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// tableColumns lists the default columns of rows: the union of their map
+// keys in sorted order, or the exported fields of the first struct row
+func tableColumns(rows []interface{}) []tableColumn {
+	seen := make(map[string]bool)
+	var names []string
+	for _, row := range rows {
+		v := reflect.ValueOf(row)
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				break
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			for _, key := range v.MapKeys() {
+				if key.Kind() == reflect.String && !seen[key.String()] {
+					seen[key.String()] = true
+					names = append(names, key.String())
+				}
+			}
+		case reflect.Struct:
+			if len(names) > 0 {
+				continue
+			}
+			for i := 0; i < v.NumField(); i++ {
+				if field := v.Type().Field(i); field.IsExported() {
+					names = append(names, field.Name)
+				}
+			}
+			return columnsNamed(names)
+		}
+	}
+	sort.Strings(names)
+	return columnsNamed(names)
+}
+
+func columnsNamed(names []string) []tableColumn {
+	columns := make([]tableColumn, len(names))
+	for i, name := range names {
+		columns[i] = tableColumn{Path: name, Header: name}
+	}
+	return columns
+}
+
+// tableCell formats a value as a single-line cell
+func tableCell(value interface{}, opts tableOptions) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if opts.MaxWidth > 0 && utf8.RuneCountInString(s) > opts.MaxWidth {
+		s = strings.TrimRight(string([]rune(s)[:max(opts.MaxWidth-1, 0)]), " ") + defaultEllipsis
+	}
+	if opts.Style == tableStyleMarkdown {
+		s = strings.ReplaceAll(s, "|", `\|`)
+	}
+	return s
+}
+
+// isNumber reports whether value is of a numeric type
+func isNumber(value interface{}) bool {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// renderTable writes the header and cells in the table's style
+func renderTable(opts tableOptions, cells [][]string) string {
+	var out strings.Builder
+	pad := func(s string, column tableColumn) string {
+		fill := strings.Repeat(" ", column.width-utf8.RuneCountInString(s))
+		if column.numeric {
+			return fill + s
+		}
+		return s + fill
+	}
+	line := func(values []string) {
+		parts := make([]string, len(opts.Columns))
+		for j, column := range opts.Columns {
+			parts[j] = pad(values[j], column)
+		}
+		if opts.Style == tableStylePlain {
+			out.WriteString(strings.TrimRight(strings.Join(parts, "  "), " "))
+		} else {
+			out.WriteString("| " + strings.Join(parts, " | ") + " |")
+		}
+		out.WriteString("\n")
+	}
+	rule := func() {
+		parts := make([]string, len(opts.Columns))
+		for j, column := range opts.Columns {
+			parts[j] = strings.Repeat("-", column.width+2)
+			if opts.Style == tableStyleMarkdown && column.numeric {
+				parts[j] = parts[j][:column.width+1] + ":"
+			}
+		}
+		corner := "+"
+		if opts.Style == tableStyleMarkdown {
+			corner = "|"
+		}
+		out.WriteString(corner + strings.Join(parts, corner) + corner + "\n")
+	}
+
+	headers := make([]string, len(opts.Columns))
+	for j, column := range opts.Columns {
+		headers[j] = column.Header
+	}
+	if opts.Style == tableStyleASCII {
+		rule()
+	}
+	line(headers)
+	if opts.Style != tableStylePlain {
+		rule()
+	}
+	for _, row := range cells {
+		line(row)
+	}
+	if opts.Style == tableStyleASCII {
+		rule()
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
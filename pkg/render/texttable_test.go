@@ -0,0 +1,66 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTextTableTemplate(t *testing.T) {
+	rows := []interface{}{
+		map[string]interface{}{"id": "A-1", "total": float64(12.5), "customer": map[string]interface{}{"name": "Ada Lovelace"}},
+		map[string]interface{}{"id": "B-22", "total": float64(1300), "customer": map[string]interface{}{"name": "Grace | Hopper"}},
+	}
+	output, err := Render(context.Background(), Request{
+		Text:       `{{textTable "columns=id:Order,customer.name:Customer,total:Total" "style=markdown" "maxWidth=10" .Rows}}`,
+		Parameters: map[string]interface{}{"Rows": rows},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "| Order | Customer    | Total |\n" +
+		"|-------|-------------|------:|\n" +
+		"| A-1   | Ada Lovel…  |  12.5 |\n" +
+		"| B-22  | Grace \\| H… |  1300 |"
+	if output != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, output)
+	}
+}
+
+func TestTextTableStyles(t *testing.T) {
+	type line struct {
+		Item  string
+		Count int
+		note  string
+	}
+	rows := []line{{"Äpfel", 3, ""}, {"Pears", 12, ""}}
+	ascii, err := textTable(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "+-------+-------+\n" +
+		"| Item  | Count |\n" +
+		"+-------+-------+\n" +
+		"| Äpfel |     3 |\n" +
+		"| Pears |    12 |\n" +
+		"+-------+-------+"
+	if ascii != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, ascii)
+	}
+
+	plain, err := textTable("style=plain", []interface{}{
+		map[string]interface{}{"b": "x", "a": "multi\nline"},
+		map[string]interface{}{"c": float64(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a           b  c\nmulti line  x\n               1"; plain != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, plain)
+	}
+
+	for _, args := range [][]interface{}{{}, {"style=html", rows}, {"width", rows}, {"columns=", rows}, {"maxWidth=-1", rows}, {"x"}} {
+		if _, err := textTable(args...); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultEllipsis marks text shortened by the truncate helpers
+const defaultEllipsis = "…"
+
+// htmlVoidElements have no end tag, so truncateHTML never closes them
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// truncateFuncs shorten text for previews without breaking UTF-8, words or
+// markup. The text is the last argument so the helpers work in pipelines,
+// optionally preceded by a custom ellipsis:
+//
+//	{{.Body | truncateWords 20}}
+//	{{truncateChars 140 "..." .Summary}}
+//	{{.Html | truncateHTML 300}}
+func truncateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"truncateChars": truncateChars,
+		"truncateWords": truncateWords,
+		"truncateHTML":  truncateHTML,
+	}
+}
+
+// truncateArgs splits the trailing [ellipsis] text arguments of a truncate helper
+func truncateArgs(name string, args []string) (text, ellipsis string, err error) {
+	switch len(args) {
+	case 1:
+		return args[0], defaultEllipsis, nil
+	case 2:
+		return args[1], args[0], nil
+	}
+	return "", "", fmt.Errorf("%s expects a length, an optional ellipsis and the text", name)
+}
+
+// truncateChars shortens s to at most n characters including the ellipsis,
+// cutting at the last word boundary that fits. A single word longer than
+// the limit is cut between characters.
+func truncateChars(n int, args ...string) (string, error) {
+	s, ellipsis, err := truncateArgs("truncateChars", args)
+	if err != nil {
+		return "", err
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s, nil
+	}
+	keep := max(n-utf8.RuneCountInString(ellipsis), 0)
+	cut := runeOffset(s, keep)
+	return strings.TrimRightFunc(wordBoundary(s, cut), unicode.IsSpace) + ellipsis, nil
+}
+
+// truncateWords keeps the first n words of s, followed by the ellipsis when
+// words were removed. Whitespace between the kept words is preserved.
+func truncateWords(n int, args ...string) (string, error) {
+	s, ellipsis, err := truncateArgs("truncateWords", args)
+	if err != nil {
+		return "", err
+	}
+	words := 0
+	inWord := false
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			inWord = false
+			continue
+		}
+		if !inWord {
+			if words == n {
+				return strings.TrimRightFunc(s[:i], unicode.IsSpace) + ellipsis, nil
+			}
+			words++
+			inWord = true
+		}
+	}
+	return s, nil
+}
+
+// truncateHTML shortens the text of an HTML fragment to at most n
+// characters including the ellipsis, like truncateChars. Tags do not count
+// and are never cut, entities count as one character, tags end words, and
+// elements left open at the cut are closed.
+func truncateHTML(n int, args ...string) (string, error) {
+	s, ellipsis, err := truncateArgs("truncateHTML", args)
+	if err != nil {
+		return "", err
+	}
+	if htmlTextLength(s) <= n {
+		return s, nil
+	}
+	budget := max(n-utf8.RuneCountInString(ellipsis), 0)
+	var open []string
+	count := 0
+	for i := 0; i < len(s); {
+		if s[i] == '<' {
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				break
+			}
+			open = trackElement(open, s[i+1:i+end])
+			i += end + 1
+			continue
+		}
+
+		next := strings.IndexByte(s[i:], '<')
+		if next < 0 {
+			next = len(s) - i
+		}
+		text := s[i : i+next]
+		if cut := htmlTextOffset(text, budget-count); cut >= 0 {
+			kept := wordBoundary(text, cut)
+			if r, _ := utf8.DecodeRuneInString(text[cut:]); count > 0 && len(kept) == cut && !unicode.IsSpace(r) {
+				// The word continues past the cut but started after a tag
+				kept = ""
+			}
+			var out strings.Builder
+			out.WriteString(strings.TrimRightFunc(s[:i]+kept, unicode.IsSpace))
+			out.WriteString(ellipsis)
+			for k := len(open) - 1; k >= 0; k-- {
+				out.WriteString("</" + open[k] + ">")
+			}
+			return out.String(), nil
+		}
+		count += htmlTextLength(text)
+		i += next
+	}
+	return s, nil
+}
+
+// htmlTextLength counts the characters of an HTML fragment outside tags,
+// counting entities as one character
+func htmlTextLength(s string) int {
+	count := 0
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '<':
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				return count
+			}
+			i += end + 1
+			continue
+		case s[i] == '&':
+			if semi := strings.IndexByte(s[i:], ';'); semi > 0 && semi <= 32 {
+				i += semi + 1
+				count++
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		count++
+	}
+	return count
+}
+
+// htmlTextOffset returns the byte offset after n characters of the
+// character data text, or -1 when text holds n characters or fewer
+func htmlTextOffset(text string, n int) int {
+	for j := 0; j < len(text); n-- {
+		if n == 0 {
+			return j
+		}
+		if text[j] == '&' {
+			if semi := strings.IndexByte(text[j:], ';'); semi > 0 && semi <= 32 {
+				j += semi + 1
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text[j:])
+		j += size
+	}
+	return -1
+}
+
+// trackElement updates the stack of open elements for the tag with the given content
+func trackElement(open []string, tag string) []string {
+	if strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "?") {
+		return open
+	}
+	closing := strings.HasPrefix(tag, "/")
+	tag = strings.TrimPrefix(tag, "/")
+	fields := strings.FieldsFunc(tag, func(r rune) bool { return unicode.IsSpace(r) || r == '/' })
+	if len(fields) == 0 {
+		return open
+	}
+	name := strings.ToLower(fields[0])
+	switch {
+	case closing:
+		for k := len(open) - 1; k >= 0; k-- {
+			if open[k] == name {
+				return open[:k]
+			}
+		}
+	case !htmlVoidElements[name] && !strings.HasSuffix(tag, "/"):
+		return append(open, name)
+	}
+	return open
+}
+
+// runeOffset returns the byte offset of the n-th character of s
+func runeOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+// wordBoundary returns s cut at offset, moved back to the end of the last
+// whole word unless the cut already falls between words or the kept text is
+// a single word
+func wordBoundary(s string, offset int) string {
+	if offset >= len(s) {
+		return s
+	}
+	if r, _ := utf8.DecodeRuneInString(s[offset:]); unicode.IsSpace(r) {
+		return s[:offset]
+	}
+	if space := strings.LastIndexFunc(s[:offset], unicode.IsSpace); space > 0 {
+		return s[:space]
+	}
+	return s[:offset]
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTruncateTemplate(t *testing.T) {
+	output, err := Render(context.Background(), Request{
+		Text:       `{{.Body | truncateWords 3}}|{{truncateChars 12 "..." .Body}}`,
+		Parameters: map[string]interface{}{"Body": "The quick  brown fox jumps"},
+	}, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Render() returned error: %v", err)
+	}
+	want := "The quick  brown…|The quick..."
+	if output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
+
+func TestTruncateChars(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{10, "short", "short"},
+		{8, "Grüße aus Köln", "Grüße…"},
+		{5, "日本語のテキスト", "日本語の…"},
+		{6, "Supercalifragilistic", "Super…"},
+		{6, "ab cd", "ab cd"},
+	}
+	for _, tt := range tests {
+		got, err := truncateChars(tt.n, tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("truncateChars(%d, %q) = %q, %v; want %q", tt.n, tt.s, got, err, tt.want)
+		}
+	}
+	if _, err := truncateChars(5); err == nil {
+		t.Error("Expected an error without text")
+	}
+}
+
+func TestTruncateWords(t *testing.T) {
+	if got, _ := truncateWords(2, " one two three "); got != " one two…" {
+		t.Errorf("Unexpected result %q", got)
+	}
+	if got, _ := truncateWords(3, "one two three"); got != "one two three" {
+		t.Errorf("Unexpected result %q", got)
+	}
+}
+
+func TestTruncateHTML(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{40, "<p>Hello <b>world</b></p>", "<p>Hello <b>world</b></p>"},
+		{12, "<p>Hello <b>big world</b> again</p>", "<p>Hello <b>big…</b></p>"},
+		{7, "<p>A &amp; B<br>and more</p>", "<p>A &amp; B<br>…</p>"},
+		{9, "<p>A &amp; B<br>and more</p>", "<p>A &amp; B<br>and…</p>"},
+		{5, "<div><img src=\"a.png\"/>Ünïcödé text</div>", "<div><img src=\"a.png\"/>Ünïc…</div>"},
+		{5, "<p>Hello</p><p></p>", "<p>Hello</p><p></p>"},
+	}
+	for _, tt := range tests {
+		got, err := truncateHTML(tt.n, tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("truncateHTML(%d, %q) = %q, %v; want %q", tt.n, tt.s, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,654 @@
+// gRPC rendering API of the template service. The server listens on
+// TEMPLATE_GRPC_PORT (cleartext HTTP/2) and accepts the same API keys as the
+// HTTP API, sent as "x-api-key" or "authorization: Bearer" metadata.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: templateservice/v1/templateservice.proto
+
+package templateservicev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// RenderRequest names the template by exactly one of text, template_id
+// (file, upload, remote or git identifier) or template_name (stored template).
+type RenderRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Text             string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	TemplateId       string                 `protobuf:"bytes,2,opt,name=template_id,json=templateId,proto3" json:"template_id,omitempty"`
+	TemplateName     string                 `protobuf:"bytes,3,opt,name=template_name,json=templateName,proto3" json:"template_name,omitempty"`
+	TemplateVersion  int32                  `protobuf:"varint,4,opt,name=template_version,json=templateVersion,proto3" json:"template_version,omitempty"` // Stored template version, 0 for the one in effect
+	Parameters       *structpb.Struct       `protobuf:"bytes,5,opt,name=parameters,proto3" json:"parameters,omitempty"`
+	EncodingFormat   string                 `protobuf:"bytes,6,opt,name=encoding_format,json=encodingFormat,proto3" json:"encoding_format,omitempty"` // Default text/plain
+	Delimiters       []string               `protobuf:"bytes,7,rep,name=delimiters,proto3" json:"delimiters,omitempty"`                               // Optional [left, right]
+	MissingKey       string                 `protobuf:"bytes,8,opt,name=missing_key,json=missingKey,proto3" json:"missing_key,omitempty"`             // default, zero or error
+	Partials         map[string]string      `protobuf:"bytes,9,rep,name=partials,proto3" json:"partials,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Layout           string                 `protobuf:"bytes,10,opt,name=layout,proto3" json:"layout,omitempty"`
+	ParametersUpload string                 `protobuf:"bytes,11,opt,name=parameters_upload,json=parametersUpload,proto3" json:"parameters_upload,omitempty"` // Completed upload holding JSON parameters
+	Engine           string                 `protobuf:"bytes,12,opt,name=engine,proto3" json:"engine,omitempty"`                                             // go (default), mustache, handlebars, jinja2 or liquid; may also be named by encoding_format
+	EffectiveDate    string                 `protobuf:"bytes,13,opt,name=effective_date,json=effectiveDate,proto3" json:"effective_date,omitempty"`          // RFC 3339 time or YYYY-MM-DD selecting the stored version in effect, default now
+	ConvertTo        string                 `protobuf:"bytes,14,opt,name=convert_to,json=convertTo,proto3" json:"convert_to,omitempty"`                      // application/pdf to print text/html output to PDF
+	Debug            bool                   `protobuf:"varint,15,opt,name=debug,proto3" json:"debug,omitempty"`                                              // Render with dump and debugJSON; servers must enable debug renders
+	Locale           string                 `protobuf:"bytes,16,opt,name=locale,proto3" json:"locale,omitempty"`                                             // Locale of {{t "key"}} translations, default the server's default locale
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *RenderRequest) Reset() {
+	*x = RenderRequest{}
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderRequest) ProtoMessage() {}
+
+func (x *RenderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderRequest.ProtoReflect.Descriptor instead.
+func (*RenderRequest) Descriptor() ([]byte, []int) {
+	return file_templateservice_v1_templateservice_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RenderRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetTemplateId() string {
+	if x != nil {
+		return x.TemplateId
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetTemplateName() string {
+	if x != nil {
+		return x.TemplateName
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetTemplateVersion() int32 {
+	if x != nil {
+		return x.TemplateVersion
+	}
+	return 0
+}
+
+func (x *RenderRequest) GetParameters() *structpb.Struct {
+	if x != nil {
+		return x.Parameters
+	}
+	return nil
+}
+
+func (x *RenderRequest) GetEncodingFormat() string {
+	if x != nil {
+		return x.EncodingFormat
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetDelimiters() []string {
+	if x != nil {
+		return x.Delimiters
+	}
+	return nil
+}
+
+func (x *RenderRequest) GetMissingKey() string {
+	if x != nil {
+		return x.MissingKey
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetPartials() map[string]string {
+	if x != nil {
+		return x.Partials
+	}
+	return nil
+}
+
+func (x *RenderRequest) GetLayout() string {
+	if x != nil {
+		return x.Layout
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetParametersUpload() string {
+	if x != nil {
+		return x.ParametersUpload
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetEngine() string {
+	if x != nil {
+		return x.Engine
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetEffectiveDate() string {
+	if x != nil {
+		return x.EffectiveDate
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetConvertTo() string {
+	if x != nil {
+		return x.ConvertTo
+	}
+	return ""
+}
+
+func (x *RenderRequest) GetDebug() bool {
+	if x != nil {
+		return x.Debug
+	}
+	return false
+}
+
+func (x *RenderRequest) GetLocale() string {
+	if x != nil {
+		return x.Locale
+	}
+	return ""
+}
+
+type RenderResponse struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Output             []byte                 `protobuf:"bytes,1,opt,name=output,proto3" json:"output,omitempty"`
+	EncodingFormat     string                 `protobuf:"bytes,2,opt,name=encoding_format,json=encodingFormat,proto3" json:"encoding_format,omitempty"`
+	Sha256             string                 `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	ContentUrl         string                 `protobuf:"bytes,4,opt,name=content_url,json=contentUrl,proto3" json:"content_url,omitempty"`
+	Signature          string                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	SignatureAlgorithm string                 `protobuf:"bytes,6,opt,name=signature_algorithm,json=signatureAlgorithm,proto3" json:"signature_algorithm,omitempty"`
+	TemplateCommit     string                 `protobuf:"bytes,7,opt,name=template_commit,json=templateCommit,proto3" json:"template_commit,omitempty"`
+	Suppressed         bool                   `protobuf:"varint,8,opt,name=suppressed,proto3" json:"suppressed,omitempty"` // Output matched the template's suppress options
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *RenderResponse) Reset() {
+	*x = RenderResponse{}
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderResponse) ProtoMessage() {}
+
+func (x *RenderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderResponse.ProtoReflect.Descriptor instead.
+func (*RenderResponse) Descriptor() ([]byte, []int) {
+	return file_templateservice_v1_templateservice_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RenderResponse) GetOutput() []byte {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+func (x *RenderResponse) GetEncodingFormat() string {
+	if x != nil {
+		return x.EncodingFormat
+	}
+	return ""
+}
+
+func (x *RenderResponse) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *RenderResponse) GetContentUrl() string {
+	if x != nil {
+		return x.ContentUrl
+	}
+	return ""
+}
+
+func (x *RenderResponse) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *RenderResponse) GetSignatureAlgorithm() string {
+	if x != nil {
+		return x.SignatureAlgorithm
+	}
+	return ""
+}
+
+func (x *RenderResponse) GetTemplateCommit() string {
+	if x != nil {
+		return x.TemplateCommit
+	}
+	return ""
+}
+
+func (x *RenderResponse) GetSuppressed() bool {
+	if x != nil {
+		return x.Suppressed
+	}
+	return false
+}
+
+type RenderChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Result        *RenderResponse        `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"` // Set on the last message, without output
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenderChunk) Reset() {
+	*x = RenderChunk{}
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderChunk) ProtoMessage() {}
+
+func (x *RenderChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderChunk.ProtoReflect.Descriptor instead.
+func (*RenderChunk) Descriptor() ([]byte, []int) {
+	return file_templateservice_v1_templateservice_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RenderChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *RenderChunk) GetResult() *RenderResponse {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+type ValidateRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Text            string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	TemplateId      string                 `protobuf:"bytes,2,opt,name=template_id,json=templateId,proto3" json:"template_id,omitempty"`
+	TemplateName    string                 `protobuf:"bytes,3,opt,name=template_name,json=templateName,proto3" json:"template_name,omitempty"`
+	TemplateVersion int32                  `protobuf:"varint,4,opt,name=template_version,json=templateVersion,proto3" json:"template_version,omitempty"`
+	Delimiters      []string               `protobuf:"bytes,5,rep,name=delimiters,proto3" json:"delimiters,omitempty"`
+	Partials        map[string]string      `protobuf:"bytes,6,rep,name=partials,proto3" json:"partials,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Layout          string                 `protobuf:"bytes,7,opt,name=layout,proto3" json:"layout,omitempty"`
+	Parameters      *structpb.Struct       `protobuf:"bytes,8,opt,name=parameters,proto3" json:"parameters,omitempty"` // Optional, to report missing variables
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ValidateRequest) Reset() {
+	*x = ValidateRequest{}
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateRequest) ProtoMessage() {}
+
+func (x *ValidateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateRequest.ProtoReflect.Descriptor instead.
+func (*ValidateRequest) Descriptor() ([]byte, []int) {
+	return file_templateservice_v1_templateservice_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ValidateRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *ValidateRequest) GetTemplateId() string {
+	if x != nil {
+		return x.TemplateId
+	}
+	return ""
+}
+
+func (x *ValidateRequest) GetTemplateName() string {
+	if x != nil {
+		return x.TemplateName
+	}
+	return ""
+}
+
+func (x *ValidateRequest) GetTemplateVersion() int32 {
+	if x != nil {
+		return x.TemplateVersion
+	}
+	return 0
+}
+
+func (x *ValidateRequest) GetDelimiters() []string {
+	if x != nil {
+		return x.Delimiters
+	}
+	return nil
+}
+
+func (x *ValidateRequest) GetPartials() map[string]string {
+	if x != nil {
+		return x.Partials
+	}
+	return nil
+}
+
+func (x *ValidateRequest) GetLayout() string {
+	if x != nil {
+		return x.Layout
+	}
+	return ""
+}
+
+func (x *ValidateRequest) GetParameters() *structpb.Struct {
+	if x != nil {
+		return x.Parameters
+	}
+	return nil
+}
+
+type ValidateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Valid         bool                   `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`         // Parse error when not valid
+	Variables     []string               `protobuf:"bytes,3,rep,name=variables,proto3" json:"variables,omitempty"` // Referenced variable paths
+	Missing       []string               `protobuf:"bytes,4,rep,name=missing,proto3" json:"missing,omitempty"`     // Variables absent from the parameters
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidateResponse) Reset() {
+	*x = ValidateResponse{}
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateResponse) ProtoMessage() {}
+
+func (x *ValidateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_templateservice_v1_templateservice_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateResponse.ProtoReflect.Descriptor instead.
+func (*ValidateResponse) Descriptor() ([]byte, []int) {
+	return file_templateservice_v1_templateservice_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ValidateResponse) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+func (x *ValidateResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ValidateResponse) GetVariables() []string {
+	if x != nil {
+		return x.Variables
+	}
+	return nil
+}
+
+func (x *ValidateResponse) GetMissing() []string {
+	if x != nil {
+		return x.Missing
+	}
+	return nil
+}
+
+var File_templateservice_v1_templateservice_proto protoreflect.FileDescriptor
+
+const file_templateservice_v1_templateservice_proto_rawDesc = "" +
+	"\n" +
+	"(templateservice/v1/templateservice.proto\x12\x12templateservice.v1\x1a\x1cgoogle/protobuf/struct.proto\"\x92\x05\n" +
+	"\rRenderRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1f\n" +
+	"\vtemplate_id\x18\x02 \x01(\tR\n" +
+	"templateId\x12#\n" +
+	"\rtemplate_name\x18\x03 \x01(\tR\ftemplateName\x12)\n" +
+	"\x10template_version\x18\x04 \x01(\x05R\x0ftemplateVersion\x127\n" +
+	"\n" +
+	"parameters\x18\x05 \x01(\v2\x17.google.protobuf.StructR\n" +
+	"parameters\x12'\n" +
+	"\x0fencoding_format\x18\x06 \x01(\tR\x0eencodingFormat\x12\x1e\n" +
+	"\n" +
+	"delimiters\x18\a \x03(\tR\n" +
+	"delimiters\x12\x1f\n" +
+	"\vmissing_key\x18\b \x01(\tR\n" +
+	"missingKey\x12K\n" +
+	"\bpartials\x18\t \x03(\v2/.templateservice.v1.RenderRequest.PartialsEntryR\bpartials\x12\x16\n" +
+	"\x06layout\x18\n" +
+	" \x01(\tR\x06layout\x12+\n" +
+	"\x11parameters_upload\x18\v \x01(\tR\x10parametersUpload\x12\x16\n" +
+	"\x06engine\x18\f \x01(\tR\x06engine\x12%\n" +
+	"\x0eeffective_date\x18\r \x01(\tR\reffectiveDate\x12\x1d\n" +
+	"\n" +
+	"convert_to\x18\x0e \x01(\tR\tconvertTo\x12\x14\n" +
+	"\x05debug\x18\x0f \x01(\bR\x05debug\x12\x16\n" +
+	"\x06locale\x18\x10 \x01(\tR\x06locale\x1a;\n" +
+	"\rPartialsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa2\x02\n" +
+	"\x0eRenderResponse\x12\x16\n" +
+	"\x06output\x18\x01 \x01(\fR\x06output\x12'\n" +
+	"\x0fencoding_format\x18\x02 \x01(\tR\x0eencodingFormat\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\tR\x06sha256\x12\x1f\n" +
+	"\vcontent_url\x18\x04 \x01(\tR\n" +
+	"contentUrl\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\tR\tsignature\x12/\n" +
+	"\x13signature_algorithm\x18\x06 \x01(\tR\x12signatureAlgorithm\x12'\n" +
+	"\x0ftemplate_commit\x18\a \x01(\tR\x0etemplateCommit\x12\x1e\n" +
+	"\n" +
+	"suppressed\x18\b \x01(\bR\n" +
+	"suppressed\"]\n" +
+	"\vRenderChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12:\n" +
+	"\x06result\x18\x02 \x01(\v2\".templateservice.v1.RenderResponseR\x06result\"\x93\x03\n" +
+	"\x0fValidateRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1f\n" +
+	"\vtemplate_id\x18\x02 \x01(\tR\n" +
+	"templateId\x12#\n" +
+	"\rtemplate_name\x18\x03 \x01(\tR\ftemplateName\x12)\n" +
+	"\x10template_version\x18\x04 \x01(\x05R\x0ftemplateVersion\x12\x1e\n" +
+	"\n" +
+	"delimiters\x18\x05 \x03(\tR\n" +
+	"delimiters\x12M\n" +
+	"\bpartials\x18\x06 \x03(\v21.templateservice.v1.ValidateRequest.PartialsEntryR\bpartials\x12\x16\n" +
+	"\x06layout\x18\a \x01(\tR\x06layout\x127\n" +
+	"\n" +
+	"parameters\x18\b \x01(\v2\x17.google.protobuf.StructR\n" +
+	"parameters\x1a;\n" +
+	"\rPartialsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"v\n" +
+	"\x10ValidateResponse\x12\x14\n" +
+	"\x05valid\x18\x01 \x01(\bR\x05valid\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12\x1c\n" +
+	"\tvariables\x18\x03 \x03(\tR\tvariables\x12\x18\n" +
+	"\amissing\x18\x04 \x03(\tR\amissing2\x8f\x02\n" +
+	"\x0fTemplateService\x12O\n" +
+	"\x06Render\x12!.templateservice.v1.RenderRequest\x1a\".templateservice.v1.RenderResponse\x12T\n" +
+	"\fRenderStream\x12!.templateservice.v1.RenderRequest\x1a\x1f.templateservice.v1.RenderChunk0\x01\x12U\n" +
+	"\bValidate\x12#.templateservice.v1.ValidateRequest\x1a$.templateservice.v1.ValidateResponseB<Z:templateservice/proto/templateservice/v1;templateservicev1b\x06proto3"
+
+var (
+	file_templateservice_v1_templateservice_proto_rawDescOnce sync.Once
+	file_templateservice_v1_templateservice_proto_rawDescData []byte
+)
+
+func file_templateservice_v1_templateservice_proto_rawDescGZIP() []byte {
+	file_templateservice_v1_templateservice_proto_rawDescOnce.Do(func() {
+		file_templateservice_v1_templateservice_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_templateservice_v1_templateservice_proto_rawDesc), len(file_templateservice_v1_templateservice_proto_rawDesc)))
+	})
+	return file_templateservice_v1_templateservice_proto_rawDescData
+}
+
+var file_templateservice_v1_templateservice_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_templateservice_v1_templateservice_proto_goTypes = []any{
+	(*RenderRequest)(nil),    // 0: templateservice.v1.RenderRequest
+	(*RenderResponse)(nil),   // 1: templateservice.v1.RenderResponse
+	(*RenderChunk)(nil),      // 2: templateservice.v1.RenderChunk
+	(*ValidateRequest)(nil),  // 3: templateservice.v1.ValidateRequest
+	(*ValidateResponse)(nil), // 4: templateservice.v1.ValidateResponse
+	nil,                      // 5: templateservice.v1.RenderRequest.PartialsEntry
+	nil,                      // 6: templateservice.v1.ValidateRequest.PartialsEntry
+	(*structpb.Struct)(nil),  // 7: google.protobuf.Struct
+}
+var file_templateservice_v1_templateservice_proto_depIdxs = []int32{
+	7, // 0: templateservice.v1.RenderRequest.parameters:type_name -> google.protobuf.Struct
+	5, // 1: templateservice.v1.RenderRequest.partials:type_name -> templateservice.v1.RenderRequest.PartialsEntry
+	1, // 2: templateservice.v1.RenderChunk.result:type_name -> templateservice.v1.RenderResponse
+	6, // 3: templateservice.v1.ValidateRequest.partials:type_name -> templateservice.v1.ValidateRequest.PartialsEntry
+	7, // 4: templateservice.v1.ValidateRequest.parameters:type_name -> google.protobuf.Struct
+	0, // 5: templateservice.v1.TemplateService.Render:input_type -> templateservice.v1.RenderRequest
+	0, // 6: templateservice.v1.TemplateService.RenderStream:input_type -> templateservice.v1.RenderRequest
+	3, // 7: templateservice.v1.TemplateService.Validate:input_type -> templateservice.v1.ValidateRequest
+	1, // 8: templateservice.v1.TemplateService.Render:output_type -> templateservice.v1.RenderResponse
+	2, // 9: templateservice.v1.TemplateService.RenderStream:output_type -> templateservice.v1.RenderChunk
+	4, // 10: templateservice.v1.TemplateService.Validate:output_type -> templateservice.v1.ValidateResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_templateservice_v1_templateservice_proto_init() }
+func file_templateservice_v1_templateservice_proto_init() {
+	if File_templateservice_v1_templateservice_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_templateservice_v1_templateservice_proto_rawDesc), len(file_templateservice_v1_templateservice_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_templateservice_v1_templateservice_proto_goTypes,
+		DependencyIndexes: file_templateservice_v1_templateservice_proto_depIdxs,
+		MessageInfos:      file_templateservice_v1_templateservice_proto_msgTypes,
+	}.Build()
+	File_templateservice_v1_templateservice_proto = out.File
+	file_templateservice_v1_templateservice_proto_goTypes = nil
+	file_templateservice_v1_templateservice_proto_depIdxs = nil
+}